@@ -0,0 +1,297 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	llmusage "github.com/kshvakov/agent/pkg/llm/usage"
+	"github.com/kshvakov/agent/pkg/runs"
+	"github.com/kshvakov/agent/pkg/tools"
+)
+
+// dashboardDays is how many days with runs the trend shows.
+const dashboardDays = 14
+
+// dashboardTools is how many failing tools the page lists.
+const dashboardTools = 10
+
+// cmdDashboard serves a page of statistics over the runs directory:
+// success rate, tokens and cost per lab, the tools that fail most, and
+// runs per day. The page is computed on every load, so a reload shows the
+// runs finished since.
+func cmdDashboard(args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: agentctl dashboard [addr]")
+	}
+	addr := "localhost:7071"
+	if len(args) == 1 {
+		addr = args[0]
+	}
+	if err := llmusage.PricesFromEnv(); err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/{$}", func(w http.ResponseWriter, r *http.Request) {
+		d, err := collectDashboard(runs.Root())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := dashboardPage.Execute(w, d); err != nil {
+			fmt.Println("dashboard:", err)
+		}
+	})
+	fmt.Printf("Dashboard of %s at http://%s/ (Ctrl+C to stop)\n", runs.Root(), addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// dashboard is what the page shows.
+type dashboard struct {
+	Root      string
+	Generated time.Time
+	Runs      int
+	Skipped   int // Run directories that could not be read
+	Labs      []*labStats
+	Tools     []*toolStats // Failing ones, most errors first
+	Days      []*dayStats  // Newest first
+}
+
+// labStats is the runs of one lab.
+type labStats struct {
+	Lab        string
+	Runs       int
+	Finished   int // With a status; the rest are running or crashed
+	Succeeded  int
+	Tokens     int
+	Cost       float64
+	Priced     int // Runs whose model has a price
+	LastRun    time.Time
+	LastStatus string
+}
+
+// SuccessRate is the share of finished runs that succeeded, from 0 to 1.
+func (l *labStats) SuccessRate() float64 { return ratio(l.Succeeded, l.Finished) }
+
+func (l *labStats) AvgTokens() int { return l.Tokens / max(l.Runs, 1) }
+
+// AvgCost is the average cost of the priced runs, or "no price".
+func (l *labStats) AvgCost() string {
+	if l.Priced == 0 {
+		return "no price"
+	}
+	return fmt.Sprintf("$%.4f", l.Cost/float64(l.Priced))
+}
+
+// toolStats is the calls of one tool across all runs. A call failed if its
+// result says so, as the agent loop reports tool errors (tools.IsError).
+type toolStats struct {
+	Tool   string
+	Calls  int
+	Errors int
+	Labs   []string
+	Last   string // The last error
+}
+
+func (t *toolStats) ErrorRate() float64 { return ratio(t.Errors, t.Calls) }
+
+// dayStats is the runs started on one day (UTC).
+type dayStats struct {
+	Day       string
+	Runs      int
+	Finished  int
+	Succeeded int
+	Tokens    int
+}
+
+func (d *dayStats) SuccessRate() float64 { return ratio(d.Succeeded, d.Finished) }
+
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
+
+// collectDashboard reads every run under root.
+func collectDashboard(root string) (*dashboard, error) {
+	metas, err := runs.List(root)
+	if err != nil {
+		return nil, err
+	}
+	d := &dashboard{Root: root, Generated: time.Now()}
+	labs := map[string]*labStats{}
+	byTool := map[string]*toolStats{}
+	days := map[string]*dayStats{}
+	for _, m := range metas {
+		a, err := runs.Load(filepath.Join(root, m.ID))
+		if err != nil {
+			d.Skipped++
+			continue
+		}
+		d.Runs++
+		finished := !m.FinishedAt.IsZero()
+		succeeded := m.Status == "success"
+
+		l := labs[m.Lab]
+		if l == nil {
+			l = &labStats{Lab: m.Lab}
+			labs[m.Lab] = l
+		}
+		l.Runs++
+		l.Tokens += a.Usage.TotalTokens
+		if finished {
+			l.Finished++
+		}
+		if succeeded {
+			l.Succeeded++
+		}
+		totals := llmusage.Totals{Requests: a.Usage.Requests, PromptTokens: a.Usage.PromptTokens, CompletionTokens: a.Usage.CompletionTokens}
+		if cost, ok := totals.Cost(m.Model); ok {
+			l.Cost += cost
+			l.Priced++
+		}
+		l.LastRun, l.LastStatus = m.StartedAt, cmp.Or(m.Status, "running?")
+
+		day := m.StartedAt.UTC().Format("2006-01-02")
+		ds := days[day]
+		if ds == nil {
+			ds = &dayStats{Day: day}
+			days[day] = ds
+		}
+		ds.Runs++
+		ds.Tokens += a.Usage.TotalTokens
+		if finished {
+			ds.Finished++
+		}
+		if succeeded {
+			ds.Succeeded++
+		}
+
+		countToolCalls(a, byTool)
+	}
+
+	for _, l := range labs {
+		d.Labs = append(d.Labs, l)
+	}
+	slices.SortFunc(d.Labs, func(a, b *labStats) int { return strings.Compare(a.Lab, b.Lab) })
+	for _, t := range byTool {
+		if t.Errors > 0 {
+			d.Tools = append(d.Tools, t)
+		}
+	}
+	slices.SortFunc(d.Tools, func(a, b *toolStats) int {
+		return cmp.Or(b.Errors-a.Errors, cmp.Compare(b.ErrorRate(), a.ErrorRate()), strings.Compare(a.Tool, b.Tool))
+	})
+	d.Tools = d.Tools[:min(len(d.Tools), dashboardTools)]
+	for _, ds := range days {
+		d.Days = append(d.Days, ds)
+	}
+	slices.SortFunc(d.Days, func(a, b *dayStats) int { return strings.Compare(b.Day, a.Day) })
+	d.Days = d.Days[:min(len(d.Days), dashboardDays)]
+	return d, nil
+}
+
+// countToolCalls adds the tool calls of run a to byTool. A result is
+// matched to its call by the call id.
+func countToolCalls(a *runs.Artifacts, byTool map[string]*toolStats) {
+	names := map[string]string{} // Call id -> tool
+	for _, e := range a.Transcript {
+		for _, tc := range e.Message.ToolCalls {
+			names[tc.ID] = tc.Function.Name
+		}
+		if e.Message.ToolCallID == "" {
+			continue
+		}
+		name := names[e.Message.ToolCallID]
+		if name == "" {
+			continue
+		}
+		t := byTool[name]
+		if t == nil {
+			t = &toolStats{Tool: name}
+			byTool[name] = t
+		}
+		t.Calls++
+		if tools.IsError(e.Message.Content) {
+			t.Errors++
+			t.Last = oneLine(e.Message.Content, 120)
+			if !slices.Contains(t.Labs, a.Meta.Lab) {
+				t.Labs = append(t.Labs, a.Meta.Lab)
+			}
+		}
+	}
+}
+
+var dashboardPage = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"pct":  func(f float64) string { return fmt.Sprintf("%.0f%%", f*100) },
+	"bar":  func(f float64) string { return fmt.Sprintf("%.0f", f*100) },
+	"when": func(t time.Time) string { return t.Local().Format("2006-01-02 15:04") },
+}).Parse(`<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Agent runs</title>
+<style>
+body { font: 14px system-ui, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { padding: 4px 12px; text-align: left; border-bottom: 1px solid #ddd; }
+td.n { text-align: right; font-variant-numeric: tabular-nums; }
+.bar { background: #eee; width: 120px; height: 10px; display: inline-block; }
+.bar span { background: #4a4; height: 10px; display: block; }
+.muted { color: #888; }
+</style>
+</head>
+<body>
+<h1>Agent runs</h1>
+<p class="muted">{{.Runs}} runs in {{.Root}}{{if .Skipped}}, {{.Skipped}} unreadable{{end}}. Computed {{when .Generated}}: reload for new runs.</p>
+{{if not .Runs}}<p>No runs yet. Labs that keep artifacts (04, 06, 13, 14) write them here.</p>{{end}}
+
+{{with .Labs}}
+<h2>Labs</h2>
+<table>
+<tr><th>Lab</th><th>Runs</th><th>Success</th><th></th><th>Avg tokens</th><th>Avg cost</th><th>Last run</th></tr>
+{{range .}}<tr>
+<td>{{.Lab}}</td><td class="n">{{.Runs}}</td>
+<td class="n">{{if .Finished}}{{pct .SuccessRate}}{{else}}-{{end}}</td>
+<td><span class="bar"><span style="width: {{bar .SuccessRate}}%"></span></span></td>
+<td class="n">{{.AvgTokens}}</td><td class="n">{{.AvgCost}}</td>
+<td>{{when .LastRun}} <span class="muted">{{.LastStatus}}</span></td>
+</tr>{{end}}
+</table>
+<p class="muted">Success is counted over finished runs. Cost needs a price for the model (LLM_PRICES).</p>
+{{end}}
+
+<h2>Failing tools</h2>
+{{with .Tools}}
+<table>
+<tr><th>Tool</th><th>Errors</th><th>Calls</th><th>Error rate</th><th>Labs</th><th>Last error</th></tr>
+{{range .}}<tr>
+<td>{{.Tool}}</td><td class="n">{{.Errors}}</td><td class="n">{{.Calls}}</td><td class="n">{{pct .ErrorRate}}</td>
+<td>{{range $i, $l := .Labs}}{{if $i}}, {{end}}{{$l}}{{end}}</td><td class="muted">{{.Last}}</td>
+</tr>{{end}}
+</table>
+{{else}}<p class="muted">No tool returned an error.</p>{{end}}
+
+{{with .Days}}
+<h2>By day</h2>
+<table>
+<tr><th>Day (UTC)</th><th>Runs</th><th>Success</th><th></th><th>Tokens</th></tr>
+{{range .}}<tr>
+<td>{{.Day}}</td><td class="n">{{.Runs}}</td>
+<td class="n">{{if .Finished}}{{pct .SuccessRate}}{{else}}-{{end}}</td>
+<td><span class="bar"><span style="width: {{bar .SuccessRate}}%"></span></span></td>
+<td class="n">{{.Tokens}}</td>
+</tr>{{end}}
+</table>
+{{end}}
+</body>
+</html>
+`))
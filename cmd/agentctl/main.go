@@ -0,0 +1,85 @@
+// Command agentctl works with the artifacts of agent runs (runs/<id>/).
+//
+// Usage:
+//
+//	agentctl list
+//	agentctl replay <run-id>
+//	agentctl diff <run-id-a> <run-id-b>
+//	agentctl export [-o file] [-anonymize [-salt s] [-epsilon e]] <run-id>
+//	agentctl trace <run-id>
+//	agentctl watch [addr]
+//	agentctl dashboard [addr]
+//	agentctl toolserver <tools.yaml> [addr]
+//	agentctl team run [-team name] <file.yaml> <task>
+//	agentctl skill list | enable <name> | disable <name> | test [name...] | robust [-seed n] [-only p,...] [name...]
+//
+// The runs directory is taken from AGENT_RUNS_DIR (default "runs"). watch
+// follows a lab running with AGENT_EVENTS=<addr> live. dashboard serves a
+// page of statistics over all runs: success rate, tokens and cost per lab,
+// failing tools, runs per day. toolserver serves the tools of a
+// tools.yaml over HTTP to agents elsewhere (see pkg/tools/toolserver).
+// team run runs a team of agents defined in a YAML file (see pkg/team).
+// skill manages the skill packs in AGENT_SKILLS_DIR (default
+// "cmd/agentctl/skills", see pkg/skill): enabled ones are attached to the
+// agent team run runs, test runs a skill's evals, and robust runs them
+// again with typos, reordered sentences, Russian words and distractors in
+// the tasks (see pkg/perturb).
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// command is one agentctl subcommand.
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"list":       {"list", cmdList},
+	"replay":     {"replay <run-id>", cmdReplay},
+	"diff":       {"diff <run-id-a> <run-id-b>", cmdDiff},
+	"export":     {"export [-o file] [-anonymize [-salt s] [-epsilon e]] <run-id>", cmdExport},
+	"trace":      {"trace <run-id>", cmdTrace},
+	"watch":      {"watch [addr]", cmdWatch},
+	"dashboard":  {"dashboard [addr]", cmdDashboard},
+	"toolserver": {"toolserver <tools.yaml> [addr]", cmdToolServer},
+	"team":       {teamUsage, cmdTeam},
+	"skill":      {skillUsage, cmdSkill},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "agentctl:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("Usage:\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "  agentctl %s\n", commands[name].usage)
+	}
+	fmt.Fprint(os.Stderr, b.String())
+}
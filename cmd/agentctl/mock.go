@@ -0,0 +1,50 @@
+package main
+
+import (
+	"slices"
+
+	"github.com/kshvakov/agent/pkg/mockllm"
+	"github.com/kshvakov/agent/pkg/perturb"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Offline run: OPENAI_BASE_URL=mock go run ./cmd/agentctl skill test
+// The scripted model works every eval of the shipped skills the way the
+// skill's prompt asks: it lists the files, reads them and answers with the
+// lines that show the cause. It knows an eval by any of a few of its
+// words, so skill robust gets the same answers for noisy tasks, and the
+// script repeats for every variant. team run gets plain-text answers.
+func init() {
+	eval := func(words []string, files []string, answer string) []mockllm.Turn {
+		on := func(req openai.ChatCompletionRequest) bool {
+			return slices.ContainsFunc(words, func(w string) bool { return mockllm.Mentions(w)(req) })
+		}
+		turns := []mockllm.Turn{mockllm.Call("list_files", map[string]any{"path": "."}).If(on)}
+		for _, f := range files {
+			turns = append(turns, mockllm.Call("read_file", map[string]any{"path": f}).If(on))
+		}
+		return append(turns, mockllm.Say(answer).If(on))
+	}
+	evals := slices.Concat(
+		eval([]string{"checkout", "10:05"}, []string{"app.log"},
+			`The database ran out of connections: "10:05:01 ERROR db: pq: sorry, too many clients already (max_connections=100)". `+
+				`The deadline errors and the 500s after it are consequences. Check which application holds the connections.`),
+		eval([]string{"worker.log", "frequent"}, []string{"worker.log"},
+			`"resize image: out of memory" occurs 5 times, "send email: smtp timeout" 2 times. Check the memory limit of the worker.`),
+		eval([]string{"orders", "morning", "collected"}, []string{"explain.txt", "indexes.txt"},
+			`"Seq Scan on orders" with "Filter: (customer_id = 42)" removes 4012455 rows: there is no index on orders.customer_id. `+
+				`Safe fix: CREATE INDEX CONCURRENTLY ON orders (customer_id, created_at).`),
+		eval([]string{"UPDATEs", "accounts", "blocking"}, []string{"activity.txt", "locks.txt"},
+			`pid 4242 blocks them: it is "idle in transaction" since 08:02:11 after "UPDATE accounts ... WHERE id = 7". `+
+				`Find the application that forgot to commit. Risky fix: SELECT pg_terminate_backend(4242).`),
+		eval([]string{"shop", "namespace", "kubectl"}, []string{"pods.txt", "describe-api.txt"},
+			`api-7d9c5b7f4-q8w2x is in CrashLoopBackOff: the last state is "Reason: OOMKilled", "Exit Code: 137", with a memory limit of 128Mi. `+
+				`Raise the memory limit, or look for a leak.`),
+		eval([]string{"pods", "web", "start"}, []string{"pods.txt", "events.txt"},
+			`web-5f7b9d6c8-m2p4k is in ImagePullBackOff: "Failed to pull image "registry.local/web:v2.3.1": manifest unknown". `+
+				`The tag v2.3.1 was never pushed: push it or roll the deployment back to the previous tag.`),
+	)
+	for range 1 + len(perturb.All) {
+		mockllm.Register(evals...)
+	}
+}
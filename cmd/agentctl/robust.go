@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/kshvakov/agent/pkg/llm"
+	llmusage "github.com/kshvakov/agent/pkg/llm/usage"
+	"github.com/kshvakov/agent/pkg/perturb"
+	"github.com/kshvakov/agent/pkg/skill"
+	"github.com/kshvakov/agent/pkg/trace"
+)
+
+// robustTally is how one variant of the tasks did across the evals.
+type robustTally struct {
+	name          string
+	runs, tools   int // Runs; runs that called the right tools
+	answers       int // Runs whose answer had what the eval expects
+	broken        int // Evals the original passes and this variant fails
+	notApplicable int // Tasks this variant leaves as they are
+}
+
+// robustSkills runs every eval of the named skills (all if none) with its
+// task as written and changed by each perturbation (pkg/perturb), and
+// reports how often the agent still picks the right tools and gives the
+// expected answer. It fails if a perturbation breaks an eval that passes
+// as written: the skill depends on the wording.
+func robustSkills(skills []*skill.Skill, args []string) error {
+	fs := flag.NewFlagSet("skill robust", flag.ContinueOnError)
+	seed := fs.Uint64("seed", 1, "seed of the perturbations: the same seed makes the same variants")
+	only := fs.String("only", "", "comma-separated perturbations to apply (default all: typos,reorder,mixed,distractor)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ps := perturb.All
+	if *only != "" {
+		var err error
+		if ps, err = perturb.Find(strings.Split(*only, ",")...); err != nil {
+			return err
+		}
+	}
+	if names := fs.Args(); len(names) > 0 {
+		var picked []*skill.Skill
+		for _, name := range names {
+			s, err := skill.Find(skills, name)
+			if err != nil {
+				return err
+			}
+			picked = append(picked, s)
+		}
+		skills = picked
+	}
+
+	client, err := llm.FromEnv()
+	if err != nil {
+		return err
+	}
+	defer llmusage.Default.Print(os.Stdout)
+	tr, err := trace.FromEnv()
+	if err != nil {
+		return err
+	}
+	defer tr.Close()
+	opts := skill.Options{Client: client, Tools: builtinTools, Trace: tr}
+	ctx := context.Background()
+
+	tallies := []*robustTally{{name: "original"}}
+	for _, p := range ps {
+		tallies = append(tallies, &robustTally{name: p.Name})
+	}
+	for _, s := range skills {
+		fmt.Printf("🧪 %s\n", s.ID())
+		for i, e := range s.Evals {
+			fmt.Printf("   %s\n", oneLine(e.Task, 100))
+			original := s.Run(ctx, e, opts)
+			tallies[0].add(original)
+			printVariant("original", "", original)
+			for j, p := range ps {
+				t := tallies[j+1]
+				// One generator per eval and perturbation: adding a skill
+				// or a perturbation doesn't change the other variants.
+				task := p.Apply(e.Task, rand.New(rand.NewPCG(*seed, uint64(i)<<8|uint64(j))))
+				if task == e.Task {
+					t.notApplicable++
+					fmt.Printf("      %-11s (nothing to change)\n", p.Name)
+					continue
+				}
+				v := e
+				v.Task = task
+				r := s.Run(ctx, v, opts)
+				t.add(r)
+				if original.Passed() && !r.Passed() {
+					t.broken++
+				}
+				printVariant(p.Name, task, r)
+			}
+		}
+		fmt.Println()
+	}
+
+	fmt.Println("Robustness:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  VARIANT\tTOOLS\tANSWERS\tBROKEN\tSKIPPED")
+	broken := 0
+	for _, t := range tallies {
+		fmt.Fprintf(w, "  %s\t%d/%d\t%d/%d\t%d\t%d\n", t.name, t.tools, t.runs, t.answers, t.runs, t.broken, t.notApplicable)
+		broken += t.broken
+	}
+	w.Flush()
+	fmt.Println("  TOOLS: the right tools were called. BROKEN: passes as written, fails with this noise.")
+	if broken > 0 {
+		return fmt.Errorf("noise broke %d eval runs that pass as written", broken)
+	}
+	return nil
+}
+
+func (t *robustTally) add(r skill.Result) {
+	t.runs++
+	if r.ToolsOK() {
+		t.tools++
+	}
+	if r.AnswerOK() {
+		t.answers++
+	}
+}
+
+// printVariant prints the outcome of one run, with the task it got if it
+// is a variant.
+func printVariant(name, task string, r skill.Result) {
+	mark := func(ok bool) string {
+		if ok {
+			return "✅"
+		}
+		return "❌"
+	}
+	fmt.Printf("      %-11s tools %s  answer %s", name, mark(r.ToolsOK()), mark(r.AnswerOK()))
+	if task != "" {
+		fmt.Printf("  %q", oneLine(task, 90))
+	}
+	fmt.Println()
+	switch {
+	case r.Err != nil:
+		fmt.Printf("                  %v\n", r.Err)
+	case !r.Passed():
+		fmt.Printf("                  %s\n", strings.Join(r.Problems, "; "))
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kshvakov/agent/pkg/blobs"
+	"github.com/kshvakov/agent/pkg/runs"
+	"github.com/sashabaranov/go-openai"
+)
+
+// loadRun resolves a run ID (or a path to a run directory) and loads it.
+func loadRun(idOrDir string) (*runs.Artifacts, error) {
+	dir := idOrDir
+	if _, err := os.Stat(filepath.Join(dir, runs.MetaFile)); err != nil {
+		dir = filepath.Join(runs.Root(), idOrDir)
+	}
+	return runs.Load(dir)
+}
+
+func cmdList(args []string) error {
+	metas, err := runs.List(runs.Root())
+	if err != nil {
+		return err
+	}
+	if len(metas) == 0 {
+		fmt.Println("no runs in", runs.Root())
+		return nil
+	}
+	for _, m := range metas {
+		fmt.Printf("%-28s %-28s %-14s %-10s %s\n",
+			m.ID, m.Lab, m.Model, orDash(m.Status), m.StartedAt.Format("2006-01-02 15:04:05"))
+	}
+	return nil
+}
+
+func cmdReplay(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: agentctl replay <run-id>")
+	}
+	a, err := loadRun(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Run %s (%s, %s) — %s\n\n", a.Meta.ID, a.Meta.Lab, a.Meta.Model, orDash(a.Meta.Status))
+	for i, e := range a.Transcript {
+		fmt.Printf("[%d] %s %s\n", i+1, e.Time.Format("15:04:05"), describe(e.Message))
+	}
+	fmt.Printf("\nUsage: %d requests, %d prompt + %d completion = %d tokens\n",
+		a.Usage.Requests, a.Usage.PromptTokens, a.Usage.CompletionTokens, a.Usage.TotalTokens)
+	if a.Report != "" {
+		fmt.Printf("\n--- report.md ---\n%s\n", a.Report)
+	}
+	return nil
+}
+
+func cmdDiff(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: agentctl diff <run-id-a> <run-id-b>")
+	}
+	a, err := loadRun(args[0])
+	if err != nil {
+		return err
+	}
+	b, err := loadRun(args[1])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%-20s %-30s %-30s\n", "", a.Meta.ID, b.Meta.ID)
+	row := func(name string, x, y any) {
+		mark := " "
+		if fmt.Sprint(x) != fmt.Sprint(y) {
+			mark = "*"
+		}
+		fmt.Printf("%s %-18s %-30v %-30v\n", mark, name, x, y)
+	}
+	row("lab", a.Meta.Lab, b.Meta.Lab)
+	row("model", a.Meta.Model, b.Meta.Model)
+	row("status", a.Meta.Status, b.Meta.Status)
+	row("messages", len(a.Transcript), len(b.Transcript))
+	row("requests", a.Usage.Requests, b.Usage.Requests)
+	row("total_tokens", a.Usage.TotalTokens, b.Usage.TotalTokens)
+	row("pipelines", len(a.Pipelines), len(b.Pipelines))
+
+	// Transcripts usually share a prefix; the first divergence is the interesting part.
+	n := min(len(a.Transcript), len(b.Transcript))
+	for i := 0; i < n; i++ {
+		x, y := describe(a.Transcript[i].Message), describe(b.Transcript[i].Message)
+		if x != y {
+			fmt.Printf("\nTranscripts diverge at message %d:\n- %s\n+ %s\n", i+1, x, y)
+			return nil
+		}
+	}
+	if len(a.Transcript) != len(b.Transcript) {
+		fmt.Printf("\nTranscripts share the first %d messages, then one of them ends.\n", n)
+		return nil
+	}
+	fmt.Println("\nTranscripts are identical.")
+	return nil
+}
+
+// bundle is the single-file export format of a run.
+type bundle struct {
+	Meta       runs.Meta         `json:"meta"`
+	Usage      runs.Usage        `json:"usage"`
+	Transcript []runs.Entry      `json:"transcript"`
+	Plan       json.RawMessage   `json:"plan,omitempty"`
+	Pipelines  map[string]string `json:"pipelines,omitempty"`
+	Report     string            `json:"report,omitempty"`
+}
+
+func cmdExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	out := fs.String("o", "", "output file (default: stdout)")
+	anonymize := fs.Bool("anonymize", false, "drop message bodies and hash identifiers")
+	salt := fs.String("salt", os.Getenv("AGENT_ANON_SALT"), "secret salt for identifier hashes, to link exports (with -anonymize; default a random one, not kept)")
+	epsilon := fs.Float64("epsilon", 0, "differential privacy budget for usage metrics; 0 = exact (with -anonymize)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: agentctl export [-o file] [-anonymize [-salt s] [-epsilon e]] <run-id>")
+	}
+	a, err := loadRun(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *anonymize {
+		a = runs.Anonymize(a, runs.AnonymizeOptions{Salt: *salt, Epsilon: *epsilon})
+	}
+
+	b := bundle{
+		Meta:       a.Meta,
+		Usage:      a.Usage,
+		Transcript: a.Transcript,
+		Plan:       a.Plan,
+		Pipelines:  a.Pipelines,
+		Report:     a.Report,
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(b)
+}
+
+// cmdTrace shows the evidence behind the final answer: the merged
+// provenance the answer was written from, and the messages it came from.
+func cmdTrace(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: agentctl trace <run-id>")
+	}
+	a, err := loadRun(args[0])
+	if err != nil {
+		return err
+	}
+
+	answer := -1
+	for i, e := range a.Transcript {
+		if e.Message.Role == openai.ChatMessageRoleAssistant && len(e.Message.ToolCalls) == 0 && e.Meta != nil {
+			answer = i
+		}
+	}
+	if answer < 0 {
+		return fmt.Errorf("run %s has no answer with provenance", a.Meta.ID)
+	}
+	e := a.Transcript[answer]
+	fmt.Printf("Answer [%d] %s\n\n", answer+1, oneLine(e.Message.Content, 160))
+
+	fmt.Println("Evidence:")
+	printMeta(a, *e.Meta, "  ")
+
+	fmt.Println("\nSources:")
+	for i, src := range a.Transcript[:answer] {
+		if src.Meta == nil || src.Message.Role == openai.ChatMessageRoleAssistant {
+			continue // Earlier answers repeat the evidence of their sources
+		}
+		fmt.Printf("  [%d] %s\n", i+1, describe(src.Message))
+		printMeta(a, *src.Meta, "       ")
+	}
+	return nil
+}
+
+// printMeta prints the non-empty fields of meta. Blob references are
+// resolved to files of the run, so the full evidence is one step away.
+func printMeta(a *runs.Artifacts, meta runs.MessageMeta, indent string) {
+	row := func(name string, values []string) {
+		if len(values) > 0 {
+			fmt.Printf("%s%-11s %s\n", indent, name+":", strings.Join(values, ", "))
+		}
+	}
+	row("tools", meta.Tools)
+	row("docs", meta.Docs)
+	var refs []string
+	for _, ref := range meta.Blobs {
+		path := filepath.Join(a.Dir, runs.BlobsDir, strings.TrimPrefix(ref, blobs.Prefix))
+		if info, err := os.Stat(path); err == nil {
+			ref = fmt.Sprintf("%s (%s, %d bytes)", ref, path, info.Size())
+		}
+		refs = append(refs, ref)
+	}
+	row("blobs", refs)
+	if meta.Summarizer != "" {
+		row("summarizer", []string{meta.Summarizer})
+	}
+	row("redactions", meta.Redactions)
+}
+
+// describe renders a message as one line for replay and diff.
+func describe(m openai.ChatCompletionMessage) string {
+	var parts []string
+	if m.Content != "" {
+		parts = append(parts, oneLine(m.Content, 160))
+	}
+	for _, tc := range m.ToolCalls {
+		parts = append(parts, fmt.Sprintf("call %s(%s)", tc.Function.Name, oneLine(tc.Function.Arguments, 80)))
+	}
+	return fmt.Sprintf("%-9s %s", m.Role+":", strings.Join(parts, " | "))
+}
+
+func oneLine(s string, limit int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > limit {
+		return string(r[:limit]) + "…"
+	}
+	return s
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
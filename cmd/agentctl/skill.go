@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/kshvakov/agent/pkg/llm"
+	llmusage "github.com/kshvakov/agent/pkg/llm/usage"
+	"github.com/kshvakov/agent/pkg/skill"
+	"github.com/kshvakov/agent/pkg/trace"
+)
+
+const skillUsage = "skill list | enable <name> | disable <name> | test [name...] | robust [-seed n] [-only p,...] [name...]"
+
+// enabledFile, in the skills directory, lists the enabled skills, one
+// name@version per line.
+const enabledFile = "enabled"
+
+// skillsDir is the directory of skill files (see pkg/skill).
+func skillsDir() string {
+	if dir := os.Getenv("AGENT_SKILLS_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join("cmd", "agentctl", "skills")
+}
+
+// cmdSkill lists, enables, disables and tests skills. An enabled skill
+// is attached to the agent team run gives the task; test runs a skill's
+// evals whether it is enabled or not, and robust runs them again with
+// noise in the tasks.
+func cmdSkill(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: agentctl " + skillUsage)
+	}
+	skills, err := skill.LoadDir(skillsDir())
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "list":
+		return listSkills(skills)
+	case "enable", "disable":
+		if len(args) != 2 {
+			return errors.New("usage: agentctl " + skillUsage)
+		}
+		s, err := skill.Find(skills, args[1])
+		if err != nil {
+			return err
+		}
+		return setEnabled(s, args[0] == "enable")
+	case "test":
+		return testSkills(skills, args[1:])
+	case "robust":
+		return robustSkills(skills, args[1:])
+	}
+	return errors.New("usage: agentctl " + skillUsage)
+}
+
+// readEnabled returns the lines of the enabled file: name@version.
+func readEnabled() ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(skillsDir(), enabledFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// enabledSkills returns the names of the enabled skills. A skill whose
+// version changed after it was enabled is an error: it has to be tested
+// and enabled again, so nobody runs a prompt they haven't seen pass.
+func enabledSkills(skills []*skill.Skill) ([]string, error) {
+	ids, err := readEnabled()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, id := range ids {
+		name, version, _ := strings.Cut(id, "@")
+		s, err := skill.Find(skills, name)
+		if err != nil {
+			return nil, fmt.Errorf("enabled skill %s: %w", id, err)
+		}
+		if s.Version != version {
+			return nil, fmt.Errorf("skill %s changed since it was enabled (%s → %s): run agentctl skill test %s, then skill enable %s",
+				name, version, s.Version, name, name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// setEnabled enables or disables s.
+func setEnabled(s *skill.Skill, on bool) error {
+	ids, err := readEnabled()
+	if err != nil {
+		return err
+	}
+	ids = slices.DeleteFunc(ids, func(id string) bool { return strings.HasPrefix(id, s.Name+"@") })
+	if on {
+		ids = append(ids, s.ID())
+	}
+	slices.Sort(ids)
+	var data []byte
+	for _, id := range ids {
+		data = append(data, id+"\n"...)
+	}
+	if err := os.WriteFile(filepath.Join(skillsDir(), enabledFile), data, 0o644); err != nil {
+		return err
+	}
+	if on {
+		fmt.Printf("✅ %s enabled\n", s.ID())
+	} else {
+		fmt.Printf("%s disabled\n", s.Name)
+	}
+	return nil
+}
+
+func listSkills(skills []*skill.Skill) error {
+	ids, err := readEnabled()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVERSION\tENABLED\tTOOLS\tEVALS\tDESCRIPTION")
+	for _, s := range skills {
+		enabled := "-"
+		for _, id := range ids {
+			if name, version, _ := strings.Cut(id, "@"); name == s.Name {
+				enabled = "yes"
+				if version != s.Version {
+					enabled = "⚠️ " + version + ", test it again"
+				}
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", s.Name, s.Version, enabled, strings.Join(s.Tools, ","), len(s.Evals), s.Description)
+	}
+	return w.Flush()
+}
+
+// testSkills runs the evals of the named skills, all of them if names is
+// empty, and fails if any eval does.
+func testSkills(skills []*skill.Skill, names []string) error {
+	if len(names) > 0 {
+		var picked []*skill.Skill
+		for _, name := range names {
+			s, err := skill.Find(skills, name)
+			if err != nil {
+				return err
+			}
+			picked = append(picked, s)
+		}
+		skills = picked
+	}
+
+	client, err := llm.FromEnv()
+	if err != nil {
+		return err
+	}
+	defer llmusage.Default.Print(os.Stdout)
+	tr, err := trace.FromEnv()
+	if err != nil {
+		return err
+	}
+	defer tr.Close()
+
+	failed := 0
+	for _, s := range skills {
+		fmt.Printf("🧪 %s\n", s.ID())
+		passed := 0
+		for _, r := range s.Test(context.Background(), skill.Options{Client: client, Tools: builtinTools, Trace: tr}) {
+			switch {
+			case r.Err != nil:
+				fmt.Printf("   ❌ %s\n      %v\n", r.Eval.Task, r.Err)
+			case !r.Passed():
+				fmt.Printf("   ❌ %s\n      %s\n", r.Eval.Task, strings.Join(r.Problems, "; "))
+			default:
+				passed++
+				fmt.Printf("   ✅ %s\n", r.Eval.Task)
+			}
+		}
+		fmt.Printf("   %d/%d passed\n\n", passed, len(s.Evals))
+		if passed < len(s.Evals) {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d skills failed their evals", failed, len(skills))
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/agent"
+	"github.com/kshvakov/agent/pkg/llm"
+	llmusage "github.com/kshvakov/agent/pkg/llm/usage"
+	"github.com/kshvakov/agent/pkg/skill"
+	"github.com/kshvakov/agent/pkg/team"
+	"github.com/kshvakov/agent/pkg/tools"
+	"github.com/kshvakov/agent/pkg/tools/docker"
+	"github.com/kshvakov/agent/pkg/tools/files"
+	"github.com/kshvakov/agent/pkg/tools/git"
+	"github.com/kshvakov/agent/pkg/tools/k8s"
+	"github.com/kshvakov/agent/pkg/tools/manifest"
+	"github.com/kshvakov/agent/pkg/tools/prom"
+	"github.com/kshvakov/agent/pkg/tools/ssh"
+	"github.com/kshvakov/agent/pkg/tools/web"
+	"github.com/kshvakov/agent/pkg/trace"
+	"github.com/sashabaranov/go-openai"
+)
+
+const teamUsage = "team run [-team name] <file.yaml> <task>"
+
+// cmdTeam runs a team (or a single agent) defined in a team file (see
+// pkg/team) on a task. The agents can use the tools of builtinTools and
+// the skills in the skills directory; the enabled ones are attached to
+// the agent that gets the task.
+func cmdTeam(args []string) error {
+	if len(args) == 0 || args[0] != "run" {
+		return errors.New("usage: agentctl " + teamUsage)
+	}
+	fs := flag.NewFlagSet("team run", flag.ContinueOnError)
+	name := fs.String("team", "", "team or agent to run; the only team of the file if empty")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		return errors.New("usage: agentctl " + teamUsage)
+	}
+	f, err := team.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	task := strings.Join(fs.Args()[1:], " ")
+	skills, err := skill.LoadDir(skillsDir())
+	if err != nil {
+		return err
+	}
+	enabled, err := enabledSkills(skills)
+	if err != nil {
+		return err
+	}
+
+	// LLM_PROVIDER picks the backend: openai (any OpenAI-compatible server), llamacpp, ollama, anthropic.
+	client, err := llm.FromEnv()
+	if err != nil {
+		return err
+	}
+	defer llmusage.Default.Print(os.Stdout)
+	tr, err := trace.FromEnv()
+	if err != nil {
+		return err
+	}
+	defer tr.Close()
+
+	stdin := bufio.NewReader(os.Stdin)
+	a, err := f.Build(*name, team.Options{
+		Client:  client,
+		Tools:   builtinTools("."),
+		Skills:  skills,
+		Enabled: enabled,
+		Ask: func(who string, _ openai.ToolCall, preview string) bool {
+			fmt.Printf("❓ [%s] Run `%s`? [y/N] ", who, preview)
+			answer, _ := stdin.ReadString('\n')
+			return strings.ToLower(strings.TrimSpace(answer)) == "y"
+		},
+		Trace: tr,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Ctrl+C stops the run after the current step and prints what was done.
+	ctx, stop := agent.Interruptible(context.Background())
+	defer stop()
+	answer, err := a.Run(ctx, task)
+	if err != nil {
+		fmt.Printf("\nSo far:\n%s\n", a.Recap())
+		return err
+	}
+	fmt.Printf("\n🤖 %s\n\n", answer)
+	return nil
+}
+
+// builtinTools is the catalog a team file or a skill can name tools from.
+// The file tools (read_file, list_dir or list_files, write_file) can't
+// leave root (see pkg/tools/files). run_command starts a shell in root,
+// and a shell goes wherever the user of agentctl can: it is not confined,
+// only approved. write_file, run_command, git_commit, git_checkout,
+// http_post, docker_restart, k8s_rollout_restart and ssh_exec are
+// Mutating, so supervised agents ask before each call.
+// AGENT_FS_READ_ONLY=1 leaves out write_file and run_command. The git_*
+// tools are there when root is in a repository; git_commit refuses the
+// branches of AGENT_GIT_PROTECTED ("main,release/*"; main, master and
+// release/* by default, see pkg/tools/git). The docker_* tools talk to the
+// daemon of DOCKER_HOST (see pkg/tools/docker), the k8s_* tools to the
+// cluster of the kubeconfig, if one is found (see pkg/tools/k8s);
+// K8S_READ_ONLY=1 leaves out k8s_rollout_restart. prom_query queries the
+// Prometheus of PROMETHEUS_URL (see pkg/tools/prom). ssh_exec is there when
+// AGENT_SSH_CONFIG names its allowlist (see pkg/tools/ssh). http_get
+// reaches any host unless AGENT_HTTP_ALLOW lists them ("a.com,*.b.com");
+// http_post is there only with the list. AGENT_TOOLS names a tools.yaml
+// whose tools come last and replace a built-in tool of the same name; its
+// medium and high risk tools are Mutating (see pkg/tools/manifest).
+func builtinTools(root string) *tools.Registry {
+	type commandArgs struct {
+		Command string `json:"command" description:"Shell command"`
+	}
+	runCommand := tools.New("run_command", "Run a shell command in the working directory (1 minute limit).", func(ctx context.Context, args commandArgs) (string, error) {
+		ctx, cancel := context.WithTimeout(ctx, time.Minute)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, "sh", "-c", args.Command)
+		cmd.Dir = root
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("%w\n%s", err, truncate(string(out), 4<<10))
+		}
+		return truncate(string(out), 8<<10), nil
+	})
+	runCommand.Mutating = true
+	runCommand.Preview = tools.PreviewOf(func(args commandArgs) string { return "$ " + args.Command })
+	readOnly := os.Getenv("AGENT_FS_READ_ONLY") == "1"
+	reg := tools.NewRegistry()
+	if !readOnly { // A shell writes where it likes
+		reg.Register(runCommand)
+	}
+	if sb, err := files.Open(root); err != nil {
+		fmt.Fprintf(os.Stderr, "agentctl: the file tools are off: %v\n", err)
+	} else {
+		sb.ReadOnly = readOnly
+		for _, t := range files.Tools(sb) {
+			reg.Register(t)
+			if t.Name == "list_dir" {
+				t.Name = "list_files" // The name older team files and skills use
+				reg.Register(t)
+			}
+		}
+	}
+	if repo, err := git.Open(root); err == nil {
+		if list := os.Getenv("AGENT_GIT_PROTECTED"); list != "" {
+			repo.Protected = strings.Split(list, ",")
+		}
+		for _, t := range git.Tools(repo) {
+			reg.Register(t)
+		}
+	}
+	var allow []string
+	if list := os.Getenv("AGENT_HTTP_ALLOW"); list != "" {
+		allow = strings.Split(list, ",")
+	}
+	for _, t := range web.Tools(web.Config{Allow: allow}) {
+		if t.Name == "http_post" && allow == nil {
+			continue // A POST anywhere is too much without an allowlist
+		}
+		reg.Register(t)
+	}
+	if c, err := docker.FromEnv(); err == nil {
+		for _, t := range docker.Tools(c) {
+			reg.Register(t)
+		}
+	}
+	if c, err := k8s.FromEnv(); err == nil {
+		for _, t := range k8s.Tools(c, os.Getenv("K8S_READ_ONLY") == "1") {
+			reg.Register(t)
+		}
+	}
+	if c, err := prom.FromEnv(); err == nil {
+		reg.Register(prom.Tool(c))
+	}
+	if path := os.Getenv("AGENT_SSH_CONFIG"); path != "" {
+		cfg, err := ssh.LoadConfig(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "agentctl: ssh_exec is off: %v\n", err)
+		} else {
+			reg.Register(ssh.Tool(cfg))
+		}
+	}
+	if path := os.Getenv("AGENT_TOOLS"); path != "" {
+		ts, err := manifest.Load(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "agentctl: the tools of %s are off: %v\n", path, err)
+		}
+		for _, t := range ts {
+			reg.Register(t)
+		}
+	}
+	return reg
+}
+
+// truncate cuts s to n bytes and says so.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + fmt.Sprintf("\n... (%d more bytes)", len(s)-n)
+}
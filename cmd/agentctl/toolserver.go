@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/kshvakov/agent/pkg/tools"
+	"github.com/kshvakov/agent/pkg/tools/manifest"
+	"github.com/kshvakov/agent/pkg/tools/toolserver"
+)
+
+// cmdToolServer serves the tools of a manifest (pkg/tools/manifest) over
+// HTTP with the protocol of Lab 12 (pkg/tools/toolserver), so agents on
+// other hosts can call them: lab14 loads them with AGENT_TOOL_SERVER set.
+func cmdToolServer(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("usage: agentctl toolserver <tools.yaml> [addr]")
+	}
+	addr := "localhost:8080"
+	if len(args) == 2 {
+		addr = args[1]
+	}
+	ts, err := manifest.Load(args[0])
+	if err != nil {
+		return err
+	}
+	reg := tools.NewRegistry(ts...)
+	fmt.Printf("Tool server at http://%s/ with %d tools from %s (Ctrl+C to stop)\n", addr, reg.Len(), args[0])
+	return http.ListenAndServe(addr, toolserver.Handler(reg, log.Printf))
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/trace"
+)
+
+// cmdWatch follows the live events of a running lab started with
+// AGENT_EVENTS=<addr>, one line per event, and prints the counts when
+// the run ends.
+func cmdWatch(args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: agentctl watch [addr]")
+	}
+	addr := cmp.Or(os.Getenv("AGENT_EVENTS"), "localhost:7070")
+	if len(args) == 1 {
+		addr = args[0]
+	}
+	resp, err := http.Get("http://" + addr + "/events")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", addr, resp.Status)
+	}
+	fmt.Printf("Watching %s (Ctrl+C to stop)\n", addr)
+
+	counts := map[string]int{}
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		data, ok := bytes.CutPrefix(sc.Bytes(), []byte("data: "))
+		if !ok {
+			continue // "event:" lines and the blank line after each event
+		}
+		var e map[string]any
+		if err := json.Unmarshal(data, &e); err != nil {
+			continue
+		}
+		name, _ := e["msg"].(string)
+		counts[name]++
+		fmt.Println(describeEvent(e))
+	}
+
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Println("\nRun ended. Events:")
+	for _, name := range names {
+		fmt.Printf("  %-13s %d\n", name, counts[name])
+	}
+	return sc.Err()
+}
+
+// describeEvent formats an event as one line: time, agent, name and the
+// attrs that matter for its kind.
+func describeEvent(e map[string]any) string {
+	var b strings.Builder
+	if t, err := time.Parse(time.RFC3339Nano, fmt.Sprint(e["time"])); err == nil {
+		b.WriteString(t.Local().Format("15:04:05 "))
+	}
+	if agent, ok := e["agent"]; ok {
+		fmt.Fprintf(&b, "[%v] ", agent)
+	}
+	name := fmt.Sprint(e["msg"])
+	fmt.Fprintf(&b, "%-13s step %v", name, e["step"])
+	switch name {
+	case trace.EventLLMRequest:
+		fmt.Fprintf(&b, "  %v  %v+%v tokens", e["model"], e["prompt_tokens"], e["completion_tokens"])
+	case trace.EventToolCall:
+		fmt.Fprintf(&b, "  %v %s", e["tool"], oneLine(fmt.Sprint(e["args"]), 80))
+	case trace.EventToolResult:
+		fmt.Fprintf(&b, "  %v %v bytes", e["tool"], e["bytes"])
+	case trace.EventFinalAnswer:
+		fmt.Fprintf(&b, "  %s", oneLine(fmt.Sprint(e["answer"]), 120))
+	}
+	if err, ok := e["error"]; ok {
+		fmt.Fprintf(&b, "  error: %v", err)
+	}
+	return b.String()
+}
@@ -0,0 +1,266 @@
+// Command agentlab lists and runs the labs from the repository root, with
+// the model settings as flags instead of edited constants.
+//
+// Usage:
+//
+//	agentlab list
+//	agentlab run [-model m] [-base-url u] [-provider p] [-temperature t] [-max-steps n] [-strict] [-structured] [-mock] [-record file | -replay file] <lab> [lab flags...]
+//
+// <lab> is a lab directory or its number: lab06-incident, lab06, 06, 6.
+// Everything after it goes to the lab: agentlab run -mock lab06 -scenario cert.
+//
+// The flags are passed to the lab as the variables pkg/llm and pkg/agent
+// read (LLM_MODEL, OPENAI_BASE_URL, LLM_PROVIDER, LLM_TEMPERATURE,
+// AGENT_MAX_STEPS, AGENT_STRICT, AGENT_STRUCTURED_RESULTS, LLM_RECORD,
+// LLM_REPLAY), so a lab run by hand with them behaves the same. -max-steps,
+// -strict and -structured apply to the labs built on pkg/agent.
+// -record saves the model's replies to a cassette file, -replay answers
+// from one instead of a model: agentlab run -replay labs/lab08-multi-agent/testdata/golden.json 08.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// command is one agentlab subcommand.
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+const runUsage = "run [-model m] [-base-url u] [-provider p] [-temperature t] [-max-steps n] [-strict] [-structured] [-mock] [-record file | -replay file] <lab> [lab flags...]"
+
+var commands = map[string]command{
+	"list": {"list", cmdList},
+	"run":  {runUsage, cmdRun},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		if exit, ok := err.(*exec.ExitError); ok {
+			os.Exit(exit.ExitCode()) // The lab has printed its error already
+		}
+		fmt.Fprintln(os.Stderr, "agentlab:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("Usage:\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "  agentlab %s\n", commands[name].usage)
+	}
+	fmt.Fprint(os.Stderr, b.String())
+}
+
+func cmdList(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: agentlab list")
+	}
+	root, err := findRoot()
+	if err != nil {
+		return err
+	}
+	labs, err := listLabs(root)
+	if err != nil {
+		return err
+	}
+	for _, dir := range labs {
+		offline := ""
+		if _, err := os.Stat(filepath.Join(root, "labs", dir, "mock.go")); err == nil {
+			offline = "  [-mock]"
+		}
+		fmt.Printf("%-28s %s%s\n", dir, labTitle(filepath.Join(root, "labs", dir)), offline)
+	}
+	return nil
+}
+
+func cmdRun(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	model := fs.String("model", "", "model name (LLM_MODEL)")
+	baseURL := fs.String("base-url", "", "OpenAI-compatible API base URL (OPENAI_BASE_URL)")
+	provider := fs.String("provider", "", "openai | llamacpp | ollama | anthropic (LLM_PROVIDER)")
+	temperature := fs.String("temperature", "", "sampling temperature of every request, 0 to 2 (LLM_TEMPERATURE)")
+	maxSteps := fs.Int("max-steps", 0, "LLM calls per agent run (AGENT_MAX_STEPS)")
+	strict := fs.Bool("strict", false, "fail the run on the first unknown tool, invalid arguments or cut-off reply instead of recovering (AGENT_STRICT)")
+	structured := fs.Bool("structured", false, "send tool results to the model as JSON with a status, data, error and hint (AGENT_STRUCTURED_RESULTS)")
+	mock := fs.Bool("mock", false, "run against the lab's scripted model (OPENAI_BASE_URL=mock)")
+	record := fs.String("record", "", "save every request and reply to this cassette file (LLM_RECORD)")
+	replay := fs.String("replay", "", "answer from this cassette file instead of a model (LLM_REPLAY)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		return fmt.Errorf("usage: agentlab %s", runUsage)
+	}
+	if *mock && *baseURL != "" {
+		return fmt.Errorf("-mock and -base-url exclude each other")
+	}
+	if *temperature != "" {
+		if t, err := strconv.ParseFloat(*temperature, 32); err != nil || t < 0 || t > 2 {
+			return fmt.Errorf("-temperature %q: want a number from 0 to 2", *temperature)
+		}
+	}
+	if *maxSteps < 0 {
+		return fmt.Errorf("-max-steps must be positive")
+	}
+	if *record != "" && *replay != "" {
+		return fmt.Errorf("-record and -replay exclude each other")
+	}
+	// The lab runs in another directory: paths are taken from here.
+	for _, path := range []*string{record, replay} {
+		if *path != "" {
+			abs, err := filepath.Abs(*path)
+			if err != nil {
+				return err
+			}
+			*path = abs
+		}
+	}
+
+	root, err := findRoot()
+	if err != nil {
+		return err
+	}
+	dir, err := resolveLab(root, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	env := os.Environ()
+	set := func(key, value string) {
+		if value != "" {
+			env = append(env, key+"="+value)
+		}
+	}
+	set("LLM_MODEL", *model)
+	set("OPENAI_BASE_URL", *baseURL)
+	set("LLM_PROVIDER", *provider)
+	set("LLM_TEMPERATURE", *temperature)
+	if *maxSteps > 0 {
+		set("AGENT_MAX_STEPS", strconv.Itoa(*maxSteps))
+	}
+	if *strict {
+		set("AGENT_STRICT", "1")
+	}
+	if *structured {
+		set("AGENT_STRUCTURED_RESULTS", "1")
+	}
+	if *mock {
+		set("OPENAI_BASE_URL", "mock")
+	}
+	set("LLM_RECORD", *record)
+	set("LLM_REPLAY", *replay)
+
+	// Labs of the root module run from the root, so their run artifacts
+	// land in the same runs/ directory. A lab with its own go.mod (Lab 09)
+	// has to be run from its directory.
+	cmd := exec.Command("go", append([]string{"run", "./labs/" + dir}, fs.Args()[1:]...)...)
+	cmd.Dir = root
+	if _, err := os.Stat(filepath.Join(root, "labs", dir, "go.mod")); err == nil {
+		cmd.Args = append([]string{"go", "run", "."}, fs.Args()[1:]...)
+		cmd.Dir = filepath.Join(root, "labs", dir)
+	}
+	cmd.Env = env
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// findRoot returns the repository root: the nearest directory up from the
+// working directory that has labs/ in it.
+func findRoot() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if fi, err := os.Stat(filepath.Join(dir, "labs")); err == nil && fi.IsDir() {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no labs/ directory here or above: run agentlab inside the course repository")
+		}
+		dir = parent
+	}
+}
+
+// listLabs returns the lab directories in order.
+func listLabs(root string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(root, "labs"))
+	if err != nil {
+		return nil, err
+	}
+	var labs []string
+	for _, e := range entries {
+		if e.IsDir() && strings.HasPrefix(e.Name(), "lab") {
+			labs = append(labs, e.Name())
+		}
+	}
+	return labs, nil
+}
+
+// resolveLab finds the lab directory for a name: the directory itself,
+// "lab06", "06" or "6".
+func resolveLab(root, name string) (string, error) {
+	labs, err := listLabs(root)
+	if err != nil {
+		return "", err
+	}
+	want := strings.TrimPrefix(strings.TrimSuffix(name, "/"), "labs/")
+	if n, err := strconv.Atoi(strings.TrimPrefix(want, "lab")); err == nil {
+		want = fmt.Sprintf("lab%02d", n)
+	}
+	for _, dir := range labs {
+		if dir == want || strings.HasPrefix(dir, want+"-") {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("no lab %q (see agentlab list)", name)
+}
+
+// labTitle returns the title from the first heading of the lab's README:
+// "# Lab 06: Incident Management (Advanced Planning)" → "Incident
+// Management (Advanced Planning)".
+func labTitle(dir string) string {
+	f, err := os.Open(filepath.Join(dir, "README.md"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if line, ok := strings.CutPrefix(s.Text(), "# "); ok {
+			if _, title, ok := strings.Cut(line, ": "); ok {
+				return title
+			}
+			return line
+		}
+	}
+	return ""
+}
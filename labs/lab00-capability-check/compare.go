@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/yaml"
+)
+
+// --- Comparing models (-models models.yaml) ---
+//
+// Picking a local model means running the suite against each candidate
+// and comparing the reports by eye. With -models the lab does it: it runs
+// the suite against every model in the file and prints one matrix, a
+// column per model.
+
+// modelsFile is the -models file.
+type modelsFile struct {
+	Models []modelEntry `json:"models"`
+}
+
+// modelEntry is one model to test. Provider, model and base URL become
+// the environment variables llm.FromEnv reads, as if they were set for a
+// plain run; env sets any others (API keys, LLAMACPP_GRAMMAR, ...).
+type modelEntry struct {
+	Name     string            `json:"name"`
+	Provider string            `json:"provider"`
+	Model    string            `json:"model"`
+	BaseURL  string            `json:"base_url"`
+	Env      map[string]string `json:"env"`
+}
+
+// baseURLVar is the variable each provider reads its base URL from.
+var baseURLVar = map[string]string{
+	"":          "OPENAI_BASE_URL",
+	"openai":    "OPENAI_BASE_URL",
+	"llamacpp":  "LLAMACPP_BASE_URL",
+	"llama.cpp": "LLAMACPP_BASE_URL",
+	"ollama":    "OLLAMA_HOST",
+	"anthropic": "ANTHROPIC_BASE_URL",
+}
+
+// environ returns the variables to set for the entry.
+func (m modelEntry) environ() (map[string]string, error) {
+	env := map[string]string{}
+	for k, v := range m.Env {
+		env[k] = v
+	}
+	if m.Provider != "" {
+		env["LLM_PROVIDER"] = m.Provider
+	}
+	if m.Model != "" {
+		env["LLM_MODEL"] = m.Model
+	}
+	if m.BaseURL != "" {
+		name, ok := baseURLVar[strings.ToLower(m.Provider)]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown provider %q (want openai, llamacpp, ollama or anthropic)", m.Name, m.Provider)
+		}
+		env[name] = m.BaseURL
+	}
+	return env, nil
+}
+
+// withEnv sets env for the duration of run and then restores what was there.
+func withEnv(env map[string]string, run func()) {
+	type saved struct {
+		value string
+		ok    bool
+	}
+	old := map[string]saved{}
+	for k, v := range env {
+		value, ok := os.LookupEnv(k)
+		old[k] = saved{value, ok}
+		os.Setenv(k, v)
+	}
+	defer func() {
+		for k, s := range old {
+			if s.ok {
+				os.Setenv(k, s.value)
+			} else {
+				os.Unsetenv(k)
+			}
+		}
+	}()
+	run()
+}
+
+// compareModels runs the suite against every model in the file at path
+// and prints the matrix.
+func compareModels(ctx context.Context, path string, trials int) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var f modelsFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if len(f.Models) == 0 {
+		return fmt.Errorf("%s: no models", path)
+	}
+	for i, m := range f.Models {
+		if m.Name == "" {
+			f.Models[i].Name = m.Model
+		}
+		if f.Models[i].Name == "" {
+			return fmt.Errorf("%s: model %d has neither a name nor a model", path, i+1)
+		}
+	}
+
+	results := make([][]Rate, len(f.Models))
+	for i, m := range f.Models {
+		fmt.Printf("\n🔬 [%d/%d] %s\n", i+1, len(f.Models), m.Name)
+		env, err := m.environ()
+		if err != nil {
+			return err
+		}
+		withEnv(env, func() {
+			client, err := llm.FromEnv()
+			if err != nil {
+				fmt.Println("   ", err)
+				return
+			}
+			fmt.Printf("Endpoint: %v\n", client)
+			if results[i], err = runTrials(ctx, client, trials); err != nil {
+				fmt.Println("   ", err)
+			}
+		})
+	}
+	printMatrix(f.Models, results)
+	return nil
+}
+
+// contextSize finds the window in the details of the context probe.
+var contextSize = regexp.MustCompile(`taken whole: (\d+k)`)
+
+// printMatrix prints a row per test and a column per model, then the
+// model that passed the most tests. With -trials a cell has the pass rate,
+// and a test passes only if it passed every time.
+func printMatrix(models []modelEntry, results [][]Rate) {
+	fmt.Println("\n📋 COMPARISON:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprint(w, "Test")
+	for _, m := range models {
+		fmt.Fprintf(w, "\t%s", m.Name)
+	}
+	fmt.Fprintln(w)
+
+	var names []string
+	for _, r := range results {
+		if len(r) > len(names) {
+			names = names[:0]
+			for _, t := range r {
+				names = append(names, t.Name)
+			}
+		}
+	}
+	passed := make([]int, len(models))
+	for row, name := range names {
+		fmt.Fprint(w, name)
+		for i, r := range results {
+			cell := "-" // The client couldn't be created
+			if row < len(r) {
+				cell = "❌"
+				switch {
+				case r[row].Stable():
+					cell = "✅"
+					passed[i]++
+				case r[row].Passes > 0:
+					cell = "⚠️"
+				}
+				if r[row].Trials > 1 {
+					cell += fmt.Sprintf(" %d/%d", r[row].Passes, r[row].Trials)
+				}
+				if m := contextSize.FindStringSubmatch(r[row].Last.Details); m != nil {
+					cell += " " + m[1]
+				}
+			}
+			fmt.Fprintf(w, "\t%s", cell)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprint(w, "Passed")
+	for i := range models {
+		fmt.Fprintf(w, "\t%d/%d", passed[i], len(names))
+	}
+	fmt.Fprintln(w)
+	w.Flush()
+
+	if len(names) == 0 {
+		fmt.Println("\n⚠️ No model could be reached.")
+		return
+	}
+	best := 0
+	for i := range models {
+		if passed[i] > passed[best] {
+			best = i
+		}
+	}
+	fmt.Printf("\n🏆 Most capable: %s (%d/%d). Details of every test are above, per model.\n", models[best].Name, passed[best], len(names))
+}
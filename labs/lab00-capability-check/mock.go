@@ -0,0 +1,55 @@
+package main
+
+import (
+	"regexp"
+
+	"github.com/kshvakov/agent/pkg/mockllm"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Offline run: OPENAI_BASE_URL=mock go run .
+// The scripted model passes every test, so a failure points at the lab code.
+func init() {
+	mockllm.Register(
+		mockllm.Say("Hello World"),
+		mockllm.Say("Apple"),
+		mockllm.Say(`{"status": "ok"}`),
+		mockllm.Call("test_tool", map[string]any{"foo": "bar"}).If(mockllm.HasTools),
+		mockllm.Say(`{"name": "web-01", "cpu_cores": 4, "tags": ["nginx", "prod"]}`).If(mockllm.JSONMode),
+	)
+	// The context probe: the code word comes back while the prompt fits
+	// (MOCK_CONTEXT_WINDOW=5000 makes the 8k prompt fail).
+	for range probeSizes {
+		mockllm.Register(mockllm.Turn{Reply: func(req openai.ChatCompletionRequest) mockllm.Turn {
+			return mockllm.Say(codeWord.FindString(mockllm.LastUser(req)))
+		}}.If(mockllm.Mentions("code word")))
+	}
+	// The tool chain: list the releases, then roll back to the previous
+	// one, read from the tool result.
+	mockllm.Register(
+		mockllm.Call("list_releases", map[string]any{"service": "payment"}).If(mockllm.Offers("list_releases")),
+		mockllm.Turn{Reply: func(req openai.ChatCompletionRequest) mockllm.Turn {
+			previous := previousRelease.FindStringSubmatch(mockllm.LastToolResult(req))
+			if previous == nil {
+				return mockllm.Say("I could not find the previous release.")
+			}
+			return mockllm.Call("rollback", map[string]any{"service": "payment", "version": previous[1]})
+		}}.If(mockllm.Offers("rollback")),
+
+		// The schema fidelity test: every field, and nothing else.
+		mockllm.Call("scale_deployment", map[string]any{
+			"target":   map[string]any{"service": "checkout", "environment": "production"},
+			"replicas": 6,
+			"strategy": "rolling",
+			"notify": []any{
+				map[string]any{"channel": "slack", "to": "#payments"},
+				map[string]any{"channel": "email", "to": "oncall@example.com"},
+			},
+		}).If(mockllm.Offers("scale_deployment")),
+	)
+}
+
+var (
+	codeWord        = regexp.MustCompile(`PELICAN-\d+`)
+	previousRelease = regexp.MustCompile(`(\S+) \(previous\)`)
+)
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kshvakov/agent/pkg/llm"
+)
+
+// --- Pass rates (-trials N) ---
+//
+// A local model doesn't answer the same prompt the same way twice, even
+// at temperature 0: batching and GPU arithmetic change the odds. A test
+// it passed once may fail on the next run, and in a lab that is the run
+// that matters. With -trials the suite runs N times and each test gets a
+// pass rate, not a verdict from one try.
+
+// Rate is the result of a test over several trials.
+type Rate struct {
+	Name   string
+	Passes int
+	Trials int
+	Last   TestResult // The last failure, or the last run if none failed
+}
+
+// Stable reports whether the test passed every time.
+func (r Rate) Stable() bool { return r.Passes == r.Trials }
+
+func (r Rate) String() string {
+	return fmt.Sprintf("%d/%d (%.0f%%)", r.Passes, r.Trials, 100*float64(r.Passes)/float64(r.Trials))
+}
+
+// runTrials runs the suite n times, the first time against client, then
+// against a new client each time (a mock model starts its script again).
+func runTrials(ctx context.Context, client llm.Provider, n int) ([]Rate, error) {
+	var rates []Rate
+	for trial := 1; trial <= n; trial++ {
+		if trial > 1 {
+			var err error
+			if client, err = llm.FromEnv(); err != nil {
+				return nil, err
+			}
+		}
+		if n > 1 {
+			fmt.Printf("\n🎲 Trial %d/%d\n", trial, n)
+		}
+		for i, r := range runSuite(ctx, client) {
+			if i == len(rates) {
+				rates = append(rates, Rate{Name: r.Name})
+			}
+			rates[i].Trials++
+			if r.Passed {
+				rates[i].Passes++
+			}
+			if !r.Passed || rates[i].Stable() {
+				rates[i].Last = r
+			}
+		}
+	}
+	return rates, nil
+}
+
+// printRates prints the pass rate of every test, with the last failure of
+// the ones that failed, and the verdict.
+func printRates(rates []Rate) {
+	fmt.Println("\n📋 PASS RATES:")
+	stable, flaky := true, false
+	for _, r := range rates {
+		icon := "✅"
+		switch {
+		case r.Passes == 0:
+			icon, stable = "❌", false
+		case !r.Stable():
+			icon, stable, flaky = "⚠️", false, true
+		}
+		fmt.Printf("%s %s: %s\n", icon, r.Name, r)
+		if !r.Stable() {
+			fmt.Printf("   Last failure: %s\n", r.Last.Details)
+		}
+	}
+
+	switch {
+	case stable:
+		fmt.Println("\n🎉 EXCELLENT! This model passed every test every time.")
+	case flaky:
+		fmt.Println("\n⚠️ FLAKY! Some tests pass only some of the time: expect the labs that rely on them to fail now and then. Try a larger model or a lower quantization.")
+	default:
+		fmt.Println("\n⚠️ WARNING! This model has limitations. Some labs might fail.")
+	}
+}
@@ -1,15 +1,22 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/kshvakov/agent/pkg/session"
 	"github.com/sashabaranov/go-openai"
 )
 
 func main() {
+	stream := flag.Bool("stream", false, "print the reply as it is generated instead of all at once")
+	sessionID := flag.String("session-id", "", "resume the conversation with this id; empty starts a new one")
+	flag.Parse()
+
 	// 1. Client setup (OpenAI or Local LLM)
 	token := os.Getenv("OPENAI_API_KEY")
 	baseURL := os.Getenv("OPENAI_BASE_URL")
@@ -28,24 +35,43 @@ func main() {
 	// client := openai.NewClientWithConfig(config)
 	// _ = client // TODO: remove this
 
-	// 2. Initialize message history
-	// messages := ...
+	// 2. Initialize message history, starting with the system prompt
+	var messages []openai.ChatCompletionMessage
+
+	// 7. (Optional) Keep the history across runs with pkg/session:
+	// s, err := session.Open(session.Root(), *sessionID)
+	// messages := s.Messages() // empty for a new session: add the system prompt
+	// After every answer: s.Append(userMsg, assistantMsg)
+	// After a command that replaced the history (/reset, /system, /load),
+	// close s and open a new session with it: a session file is only ever
+	// appended to.
+	// Print s.ID(), so the user can come back with -session-id.
+	_ = sessionID
 
-	reader := bufio.NewReader(os.Stdin)
+	// Whole lines, with ↑/↓ history kept in sessions/lab01.history (shell.go)
+	reader := newLineReader(filepath.Join(session.Root(), historyFile))
 	ctx := context.Background()
+	var total usageTotal // Tokens used by the conversation (stats.go)
 
-	fmt.Println("DevOps Bot (Lab 01). Type 'exit' to quit.")
+	fmt.Println("DevOps Bot (Lab 01). Type /help for commands, 'exit' to quit.")
 
 	for {
-		fmt.Print("> ")
-
-		var input string
-		fmt.Scanln(&input) // Warning: Scanln reads only one word. Better use reader.ReadString('\n')
-		_ = reader         // TODO: Use reader instead of Scanln
-
-		if input == "exit" {
+		input, err := reader.ReadLine("> ")
+		if err != nil || input == "exit" || input == "/exit" {
 			break
 		}
+		if input == "" {
+			continue
+		}
+		if strings.HasPrefix(input, "/") {
+			var replaced bool
+			messages, replaced, err = runCommand(input, messages)
+			if err != nil {
+				fmt.Println("Error:", err)
+			}
+			_ = replaced // 7. (Optional) A new session when the history was replaced
+			continue
+		}
 
 		// 3. Add User message to history
 
@@ -58,6 +84,20 @@ func main() {
 		// resp, err := client.CreateChatCompletion(ctx, req)
 
 		// 5. Handle response & Add Assistant message to history
+		// Measure the reply for the status line (stats.go): stats :=
+		// newReplyStats() before the request, stats.Done(&resp) after it,
+		// then total.Add(stats) and printStatus(stats, &total).
+
+		// 6. (Optional) With -stream, print the reply token by token:
+		// req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+		// s, err := client.CreateChatCompletionStream(ctx, req)
+		// defer s.Close()
+		// for { chunk, err := s.Recv(); if errors.Is(err, io.EOF) { break } ... }
+		// Print every chunk.Choices[0].Delta.Content at once and collect them:
+		// the history needs the whole answer. stats.Chunk(chunk) for every
+		// chunk, and stats.Done(nil) at the end.
 		_ = ctx
+		_ = stream
+		_ = total
 	}
 }
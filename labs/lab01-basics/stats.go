@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- The status line ---
+// Where the time of a reply goes: before the first token the server reads
+// the whole history (and, for a hosted model, the request crosses the
+// network); after it the model generates at some tokens per second. A
+// hosted model usually starts later and writes faster than a local one on
+// a laptop, and a local one slows down to first token as the history
+// grows. The status line after every reply shows both, and what the
+// conversation has used so far: every request sends the whole history
+// again. Ready to use, like shell.go.
+
+// replyStats measures one reply. Create it right before the request.
+type replyStats struct {
+	start  time.Time
+	first  time.Duration // To the first piece of the answer; 0 if not streamed
+	total  time.Duration
+	chunks int           // Pieces of the answer: about a token each
+	usage  *openai.Usage // As the server reported it, if it did
+}
+
+func newReplyStats() *replyStats {
+	return &replyStats{start: time.Now()}
+}
+
+// Chunk records a chunk of a streamed reply. The server reports usage in
+// the last chunk when the request asks for it:
+// StreamOptions: &openai.StreamOptions{IncludeUsage: true}.
+func (r *replyStats) Chunk(chunk openai.ChatCompletionStreamResponse) {
+	if chunk.Usage != nil {
+		r.usage = chunk.Usage
+	}
+	if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+		return
+	}
+	if r.chunks == 0 {
+		r.first = time.Since(r.start)
+	}
+	r.chunks++
+}
+
+// Done ends the measurement. resp is the reply of a request that was not
+// streamed, nil for a streamed one.
+func (r *replyStats) Done(resp *openai.ChatCompletionResponse) {
+	r.total = time.Since(r.start)
+	if resp != nil {
+		r.usage = &resp.Usage
+		if len(resp.Choices) > 0 {
+			r.chunks = (len(resp.Choices[0].Message.Content) + 3) / 4 // About 4 characters a token
+		}
+	}
+}
+
+// tokens returns the tokens generated, and whether the server counted
+// them: if not, it is an estimate.
+func (r *replyStats) tokens() (int, bool) {
+	if r.usage != nil && r.usage.CompletionTokens > 0 {
+		return r.usage.CompletionTokens, true
+	}
+	return r.chunks, false
+}
+
+func (r *replyStats) String() string {
+	n, counted := r.tokens()
+	count := fmt.Sprint(n)
+	if !counted {
+		count = "~" + count
+	}
+	if r.first == 0 {
+		// Not streamed: the whole answer arrived at once, so there is only
+		// the overall rate.
+		return fmt.Sprintf("%s tokens in %.2fs · %.1f tok/s overall", count, r.total.Seconds(), rate(n, r.total))
+	}
+	// Generation speed: the tokens after the first one, in the time after it.
+	return fmt.Sprintf("first token %.2fs · %s tokens in %.2fs · %.1f tok/s",
+		r.first.Seconds(), count, r.total.Seconds(), rate(n-1, r.total-r.first))
+}
+
+func rate(tokens int, d time.Duration) float64 {
+	if tokens <= 0 || d <= 0 {
+		return 0
+	}
+	return float64(tokens) / d.Seconds()
+}
+
+// usageTotal adds up the replies of the conversation.
+type usageTotal struct {
+	requests   int
+	prompt     int
+	completion int
+	estimated  bool // Some reply came without usage: its tokens are an estimate
+}
+
+func (u *usageTotal) Add(r *replyStats) {
+	u.requests++
+	n, counted := r.tokens()
+	u.completion += n
+	if r.usage != nil {
+		u.prompt += r.usage.PromptTokens
+	}
+	if !counted {
+		u.estimated = true
+	}
+}
+
+func (u *usageTotal) String() string {
+	line := fmt.Sprintf("requests %d · %d prompt + %d completion tokens", u.requests, u.prompt, u.completion)
+	if u.estimated {
+		line += " (the server didn't report all of them)"
+	}
+	return line
+}
+
+// printStatus prints the status line of reply r, with the totals so far.
+func printStatus(r *replyStats, total *usageTotal) {
+	fmt.Printf("⏱  %v | so far: %v\n", r, total)
+}
@@ -0,0 +1,7 @@
+//go:build !linux && !darwin
+
+package main
+
+// makeRaw is not supported here: lines are read without editing or
+// history recall.
+func makeRaw(fd int) (restore func(), ok bool) { return nil, false }
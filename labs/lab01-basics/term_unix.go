@@ -0,0 +1,29 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// makeRaw turns off the terminal's line buffering and echo on fd, so the
+// line editor gets every key as it is pressed, and returns the function
+// that turns them back on. ok is false if fd is not a terminal.
+func makeRaw(fd int) (restore func(), ok bool) {
+	var old syscall.Termios
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), ioctlGetTermios, uintptr(unsafe.Pointer(&old))); errno != 0 {
+		return nil, false
+	}
+	raw := old
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO | syscall.ISIG | syscall.IEXTEN
+	raw.Iflag &^= syscall.IXON | syscall.ICRNL
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), ioctlSetTermios, uintptr(unsafe.Pointer(&raw))); errno != 0 {
+		return nil, false
+	}
+	return func() {
+		syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), ioctlSetTermios, uintptr(unsafe.Pointer(&old)))
+	}, true
+}
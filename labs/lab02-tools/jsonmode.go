@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kshvakov/agent/pkg/parse"
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Tool calls for models without them ---
+// Many local models never fill ToolCalls: they weren't trained to, or the
+// server doesn't pass tools to them. Such a model can still pick a tool if
+// it is asked in words: the system prompt lists the tools and asks for a
+// JSON action block in the reply. parseAction turns the block into an
+// openai.ToolCall, the same value a native call is, so the dispatch after
+// it doesn't know the difference. Ready to use; main.go picks the mode
+// with -tool-mode.
+
+// Tool modes.
+const (
+	toolModeNative = "native" // Tools in the request, calls in ToolCalls
+	toolModeJSON   = "json"   // Tools in the system prompt, calls in the text
+)
+
+// jsonToolPrompt is the system prompt of json mode: the tools and the
+// format of a call.
+func jsonToolPrompt(tools []openai.Tool) string {
+	var b strings.Builder
+	b.WriteString("You can call these tools:\n\n")
+	for _, t := range tools {
+		params, _ := json.Marshal(t.Function.Parameters)
+		fmt.Fprintf(&b, "- %s: %s\n  Parameters (JSON Schema): %s\n", t.Function.Name, t.Function.Description, params)
+	}
+	b.WriteString(`
+To call a tool, reply with only this JSON object and nothing else:
+{"tool": "<tool name>", "args": {<parameters>}}
+
+You will get the result in the next message. When you have what you need,
+answer the user in plain text, without JSON.`)
+	return b.String()
+}
+
+// action is the call a model writes in the text. Models trained on other
+// formats write "name" and "arguments", sometimes with the arguments as a
+// string: all of them are accepted.
+type action struct {
+	Tool      string          `json:"tool"`
+	Name      string          `json:"name"`
+	Args      json.RawMessage `json:"args"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// parseAction finds an action block in content: bare, in a ```json fence,
+// or with prose around it. ok is false if there is none, and the content
+// is the answer. n numbers the call, for its ID.
+func parseAction(content string, n int) (call openai.ToolCall, ok bool) {
+	a, err := parse.JSON[action]()(content)
+	name := a.Tool
+	if name == "" {
+		name = a.Name
+	}
+	if err != nil || name == "" {
+		return openai.ToolCall{}, false
+	}
+	args := a.Args
+	if len(args) == 0 {
+		args = a.Arguments
+	}
+	var s string
+	if json.Unmarshal(args, &s) == nil {
+		args = json.RawMessage(s) // "arguments": "{\"ip\": ...}"
+	}
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	return openai.ToolCall{
+		ID:       fmt.Sprintf("json-%d", n),
+		Type:     openai.ToolTypeFunction,
+		Function: openai.FunctionCall{Name: name, Arguments: string(args)},
+	}, true
+}
+
+// jsonResult is the message that gives the model the result of call in
+// json mode. It is a user message: the API accepts a tool message only
+// after an assistant message with ToolCalls, and there is none.
+func jsonResult(call openai.ToolCall, result string) openai.ChatCompletionMessage {
+	return openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: fmt.Sprintf("Result of %s %s:\n%s", call.Function.Name, call.Function.Arguments, result),
+	}
+}
@@ -2,12 +2,15 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"os"
+	"strings"
 
 	"github.com/sashabaranov/go-openai"
 )
 
-// Our "real" function
+// Our "real" functions
 func runGetServerStatus(ip string) string {
 	// Mock implementation
 	if ip == "192.168.1.10" {
@@ -16,7 +19,28 @@ func runGetServerStatus(ip string) string {
 	return "OFFLINE"
 }
 
+func runGetServerLoad(ip string) string {
+	// Mock implementation: load average over 1, 5 and 15 minutes
+	if ip == "192.168.1.10" {
+		return "load average: 3.90, 2.10, 0.80 (4 CPUs)"
+	}
+	return "no data: the server does not respond"
+}
+
 func main() {
+	toolMode := flag.String("tool-mode", toolModeNative, "native: tools in the request; json: tools in the prompt, calls as JSON in the text (jsonmode.go)")
+	flag.Parse()
+	if *toolMode != toolModeNative && *toolMode != toolModeJSON {
+		fmt.Fprintln(os.Stderr, "-tool-mode must be native or json")
+		os.Exit(2)
+	}
+
+	// The question, e.g. go run . "How loaded is 192.168.1.10?"
+	question := "Is server 192.168.1.10 online?"
+	if flag.NArg() > 0 {
+		question = strings.Join(flag.Args(), " ")
+	}
+
 	// 1. Client setup
 	token := os.Getenv("OPENAI_API_KEY")
 	baseURL := os.Getenv("OPENAI_BASE_URL")
@@ -29,24 +53,43 @@ func main() {
 	}
 	client := openai.NewClientWithConfig(config)
 
-	// 2. Describe the tool
+	// 2. Describe the tools: get_server_status and get_server_load
 	// tools := []openai.Tool{ ... }
 
 	// 3. Form the request
+	// messages := []openai.ChatCompletionMessage{
+	//     {Role: openai.ChatMessageRoleUser, Content: question},
+	// }
 	// req := openai.ChatCompletionRequest{
 	//     Model: "gpt-4o-mini", // Or your local model name
-	//     Messages: []openai.ChatCompletionMessage{
-	//         {Role: openai.ChatMessageRoleUser, Content: "Is server 192.168.1.10 online?"},
-	//     },
+	//     Messages: messages,
 	//     Tools: tools,
 	// }
 
 	ctx := context.Background()
 	_ = ctx
 	_ = client
+	_ = question
 	_ = runGetServerStatus
+	_ = runGetServerLoad
 
 	// 4. Execute request and check ToolCalls
 	// resp, _ := client.CreateChatCompletion(ctx, req)
-	// if len(resp.Choices[0].Message.ToolCalls) > 0 { ... }
+	// msg := resp.Choices[0].Message
+	// if len(msg.ToolCalls) == 0 { the model answered with text: print it }
+
+	// 5. Run every call: pick the function by call.Function.Name, parse
+	// call.Function.Arguments. Add msg to messages, then one tool message
+	// per call:
+	// {Role: openai.ChatMessageRoleTool, ToolCallID: call.ID, Content: result}
+
+	// 6. Send messages again (with the tools) and print the answer: the
+	// model turns the results into words.
+
+	// 7. (Optional) With -tool-mode json, for models that never fill
+	// ToolCalls: no Tools in the request, a system message
+	// jsonToolPrompt(tools) instead. A call comes as text:
+	// call, ok := parseAction(msg.Content, 1) // ok == false: it's the answer
+	// Run it the same way, then add msg and jsonResult(call, result).
+	_ = toolMode
 }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// --- Running ansible-playbook ---
+// runPlaybook runs the command, prints its output as it comes (a playbook
+// can take minutes, and silence looks like a hang) and keeps the end of it
+// for the tool result: PLAY RECAP and the errors are at the end. A failed
+// run is a *playbookError that says from the exit code what went wrong and
+// whether running it again can help. Ready to use; the tool in main.go
+// builds the command line.
+
+// maxPlaybookOutput is how much of the output the result keeps, from the end.
+const maxPlaybookOutput = 4 << 10
+
+// playbookRun is the outcome of one run.
+type playbookRun struct {
+	Command  string // The command line
+	Output   string // stdout and stderr as printed, the last maxPlaybookOutput bytes
+	ExitCode int
+	Duration time.Duration // The timeout, if TimedOut
+	TimedOut bool
+}
+
+// ansibleExitCodes are the exit codes of ansible-playbook: what they mean
+// and whether the same run may succeed later.
+var ansibleExitCodes = map[int]struct {
+	meaning string
+	retry   bool
+}{
+	1:   {"error", false},
+	2:   {"one or more hosts failed", true},
+	3:   {"one or more hosts were unreachable", true},
+	4:   {"parser error: check the playbook and the inventory", false},
+	5:   {"bad or incomplete options", false},
+	99:  {"interrupted by the user", true},
+	250: {"unexpected error", false},
+}
+
+// playbookError is a run that didn't succeed.
+type playbookError struct {
+	Run   playbookRun
+	Retry bool // Running it again unchanged may work
+}
+
+func (e *playbookError) Error() string {
+	var reason string
+	switch {
+	case e.Run.TimedOut:
+		reason = fmt.Sprintf("killed after the timeout of %s", e.Run.Duration)
+	case ansibleExitCodes[e.Run.ExitCode].meaning != "":
+		reason = fmt.Sprintf("exit code %d: %s", e.Run.ExitCode, ansibleExitCodes[e.Run.ExitCode].meaning)
+	default:
+		reason = fmt.Sprintf("exit code %d", e.Run.ExitCode)
+	}
+	retry := "no, fix the call first"
+	switch {
+	case e.Run.TimedOut:
+		retry = "only with a longer timeout, after checking the output for the task that hangs"
+	case e.Retry:
+		retry = "yes, once the hosts are fixed or reachable"
+	}
+	return fmt.Sprintf("%s: %s. Retry: %s.\n%s", e.Run.Command, reason, retry, e.Run.Output)
+}
+
+// runPlaybook runs cmd (ansible-playbook and its arguments) with a timeout.
+// The error is a *playbookError if the command ran and failed, another
+// error if it couldn't start.
+func runPlaybook(ctx context.Context, command func(ctx context.Context, args ...string) *exec.Cmd, args []string, timeout time.Duration) (playbookRun, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := command(ctx, args...)
+	cmd.WaitDelay = 5 * time.Second // A killed playbook's children may hold the pipes open
+
+	run := playbookRun{Command: strings.Join(append([]string{"ansible-playbook"}, args...), " ")}
+	var out bytes.Buffer
+	w := io.MultiWriter(os.Stdout, &out)
+	cmd.Stdout, cmd.Stderr = w, w // One writer: the lines stay in order
+
+	start := time.Now()
+	err := cmd.Run()
+	run.Duration = time.Since(start)
+	run.Output = tail(out.String(), maxPlaybookOutput)
+
+	var exit *exec.ExitError
+	switch {
+	case err == nil:
+		return run, nil
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		run.TimedOut, run.ExitCode, run.Duration = true, -1, timeout
+		return run, &playbookError{Run: run, Retry: false}
+	case errors.As(err, &exit):
+		run.ExitCode = exit.ExitCode()
+		return run, &playbookError{Run: run, Retry: ansibleExitCodes[run.ExitCode].retry}
+	default:
+		return run, fmt.Errorf("%s: %w", run.Command, err) // Not installed, not executable
+	}
+}
+
+// tail keeps the last n bytes of s and says how much was cut.
+func tail(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	cut := len(s) - n
+	if i := strings.IndexByte(s[cut:], '\n'); i >= 0 {
+		cut += i + 1 // Start on a whole line
+	}
+	return fmt.Sprintf("... (%d bytes before)\n%s", cut, s[cut:])
+}
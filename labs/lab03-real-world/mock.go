@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"slices"
+	"sync"
+)
+
+// Offline run: go run . -mock [tool] [args] (or OPENAI_BASE_URL=mock, as
+// agentlab run -mock sets it). fakeProxmox is a cluster of two nodes kept
+// in memory. It refuses what the real API refuses, with the same messages,
+// so the tools' error handling can be tried without a server.
+// fakeAnsiblePlaybook does the same for Ansible.
+type fakeProxmox struct {
+	mu  sync.Mutex
+	vms []vm
+}
+
+func newFakeProxmox() *fakeProxmox {
+	return &fakeProxmox{vms: []vm{
+		{VMID: 100, Name: "web-01", Node: "pve1", Status: "running", Type: "qemu"},
+		{VMID: 101, Name: "db-01", Node: "pve1", Status: "stopped", Type: "qemu"},
+		{VMID: 200, Name: "ci-runner", Node: "pve2", Status: "running", Type: "qemu"},
+	}}
+}
+
+func (f *fakeProxmox) ListVMs(node string) ([]vm, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if node != "" && node != "pve1" && node != "pve2" {
+		return nil, &proxmoxError{Status: http.StatusInternalServerError, Message: fmt.Sprintf("hostname lookup '%s' failed - failed to get address info for: %s: Name or service not known", node, node)}
+	}
+	var vms []vm
+	for _, v := range f.vms {
+		if node == "" || v.Node == node {
+			vms = append(vms, v)
+		}
+	}
+	return vms, nil
+}
+
+func (f *fakeProxmox) StartVM(node string, vmid int) error {
+	return f.power(node, vmid, "running", "VM %d already running")
+}
+
+func (f *fakeProxmox) StopVM(node string, vmid int) error {
+	return f.power(node, vmid, "stopped", "VM %d not running")
+}
+
+func (f *fakeProxmox) power(node string, vmid int, status, already string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := slices.IndexFunc(f.vms, func(v vm) bool { return v.VMID == vmid && v.Node == node })
+	if i < 0 {
+		return &proxmoxError{Status: http.StatusInternalServerError, Message: fmt.Sprintf("Configuration file 'nodes/%s/qemu-server/%d.conf' does not exist", node, vmid)}
+	}
+	if f.vms[i].Status == status {
+		return &proxmoxError{Status: http.StatusInternalServerError, Message: fmt.Sprintf(already, vmid)}
+	}
+	f.vms[i].Status = status
+	return nil
+}
+
+// fakeAnsiblePlaybook is a shell script that answers like ansible-playbook,
+// so run_playbook really starts a process, streams it and reads its exit
+// code. deploy_nginx.yml succeeds (except on db hosts, which are
+// unreachable), fail.yml fails on a host, slow.yml takes a minute (try it
+// with -playbook-timeout 3s), any other playbook is not found.
+func fakeAnsiblePlaybook(ctx context.Context, args ...string) *exec.Cmd {
+	const script = `
+playbook=; limit=all
+while [ $# -gt 0 ]; do
+	case "$1" in
+	-i) shift ;;
+	--limit) limit=$2; shift ;;
+	--check) ;;
+	*) playbook=$1 ;;
+	esac
+	shift
+done
+case "$playbook" in
+deploy_nginx.yml|fail.yml|slow.yml) ;;
+*) echo "ERROR! the playbook: $playbook could not be found" >&2; exit 1 ;;
+esac
+if [ "$limit" = db ]; then
+	echo "fatal: [db-01]: UNREACHABLE! => {\"msg\": \"Failed to connect to the host via ssh: Connection timed out\"}" >&2
+	echo; echo "PLAY RECAP"; echo "db-01 : ok=0 changed=0 unreachable=1 failed=0"; exit 3
+fi
+echo "PLAY [$playbook] ****"
+echo; echo "TASK [Gathering Facts] ****"; sleep 1; echo "ok: [web-01]"
+if [ "$playbook" = slow.yml ]; then echo; echo "TASK [Wait for the migration] ****"; sleep 60; fi
+echo; echo "TASK [Install nginx] ****"; sleep 1
+if [ "$playbook" = fail.yml ]; then
+	echo "fatal: [web-01]: FAILED! => {\"msg\": \"No package matching 'nginx-full' is available\"}" >&2
+	echo; echo "PLAY RECAP"; echo "web-01 : ok=1 changed=0 unreachable=0 failed=1"; exit 2
+fi
+echo "changed: [web-01]"
+echo; echo "PLAY RECAP"; echo "web-01 : ok=2 changed=1 unreachable=0 failed=0"
+`
+	return exec.CommandContext(ctx, "sh", append([]string{"-c", script, "ansible-playbook"}, args...)...)
+}
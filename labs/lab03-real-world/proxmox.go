@@ -0,0 +1,205 @@
+package main
+
+import (
+	"cmp"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// --- Proxmox VE API client ---
+// A small client of the Proxmox VE REST API: just what the tools in
+// main.go need. It authenticates with an API token, so no password or
+// ticket is involved:
+//
+//	PROXMOX_URL=https://pve.example.com:8006
+//	PROXMOX_TOKEN_ID='agent@pve!lab03'
+//	PROXMOX_TOKEN_SECRET=xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx
+//	PROXMOX_INSECURE=1 # The server has a self-signed certificate
+//
+// Create the token in Datacenter → Permissions → API Tokens; it needs
+// VM.Audit to list VMs and VM.PowerMgmt to start and stop them. Ready to
+// use; without a Proxmox server, run the lab with -mock (mock.go).
+
+// proxmox is what the tools use: the real API or the fake cluster.
+type proxmox interface {
+	// ListVMs returns the VMs of node, or of the whole cluster if node is "".
+	ListVMs(node string) ([]vm, error)
+	// StartVM and StopVM return when the task is done. StopVM is a hard
+	// stop, like pulling the power cord, not a guest shutdown.
+	StartVM(node string, vmid int) error
+	StopVM(node string, vmid int) error
+}
+
+// vm is one VM as the API lists it.
+type vm struct {
+	VMID   int    `json:"vmid"`
+	Name   string `json:"name"`
+	Node   string `json:"node"`
+	Status string `json:"status"` // running, stopped
+	Type   string `json:"type"`   // qemu; lxc for containers
+}
+
+func (v vm) String() string {
+	return fmt.Sprintf("ID: %d, Name: %s, Node: %s, Status: %s", v.VMID, v.Name, v.Node, v.Status)
+}
+
+// proxmoxError is an error the API returned. Message is the reason
+// Proxmox puts in the status line ("VM 100 already running"), Errors the
+// invalid parameters of a 400.
+type proxmoxError struct {
+	Status  int
+	Message string
+	Errors  map[string]string
+}
+
+func (e *proxmoxError) Error() string {
+	msg := fmt.Sprintf("proxmox: %d %s", e.Status, cmp.Or(e.Message, http.StatusText(e.Status)))
+	params := make([]string, 0, len(e.Errors))
+	for p, reason := range e.Errors {
+		params = append(params, p+": "+strings.TrimSpace(reason))
+	}
+	slices.Sort(params)
+	if len(params) > 0 {
+		msg += " (" + strings.Join(params, "; ") + ")"
+	}
+	return msg
+}
+
+// proxmoxClient talks to a Proxmox VE server.
+type proxmoxClient struct {
+	base  string // https://host:8006/api2/json
+	token string // The Authorization header
+	http  *http.Client
+}
+
+// taskTimeout is how long StartVM and StopVM wait for their task.
+const taskTimeout = 2 * time.Minute
+
+// proxmoxFromEnv returns a client configured by PROXMOX_URL,
+// PROXMOX_TOKEN_ID, PROXMOX_TOKEN_SECRET and PROXMOX_INSECURE.
+func proxmoxFromEnv() (*proxmoxClient, error) {
+	base, id, secret := os.Getenv("PROXMOX_URL"), os.Getenv("PROXMOX_TOKEN_ID"), os.Getenv("PROXMOX_TOKEN_SECRET")
+	if base == "" || id == "" || secret == "" {
+		return nil, errors.New("set PROXMOX_URL, PROXMOX_TOKEN_ID and PROXMOX_TOKEN_SECRET, or run with -mock")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if os.Getenv("PROXMOX_INSECURE") == "1" {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &proxmoxClient{
+		base:  strings.TrimSuffix(base, "/") + "/api2/json",
+		token: "PVEAPIToken=" + id + "=" + secret,
+		http:  &http.Client{Timeout: 30 * time.Second, Transport: transport},
+	}, nil
+}
+
+// call sends a request and decodes the "data" field of the reply into out.
+func (c *proxmoxClient) call(method, path string, form url.Values, out any) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, c.base+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", c.token)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("proxmox: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var reply struct {
+		Data   json.RawMessage   `json:"data"`
+		Errors map[string]string `json:"errors"`
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("proxmox: %w", err)
+	}
+	jsonErr := json.Unmarshal(raw, &reply)
+	if resp.StatusCode != http.StatusOK {
+		// "500 VM 100 not running": the reason is the text after the code.
+		_, reason, _ := strings.Cut(resp.Status, " ")
+		if reason == http.StatusText(resp.StatusCode) {
+			reason = ""
+		}
+		return &proxmoxError{Status: resp.StatusCode, Message: reason, Errors: reply.Errors}
+	}
+	if jsonErr != nil {
+		return fmt.Errorf("proxmox: bad reply to %s %s: %w", method, path, jsonErr)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(reply.Data, out)
+}
+
+func (c *proxmoxClient) ListVMs(node string) ([]vm, error) {
+	var all []vm
+	if err := c.call(http.MethodGet, "/cluster/resources?type=vm", nil, &all); err != nil {
+		return nil, err
+	}
+	var vms []vm
+	for _, v := range all {
+		if v.Type == "qemu" && (node == "" || v.Node == node) {
+			vms = append(vms, v)
+		}
+	}
+	slices.SortFunc(vms, func(a, b vm) int { return a.VMID - b.VMID })
+	return vms, nil
+}
+
+func (c *proxmoxClient) StartVM(node string, vmid int) error { return c.power(node, vmid, "start") }
+
+func (c *proxmoxClient) StopVM(node string, vmid int) error { return c.power(node, vmid, "stop") }
+
+// power starts or stops a VM and waits for the task Proxmox runs for it:
+// the request only queues the task, and the task can still fail.
+func (c *proxmoxClient) power(node string, vmid int, action string) error {
+	var upid string
+	path := fmt.Sprintf("/nodes/%s/qemu/%d/status/%s", url.PathEscape(node), vmid, action)
+	if err := c.call(http.MethodPost, path, url.Values{}, &upid); err != nil {
+		return err
+	}
+	return c.wait(node, upid)
+}
+
+// wait polls a task until it stops and returns its exit status as an error
+// unless it is "OK".
+func (c *proxmoxClient) wait(node, upid string) error {
+	path := fmt.Sprintf("/nodes/%s/tasks/%s/status", url.PathEscape(node), url.PathEscape(upid))
+	deadline := time.Now().Add(taskTimeout)
+	for {
+		var task struct {
+			Status     string `json:"status"` // running, stopped
+			ExitStatus string `json:"exitstatus"`
+		}
+		if err := c.call(http.MethodGet, path, nil, &task); err != nil {
+			return err
+		}
+		if task.Status == "stopped" {
+			if task.ExitStatus != "OK" {
+				return fmt.Errorf("proxmox: task %s failed: %s", upid, task.ExitStatus)
+			}
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("proxmox: task %s still running after %s", upid, taskTimeout)
+		}
+		time.Sleep(time.Second)
+	}
+}
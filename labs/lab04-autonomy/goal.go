@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/parse"
+	"github.com/kshvakov/agent/pkg/schema"
+	"github.com/sashabaranov/go-openai"
+)
+
+// A loop that stops when the model stops calling tools ends when the model
+// thinks it is done, and a model thinks so easily: "logs cleaned" is not
+// "disk space freed". The loop here ends on an explicit criterion, and says
+// which one ended it.
+
+// Exit states of the loop, also the status of the run (runs/<id>/meta.json).
+const (
+	exitSuccess        = "success"         // The goal is achieved
+	exitGaveUp         = "gave_up"         // Out of attempts or iterations, the goal not achieved
+	exitBudgetExceeded = "budget_exceeded" // The Budget of a run ran out
+	exitInterrupted    = "interrupted"     // Ctrl+C
+	exitFailed         = "failed"          // The LLM API failed
+)
+
+// outcome is how the loop ended and why.
+type outcome struct {
+	State  string
+	Reason string
+}
+
+// evaluation is an evaluator's verdict on the goal.
+type evaluation struct {
+	Achieved bool   `json:"achieved"`
+	Reason   string `json:"reason"`
+	By       string `json:"-"` // rule or llm
+}
+
+// goal is what the run must achieve: the objective in words, for the model
+// and the judge, and the rule that checks it on the host.
+type goal struct {
+	Objective string
+	Threshold int // Disk usage the objective allows on every partition, percent
+}
+
+func (g goal) String() string {
+	return fmt.Sprintf("%s: every partition below %d%%, and staying there", g.Objective, g.Threshold)
+}
+
+// rule checks the host itself, not what the model says about it. Space
+// that fills again is not freed.
+func (g goal) rule(h *host) evaluation {
+	for _, p := range []*partition{h.root, h.data} {
+		if p.percent() >= g.Threshold {
+			return evaluation{By: "rule", Reason: fmt.Sprintf("%s is still %d%% full, the objective needs below %d%%", p.mount, p.percent(), g.Threshold)}
+		}
+	}
+	if h.crashing {
+		return evaluation{By: "rule", Reason: fmt.Sprintf("every partition is below %d%%, but /data grows %dGB a minute and will fill again", g.Threshold, dumpGB)}
+	}
+	return evaluation{Achieved: true, By: "rule", Reason: fmt.Sprintf("/ is %d%% full, /data %d%%, and neither grows", h.root.percent(), h.data.percent())}
+}
+
+// evaluationSchema is the shape of the judge's answer.
+var evaluationSchema = schema.Object().
+	Prop("achieved", schema.Boolean("Whether the objective is achieved")).
+	Prop("reason", schema.String("The evidence, in one sentence")).
+	Require("achieved", "reason")
+
+// judge asks the model whether the run achieved the objective, from the
+// tool results of the run and its answer. A judge reads the evidence, not
+// the system: it is for goals no rule can check.
+func (g goal) judge(ctx context.Context, client llm.Provider, messages []openai.ChatCompletionMessage, answer string) (evaluation, error) {
+	var evidence strings.Builder
+	for _, m := range messages {
+		if m.Role == openai.ChatMessageRoleTool {
+			fmt.Fprintf(&evidence, "- %s\n", strings.TrimSpace(m.Content))
+		}
+	}
+	prompt := fmt.Sprintf(`You check whether an agent achieved its objective. Trust tool results over the agent's claims.
+Objective: %s
+
+Tool results, in order:
+%s
+Agent's answer: %s
+
+Return JSON only: {"achieved": true or false, "reason": "..."}`, g, evidence.String(), answer)
+
+	resp, err := client.ChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:          "gpt-4o-mini",
+		Messages:       []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: prompt}},
+		Temperature:    llm.ZeroTemperature,
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	})
+	if err != nil {
+		return evaluation{}, err
+	}
+	if len(resp.Choices) == 0 {
+		return evaluation{}, fmt.Errorf("empty judge response")
+	}
+	content, err := parse.JSON[json.RawMessage]()(resp.Choices[0].Message.Content)
+	if err != nil {
+		return evaluation{}, fmt.Errorf("judge: %w", err)
+	}
+	if err := evaluationSchema.Validate(content); err != nil {
+		return evaluation{}, fmt.Errorf("judge: %w", err)
+	}
+	var e evaluation
+	if err := json.Unmarshal(content, &e); err != nil {
+		return evaluation{}, fmt.Errorf("judge returned invalid JSON: %w", err)
+	}
+	e.By = "llm"
+	return e, nil
+}
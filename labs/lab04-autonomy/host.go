@@ -0,0 +1,264 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// --- Simulated host ---
+//
+// The server the agent frees space on. It is small, but it answers the
+// way a real one does: what an action does depends on what happened
+// before, so the agent has something to adapt to.
+//
+//   - "/" is full of old logs. clean_logs frees them, but its first try
+//     hits logrotate holding the lock, and only a retry works.
+//   - "/data" is the real culprit: report-worker crash-loops and dumps a
+//     core into /data/dumps every minute. Deleting the dumps frees the
+//     space for a while; /data fills again until the worker is stopped.
+//
+// Every call of a host tool is one minute. The state of the culprit is a
+// state machine (see state), and history records each transition with the
+// action that caused it, so a test asserts the path a fix took
+// (filling → refilling → stopped → fixed, see host_test.go) and not just
+// the answer.
+
+// Host states: the worker and its dumps.
+const (
+	stateFilling   = "filling"   // The worker crash-loops, its dumps fill /data
+	stateRefilling = "refilling" // Dumps deleted, but the worker still crash-loops: /data fills again
+	stateStopped   = "stopped"   // Worker stopped: /data no longer grows, the dumps are still there
+	stateFixed     = "fixed"     // Worker stopped, dumps deleted
+)
+
+// dumpGB is how much a crash of report-worker adds to /data/dumps.
+const dumpGB = 2
+
+// partition is a mounted file system: its size and what takes it, by
+// directory.
+type partition struct {
+	device string
+	mount  string
+	sizeGB int
+	dirs   map[string]int // GB used, by directory
+}
+
+func (p *partition) usedGB() int {
+	used := 0
+	for _, gb := range p.dirs {
+		used += gb
+	}
+	return used
+}
+
+// percent is the Use% of df.
+func (p *partition) percent() int {
+	return p.usedGB() * 100 / p.sizeGB
+}
+
+// transition is a change of the host state.
+type transition struct {
+	Minute int
+	Action string // The tool call that caused it, or "tick"
+	From   string
+	To     string
+}
+
+// host is the simulated server.
+type host struct {
+	minute     int
+	root       *partition
+	data       *partition
+	crashing   bool // report-worker crash-loops
+	restarts   int  // Crashes of report-worker so far
+	cleared    bool // The dumps were deleted while it crashed
+	cleanFails int  // clean_logs calls that fail before one works
+	logsClean  bool
+	history    []transition
+}
+
+// newHost returns the host at the moment the disk alert fired.
+func newHost() *host {
+	return &host{
+		root: &partition{device: "/dev/sda1", mount: "/", sizeGB: 50, dirs: map[string]int{
+			"/usr": 14, "/var/log": 20, "/home": 6, "/opt": 5,
+		}},
+		data: &partition{device: "/dev/sdb1", mount: "/data", sizeGB: 200, dirs: map[string]int{
+			"/data/db": 60, "/data/dumps": 130,
+		}},
+		crashing:   true,
+		restarts:   65,
+		cleanFails: 1,
+	}
+}
+
+// state is where the host is in the state machine.
+func (h *host) state() string {
+	switch {
+	case h.crashing && h.cleared:
+		return stateRefilling
+	case h.crashing:
+		return stateFilling
+	case h.data.dirs["/data/dumps"] > 0:
+		return stateStopped
+	default:
+		return stateFixed
+	}
+}
+
+// do runs one tool call: a minute passes, the action runs, and a change
+// of state is recorded.
+func (h *host) do(action string, fn func() (string, error)) (string, error) {
+	from := h.state()
+	h.tick()
+	result, err := fn()
+	if to := h.state(); to != from {
+		h.history = append(h.history, transition{Minute: h.minute, Action: action, From: from, To: to})
+	}
+	return result, err
+}
+
+// tick is one minute: a crash-looping worker dumps another core, as long
+// as /data has room for it.
+func (h *host) tick() {
+	h.minute++
+	if !h.crashing {
+		return
+	}
+	h.restarts++
+	free := h.data.sizeGB - h.data.usedGB()
+	h.data.dirs["/data/dumps"] += min(dumpGB, free)
+}
+
+// df is check_disk.
+func (h *host) df() string {
+	var b strings.Builder
+	b.WriteString("Filesystem   Size  Used  Avail  Use%  Mounted on\n")
+	for _, p := range []*partition{h.root, h.data} {
+		fmt.Fprintf(&b, "%-10s %5dG %4dG %5dG %4d%%  %s\n", p.device, p.sizeGB, p.usedGB(), p.sizeGB-p.usedGB(), p.percent(), p.mount)
+	}
+	for _, p := range []*partition{h.root, h.data} {
+		if p.percent() >= 90 {
+			fmt.Fprintf(&b, "CRITICAL: %s is %d%% full\n", p.mount, p.percent())
+		}
+	}
+	return b.String()
+}
+
+// du lists the directories under path, largest first.
+func (h *host) du(path string) (string, error) {
+	path = cmp.Or(strings.TrimSuffix(path, "/"), "/")
+	type entry struct {
+		dir string
+		gb  int
+	}
+	var entries []entry
+	for _, p := range []*partition{h.root, h.data} {
+		for dir, gb := range p.dirs {
+			if path == "/" && p == h.data {
+				continue // Another file system (du -x)
+			}
+			if dir == path || strings.HasPrefix(dir, path+"/") || path == "/" {
+				entries = append(entries, entry{dir, gb})
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("du: cannot access '%s': No such file or directory", path)
+	}
+	slices.SortFunc(entries, func(a, b entry) int { return cmp.Or(b.gb-a.gb, strings.Compare(a.dir, b.dir)) })
+	var b strings.Builder
+	total := 0
+	for _, e := range entries {
+		fmt.Fprintf(&b, "%dG\t%s\n", e.gb, e.dir)
+		total += e.gb
+	}
+	if path == "/data/dumps" && h.data.dirs["/data/dumps"] > 0 {
+		fmt.Fprintf(&b, "(%d files: core.report-worker.<pid>, newest a minute old)\n", h.data.dirs["/data/dumps"]/dumpGB)
+	}
+	fmt.Fprintf(&b, "%dG\ttotal\n", total)
+	return b.String(), nil
+}
+
+// listLogs is what `du -ah /var/log` prints on a server that never sent
+// its old logs anywhere: on its own, more than a small model's context
+// window takes (see Config.MaxToolResult). After the cleanup only the
+// current logs are left.
+func (h *host) listLogs() string {
+	oldest := 30
+	if h.logsClean {
+		oldest = 1
+	}
+	var b strings.Builder
+	for _, name := range []string{"syslog", "kern.log", "auth.log", "nginx/access.log", "nginx/error.log", "payment/app.log"} {
+		for day := oldest; day >= 1; day-- {
+			fmt.Fprintf(&b, "%dM\t/var/log/%s.%d.gz\n", 20+day*3, name, day)
+		}
+	}
+	fmt.Fprintf(&b, "%dG\t/var/log\n", h.root.dirs["/var/log"])
+	return b.String()
+}
+
+// cleanLogs deletes the rotated logs of /var/log, unless logrotate holds
+// the lock.
+func (h *host) cleanLogs() (string, error) {
+	if h.cleanFails > 0 {
+		h.cleanFails--
+		return "", fmt.Errorf("logrotate is running (pid 4242) and holds the lock on /var/log; it is done in a minute")
+	}
+	if h.logsClean {
+		return "No old logs left to clean. Freed 0GB.", nil
+	}
+	freed := h.root.dirs["/var/log"] - 2
+	h.root.dirs["/var/log"] = 2
+	h.logsClean = true
+	return fmt.Sprintf("Logs cleaned. Freed %dGB.", freed), nil
+}
+
+// serviceStatus is systemctl status, for the units of the host.
+func (h *host) serviceStatus(name string) (string, error) {
+	switch name {
+	case "report-worker":
+		if !h.crashing {
+			return "report-worker.service: inactive (dead) since the agent stopped it", nil
+		}
+		return fmt.Sprintf("report-worker.service: activating (auto-restart)\n"+
+			"Restarted %d times; last exit: signal SEGV, core dumped to /data/dumps", h.restarts), nil
+	case "postgresql":
+		return "postgresql.service: active (running), data in /data/db", nil
+	case "nginx", "payment":
+		return name + ".service: active (running)", nil
+	}
+	return "", fmt.Errorf("Unit %s.service could not be found. Units: nginx, payment, postgresql, report-worker", name)
+}
+
+// stopService stops a unit; only report-worker can be stopped without an
+// outage.
+func (h *host) stopService(name string) (string, error) {
+	switch name {
+	case "report-worker":
+		if !h.crashing {
+			return "report-worker is already stopped.", nil
+		}
+		h.crashing = false
+		return "Stopped report-worker.service. It no longer restarts.", nil
+	case "postgresql", "nginx", "payment":
+		return "", fmt.Errorf("refusing to stop %s: it serves production traffic", name)
+	}
+	return "", fmt.Errorf("Unit %s.service not loaded", name)
+}
+
+// cleanDumps deletes the core dumps of /data/dumps.
+func (h *host) cleanDumps() string {
+	gb := h.data.dirs["/data/dumps"]
+	if gb == 0 {
+		return "No core dumps to delete."
+	}
+	h.data.dirs["/data/dumps"] = 0
+	if h.crashing {
+		h.cleared = true
+	}
+	return fmt.Sprintf("Deleted %d core dumps, freed %dGB.", gb/dumpGB, gb)
+}
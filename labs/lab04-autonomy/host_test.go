@@ -0,0 +1,62 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestHostTransitions runs the fix of the mock scenario on the host and
+// asserts the path it took, not the answer.
+func TestHostTransitions(t *testing.T) {
+	h := newHost()
+	if got := h.state(); got != stateFilling {
+		t.Fatalf("new host is %s, want %s", got, stateFilling)
+	}
+	noErr := func(fn func() string) func() (string, error) {
+		return func() (string, error) { return fn(), nil }
+	}
+	stop := func() (string, error) { return h.stopService("report-worker") }
+
+	h.do("check_disk", noErr(h.df))
+	h.do("clean_dumps", noErr(h.cleanDumps))
+	h.do("check_disk", noErr(h.df))
+	if h.data.dirs["/data/dumps"] == 0 {
+		t.Errorf("/data/dumps is empty a minute after the dumps were deleted; the worker still crashes")
+	}
+	h.do("stop_service", stop)
+	h.do("clean_dumps", noErr(h.cleanDumps))
+	h.do("check_disk", noErr(h.df))
+
+	want := []transition{
+		{Minute: 2, Action: "clean_dumps", From: stateFilling, To: stateRefilling},
+		{Minute: 4, Action: "stop_service", From: stateRefilling, To: stateStopped},
+		{Minute: 5, Action: "clean_dumps", From: stateStopped, To: stateFixed},
+	}
+	if !slices.Equal(h.history, want) {
+		t.Errorf("history:\n%v\nwant:\n%v", h.history, want)
+	}
+	if h.data.dirs["/data/dumps"] != 0 {
+		t.Errorf("/data/dumps has %dGB after the worker stopped", h.data.dirs["/data/dumps"])
+	}
+}
+
+// TestHostCleanLogs: logrotate holds the lock on the first try only.
+func TestHostCleanLogs(t *testing.T) {
+	h := newHost()
+	before := h.root.percent()
+	if _, err := h.do("clean_logs", h.cleanLogs); err == nil {
+		t.Fatal("first clean_logs succeeded, want the logrotate lock error")
+	}
+	if h.root.percent() != before {
+		t.Errorf("/ went from %d%% to %d%% on a failed clean_logs", before, h.root.percent())
+	}
+	if _, err := h.do("clean_logs", h.cleanLogs); err != nil {
+		t.Fatalf("retry of clean_logs: %v", err)
+	}
+	if h.root.percent() >= before {
+		t.Errorf("/ is %d%% after clean_logs, was %d%%", h.root.percent(), before)
+	}
+	if len(h.history) != 0 {
+		t.Errorf("clean_logs changed the state of the worker: %v", h.history)
+	}
+}
@@ -2,97 +2,263 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"regexp"
+	"strings"
+	"time"
 
+	"github.com/kshvakov/agent/pkg/agent"
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/runs"
+	"github.com/kshvakov/agent/pkg/tools"
+	"github.com/kshvakov/agent/pkg/trace"
 	"github.com/sashabaranov/go-openai"
 )
 
-// Mock Tools
-func checkDisk() string { return "Disk Usage: 95% (CRITICAL). Large folder: /var/log" }
-func cleanLogs() string { return "Logs cleaned. Freed 20GB." }
+// intentPhrases announce an action the model is about to take.
+var intentPhrases = []string{"i will", "i'll", "i’ll", "i'm going to", "i am going to", "let me", "now run", "now call"}
+
+// intentReach is how many words after an announcement the tool must come:
+// "I will now run check_disk" is a call, "let me know if you want me to
+// run clean_dumps" is a question.
+const intentReach = 4
+
+// textualToolCall detects a broken tool-call contract: the model announces
+// a call in plain text ("I will now run check_disk") instead of emitting a
+// ToolCall. The tool must follow the announcement in the same sentence: a
+// final answer that says "running clean_logs freed 18GB" reports a call,
+// it doesn't announce one. Returns the name of the tool it was talking about.
+func textualToolCall(content string, tools []string) (string, bool) {
+	sentences := strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return strings.ContainsRune(".!?\n", r)
+	})
+	for _, sentence := range sentences {
+		for _, p := range intentPhrases {
+			_, after, ok := strings.Cut(sentence, p)
+			if !ok {
+				continue
+			}
+			words := strings.Fields(after)
+			next := " " + strings.Join(words[:min(len(words), intentReach)], " ") + " "
+			for _, name := range tools {
+				// Models write both "check_disk" and "check disk".
+				if mentionsWord(next, name) || mentionsWord(next, strings.ReplaceAll(name, "_", " ")) {
+					return name, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// mentionsWord reports whether text has name as a whole word: "du" is in
+// "run du on /data", not in "during".
+func mentionsWord(text, name string) bool {
+	return regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\b`).MatchString(text)
+}
+
+// repairNudge is the corrective system message sent after a textual tool call.
+func repairNudge(tool string) string {
+	return fmt.Sprintf("You described calling %s in text, but did not call it. "+
+		"Do not describe actions — call the tool via the tool-calling API.", tool)
+}
 
 func main() {
+	// An autonomous agent spends money and time on its own. The budget
+	// caps both: a run that would go over it stops with a summary instead
+	// of looping on. Try -max-tokens 150 to see it stop.
+	var budget agent.Budget
+	flag.IntVar(&budget.Steps, "max-steps", 15, "LLM calls per run")
+	flag.IntVar(&budget.Tokens, "max-tokens", 20_000, "prompt and completion tokens per run")
+	flag.Float64Var(&budget.Dollars, "max-cost", 0.05, "estimated cost per run, in dollars")
+	flag.DurationVar(&budget.Time, "max-time", 2*time.Minute, "wall time per run")
+	// The loop ends when the goal is achieved, not when the model stops
+	// calling tools. Try -threshold 30 to see it give up.
+	judge := flag.String("judge", "rule", "who evaluates the goal: rule (checks the host) or llm (reads the run)")
+	threshold := flag.Int("threshold", 80, "disk usage the goal allows on every partition, percent")
+	attempts := flag.Int("attempts", 3, "runs before the agent gives up on the goal")
+	flag.Parse()
+	if *judge != "rule" && *judge != "llm" {
+		fmt.Fprintf(os.Stderr, "-judge: want rule or llm, not %q\n", *judge)
+		os.Exit(2)
+	}
+
 	// 1. Client setup (Local-First)
-	token := os.Getenv("OPENAI_API_KEY")
-	baseURL := os.Getenv("OPENAI_BASE_URL")
-	if token == "" {
-		token = "dummy"
+	// LLM_PROVIDER picks the backend: openai (any OpenAI-compatible server), llamacpp, ollama, anthropic.
+	client, err := llm.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
-	config := openai.DefaultConfig(token)
-	if baseURL != "" {
-		config.BaseURL = baseURL
+	// Ctrl+C stops the run after the current step and prints what was done.
+	ctx, stop := agent.Interruptible(context.Background())
+	defer stop()
+
+	// Every step is logged as a structured event: text on stdout by default,
+	// JSON lines with AGENT_TRACE=json or AGENT_TRACE=<file> (see pkg/trace).
+	tr, err := trace.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	client := openai.NewClientWithConfig(config)
+	defer tr.Close()
+
+	// With OTEL_EXPORTER_OTLP_ENDPOINT set, the run is also exported as
+	// OpenTelemetry spans: run → iterations → LLM and tool calls.
+	tracer := trace.TracerFromEnv("lab04-autonomy")
 
-	ctx := context.Background()
+	// Run artifacts go to runs/<id>/ (see `agentctl replay <id>`).
+	run, err := runs.New(runs.Root(), "lab04-autonomy", "gpt-4o-mini")
+	if err != nil {
+		panic(fmt.Sprintf("Run artifacts: %v", err))
+	}
+	status := exitGaveUp
+	defer func() { run.Close(status) }()
 
-	// 2. Define tools
-	tools := []openai.Tool{
-		{
-			Type: openai.ToolTypeFunction,
-			Function: &openai.FunctionDefinition{
-				Name:        "check_disk",
-				Description: "Check current disk usage",
+	// 2. The loop itself (call LLM -> execute ToolCalls -> repeat) lives in pkg/agent;
+	// the lab configures it: prompt, tools, and response repair.
+	var a *agent.Agent
+	mutating := map[string]bool{} // Tools that change the host, see step 3
+	a = agent.New(client, agent.Config{
+		SystemPrompt: "You are an autonomous DevOps agent.",
+		Budget:       budget,
+		// The budget limits the steps; the iterations only stop a run
+		// without one.
+		MaxIterations: 50,
+		Run:           run,
+		Trace:         tr,
+		Tracer:        tracer,
+		Hooks: agent.Hooks{
+			// Response repair: pkg/agent makes at most one attempt per user turn,
+			// so a model that can't call tools doesn't spin in the loop.
+			// A tool result too large for the context window is sent in
+			// parts the model reads with read_more (try MOCK_CONTEXT_WINDOW=1000).
+			OnPaged: func(call openai.ToolCall, parts int) {
+				fmt.Printf("Result of %s is too large for the context window: sent in %d parts\n", call.Function.Name, parts)
 			},
-		},
-		{
-			Type: openai.ToolTypeFunction,
-			Function: &openai.FunctionDefinition{
-				Name:        "clean_logs",
-				Description: "Delete old logs to free space",
+			Repair: func(msg openai.ChatCompletionMessage) (string, string) {
+				name, ok := textualToolCall(msg.Content, a.ToolNames())
+				if !ok {
+					return "", ""
+				}
+				// A guess doesn't get to change the host: a mutating
+				// tool is left for the model to call, or not.
+				if mutating[name] {
+					fmt.Printf("Repair: model described %s in text; it changes the host, so it is not forced\n", name)
+					return repairNudge(name), ""
+				}
+				fmt.Printf("Repair: model described %s in text, forcing a real tool call\n", name)
+				return repairNudge(name), name
 			},
 		},
+	})
+
+	// 3. Define tools: each call is a minute on the simulated host (host.go)
+	h := newHost()
+	hostTool := func(name, description string, fn func() (string, error)) agent.Tool {
+		return agent.Tool{Name: name, Description: description, Execute: func(context.Context, json.RawMessage) (string, error) {
+			return h.do(name, fn)
+		}}
+	}
+	noErr := func(fn func() string) func() (string, error) {
+		return func() (string, error) { return fn(), nil }
+	}
+	register := func(t agent.Tool) {
+		a.RegisterTool(t)
+		mutating[t.Name] = t.Mutating
 	}
+	register(hostTool("check_disk", "Check the usage of every partition (df -h)", noErr(h.df)))
+	register(hostTool("list_logs", "List the files in /var/log with their sizes", noErr(h.listLogs)))
+	cleanLogs := hostTool("clean_logs", "Delete the rotated logs in /var/log to free space on /", h.cleanLogs)
+	cleanLogs.Mutating = true
+	register(cleanLogs)
+	cleanDumps := hostTool("clean_dumps", "Delete the core dumps in /data/dumps", noErr(h.cleanDumps))
+	cleanDumps.Mutating = true
+	register(cleanDumps)
+	register(tools.New("du", "Disk usage of the directories under a path, largest first (du -x)", func(_ context.Context, args struct {
+		Path string `json:"path" description:"Directory, e.g. / or /data"`
+	}) (string, error) {
+		return h.do("du", func() (string, error) { return h.du(args.Path) })
+	}))
+	type unitArgs struct {
+		Name string `json:"name" description:"Unit name, e.g. nginx"`
+	}
+	register(tools.New("service_status", "Status of a systemd unit", func(_ context.Context, args unitArgs) (string, error) {
+		return h.do("service_status", func() (string, error) { return h.serviceStatus(args.Name) })
+	}))
+	stopService := tools.New("stop_service", "Stop a systemd unit", func(_ context.Context, args unitArgs) (string, error) {
+		return h.do("stop_service", func() (string, error) { return h.stopService(args.Name) })
+	})
+	stopService.Mutating = true
+	register(stopService)
 
-	messages := []openai.ChatCompletionMessage{
-		{Role: openai.ChatMessageRoleSystem, Content: "You are an autonomous DevOps agent."},
-		{Role: openai.ChatMessageRoleUser, Content: "I'm out of disk space. Fix it."},
+	// 4. The goal, and who evaluates it: the rule checks the host, the
+	// judge reads the run. If the judge fails, the rule decides.
+	g := goal{Objective: "disk space freed", Threshold: *threshold}
+	evaluate := func(answer string) evaluation {
+		if *judge == "llm" {
+			e, err := g.judge(ctx, client, a.Messages(), answer)
+			if err == nil {
+				return e
+			}
+			fmt.Printf("Judge failed, using the rule: %v\n", err)
+		}
+		return g.rule(h)
 	}
 
 	fmt.Println("Starting Agent Loop...")
+	fmt.Println("Run ID:", run.ID())
+	fmt.Println("Goal:", g)
 
-	// 3. THE LOOP
-	for i := 0; i < 5; i++ {
-		req := openai.ChatCompletionRequest{
-			Model:    "gpt-4o-mini",
-			Messages: messages,
-			Tools:    tools,
-		}
+	// 5. THE LOOP
+	out, answer := loop(ctx, a, evaluate, *attempts, fmt.Sprintf("I'm out of disk space. Fix it. Objective: %s.", g))
+	status = out.State
+	switch out.State {
+	case exitSuccess:
+		fmt.Println("AI:", answer)
+		fmt.Println("Spent:", a.Spent())
+		run.WriteReport(answer)
+	case exitGaveUp, exitBudgetExceeded, exitInterrupted:
+		fmt.Printf("\nSo far:\n%s", a.Recap())
+	}
+	fmt.Printf("\nLoop ended: %s (%s)\n", out.State, out.Reason)
+	fmt.Printf("Host: %s at minute %d\n", h.state(), h.minute)
+	for _, t := range h.history {
+		fmt.Printf("  minute %d, %s: %s → %s\n", t.Minute, t.Action, t.From, t.To)
+	}
+}
 
-		resp, err := client.CreateChatCompletion(ctx, req)
-		if err != nil {
-			panic(fmt.Sprintf("API Error: %v", err))
+// loop runs the agent until the goal is achieved or the loop can't go on,
+// and returns how it ended with the last answer. After each run the goal
+// is evaluated: a run that ends short of it is followed by another, told
+// why, up to attempts runs.
+func loop(ctx context.Context, a *agent.Agent, evaluate func(answer string) evaluation, attempts int, task string) (outcome, string) {
+	msg := task
+	for i := 1; ; i++ {
+		answer, err := a.Run(ctx, msg)
+		switch {
+		case errors.Is(err, context.Canceled):
+			return outcome{exitInterrupted, "stopped by Ctrl+C"}, ""
+		case errors.Is(err, agent.ErrBudget):
+			return outcome{exitBudgetExceeded, err.Error()}, ""
+		case errors.Is(err, agent.ErrMaxIterations):
+			return outcome{exitGaveUp, err.Error()}, ""
+		case err != nil:
+			return outcome{exitFailed, fmt.Sprintf("API error: %v", err)}, ""
 		}
-
-		msg := resp.Choices[0].Message
-		messages = append(messages, msg)
-
-		// 4. Analyze response
-		if len(msg.ToolCalls) == 0 {
-			fmt.Println("AI:", msg.Content)
-			break
+		e := evaluate(answer)
+		fmt.Printf("Goal check %d/%d (%s): achieved=%t, %s\n", i, attempts, e.By, e.Achieved, e.Reason)
+		if e.Achieved {
+			return outcome{exitSuccess, e.Reason}, answer
 		}
-
-		// 5. Execute tools
-		for _, toolCall := range msg.ToolCalls {
-			fmt.Printf("Executing tool: %s\n", toolCall.Function.Name)
-
-			var result string
-			if toolCall.Function.Name == "check_disk" {
-				result = checkDisk()
-			} else if toolCall.Function.Name == "clean_logs" {
-				result = cleanLogs()
-			}
-
-			fmt.Println("Tool Output:", result)
-
-			messages = append(messages, openai.ChatCompletionMessage{
-				Role:       openai.ChatMessageRoleTool,
-				Content:    result,
-				ToolCallID: toolCall.ID,
-			})
+		if i >= attempts {
+			return outcome{exitGaveUp, fmt.Sprintf("%d attempts, and %s", attempts, e.Reason)}, answer
 		}
+		msg = fmt.Sprintf("The objective is not achieved: %s. Continue until it is, or say what blocks you.", e.Reason)
 	}
 }
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestTextualToolCall(t *testing.T) {
+	tools := []string{"check_disk", "clean_logs", "clean_dumps", "du", "stop_service"}
+	tests := []struct {
+		content string
+		want    string // "" if it is not a call in text
+	}{
+		{"I will now run check_disk to see what takes the space.", "check_disk"},
+		{"Let me call du on /data.", "du"},
+		{"I'll check disk usage first.", "check_disk"},
+		{"OK. Now run clean_logs", "clean_logs"},
+		// Final answers report calls, they don't announce them.
+		{"Running clean_logs freed 18GB. /data is at 30%.", ""},
+		{"After calling clean_dumps and executing stop_service, every partition is below 80%.", ""},
+		{"I will keep an eye on it. check_disk shows / at 54%.", ""},
+		{"Let me know if you want me to run clean_dumps again later.", ""},
+		{"I will report back during the next hour.", ""},
+	}
+	for _, tt := range tests {
+		got, ok := textualToolCall(tt.content, tools)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("textualToolCall(%q) = %q, %t; want %q", tt.content, got, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"regexp"
+
+	"github.com/kshvakov/agent/pkg/mockllm"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Offline run: OPENAI_BASE_URL=mock go run .
+// The first reply describes a tool call in text, to show the repair at work.
+// With MOCK_CONTEXT_WINDOW=1000 the listing of /var/log doesn't fit: the
+// model reads it part by part, as the continuation markers say.
+//
+// The model adapts to the host (host.go): it retries clean_logs once
+// logrotate is done, and deletes the core dumps of /data. That frees the
+// space, but the worker keeps crashing, so the goal is not achieved; the
+// second run stops the worker first.
+//
+// With -judge llm the goal is evaluated by a JSON call, told apart by its
+// prompt; those turns come first, so no other turn answers it.
+func init() {
+	judge := mockllm.All(mockllm.JSONMode, mockllm.Mentions("You check whether an agent achieved its objective"))
+	summarizer := func(req openai.ChatCompletionRequest) bool { return !mockllm.HasTools(req) && !judge(req) }
+	mockllm.Register(
+		mockllm.Say(`{"achieved": false, "reason": "du shows a core dump a minute old in /data/dumps: /data will fill again"}`).If(judge),
+		mockllm.Say(`{"achieved": true, "reason": "report-worker is stopped and check_disk shows every partition below the threshold"}`).If(judge),
+		// llm.WithCondense tries a summary first: it can't shrink the listing.
+		mockllm.Say("The user is out of disk space.").If(summarizer),
+		mockllm.Say("I will now run check_disk to see what takes the space."),
+		mockllm.Call("check_disk", nil),
+		mockllm.Call("list_logs", nil),
+	)
+	for range 3 {
+		mockllm.Register(mockllm.Turn{Reply: readMore}.If(continued))
+	}
+	mockllm.Register(
+		mockllm.Call("clean_logs", nil),
+		mockllm.Think("logrotate holds the lock for a minute. Checking the disk meanwhile.", "check_disk", nil),
+		mockllm.Call("clean_logs", nil),
+		mockllm.Think("/ is fine now, but /data is almost full.", "du", map[string]any{"path": "/data"}),
+		mockllm.Call("du", map[string]any{"path": "/data/dumps"}),
+		mockllm.Call("clean_dumps", nil),
+		mockllm.Call("check_disk", nil),
+		mockllm.Say("Freed 18GB of old logs on / and the core dumps on /data."),
+		// Second run: the goal check says /data fills again.
+		mockllm.Call("service_status", map[string]any{"name": "report-worker"}),
+		mockllm.Think("report-worker crash-loops and dumps a core every minute: stopping it.", "stop_service", map[string]any{"name": "report-worker"}),
+		mockllm.Call("clean_dumps", nil),
+		mockllm.Call("check_disk", nil),
+		mockllm.Say("/ was full of old logs, /data of core dumps from report-worker, which crashed every minute. "+
+			"Logs and dumps are deleted and report-worker is stopped: / is at 54%, /data at 30%. report-worker needs a fix before it is started again."),
+	)
+}
+
+// moreMarker is the end of a part of a paged result (see pkg/agent).
+var moreMarker = regexp.MustCompile(`Call read_more with id "([^"]+)" and part (\d+) for the rest`)
+
+// continued accepts a request whose last message is a part with more to come.
+func continued(req openai.ChatCompletionRequest) bool {
+	n := len(req.Messages)
+	return n > 0 && moreMarker.MatchString(req.Messages[n-1].Content)
+}
+
+// readMore asks for the part the marker names.
+func readMore(req openai.ChatCompletionRequest) mockllm.Turn {
+	m := moreMarker.FindStringSubmatch(req.Messages[len(req.Messages)-1].Content)
+	return mockllm.Call("read_more", `{"id": "`+m[1]+`", "part": `+m[2]+`}`)
+}
@@ -1,13 +1,19 @@
 package main
 
 import (
-	"bufio"
 	"context"
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/kshvakov/agent/pkg/agent"
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/schema"
+	"github.com/kshvakov/agent/pkg/session"
+	"github.com/kshvakov/agent/pkg/trace"
 	"github.com/sashabaranov/go-openai"
 )
 
@@ -21,17 +27,60 @@ func sendEmail(to, subject, body string) string {
 	return fmt.Sprintf("Email sent to %s. Subject: %s. Body len: %d", to, subject, len(body))
 }
 
+// Tool arguments. The Parameters schemas are derived from these structs
+// (schema.For): the model is asked for exactly the fields the code reads.
+type deleteDBArgs struct {
+	Name string `json:"name" description:"Database name"`
+}
+
+type sendEmailArgs struct {
+	To      string `json:"to" description:"Recipient address"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// checkArguments validates the arguments of call against the Parameters
+// schema of the tool it names.
+func checkArguments(tools []openai.Tool, call openai.ToolCall) error {
+	for _, t := range tools {
+		if t.Function.Name != call.Function.Name {
+			continue
+		}
+		params, _ := t.Function.Parameters.(*schema.Schema)
+		if params == nil {
+			return nil
+		}
+		return params.Validate([]byte(call.Function.Arguments))
+	}
+	return fmt.Errorf("unknown tool %s", call.Function.Name)
+}
+
 func main() {
+	sessionID := flag.String("session-id", "", "resume the conversation with this id; empty starts a new one")
+	takeOver := flag.Bool("take-over", false, "continue a session another front-end still holds; it stops writing to it")
+	flag.Parse()
+
 	// 1. Config for Local LLM
-	token := os.Getenv("OPENAI_API_KEY")
-	if token == "" { token = "dummy" }
-	config := openai.DefaultConfig(token)
-	if baseURL := os.Getenv("OPENAI_BASE_URL"); baseURL != "" {
-		config.BaseURL = baseURL
+	// LLM_PROVIDER picks the backend: openai (any OpenAI-compatible server), llamacpp, ollama, anthropic.
+	client, err := llm.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	client := openai.NewClientWithConfig(config)
-	
-	ctx := context.Background()
+
+	// Ctrl+C ends the session after the current step and prints what was done.
+	ctx, stop := agent.Interruptible(context.Background())
+	defer stop()
+
+	// Tool calls are logged as structured events: text on stdout by default,
+	// JSON lines with AGENT_TRACE=json or AGENT_TRACE=<file> (see pkg/trace).
+	tr, err := trace.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer tr.Close()
+	step := 0 // LLM calls so far
 
 	// 2. Tools
 	tools := []openai.Tool{
@@ -40,11 +89,7 @@ func main() {
 			Function: &openai.FunctionDefinition{
 				Name:        "delete_db",
 				Description: "Delete a database by name. DANGEROUS ACTION.",
-				Parameters: json.RawMessage(`{
-					"type": "object",
-					"properties": { "name": { "type": "string" } },
-					"required": ["name"]
-				}`),
+				Parameters:  schema.For[deleteDBArgs](),
 			},
 		},
 		{
@@ -52,35 +97,93 @@ func main() {
 			Function: &openai.FunctionDefinition{
 				Name:        "send_email",
 				Description: "Send an email",
-				Parameters: json.RawMessage(`{
-					"type": "object",
-					"properties": {
-						"to": { "type": "string" },
-						"subject": { "type": "string" },
-						"body": { "type": "string" }
-					},
-					"required": ["to", "subject", "body"]
-				}`),
+				Parameters:  schema.For[sendEmailArgs](),
 			},
 		},
 	}
 
-	messages := []openai.ChatCompletionMessage{
-		{
-			Role:    openai.ChatMessageRoleSystem,
-			Content: "You are a helpful assistant. IMPORTANT: 1) Always ask for explicit confirmation before deleting anything. 2) If user parameters are missing, ask clarifying questions.",
-		},
+	// The conversation is kept in sessions/<id>.jsonl, so it outlives the
+	// process: -session-id picks it up where it stopped, tool calls and
+	// results included.
+	//
+	// One front-end holds a session at a time: another terminal (or machine,
+	// with a shared AGENT_SESSIONS_DIR) gets it once this one exits, or
+	// right away with -take-over.
+	sess, err := session.OpenWith(session.Root(), *sessionID, session.Options{TakeOver: *takeOver})
+	var locked *session.LockedError
+	if errors.As(err, &locked) {
+		fmt.Fprintf(os.Stderr, "%v\nWait for it to exit, or continue here with -session-id %s -take-over\n", err, locked.ID)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer sess.Close()
+	messages := sess.Messages()
+	if len(messages) == 0 {
+		messages = []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: "You are a helpful assistant. IMPORTANT: 1) Always ask for explicit confirmation before deleting anything. 2) If user parameters are missing, ask clarifying questions.",
+			},
+		}
+	} else {
+		fmt.Printf("Resumed session %s: %d messages.\n", sess.ID(), len(messages))
 	}
+	saved := len(sess.Messages())
+	// save writes the messages added since the last call to the session.
+	// Once another front-end has taken the session over, this one stops.
+	takenOver := false
+	save := func() {
+		if takenOver {
+			return
+		}
+		if err := sess.Append(messages[saved:]...); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			takenOver = errors.Is(err, session.ErrTakenOver)
+		}
+		saved = len(messages)
+	}
+	defer save()
+	fmt.Printf("Session %s (continue it later with -session-id %s)\n", sess.ID(), sess.ID())
+
+	lines := readLines(os.Stdin)
+
+	// A session handed over mid-action: the previous front-end got the tool
+	// calls but not their results (it was waiting for a "yes", or it was
+	// killed). Every call needs a result before the next request, and a
+	// dangerous one is approved here, by whoever holds the session now.
+	for _, call := range sess.Pending() {
+		fmt.Printf("Pending from the previous front-end: %s %s\nApprove? [y/N] > ", call.Function.Name, call.Function.Arguments)
+		result := "Cancelled: the operator did not approve this call"
+		if answer, ok := <-lines; ok && strings.EqualFold(strings.TrimSpace(answer), "y") {
+			// TODO: Implement tool calls here (as in the loop below)
+			result = "Executed"
+		}
+		fmt.Printf("  [System] %s\n", result)
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:       openai.ChatMessageRoleTool,
+			Content:    result,
+			ToolCallID: call.ID,
+		})
+	}
+	save()
 
-	reader := bufio.NewReader(os.Stdin)
 	fmt.Println("Agent is ready. (Try: 'Delete prod_db' or 'Send email to bob')")
+	fmt.Println("While the agent is answering, type a correction and press Enter to interrupt it.")
 
 	// 3. Interactive Chat Loop
-	for {
+	for ctx.Err() == nil && !takenOver {
 		fmt.Print("\nUser > ")
-		input, _ := reader.ReadString('\n')
+		var input string
+		ok := false
+		select {
+		case input, ok = <-lines:
+		case <-ctx.Done():
+		}
 		input = strings.TrimSpace(input)
-		if input == "exit" {
+		if !ok || input == "exit" {
 			break
 		}
 
@@ -97,26 +200,69 @@ func main() {
 				Tools:    tools,
 			}
 
-			resp, err := client.CreateChatCompletion(ctx, req)
+			// The reply is streamed; a line typed meanwhile interrupts it.
+			step++
+			started := false
+			msg, correction, interrupted, err := streamReply(ctx, client, req, lines, func(s string) {
+				if !started {
+					fmt.Print("Agent > ")
+					started = true
+				}
+				fmt.Print(s)
+			})
+			if started {
+				fmt.Println()
+			}
 			if err != nil {
-				fmt.Printf("Error: %v\n", err)
+				if ctx.Err() == nil {
+					fmt.Printf("Error: %v\n", err)
+				}
 				break
 			}
 
-			msg := resp.Choices[0].Message
+			if interrupted {
+				// Keep what the model managed to say, so it knows where it was cut off.
+				if msg.Content != "" {
+					msg.Content = strings.TrimSpace(msg.Content) + " [interrupted by user]"
+					messages = append(messages, msg)
+				}
+				if strings.TrimSpace(correction) == "" {
+					fmt.Print("Correction > ")
+					correction = <-lines
+				}
+				fmt.Println("  [System] Interrupted. Correction sent to the agent.")
+				messages = append(messages, openai.ChatCompletionMessage{
+					Role:    openai.ChatMessageRoleUser,
+					Content: strings.TrimSpace(correction),
+				})
+				continue
+			}
+
 			messages = append(messages, msg)
 
 			if len(msg.ToolCalls) == 0 {
-				fmt.Printf("Agent > %s\n", msg.Content)
 				break
 			}
+			// The calls are saved before they run: if this front-end goes
+			// away now, the next one finds them pending.
+			save()
 
 			for _, toolCall := range msg.ToolCalls {
-				fmt.Printf("  [System] Executing tool: %s\n", toolCall.Function.Name)
+				tr.ToolCall(ctx, step, toolCall)
+				start := time.Now()
 				var result string
-				
-				// TODO: Implement tool calls here
-				result = "Executed" 
+
+				// Arguments are checked against the schema the model was
+				// given: a call without "subject" gets back exactly what is
+				// missing, and the model can fix it or ask the user.
+				if err := checkArguments(tools, toolCall); err != nil {
+					result = "Error: " + err.Error()
+				} else {
+					// TODO: Implement tool calls here
+					result = "Executed"
+				}
+
+				tr.ToolResult(ctx, step, toolCall, result, time.Since(start), nil)
 
 				messages = append(messages, openai.ChatCompletionMessage{
 					Role:       openai.ChatMessageRoleTool,
@@ -125,5 +271,9 @@ func main() {
 				})
 			}
 		}
+		save()
+	}
+	if ctx.Err() != nil {
+		fmt.Printf("\n⏹  Interrupted. So far:\n%s", agent.Recap(messages))
 	}
 }
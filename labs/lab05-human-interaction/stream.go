@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Streaming with interrupt ---
+//
+// A long explanation or plan can take many seconds to generate. Instead of
+// waiting for the whole completion, the reply is streamed, and the user can
+// cut in: typing a line (or just pressing Enter) while the agent is "talking"
+// stops the stream. The partial reply stays in the history, so the model knows
+// where it was interrupted, and the correction goes in as the next user message.
+
+// readLines reads stdin on its own goroutine, so the chat loop can wait for
+// user input and for stream chunks at the same time. The channel is closed on EOF.
+func readLines(r io.Reader) <-chan string {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		sc := bufio.NewScanner(r)
+		for sc.Scan() {
+			lines <- sc.Text()
+		}
+	}()
+	return lines
+}
+
+// streamReply streams one completion, passing content to onContent as it
+// arrives. If a line comes from interrupts first, the stream is stopped and
+// the partial reply is returned with interrupted=true and the line as the
+// correction (empty if the user only pressed Enter).
+func streamReply(ctx context.Context, client llm.Provider, req openai.ChatCompletionRequest,
+	interrupts <-chan string, onContent func(string)) (reply openai.ChatCompletionMessage, correction string, interrupted bool, err error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req.Stream = true
+	stream, err := client.Stream(ctx, req)
+	if err != nil {
+		return reply, "", false, err
+	}
+	defer stream.Close()
+
+	type chunk struct {
+		resp openai.ChatCompletionStreamResponse
+		err  error
+	}
+	chunks := make(chan chunk)
+	go func() {
+		for {
+			resp, err := stream.Recv()
+			select {
+			case chunks <- chunk{resp, err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	reply.Role = openai.ChatMessageRoleAssistant
+	for {
+		select {
+		case line, ok := <-interrupts:
+			if !ok {
+				interrupts = nil // stdin closed: nothing can interrupt any more
+				continue
+			}
+			// Partial tool calls are dropped: their arguments may be cut mid-JSON.
+			reply.ToolCalls = nil
+			return reply, line, true, nil
+		case c := <-chunks:
+			if errors.Is(c.err, io.EOF) {
+				return reply, "", false, nil
+			}
+			if c.err != nil {
+				return reply, "", false, c.err
+			}
+			if len(c.resp.Choices) == 0 {
+				continue
+			}
+			delta := c.resp.Choices[0].Delta
+			if delta.Content != "" {
+				reply.Content += delta.Content
+				onContent(delta.Content)
+			}
+			reply.ToolCalls = llm.MergeToolCalls(reply.ToolCalls, delta.ToolCalls)
+		}
+	}
+}
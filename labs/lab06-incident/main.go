@@ -1,10 +1,25 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/kshvakov/agent/pkg/agent"
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/prompts"
+	"github.com/kshvakov/agent/pkg/runs"
+	"github.com/kshvakov/agent/pkg/simclock"
+	"github.com/kshvakov/agent/pkg/tools"
+	"github.com/kshvakov/agent/pkg/tools/prom"
+	"github.com/kshvakov/agent/pkg/trace"
 	"github.com/sashabaranov/go-openai"
 )
 
@@ -13,6 +28,90 @@ var serviceState = map[string]string{
 	"status":  "failed", // failed -> running
 	"config":  "bad",    // bad -> good
 	"version": "v2.0",   // v2.0 -> v1.9
+	"cert":    "valid",  // valid -> expired | renewed
+	"db":      "up",     // down | slow -> up
+	"cache":   "up",     // oom -> up
+}
+
+// --- Simulated Time ---
+// Every tool call "takes" time on a simulated clock, so scenarios can have
+// deadlines without the lab running for real minutes.
+var (
+	clock         = simclock.New(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	startedAt     = clock.Now()
+	certExpiresAt time.Time // Zero when the certificate is not part of the scenario
+	backlog       int       // Payments queued while the service is down
+	dropped       int       // Payments lost to restarts of a running service
+)
+
+// toolDurations is how long each action takes in simulated time.
+var toolDurations = map[string]time.Duration{
+	"check_http":      10 * time.Second,
+	"read_logs":       30 * time.Second,
+	"restart_service": time.Minute,
+	"rollback_deploy": 2 * time.Minute,
+	"check_cert":      10 * time.Second,
+	"renew_cert":      2 * time.Minute,
+	"pager":           5 * time.Second,
+
+	"inventory":          5 * time.Second,
+	"check_service":      10 * time.Second,
+	"read_service_logs":  30 * time.Second,
+	"restart_dependency": time.Minute,
+}
+
+// setupScenario prepares the environment.
+//   - "config": the service is down after a bad deploy (the classic SOP exercise).
+//   - "cert":   the service is up, but its TLS certificate expires at T+5m.
+//     If the agent doesn't renew it in time, the service goes down.
+//   - "flap":   the service is down because its database is, and recovers on
+//     its own at T+20s. A restart decided on the first checks hits a healthy
+//     service and drops in-flight payments.
+//   - "db":     the database is down and stays down. Nothing the agent can
+//     run fixes it; an agent that keeps checking instead of escalating
+//     loops (-loop).
+//   - "cascade": the payment service times out on the database, which is
+//     up but has run out of connections because its cache is down (see
+//     topology.go). Only a restart of the cache fixes it.
+//
+// In every scenario the payment backlog grows every simulated minute of downtime.
+func setupScenario(name string) error {
+	switch name {
+	case "config":
+	case "cert":
+		serviceState["status"] = "running"
+		serviceState["config"] = "good"
+		certExpiresAt = clock.Now().Add(5 * time.Minute)
+		clock.At(certExpiresAt, func() {
+			if serviceState["cert"] != "renewed" {
+				serviceState["cert"] = "expired"
+				serviceState["status"] = "failed"
+			}
+		})
+	case "flap":
+		serviceState["config"] = "good"
+		serviceState["db"] = "down"
+		clock.At(clock.Now().Add(20*time.Second), func() {
+			serviceState["db"] = "up"
+			serviceState["status"] = "running"
+		})
+	case "db":
+		serviceState["config"] = "good"
+		serviceState["db"] = "down"
+	case "cascade":
+		serviceState["config"] = "good"
+		serviceState["db"] = "slow"
+		serviceState["cache"] = "oom"
+		cascading = true
+	default:
+		return fmt.Errorf("unknown scenario %q (want config, cert, flap, db or cascade)", name)
+	}
+	clock.Every(time.Minute, func() {
+		if serviceState["status"] != "running" {
+			backlog += 120
+		}
+	})
+	return nil
 }
 
 // --- Tools Implementation ---
@@ -22,11 +121,23 @@ func checkHttp() string {
 	if serviceState["status"] == "running" {
 		return "200 OK"
 	}
+	if serviceState["cert"] == "expired" {
+		return "502 Bad Gateway (TLS handshake failed)"
+	}
 	return "502 Bad Gateway"
 }
 
 func readLogs() string {
 	fmt.Println("   [TOOL] Reading logs...")
+	if serviceState["db"] == "down" {
+		return "ERROR: Connection refused: db-main:5432. Retrying in 10s."
+	}
+	if serviceState["db"] == "slow" {
+		return "ERROR: timeout after 5s waiting for a connection to db-main:5432 (pool exhausted)."
+	}
+	if serviceState["cert"] == "expired" {
+		return "ERROR: x509: certificate has expired or is not yet valid."
+	}
 	if serviceState["config"] == "bad" {
 		return "ERROR: Config syntax error in line 42. Unexpected token."
 	}
@@ -38,10 +149,46 @@ func restartService() string {
 	if serviceState["config"] == "bad" {
 		return "Failed to start service. Exit code 1 (Config Error)."
 	}
+	if serviceState["db"] == "down" {
+		return "Failed to start service. Exit code 1 (database unavailable)."
+	}
+	if serviceState["db"] == "slow" {
+		return "Service restarted. Status: Active. Requests still time out waiting for db-main."
+	}
+	if serviceState["status"] == "running" {
+		dropped += 37
+		return "Service restarted. Status: Active. 37 in-flight payments dropped."
+	}
 	serviceState["status"] = "running"
 	return "Service restarted. Status: Active."
 }
 
+func checkCert() string {
+	fmt.Println("   [TOOL] Checking TLS certificate...")
+	switch {
+	case serviceState["cert"] == "renewed":
+		return "Certificate renewed. Valid for 90 days."
+	case certExpiresAt.IsZero():
+		return "Certificate valid for 60 days."
+	case serviceState["cert"] == "expired":
+		return fmt.Sprintf("Certificate EXPIRED at %s.", certExpiresAt.Format("15:04:05"))
+	default:
+		left := certExpiresAt.Sub(clock.Now()).Round(time.Second)
+		return fmt.Sprintf("Certificate valid until %s (expires in %s).", certExpiresAt.Format("15:04:05"), left)
+	}
+}
+
+func renewCert() string {
+	fmt.Println("   [TOOL] Renewing TLS certificate...")
+	wasExpired := serviceState["cert"] == "expired"
+	serviceState["cert"] = "renewed"
+	if wasExpired && serviceState["config"] == "good" {
+		serviceState["status"] = "running"
+		return "Certificate renewed. Service recovered after TLS outage."
+	}
+	return "Certificate renewed. Valid for 90 days."
+}
+
 func rollback() string {
 	fmt.Println("   [TOOL] Rolling back to previous version...")
 	serviceState["config"] = "good"
@@ -53,28 +200,67 @@ func rollback() string {
 // --- Main Agent ---
 
 func main() {
-	// Config
-	token := os.Getenv("OPENAI_API_KEY")
-	if token == "" {
-		token = "dummy"
+	scenario := flag.String("scenario", "config", "incident scenario: config | cert | flap | db | cascade")
+	sevName := flag.String("severity", "SEV2", "alert severity: SEV1 (act fast) | SEV2 | SEV3 (careful path)")
+	stream := flag.Bool("stream", false, "print the model's text as it is generated")
+	ttl := flag.Duration("ttl", 30*time.Second, "how long check results stay valid before a restart or rollback re-verifies them; 0 turns it off (default by -severity: 2m for SEV1, else 30s)")
+	budget := flag.Int("budget", 0, "stop the run after this many tokens; 0 means no limit")
+	approve := flag.Bool("approve", false, "ask on the terminal before every restart, rollback or renewal")
+	loop := flag.Int("loop", 3, "after this many identical tool calls, tell the model to stop repeating them; 0 turns it off")
+	unattended := flag.Bool("unattended", false, "no operator: at most one restart, rollback or renewal per 10 minutes, the rest queued for review")
+	flag.Parse()
+	if err := setupScenario(*scenario); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
-	config := openai.DefaultConfig(token)
-	if baseURL := os.Getenv("OPENAI_BASE_URL"); baseURL != "" {
-		config.BaseURL = baseURL
+	sev, ok := severities[strings.ToUpper(*sevName)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown severity %q (want SEV1, SEV2 or SEV3)\n", *sevName)
+		os.Exit(2)
+	}
+	*sevName = strings.ToUpper(*sevName)
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "ttl" {
+			sev.ttl = *ttl
+		}
+	})
+	openPage(*sevName)
+
+	// Config
+	// LLM_PROVIDER picks the backend: openai (any OpenAI-compatible server), llamacpp, ollama, anthropic.
+	client, err := llm.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	client := openai.NewClientWithConfig(config)
 
-	ctx := context.Background()
+	// Ctrl+C stops the run after the current step and prints what was done.
+	ctx, stop := agent.Interruptible(context.Background())
+	defer stop()
 
-	fmt.Println("🚨 ALERT: Payment Service is DOWN (502).")
-	fmt.Println("--- Agent Taking Over ---")
+	// Run artifacts (transcript, and the handoff if the run needs a human)
+	// go to runs/<id>/.
+	run, err := runs.New(runs.Root(), "lab06-incident", "gpt-4o-mini")
+	if err != nil {
+		panic(fmt.Sprintf("Run artifacts: %v", err))
+	}
+	status := "gave_up"
+	defer func() { run.Close(status) }()
 
-	tools := []openai.Tool{
-		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "check_http", Description: "Check service HTTP status"}},
-		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "read_logs", Description: "Read service logs. Do this if HTTP is 500/502."}},
-		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "restart_service", Description: "Restart the service. Use ONLY if logs show transient error."}},
-		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "rollback_deploy", Description: "Rollback to previous version. Use if logs show Config/Syntax error."}},
+	alert := "Payment Service is down (502). Fix it."
+	switch *scenario {
+	case "cert":
+		alert = "Payment Service TLS certificate is about to expire. Prevent an outage."
+	case "flap":
+		alert = "Payment Service is down (502), database errors on the dashboard. Fix it."
+	case "db":
+		alert = "Payment Service is down (502), payments are failing. Fix it."
+	case "cascade":
+		alert = "Payment Service is down (502), checkouts time out. Fix it."
 	}
+	alert = fmt.Sprintf("[%s] %s", *sevName, alert)
+	fmt.Printf("🚨 ALERT [%s]: %s\n", clock.Now().Format("15:04:05"), alert)
+	fmt.Println("--- Agent Taking Over ---")
 
 	// TODO: Add SOP (Standard Operating Procedure) to System Prompt
 	// SOP should include:
@@ -82,77 +268,207 @@ func main() {
 	// 2. If status is not 200, READ LOGS immediately
 	// 3. Analyze logs and choose the correct action
 	// 4. Verify fix by checking HTTP status again
-	sopPrompt := `You are a Site Reliability Engineer (SRE).
-Your goal is to fix the Payment Service.
-Follow this Standard Operating Procedure (SOP) strictly:
-1. Check HTTP status first.
-2. If status is not 200, READ LOGS immediately. Do not guess.
-3. Analyze logs:
-   - If "Syntax Error" or "Config Error" -> ROLLBACK.
-   - If "Connection Error" -> RESTART.
-4. Verify fix by checking HTTP status again.
-
-ALWAYS Think step by step. Output your thought process before calling a tool.`
-
-	messages := []openai.ChatCompletionMessage{
-		{Role: openai.ChatMessageRoleSystem, Content: sopPrompt},
-		{Role: openai.ChatMessageRoleUser, Content: "Payment Service is down (502). Fix it."},
-	}
-
-	// TODO: Implement agent loop that strictly follows SOP
-	// Loop should:
-	// 1. Send request to LLM
-	// 2. Check if there are ToolCalls
-	// 3. If there are ToolCalls - execute tools
-	// 4. Add results to history
-	// 5. Repeat until agent responds with text
-
-	// The Loop
-	for i := 0; i < 15; i++ {
-		req := openai.ChatCompletionRequest{
-			Model:       "gpt-4o-mini",
-			Messages:    messages,
-			Tools:       tools,
-			Temperature: 0, // Deterministic behavior
-		}
+	// The page is acknowledged before and closed after; the severity adds
+	// its rule. The wording around the steps is the shared "sop" template
+	// (pkg/prompts).
+	var notes []string
+	if sev.rule != "" {
+		notes = append(notes, sev.rule)
+	}
+	if cascading {
+		notes = append(notes, topologyRule)
+	}
+	sopPrompt := prompts.Must("sop", prompts.SOP{
+		Service: "the Payment Service",
+		Steps: []string{
+			"Acknowledge the page (pager, action ack) before anything else.",
+			"Check HTTP status.",
+			"If status is not 200, READ LOGS immediately. Do not guess.",
+			"Analyze logs:\n" +
+				"   - If \"Syntax Error\" or \"Config Error\" -> ROLLBACK.\n" +
+				"   - If \"Connection Error\" -> RESTART.",
+			"Verify fix by checking HTTP status again.",
+			"Close the page: resolve it once HTTP is 200 OK, or escalate it with a note if you can't fix the cause.",
+		},
+		Notes:         notes,
+		SimulatedTime: true,
+	})
 
-		resp, err := client.CreateChatCompletion(ctx, req)
-		if err != nil {
-			panic(err)
-		}
+	// Every step is logged as a structured event: text on stdout by default,
+	// JSON lines with AGENT_TRACE=json or AGENT_TRACE=<file> (see pkg/trace).
+	tr, err := trace.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer tr.Close()
 
-		msg := resp.Choices[0].Message
-		messages = append(messages, msg)
+	// With OTEL_EXPORTER_OTLP_ENDPOINT set, the run is also exported as
+	// OpenTelemetry spans: run → iterations → LLM and tool calls.
+	tracer := trace.TracerFromEnv("lab06-incident")
 
-		if len(msg.ToolCalls) == 0 {
-			fmt.Printf("\n🤖 Agent: %s\n", msg.Content)
-			break
-		}
+	// With -stream, text is printed as it arrives; whether it was a thought
+	// or the answer is only known when the turn ends.
+	streamed := false
 
-		fmt.Printf("\n🧠 Thought: %s\n", msg.Content) // Print Chain of Thought
-
-		for _, toolCall := range msg.ToolCalls {
-			fmt.Printf("🔧 Call: %s\n", toolCall.Function.Name)
-
-			var result string
-			switch toolCall.Function.Name {
-			case "check_http":
-				result = checkHttp()
-			case "read_logs":
-				result = readLogs()
-			case "restart_service":
-				result = restartService()
-			case "rollback_deploy":
-				result = rollback()
-			}
+	// Middleware wraps the LLM and tool calls without touching the loop:
+	// a token budget, an operator approving every action, or, with nobody
+	// watching, a limit on how often the service may be changed.
+	actions := []string{"restart_service", "rollback_deploy", "renew_cert", "restart_dependency"}
+	guard := &agent.ChangeGuard{Window: 10 * time.Minute, Tools: actions, Now: clock.Now}
+	var middleware []agent.Hooks
+	if *budget > 0 {
+		middleware = append(middleware, agent.TokenBudget(*budget))
+	}
+	var a *agent.Agent // The approval prompt shows the call as a command (Tool.Preview)
+	if *approve {
+		stdin := bufio.NewReader(os.Stdin)
+		middleware = append(middleware, agent.Approval(func(call openai.ToolCall) bool {
+			fmt.Printf("❓ Run `%s`? [y/N] ", a.Preview(call))
+			answer, _ := stdin.ReadString('\n')
+			return strings.ToLower(strings.TrimSpace(answer)) == "y"
+		}, actions...))
+	}
+	if *unattended {
+		middleware = append(middleware, guard.Hooks())
+	}
 
-			fmt.Printf("📦 Result: %s\n", result)
+	a = agent.New(client, agent.Config{
+		SystemPrompt:  sopPrompt,
+		MaxIterations: 15,
+		LoopLimit:     *loop,
+		Stream:        *stream,
+		Trace:         tr,
+		Tracer:        tracer,
+		Run:           run,
+		Now:           clock.Now, // Freshness of check results is measured in simulated time
+		Hooks: agent.Chain(append(middleware, agent.Hooks{
+			OnContent: func(delta string) {
+				if !streamed {
+					fmt.Print("\n💬 ")
+					streamed = true
+				}
+				fmt.Print(delta)
+			},
+			OnThought: func(content string) {
+				if streamed {
+					fmt.Println()
+					streamed = false
+					return
+				}
+				fmt.Printf("\n🧠 Thought: %s\n", content) // Print Chain of Thought
+			},
+			OnToolResult: func(call openai.ToolCall, result string) string {
+				// The action takes simulated time; scheduled events (expiry, backlog) fire here.
+				clock.Advance(toolDurations[call.Function.Name])
+				return fmt.Sprintf("[%s] %s", clock.Now().Format("15:04:05"), result)
+			},
+			OnLoop: func(call openai.ToolCall, n int) {
+				fmt.Printf("🔁 %s called %d times with the same arguments: telling the agent to stop\n", call.Function.Name, n)
+			},
+			OnReverify: func(call openai.ToolCall, was, now string) {
+				clock.Advance(toolDurations[call.Function.Name])
+				fmt.Printf("♻️  Re-verified %s before acting: %q → %q\n", call.Function.Name, was, now)
+			},
+		})...),
+	})
 
-			messages = append(messages, openai.ChatCompletionMessage{
-				Role:       openai.ChatMessageRoleTool,
-				Content:    result,
-				ToolCallID: toolCall.ID,
-			})
+	// Checks describe the system at the moment they ran (their results go
+	// stale after -ttl); actions change it. Before an action, stale checks
+	// are run again, and if the picture changed, the action is blocked.
+	for _, t := range []struct {
+		name, description string
+		run               func() string
+		command           string // What an action amounts to, shown for approval
+	}{
+		{"check_http", "Check service HTTP status", checkHttp, ""},
+		{"read_logs", "Read service logs. Do this if HTTP is 500/502.", readLogs, ""},
+		{"restart_service", "Restart the service. Use ONLY if logs show transient error.", restartService,
+			"systemctl restart payment-service"},
+		{"rollback_deploy", "Rollback to previous version. Use if logs show Config/Syntax error.", rollback,
+			"kubectl rollout undo deployment/payment-service"},
+		{"check_cert", "Check the service TLS certificate and its expiry time.", checkCert, ""},
+		{"renew_cert", "Renew the service TLS certificate. Takes about 2 minutes.", renewCert,
+			"certbot renew --cert-name payments.example.com"},
+	} {
+		name, run, command := t.name, t.run, t.command
+		tool := agent.Tool{
+			Name:        name,
+			Description: t.description,
+			Mutating:    command != "",
+			Execute: func(context.Context, json.RawMessage) (string, error) {
+				ran = append(ran, name)
+				return run(), nil
+			},
 		}
+		if tool.Mutating {
+			tool.Preview = func(json.RawMessage) string { return command }
+		} else {
+			tool.TTL = sev.ttl
+		}
+		a.RegisterTool(tool)
+	}
+	a.RegisterTool(tools.New("pager", "Acknowledge, resolve or escalate the page of this incident.", pager))
+	// With a real Prometheus (PROMETHEUS_URL), the agent can check the
+	// metrics behind the alert instead of trusting the canned checks.
+	if c, err := prom.FromEnv(); err == nil {
+		a.RegisterTool(prom.Tool(c))
+	}
+	if cascading {
+		for _, t := range topologyTools(sev.ttl) {
+			a.RegisterTool(t)
+		}
+	}
+
+	// The loop (pkg/agent): send request, execute ToolCalls, add results to history,
+	// repeat until the agent responds with text.
+	answer, err := a.Run(ctx, alert)
+	if errors.Is(err, context.Canceled) {
+		fmt.Printf("\n⏹  Interrupted. So far:\n%s", a.Recap())
+	} else if errors.Is(err, agent.ErrLoop) {
+		fmt.Printf("\n🔁 %v. So far:\n%s", err, a.Recap())
+	} else if errors.Is(err, agent.ErrBudget) {
+		fmt.Printf("\n💸 %v. So far:\n%s", err, a.Recap())
+	} else if err != nil && !errors.Is(err, agent.ErrMaxIterations) {
+		panic(err)
+	}
+	if err == nil && streamed {
+		fmt.Println()
+	} else if err == nil {
+		fmt.Printf("\n🤖 Agent: %s\n", answer)
+	}
+
+	for _, p := range guard.Queued() {
+		fmt.Printf("\n📋 Queued for review [%s]: %s (the service was changed at %s)",
+			p.At.Format("15:04:05"), p.Call.Function.Name, p.LastDone.Format("15:04:05"))
+	}
+	fmt.Printf("\n⏱  Simulated time: %s, payment backlog: %d, dropped by restarts: %d, service: %s\n",
+		clock.Since(startedAt), backlog, dropped, serviceState["status"])
+	printGrade(grade())
+
+	// An escalated page, or a run that stopped short of closing it, goes to
+	// a human. They get a handoff, not the transcript: the cause as the
+	// agent sees it, the evidence, the next steps with their risk.
+	reason := ""
+	switch {
+	case page.closedAs == "escalated":
+		status, reason = "escalated", "The agent escalated the page: "+page.note
+	case page.closedAs == "resolved":
+		status = "success"
+	case err != nil && !errors.Is(err, context.Canceled):
+		reason = fmt.Sprintf("The agent stopped without closing the page: %v", err)
+	}
+	if reason == "" {
+		return
+	}
+	handoff, err := a.Handoff(ctx, reason)
+	if err != nil {
+		fmt.Println("\n⚠️  No handoff:", err)
+		return
+	}
+	if err := run.WriteHandoff(handoff.Markdown(), handoff); err != nil {
+		fmt.Println("\n⚠️  Handoff not saved:", err)
+		return
 	}
+	fmt.Printf("\n🙋 Needs a human. Handoff: %s\n\n%s", filepath.Join(run.Dir, runs.HandoffFile), handoff.Markdown())
 }
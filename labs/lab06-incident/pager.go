@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// --- Severity ---
+// The alert comes with a severity, and the severity decides how the
+// incident is worked: a SEV1 costs payments every minute, so diagnostics
+// that don't change the fix are skipped; a SEV3 leaves time for the
+// careful path.
+type severity struct {
+	ackWithin   time.Duration // The page goes to the secondary on-call after this
+	closeWithin time.Duration // Resolved or escalated within this, or the grade fails
+	ttl         time.Duration // Default -ttl: how soon checks are re-run before an action
+	rule        string        // Added to the SOP; empty for none
+}
+
+var severities = map[string]severity{
+	"SEV1": {
+		ackWithin:   5 * time.Minute,
+		closeWithin: 15 * time.Minute,
+		ttl:         2 * time.Minute, // A recent check is good enough: no re-verification before the fix
+		rule:        "This is a SEV1: payments are failing right now. Skip diagnostics that don't change the fix: act as soon as the logs show the cause.",
+	},
+	"SEV2": {
+		ackWithin:   15 * time.Minute,
+		closeWithin: time.Hour,
+		ttl:         30 * time.Second,
+	},
+	"SEV3": {
+		ackWithin:   time.Hour,
+		closeWithin: 4 * time.Hour,
+		ttl:         30 * time.Second,
+		rule:        "This is a SEV3: there is time for the careful path. Rule out the other causes (check the TLS certificate) before you act.",
+	},
+}
+
+// --- Pager ---
+// The alert is a page. The agent acknowledges it before it starts and
+// closes it when it is done: resolved once the service is up, escalated
+// when it can't be fixed. A page nobody acknowledges in time goes to the
+// secondary on-call.
+var page struct {
+	severity string
+	ackedAt  time.Time
+	closedAt time.Time
+	closedAs string // "resolved" or "escalated"
+	note     string
+	missed   bool // Not acknowledged in time
+}
+
+// openPage opens the page for the alert and schedules its escalation.
+func openPage(sev string) {
+	page.severity = sev
+	deadline := clock.Now().Add(severities[sev].ackWithin)
+	clock.At(deadline, func() {
+		if page.ackedAt.IsZero() {
+			page.missed = true
+			fmt.Printf("📟 %s page not acknowledged by %s: escalated to the secondary on-call\n", sev, deadline.Format("15:04:05"))
+		}
+	})
+}
+
+// pagerArgs are the arguments of the pager tool.
+type pagerArgs struct {
+	Action string `json:"action" enum:"ack,resolve,escalate" description:"ack when you start, resolve when the service is up again, escalate when you can't fix it"`
+	Note   string `json:"note,omitempty" description:"For resolve and escalate: one line on the cause and what was done, or who should take over"`
+}
+
+func pager(_ context.Context, args pagerArgs) (string, error) {
+	fmt.Printf("   [TOOL] Pager: %s\n", args.Action)
+	ran = append(ran, "pager "+args.Action)
+	switch {
+	case page.closedAs != "":
+		return fmt.Sprintf("Error: the page was already %s at %s.", page.closedAs, page.closedAt.Format("15:04:05")), nil
+	case args.Action == "ack" && !page.ackedAt.IsZero():
+		return fmt.Sprintf("The page was already acknowledged at %s.", page.ackedAt.Format("15:04:05")), nil
+	case args.Action == "ack":
+		page.ackedAt = clock.Now()
+		return fmt.Sprintf("%s page acknowledged. Close it within %s.", page.severity, severities[page.severity].closeWithin), nil
+	case page.ackedAt.IsZero():
+		return "Error: acknowledge the page first.", nil
+	}
+	page.closedAt, page.closedAs, page.note = clock.Now(), args.Action+"d", args.Note
+	if args.Action == "escalate" {
+		return "Page escalated. The owning team has been paged.", nil
+	}
+	return "Page resolved.", nil
+}
+
+// --- Grade ---
+// ran names every tool call that ran, in order: what the grade is
+// computed from. Pager calls are "pager <action>", calls of the inventory
+// tools "<tool> <service>".
+var ran []string
+
+// check is one line of the grade.
+type check struct {
+	name string
+	ok   bool
+}
+
+// grade checks how the incident was worked against the SOP and the
+// limits of its severity.
+func grade() []check {
+	sev := severities[page.severity]
+	// index finds calls by name ("restart_dependency") or by name and
+	// argument ("restart_dependency db-main").
+	index := func(names ...string) (first, last int) {
+		first, last = -1, -1
+		for i, name := range ran {
+			if slices.Contains(names, name) || slices.Contains(names, strings.Fields(name)[0]) {
+				if first < 0 {
+					first = i
+				}
+				last = i
+			}
+		}
+		return first, last
+	}
+	firstAction, lastAction := index("restart_service", "rollback_deploy", "renew_cert", "restart_dependency")
+	firstDiagnosis, _ := index("read_logs", "check_cert", "read_service_logs")
+	_, lastCheck := index("check_http")
+	ack, _ := index("pager ack")
+
+	want := "resolved"
+	if serviceState["status"] != "running" {
+		want = "escalated"
+	}
+	checks := []check{
+		{fmt.Sprintf("page acknowledged within %s, before anything else", sev.ackWithin),
+			ack == 0 && !page.missed},
+		{"diagnosed (logs or certificate) before the first action",
+			firstAction < 0 || (firstDiagnosis >= 0 && firstDiagnosis < firstAction)},
+		{"HTTP checked after the last action",
+			lastCheck > lastAction},
+		{fmt.Sprintf("page %s (the service is %s)", want, serviceState["status"]),
+			page.closedAs == want},
+		{fmt.Sprintf("page closed within %s", sev.closeWithin),
+			page.closedAs != "" && page.closedAt.Sub(startedAt) <= sev.closeWithin},
+	}
+	return append(checks, topologyChecks(index)...)
+}
+
+// printGrade prints the grade of the run.
+func printGrade(checks []check) {
+	passed := 0
+	for _, c := range checks {
+		if c.ok {
+			passed++
+		}
+	}
+	if page.closedAs != "" {
+		fmt.Printf("📟 Page %s at %s: %s\n", page.closedAs, page.closedAt.Format("15:04:05"), page.note)
+	}
+	fmt.Printf("📝 Grade (%s): %d/%d\n", page.severity, passed, len(checks))
+	for _, c := range checks {
+		mark := "✅"
+		if !c.ok {
+			mark = "❌"
+		}
+		fmt.Printf("  %s %s\n", mark, c.name)
+	}
+}
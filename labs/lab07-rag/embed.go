@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/vecindex"
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Embeddings: ranking by meaning (-eval -embeddings) ---
+//
+// The rankers of retrieve.go match words: "the service is down" finds
+// nothing about "restart". Embeddings compare meaning, for the price of a
+// model call per text. The chunks are embedded once and kept in kb.vec
+// (pkg/vecindex); the next run sends only new or edited chunks to the
+// model, and another embedding model rebuilds the file.
+
+// indexFile keeps the embeddings of the chunks and the eval queries.
+const indexFile = "kb.vec"
+
+// embeddingModel embeds chunks and queries.
+const embeddingModel = openai.SmallEmbedding3
+
+// embeddingRetriever embeds the chunks and the queries (the ones indexFile
+// lacks) and returns a retriever that ranks the chunks by cosine
+// similarity to the query.
+func embeddingRetriever(ctx context.Context, client llm.Provider, chunks []Chunk, queries []string) (retriever, error) {
+	ix, err := vecindex.Open(indexFile, string(embeddingModel))
+	if err != nil {
+		return nil, err
+	}
+	if ix.Rebuilt != "" {
+		fmt.Printf("Rebuilding %s: %s\n", indexFile, ix.Rebuilt)
+	}
+	var texts []string
+	for _, c := range chunks {
+		texts = append(texts, searchable(c))
+	}
+	texts = append(texts, queries...)
+	ix.Retain(texts) // Chunks of documents edited since: never found again
+	cached := ix.Len()
+	if _, err := ix.Embed(ctx, client, texts); err != nil {
+		return nil, fmt.Errorf("embeddings: %w", err)
+	}
+	if err := ix.Save(indexFile); err != nil {
+		return nil, err
+	}
+	fmt.Printf("%s: %d texts, %d embedded now\n\n", indexFile, ix.Len(), ix.Len()-cached)
+
+	return func(chunks []Chunk, query string) []Chunk {
+		q, ok := ix.Lookup(query)
+		if !ok {
+			return nil
+		}
+		var hits []scored
+		for _, c := range chunks {
+			v, _ := ix.Lookup(searchable(c))
+			hits = append(hits, scored{c, vecindex.Cosine(q, v)})
+		}
+		return ranked(hits)
+	}, nil
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// --- Ingestion: documents → chunks ---
+//
+// Search returns chunks, not files: a whole file is too much context, and a
+// fixed-size window cuts a procedure in half. Each format is split along
+// its own structure, so a chunk is a unit a human would quote: a Markdown
+// section under its headings, a YAML subtree under its key path, a Go
+// declaration with its doc comment.
+
+// Chunk is one retrievable piece of a document.
+type Chunk struct {
+	Source string // File name
+	Path   string // Place in the file: "Restart Protocol > Steps", "spec.template", "func Drain"
+	Text   string
+}
+
+// ID names the chunk in evaluation sets: "phoenix.md#Rollback", or just
+// the file name for a chunk without a path.
+func (c Chunk) ID() string {
+	if c.Path == "" {
+		return c.Source
+	}
+	return c.Source + "#" + c.Path
+}
+
+// chunker splits one document into chunks.
+type chunker func(name, content string) []Chunk
+
+// chunkers by file extension. Other files are plain text.
+var chunkers = map[string]chunker{
+	".md":       chunkMarkdown,
+	".markdown": chunkMarkdown,
+	".yaml":     chunkYAML,
+	".yml":      chunkYAML,
+	".go":       chunkGo,
+}
+
+// chunkerFor picks the chunker by the file extension.
+func chunkerFor(name string) chunker {
+	if c, ok := chunkers[strings.ToLower(path.Ext(name))]; ok {
+		return c
+	}
+	return chunkText
+}
+
+// ingest chunks every file in fsys.
+func ingest(fsys fs.FS) ([]Chunk, error) {
+	var chunks []Chunk
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		chunks = append(chunks, chunkerFor(name)(name, string(data))...)
+		return nil
+	})
+	return chunks, err
+}
+
+// --- Plain text ---
+
+// maxTextChunk is the size plain-text paragraphs are merged up to.
+const maxTextChunk = 800
+
+// chunkText splits text by paragraphs (blank lines) and merges neighbors
+// up to maxTextChunk characters. A short document stays one chunk.
+func chunkText(name, content string) []Chunk {
+	var chunks []Chunk
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() > 0 {
+			chunks = append(chunks, Chunk{Source: name, Text: cur.String()})
+			cur.Reset()
+		}
+	}
+	for _, p := range regexp.MustCompile(`\n\s*\n`).Split(content, -1) {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if cur.Len() > 0 && cur.Len()+len(p) > maxTextChunk {
+			flush()
+		}
+		if cur.Len() > 0 {
+			cur.WriteString("\n\n")
+		}
+		cur.WriteString(p)
+	}
+	flush()
+	if len(chunks) > 1 {
+		for i := range chunks {
+			chunks[i].Path = fmt.Sprintf("part %d", i+1)
+		}
+	}
+	return chunks
+}
+
+// --- Markdown: one chunk per section ---
+
+var mdHeading = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+
+// chunkMarkdown makes a chunk of every section's own text; its Path is the
+// trail of headings above it. Headings inside fenced code blocks ("# comment"
+// in a bash snippet) are not headings. Sections with no text of their own
+// (a heading right before a subheading) give no chunk.
+func chunkMarkdown(name, content string) []Chunk {
+	var chunks []Chunk
+	var trail []string // trail[i] is the current heading of level i+1
+	var body []string
+	fenced := false
+	flush := func() {
+		text := strings.TrimSpace(strings.Join(body, "\n"))
+		body = nil
+		if text == "" {
+			return
+		}
+		var headings []string
+		for _, h := range trail {
+			if h != "" {
+				headings = append(headings, h)
+			}
+		}
+		chunks = append(chunks, Chunk{Source: name, Path: strings.Join(headings, " > "), Text: text})
+	}
+	for _, line := range strings.Split(content, "\n") {
+		if t := strings.TrimSpace(line); strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~") {
+			fenced = !fenced
+		}
+		m := mdHeading.FindStringSubmatch(line)
+		if m == nil || fenced {
+			body = append(body, line)
+			continue
+		}
+		flush()
+		level := len(m[1])
+		for len(trail) < level-1 {
+			trail = append(trail, "")
+		}
+		trail = append(trail[:level-1], m[2])
+	}
+	flush()
+	return chunks
+}
+
+// --- YAML: one chunk per subtree that fits ---
+
+// maxYAMLLines is the size of a YAML chunk. A bigger subtree is split into
+// its children; small siblings are grouped together.
+const maxYAMLLines = 12
+
+// yamlNode is one entry of a mapping or a list, with everything nested in it.
+type yamlNode struct {
+	key   string   // "spec", or "[0]" for a list item
+	lines []string // The entry's line and its nested lines
+	at    int      // Index of the entry's line: comments may come before it
+}
+
+// chunkYAML splits every document of the file (separated by "---") along
+// its key paths: "spec.template.spec.containers[0]", "doc 2: spec" in a
+// file of several documents. Every chunk starts
+// with the lines of its parent keys, so it reads as valid YAML with its
+// context. The indentation is all it looks at: no YAML library needed.
+func chunkYAML(name, content string) []Chunk {
+	var chunks []Chunk
+	docs := regexp.MustCompile(`(?m)^---\s*$`).Split(content, -1)
+	n := 0
+	for _, doc := range docs {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		n++
+		prefix := ""
+		if len(docs) > 1 {
+			prefix = fmt.Sprintf("doc %d", n)
+		}
+		chunkYAMLBlock(name, prefix, "", nil, strings.Split(strings.Trim(doc, "\n"), "\n"), &chunks)
+	}
+	return chunks
+}
+
+func chunkYAMLBlock(name, prefix, keyPath string, header, lines []string, out *[]Chunk) {
+	var group []yamlNode
+	size := 0
+	flush := func() {
+		if len(group) == 0 {
+			return
+		}
+		p := keyPath
+		if len(group) == 1 {
+			p = joinKeyPath(keyPath, group[0].key)
+		}
+		text := append([]string{}, header...)
+		for _, e := range group {
+			text = append(text, e.lines...)
+		}
+		if prefix != "" && p != "" {
+			p = prefix + ": " + p
+		} else if prefix != "" {
+			p = prefix
+		}
+		*out = append(*out, Chunk{Source: name, Path: p, Text: strings.Join(text, "\n")})
+		group, size = nil, 0
+	}
+	for _, e := range yamlEntries(lines) {
+		if len(e.lines) > maxYAMLLines && !yamlScalarBlock(e.lines[e.at]) {
+			flush()
+			chunkYAMLBlock(name, prefix, joinKeyPath(keyPath, e.key), append(header[:len(header):len(header)], e.lines[:e.at+1]...), e.lines[e.at+1:], out)
+			continue
+		}
+		if size+len(e.lines) > maxYAMLLines {
+			flush()
+		}
+		group = append(group, e)
+		size += len(e.lines)
+	}
+	flush()
+}
+
+// yamlEntries splits lines into the entries at the indentation of the
+// first one. Comments and blank lines stay with the entry before them
+// (leading ones with the first entry).
+func yamlEntries(lines []string) []yamlNode {
+	indent := -1
+	for _, l := range lines {
+		if t := strings.TrimSpace(l); t != "" && !strings.HasPrefix(t, "#") {
+			indent = len(l) - len(strings.TrimLeft(l, " "))
+			break
+		}
+	}
+	var nodes []yamlNode
+	var pending []string // Lines before the first entry
+	items := 0
+	for _, l := range lines {
+		t := strings.TrimSpace(l)
+		structural := t != "" && !strings.HasPrefix(t, "#")
+		if structural && len(l)-len(strings.TrimLeft(l, " ")) == indent {
+			key, _, _ := strings.Cut(t, ":")
+			if strings.HasPrefix(t, "- ") || t == "-" {
+				key = fmt.Sprintf("[%d]", items)
+				items++
+			}
+			nodes = append(nodes, yamlNode{key: strings.Trim(key, `"'`), lines: append(pending, l), at: len(pending)})
+			pending = nil
+			continue
+		}
+		if len(nodes) == 0 {
+			pending = append(pending, l)
+			continue
+		}
+		last := &nodes[len(nodes)-1]
+		last.lines = append(last.lines, l)
+	}
+	return nodes
+}
+
+// yamlScalarBlock reports whether the entry's value is a multi-line string
+// ("key: |"): its lines are text, not keys, and can't be split.
+func yamlScalarBlock(line string) bool {
+	t := strings.TrimSpace(line)
+	for _, s := range []string{"|", "|-", "|+", ">", ">-", ">+"} {
+		if strings.HasSuffix(t, " "+s) || strings.HasSuffix(t, ":"+s) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinKeyPath(keyPath, key string) string {
+	if keyPath == "" || strings.HasPrefix(key, "[") {
+		return keyPath + key
+	}
+	return keyPath + "." + key
+}
+
+// --- Go: one chunk per declaration ---
+
+// chunkGo makes a chunk of every top-level declaration (function, type,
+// const or var group) together with its doc comment, plus one for the
+// package doc. Imports are left out: they say little about what the code
+// does. A file that doesn't parse is chunked as plain text.
+func chunkGo(name, content string) []Chunk {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, name, content, parser.ParseComments)
+	if err != nil {
+		return chunkText(name, content)
+	}
+	source := func(from, to token.Pos) string {
+		return content[fset.Position(from).Offset:fset.Position(to).Offset]
+	}
+
+	var chunks []Chunk
+	if f.Doc != nil {
+		chunks = append(chunks, Chunk{Source: name, Path: "package " + f.Name.Name, Text: source(f.Doc.Pos(), f.Name.End())})
+	}
+	for _, decl := range f.Decls {
+		var p string
+		var doc *ast.CommentGroup
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			doc, p = d.Doc, "func "+d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				p = fmt.Sprintf("func (%s) %s", goTypeName(d.Recv.List[0].Type), d.Name.Name)
+			}
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			var names []string
+			for _, s := range d.Specs {
+				switch s := s.(type) {
+				case *ast.TypeSpec:
+					names = append(names, s.Name.Name)
+				case *ast.ValueSpec:
+					for _, n := range s.Names {
+						names = append(names, n.Name)
+					}
+				}
+			}
+			doc, p = d.Doc, d.Tok.String()+" "+strings.Join(names, ", ")
+		}
+		start := decl.Pos()
+		if doc != nil {
+			start = doc.Pos()
+		}
+		chunks = append(chunks, Chunk{Source: name, Path: p, Text: source(start, decl.End())})
+	}
+	return chunks
+}
+
+// goTypeName renders a receiver type: "*Backend", "List[T]".
+func goTypeName(e ast.Expr) string {
+	switch t := e.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return "*" + goTypeName(t.X)
+	case *ast.IndexExpr:
+		return goTypeName(t.X) + "[" + goTypeName(t.Index) + "]"
+	case *ast.IndexListExpr:
+		var params []string
+		for _, i := range t.Indices {
+			params = append(params, goTypeName(i))
+		}
+		return goTypeName(t.X) + "[" + strings.Join(params, ", ") + "]"
+	}
+	return "?"
+}
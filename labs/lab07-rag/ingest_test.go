@@ -0,0 +1,209 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// paths returns the Path of every chunk.
+func paths(chunks []Chunk) []string {
+	var out []string
+	for _, c := range chunks {
+		out = append(out, c.Path)
+	}
+	return out
+}
+
+func TestChunkMarkdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		paths   []string
+	}{
+		{
+			name:    "sections under their headings",
+			content: "# Phoenix\nIntro.\n## Restart\nStop it.\n### Steps\n1. Drain.\n## Rollback\nDeploy the previous tag.\n",
+			paths:   []string{"Phoenix", "Phoenix > Restart", "Phoenix > Restart > Steps", "Phoenix > Rollback"},
+		},
+		{
+			name:    "heading with no text of its own",
+			content: "# Phoenix\n## Restart\nStop it.\n",
+			paths:   []string{"Phoenix > Restart"},
+		},
+		{
+			name:    "comment in a code block is not a heading",
+			content: "# Restart\n```bash\n# drain first\nkubectl drain node\n```\n",
+			paths:   []string{"Restart"},
+		},
+		{
+			name:    "skipped level",
+			content: "# Phoenix\n### Limits\nTen pods.\n## Rollback\nPrevious tag.\n",
+			paths:   []string{"Phoenix > Limits", "Phoenix > Rollback"},
+		},
+		{
+			name:    "text before the first heading",
+			content: "Owned by the payments team.\n# Phoenix\nIntro.\n",
+			paths:   []string{"", "Phoenix"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := chunkMarkdown("phoenix.md", tt.content)
+			if got := paths(chunks); !reflect.DeepEqual(got, tt.paths) {
+				t.Errorf("paths = %q, want %q", got, tt.paths)
+			}
+			for _, c := range chunks {
+				if c.Source != "phoenix.md" || strings.HasPrefix(c.Text, "#") {
+					t.Errorf("chunk %q: Source %q, Text %q", c.Path, c.Source, c.Text)
+				}
+			}
+		})
+	}
+}
+
+func TestChunkYAML(t *testing.T) {
+	deployment := `apiVersion: apps/v1
+kind: Deployment
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+        - name: api
+          image: api:1.4
+          env:
+            - name: DB_HOST
+              value: db
+            - name: DB_POOL
+              value: "20"
+          ports:
+            - 8080
+          resources:
+            limits:
+              memory: 512Mi
+        - name: sidecar
+          image: proxy:2
+`
+	tests := []struct {
+		name    string
+		content string
+		paths   []string
+		first   string // Start of the first chunk
+	}{
+		{
+			name:    "small file is one chunk",
+			content: "replicas: 3\nimage: api:1.4\n",
+			paths:   []string{""},
+			first:   "replicas: 3",
+		},
+		{
+			name:    "big subtree split along key paths",
+			content: deployment,
+			paths:   []string{"", "spec.replicas", "spec.template.spec.containers[0]", "spec.template.spec.containers[1]"},
+			first:   "apiVersion: apps/v1",
+		},
+		{
+			name:    "documents of one file",
+			content: "kind: Service\n---\nkind: ConfigMap\n",
+			paths:   []string{"doc 1: kind", "doc 2: kind"},
+			first:   "kind: ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := chunkYAML("deploy.yaml", tt.content)
+			if got := paths(chunks); !reflect.DeepEqual(got, tt.paths) {
+				t.Errorf("paths = %q, want %q", got, tt.paths)
+			}
+			for _, c := range chunks {
+				if c.Path != "" && strings.HasPrefix(c.Path, "spec") && !strings.HasPrefix(c.Text, "spec:") {
+					t.Errorf("chunk %q doesn't start with its parent keys:\n%s", c.Path, c.Text)
+				}
+			}
+			if len(chunks) > 0 && !strings.HasPrefix(chunks[0].Text, tt.first) {
+				t.Errorf("first chunk = %q, want it to start with %q", chunks[0].Text, tt.first)
+			}
+		})
+	}
+}
+
+func TestChunkGo(t *testing.T) {
+	src := `// Package drain evicts pods before maintenance.
+package drain
+
+import "context"
+
+// Timeout is how long a drain may take.
+const Timeout = 300
+
+// Node is a cluster node.
+type Node struct{ Name string }
+
+// Drain evicts every pod of n.
+func Drain(ctx context.Context, n *Node) error {
+	return nil
+}
+
+func (n *Node) String() string { return n.Name }
+`
+	tests := []struct {
+		name    string
+		content string
+		paths   []string
+	}{
+		{
+			name:    "declarations with doc comments",
+			content: src,
+			paths:   []string{"package drain", "const Timeout", "type Node", "func Drain", "func (*Node) String"},
+		},
+		{
+			name:    "file that doesn't parse is plain text",
+			content: "package drain\n\nfunc Drain( {\n",
+			paths:   []string{""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := chunkGo("drain.go", tt.content)
+			if got := paths(chunks); !reflect.DeepEqual(got, tt.paths) {
+				t.Errorf("paths = %q, want %q", got, tt.paths)
+			}
+		})
+	}
+
+	for _, c := range chunkGo("drain.go", src) {
+		if c.Path == "func Drain" {
+			want := "// Drain evicts every pod of n.\nfunc Drain(ctx context.Context, n *Node) error {\n\treturn nil\n}"
+			if c.Text != want {
+				t.Errorf("func Drain chunk = %q, want %q", c.Text, want)
+			}
+		}
+		if strings.Contains(c.Text, "import") {
+			t.Errorf("chunk %q has the imports", c.Path)
+		}
+	}
+}
+
+func TestChunkerFor(t *testing.T) {
+	files := fstest.MapFS{
+		"phoenix.md":     {Data: []byte("# Restart\nStop it.\n")},
+		"notes.MARKDOWN": {Data: []byte("# Notes\nText.\n")},
+		"deploy.yml":     {Data: []byte("replicas: 3\n")},
+		"drain.go":       {Data: []byte("package drain\n\nfunc Drain() {}\n")},
+		"oncall.txt":     {Data: []byte("# not a heading\n\nCall Bob.\n")},
+	}
+	chunks, err := ingest(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range chunks {
+		got = append(got, c.ID())
+	}
+	want := []string{"deploy.yml#replicas", "drain.go#func Drain", "notes.MARKDOWN#Notes", "oncall.txt", "phoenix.md#Restart"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("chunk IDs = %q, want %q", got, want)
+	}
+}
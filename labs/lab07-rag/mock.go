@@ -0,0 +1,16 @@
+package main
+
+import "github.com/kshvakov/agent/pkg/mockllm"
+
+// Offline run: OPENAI_BASE_URL=mock go run .
+// The scripted model searches the knowledge base before acting, as the
+// system prompt requires, and follows the protocol it found.
+func init() {
+	mockllm.Register(
+		mockllm.Call("search_knowledge_base", map[string]any{"query": "phoenix"}),
+		mockllm.Call("search_knowledge_base", map[string]any{"query": "restart"}),
+		mockllm.Call("run_backup", nil),
+		mockllm.Call("restart_server", map[string]any{"name": "phoenix"}),
+		mockllm.Say("Phoenix restarted per protocol: backup first (policy #12), then restart."),
+	)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// --- Retrieval: query → ranked chunks ---
+//
+// Three ways to rank the same chunks. search_knowledge_base uses the first;
+// -eval measures all of them on the labeled queries in evalset.json, and
+// with -embeddings a fourth one (see embed.go).
+
+// retriever ranks the chunks that match query, best first.
+type retriever func(chunks []Chunk, query string) []Chunk
+
+// namedRetriever is a retriever as -eval reports it.
+type namedRetriever struct {
+	name string
+	rank retriever
+}
+
+var retrievers = []namedRetriever{
+	{"substring", rankSubstring},
+	{"keywords", rankKeywords},
+	{"bm25", rankBM25},
+}
+
+// scored is a chunk with its score for one query.
+type scored struct {
+	chunk Chunk
+	score float64
+}
+
+// ranked drops chunks that scored 0 and sorts the rest by score. Ties keep
+// the knowledge base order.
+func ranked(hits []scored) []Chunk {
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+	var out []Chunk
+	for _, h := range hits {
+		if h.score > 0 {
+			out = append(out, h.chunk)
+		}
+	}
+	return out
+}
+
+// searchable is the text a query is matched against: the section path
+// carries words the text itself may lack ("Rollback", "func Undrain").
+func searchable(c Chunk) string {
+	return strings.ToLower(c.Path + "\n" + c.Text)
+}
+
+// rankSubstring finds the whole query as a substring, scored by the number
+// of occurrences. "restart phoenix" doesn't find "Phoenix server restart
+// protocol": simple and brittle.
+func rankSubstring(chunks []Chunk, query string) []Chunk {
+	q := strings.ToLower(query)
+	var hits []scored
+	for _, c := range chunks {
+		hits = append(hits, scored{c, float64(strings.Count(searchable(c), q))})
+	}
+	return ranked(hits)
+}
+
+var wordRE = regexp.MustCompile(`[\p{L}\p{N}_]+`)
+
+func words(s string) []string {
+	return wordRE.FindAllString(strings.ToLower(s), -1)
+}
+
+// rankKeywords scores a chunk by the number of distinct query words it
+// contains: word order doesn't matter, every word weighs the same ("how"
+// as much as "drain").
+func rankKeywords(chunks []Chunk, query string) []Chunk {
+	var hits []scored
+	for _, c := range chunks {
+		text := searchable(c)
+		n := 0
+		for _, w := range unique(words(query)) {
+			if strings.Contains(text, w) {
+				n++
+			}
+		}
+		hits = append(hits, scored{c, float64(n)})
+	}
+	return ranked(hits)
+}
+
+// BM25 parameters: term frequency saturation and length normalization.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// rankBM25 is the classic lexical ranking of search engines: a word found
+// in few chunks (rare, so telling) weighs more than one found everywhere,
+// repeats count with diminishing returns, long chunks are penalized.
+func rankBM25(chunks []Chunk, query string) []Chunk {
+	docs := make([][]string, len(chunks))
+	df := map[string]int{}
+	total := 0
+	for i, c := range chunks {
+		docs[i] = words(c.Path + "\n" + c.Text)
+		total += len(docs[i])
+		for _, w := range unique(docs[i]) {
+			df[w]++
+		}
+	}
+	if len(chunks) == 0 {
+		return nil
+	}
+	avg := float64(total) / float64(len(chunks))
+	n := float64(len(chunks))
+
+	var hits []scored
+	for i, c := range chunks {
+		tf := map[string]int{}
+		for _, w := range docs[i] {
+			tf[w]++
+		}
+		score := 0.0
+		for _, w := range unique(words(query)) {
+			if tf[w] == 0 {
+				continue
+			}
+			idf := math.Log(1 + (n-float64(df[w])+0.5)/(float64(df[w])+0.5))
+			f := float64(tf[w])
+			score += idf * f * (bm25K1 + 1) / (f + bm25K1*(1-bm25B+bm25B*float64(len(docs[i]))/avg))
+		}
+		hits = append(hits, scored{c, score})
+	}
+	return ranked(hits)
+}
+
+func unique(ws []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, w := range ws {
+		if !seen[w] {
+			seen[w] = true
+			out = append(out, w)
+		}
+	}
+	return out
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/agent"
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/llm/usage"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Experiment mode (-bench): is a team worth it? The same task runs with a
+// single generalist that holds every tool and with the supervisor/worker
+// team, once per seed each. Both get the same seeds and temperature, so
+// the difference comes from the topology.
+
+// topology runs the task once and returns the final answer. seen is the
+// run's dedup pass of worker answers, if the topology has workers.
+type topology struct {
+	name string
+	run  func(ctx context.Context, client llm.Provider, seen *reported) (string, error)
+}
+
+var topologies = []topology{
+	{"generalist", func(ctx context.Context, client llm.Provider, _ *reported) (string, error) {
+		generalist := agent.New(client, agent.Config{
+			SystemPrompt:  "You are a DevOps engineer. You know networking and databases. Use the tools to check facts before answering.",
+			MaxIterations: 10,
+		})
+		for _, t := range append(networkTools(), databaseTools()...) {
+			generalist.RegisterTool(t)
+		}
+		return generalist.Run(ctx, task)
+	}},
+	{"multi-agent", func(ctx context.Context, client llm.Provider, seen *reported) (string, error) {
+		return newSupervisor(client, nil, nil, seen).Run(ctx, task)
+	}},
+}
+
+// solved checks the answer for the fact only the database can give.
+func solved(answer string) bool {
+	return strings.Contains(answer, "15.2")
+}
+
+// benchResult is one run of one topology.
+type benchResult struct {
+	ok       bool
+	requests int // LLM calls of all agents: the iterations of the run
+	tokens   int
+	latency  time.Duration
+	deduped  int // Characters of worker answers dropped as repeats
+}
+
+func benchmark(ctx context.Context, client llm.Provider, seeds int, temperature float32) {
+	fmt.Printf("Benchmark: %d seeds per topology, temperature %.1f\n\n", seeds, temperature)
+	results := map[string][]benchResult{}
+	for seed := 1; seed <= seeds; seed++ {
+		for _, t := range topologies {
+			// A tracker per run: usage.Default keeps counting the whole benchmark.
+			tracker := &usage.Tracker{}
+			c := llm.WithUsage(&sampled{Provider: client, seed: seed, temperature: temperature}, tracker)
+			seen := &reported{}
+
+			start := time.Now()
+			answer, err := t.run(ctx, c, seen)
+			r := benchResult{ok: err == nil && solved(answer), latency: time.Since(start), deduped: seen.saved()}
+			for _, m := range tracker.Models() {
+				r.requests += m.Requests
+				r.tokens += m.PromptTokens + m.CompletionTokens
+			}
+			results[t.name] = append(results[t.name], r)
+
+			status := "ok"
+			if err != nil {
+				status = "error: " + err.Error()
+			} else if !r.ok {
+				status = "wrong answer"
+			}
+			fmt.Printf("  seed %-3d %-12s %2d requests %6d tokens %8s %5d deduped  %s\n",
+				seed, t.name, r.requests, r.tokens, r.latency.Round(time.Millisecond), r.deduped, status)
+		}
+	}
+
+	fmt.Printf("\n  %-12s %8s %9s %8s %9s %8s\n", "topology", "success", "requests", "tokens", "latency", "deduped")
+	for _, t := range topologies {
+		var ok, requests, tokens, deduped int
+		var latency time.Duration
+		for _, r := range results[t.name] {
+			if r.ok {
+				ok++
+			}
+			requests += r.requests
+			tokens += r.tokens
+			latency += r.latency
+			deduped += r.deduped
+		}
+		n := len(results[t.name])
+		fmt.Printf("  %-12s %8s %9.1f %8d %9s %8d\n", t.name, fmt.Sprintf("%d/%d", ok, n),
+			float64(requests)/float64(n), tokens/n, (latency / time.Duration(n)).Round(time.Millisecond), deduped/n)
+	}
+	fmt.Println("\n  (requests, tokens and latency are means per run; deduped: characters of")
+	fmt.Println("   worker answers kept out of the supervisor's context)")
+}
+
+// sampled sets the seed and temperature of every chat request, so all
+// agents of a run, supervisor and workers, sample the same way.
+type sampled struct {
+	llm.Provider
+	seed        int
+	temperature float32
+}
+
+func (s *sampled) ChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	req.Seed = &s.seed
+	req.Temperature = s.temperature
+	return s.Provider.ChatCompletion(ctx, req)
+}
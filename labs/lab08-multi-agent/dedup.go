@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Workers overlap: both specialists may say the host is reachable, a
+// second question to the same specialist repeats half of the first
+// answer. Every repeated sentence is context the supervisor reads again on
+// each of its following steps. reported is the dedup pass between the
+// workers and the supervisor: a worker's answer reaches the supervisor's
+// history without the sentences it has already seen.
+
+// sameFact is the word overlap (Jaccard) from which two sentences are
+// taken to state the same fact.
+const sameFact = 0.8
+
+// reported holds the sentences already returned to the supervisor. One
+// is shared by all workers of a run; workers run in parallel, hence the
+// lock.
+type reported struct {
+	mu        sync.Mutex
+	sentences []map[string]bool // Words of each reported sentence
+	in, out   int               // Characters of the worker answers before and after the pass
+	dropped   int               // Sentences dropped as repeats
+}
+
+// merge returns answer without the sentences already reported and
+// remembers the rest.
+func (r *reported) merge(answer string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var kept []string
+	for _, s := range sentences(answer) {
+		w := words(s)
+		if r.seen(w) {
+			r.dropped++
+			continue
+		}
+		r.sentences = append(r.sentences, w)
+		kept = append(kept, s)
+	}
+	merged := strings.Join(kept, " ")
+	if merged == "" && answer != "" {
+		merged = "Nothing new: everything in this answer is already reported above."
+	}
+	r.in += len(answer)
+	r.out += len(merged)
+	return merged
+}
+
+// seen reports whether a sentence with words w is already reported.
+func (r *reported) seen(w map[string]bool) bool {
+	if len(w) == 0 {
+		return false
+	}
+	for _, prev := range r.sentences {
+		if overlap(w, prev) >= sameFact {
+			return true
+		}
+	}
+	return false
+}
+
+// Print writes how much of the workers' output the pass kept out of the
+// supervisor's context (tokens are estimated at 4 characters each).
+func (r *reported) Print(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.in == 0 {
+		return
+	}
+	saved := r.in - r.out
+	fmt.Fprintf(w, "Dedup: %d of %d characters of worker answers (%.0f%%, ~%d tokens) kept out of the supervisor's context; repeated sentences: %d\n",
+		saved, r.in, 100*float64(saved)/float64(r.in), saved/4, r.dropped)
+}
+
+// saved returns the characters the pass has dropped so far.
+func (r *reported) saved() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.in - r.out
+}
+
+// sentences splits text at line breaks and at sentence ends: ".", "!" or
+// "?" followed by a space. "15.2" stays whole.
+func sentences(text string) []string {
+	var out []string
+	for _, line := range strings.Split(text, "\n") {
+		start := 0
+		for i := 0; i < len(line); i++ {
+			if strings.IndexByte(".!?", line[i]) >= 0 && (i+1 == len(line) || line[i+1] == ' ') {
+				out = appendSentence(out, line[start:i+1])
+				start = i + 1
+			}
+		}
+		out = appendSentence(out, line[start:])
+	}
+	return out
+}
+
+func appendSentence(out []string, s string) []string {
+	if s = strings.TrimSpace(s); s != "" {
+		out = append(out, s)
+	}
+	return out
+}
+
+// words returns the lowercase words of a sentence, punctuation stripped.
+func words(s string) map[string]bool {
+	w := map[string]bool{}
+	for _, f := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.' && r != '-'
+	}) {
+		if f = strings.Trim(f, ".-"); f != "" {
+			w[f] = true
+		}
+	}
+	return w
+}
+
+// overlap is the Jaccard similarity of two word sets.
+func overlap(a, b map[string]bool) float64 {
+	inter := 0
+	for w := range a {
+		if b[w] {
+			inter++
+		}
+	}
+	union := len(a) + len(b) - inter
+	if union == 0 {
+		return 0
+	}
+	return float64(inter) / float64(union)
+}
@@ -2,13 +2,23 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
-
-	"github.com/sashabaranov/go-openai"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/agent"
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/llm/usage"
+	"github.com/kshvakov/agent/pkg/prompts"
+	"github.com/kshvakov/agent/pkg/tools"
+	"github.com/kshvakov/agent/pkg/trace"
 )
 
+// task is the troubleshooting task of the lab: two specialties, one answer.
+const task = "Check if DB server db-host.example.com is reachable, and if yes — find out PostgreSQL version"
+
 // Mock Tools for Network Specialist
 func ping(host string) string {
 	return fmt.Sprintf("Host %s is reachable. Latency: 5ms", host)
@@ -23,216 +33,189 @@ func runSQL(query string) string {
 }
 
 // Function to run Worker agent
-func runWorkerAgent(role, systemPrompt, question string, tools []openai.Tool, client *openai.Client) string {
-	ctx := context.Background()
-	
-	// Create NEW context for worker (isolation!)
-	messages := []openai.ChatCompletionMessage{
-		{Role: openai.ChatMessageRoleSystem, Content: systemPrompt},
-		{Role: openai.ChatMessageRoleUser, Content: question},
-	}
-
-	// Simple loop for worker (usually 1-2 steps)
-	for i := 0; i < 5; i++ {
-		req := openai.ChatCompletionRequest{
-			Model:    "gpt-4o-mini",
-			Messages: messages,
-			Tools:   tools,
-		}
-
-		resp, err := client.CreateChatCompletion(ctx, req)
-		if err != nil {
-			return fmt.Sprintf("Worker error: %v", err)
-		}
-
-		msg := resp.Choices[0].Message
-		messages = append(messages, msg)
-
-		if len(msg.ToolCalls) == 0 {
-			return msg.Content // Return worker's final answer
-		}
-
-		// Execute worker's tools
-		for _, toolCall := range msg.ToolCalls {
-			var result string
-			if toolCall.Function.Name == "ping" {
-				var args struct {
-					Host string `json:"host"`
-				}
-				json.Unmarshal([]byte(toolCall.Function.Arguments), &args)
-				result = ping(args.Host)
-			} else if toolCall.Function.Name == "run_sql" {
-				var args struct {
-					Query string `json:"query"`
-				}
-				json.Unmarshal([]byte(toolCall.Function.Arguments), &args)
-				result = runSQL(args.Query)
-			}
-
-			messages = append(messages, openai.ChatCompletionMessage{
-				Role:       openai.ChatMessageRoleTool,
-				Content:    result,
-				ToolCallID: toolCall.ID,
-			})
-		}
-	}
-	return "Worker failed to complete task."
+func runWorkerAgent(ctx context.Context, role, systemPrompt, question string, tools []agent.Tool, client llm.Provider, tr *trace.Logger, tracer *trace.Tracer) string {
+	// Create NEW agent for worker: its own context (isolation!)
+	worker := agent.New(client, agent.Config{
+		SystemPrompt:  systemPrompt,
+		MaxIterations: 5, // Simple loop for worker (usually 1-2 steps)
+		Trace:         tr.With("agent", role),
+		Tracer:        tracer,
+	})
+	for _, t := range tools {
+		worker.RegisterTool(t)
+	}
+
+	answer, err := worker.Run(ctx, question)
+	if errors.Is(err, agent.ErrMaxIterations) {
+		return "Worker failed to complete task."
+	}
+	if err != nil {
+		return fmt.Sprintf("Worker error: %v", err)
+	}
+	return answer // Return worker's final answer
+}
+
+// Tool arguments. The schemas the model sees are derived from these
+// structs (tools.New), so they can't drift apart.
+type (
+	pingArgs struct {
+		Host string `json:"host" description:"Host to ping"`
+	}
+	sqlArgs struct {
+		Query string `json:"query" description:"SQL query to run"`
+	}
+	questionArgs struct {
+		Question string `json:"question" description:"Question for the specialist"`
+	}
+)
+
+// Tools for Workers
+func networkTools() []agent.Tool {
+	return []agent.Tool{
+		tools.New("ping", "Ping a host to check connectivity", func(_ context.Context, args pingArgs) (string, error) {
+			return ping(args.Host), nil
+		}),
+	}
+}
+
+func databaseTools() []agent.Tool {
+	return []agent.Tool{
+		tools.New("run_sql", "Run a SQL query on the database", func(_ context.Context, args sqlArgs) (string, error) {
+			return runSQL(args.Query), nil
+		}),
+	}
+}
+
+// askExpert is the function of a Supervisor tool: a worker answers the question.
+// The worker runs in the context of the call, so its spans nest inside it.
+// Its answer goes to the supervisor without what seen has already reported.
+func askExpert(role, systemPrompt string, workerTools func() []agent.Tool, client llm.Provider, tr *trace.Logger, tracer *trace.Tracer, seen *reported) func(context.Context, questionArgs) (string, error) {
+	return func(ctx context.Context, args questionArgs) (string, error) {
+		return seen.merge(runWorkerAgent(ctx, role, systemPrompt, args.Question, workerTools(), client, tr, tracer)), nil
+	}
+}
+
+// newSupervisor returns the Supervisor with tools that call specialists.
+// Events of every agent go to tr, marked with the agent's role; spans go to
+// tracer, the workers' inside the supervisor's tool calls. Worker answers
+// are deduplicated against seen.
+func newSupervisor(client llm.Provider, tr *trace.Logger, tracer *trace.Tracer, seen *reported) *agent.Agent {
+	networkExpert := prompts.Worker{
+		Tool:   "ask_network_expert",
+		Role:   "Network Specialist",
+		Topics: "connectivity, pings, and ports",
+		Use:    "Network questions",
+	}
+	databaseExpert := prompts.Worker{
+		Tool:   "ask_database_expert",
+		Role:   "Database Specialist",
+		Topics: "SQL, schemas, and database versions",
+		Use:    "Database questions",
+	}
+	supervisorPrompt := prompts.Must("supervisor", prompts.Supervisor{Workers: []prompts.Worker{networkExpert, databaseExpert}})
+
+	supervisor := agent.New(client, agent.Config{
+		SystemPrompt: supervisorPrompt,
+		// The specialists asked in one reply work at the same time: the
+		// step takes as long as the slowest of them, not their sum.
+		ParallelTools: 4,
+		Trace:         tr.With("agent", "Supervisor"),
+		Tracer:        tracer,
+	})
+
+	// Tools for Supervisor (calling specialists)
+	network := tools.New(networkExpert.Tool,
+		"Ask the network specialist about connectivity, pings, ports. Use this when you need to check if a host is reachable.",
+		askExpert(
+			"NetworkAdmin",
+			prompts.Must("specialist", networkExpert),
+			networkTools,
+			client,
+			tr,
+			tracer,
+			seen,
+		))
+	// A repeated question within 5 minutes gets the cached answer
+	// instead of a new worker run.
+	network.TTL = 5 * time.Minute
+	// At most two network workers at once, however many questions
+	// the supervisor asks in one reply.
+	network.Concurrency = 2
+	supervisor.RegisterTool(network)
+
+	database := tools.New(databaseExpert.Tool,
+		"Ask the DB specialist about SQL, schemas, data, versions. Use this when you need database information.",
+		askExpert(
+			"DBAdmin",
+			prompts.Must("specialist", databaseExpert),
+			databaseTools,
+			client,
+			tr,
+			tracer,
+			seen,
+		))
+	database.TTL = 5 * time.Minute
+	database.Concurrency = 2
+	supervisor.RegisterTool(database)
+	return supervisor
 }
 
 func main() {
+	bench := flag.Bool("bench", false, "compare a single generalist agent with the supervisor/worker team on the same task")
+	seeds := flag.Int("seeds", 5, "runs per topology in -bench, one seed each")
+	temperature := flag.Float64("temperature", 0.7, "sampling temperature of every request in -bench")
+	flag.Parse()
+	if *seeds < 1 {
+		fmt.Fprintln(os.Stderr, "-seeds must be at least 1")
+		os.Exit(2)
+	}
+
 	// 1. Client setup (Local-First)
-	token := os.Getenv("OPENAI_API_KEY")
-	baseURL := os.Getenv("OPENAI_BASE_URL")
-	if token == "" {
-		token = "dummy"
-	}
-
-	config := openai.DefaultConfig(token)
-	if baseURL != "" {
-		config.BaseURL = baseURL
-	}
-	client := openai.NewClientWithConfig(config)
-
-	ctx := context.Background()
-
-	// 2. Tools for Workers
-	netTools := []openai.Tool{
-		{
-			Type: openai.ToolTypeFunction,
-			Function: &openai.FunctionDefinition{
-				Name:        "ping",
-				Description: "Ping a host to check connectivity",
-				Parameters: json.RawMessage(`{
-					"type": "object",
-					"properties": {
-						"host": {"type": "string"}
-					},
-					"required": ["host"]
-				}`),
-			},
-		},
-	}
-
-	dbTools := []openai.Tool{
-		{
-			Type: openai.ToolTypeFunction,
-			Function: &openai.FunctionDefinition{
-				Name:        "run_sql",
-				Description: "Run a SQL query on the database",
-				Parameters: json.RawMessage(`{
-					"type": "object",
-					"properties": {
-						"query": {"type": "string"}
-					},
-					"required": ["query"]
-				}`),
-			},
-		},
-	}
-
-	// 3. Tools for Supervisor (calling specialists)
-	supervisorTools := []openai.Tool{
-		{
-			Type: openai.ToolTypeFunction,
-			Function: &openai.FunctionDefinition{
-				Name:        "ask_network_expert",
-				Description: "Ask the network specialist about connectivity, pings, ports. Use this when you need to check if a host is reachable.",
-				Parameters: json.RawMessage(`{
-					"type": "object",
-					"properties": {
-						"question": {"type": "string"}
-					},
-					"required": ["question"]
-				}`),
-			},
-		},
-		{
-			Type: openai.ToolTypeFunction,
-			Function: &openai.FunctionDefinition{
-				Name:        "ask_database_expert",
-				Description: "Ask the DB specialist about SQL, schemas, data, versions. Use this when you need database information.",
-				Parameters: json.RawMessage(`{
-					"type": "object",
-					"properties": {
-						"question": {"type": "string"}
-					},
-					"required": ["question"]
-				}`),
-			},
-		},
-	}
-
-	supervisorPrompt := `You are a Supervisor agent. You coordinate specialized workers.
-When you receive a task, delegate it to the appropriate specialist:
-- Network questions → ask_network_expert
-- Database questions → ask_database_expert
-Collect results and provide a final answer to the user.`
-
-	messages := []openai.ChatCompletionMessage{
-		{Role: openai.ChatMessageRoleSystem, Content: supervisorPrompt},
-		{Role: openai.ChatMessageRoleUser, Content: "Check if DB server db-host.example.com is reachable, and if yes — find out PostgreSQL version"},
+	// LLM_PROVIDER picks the backend: openai (any OpenAI-compatible server), llamacpp, ollama, anthropic.
+	client, err := llm.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	// Every call of the run, supervisor's and workers' alike, is counted.
+	defer usage.Default.Print(os.Stdout)
+
+	// Ctrl+C stops the run after the current step and prints what was done.
+	ctx, stop := agent.Interruptible(context.Background())
+	defer stop()
+
+	if *bench {
+		benchmark(ctx, client, *seeds, float32(*temperature))
+		return
+	}
+
+	// 2. Supervisor and its specialists. Every step of every agent is logged
+	// as a structured event: text on stdout by default, JSON lines with
+	// AGENT_TRACE=json or AGENT_TRACE=<file> (see pkg/trace).
+	tr, err := trace.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
+	defer tr.Close()
+	// With OTEL_EXPORTER_OTLP_ENDPOINT set, the run is also exported as
+	// OpenTelemetry spans: run → iterations → LLM and tool calls.
+	// Repeated facts in worker answers are dropped before the supervisor
+	// reads them; the savings are printed at exit.
+	seen := &reported{}
+	defer seen.Print(os.Stdout)
+	supervisor := newSupervisor(client, tr, trace.TracerFromEnv("lab08-multi-agent"), seen)
 
 	fmt.Println("Starting Multi-Agent System...")
 
-	// 4. Supervisor loop
-	for i := 0; i < 10; i++ {
-		req := openai.ChatCompletionRequest{
-			Model:    "gpt-4o-mini",
-			Messages: messages,
-			Tools:   supervisorTools,
-		}
-
-		resp, err := client.CreateChatCompletion(ctx, req)
-		if err != nil {
-			panic(fmt.Sprintf("API Error: %v", err))
-		}
-
-		msg := resp.Choices[0].Message
-		messages = append(messages, msg)
-
-		// 5. Analyze response
-		if len(msg.ToolCalls) == 0 {
-			fmt.Println("Supervisor:", msg.Content)
-			break
-		}
-
-		// 6. Execute Supervisor tools (delegate to Workers)
-		for _, toolCall := range msg.ToolCalls {
-			fmt.Printf("Supervisor delegating to: %s\n", toolCall.Function.Name)
-
-			var workerResponse string
-			var args struct {
-				Question string `json:"question"`
-			}
-			json.Unmarshal([]byte(toolCall.Function.Arguments), &args)
-
-			if toolCall.Function.Name == "ask_network_expert" {
-				workerResponse = runWorkerAgent(
-					"NetworkAdmin",
-					"You are a Network Specialist. You know about connectivity, pings, and ports.",
-					args.Question,
-					netTools,
-					client,
-				)
-			} else if toolCall.Function.Name == "ask_database_expert" {
-				workerResponse = runWorkerAgent(
-					"DBAdmin",
-					"You are a Database Specialist. You know about SQL, schemas, and database versions.",
-					args.Question,
-					dbTools,
-					client,
-				)
-			}
-
-			fmt.Printf("Worker response: %s\n", workerResponse)
-
-			// Return worker's response to Supervisor
-			messages = append(messages, openai.ChatCompletionMessage{
-				Role:       openai.ChatMessageRoleTool,
-				Content:    workerResponse,
-				ToolCallID: toolCall.ID,
-			})
-		}
+	// 3. Supervisor loop (pkg/agent)
+	answer, err := supervisor.Run(ctx, task)
+	if errors.Is(err, context.Canceled) {
+		fmt.Printf("\n⏹  Interrupted. So far:\n%s", supervisor.Recap())
+		return
+	}
+	if err != nil {
+		panic(fmt.Sprintf("Agent Error: %v", err))
 	}
+	fmt.Println("Supervisor:", answer)
 }
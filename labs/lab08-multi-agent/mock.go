@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/kshvakov/agent/pkg/mockllm"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Offline run: OPENAI_BASE_URL=mock go run . [-bench]
+// Supervisor and workers share one scripted model; each turn is matched by
+// the tools the request offers. The generalist offers both worker tools,
+// so worker turns require the other one to be absent. -bench replays the
+// script once per run; with more than 10 seeds the extra runs get the
+// fallback reply and fail.
+func init() {
+	supervisor := mockllm.Offers("ask_network_expert")
+	generalist := mockllm.All(mockllm.Offers("ping"), mockllm.Offers("run_sql"))
+	network := only("ping", "run_sql")
+	database := only("run_sql", "ping")
+	for range 10 {
+		mockllm.Register(
+			mockllm.Call("ask_network_expert", map[string]any{"question": "Is db-host.example.com reachable?"}).If(supervisor),
+			mockllm.Call("ping", map[string]any{"host": "db-host.example.com"}).If(network),
+			mockllm.Say("db-host.example.com is reachable. Latency is 5ms.").If(network),
+			mockllm.Call("ask_database_expert", map[string]any{"question": "What PostgreSQL version is running?"}).If(supervisor),
+			mockllm.Call("run_sql", map[string]any{"query": "SELECT version()"}).If(database),
+			// The DB worker repeats the network fact: the dedup pass drops it.
+			mockllm.Say("db-host.example.com is reachable. The server runs PostgreSQL 15.2.").If(database),
+			mockllm.Say("db-host.example.com is reachable (5ms), and it runs PostgreSQL 15.2.").If(supervisor),
+
+			mockllm.Call("ping", map[string]any{"host": "db-host.example.com"}).If(generalist),
+			mockllm.Call("run_sql", map[string]any{"query": "SELECT version()"}).If(generalist),
+			mockllm.Say("db-host.example.com is reachable (5ms) and runs PostgreSQL 15.2.").If(generalist),
+		)
+	}
+}
+
+// only matches requests that offer tool but not other.
+func only(tool, other string) func(openai.ChatCompletionRequest) bool {
+	return func(req openai.ChatCompletionRequest) bool {
+		return mockllm.Offers(tool)(req) && !mockllm.Offers(other)(req)
+	}
+}
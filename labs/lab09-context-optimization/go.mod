@@ -2,4 +2,10 @@ module lab09-context-optimization
 
 go 1.25.5
 
-require github.com/sashabaranov/go-openai v1.41.2 // indirect
+require (
+	github.com/kshvakov/agent v0.0.0
+	github.com/sashabaranov/go-openai v1.41.2
+)
+
+// The shared packages (pkg/schema, pkg/tools) come from this repository.
+replace github.com/kshvakov/agent => ../..
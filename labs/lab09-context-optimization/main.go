@@ -3,10 +3,17 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"strings"
 
+	"github.com/kshvakov/agent/pkg/agent"
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/llm/usage"
+	"github.com/kshvakov/agent/pkg/schema"
+	"github.com/kshvakov/agent/pkg/tools"
 	"github.com/sashabaranov/go-openai"
 )
 
@@ -39,17 +46,17 @@ type Run struct {
 	contextMax   int  // model window; take it from configuration, do not hardcode
 	condenseDone bool // limit: one condense per Run
 
-	client *openai.Client
+	client llm.Provider
 	model  string
-	tools  []openai.Tool
+	tools  *tools.Registry
 }
 
-func NewRun(client *openai.Client, model string, contextMax int, systemPrompt string, tools []openai.Tool) *Run {
+func NewRun(client llm.Provider, model string, contextMax int, systemPrompt string, reg *tools.Registry) *Run {
 	return &Run{
 		client:     client,
 		model:      model,
 		contextMax: contextMax,
-		tools:      tools,
+		tools:      reg,
 		messages: []openai.ChatCompletionMessage{
 			{Role: openai.ChatMessageRoleSystem, Content: systemPrompt},
 		},
@@ -85,7 +92,10 @@ func (r *Run) Step(ctx context.Context, userInput string) (string, error) {
 		}
 
 		for _, tc := range msg.ToolCalls {
-			result := r.dispatchTool(ctx, tc)
+			result, err := r.tools.Dispatch(ctx, tc)
+			if err != nil {
+				result = fmt.Sprintf("error: %v", err)
+			}
 			r.messages = append(r.messages, openai.ChatCompletionMessage{
 				Role:       openai.ChatMessageRoleTool,
 				ToolCallID: tc.ID,
@@ -97,10 +107,10 @@ func (r *Run) Step(ctx context.Context, userInput string) (string, error) {
 }
 
 func (r *Run) callLLM(ctx context.Context) (openai.ChatCompletionResponse, error) {
-	return r.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+	return r.client.ChatCompletion(ctx, openai.ChatCompletionRequest{
 		Model:       r.model,
 		Messages:    r.messages,
-		Tools:       r.tools,
+		Tools:       r.tools.Definitions(),
 		Temperature: 0,
 	})
 }
@@ -152,24 +162,22 @@ func (r *Run) condense(ctx context.Context) error {
 
 // summarize calls the LLM to get a short summary of a chunk of history.
 func (r *Run) summarize(ctx context.Context, head []openai.ChatCompletionMessage) (string, error) {
-	// TODO 5: assemble input as linear text ("role: content\n"),
-	// call r.client with the system prompt from MANUAL.md (section "Step 4: condense"),
+	// TODO 5: assemble input as linear text ("role: content\n"), mask
+	// secrets in it with redact.Text (pkg/redact), call r.client with the system prompt from MANUAL.md (section "Step 4: condense"),
 	// and return Choices[0].Message.Content.
 	return "", fmt.Errorf("summarize not implemented")
 }
 
-// dispatchTool — a simple fake tool so the demo can exercise tool calls
+// fakeLookup — a simple fake tool so the demo can exercise tool calls
 // and verify pair-protection during condense.
-func (r *Run) dispatchTool(ctx context.Context, tc openai.ToolCall) string {
-	switch tc.Function.Name {
-	case "fake_lookup":
-		var args struct {
-			Query string `json:"query"`
-		}
-		_ = json.Unmarshal([]byte(tc.Function.Arguments), &args)
-		return fmt.Sprintf("result for %q: ok", args.Query)
+func fakeLookup(_ context.Context, raw json.RawMessage) (string, error) {
+	var args struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return "", err
 	}
-	return "unknown tool: " + tc.Function.Name
+	return fmt.Sprintf("result for %q: ok", args.Query), nil
 }
 
 // isContextOverflow returns true if the error looks like a context-window overflow.
@@ -185,42 +193,45 @@ func isContextOverflow(err error) bool {
 		strings.Contains(msg, "context window")
 }
 
-func jsonSchema(s string) json.RawMessage { return json.RawMessage(s) }
-
 func main() {
-	token := os.Getenv("OPENAI_API_KEY")
-	baseURL := os.Getenv("OPENAI_BASE_URL")
-	if token == "" {
-		token = "dummy"
-	}
-
-	cfg := openai.DefaultConfig(token)
-	if baseURL != "" {
-		cfg.BaseURL = baseURL
-	}
-	client := openai.NewClientWithConfig(cfg)
-
-	tools := []openai.Tool{
-		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
-			Name:        "fake_lookup",
-			Description: "Fake lookup tool used to exercise tool_call/tool_result pairs in the history.",
-			Parameters: jsonSchema(`{
-				"type":"object",
-				"properties":{"query":{"type":"string"}},
-				"required":["query"]
-			}`),
-		}},
+	// The default is low on purpose, to trigger a proactive condense
+	// quickly. For a real model, take the window Lab 00's context probe
+	// found: a guess too high overflows, a guess too low condenses early.
+	contextMax := flag.Int("context-max", 4_000, "model context window in tokens (Lab 00 measures it)")
+	tiered := flag.Bool("tiers", false, "keep the history in three tiers (recent turns, mid paragraphs, an ancient summary) instead of one condense; see tiers.go")
+	flag.Parse()
+
+	// LLM_PROVIDER picks the backend: openai (any OpenAI-compatible server), llamacpp, ollama, anthropic.
+	client, err := llm.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
+	// At exit: tokens per model, and which parts of the context took them.
+	defer usage.Default.Print(os.Stdout)
+
+	reg := tools.NewRegistry(tools.Tool{
+		Name:        "fake_lookup",
+		Description: "Fake lookup tool used to exercise tool_call/tool_result pairs in the history.",
+		Params: schema.Object().
+			Prop("query", schema.String("")).
+			Require("query"),
+		Execute: fakeLookup,
+	})
 
 	systemPrompt := "You are an assistant. Answer briefly and to the point. If a lookup is needed — call fake_lookup."
 
-	// contextMax is intentionally lowered to trigger a proactive condense quickly.
-	// In production this value comes from model metadata or configuration.
-	const contextMax = 4_000
-
-	run := NewRun(client, "gpt-4o-mini", contextMax, systemPrompt, tools)
+	run := NewRun(client, "gpt-4o-mini", *contextMax, systemPrompt, reg)
+	step := run.Step
+	var tiers *tieredRun
+	if *tiered {
+		tiers = newTieredRun(run)
+		step = tiers.Step
+	}
 
-	ctx := context.Background()
+	// Ctrl+C stops the run after the current step and prints what was done.
+	ctx, stop := agent.Interruptible(context.Background())
+	defer stop()
 
 	// A long dialogue with deliberately "fat" turns to push past the 80% threshold.
 	steps := []string{
@@ -235,12 +246,19 @@ func main() {
 
 	for i, input := range steps {
 		fmt.Printf("\n--- Step %d ---\nUser: %s\n", i+1, input)
-		answer, err := run.Step(ctx, input)
+		answer, err := step(ctx, input)
+		if errors.Is(err, context.Canceled) {
+			fmt.Printf("\n⏹  Interrupted. So far:\n%s", agent.Recap(run.messages))
+			return
+		}
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "step error: %v\n", err)
 			os.Exit(1)
 		}
 		fmt.Printf("Assistant: %s\n", answer)
+		if tiers != nil {
+			tiers.report()
+		}
 		if run.condenseDone {
 			fmt.Println("  (condense already done in this Run)")
 		}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/kshvakov/agent/pkg/mockllm"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Offline run: OPENAI_BASE_URL=mock go run .
+// Answers are padded on purpose: the history has to cross the 80% threshold
+// for condense to be exercised. The last turn answers the memory check only
+// if the name and the stack are still somewhere in the history.
+func init() {
+	summarizer := func(req openai.ChatCompletionRequest) bool { return !mockllm.HasTools(req) }
+	long := func(topic string) string {
+		return strings.Repeat("Step: "+topic+" — check prerequisites, apply, verify, document. ", 40)
+	}
+	// -tiers: the promotions answer with the start of what they compress,
+	// which keeps the first turn (the name, the stack) in every tier.
+	for _, prompt := range []string{midPrompt, ancientPrompt} {
+		promotion := func(req openai.ChatCompletionRequest) bool {
+			return len(req.Messages) > 0 && req.Messages[0].Content == prompt
+		}
+		for range 10 {
+			mockllm.Register(mockllm.Turn{Reply: func(req openai.ChatCompletionRequest) mockllm.Turn {
+				text := strings.Join(strings.Fields(mockllm.LastUser(req)), " ")
+				return mockllm.Say(text[:min(len(text), 240)])
+			}}.If(promotion))
+		}
+	}
+	mockllm.Register(
+		// condense: the summarization call is the only one without tools
+		mockllm.Say("User: Ivan, DevOps engineer at TechCorp. Stack: Ubuntu 22.04, Docker, Kubernetes, PostgreSQL, Redis, Nginx, Vault, Prometheus. Discussed: k8s PoC, PG 14→16 migration, alerts, Vault Injector.").If(summarizer),
+		mockllm.Say("Hi Ivan! Noted your stack.").If(mockllm.Mentions("my name is")),
+		mockllm.Call("fake_lookup", map[string]any{"query": "kubernetes single-node ubuntu"}).If(mockllm.Mentions("kubernetes on bare")),
+		mockllm.Say(long("kubeadm single-node")).If(mockllm.Mentions("kubernetes on bare")),
+		mockllm.Say(long("pg_upgrade via logical replication")).If(mockllm.Mentions("postgresql 14")),
+		mockllm.Say(long("replication lag, connections, bloat")).If(mockllm.Mentions("prometheus metrics")),
+		mockllm.Say(long("Vault Agent Injector annotations")).If(mockllm.Mentions("vault")),
+		mockllm.Say(long("Bacula for tape, Restic for object storage")).If(mockllm.Mentions("bacula")),
+		mockllm.Turn{Reply: func(req openai.ChatCompletionRequest) mockllm.Turn {
+			for _, m := range req.Messages {
+				if strings.Contains(m.Content, "Ivan") {
+					return mockllm.Say("You're Ivan, a DevOps engineer at TechCorp; the stack is Ubuntu, Docker, Kubernetes, PostgreSQL and friends.")
+				}
+			}
+			return mockllm.Say("I don't know: that part of the conversation was lost.")
+		}}.If(mockllm.Mentions("what's my name")),
+	)
+}
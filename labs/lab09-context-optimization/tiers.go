@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kshvakov/agent/pkg/redact"
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Optional part: three context tiers (-tiers) ---
+//
+// One condense per Run is enough for one task. A conversation that goes
+// on for hours needs more, and the older a part of it is, the less of its
+// detail is worth the tokens. The tiered layout keeps
+//
+//	recent   the last recentTurns turns, verbatim
+//	mid      one paragraph per older turn, at most midParagraphs of them
+//	ancient  one paragraph for everything before that
+//
+// and promotes as the conversation grows. After every step the oldest
+// recent turn becomes a paragraph, and the oldest paragraph beyond
+// midParagraphs folds into the ancient one. Every tier covers more
+// history per token than the one before it, so the context stays about
+// the same size however long the conversation is.
+//
+// The request is the same shape as after condense: system, one user
+// message with the ancient and mid tiers, then the recent turns. A turn is
+// promoted whole (the user message up to the answer), so tool pairs are
+// never split.
+
+const (
+	recentTurns   = 2 // Turns kept verbatim
+	midParagraphs = 3 // Paragraphs kept before the oldest folds into ancient
+)
+
+// Prompts of the two promotions.
+const (
+	midPrompt = `Summarize this turn of a conversation between a user and an assistant in one paragraph of at most 3 sentences.
+Keep names, facts about the user and their systems, decisions and open questions. Drop the details of the answer.`
+	ancientPrompt = `Merge the summary of the earliest conversation with the paragraph that follows it into one paragraph of at most 5 sentences.
+Keep names, facts about the user and their systems, and decisions. Drop everything else.`
+)
+
+// tieredRun runs a Run with its history in three tiers.
+type tieredRun struct {
+	*Run
+	system  openai.ChatCompletionMessage
+	ancient string
+	mid     []string
+	recent  [][]openai.ChatCompletionMessage // Turns, oldest first
+}
+
+func newTieredRun(r *Run) *tieredRun {
+	return &tieredRun{Run: r, system: r.messages[0]}
+}
+
+// Step runs one turn on the tiered history and promotes the tiers.
+func (t *tieredRun) Step(ctx context.Context, userInput string) (string, error) {
+	t.messages = t.layout()
+	answer, err := t.Run.Step(ctx, userInput)
+	if err != nil {
+		return answer, err
+	}
+	// The turn is everything from its user message on, wherever Run
+	// has left it.
+	start := len(t.messages) - 1
+	for start > 0 && (t.messages[start].Role != openai.ChatMessageRoleUser || t.messages[start].Content != userInput) {
+		start--
+	}
+	t.recent = append(t.recent, slices.Clone(t.messages[start:]))
+	return answer, t.promote(ctx)
+}
+
+// layout returns the messages of the next request.
+func (t *tieredRun) layout() []openai.ChatCompletionMessage {
+	msgs := []openai.ChatCompletionMessage{t.system}
+	var b strings.Builder
+	if t.ancient != "" {
+		b.WriteString("Earlier: " + t.ancient + "\n\n")
+	}
+	for _, p := range t.mid {
+		b.WriteString(p + "\n\n")
+	}
+	if b.Len() > 0 {
+		msgs = append(msgs, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleUser,
+			Content: "Context of previous work:\n\n" + strings.TrimSpace(b.String()),
+		})
+	}
+	for _, turn := range t.recent {
+		msgs = append(msgs, turn...)
+	}
+	return msgs
+}
+
+// promote moves the oldest turns and paragraphs one tier down.
+func (t *tieredRun) promote(ctx context.Context) error {
+	for len(t.recent) > recentTurns {
+		p, err := t.compress(ctx, midPrompt, transcript(t.recent[0]))
+		if err != nil {
+			return fmt.Errorf("promote to mid: %w", err)
+		}
+		t.mid = append(t.mid, p)
+		t.recent = t.recent[1:]
+		fmt.Println("  tiers: oldest turn → mid paragraph")
+	}
+	for len(t.mid) > midParagraphs {
+		input := t.mid[0]
+		if t.ancient != "" {
+			input = "Summary of the earliest conversation: " + t.ancient + "\n\nThen: " + t.mid[0]
+		}
+		a, err := t.compress(ctx, ancientPrompt, input)
+		if err != nil {
+			return fmt.Errorf("promote to ancient: %w", err)
+		}
+		t.ancient = a
+		t.mid = t.mid[1:]
+		fmt.Println("  tiers: oldest paragraph → ancient")
+	}
+	return nil
+}
+
+// compress asks the model for one paragraph. Secrets are masked first: a
+// summary outlives the messages it replaces.
+func (t *tieredRun) compress(ctx context.Context, prompt, text string) (string, error) {
+	text, _ = redact.Text(text)
+	resp, err := t.client.ChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: t.model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: prompt},
+			{Role: openai.ChatMessageRoleUser, Content: text},
+		},
+		Temperature: 0,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("empty response")
+	}
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
+
+// transcript renders a turn as text for the summarizer.
+func transcript(msgs []openai.ChatCompletionMessage) string {
+	var b strings.Builder
+	for _, m := range msgs {
+		if m.Content != "" {
+			fmt.Fprintf(&b, "%s: %s\n", m.Role, m.Content)
+		}
+		for _, tc := range m.ToolCalls {
+			fmt.Fprintf(&b, "%s: calls %s(%s)\n", m.Role, tc.Function.Name, tc.Function.Arguments)
+		}
+	}
+	return b.String()
+}
+
+// report prints the estimated tokens of every tier next to the actual
+// prompt tokens of the last request. Per tier there is no provider count,
+// so the tiers are estimated; the total is the provider's.
+func (t *tieredRun) report() {
+	recent := 0
+	for _, turn := range t.recent {
+		for _, m := range turn {
+			recent += estimateTokens(m.Content)
+			for _, tc := range m.ToolCalls {
+				recent += estimateTokens(tc.Function.Name) + estimateTokens(tc.Function.Arguments)
+			}
+		}
+	}
+	mid := 0
+	for _, p := range t.mid {
+		mid += estimateTokens(p)
+	}
+	fmt.Printf("  tiers: recent %d turns ~%d tok | mid %d paragraphs ~%d tok | ancient ~%d tok | prompt (actual) %d\n",
+		len(t.recent), recent, len(t.mid), mid, estimateTokens(t.ancient), t.lastTokens)
+}
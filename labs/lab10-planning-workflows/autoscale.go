@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/simclock"
+)
+
+// --- Autoscaling scenario ---
+//
+// A worker service drains a queue. Load grows faster than the current replicas
+// can handle, so the queue keeps growing. The plan must scale up gradually
+// (a big jump is rejected by the capacity guard), verifying between
+// increments that the queue actually drains. New replicas need a warm-up
+// minute, so a verification right after scale-up fails and gets retried.
+
+// scalingService is a simulated service with queue depth and replica count.
+type scalingService struct {
+	// mu serializes the actions: the plan's Resources are whatever the
+	// model declared, so steps of one batch may reach the service together.
+	mu    sync.Mutex
+	clock *simclock.Sim
+
+	QueueDepth int
+	Replicas   int // Ready replicas
+	Warming    int // Replicas that are starting up
+
+	MaxReplicas int // Hard capacity limit
+	MaxStep     int // Max replicas added or removed in one action
+	ArrivalRate int // Messages per minute
+	PerReplica  int // Messages drained by one replica per minute
+
+	lastDepth int // Queue depth at the previous verification
+}
+
+func newScalingService(clock *simclock.Sim) *scalingService {
+	s := &scalingService{
+		clock:       clock,
+		QueueDepth:  5000,
+		Replicas:    2,
+		MaxReplicas: 10,
+		MaxStep:     2,
+		ArrivalRate: 700,
+		PerReplica:  200,
+	}
+	s.lastDepth = s.QueueDepth
+	clock.Every(time.Minute, s.tick)
+	return s
+}
+
+// tick applies one minute of load and processing.
+func (s *scalingService) tick() {
+	s.QueueDepth += s.ArrivalRate - s.Replicas*s.PerReplica
+	if s.QueueDepth < 0 {
+		s.QueueDepth = 0
+	}
+}
+
+func (s *scalingService) status() string {
+	return fmt.Sprintf("[%s] queue_depth=%d replicas=%d warming=%d",
+		s.clock.Now().Format("15:04:05"), s.QueueDepth, s.Replicas, s.Warming)
+}
+
+func (s *scalingService) scaleUp(n int) (string, error) {
+	if n <= 0 || n > s.MaxStep {
+		return "", fmt.Errorf("scale_up: count must be 1..%d, got %d (scale gradually)", s.MaxStep, n)
+	}
+	if s.Replicas+s.Warming+n > s.MaxReplicas {
+		return "", fmt.Errorf("scale_up: would exceed max replicas %d", s.MaxReplicas)
+	}
+	s.Warming += n
+	s.clock.After(time.Minute, func() {
+		s.Warming -= n
+		s.Replicas += n
+	})
+	return fmt.Sprintf("scaling up by %d, replicas will be ready in 1m. %s", n, s.status()), nil
+}
+
+func (s *scalingService) scaleDown(n int) (string, error) {
+	if n <= 0 || n > s.MaxStep {
+		return "", fmt.Errorf("scale_down: count must be 1..%d, got %d", s.MaxStep, n)
+	}
+	if s.Replicas-n < 1 {
+		return "", fmt.Errorf("scale_down: at least 1 replica must remain")
+	}
+	s.Replicas -= n
+	return fmt.Sprintf("scaled down by %d. %s", n, s.status()), nil
+}
+
+// verifyDraining waits a minute and checks that the queue shrank.
+// An error means "not yet" — the executor retries the step.
+func (s *scalingService) verifyDraining() (string, error) {
+	s.clock.Advance(time.Minute)
+	prev := s.lastDepth
+	s.lastDepth = s.QueueDepth
+	if s.QueueDepth >= prev && s.QueueDepth > 0 {
+		return "", fmt.Errorf("queue is not draining: %d -> %d. %s", prev, s.QueueDepth, s.status())
+	}
+	return fmt.Sprintf("queue draining: %d -> %d. %s", prev, s.QueueDepth, s.status()), nil
+}
+
+// ScalingExecutor executes plan steps against the simulated service.
+// Steps name their action in Step.Tool; arguments go to Step.Args.
+type ScalingExecutor struct {
+	svc *scalingService
+}
+
+func (e *ScalingExecutor) Execute(step *Step) (string, error) {
+	fmt.Printf("Executing step %s: %s\n", step.ID, step.Description)
+	e.svc.mu.Lock()
+	defer e.svc.mu.Unlock()
+	// Every action takes a little simulated time.
+	defer e.svc.clock.Advance(10 * time.Second)
+
+	switch step.Tool {
+	case "check_queue":
+		return e.svc.status(), nil
+	case "scale_up":
+		return e.svc.scaleUp(intArg(step.Args, "count", 1))
+	case "scale_down":
+		return e.svc.scaleDown(intArg(step.Args, "count", 1))
+	case "verify_draining":
+		return e.svc.verifyDraining()
+	default:
+		return "", fmt.Errorf("unknown tool %q in step %s", step.Tool, step.ID)
+	}
+}
+
+// scalingTools are the step tools of the scenario, checked while the plan
+// streams (see stream.go).
+var scalingTools = []string{"check_queue", "scale_up", "scale_down", "verify_draining"}
+
+// scalingToolsPrompt describes the scenario tools for createPlan.
+const scalingToolsPrompt = `Available step tools (set "tool" and "args" on each step):
+- check_queue {} — current queue depth and replicas
+- scale_up {"count": 1..2} — add replicas (ready after 1 minute)
+- scale_down {"count": 1..2} — remove replicas
+- verify_draining {} — wait 1 minute and check the queue shrinks (fails if not)
+Max 10 replicas. Scale gradually and verify after each increment.
+Every step touches "deployment/orders-worker" (set it in "resources").
+Steps may declare checks: "pre"/"post": [{"tool": "check_queue", "expect": "warming=0"}]
+(expect is a regexp the tool result must match).`
+
+// workerDeployment is the resource every scaling step touches: two scaling
+// actions at once make each one's verification meaningless.
+const workerDeployment = "deployment/orders-worker"
+
+// autoscalePlan is the reference plan for the scenario: gradual scale-up with
+// a verification between increments.
+func autoscalePlan() *Plan {
+	return &Plan{
+		ID:   "autoscale-orders-worker",
+		Task: "Drain the orders-worker queue by scaling up gradually",
+		Steps: []*Step{
+			{ID: "check", Description: "Check queue depth and replicas", Tool: "check_queue", Resources: []string{workerDeployment}, Status: "pending"},
+			{ID: "scale-1", Description: "Scale up by 2 replicas", Tool: "scale_up", Args: map[string]any{"count": 2}, Dependencies: []string{"check"}, Resources: []string{workerDeployment}, Status: "pending"},
+			{ID: "verify-1", Description: "Verify the queue is draining", Tool: "verify_draining", Dependencies: []string{"scale-1"}, Resources: []string{workerDeployment}, Status: "pending"},
+			{ID: "scale-2", Description: "Scale up by 2 more replicas", Tool: "scale_up", Args: map[string]any{"count": 2}, Dependencies: []string{"verify-1"}, Resources: []string{workerDeployment}, Status: "pending",
+				// Don't stack scale-ups: previous replicas must be ready.
+				Pre: []Condition{{Tool: "check_queue", Expect: `warming=0\b`}}},
+			{ID: "verify-2", Description: "Verify the queue drains faster", Tool: "verify_draining", Dependencies: []string{"scale-2"}, Resources: []string{workerDeployment}, Status: "pending"},
+			{ID: "final", Description: "Report final queue depth", Tool: "check_queue", Dependencies: []string{"verify-2"}, Resources: []string{workerDeployment}, Status: "pending",
+				Post: []Condition{{Tool: "check_queue", Expect: `replicas=6\b`}}},
+		},
+	}
+}
+
+// intArg reads an integer argument; JSON numbers arrive as float64.
+func intArg(args map[string]any, key string, def int) int {
+	switch v := args[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return def
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// --- Preconditions and postconditions ---
+//
+// "Verify the fix" written in a prompt is a wish; written in the plan it is
+// enforced. A step may declare checks: a tool call and a regexp its result
+// must match. Preconditions run before the step, postconditions after it.
+// A failed check fails the step, so the usual retries apply.
+
+// Condition is a tool call with the expected result.
+type Condition struct {
+	Tool   string         `json:"tool"`
+	Args   map[string]any `json:"args,omitempty"`
+	Expect string         `json:"expect"` // Regexp the tool result must match
+}
+
+// conditionExecutor verifies Step.Pre and Step.Post around the inner executor.
+// Checks are run by the inner executor too, as steps of their own.
+type conditionExecutor struct {
+	inner StepExecutor
+}
+
+func (e *conditionExecutor) Execute(step *Step) (string, error) {
+	for i, c := range step.Pre {
+		if err := e.check(step, "pre", i, c); err != nil {
+			return "", err
+		}
+	}
+	result, err := e.inner.Execute(step)
+	if err != nil {
+		return result, err
+	}
+	for i, c := range step.Post {
+		if err := e.check(step, "post", i, c); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+func (e *conditionExecutor) check(step *Step, kind string, i int, c Condition) error {
+	re, err := regexp.Compile(c.Expect)
+	if err != nil {
+		return fmt.Errorf("%scondition %d of step %s: bad pattern: %w", kind, i+1, step.ID, err)
+	}
+	check := &Step{
+		ID:          fmt.Sprintf("%s/%s-%d", step.ID, kind, i+1),
+		Description: fmt.Sprintf("%scondition: %s expects /%s/", kind, c.Tool, c.Expect),
+		Tool:        c.Tool,
+		Args:        c.Args,
+		Resources:   step.Resources,
+	}
+	out, err := e.inner.Execute(check)
+	if err != nil {
+		return fmt.Errorf("%scondition %d of step %s: %w", kind, i+1, step.ID, err)
+	}
+	if !re.MatchString(out) {
+		return fmt.Errorf("%scondition %d of step %s failed: %s result %q doesn't match /%s/", kind, i+1, step.ID, c.Tool, out, c.Expect)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// --- Resource conflicts ---
+//
+// The dependency graph says which steps *may* run in parallel. It doesn't know
+// that "restart api" and "migrate api database" both touch the api deployment.
+// Steps declare the resources they touch in Step.Resources; two ready steps
+// sharing a resource never run at the same time.
+
+// Conflict is a pair of steps that share a resource but are not ordered by
+// dependencies, so the scheduler has to serialize them.
+type Conflict struct {
+	A, B     string
+	Resource string
+}
+
+// resourceConflicts lists unordered step pairs that share a resource.
+// It is a report for humans: the scheduler serializes them anyway.
+func resourceConflicts(plan *Plan) []Conflict {
+	byID := make(map[string]*Step, len(plan.Steps))
+	for _, s := range plan.Steps {
+		byID[s.ID] = s
+	}
+	// dependsOn reports whether a (transitively) depends on b.
+	var dependsOn func(a *Step, b string, seen map[string]bool) bool
+	dependsOn = func(a *Step, b string, seen map[string]bool) bool {
+		for _, dep := range a.Dependencies {
+			if dep == b {
+				return true
+			}
+			if seen[dep] {
+				continue
+			}
+			seen[dep] = true
+			if d, ok := byID[dep]; ok && dependsOn(d, b, seen) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var conflicts []Conflict
+	for i, a := range plan.Steps {
+		for _, b := range plan.Steps[i+1:] {
+			res, ok := sharedResource(a, b)
+			if !ok {
+				continue
+			}
+			if dependsOn(a, b.ID, map[string]bool{}) || dependsOn(b, a.ID, map[string]bool{}) {
+				continue
+			}
+			conflicts = append(conflicts, Conflict{A: a.ID, B: b.ID, Resource: res})
+		}
+	}
+	return conflicts
+}
+
+func sharedResource(a, b *Step) (string, bool) {
+	for _, ra := range a.Resources {
+		for _, rb := range b.Resources {
+			if ra == rb {
+				return ra, true
+			}
+		}
+	}
+	return "", false
+}
+
+// nextBatch picks ready steps that can run together: in plan order, a step is
+// taken unless it shares a resource with a step already in the batch.
+// The rest stay pending and are picked up on the next round.
+func nextBatch(ready []*Step) []*Step {
+	locked := map[string]bool{}
+	var batch []*Step
+	for _, s := range ready {
+		free := true
+		for _, r := range s.Resources {
+			if locked[r] {
+				free = false
+				break
+			}
+		}
+		if !free {
+			continue
+		}
+		for _, r := range s.Resources {
+			locked[r] = true
+		}
+		batch = append(batch, s)
+	}
+	return batch
+}
+
+// runBatch executes a conflict-free batch in parallel and returns the first
+// error, with the step it came from. fn runs one step (with its retries)
+// and updates its status.
+func runBatch(batch []*Step, fn func(*Step) error) error {
+	if len(batch) == 1 {
+		if err := fn(batch[0]); err != nil {
+			return fmt.Errorf("step %s: %w", batch[0].ID, err)
+		}
+		return nil
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, len(batch))
+	for i, s := range batch {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = fn(s)
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("step %s: %w", batch[i].ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// runRounds runs steps the way executePlanWithRetries does: a batch of the
+// pending steps per round, until none is left. It returns the most steps
+// that ran at once.
+func runRounds(t *testing.T, steps []*Step) int {
+	t.Helper()
+	var mu sync.Mutex
+	running, most := 0, 0
+	for round := 0; ; round++ {
+		var ready []*Step
+		for _, s := range steps {
+			if s.Status == "pending" {
+				ready = append(ready, s)
+			}
+		}
+		if len(ready) == 0 {
+			return most
+		}
+		if round == len(steps) {
+			t.Fatalf("steps still pending after %d rounds", round)
+		}
+		err := runBatch(nextBatch(ready), func(s *Step) error {
+			mu.Lock()
+			running++
+			most = max(most, running)
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			s.Status = "completed"
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSharedResourceNeverOverlaps(t *testing.T) {
+	steps := []*Step{
+		{ID: "restart", Resources: []string{"deployment/api"}, Status: "pending"},
+		{ID: "migrate", Resources: []string{"db/api", "deployment/api"}, Status: "pending"},
+		{ID: "scale", Resources: []string{"deployment/api"}, Status: "pending"},
+	}
+	if most := runRounds(t, steps); most != 1 {
+		t.Errorf("%d steps sharing deployment/api ran at once, want 1", most)
+	}
+}
+
+func TestDisjointResourcesRunTogether(t *testing.T) {
+	steps := []*Step{
+		{ID: "scale-api", Resources: []string{"deployment/api"}, Status: "pending"},
+		{ID: "scale-web", Resources: []string{"deployment/web"}, Status: "pending"},
+		{ID: "notify", Status: "pending"}, // Touches nothing
+	}
+	batch := nextBatch(steps)
+	if len(batch) != len(steps) {
+		t.Fatalf("batch has %d steps, want %d", len(batch), len(steps))
+	}
+
+	// A step finishes only once every step of the batch has started:
+	// steps run one after another would time out.
+	var started sync.WaitGroup
+	started.Add(len(batch))
+	all := make(chan struct{})
+	go func() {
+		started.Wait()
+		close(all)
+	}()
+	err := runBatch(batch, func(s *Step) error {
+		started.Done()
+		select {
+		case <-all:
+			return nil
+		case <-time.After(time.Second):
+			return errors.New("ran without the other steps of its batch")
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNextBatch(t *testing.T) {
+	api := []string{"deployment/api"}
+	web := []string{"deployment/web"}
+	tests := []struct {
+		name  string
+		steps []*Step
+		want  []string
+	}{
+		{"shared resource: the first in plan order", []*Step{{ID: "a", Resources: api}, {ID: "b", Resources: api}}, []string{"a"}},
+		{"disjoint resources", []*Step{{ID: "a", Resources: api}, {ID: "b", Resources: web}}, []string{"a", "b"}},
+		{"a step skipped doesn't lock its other resources", []*Step{{ID: "a", Resources: api}, {ID: "b", Resources: []string{"deployment/api", "deployment/web"}}, {ID: "c", Resources: web}}, []string{"a", "c"}},
+		{"no resources", []*Step{{ID: "a"}, {ID: "b"}}, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, s := range nextBatch(tt.steps) {
+				got = append(got, s.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("batch %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
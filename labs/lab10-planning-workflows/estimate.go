@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/simclock"
+)
+
+// statsFile keeps measured step durations between runs.
+const statsFile = "plan_stats.json"
+
+// Price of LLM-driven steps, $ per 1K tokens (gpt-4o-mini, blended input/output).
+const pricePer1KTokens = 0.0006
+
+// stepHeuristics give a first guess when there is no history for a step kind.
+var stepHeuristics = []struct {
+	keyword  string
+	duration time.Duration
+	tokens   int
+}{
+	{"deploy", 5 * time.Minute, 1500},
+	{"build", 3 * time.Minute, 800},
+	{"test", 4 * time.Minute, 1200},
+	{"backup", 2 * time.Minute, 500},
+	{"migrat", 6 * time.Minute, 1500},
+	{"verify", 30 * time.Second, 600},
+	{"check", 15 * time.Second, 400},
+	{"scale", time.Minute, 400},
+}
+
+const (
+	defaultStepDuration = time.Minute
+	defaultStepTokens   = 800
+)
+
+// StepStats are historical measurements of one step kind. Tokens are
+// counted apart: a step that doesn't go through the LLM has a duration to
+// measure but no usage.
+type StepStats struct {
+	Samples       int           `json:"samples"`
+	TotalDuration time.Duration `json:"total_duration"`
+	TokenSamples  int           `json:"token_samples,omitempty"`
+	TotalTokens   int           `json:"total_tokens"`
+}
+
+// unmeasured is the token count of a step whose LLM usage nobody measured.
+const unmeasured = -1
+
+// StatsStore maps a step kind (see stepKind) to its measurements.
+// Steps of one batch run in parallel, so record is guarded by mu.
+type StatsStore struct {
+	mu    sync.Mutex
+	path  string
+	Steps map[string]*StepStats `json:"steps"`
+}
+
+// loadStats reads historical stats; a missing file means "no history yet".
+func loadStats(path string) (*StatsStore, error) {
+	s := &StatsStore{path: path, Steps: map[string]*StepStats{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *StatsStore) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0o644)
+}
+
+// record adds a measurement of step: its duration, and its tokens unless
+// they are unmeasured.
+func (s *StatsStore) record(step *Step, d time.Duration, tokens int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kind := stepKind(step)
+	st, ok := s.Steps[kind]
+	if !ok {
+		st = &StepStats{}
+		s.Steps[kind] = st
+	}
+	st.Samples++
+	st.TotalDuration += d
+	if tokens != unmeasured {
+		st.TokenSamples++
+		st.TotalTokens += tokens
+	}
+}
+
+// stepKind groups similar steps: by tool if the step has one,
+// otherwise by the first two words of the description.
+func stepKind(step *Step) string {
+	if step.Tool != "" {
+		return "tool:" + step.Tool
+	}
+	words := strings.Fields(strings.ToLower(step.Description))
+	if len(words) > 2 {
+		words = words[:2]
+	}
+	return "desc:" + strings.Join(words, " ")
+}
+
+// StepEstimate is the expected duration and cost of one step.
+type StepEstimate struct {
+	StepID   string
+	Duration time.Duration
+	Tokens   int
+	Cost     float64
+	Source   string // "history" or "heuristic"
+}
+
+// PlanEstimate sums up the plan. Duration is the critical path:
+// independent steps can run in parallel.
+type PlanEstimate struct {
+	Steps    []StepEstimate
+	Duration time.Duration
+	Tokens   int
+	Cost     float64
+}
+
+// estimateStep guesses from the heuristics, then replaces what history has
+// measured, field by field: a step kind with durations but no token counts
+// keeps the guessed tokens, and so its cost.
+func estimateStep(step *Step, stats *StatsStore) StepEstimate {
+	e := StepEstimate{StepID: step.ID, Duration: defaultStepDuration, Tokens: defaultStepTokens, Source: "heuristic"}
+	desc := strings.ToLower(step.Description + " " + step.Tool)
+	for _, h := range stepHeuristics {
+		if strings.Contains(desc, h.keyword) {
+			e.Duration, e.Tokens = h.duration, h.tokens
+			break
+		}
+	}
+	if step.Tool != "" {
+		e.Tokens = 0 // Direct tool calls don't go through the LLM
+	}
+	if st, ok := stats.Steps[stepKind(step)]; ok {
+		if st.Samples > 0 {
+			e.Duration = st.TotalDuration / time.Duration(st.Samples)
+			e.Source = "history"
+		}
+		if st.TokenSamples > 0 {
+			e.Tokens = st.TotalTokens / st.TokenSamples
+			e.Source = "history"
+		}
+	}
+	e.Cost = float64(e.Tokens) / 1000 * pricePer1KTokens
+	return e
+}
+
+// estimatePlan estimates the steps that are going to run and the whole plan.
+// Completed and held steps cost nothing.
+func estimatePlan(plan *Plan, stats *StatsStore) PlanEstimate {
+	var pe PlanEstimate
+	byID := map[string]StepEstimate{}
+	for _, s := range plan.Steps {
+		if s.Status != "pending" {
+			continue
+		}
+		e := estimateStep(s, stats)
+		byID[s.ID] = e
+		pe.Steps = append(pe.Steps, e)
+		pe.Tokens += e.Tokens
+		pe.Cost += e.Cost
+	}
+	pe.Duration = criticalPath(plan, byID)
+	return pe
+}
+
+// criticalPath returns the longest dependency chain. On a cycle it falls back
+// to the plain sum — the cycle itself is reported by findReadySteps.
+func criticalPath(plan *Plan, est map[string]StepEstimate) time.Duration {
+	deps := map[string][]string{}
+	for _, s := range plan.Steps {
+		deps[s.ID] = s.Dependencies
+	}
+	finish := map[string]time.Duration{}
+	visiting := map[string]bool{}
+	cycle := false
+
+	var visit func(id string) time.Duration
+	visit = func(id string) time.Duration {
+		if d, ok := finish[id]; ok {
+			return d
+		}
+		if visiting[id] {
+			cycle = true
+			return 0
+		}
+		visiting[id] = true
+		var start time.Duration
+		for _, dep := range deps[id] {
+			start = max(start, visit(dep))
+		}
+		visiting[id] = false
+		finish[id] = start + est[id].Duration
+		return finish[id]
+	}
+
+	var longest, sum time.Duration
+	for _, s := range plan.Steps {
+		longest = max(longest, visit(s.ID))
+		sum += est[s.ID].Duration
+	}
+	if cycle {
+		return sum
+	}
+	return longest
+}
+
+func printEstimate(pe PlanEstimate) {
+	fmt.Println("\nEstimate:")
+	for _, e := range pe.Steps {
+		fmt.Printf("  %-12s %8s %6d tokens  $%.4f  (%s)\n", e.StepID, e.Duration, e.Tokens, e.Cost, e.Source)
+	}
+	fmt.Printf("  %-12s %8s %6d tokens  $%.4f\n", "TOTAL", pe.Duration, pe.Tokens, pe.Cost)
+}
+
+// confirmEstimate asks the human to confirm when the estimate exceeds a limit.
+// Zero limits are ignored.
+func confirmEstimate(pe PlanEstimate, maxDuration time.Duration, maxCost float64) bool {
+	var reasons []string
+	if maxDuration > 0 && pe.Duration > maxDuration {
+		reasons = append(reasons, fmt.Sprintf("duration %s > %s", pe.Duration, maxDuration))
+	}
+	if maxCost > 0 && pe.Cost > maxCost {
+		reasons = append(reasons, fmt.Sprintf("cost $%.4f > $%.4f", pe.Cost, maxCost))
+	}
+	if len(reasons) == 0 {
+		return true
+	}
+	fmt.Printf("\n⚠️  Estimate exceeds the threshold: %s. Continue? [y/N] ", strings.Join(reasons, ", "))
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// timedExecutor measures each step and records it into the stats store.
+// The clock is simulated in the autoscale scenario and real otherwise.
+// The executors of this lab don't call the LLM, so their tokens are
+// unmeasured; one that does would record its usage.
+type timedExecutor struct {
+	inner StepExecutor
+	clock simclock.Clock
+	stats *StatsStore
+}
+
+func (e *timedExecutor) Execute(step *Step) (string, error) {
+	start := e.clock.Now()
+	result, err := e.inner.Execute(step)
+	if err == nil {
+		e.stats.record(step, e.clock.Now().Sub(start), unmeasured)
+	}
+	return result, err
+}
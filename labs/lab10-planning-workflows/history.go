@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/vecindex"
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- History-aware planning ---
+//
+// Every executed plan is stored with its outcome. When planning a new task,
+// the most similar past tasks (by embedding similarity) are put into the
+// planning prompt as examples: successful plans to imitate, failed ones
+// to avoid.
+//
+// The embeddings of past tasks are kept in an index file (pkg/vecindex),
+// so a run embeds only the new task, not the whole history. With another
+// embedding model (LLM_EMBEDDING_MODEL) the index is rebuilt on its own.
+
+// historyFile keeps past plans and their outcomes; historyIndex the
+// embeddings of their tasks.
+const (
+	historyFile  = "plan_history.json"
+	historyIndex = "plan_history.vec"
+)
+
+// embeddingModel embeds the tasks.
+const embeddingModel = openai.SmallEmbedding3
+
+// PastPlan is a plan from a previous run and how it went.
+type PastPlan struct {
+	Task    string    `json:"task"`
+	Plan    *Plan     `json:"plan"`
+	Outcome string    `json:"outcome"` // success or failed
+	Error   string    `json:"error,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+func loadHistory(path string) ([]PastPlan, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var history []PastPlan
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return history, nil
+}
+
+// recordPlanOutcome appends the plan to the history file.
+func recordPlanOutcome(ctx context.Context, client llm.Provider, path string, plan *Plan, execErr error) error {
+	history, err := loadHistory(path)
+	if err != nil {
+		return err
+	}
+	past := PastPlan{Task: plan.Task, Plan: plan, Outcome: "success", At: time.Now()}
+	if execErr != nil {
+		past.Outcome, past.Error = "failed", execErr.Error()
+	}
+	// Without embeddings the entry is still useful: similarity falls back to words.
+	embedTasks(ctx, client, []string{plan.Task})
+
+	history = append(history, past)
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// embedTasks returns the embeddings of tasks from the history index,
+// embedding the ones it lacks. nil means no embeddings: the backend has
+// none, or the index can't be read.
+func embedTasks(ctx context.Context, client llm.Provider, tasks []string) [][]float32 {
+	ix, err := vecindex.Open(historyIndex, string(embeddingModel))
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+		return nil
+	}
+	if ix.Rebuilt != "" {
+		fmt.Printf("Rebuilding %s: %s\n", historyIndex, ix.Rebuilt)
+	}
+	vecs, err := ix.Embed(ctx, client, tasks)
+	if err != nil {
+		return nil
+	}
+	if err := ix.Save(historyIndex); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	return vecs
+}
+
+// similarPlans returns up to k past plans most similar to the task.
+// Entries below minSimilarity are not worth showing to the model.
+func similarPlans(ctx context.Context, client llm.Provider, history []PastPlan, task string, k int, minSimilarity float64) []PastPlan {
+	tasks := []string{task}
+	for _, p := range history {
+		tasks = append(tasks, p.Task)
+	}
+	vecs := embedTasks(ctx, client, tasks)
+
+	type scored struct {
+		past  PastPlan
+		score float64
+	}
+	var candidates []scored
+	for i, p := range history {
+		var score float64
+		if vecs != nil {
+			score = vecindex.Cosine(vecs[0], vecs[i+1])
+		} else {
+			score = wordOverlap(task, p.Task)
+		}
+		if score >= minSimilarity {
+			candidates = append(candidates, scored{p, score})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+
+	var out []PastPlan
+	for i := 0; i < len(candidates) && i < k; i++ {
+		out = append(out, candidates[i].past)
+	}
+	return out
+}
+
+// wordOverlap is the Jaccard similarity of lowercase words, used when
+// embeddings are unavailable (mock server, no API key).
+func wordOverlap(a, b string) float64 {
+	wa := map[string]bool{}
+	for _, w := range strings.Fields(strings.ToLower(a)) {
+		wa[w] = true
+	}
+	wb := map[string]bool{}
+	for _, w := range strings.Fields(strings.ToLower(b)) {
+		wb[w] = true
+	}
+	inter := 0
+	for w := range wa {
+		if wb[w] {
+			inter++
+		}
+	}
+	union := len(wa) + len(wb) - inter
+	if union == 0 {
+		return 0
+	}
+	return float64(inter) / float64(union)
+}
+
+// planningExamples formats past plans for the planning prompt.
+func planningExamples(past []PastPlan) string {
+	if len(past) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("Plans for similar tasks from previous runs:\n")
+	for _, p := range past {
+		fmt.Fprintf(&b, "\nTask: %s\nOutcome: %s", p.Task, p.Outcome)
+		if p.Error != "" {
+			fmt.Fprintf(&b, " (%s)", p.Error)
+		}
+		b.WriteString("\nSteps:\n")
+		for _, s := range p.Plan.Steps {
+			deps := ""
+			if len(s.Dependencies) > 0 {
+				deps = " after " + strings.Join(s.Dependencies, ", ")
+			}
+			fmt.Fprintf(&b, "- %s: %s%s\n", s.ID, s.Description, deps)
+		}
+	}
+	b.WriteString("\nReuse what worked; avoid the mistakes of failed plans.")
+	return b.String()
+}
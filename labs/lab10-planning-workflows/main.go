@@ -3,10 +3,15 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"time"
 
-	"github.com/sashabaranov/go-openai"
+	"github.com/kshvakov/agent/pkg/agent"
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/simclock"
 )
 
 // Step represents a single step in the plan
@@ -16,6 +21,14 @@ type Step struct {
 	Dependencies []string // IDs of steps this step depends on
 	Status       string   // pending, running, completed, failed
 	Result       string   // Execution result
+
+	Tool string         // Optional: tool the executor should run for this step
+	Args map[string]any // Optional: tool arguments
+
+	Resources []string // Optional: resources the step touches (e.g. "deployment/api"); see conflicts.go
+
+	Pre  []Condition // Optional: checks that must pass before the step; see conditions.go
+	Post []Condition // Optional: checks that must pass after the step
 }
 
 // Plan represents the complete task execution plan
@@ -30,15 +43,26 @@ type StepExecutor interface {
 	Execute(step *Step) (string, error)
 }
 
+// PlanOptions tune plan creation
+type PlanOptions struct {
+	Examples    string   // Plans for similar past tasks (see history.go), may be empty
+	Temperature float32  // 0 for a deterministic plan, higher for diverse candidates (see portfolio.go)
+	Tools       []string // Step tools the plan may call (see stream.go); none if empty
+}
+
 // TODO 1: Implement plan creation function via LLM
 // Use LLM to decompose task into steps
 // Define dependencies between steps
-func createPlan(ctx context.Context, client *openai.Client, task string) (*Plan, error) {
+func createPlan(ctx context.Context, client llm.Provider, task string, opts PlanOptions) (*Plan, error) {
 	// TODO: Create prompt for task decomposition
-	// TODO: Call LLM to get plan
+	//       (if the task lists step tools, ask for "tool" and "args" on each step;
+	//       append opts.Examples so the model learns from previous outcomes,
+	//       and planOrderRule)
+	// TODO: Call LLM to get plan (with opts.Temperature): streamPlan(ctx, client, req, opts.Tools)
+	//       checks each step as it arrives and asks again if one is bad
 	// TODO: Parse LLM response into Plan structure
 	// TODO: Return plan
-	
+
 	return nil, fmt.Errorf("not implemented")
 }
 
@@ -46,11 +70,12 @@ func createPlan(ctx context.Context, client *openai.Client, task string) (*Plan,
 // Return steps whose all dependencies are completed
 // Detect cyclic dependencies
 func findReadySteps(plan *Plan) ([]*Step, error) {
-	// TODO: Iterate through all steps
+	// TODO: Iterate through all steps (only "pending" ones are candidates;
+	//       "held" steps are excluded by --until)
 	// TODO: Check if all dependencies are completed
 	// TODO: Detect cyclic dependencies
 	// TODO: Return ready steps
-	
+
 	return nil, fmt.Errorf("not implemented")
 }
 
@@ -59,10 +84,15 @@ func findReadySteps(plan *Plan) ([]*Step, error) {
 // Retry failed steps up to maxRetries
 func executePlanWithRetries(ctx context.Context, plan *Plan, executor StepExecutor, maxRetries int) error {
 	// TODO: Find ready steps
-	// TODO: Execute steps
+	// TODO: Execute steps (independent steps may run in parallel: take a
+	//       conflict-free batch with nextBatch and run it with runBatch)
 	// TODO: Handle errors (retry, skip, abort)
 	// TODO: Track step status
-	
+	// TODO: Return nil when every step is "completed" or "held" (--until):
+	//       held steps run on --resume, they are not a deadlock
+	// TODO: Stop between steps when ctx is done (Ctrl+C) and return ctx.Err():
+	//       completed steps are saved, --resume picks up the rest
+
 	return fmt.Errorf("not implemented")
 }
 
@@ -71,7 +101,7 @@ func executePlanWithRetries(ctx context.Context, plan *Plan, executor StepExecut
 func savePlanState(planID string, plan *Plan) error {
 	// TODO: Serialize plan to JSON
 	// TODO: Save to file
-	
+
 	return fmt.Errorf("not implemented")
 }
 
@@ -81,7 +111,7 @@ func loadPlanState(planID string) (*Plan, error) {
 	// TODO: Read file
 	// TODO: Deserialize JSON to Plan
 	// TODO: Return plan
-	
+
 	return nil, fmt.Errorf("not implemented")
 }
 
@@ -95,45 +125,153 @@ func (e *MockExecutor) Execute(step *Step) (string, error) {
 }
 
 func main() {
-	// Client setup
-	token := os.Getenv("OPENAI_API_KEY")
-	baseURL := os.Getenv("OPENAI_BASE_URL")
-	if token == "" {
-		token = "dummy"
-	}
+	scenario := flag.String("scenario", "deploy", "scenario: deploy | autoscale")
+	until := flag.String("until", "", "execute only up to this step ID (and its dependencies), then stop")
+	resume := flag.String("resume", "", "resume a saved plan by ID instead of creating a new one")
+	candidates := flag.Int("k", 1, "generate k candidate plans, let a judge model pick the best")
+	useHistory := flag.Bool("history", true, "show plans of similar past tasks to the planner (disable to compare plan quality)")
+	maxDuration := flag.Duration("max-duration", 15*time.Minute, "ask for confirmation if the estimated duration exceeds this (0 = no limit)")
+	progress := flag.String("progress", "text", "progress events: text | json (JSON lines on stderr) | off")
+	maxCost := flag.Float64("max-cost", 0.01, "ask for confirmation if the estimated LLM cost in $ exceeds this (0 = no limit)")
+	flag.Parse()
 
-	config := openai.DefaultConfig(token)
-	if baseURL != "" {
-		config.BaseURL = baseURL
+	// Client setup. LLM_PROVIDER picks the backend: openai (any OpenAI-compatible server), llamacpp, ollama, anthropic.
+	client, err := llm.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	client := openai.NewClientWithConfig(config)
 
-	ctx := context.Background()
+	// Ctrl+C stops the plan between steps; it can be resumed with --resume.
+	ctx, stop := agent.Interruptible(context.Background())
+	defer stop()
 
 	// Test task
 	task := "Deploy new version of service"
+	var executor StepExecutor = &MockExecutor{}
+
+	var clock simclock.Clock = simclock.Real{}
+	var svc *scalingService
+	if *scenario == "autoscale" {
+		// The queue grows on a simulated clock; steps call scale_up/scale_down/verify_draining.
+		sim := simclock.New(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+		clock = sim
+		svc = newScalingService(sim)
+		executor = &ScalingExecutor{svc: svc}
+		task = "Queue depth of orders-worker keeps growing. Drain it by scaling up gradually.\n\n" + scalingToolsPrompt
+	}
 
 	fmt.Println("=== Lab 10: Planning and Workflows ===")
 	fmt.Printf("Task: %s\n\n", task)
 
 	// TODO: Create plan
-	plan, err := createPlan(ctx, client, task)
+	var plan *Plan
+	if *resume != "" {
+		plan, err = loadPlanState(*resume)
+	} else {
+		var opts PlanOptions
+		if svc != nil {
+			opts.Tools = scalingTools
+		}
+		if *useHistory {
+			history, histErr := loadHistory(historyFile)
+			if histErr != nil {
+				fmt.Printf("Warning: ignoring plan history: %v\n", histErr)
+			}
+			past := similarPlans(ctx, client, history, task, 3, 0.3)
+			if len(past) > 0 {
+				fmt.Printf("Using %d similar past plans as examples\n", len(past))
+			}
+			opts.Examples = planningExamples(past)
+		}
+		if *candidates > 1 {
+			plan, err = createPlanPortfolio(ctx, client, task, opts, *candidates)
+		} else {
+			plan, err = createPlan(ctx, client, task, opts)
+		}
+	}
+	if err != nil && *resume == "" && *scenario == "autoscale" {
+		// Lets you work on the executor before createPlan is implemented.
+		fmt.Printf("Error creating plan: %v — using the reference autoscale plan\n", err)
+		plan, err = autoscalePlan(), nil
+	}
 	if err != nil {
 		fmt.Printf("Error creating plan: %v\n", err)
 		return
 	}
 
 	fmt.Printf("Plan created with %d steps\n", len(plan.Steps))
+	for _, c := range resourceConflicts(plan) {
+		fmt.Printf("Note: steps %s and %s both touch %s — they will run one after another\n", c.A, c.B, c.Resource)
+	}
+
+	// Partial execution: run only what --until needs, keep the rest for --resume.
+	release := func() {}
+	if *until != "" {
+		release, err = limitPlan(plan, *until)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+	}
+
+	// Estimate before executing: history from previous runs, heuristics otherwise.
+	stats, err := loadStats(statsFile)
+	if err != nil {
+		fmt.Printf("Warning: ignoring step history: %v\n", err)
+		stats = &StatsStore{path: statsFile, Steps: map[string]*StepStats{}}
+	}
+	estimate := estimatePlan(plan, stats)
+	printEstimate(estimate)
+	if !confirmEstimate(estimate, *maxDuration, *maxCost) {
+		release()
+		fmt.Println("Aborted.")
+		return
+	}
 
 	// TODO: Execute plan
-	executor := &MockExecutor{}
+	executor = &timedExecutor{inner: &conditionExecutor{inner: executor}, clock: clock, stats: stats}
+	switch *progress {
+	case "text":
+		executor = newProgressExecutor(executor, plan, estimate, clock, textSink(os.Stdout))
+	case "json":
+		executor = newProgressExecutor(executor, plan, estimate, clock, jsonSink(os.Stderr))
+	}
 	err = executePlanWithRetries(ctx, plan, executor, 3)
+	release()
+	if saveErr := stats.save(); saveErr != nil {
+		fmt.Printf("Warning: step history not saved: %v\n", saveErr)
+	}
+	if svc != nil {
+		fmt.Println("Service:", svc.status())
+	}
+	if saveErr := savePlanState(plan.ID, plan); saveErr != nil {
+		fmt.Printf("Warning: plan state not saved: %v\n", saveErr)
+	}
+	// Partial runs aren't outcomes yet: the plan is recorded when it finishes or fails.
+	interrupted := errors.Is(err, context.Canceled)
+	if *until == "" && !interrupted {
+		if histErr := recordPlanOutcome(ctx, client, historyFile, plan, err); histErr != nil {
+			fmt.Printf("Warning: plan history not saved: %v\n", histErr)
+		}
+	}
+	if interrupted {
+		printPlanStatus(plan)
+		fmt.Printf("\n⏹  Interrupted. Continue with: go run . --resume %s\n", plan.ID)
+		return
+	}
 	if err != nil {
+		printPlanStatus(plan)
 		fmt.Printf("Error executing plan: %v\n", err)
 		return
 	}
 
+	if *until != "" {
+		printPlanStatus(plan)
+		fmt.Printf("\nStopped after step %q. Continue with: go run . --resume %s\n", *until, plan.ID)
+		return
+	}
 	fmt.Println("\nPlan executed successfully!")
-	
+
 	_ = json.RawMessage{}
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// statusHeld marks steps excluded from the current partial execution.
+// findReadySteps only picks "pending" steps, so held steps are skipped.
+const statusHeld = "held"
+
+// limitPlan restricts execution to the until step and everything it
+// (transitively) depends on. Other pending steps are put on hold.
+// The returned release function puts them back to "pending", so the plan
+// can be saved and resumed later.
+func limitPlan(plan *Plan, until string) (release func(), err error) {
+	byID := make(map[string]*Step, len(plan.Steps))
+	for _, s := range plan.Steps {
+		byID[s.ID] = s
+	}
+	if _, ok := byID[until]; !ok {
+		return nil, fmt.Errorf("step %q not found in plan %s", until, plan.ID)
+	}
+
+	// Collect the until step and its dependency closure.
+	needed := map[string]bool{}
+	var visit func(id string)
+	visit = func(id string) {
+		if needed[id] {
+			return
+		}
+		needed[id] = true
+		if s, ok := byID[id]; ok {
+			for _, dep := range s.Dependencies {
+				visit(dep)
+			}
+		}
+	}
+	visit(until)
+
+	var held []*Step
+	for _, s := range plan.Steps {
+		if !needed[s.ID] && s.Status == "pending" {
+			s.Status = statusHeld
+			held = append(held, s)
+		}
+	}
+	return func() {
+		for _, s := range held {
+			if s.Status == statusHeld {
+				s.Status = "pending"
+			}
+		}
+	}, nil
+}
+
+// printPlanStatus shows every step with its status and result,
+// so intermediate results can be inspected between partial runs.
+func printPlanStatus(plan *Plan) {
+	fmt.Printf("\nPlan %s:\n", plan.ID)
+	for _, s := range plan.Steps {
+		deps := ""
+		if len(s.Dependencies) > 0 {
+			deps = " (after " + strings.Join(s.Dependencies, ", ") + ")"
+		}
+		fmt.Printf("  [%-9s] %s: %s%s\n", s.Status, s.ID, s.Description, deps)
+		if s.Result != "" {
+			fmt.Printf("              → %s\n", s.Result)
+		}
+	}
+}
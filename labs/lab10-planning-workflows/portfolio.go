@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/parse"
+	"github.com/kshvakov/agent/pkg/schema"
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Plan portfolio ---
+//
+// One plan at temperature 0 is one opinion. With -k N, createPlan samples N
+// candidates at a higher temperature, a judge model scores each of them, and
+// the best one is executed. All candidates are saved for comparison.
+
+// portfolioTemperature is used for sampling when PlanOptions.Temperature is 0.
+const portfolioTemperature = 0.9
+
+// PlanScore is the judge's opinion on a candidate plan, each criterion 1..10.
+type PlanScore struct {
+	Completeness int    `json:"completeness"` // Does it solve the task, including verification?
+	Safety       int    `json:"safety"`       // Checks before risky actions, gradual changes, rollback
+	Parallelism  int    `json:"parallelism"`  // Independent steps are not chained needlessly
+	Comment      string `json:"comment"`
+	Judge        string `json:"judge"` // llm or heuristic
+}
+
+// Total weights correctness above speed.
+func (s PlanScore) Total() float64 {
+	return 0.4*float64(s.Completeness) + 0.4*float64(s.Safety) + 0.2*float64(s.Parallelism)
+}
+
+// Candidate is one sampled plan with its score.
+type Candidate struct {
+	Plan  *Plan     `json:"plan"`
+	Score PlanScore `json:"score"`
+	Total float64   `json:"total"`
+}
+
+// createPlanPortfolio samples k plans, scores them and returns the best one.
+func createPlanPortfolio(ctx context.Context, client llm.Provider, task string, opts PlanOptions, k int) (*Plan, error) {
+	if opts.Temperature == 0 {
+		opts.Temperature = portfolioTemperature
+	}
+
+	var candidates []Candidate
+	var lastErr error
+	for i := 0; i < k; i++ {
+		plan, err := createPlan(ctx, client, task, opts)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		score, err := judgePlan(ctx, client, task, plan)
+		if err != nil {
+			fmt.Printf("Judge failed for candidate %d, using heuristics: %v\n", i+1, err)
+			score = heuristicScore(plan)
+		}
+		candidates = append(candidates, Candidate{Plan: plan, Score: score, Total: score.Total()})
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no candidate plans: %w", lastErr)
+	}
+
+	best := 0
+	for i, c := range candidates {
+		fmt.Printf("Candidate %d: %d steps, completeness=%d safety=%d parallelism=%d total=%.1f (%s)\n",
+			i+1, len(c.Plan.Steps), c.Score.Completeness, c.Score.Safety, c.Score.Parallelism, c.Total, c.Score.Judge)
+		if c.Total > candidates[best].Total {
+			best = i
+		}
+	}
+	fmt.Printf("Selected candidate %d\n", best+1)
+
+	if err := saveCandidates(candidates[best].Plan.ID, candidates); err != nil {
+		fmt.Printf("Warning: candidates not saved: %v\n", err)
+	}
+	return candidates[best].Plan, nil
+}
+
+// judgeSchema is the shape of the judge's answer. Out-of-range scores are
+// clamped rather than rejected, so only the types are checked.
+var judgeSchema = schema.Object().
+	Prop("completeness", schema.Integer("")).
+	Prop("safety", schema.Integer("")).
+	Prop("parallelism", schema.Integer("")).
+	Prop("comment", schema.String("")).
+	Require("completeness", "safety", "parallelism")
+
+// judgePlan asks the model to score a plan.
+func judgePlan(ctx context.Context, client llm.Provider, task string, plan *Plan) (PlanScore, error) {
+	data, err := json.MarshalIndent(plan.Steps, "", "  ")
+	if err != nil {
+		return PlanScore{}, err
+	}
+	prompt := fmt.Sprintf(`You review execution plans for DevOps tasks.
+Task: %s
+
+Plan steps:
+%s
+
+Score the plan from 1 to 10 on:
+- completeness: solves the whole task, including verification of the result
+- safety: checks before risky actions, gradual changes, a way back
+- parallelism: independent steps don't depend on each other needlessly
+
+Return JSON only: {"completeness": N, "safety": N, "parallelism": N, "comment": "..."}`, task, data)
+
+	resp, err := client.ChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:          "gpt-4o-mini",
+		Messages:       []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: prompt}},
+		Temperature:    llm.ZeroTemperature,
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	})
+	if err != nil {
+		return PlanScore{}, err
+	}
+	if len(resp.Choices) == 0 {
+		return PlanScore{}, fmt.Errorf("empty judge response")
+	}
+	content, err := parse.JSON[json.RawMessage]()(resp.Choices[0].Message.Content)
+	if err != nil {
+		return PlanScore{}, fmt.Errorf("judge: %w", err)
+	}
+	if err := judgeSchema.Validate(content); err != nil {
+		return PlanScore{}, fmt.Errorf("judge: %w", err)
+	}
+	var score PlanScore
+	if err := json.Unmarshal(content, &score); err != nil {
+		return PlanScore{}, fmt.Errorf("judge returned invalid JSON: %w", err)
+	}
+	score.Completeness = clampScore(score.Completeness)
+	score.Safety = clampScore(score.Safety)
+	score.Parallelism = clampScore(score.Parallelism)
+	score.Judge = "llm"
+	return score, nil
+}
+
+// heuristicScore is the fallback when the judge is unavailable.
+func heuristicScore(plan *Plan) PlanScore {
+	var verifies, conditions bool
+	for _, s := range plan.Steps {
+		text := strings.ToLower(s.Description + " " + s.Tool)
+		if strings.Contains(text, "verify") || strings.Contains(text, "check") || strings.Contains(text, "test") {
+			verifies = true
+		}
+		if len(s.Pre)+len(s.Post) > 0 {
+			conditions = true
+		}
+	}
+	score := PlanScore{Completeness: 5, Safety: 5, Judge: "heuristic"}
+	if verifies {
+		score.Completeness += 4
+		score.Safety += 2
+	}
+	if conditions {
+		score.Safety += 3
+	}
+
+	// Parallelism: how much shorter the longest chain is than the plan.
+	unit := map[string]StepEstimate{}
+	for _, s := range plan.Steps {
+		unit[s.ID] = StepEstimate{Duration: time.Second}
+	}
+	if n := len(plan.Steps); n > 0 {
+		depth := int(criticalPath(plan, unit) / time.Second)
+		score.Parallelism = 1 + 9*(n-depth)/n
+	}
+	return score
+}
+
+func clampScore(n int) int {
+	return min(max(n, 1), 10)
+}
+
+func saveCandidates(planID string, candidates []Candidate) error {
+	data, err := json.MarshalIndent(candidates, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fmt.Sprintf("plan_%s_candidates.json", planID), data, 0o644)
+}
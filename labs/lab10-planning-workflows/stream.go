@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/parse"
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Streaming the plan ---
+//
+// A plan arrives token by token, and a bad one is usually bad early: the
+// second step depends on a step that doesn't exist, or calls a tool the
+// scenario doesn't have. Waiting for the whole plan to validate it pays
+// for every step after the mistake. streamPlan checks each step as soon
+// as its closing brace arrives (parse.Elements) and stops the stream at
+// the first bad one; the model is asked again with what was wrong.
+//
+// A step may depend only on steps above it. That can be checked before
+// the plan is complete, and a plan that keeps to it has no cycles.
+
+// planRepairs is how many times a plan stopped at a bad step is asked for
+// again.
+const planRepairs = 2
+
+// planOrderRule goes into the planner's prompt: it is what checkPlanStep
+// enforces.
+const planOrderRule = "List the steps in order: a step may depend only on steps listed before it."
+
+// BadStepError is a plan step that failed the check while the plan
+// streamed.
+type BadStepError struct {
+	Step    int // From 1
+	ID      string
+	Problem string
+}
+
+func (e *BadStepError) Error() string {
+	return fmt.Sprintf("step %d (%s): %s", e.Step, e.ID, e.Problem)
+}
+
+// checkPlanStep checks step i (from 0) of a streaming plan against the
+// steps before it, by id, and the step tools (none outside the autoscale
+// scenario).
+func checkPlanStep(i int, raw json.RawMessage, before []string, tools []string) (string, error) {
+	var step struct {
+		ID           string      `json:"id"`
+		Dependencies []string    `json:"dependencies"`
+		Tool         string      `json:"tool"`
+		Pre          []Condition `json:"pre"`
+		Post         []Condition `json:"post"`
+	}
+	if err := json.Unmarshal(raw, &step); err != nil {
+		return "", &BadStepError{Step: i + 1, Problem: "not a step object"}
+	}
+	bad := func(format string, args ...any) error {
+		return &BadStepError{Step: i + 1, ID: step.ID, Problem: fmt.Sprintf(format, args...)}
+	}
+	switch {
+	case step.ID == "":
+		return "", bad("no id")
+	case slices.Contains(before, step.ID):
+		return "", bad("the id is taken by an earlier step")
+	}
+	for _, dep := range step.Dependencies {
+		if !slices.Contains(before, dep) {
+			return "", bad("depends on %q, which is not a step above it", dep)
+		}
+	}
+	for _, c := range slices.Concat([]Condition{{Tool: step.Tool}}, step.Pre, step.Post) {
+		if c.Tool != "" && !slices.Contains(tools, c.Tool) {
+			if len(tools) == 0 {
+				return "", bad("calls %s, but this task has no step tools", c.Tool)
+			}
+			return "", bad("calls %s, which is not one of the step tools (%s)", c.Tool, strings.Join(tools, ", "))
+		}
+	}
+	return step.ID, nil
+}
+
+// streamPlan sends the planner's request req streamed and returns the
+// text of a plan whose every step passed checkPlanStep. A plan stopped at
+// a bad step is asked for again, up to planRepairs times.
+func streamPlan(ctx context.Context, client llm.Provider, req openai.ChatCompletionRequest, tools []string) (string, error) {
+	req.Stream = true
+	req.Messages = slices.Clone(req.Messages)
+	for attempt := 0; ; attempt++ {
+		text, err := streamPlanOnce(ctx, client, req, tools)
+		var bad *BadStepError
+		if !errors.As(err, &bad) || attempt == planRepairs {
+			return text, err
+		}
+		fmt.Printf("✂️  Plan stopped at %v. Asking again.\n", bad)
+		req.Messages = append(req.Messages,
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: text},
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: fmt.Sprintf(
+				"Your plan was stopped at %v. Write the whole plan again with that fixed. %s", bad, planOrderRule)})
+	}
+}
+
+// streamPlanOnce streams one reply, stopping at the first bad step: the
+// text so far is returned with a *BadStepError.
+func streamPlanOnce(ctx context.Context, client llm.Provider, req openai.ChatCompletionRequest, tools []string) (string, error) {
+	stream, err := client.Stream(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	var ids []string
+	steps := parse.NewElements("steps", func(i int, raw json.RawMessage) error {
+		id, err := checkPlanStep(i, raw, ids, tools)
+		ids = append(ids, id)
+		return err
+	})
+	resp, err := llm.CollectUntil(stream, steps.Write)
+	if len(resp.Choices) == 0 {
+		return "", err
+	}
+	return resp.Choices[0].Message.Content, err
+}
@@ -3,11 +3,19 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/kshvakov/agent/pkg/agent"
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/normalize"
+	"github.com/kshvakov/agent/pkg/redact"
+	"github.com/kshvakov/agent/pkg/schema"
+	"github.com/kshvakov/agent/pkg/tools"
 	"github.com/sashabaranov/go-openai"
 )
 
@@ -68,19 +76,19 @@ type Run struct {
 	contextMax   int
 	condenseDone bool
 
-	client *openai.Client
+	client llm.Provider
 	model  string
-	tools  []openai.Tool
+	tools  *tools.Registry
 	store  Store
 }
 
-func NewRun(client *openai.Client, model string, contextMax int, store Store, systemPrompt string, tools []openai.Tool) *Run {
+func NewRun(client llm.Provider, model string, contextMax int, store Store, systemPrompt string, reg *tools.Registry) *Run {
 	return &Run{
 		client:     client,
 		model:      model,
 		contextMax: contextMax,
 		store:      store,
-		tools:      tools,
+		tools:      reg,
 		messages: []openai.ChatCompletionMessage{
 			{Role: openai.ChatMessageRoleSystem, Content: systemPrompt},
 		},
@@ -114,7 +122,10 @@ func (r *Run) Step(ctx context.Context, userInput string) (string, error) {
 		}
 
 		for _, tc := range msg.ToolCalls {
-			result := r.dispatchTool(ctx, tc)
+			result, err := r.tools.Dispatch(ctx, tc)
+			if err != nil {
+				result = fmt.Sprintf("error: %v", err)
+			}
 			r.messages = append(r.messages, openai.ChatCompletionMessage{
 				Role:       openai.ChatMessageRoleTool,
 				ToolCallID: tc.ID,
@@ -126,10 +137,10 @@ func (r *Run) Step(ctx context.Context, userInput string) (string, error) {
 }
 
 func (r *Run) callLLM(ctx context.Context) (openai.ChatCompletionResponse, error) {
-	return r.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+	return r.client.ChatCompletion(ctx, openai.ChatCompletionRequest{
 		Model:       r.model,
 		Messages:    r.messages,
-		Tools:       r.tools,
+		Tools:       r.tools.Definitions(),
 		Temperature: 0,
 	})
 }
@@ -155,51 +166,81 @@ func (r *Run) condense(ctx context.Context) error {
 
 // summarize calls the LLM to get a short summary of a chunk of history.
 func (r *Run) summarize(ctx context.Context, head []openai.ChatCompletionMessage) (string, error) {
-	// TODO 9: assemble input as linear text (role: content),
-	// send a separate request with the system prompt from MANUAL.md
+	// TODO 9: assemble input as linear text (role: content), mask secrets
+	// in it with redact.Text (as memory_save does), send a separate request with the system prompt from MANUAL.md
 	// (section "Step 2: condense"), and return Choices[0].Message.Content.
 	return "", fmt.Errorf("not implemented")
 }
 
-// dispatchTool routes memory_save / memory_recall / memory_delete calls.
-// Returns the string that goes into the tool message's content.
-func (r *Run) dispatchTool(ctx context.Context, tc openai.ToolCall) string {
-	switch tc.Function.Name {
-	case "memory_save":
-		var args struct {
-			Key, Value string
-		}
-		if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
-			return fmt.Sprintf("error: %v", err)
-		}
-		if err := r.store.Save(ctx, args.Key, args.Value); err != nil {
-			return fmt.Sprintf("error: %v", err)
-		}
-		return "ok"
-
-	case "memory_recall":
-		var args struct{ Query string }
-		if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
-			return fmt.Sprintf("error: %v", err)
-		}
-		hits, err := r.store.Recall(ctx, args.Query)
-		if err != nil {
-			return fmt.Sprintf("error: %v", err)
-		}
-		out, _ := json.Marshal(hits)
-		return string(out)
-
-	case "memory_delete":
-		var args struct{ Key string }
-		if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
-			return fmt.Sprintf("error: %v", err)
-		}
-		if err := r.store.Delete(ctx, args.Key); err != nil {
-			return fmt.Sprintf("error: %v", err)
-		}
-		return "ok"
+// memoryTools returns memory_save / memory_recall / memory_delete over store.
+// The returned string goes into the tool message's content.
+func memoryTools(store Store) []tools.Tool {
+	return []tools.Tool{
+		{
+			Name:        "memory_save",
+			Description: "Save a long-term note. Use for stable facts about the user or project.",
+			Params: schema.Object().
+				Prop("key", schema.String("")).
+				Prop("value", schema.String("")).
+				Require("key", "value"),
+			Execute: func(ctx context.Context, raw json.RawMessage) (string, error) {
+				var args struct {
+					Key, Value string
+				}
+				if err := json.Unmarshal(raw, &args); err != nil {
+					return "", err
+				}
+				// A note outlives the session: mask credentials and
+				// personal data before it is written, and write dates,
+				// versions and sizes one way so recall finds them.
+				value, masked := redact.Text(args.Value)
+				value = normalize.Text(value)
+				if err := store.Save(ctx, args.Key, value); err != nil {
+					return "", err
+				}
+				if len(masked) > 0 {
+					return "ok, masked: " + strings.Join(masked, ", "), nil
+				}
+				return "ok", nil
+			},
+		},
+		{
+			Name:        "memory_recall",
+			Description: "Search long-term notes by query (substring).",
+			Params: schema.Object().
+				Prop("query", schema.String("")).
+				Require("query"),
+			Execute: func(ctx context.Context, raw json.RawMessage) (string, error) {
+				var args struct{ Query string }
+				if err := json.Unmarshal(raw, &args); err != nil {
+					return "", err
+				}
+				hits, err := store.Recall(ctx, normalize.Text(args.Query))
+				if err != nil {
+					return "", err
+				}
+				out, _ := json.Marshal(hits)
+				return string(out), nil
+			},
+		},
+		{
+			Name:        "memory_delete",
+			Description: "Delete a note by key.",
+			Params: schema.Object().
+				Prop("key", schema.String("")).
+				Require("key"),
+			Execute: func(ctx context.Context, raw json.RawMessage) (string, error) {
+				var args struct{ Key string }
+				if err := json.Unmarshal(raw, &args); err != nil {
+					return "", err
+				}
+				if err := store.Delete(ctx, args.Key); err != nil {
+					return "", err
+				}
+				return "ok", nil
+			},
+		},
 	}
-	return fmt.Sprintf("unknown tool: %s", tc.Function.Name)
 }
 
 // isContextOverflow returns true if the error looks like a model-window overflow.
@@ -208,23 +249,13 @@ func isContextOverflow(err error) bool {
 	return false
 }
 
-// jsonSchema — convenience helper for writing Parameters in tools.
-func jsonSchema(s string) json.RawMessage {
-	return json.RawMessage(s)
-}
-
 func main() {
-	token := os.Getenv("OPENAI_API_KEY")
-	baseURL := os.Getenv("OPENAI_BASE_URL")
-	if token == "" {
-		token = "dummy"
-	}
-
-	cfg := openai.DefaultConfig(token)
-	if baseURL != "" {
-		cfg.BaseURL = baseURL
+	// LLM_PROVIDER picks the backend: openai (any OpenAI-compatible server), llamacpp, ollama, anthropic.
+	client, err := llm.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	client := openai.NewClientWithConfig(cfg)
 
 	store, err := NewFileStore("memory.json")
 	if err != nil {
@@ -232,53 +263,24 @@ func main() {
 		os.Exit(1)
 	}
 
-	tools := []openai.Tool{
-		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
-			Name:        "memory_save",
-			Description: "Save a long-term note. Use for stable facts about the user or project.",
-			Parameters: jsonSchema(`{
-				"type":"object",
-				"properties":{
-					"key":{"type":"string"},
-					"value":{"type":"string"}
-				},
-				"required":["key","value"]
-			}`),
-		}},
-		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
-			Name:        "memory_recall",
-			Description: "Search long-term notes by query (substring).",
-			Parameters: jsonSchema(`{
-				"type":"object",
-				"properties":{
-					"query":{"type":"string"}
-				},
-				"required":["query"]
-			}`),
-		}},
-		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
-			Name:        "memory_delete",
-			Description: "Delete a note by key.",
-			Parameters: jsonSchema(`{
-				"type":"object",
-				"properties":{
-					"key":{"type":"string"}
-				},
-				"required":["key"]
-			}`),
-		}},
-	}
+	reg := tools.NewRegistry(memoryTools(store)...)
 
 	systemPrompt := `You are an assistant.
 You have memory_save / memory_recall / memory_delete tools that persist between sessions.
 Use them for stable facts about the user and project. Don't store transient statuses.`
 
-	run := NewRun(client, "gpt-4o-mini", 128_000, store, systemPrompt, tools)
+	run := NewRun(client, "gpt-4o-mini", 128_000, store, systemPrompt, reg)
 
-	ctx := context.Background()
+	// Ctrl+C stops the run after the current step and prints what was done.
+	ctx, stop := agent.Interruptible(context.Background())
+	defer stop()
 
 	// Demo step. In a real lab this should be a REPL.
 	answer, err := run.Step(ctx, "Remember that my name is Ivan and I'm responsible for the prod cluster.")
+	if errors.Is(err, context.Canceled) {
+		fmt.Printf("\n⏹  Interrupted. So far:\n%s", agent.Recap(run.messages))
+		return
+	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "step:", err)
 		os.Exit(1)
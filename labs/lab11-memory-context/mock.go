@@ -0,0 +1,15 @@
+package main
+
+import "github.com/kshvakov/agent/pkg/mockllm"
+
+// Offline run: OPENAI_BASE_URL=mock go run .
+// The scripted model decides to save both facts, as the system prompt asks.
+func init() {
+	mockllm.Register(
+		mockllm.Turn{ToolCalls: []mockllm.ToolCall{
+			{Name: "memory_save", Args: map[string]any{"key": "user.name", "value": "Ivan"}},
+			{Name: "memory_save", Args: map[string]any{"key": "user.responsibility", "value": "prod cluster"}},
+		}},
+		mockllm.Say("Got it, Ivan: I'll remember that you're responsible for the prod cluster."),
+	)
+}
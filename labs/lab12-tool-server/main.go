@@ -4,10 +4,14 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"expvar"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"os/exec"
+
+	"github.com/kshvakov/agent/pkg/schema"
 )
 
 // ToolRequest represents a tool execution request
@@ -19,9 +23,10 @@ type ToolRequest struct {
 
 // ToolResponse represents a response from tool server
 type ToolResponse struct {
-	Success bool   `json:"success"`
-	Result  string `json:"result"`
-	Error   string `json:"error,omitempty"`
+	Success     bool   `json:"success"`
+	Result      string `json:"result"`
+	Error       string `json:"error,omitempty"`
+	Deprecation string `json:"deprecation,omitempty"` // Set when a deprecated tool name was called
 }
 
 // ToolDefinition represents a tool definition
@@ -31,6 +36,81 @@ type ToolDefinition struct {
 	CompatibleWith []string        `json:"compatible_with"`
 	Description    string          `json:"description"`
 	Parameters     json.RawMessage `json:"parameters"`
+	Deprecated     bool            `json:"deprecated,omitempty"`
+	ReplacedBy     string          `json:"replaced_by,omitempty"` // Name of the tool to use instead
+}
+
+// deprecatedCalls counts calls to deprecated tools by name.
+// expvar publishes it at /debug/vars when the HTTP server uses the default mux.
+var deprecatedCalls = expvar.NewMap("deprecated_tool_calls")
+
+// deprecatedAlias registers an old tool name as a deprecated alias of a new tool.
+// The alias keeps the same contract, so existing agents keep working while they migrate.
+func deprecatedAlias(oldName string, replacement *ToolDefinition) *ToolDefinition {
+	alias := *replacement
+	alias.Name = oldName
+	alias.Description = fmt.Sprintf("DEPRECATED: use %s instead. %s", replacement.Name, replacement.Description)
+	alias.Deprecated = true
+	alias.ReplacedBy = replacement.Name
+	return &alias
+}
+
+// deprecationNote is the message returned to the model alongside the result.
+func deprecationNote(tool *ToolDefinition) string {
+	if tool.ReplacedBy == "" {
+		return fmt.Sprintf("tool %q is deprecated and will be removed", tool.Name)
+	}
+	return fmt.Sprintf("tool %q is deprecated, call %q instead", tool.Name, tool.ReplacedBy)
+}
+
+// validateArguments checks the arguments against the tool's published schema,
+// so a malformed call is rejected before it reaches the tool.
+func validateArguments(tool *ToolDefinition, arguments json.RawMessage) error {
+	if len(tool.Parameters) == 0 {
+		return nil
+	}
+	s, err := schema.Parse(tool.Parameters)
+	if err != nil {
+		return fmt.Errorf("tool %s: %w", tool.Name, err)
+	}
+	return s.Validate(arguments)
+}
+
+// handleRequest resolves the tool, checks the version and arguments, and executes it.
+// Deprecated tools still run (via their replacement), but the response
+// carries a note so the model can switch to the new name.
+func handleRequest(tools map[string]*ToolDefinition, req ToolRequest) ToolResponse {
+	tool, ok := tools[req.Tool]
+	if !ok {
+		return ToolResponse{Success: false, Error: fmt.Sprintf("unknown tool: %s", req.Tool)}
+	}
+	if !checkVersionCompatibility(tool, req.Version) {
+		return ToolResponse{Success: false, Error: fmt.Sprintf("tool %s: version %s is not compatible", req.Tool, req.Version)}
+	}
+	if err := validateArguments(tool, req.Arguments); err != nil {
+		return ToolResponse{Success: false, Error: err.Error()}
+	}
+
+	var resp ToolResponse
+	name := tool.Name
+	if tool.Deprecated {
+		deprecatedCalls.Add(tool.Name, 1)
+		// log writes to stderr, so it doesn't break the stdio protocol on stdout.
+		log.Printf("deprecated tool called: %s (replaced by %q)", tool.Name, tool.ReplacedBy)
+		resp.Deprecation = deprecationNote(tool)
+		if tool.ReplacedBy != "" {
+			name = tool.ReplacedBy
+		}
+	}
+
+	result, err := executeTool(name, req.Arguments)
+	if err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+	resp.Success = true
+	resp.Result = result
+	return resp
 }
 
 // TODO 1: Implement stdio protocol for tool server
@@ -51,10 +131,9 @@ func (s *StdioToolServer) RegisterTool(tool *ToolDefinition) {
 
 func (s *StdioToolServer) Start() error {
 	// TODO: Read requests from stdin (JSON)
-	// TODO: Check version
-	// TODO: Execute tool
+	// TODO: Check version and execute tool — handleRequest(s.tools, req) does both
 	// TODO: Write response to stdout (JSON)
-	
+
 	return fmt.Errorf("not implemented")
 }
 
@@ -76,9 +155,9 @@ func (s *HTTPToolServer) RegisterTool(tool *ToolDefinition) {
 
 func (s *HTTPToolServer) Start(port string) error {
 	// TODO: Create HTTP endpoint POST /execute
-	// TODO: Handle request
+	// TODO: Handle request with handleRequest(s.tools, req)
 	// TODO: Return JSON response
-	
+
 	return fmt.Errorf("not implemented")
 }
 
@@ -87,14 +166,16 @@ func checkVersionCompatibility(tool *ToolDefinition, requestedVersion string) bo
 	// TODO: Check if requested version is compatible
 	// TODO: Consider CompatibleWith field
 	// TODO: Return true if compatible
-	
+
 	return false
 }
 
 // TODO 4: Implement tool client for agent
 // Client for calling tool server via protocol
 type ToolClient interface {
-	CallTool(tool string, version string, arguments json.RawMessage) (string, error)
+	// CallTool gives up when ctx is done: a Ctrl+C must not wait for a
+	// hung tool server.
+	CallTool(ctx context.Context, tool string, version string, arguments json.RawMessage) (string, error)
 }
 
 type StdioToolClient struct {
@@ -104,15 +185,15 @@ type StdioToolClient struct {
 func NewStdioToolClient(serverPath string) (*StdioToolClient, error) {
 	// TODO: Start tool server as separate process
 	// TODO: Configure stdin/stdout for communication
-	
+
 	return nil, fmt.Errorf("not implemented")
 }
 
-func (c *StdioToolClient) CallTool(tool string, version string, arguments json.RawMessage) (string, error) {
+func (c *StdioToolClient) CallTool(ctx context.Context, tool string, version string, arguments json.RawMessage) (string, error) {
 	// TODO: Send request to tool server via stdin
-	// TODO: Read response from stdout
+	// TODO: Read response from stdout; return ctx.Err() if ctx is done first
 	// TODO: Return result
-	
+
 	return "", fmt.Errorf("not implemented")
 }
 
@@ -128,11 +209,11 @@ func NewHTTPToolClient(baseURL string) *HTTPToolClient {
 	}
 }
 
-func (c *HTTPToolClient) CallTool(tool string, version string, arguments json.RawMessage) (string, error) {
-	// TODO: Send HTTP POST request
+func (c *HTTPToolClient) CallTool(ctx context.Context, tool string, version string, arguments json.RawMessage) (string, error) {
+	// TODO: Send HTTP POST request with ctx (http.NewRequestWithContext)
 	// TODO: Handle response
 	// TODO: Return result
-	
+
 	return "", fmt.Errorf("not implemented")
 }
 
@@ -141,7 +222,7 @@ func executeTool(toolName string, arguments json.RawMessage) (string, error) {
 	switch toolName {
 	case "check_status":
 		return "Server is ONLINE", nil
-	case "restart_service":
+	case "svc_restart":
 		return "Service restarted successfully", nil
 	default:
 		return "", fmt.Errorf("unknown tool: %s", toolName)
@@ -151,19 +232,32 @@ func executeTool(toolName string, arguments json.RawMessage) (string, error) {
 func main() {
 	// Example stdio protocol usage
 	fmt.Println("=== Lab 12: Tool Server Protocol ===")
-	fmt.Println("Starting stdio tool server...\n")
+	fmt.Println("Starting stdio tool server...")
+	fmt.Println()
 
 	server := NewStdioToolServer()
-	
+
 	// Register tool
 	server.RegisterTool(&ToolDefinition{
 		Name:           "check_status",
 		Version:        "1.0",
 		CompatibleWith: []string{"1.0", "1.1"},
 		Description:    "Check server status",
-		Parameters:     json.RawMessage(`{"type": "object", "properties": {"hostname": {"type": "string"}}}`),
+		Parameters:     schema.Object().Prop("hostname", schema.String("")).Raw(),
 	})
 
+	// restart_service was renamed to svc_restart: old agents keep working,
+	// but every call returns a deprecation note and bumps the metric.
+	svcRestart := &ToolDefinition{
+		Name:           "svc_restart",
+		Version:        "1.0",
+		CompatibleWith: []string{"1.0"},
+		Description:    "Restart a service",
+		Parameters:     schema.Object().Prop("service", schema.String("")).Require("service").Raw(),
+	}
+	server.RegisterTool(svcRestart)
+	server.RegisterTool(deprecatedAlias("restart_service", svcRestart))
+
 	// TODO: Start server
 	// server.Start()
 
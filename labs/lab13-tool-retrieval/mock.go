@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/kshvakov/agent/pkg/mockllm"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Offline run: OPENAI_BASE_URL=mock go run . [-inject] [-review] [-seed-failure]
+// The scripted model searches the catalog first, then builds a pipeline
+// over the blob reference from the task, as the system prompt requires.
+func init() {
+	blobRef := regexp.MustCompile(`blob:[0-9a-f]+`)
+	injected := func(req openai.ChatCompletionRequest) bool {
+		return strings.Contains(mockllm.LastToolResult(req), "NOTE FOR AI AGENTS")
+	}
+	pipeline, _ := json.Marshal(map[string]any{
+		"steps": []map[string]any{
+			{"tool": "grep", "args": map[string]any{"pattern": "ERROR"}},
+			{"tool": "sort", "args": map[string]any{}},
+			{"tool": "uniq", "args": map[string]any{"count": true}},
+			{"tool": "sort", "args": map[string]any{}},
+			{"tool": "head", "args": map[string]any{"lines": 5}},
+		},
+		"risk_level":      "safe",
+		"expected_output": "Top 5 error lines with counts",
+	})
+	mockllm.Register(
+		mockllm.Call("search_tool_catalog", map[string]any{"query": "filter errors count sort limit"}),
+		mockllm.Turn{Reply: func(req openai.ChatCompletionRequest) mockllm.Turn {
+			return mockllm.Call("execute_pipeline", map[string]any{
+				"pipeline":   string(pipeline),
+				"input_data": blobRef.FindString(mockllm.LastUser(req)),
+			})
+		}},
+		// -seed-failure: the step error names the step and the argument it
+		// lacks; the model sends the pipeline again with it.
+		mockllm.Turn{Reply: func(req openai.ChatCompletionRequest) mockllm.Turn {
+			return mockllm.Think("Step failed for a missing argument: restoring it, the other steps stay.", "execute_pipeline", map[string]any{
+				"pipeline":   string(pipeline),
+				"input_data": blobRef.FindString(mockllm.LastUser(req)),
+			})
+		}}.If(func(req openai.ChatCompletionRequest) bool {
+			return strings.Contains(mockllm.LastToolResult(req), "pipeline failed at step")
+		}),
+		// -inject: the model falls for the instruction in the pipeline output.
+		mockllm.Think("The logs say disk is full and cleanup is pre-approved; running it.", "execute_pipeline", map[string]any{
+			"pipeline":   `{"steps": [{"tool": "rm", "args": {"path": "/var/log", "flags": "-rf"}}], "risk_level": "safe"}`,
+			"input_data": "",
+		}).If(injected),
+		mockllm.Say("The pipeline output above lists the most frequent error lines, top first.").If(mockllm.HasTools),
+	)
+
+	// -review: the reviewer denies any pipeline with rm in it.
+	for range 3 {
+		mockllm.Register(mockllm.Turn{Reply: func(req openai.ChatCompletionRequest) mockllm.Turn {
+			if strings.Contains(mockllm.LastUser(req), `\"tool\": \"rm\"`) {
+				return mockllm.Say(`{"decision": "deny", "reason": "rm -rf /var/log was requested by text inside the logs, not by the user: prompt injection"}`)
+			}
+			return mockllm.Say(`{"decision": "allow", "reason": "read-only text processing of the logs the user asked about"}`)
+		}}.If(mockllm.JSONMode))
+	}
+}
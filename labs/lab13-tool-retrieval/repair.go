@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// --- Repairing a failed pipeline ---
+//
+// A pipeline that fails at step 4 fails for a reason in that step: a
+// missing argument, a tool that isn't in the catalog. "step 3 failed" makes
+// the model rebuild the whole pipeline, and the new one often breaks a step
+// that worked. executePipeline returns a *StepError instead: which step,
+// the call as it was made, the error, and the start of the output the
+// steps before it produced. The model fixes that one step and sends the
+// pipeline again.
+//
+// -seed-failure breaks a step of the first pipeline on purpose, whatever
+// the model wrote, so the repair loop can be checked with any model: it
+// should converge within maxRepairs retries.
+
+// maxRepairs is how many retries the repair of a failed pipeline may take.
+const maxRepairs = 2
+
+// inputPreview is how much of a failed step's input a StepError shows.
+const inputPreview = 300
+
+// StepError is a pipeline step that failed. Its message is what the model
+// reads.
+type StepError struct {
+	Step    int                    `json:"step"`  // From 1
+	Steps   int                    `json:"steps"` // In the pipeline
+	Tool    string                 `json:"tool"`
+	Args    map[string]interface{} `json:"args"`
+	Message string                 `json:"error"`
+	Input   string                 `json:"input"` // Start of the output of the steps before it
+}
+
+func (e *StepError) Error() string {
+	details, _ := json.MarshalIndent(e, "", "  ")
+	worked := ""
+	if e.Step > 1 {
+		worked = fmt.Sprintf(", steps 1-%d worked", e.Step-1)
+	}
+	return fmt.Sprintf("pipeline failed at step %d of %d (%s)%s. Fix this step and send the whole pipeline again.\n%s",
+		e.Step, e.Steps, e.Tool, worked, details)
+}
+
+// stepError describes step i (from 0) of p, which failed with err on input.
+func stepError(p Pipeline, i int, err error, input string) *StepError {
+	if len(input) > inputPreview {
+		input = input[:inputPreview] + "..."
+	}
+	return &StepError{
+		Step:    i + 1,
+		Steps:   len(p.Steps),
+		Tool:    p.Steps[i].Tool,
+		Args:    p.Steps[i].Args,
+		Message: err.Error(),
+		Input:   input,
+	}
+}
+
+// seedFailure drops the arguments of the first step that needs them (grep,
+// head) and returns the pipeline and that step, from 1; 0 if no step needs
+// arguments or pipelineJSON doesn't parse.
+func seedFailure(pipelineJSON string) (string, int) {
+	var p Pipeline
+	if err := json.Unmarshal([]byte(pipelineJSON), &p); err != nil {
+		return pipelineJSON, 0
+	}
+	for i, step := range p.Steps {
+		if step.Tool == "grep" || step.Tool == "head" {
+			p.Steps[i].Args = map[string]interface{}{}
+			broken, err := json.Marshal(p)
+			if err != nil {
+				return pipelineJSON, 0
+			}
+			return string(broken), i + 1
+		}
+	}
+	return pipelineJSON, 0
+}
+
+// repairs follows the execute_pipeline calls of a run.
+type repairs struct {
+	calls  int
+	ranOn  int // The call that first ran the pipeline through, from 1; 0 if none did
+	seeded int // The step -seed-failure broke, from 1
+}
+
+// verdict says whether the seeded failure was repaired within maxRepairs
+// retries, for -seed-failure.
+func (r *repairs) verdict() (string, bool) {
+	switch {
+	case r.seeded == 0:
+		return "no step to break: the first pipeline had no grep or head", false
+	case r.ranOn == 0:
+		return fmt.Sprintf("not repaired: %d calls, none ran through", r.calls), false
+	case r.ranOn-1 > maxRepairs:
+		return fmt.Sprintf("repaired on retry %d, later than the limit of %d", r.ranOn-1, maxRepairs), false
+	}
+	return fmt.Sprintf("repaired on retry %d (limit %d)", r.ranOn-1, maxRepairs), true
+}
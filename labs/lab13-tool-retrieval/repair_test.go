@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kshvakov/agent/pkg/mockllm"
+	"github.com/sashabaranov/go-openai"
+)
+
+// pipelineOrSkip runs executePipeline and skips the test while it is still
+// the TODO of the exercise.
+func pipelineOrSkip(t *testing.T, pipelineJSON, input string) (string, error) {
+	t.Helper()
+	result, err := executePipeline(pipelineJSON, input)
+	if err != nil && err.Error() == "not implemented" {
+		t.Skip("executePipeline is not implemented yet (main.go)")
+	}
+	return result, err
+}
+
+// TestSeededFailureRepaired plays the -seed-failure run against the lab's
+// mock model: the first pipeline loses the arguments of a step, the model
+// gets the *StepError back and must send a pipeline that runs within
+// maxRepairs retries.
+func TestSeededFailureRepaired(t *testing.T) {
+	s := mockllm.Start(mockllm.Registered())
+	defer s.Close()
+	cfg := openai.DefaultConfig("mock")
+	cfg.BaseURL = s.BaseURL()
+	client := openai.NewClientWithConfig(cfg)
+
+	const logsRef = "blob:0123456789abcdef"
+	defs := []openai.Tool{
+		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "search_tool_catalog"}},
+		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "execute_pipeline"}},
+	}
+	messages := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "Find top 5 most frequent error lines from the logs\n\nLogs: " + logsRef},
+	}
+
+	calls, ranOn := 0, 0
+	for turn := 0; ranOn == 0 && turn < 2+maxRepairs+1; turn++ {
+		resp, err := client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+			Model:    "gpt-4o-mini",
+			Messages: messages,
+			Tools:    defs,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := resp.Choices[0].Message
+		if len(msg.ToolCalls) == 0 {
+			t.Fatalf("the model answered before the pipeline ran: %q", msg.Content)
+		}
+		messages = append(messages, msg)
+		for _, tc := range msg.ToolCalls {
+			content := "Found 4 relevant tools: grep, sort, uniq, head"
+			if tc.Function.Name == "execute_pipeline" {
+				content = runPipelineCall(t, tc, logsRef, &calls, &ranOn)
+			}
+			messages = append(messages, openai.ChatCompletionMessage{
+				Role: openai.ChatMessageRoleTool, Content: content, ToolCallID: tc.ID,
+			})
+		}
+	}
+	if ranOn == 0 {
+		t.Fatalf("not repaired: %d execute_pipeline calls, none ran through", calls)
+	}
+	if retries := ranOn - 1; retries == 0 || retries > maxRepairs {
+		t.Errorf("pipeline ran on retry %d, want 1..%d", retries, maxRepairs)
+	}
+}
+
+// runPipelineCall executes one execute_pipeline call the way the lab's tool
+// does, seeding the failure into the first one, and returns the tool result.
+func runPipelineCall(t *testing.T, tc openai.ToolCall, logsRef string, calls, ranOn *int) string {
+	t.Helper()
+	var args struct {
+		Pipeline  string `json:"pipeline"`
+		InputData string `json:"input_data"`
+	}
+	if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
+		t.Fatalf("execute_pipeline arguments: %v", err)
+	}
+	if args.InputData != logsRef {
+		t.Errorf("input_data = %q, want %q", args.InputData, logsRef)
+	}
+	*calls++
+	pipeline, seeded := args.Pipeline, 0
+	if *calls == 1 {
+		pipeline, seeded = seedFailure(args.Pipeline)
+		if seeded == 0 {
+			t.Fatalf("no step to break in %s", args.Pipeline)
+		}
+	}
+	result, err := pipelineOrSkip(t, pipeline, sampleLogs)
+	if seeded > 0 {
+		var failed *StepError
+		if !errors.As(err, &failed) {
+			t.Fatalf("seeded pipeline: got %v, want a *StepError", err)
+		}
+		if failed.Step != seeded {
+			t.Errorf("StepError.Step = %d, want the seeded step %d", failed.Step, seeded)
+		}
+	}
+	if err != nil {
+		return "Error: " + err.Error()
+	}
+	*ranOn = *calls
+	return result
+}
+
+// TestStepErrorFields checks what a failed step reports: the step, the call
+// as it was made, the error, and the output of the steps before it.
+func TestStepErrorFields(t *testing.T) {
+	logs := "b ERROR disk\nINFO ok\na ERROR db\nc WARN cpu"
+	tests := []struct {
+		name     string
+		pipeline string
+		step     int
+		tool     string
+		args     map[string]interface{}
+		message  string
+		input    string
+	}{
+		{
+			name:     "missing argument",
+			pipeline: `{"steps": [{"tool": "grep", "args": {"pattern": "ERROR"}}, {"tool": "sort", "args": {}}, {"tool": "head", "args": {"count": 1}}], "risk_level": "safe"}`,
+			step:     3,
+			tool:     "head",
+			args:     map[string]interface{}{"count": float64(1)},
+			message:  "head: missing argument 'lines'",
+			input:    "a ERROR db\nb ERROR disk",
+		},
+		{
+			name:     "unknown tool",
+			pipeline: `{"steps": [{"tool": "grep", "args": {"pattern": "WARN"}}, {"tool": "awk", "args": {"program": "{print $1}"}}], "risk_level": "safe"}`,
+			step:     2,
+			tool:     "awk",
+			args:     map[string]interface{}{"program": "{print $1}"},
+			message:  `unknown tool "awk"`,
+			input:    "c WARN cpu",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := pipelineOrSkip(t, tt.pipeline, logs)
+			var failed *StepError
+			if !errors.As(err, &failed) {
+				t.Fatalf("got %v, want a *StepError", err)
+			}
+			if failed.Step != tt.step || failed.Tool != tt.tool {
+				t.Errorf("failed at step %d (%s), want %d (%s)", failed.Step, failed.Tool, tt.step, tt.tool)
+			}
+			if len(failed.Args) != len(tt.args) {
+				t.Errorf("Args = %v, want %v", failed.Args, tt.args)
+			}
+			for k, v := range tt.args {
+				if failed.Args[k] != v {
+					t.Errorf("Args[%q] = %v, want %v", k, failed.Args[k], v)
+				}
+			}
+			if !strings.Contains(failed.Message, tt.message) {
+				t.Errorf("Message = %q, want it to contain %q", failed.Message, tt.message)
+			}
+			if strings.TrimSpace(failed.Input) != tt.input {
+				t.Errorf("Input = %q, want the output of the steps before: %q", failed.Input, tt.input)
+			}
+			if !strings.Contains(err.Error(), "Fix this step") {
+				t.Errorf("error text doesn't ask to fix the step: %s", err)
+			}
+		})
+	}
+}
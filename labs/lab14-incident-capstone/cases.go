@@ -0,0 +1,134 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/normalize"
+)
+
+// --- Past incidents (case-based reasoning) ---
+//
+// A lesson is what the model chose to write down. A case is what happened:
+// every resolved run is recorded by the program, not the model, with the
+// alert, the symptoms the agent saw, the root cause it named, the actions
+// that fixed it, and how long that took. On a new alert the most similar
+// cases go into the plan and the loop before anything is checked, so a
+// repeated incident is recognized instead of investigated from scratch.
+
+// Case is one resolved incident.
+type Case struct {
+	ID        string        `json:"id"` // The run ID: runs/<id>/ has the transcript
+	Alert     string        `json:"alert"`
+	Symptoms  []string      `json:"symptoms"`   // HTTP status and log errors, without timestamps
+	RootCause string        `json:"root_cause"` // The agent's lesson, or its final answer
+	Fix       []string      `json:"fix"`        // The actions, in order
+	Resolved  time.Duration `json:"resolved"`   // Simulated time from the alert to the fix
+	ToolCalls int           `json:"tool_calls"`
+	At        time.Time     `json:"at"`
+	Seen      int           `json:"seen"` // Runs that ended with these symptoms and this fix
+}
+
+// sameCase reports whether a and b are one incident seen twice: the same
+// symptoms, fixed the same way.
+func sameCase(a, b Case) bool {
+	return slices.Equal(a.Symptoms, b.Symptoms) && slices.Equal(a.Fix, b.Fix)
+}
+
+// similarCase is a recalled case and how close it is to the new alert,
+// from 0 to 1.
+type similarCase struct {
+	Case
+	Score float64
+}
+
+// caseThreshold is the lowest similarity worth showing the model: a case
+// that shares a word or two with the alert is noise, not experience.
+const caseThreshold = 0.3
+
+// actionTools change the service: a case's fix is the calls of these.
+var actionTools = []string{"backup_db", "restart_service", "rollback_deploy"}
+
+// similarity is the share of the alert's words found in the case's alert
+// and symptoms. Word overlap needs no embeddings, so it works offline and
+// with any provider; Lab 07 shows how to do it with vectors.
+func similarity(alert string, c Case) float64 {
+	query := caseWords(alert)
+	if len(query) == 0 {
+		return 0
+	}
+	known := caseWords(c.Alert + " " + strings.Join(c.Symptoms, " "))
+	hits := 0
+	for w := range query {
+		if known[w] {
+			hits++
+		}
+	}
+	return float64(hits) / float64(len(query))
+}
+
+func caseWords(text string) map[string]bool {
+	words := map[string]bool{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(normalize.Text(text)), func(r rune) bool {
+		return !('a' <= r && r <= 'z' || '0' <= r && r <= '9' || r == '.' || r == '_')
+	}) {
+		if len(w) > 2 {
+			words[w] = true
+		}
+	}
+	return words
+}
+
+// rankCases returns up to n cases at least caseThreshold similar to the
+// alert, the closest first; of equally close ones, the newest.
+func rankCases(cases []Case, alert string, n int) []similarCase {
+	var found []similarCase
+	for _, c := range cases {
+		if s := similarity(alert, c); s >= caseThreshold {
+			found = append(found, similarCase{c, s})
+		}
+	}
+	slices.SortFunc(found, func(a, b similarCase) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), b.At.Compare(a.At))
+	})
+	return found[:min(len(found), n)]
+}
+
+// formatCases renders recalled cases for the prompt. The model is told to
+// confirm the symptoms first: the same alert can have another cause.
+func formatCases(cases []similarCase) string {
+	var b strings.Builder
+	b.WriteString("Similar past incidents (confirm the symptoms before you reuse a fix):\n")
+	for i, c := range cases {
+		seen := ""
+		if c.Seen > 1 {
+			seen = fmt.Sprintf("; seen %d times", c.Seen)
+		}
+		fmt.Fprintf(&b, "%d. [%.0f%% similar, run %s] Alert: %s\n   Symptoms: %s\n   Root cause: %s\n   Fix: %s (resolved in %s, %d tool calls%s)\n",
+			i+1, c.Score*100, c.ID, c.Alert, strings.Join(c.Symptoms, "; "), c.RootCause,
+			strings.Join(c.Fix, " → "), c.Resolved, c.ToolCalls, seen)
+	}
+	return b.String()
+}
+
+// symptomsOf extracts the symptoms from an observation: the HTTP status,
+// or the distinct error messages of the logs.
+func symptomsOf(tool, result string) []string {
+	switch tool {
+	case "check_http":
+		return []string{"HTTP " + result}
+	case "read_logs":
+		var errs []string
+		for _, line := range strings.Split(result, "\n") {
+			_, msg, ok := strings.Cut(line, " ERROR ")
+			if ok && !slices.Contains(errs, msg) {
+				errs = append(errs, msg)
+			}
+		}
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/simclock"
+)
+
+// --- Environment (lab06 simulator, extended) ---
+//
+// The payment service runs on a simulated clock: every tool call takes time,
+// and the payment backlog grows every minute the service is down.
+
+// env is the state of the simulated infrastructure.
+type env struct {
+	clock     *simclock.Sim
+	startedAt time.Time
+
+	scenario string
+	status   string // "failed" | "running"
+	config   string // "bad" | "good"
+	version  string
+	backedUp bool // backup_db was run since the incident started
+	backlog  int  // Payments queued while the service is down
+}
+
+// toolDurations is how long each action takes in simulated time.
+var toolDurations = map[string]time.Duration{
+	"check_http":      10 * time.Second,
+	"read_logs":       30 * time.Second,
+	"analyze_logs":    20 * time.Second,
+	"backup_db":       3 * time.Minute,
+	"restart_service": time.Minute,
+	"rollback_deploy": 2 * time.Minute,
+}
+
+// newEnv prepares the scenario.
+//   - "config":  a bad deploy broke the config; restart won't help, rollback will
+//     (and policy requires a backup first).
+//   - "network": the database connection pool is exhausted; a restart fixes it.
+func newEnv(scenario string) (*env, error) {
+	clock := simclock.New(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	e := &env{clock: clock, startedAt: clock.Now(), scenario: scenario, status: "failed", version: "v2.0"}
+	switch scenario {
+	case "config":
+		e.config = "bad"
+	case "network":
+		e.config = "good"
+	default:
+		return nil, fmt.Errorf("unknown scenario %q (want config or network)", scenario)
+	}
+	clock.Every(time.Minute, func() {
+		if e.status != "running" {
+			e.backlog += 120
+		}
+	})
+	return e, nil
+}
+
+// advance moves the clock by the duration of the tool and returns
+// the timestamp prefix for its result.
+func (e *env) advance(tool string) string {
+	e.clock.Advance(toolDurations[tool])
+	return e.clock.Now().Format("15:04:05")
+}
+
+func (e *env) checkHTTP() string {
+	if e.status == "running" {
+		return "200 OK"
+	}
+	return "502 Bad Gateway"
+}
+
+// readLogs returns the last few hundred lines of service logs. They are far too
+// long for the context; the caller parks them in the blob store.
+func (e *env) readLogs() string {
+	var b strings.Builder
+	t := e.startedAt.Add(-10 * time.Minute)
+	for i := 0; i < 400; i++ {
+		t = t.Add(1500 * time.Millisecond)
+		ts := t.Format("2006-01-02 15:04:05")
+		switch {
+		case e.status == "running":
+			fmt.Fprintf(&b, "%s INFO request processed in %dms\n", ts, 20+i%30)
+		case i%7 == 0:
+			fmt.Fprintf(&b, "%s WARN slow upstream response from fraud-check\n", ts)
+		case i%5 == 0 && e.config == "bad":
+			fmt.Fprintf(&b, "%s ERROR config: syntax error in payment.yaml line 42: unexpected token\n", ts)
+		case i%5 == 0:
+			fmt.Fprintf(&b, "%s ERROR db: connection pool exhausted (max=50)\n", ts)
+		case i%11 == 0:
+			fmt.Fprintf(&b, "%s ERROR http: upstream connect timeout\n", ts)
+		default:
+			fmt.Fprintf(&b, "%s INFO healthcheck from lb-%d\n", ts, i%3)
+		}
+	}
+	return b.String()
+}
+
+func (e *env) backupDB() string {
+	e.backedUp = true
+	return "Backup completed: payments-2024-01-01.dump"
+}
+
+func (e *env) restartService() string {
+	if e.config == "bad" {
+		return "Failed to start service. Exit code 1 (Config Error)."
+	}
+	e.status = "running"
+	return "Service restarted. Status: Active."
+}
+
+func (e *env) rollback() string {
+	if !e.backedUp {
+		// Policy from the knowledge base: no rollback without a fresh backup.
+		return "REFUSED: rollback requires a database backup taken during this incident (policy #12)."
+	}
+	e.config = "good"
+	e.version = "v1.9"
+	e.status = "running"
+	return "Rollback complete. Version is now v1.9. Service is Active."
+}
+
+// summary is printed when the run ends.
+func (e *env) summary() string {
+	return fmt.Sprintf("simulated time: %s, payment backlog: %d, service: %s (%s)",
+		e.clock.Since(e.startedAt), e.backlog, e.status, e.version)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Long-term memory (lab11) ---
+//
+// Lessons from past incidents survive between runs in a JSON file.
+// The agent manages them itself through memory_save / memory_recall.
+// The same file keeps the resolved incidents (cases.go), which the
+// program records.
+
+// Note is one record in long-term memory.
+type Note struct {
+	Key       string    `json:"key"`
+	Value     string    `json:"value"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// memoryStore is the lab11 FileStore, solved.
+type memoryStore struct {
+	mu    sync.Mutex
+	path  string
+	notes []Note
+	cases []Case
+}
+
+// memoryFile is the file format. A file with a bare list of notes, as
+// written before cases, is read too.
+type memoryFile struct {
+	Notes []Note `json:"notes"`
+	Cases []Case `json:"cases,omitempty"`
+}
+
+func openMemory(path string) (*memoryStore, error) {
+	m := &memoryStore{path: path}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		return m, json.Unmarshal(data, &m.notes)
+	}
+	var f memoryFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	m.notes, m.cases = f.Notes, f.Cases
+	return m, nil
+}
+
+// Save upserts a note by key.
+func (m *memoryStore) Save(key, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	note := Note{Key: key, Value: value, CreatedAt: time.Now().UTC()}
+	for i := range m.notes {
+		if m.notes[i].Key == key {
+			m.notes[i] = note
+			return m.flush()
+		}
+	}
+	m.notes = append(m.notes, note)
+	return m.flush()
+}
+
+// Recall returns up to 5 notes that contain any word of the query.
+func (m *memoryStore) Recall(query string) []Note {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	words := strings.Fields(strings.ToLower(query))
+	var found []Note
+	for _, n := range m.notes {
+		text := strings.ToLower(n.Key + " " + n.Value)
+		for _, w := range words {
+			if len(w) > 2 && strings.Contains(text, w) {
+				found = append(found, n)
+				break
+			}
+		}
+		if len(found) == 5 {
+			break
+		}
+	}
+	return found
+}
+
+// SaveCase records a resolved incident. One seen before replaces its
+// older record and counts the times: the newest run is the one to follow.
+func (m *memoryStore) SaveCase(c Case) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c.Seen = 1
+	for i := range m.cases {
+		if sameCase(m.cases[i], c) {
+			c.Seen += m.cases[i].Seen
+			m.cases[i] = c
+			return m.flush()
+		}
+	}
+	m.cases = append(m.cases, c)
+	return m.flush()
+}
+
+// SimilarCases returns up to n past incidents similar to alert, the
+// closest first.
+func (m *memoryStore) SimilarCases(alert string, n int) []similarCase {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return rankCases(m.cases, alert, n)
+}
+
+func (m *memoryStore) flush() error {
+	data, err := json.MarshalIndent(memoryFile{Notes: m.notes, Cases: m.cases}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(m.path, data, 0o644)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/kshvakov/agent/pkg/mockllm"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Offline run: OPENAI_BASE_URL=mock go run . [-scenario network]
+// Both scenarios get the same alert, so the scripted model branches on what
+// the logs showed: a config error means backup and rollback (policy #12),
+// an exhausted connection pool means a restart. With past incidents in the
+// task (the second run on the same memory file) it skips the analysis and
+// the runbook search: the logs confirm a known case and its fix is reused.
+func init() {
+	blobRef := regexp.MustCompile(`blob:[0-9a-f]+`)
+	seen := func(text string) func(openai.ChatCompletionRequest) bool {
+		return func(req openai.ChatCompletionRequest) bool {
+			for _, m := range req.Messages {
+				if m.Role == openai.ChatMessageRoleTool && strings.Contains(m.Content, text) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	loop := mockllm.HasTools
+	badConfig := mockllm.All(loop, seen("ERROR config: syntax error"))
+	pool := mockllm.All(loop, seen("ERROR db: connection pool"))
+	report := func(req openai.ChatCompletionRequest) bool { return !mockllm.HasTools(req) && !mockllm.JSONMode(req) }
+	// A known case: the task recalls an incident with the symptoms the
+	// logs show now.
+	knownConfig := mockllm.All(badConfig, mockllm.Mentions("syntax error in payment.yaml"))
+	knownPool := mockllm.All(pool, mockllm.Mentions("connection pool exhausted"))
+	fresh := func(req openai.ChatCompletionRequest) bool { return !knownConfig(req) && !knownPool(req) }
+
+	mockllm.Register(
+		mockllm.Say(`{"goal": "check_http returns 200 OK", "steps": [
+  {"id": "1", "description": "Confirm the outage", "tool": "check_http"},
+  {"id": "2", "description": "Read the logs and compare them with the past incidents", "tool": "read_logs"},
+  {"id": "3", "description": "If they match, apply the fix of that incident"},
+  {"id": "4", "description": "Verify", "tool": "check_http"},
+  {"id": "5", "description": "Save the lesson", "tool": "memory_save"}
+]}`).If(mockllm.All(mockllm.JSONMode, mockllm.Mentions("Similar past incidents"))),
+		mockllm.Say(`{"goal": "check_http returns 200 OK", "steps": [
+  {"id": "1", "description": "Confirm the outage", "tool": "check_http"},
+  {"id": "2", "description": "Read the logs", "tool": "read_logs"},
+  {"id": "3", "description": "Find the most frequent errors", "tool": "analyze_logs"},
+  {"id": "4", "description": "Look up the runbook for the root cause", "tool": "search_knowledge_base"},
+  {"id": "5", "description": "Apply the fix the runbook prescribes"},
+  {"id": "6", "description": "Verify", "tool": "check_http"},
+  {"id": "7", "description": "Save the lesson", "tool": "memory_save"}
+]}`).If(mockllm.JSONMode),
+
+		mockllm.Think("Step 1: confirming the outage.", "check_http", nil).If(loop),
+		mockllm.Think("Step 2: reading the logs.", "read_logs", nil).If(loop),
+		mockllm.Turn{Reply: func(req openai.ChatCompletionRequest) mockllm.Turn {
+			return mockllm.Think("The logs are parked; analyzing them by reference.", "analyze_logs", map[string]any{
+				"input": blobRef.FindString(mockllm.LastToolResult(req)),
+				"steps": []map[string]any{
+					{"tool": "grep", "args": map[string]any{"pattern": "ERROR"}},
+					{"tool": "cut"}, {"tool": "sort"}, {"tool": "uniq"},
+					{"tool": "head", "args": map[string]any{"lines": 3}},
+				},
+			})
+		}}.If(mockllm.All(loop, fresh)),
+		mockllm.Call("search_knowledge_base", map[string]any{"query": "payment 502 config rollback policy"}).If(mockllm.All(badConfig, fresh)),
+		mockllm.Call("search_knowledge_base", map[string]any{"query": "payment 502 connection pool restart"}).If(mockllm.All(pool, fresh)),
+
+		// A known case: no analysis and no runbook search, its fix again
+		mockllm.Think("The logs match a past incident with a config syntax error: reusing its fix, backup first (policy #12).", "backup_db", nil).If(knownConfig),
+		mockllm.Think("The logs match a past incident with an exhausted connection pool: reusing its fix.", "restart_service", nil).If(knownPool),
+
+		// config: policy #12 requires a backup before the rollback
+		mockllm.Think("Config error: restart won't help. Policy #12: backup first.", "backup_db", nil).If(mockllm.All(badConfig, fresh)),
+		mockllm.Think("Backup done, rolling back.", "rollback_deploy", nil).If(badConfig),
+		// network: the pool is exhausted, a restart fixes it
+		mockllm.Think("Connection pool exhausted: restarting per the runbook.", "restart_service", nil).If(mockllm.All(pool, fresh)),
+
+		mockllm.Think("Verifying.", "check_http", nil).If(loop),
+		mockllm.Call("memory_save", map[string]any{
+			"key":   "payment-502-bad-config",
+			"value": "Payment 502 after deploy with config syntax errors in logs: backup_db, then rollback_deploy (policy #12).",
+		}).If(badConfig),
+		mockllm.Call("memory_save", map[string]any{
+			"key":   "payment-502-db-pool",
+			"value": "Payment 502 with 'connection pool exhausted' in logs: restart_service fixes it.",
+		}).If(pool),
+		mockllm.Say("Fixed: payment service is back to 200 OK.").If(loop),
+
+		mockllm.Say(`Impact: payment service returned 502 until the fix.
+Root cause: see the most frequent log errors found by analyze_logs.
+Actions: checked HTTP, analyzed logs by reference, followed the runbook, verified 200 OK.
+Lesson: saved to memory for the next incident.`).If(report),
+	)
+}
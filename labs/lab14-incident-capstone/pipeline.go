@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// --- Pipelines (lab13) ---
+//
+// analyze_logs runs a small text pipeline over the logs. The logs come in as
+// a blob reference, so the raw lines never pass through the model context.
+
+// PipelineStep is one step: {"tool": "grep", "args": {"pattern": "ERROR"}}.
+type PipelineStep struct {
+	Tool string         `json:"tool"`
+	Args map[string]any `json:"args"`
+}
+
+// runPipeline executes steps sequentially: each step's output is the next step's input.
+func runPipeline(steps []PipelineStep, input string) (string, error) {
+	if len(steps) == 0 {
+		return "", fmt.Errorf("pipeline has no steps")
+	}
+	out := input
+	for i, step := range steps {
+		var err error
+		out, err = runStep(step, out)
+		if err != nil {
+			return "", fmt.Errorf("step %d (%s): %w", i+1, step.Tool, err)
+		}
+	}
+	return out, nil
+}
+
+func runStep(step PipelineStep, input string) (string, error) {
+	lines := strings.Split(strings.TrimRight(input, "\n"), "\n")
+	switch step.Tool {
+	case "grep":
+		pattern, _ := step.Args["pattern"].(string)
+		if pattern == "" {
+			return "", fmt.Errorf("requires 'pattern' argument")
+		}
+		var kept []string
+		for _, l := range lines {
+			if strings.Contains(l, pattern) {
+				kept = append(kept, l)
+			}
+		}
+		return strings.Join(kept, "\n"), nil
+	case "cut":
+		// Drops the timestamp: "2024-01-01 10:00:00 ERROR ..." -> "ERROR ...".
+		for i, l := range lines {
+			if f := strings.SplitN(l, " ", 3); len(f) == 3 {
+				lines[i] = f[2]
+			}
+		}
+		return strings.Join(lines, "\n"), nil
+	case "sort":
+		sort.Strings(lines)
+		return strings.Join(lines, "\n"), nil
+	case "uniq":
+		return uniq(lines), nil
+	case "head":
+		n, ok := step.Args["lines"].(float64)
+		if !ok || n <= 0 {
+			return "", fmt.Errorf("requires positive 'lines' argument")
+		}
+		if int(n) < len(lines) {
+			lines = lines[:int(n)]
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+	return "", fmt.Errorf("unknown tool (want grep, cut, sort, uniq, head)")
+}
+
+// uniq counts equal lines (like sort | uniq -c | sort -rn), most frequent first.
+func uniq(lines []string) string {
+	counts := map[string]int{}
+	var order []string
+	for _, l := range lines {
+		if counts[l] == 0 {
+			order = append(order, l)
+		}
+		counts[l]++
+	}
+	sort.SliceStable(order, func(i, j int) bool { return counts[order[i]] > counts[order[j]] })
+	out := make([]string, len(order))
+	for i, l := range order {
+		out[i] = fmt.Sprintf("%7d %s", counts[l], l)
+	}
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/parse"
+	"github.com/kshvakov/agent/pkg/schema"
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Planning (lab10) ---
+//
+// Before touching anything the agent writes a plan. The plan is validated,
+// saved as plan.json in the run directory and then guides the tool loop:
+// lab10 executes plans with its own runtime, here the model follows the plan itself.
+//
+// The plan streams, and each step is checked as soon as it is complete
+// (parse.Elements): a step with a tool the agent doesn't have, or an id
+// an earlier step took, stops the stream there. The model is asked again
+// with what was wrong, instead of finishing a plan that will be thrown away.
+
+// Step is one step of the incident plan.
+type Step struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	Tool        string `json:"tool,omitempty"` // Tool the step expects to call, if any
+}
+
+// Plan is the incident response plan.
+type Plan struct {
+	Goal  string `json:"goal"`
+	Steps []Step `json:"steps"`
+}
+
+// planSchema is checked before the plan is accepted: a plan the model
+// can't follow is worse than no plan.
+var planSchema = schema.Object().
+	Prop("goal", schema.String("What 'resolved' means for this incident")).
+	Prop("steps", schema.Array(schema.Object().
+		Prop("id", schema.String("")).
+		Prop("description", schema.String("")).
+		Prop("tool", schema.String("")).
+		Require("id", "description"), "")).
+	Require("goal", "steps")
+
+// planRepairs is how many times a plan stopped at a bad step is asked for
+// again.
+const planRepairs = 2
+
+// badStep is a plan step that failed the check while the plan streamed.
+type badStep struct {
+	Step    int // From 1
+	Problem string
+}
+
+func (e *badStep) Error() string {
+	return fmt.Sprintf("step %d: %s", e.Step, e.Problem)
+}
+
+// createPlan asks the model for a plan. Runbook excerpts and past lessons
+// go into the prompt, so the plan starts from what is already known.
+// The plan is JSON, so temperature is the PhaseJSON one (0 by default).
+func createPlan(ctx context.Context, client llm.Provider, alert, runbookHints, lessons string, tools []string, temperature float32) (*Plan, error) {
+	prompt := fmt.Sprintf(`You are an SRE planning an incident response.
+Alert: %s
+
+Relevant runbooks:
+%s
+
+Lessons from past incidents:
+%s
+
+Available tools: %s
+
+Write a short plan (3-8 steps). Investigate before acting, respect policies from the runbooks,
+verify the fix at the end, and finish by saving a lesson to memory.
+Return JSON only: {"goal": "...", "steps": [{"id": "1", "description": "...", "tool": "..."}]}`,
+		alert, runbookHints, lessons, strings.Join(tools, ", "))
+
+	req := openai.ChatCompletionRequest{
+		Model:       "gpt-4o-mini",
+		Messages:    []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: prompt}},
+		Temperature: temperature,
+		// The schema goes with the request: Ollama and llama.cpp
+		// (LLAMACPP_GRAMMAR=on) constrain decoding to it.
+		ResponseFormat: &openai.ChatCompletionResponseFormat{
+			Type:       openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{Name: "plan", Schema: planSchema.Raw()},
+		},
+		Stream: true,
+	}
+	var text string
+	for attempt := 0; ; attempt++ {
+		var err error
+		text, err = streamPlan(ctx, client, req, tools)
+		var bad *badStep
+		if errors.As(err, &bad) && attempt < planRepairs {
+			fmt.Printf("✂️  Planner stopped at %v. Asking again.\n", bad)
+			req.Messages = append(req.Messages,
+				openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: text},
+				openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: fmt.Sprintf(
+					"Your plan was stopped at %v. Write the whole plan again with that step fixed. Use only the available tools.", bad)})
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("planner: %w", err)
+		}
+		break
+	}
+	// Without constrained decoding the schema is a request, not a
+	// guarantee: local models may still wrap the JSON in prose or a code fence.
+	content, err := parse.JSON[json.RawMessage]()(text)
+	if err != nil {
+		return nil, fmt.Errorf("planner: %w", err)
+	}
+	if err := planSchema.Validate(content); err != nil {
+		return nil, fmt.Errorf("planner: %w", err)
+	}
+	var plan Plan
+	if err := json.Unmarshal(content, &plan); err != nil {
+		return nil, fmt.Errorf("planner returned invalid JSON: %w", err)
+	}
+	if len(plan.Steps) == 0 {
+		return nil, fmt.Errorf("planner returned no steps")
+	}
+	return &plan, nil
+}
+
+// streamPlan streams the planner's reply and checks every step as it
+// completes. The first bad step stops the stream; the text so far is
+// returned with a *badStep.
+func streamPlan(ctx context.Context, client llm.Provider, req openai.ChatCompletionRequest, tools []string) (string, error) {
+	stream, err := client.Stream(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	var ids []string
+	steps := parse.NewElements("steps", func(i int, raw json.RawMessage) error {
+		var step Step
+		if err := json.Unmarshal(raw, &step); err != nil {
+			return &badStep{i + 1, "not a step object"}
+		}
+		if slices.Contains(ids, step.ID) {
+			return &badStep{i + 1, fmt.Sprintf("id %q is taken by an earlier step", step.ID)}
+		}
+		if step.Tool != "" && !slices.Contains(tools, step.Tool) {
+			return &badStep{i + 1, fmt.Sprintf("there is no tool %q (available: %s)", step.Tool, strings.Join(tools, ", "))}
+		}
+		ids = append(ids, step.ID)
+		return nil
+	})
+	resp, err := llm.CollectUntil(stream, steps.Write)
+	if len(resp.Choices) == 0 {
+		return "", err
+	}
+	return resp.Choices[0].Message.Content, err
+}
+
+// String renders the plan for the conversation and the console.
+func (p *Plan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Goal: %s\n", p.Goal)
+	for _, s := range p.Steps {
+		fmt.Fprintf(&b, "%s. %s", s.ID, s.Description)
+		if s.Tool != "" {
+			fmt.Fprintf(&b, " [%s]", s.Tool)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,592 @@
+// Package agent is the tool-calling loop shared by the labs:
+//
+//	call LLM → no ToolCalls? return the answer
+//	         → execute every ToolCall, append results, repeat
+//
+// A lab configures an Agent (system prompt, tools, hooks) instead of
+// copying the loop:
+//
+//	a := agent.New(client, agent.Config{SystemPrompt: "You are a DevOps agent."})
+//	a.RegisterTool(agent.Tool{
+//		Name:        "check_disk",
+//		Description: "Check current disk usage",
+//		Execute: func(ctx context.Context, args json.RawMessage) (string, error) {
+//			return checkDisk(), nil
+//		},
+//	})
+//	answer, err := a.Run(ctx, "I'm out of disk space. Fix it.")
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/blobs"
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/runs"
+	"github.com/kshvakov/agent/pkg/safety"
+	"github.com/kshvakov/agent/pkg/tools"
+	"github.com/kshvakov/agent/pkg/trace"
+	"github.com/sashabaranov/go-openai"
+)
+
+// DefaultModel is used when Config.Model is empty.
+const DefaultModel = "gpt-4o-mini"
+
+// DefaultMaxIterations is used when Config.MaxIterations is 0.
+const DefaultMaxIterations = 10
+
+// ErrMaxIterations is returned when the model is still calling tools
+// after Config.MaxIterations LLM calls.
+var ErrMaxIterations = errors.New("agent: max iterations reached")
+
+// ErrLoop is returned when the model keeps repeating a call after it was
+// told to stop (see Config.LoopLimit).
+var ErrLoop = errors.New("agent: tool call loop")
+
+// Tool is a tools.Tool. An error from Execute is reported to the model
+// as "Error: ..." (or a tools.Result, see Config.StructuredResults), not
+// returned from Agent.Run.
+type Tool = tools.Tool
+
+// Hooks observe and adjust the loop. All of them are optional.
+type Hooks struct {
+	// OnThought receives the text the model sends along with tool calls.
+	OnThought func(content string)
+	// OnToolCall is called before a tool runs.
+	OnToolCall func(call openai.ToolCall)
+	// OnToolResult is called with the result (or the error text) of every call
+	// and returns the content sent to the model: labs use it to timestamp
+	// results, park large outputs, or just print them.
+	OnToolResult func(call openai.ToolCall, result string) string
+	// OnContent is called with every piece of assistant content as it
+	// arrives when Config.Stream is set.
+	OnContent func(delta string)
+	// OnReview is called with the safety verdict on a mutating call.
+	OnReview func(call openai.ToolCall, v safety.Verdict)
+	// OnLoop is called when a call has been made Config.LoopLimit times
+	// and the model is told to stop repeating it.
+	OnLoop func(call openai.ToolCall, n int)
+	// OnReverify is called when a stale fact was re-verified before a
+	// mutating call, with the old and the new result (see Tool.TTL).
+	OnReverify func(call openai.ToolCall, was, now string)
+	// Confirm asks a human about a call the reviewer marked needs_human
+	// and returns true to run it. Without Confirm such calls are blocked.
+	Confirm func(call openai.ToolCall, reason string) bool
+	// OnPaged is called when the result of call is split into parts the
+	// model reads one by one, and again when an overflow of the context
+	// window makes the parts smaller (see Config.MaxToolResult).
+	OnPaged func(call openai.ToolCall, parts int)
+	// Repair is called when the model answers without tool calls. If it
+	// returns a nudge, the nudge is sent as a system message and the loop goes
+	// on, with forceTool (if set) forced via ToolChoice. Repair runs at most
+	// once per Run, so a model that can't call tools doesn't spin.
+	Repair func(msg openai.ChatCompletionMessage) (nudge, forceTool string)
+
+	// The middleware hooks wrap every LLM and tool call, so logging,
+	// approvals, cost limits and caches bolt on without changing the
+	// loop. Chain stacks several of them.
+
+	// BeforeLLMCall runs before every LLM call and may change the request
+	// (trim the history, switch the model). An error stops the Run with
+	// that error: TokenBudget returns one when the budget is spent.
+	BeforeLLMCall func(req *openai.ChatCompletionRequest) error
+	// AfterLLMCall sees the response, or the error, of every LLM call.
+	AfterLLMCall func(req openai.ChatCompletionRequest, resp openai.ChatCompletionResponse, err error)
+	// BeforeToolCall runs before a tool call, after OnToolCall. If it
+	// returns handled, the tool doesn't run and result is the call's
+	// result: a cache hit, or the reason an approval step said no. A
+	// result "Error: ..." refuses the call: it fails with ErrRefused.
+	BeforeToolCall func(call openai.ToolCall) (result string, handled bool)
+	// AfterToolCall sees the result and the error of every call, before
+	// OnToolResult. With Config.ParallelTools, the tool hooks run
+	// concurrently.
+	AfterToolCall func(call openai.ToolCall, result string, err error)
+}
+
+// Reviewer decides whether a tool call may run. *safety.Reviewer implements it.
+type Reviewer interface {
+	Review(ctx context.Context, call openai.ToolCall, history []openai.ChatCompletionMessage) (safety.Verdict, error)
+}
+
+// Config configures an Agent.
+type Config struct {
+	Model         string // DefaultModel if empty
+	SystemPrompt  string // messages[0]; empty means no system message
+	MaxIterations int    // LLM calls per Run; DefaultMaxIterations if 0, AGENT_MAX_STEPS if set
+
+	// Budget limits the steps, tokens, cost and time of every Run; a Run
+	// over it stops with a *BudgetError that says what was spent.
+	Budget Budget
+
+	// LoopLimit, if set, catches a model that repeats itself: once the
+	// same call (tool and arguments) has been made LoopLimit times in a
+	// Run, a system message tells the model to stop, and the next repeat
+	// of a call made that often stops the Run with ErrLoop.
+	LoopLimit int
+
+	// Temperatures per phase; missing phases use DefaultTemperatures.
+	// Turns that offer tools are PhaseTools, turns without tools
+	// (an agent with no tools, or Report) are PhaseReport.
+	Temperatures Temperatures
+
+	// ParallelTools is how many tool calls of one reply run at once; 0 or
+	// 1 runs them one after another. A Mutating call always runs alone,
+	// and Tool.Concurrency caps the calls of one tool. With parallel
+	// calls, Hooks.OnToolCall and OnToolResult run concurrently.
+	ParallelTools int
+
+	// ToolTimeout, if set, is the Tool.Timeout of registered tools that
+	// have none: a call that runs longer is abandoned, and the model is
+	// told its outcome is unknown. A panicking tool fails its call, with
+	// or without a timeout (see tools.Registry.Dispatch).
+	ToolTimeout time.Duration
+
+	// MaxToolResult, if set, is the longest tool result in bytes sent to
+	// the model at once. A longer one is sent in parts: the first with a
+	// continuation marker, the rest when the model asks for them with the
+	// read_more tool. A result is also split, whatever MaxToolResult is,
+	// when it makes a request overflow the context window. See paging.go.
+	MaxToolResult int
+
+	// Stream, if set, streams every completion: content reaches
+	// Hooks.OnContent as it is generated instead of after the whole reply.
+	Stream bool
+
+	// Reviewer, if set, reviews every call of a Mutating tool before it
+	// runs; see pkg/safety. A blocked call gets the reason as its result.
+	Reviewer Reviewer
+
+	// Run, if set, receives every message with its provenance and the
+	// usage of every LLM call.
+	Run *runs.Run
+
+	// Trace, if set, logs every step: LLM requests, tool calls and
+	// results, the final answer. See pkg/trace.
+	Trace *trace.Logger
+
+	// Now is the clock for the freshness of tool results (Tool.TTL);
+	// time.Now if nil. Labs with simulated time pass their clock.
+	Now func() time.Time
+
+	// Tracer, if set, records OpenTelemetry spans: one per Run, per
+	// iteration, per LLM call and per tool call. See trace.Tracer.
+	Tracer *trace.Tracer
+
+	// StructuredResults, if set, sends every tool result to the model as
+	// the JSON of a tools.Result: {"status":"ok","data":...} for a call
+	// that ran, {"status":"error","error":...,"hint":...} for one that
+	// failed, so bad news from a tool doesn't read like a broken tool.
+	// A call middleware refused is a failure too (see ErrRefused).
+	// AGENT_STRUCTURED_RESULTS=1 sets it.
+	StructuredResults bool
+
+	// Strict, if set, stops a Run with a *StrictError at the first reply
+	// that breaks the tool-calling contract, instead of recovering from it
+	// (see strict.go). AGENT_STRICT=1 sets it.
+	Strict bool
+
+	Hooks Hooks
+}
+
+// Agent holds the conversation and the tools. The conversation survives
+// between Run calls, so one Agent is one chat session.
+type Agent struct {
+	client   llm.Provider
+	cfg      Config
+	tools    *tools.Registry
+	messages []openai.ChatCompletionMessage
+	metas    []runs.MessageMeta  // Provenance of messages[i]
+	step     int                 // LLM calls so far, for the trace
+	facts    map[string]fact     // Results of tools with a TTL, by fingerprint
+	factsMu  sync.Mutex          // Guards facts and once from parallel tool calls
+	once     map[string]onceCall // Calls of Once tools in the current Run, see once.go
+	spent    Spent               // Of the current Run, see Budget
+	started  time.Time           // Of the current Run
+	repeats  map[string]int      // Calls of the current Run by fingerprint, see LoopLimit
+	warned   bool                // The current Run got the loop nudge
+	pages    pages               // Tool results sent in parts, see paging.go
+}
+
+// New returns an agent with no tools.
+func New(client llm.Provider, cfg Config) *Agent {
+	if cfg.Model == "" {
+		cfg.Model = DefaultModel
+	}
+	if cfg.MaxIterations == 0 {
+		cfg.MaxIterations = DefaultMaxIterations
+	}
+	// AGENT_MAX_STEPS overrides the lab's limit (agentlab run --max-steps).
+	if n, err := strconv.Atoi(os.Getenv("AGENT_MAX_STEPS")); err == nil && n > 0 {
+		cfg.MaxIterations = n
+	}
+	// AGENT_STRICT turns strict mode on for every agent (agentlab run -strict).
+	if on, err := strconv.ParseBool(os.Getenv("AGENT_STRICT")); err == nil && on {
+		cfg.Strict = true
+	}
+	if on, err := strconv.ParseBool(os.Getenv("AGENT_STRUCTURED_RESULTS")); err == nil && on {
+		cfg.StructuredResults = true
+	}
+	a := &Agent{client: client, cfg: cfg, tools: tools.NewRegistry()}
+	if cfg.SystemPrompt != "" {
+		a.append(openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: cfg.SystemPrompt}, runs.MessageMeta{})
+	}
+	return a
+}
+
+// RegisterTool adds a tool. Registering the same name again replaces it.
+func (a *Agent) RegisterTool(t Tool) {
+	if t.Timeout == 0 {
+		t.Timeout = a.cfg.ToolTimeout
+	}
+	a.tools.Register(t)
+}
+
+// ToolNames returns the names of registered tools in registration order.
+func (a *Agent) ToolNames() []string {
+	return a.tools.Names()
+}
+
+// Tools returns the tool definitions sent to the model.
+func (a *Agent) Tools() []openai.Tool {
+	return a.tools.Definitions()
+}
+
+// Preview returns how call reads to a human, for approval prompts (see
+// Tool.Preview).
+func (a *Agent) Preview(call openai.ToolCall) string {
+	return a.tools.Preview(call)
+}
+
+// Messages returns the conversation so far.
+func (a *Agent) Messages() []openai.ChatCompletionMessage {
+	return a.messages
+}
+
+// Provenance returns the metadata of every message, aligned with Messages.
+func (a *Agent) Provenance() []runs.MessageMeta {
+	return a.metas
+}
+
+// Run appends userMsg and loops until the model answers without tool calls.
+// It returns that answer, ErrMaxIterations, ErrLoop, a *BudgetError if
+// Config.Budget runs out, or a *StrictError in strict mode. The answer's provenance is
+// the merged provenance of the conversation it was written from.
+//
+// When ctx is canceled (Ctrl+C, see Interruptible), Run stops at the next
+// LLM or tool call and returns the context's error; what was done so far
+// stays in the conversation (see Recap).
+func (a *Agent) Run(ctx context.Context, userMsg string) (answer string, err error) {
+	ctx, span := a.cfg.Tracer.Start(ctx, "invoke_agent", "gen_ai.operation.name", "invoke_agent")
+	a.spent, a.started = Spent{}, time.Now()
+	a.repeats, a.warned, a.once = map[string]int{}, false, nil
+	defer func() {
+		a.spent.Time, a.started = time.Since(a.started), time.Time{}
+		span.SetError(err)
+		span.End()
+	}()
+	a.append(openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: userMsg}, runs.MessageMeta{})
+
+	repaired := false
+	forcedTool := ""
+	for i := 0; i < a.cfg.MaxIterations; i++ {
+		span.SetAttr("agent.iterations", i+1)
+		if err := a.checkBudget(); err != nil {
+			return "", err
+		}
+		answer, done, err := a.iterate(ctx, i+1, &repaired, &forcedTool)
+		if done || err != nil {
+			return answer, err
+		}
+	}
+	return "", ErrMaxIterations
+}
+
+// iterate is one iteration of Run: an LLM call and the tool calls it asks
+// for. done reports that the model answered.
+func (a *Agent) iterate(ctx context.Context, n int, repaired *bool, forcedTool *string) (answer string, done bool, err error) {
+	ctx, span := a.cfg.Tracer.Start(ctx, "agent.iteration", "agent.iteration", n)
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+	req := openai.ChatCompletionRequest{
+		Model:       a.cfg.Model,
+		Messages:    a.messages,
+		Tools:       append(a.Tools(), a.pagingTools()...),
+		Temperature: a.cfg.Temperatures.For(PhaseTools),
+	}
+	if len(req.Tools) == 0 {
+		req.Temperature = a.cfg.Temperatures.For(PhaseReport)
+	}
+	if *forcedTool != "" {
+		req.ToolChoice = openai.ToolChoice{
+			Type:     openai.ToolTypeFunction,
+			Function: openai.ToolFunction{Name: *forcedTool},
+		}
+		*forcedTool = ""
+	}
+
+	msg, err := a.complete(ctx, req)
+	if err != nil {
+		return "", false, err
+	}
+
+	if len(msg.ToolCalls) == 0 {
+		if a.cfg.Hooks.Repair != nil && !*repaired {
+			if nudge, tool := a.cfg.Hooks.Repair(msg); nudge != "" {
+				if a.cfg.Strict {
+					return "", false, a.strictError(msg, ViolationNoToolCall, "no tool call where one was expected (Repair: %q)", nudge)
+				}
+				*repaired = true
+				*forcedTool = tool
+				a.append(openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: nudge}, runs.MessageMeta{})
+				return "", false, nil
+			}
+		}
+		a.cfg.Trace.FinalAnswer(ctx, a.step, msg.Content)
+		return msg.Content, true, nil
+	}
+
+	if msg.Content != "" && a.cfg.Hooks.OnThought != nil {
+		a.cfg.Hooks.OnThought(msg.Content)
+	}
+	// The calls may run in parallel (Config.ParallelTools); their results
+	// are appended in the order the model made them.
+	metas := make([]runs.MessageMeta, len(msg.ToolCalls))
+	index := map[string]int{}
+	for i, call := range msg.ToolCalls {
+		index[call.ID] = i
+	}
+	results := a.tools.Each(ctx, msg.ToolCalls, a.cfg.ParallelTools, func(ctx context.Context, call openai.ToolCall) string {
+		// Calls left when the run is interrupted still get a result: the
+		// conversation stays valid to continue with another Run.
+		if ctx.Err() != nil {
+			return a.render("", errors.New("interrupted before the call"))
+		}
+		result, meta := a.call(ctx, call)
+		metas[index[call.ID]] = meta
+		return result
+	})
+	for i, call := range msg.ToolCalls {
+		a.append(openai.ChatCompletionMessage{
+			Role:       openai.ChatMessageRoleTool,
+			Content:    results[i],
+			ToolCallID: call.ID,
+		}, metas[i])
+	}
+	if err := a.checkLoop(msg.ToolCalls); err != nil {
+		return "", false, err
+	}
+	return "", false, ctx.Err()
+}
+
+// Report appends instruction and asks for a free-form answer without tools,
+// at the PhaseReport temperature. Call it after Run, when the work is done
+// and what's left is to explain it to a human.
+func (a *Agent) Report(ctx context.Context, instruction string) (string, error) {
+	a.append(openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: instruction}, runs.MessageMeta{})
+	msg, err := a.complete(ctx, openai.ChatCompletionRequest{
+		Model:       a.cfg.Model,
+		Messages:    a.messages,
+		Temperature: a.cfg.Temperatures.For(PhaseReport),
+	})
+	if err != nil {
+		return "", err
+	}
+	a.cfg.Trace.FinalAnswer(ctx, a.step, msg.Content)
+	return msg.Content, nil
+}
+
+// complete makes one LLM call and appends the reply to the conversation.
+// A reply without tool calls is an answer: it gets the evidence as provenance.
+func (a *Agent) complete(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionMessage, error) {
+	if a.cfg.Hooks.BeforeLLMCall != nil {
+		if err := a.cfg.Hooks.BeforeLLMCall(&req); err != nil {
+			return openai.ChatCompletionMessage{}, err
+		}
+	}
+	a.step++
+	a.spent.Steps++
+	_, span := a.cfg.Tracer.Start(ctx, "chat "+req.Model,
+		"gen_ai.operation.name", "chat",
+		"gen_ai.request.model", req.Model,
+		"agent.step", a.step,
+	)
+	span.Client()
+	start := time.Now()
+	resp, err := a.completeFitting(ctx, req)
+	a.cfg.Trace.LLMRequest(ctx, a.step, req, resp, time.Since(start), err)
+	span.SetAttr("gen_ai.response.model", resp.Model)
+	span.SetAttr("gen_ai.usage.input_tokens", resp.Usage.PromptTokens)
+	span.SetAttr("gen_ai.usage.output_tokens", resp.Usage.CompletionTokens)
+	span.SetError(err)
+	span.End()
+	if a.cfg.Hooks.AfterLLMCall != nil {
+		a.cfg.Hooks.AfterLLMCall(req, resp, err)
+	}
+	if err != nil {
+		return openai.ChatCompletionMessage{}, err
+	}
+	if len(resp.Choices) == 0 {
+		return openai.ChatCompletionMessage{}, fmt.Errorf("agent: empty response")
+	}
+	a.spend(req, resp)
+	if a.cfg.Run != nil {
+		a.cfg.Run.AddUsage(resp.Usage)
+	}
+	msg := resp.Choices[0].Message
+	var meta runs.MessageMeta
+	if len(msg.ToolCalls) == 0 {
+		meta = runs.Merge(a.metas...)
+	}
+	a.append(msg, meta)
+	return msg, a.checkStrict(msg, resp.Choices[0].FinishReason)
+}
+
+// completion makes the LLM call, streamed if Config.Stream is set.
+// Tool calls are assembled from their deltas, so the loop can't tell
+// a streamed reply from a whole one.
+func (a *Agent) completion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	if !a.cfg.Stream {
+		return a.client.ChatCompletion(ctx, req)
+	}
+	req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	stream, err := a.client.Stream(ctx, req)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	defer stream.Close()
+	return llm.Collect(stream, a.cfg.Hooks.OnContent)
+}
+
+// call validates the arguments and runs one tool, or answers it from the
+// facts if the same call has a fresh result (see freshness.go), or from
+// the first call if it is a repeat of a Once tool (see once.go). Failures
+// become the tool result, so the model can see them and correct itself. The result's
+// provenance is the tool, what the tool reported via Annotate, and the
+// blob references in its arguments (data it worked on) and in the final
+// result (data it parked).
+func (a *Agent) call(ctx context.Context, call openai.ToolCall) (string, runs.MessageMeta) {
+	if a.cfg.Hooks.OnToolCall != nil {
+		a.cfg.Hooks.OnToolCall(call)
+	}
+	a.cfg.Trace.ToolCall(ctx, a.step, call)
+	ctx, span := a.cfg.Tracer.Start(ctx, "execute_tool "+call.Function.Name,
+		"gen_ai.operation.name", "execute_tool",
+		"gen_ai.tool.name", call.Function.Name,
+		"gen_ai.tool.call.id", call.ID,
+	)
+	defer span.End()
+	start := time.Now()
+	meta := &runs.MessageMeta{Tools: []string{call.Function.Name}}
+	var result string
+	var err error
+	var handled bool
+	t, _ := a.tools.Get(call.Function.Name)
+	if ran, r, onceErr := a.ranOnce(t, call); ran {
+		result, err, handled = r, onceErr, true
+	} else if a.cfg.Hooks.BeforeToolCall != nil {
+		result, handled = a.cfg.Hooks.BeforeToolCall(call)
+		if reason, ok := strings.CutPrefix(result, "Error: "); handled && ok {
+			result, err = "", &refusedError{reason: reason}
+		}
+	}
+	if handled {
+		// Answered by middleware, or by the first call of a Once tool
+	} else if r, ok := a.cached(call); ok {
+		result = r
+	} else if reason, ok := a.reverify(ctx, t); !ok {
+		err = errors.New(reason)
+	} else if reason, ok := a.review(ctx, call); !ok {
+		err = errors.New(reason)
+	} else {
+		reg := a.tools
+		if _, ok := reg.Get(call.Function.Name); !ok && call.Function.Name == ReadMoreTool {
+			reg = a.pagingRegistry()
+			ctx = context.WithValue(ctx, callIDKey{}, call.ID)
+		}
+		result, err = reg.Dispatch(context.WithValue(ctx, metaKey{}, meta), call)
+		switch {
+		case err == nil && t.TTL > 0:
+			a.remember(call, result, t.TTL)
+		case err == nil && t.Mutating:
+			clear(a.facts)
+		}
+		a.recordOnce(t, call, result, err)
+	}
+	if a.cfg.Hooks.AfterToolCall != nil {
+		a.cfg.Hooks.AfterToolCall(call, result, err)
+	}
+	result = a.render(result, err)
+	if a.cfg.Hooks.OnToolResult != nil {
+		result = a.cfg.Hooks.OnToolResult(call, result)
+	}
+	if n := a.cfg.MaxToolResult; n > 0 && len(result) > n && call.Function.Name != ReadMoreTool {
+		meta.Redactions = append(meta.Redactions, fmt.Sprintf("paged %d bytes of tool output", len(result)))
+		result = a.page(call, result, n)
+	}
+	a.cfg.Trace.ToolResult(ctx, a.step, call, result, time.Since(start), err)
+	span.SetAttr("tool.result_bytes", len(result))
+	span.SetError(err)
+	refs := append(blobs.Refs(call.Function.Arguments), blobs.Refs(result)...)
+	return result, runs.Merge(*meta, runs.MessageMeta{Blobs: refs})
+}
+
+// render is the tool message of a call that returned result and err:
+// result, or "Error: ..." for a failed call, or with
+// Config.StructuredResults the tools.Result of either.
+func (a *Agent) render(result string, err error) string {
+	if !a.cfg.StructuredResults {
+		if err != nil {
+			return fmt.Sprintf("Error: %v", err)
+		}
+		return result
+	}
+	if err != nil {
+		return tools.Failed(err).String()
+	}
+	return tools.OK(result).String()
+}
+
+// review runs the safety review for calls of mutating tools. It returns
+// false with the reason if the call must not run. A failed review blocks
+// the call: an unreviewed destructive action is worse than a retry.
+func (a *Agent) review(ctx context.Context, call openai.ToolCall) (string, bool) {
+	t, ok := a.tools.Get(call.Function.Name)
+	if a.cfg.Reviewer == nil || !ok || !t.Mutating {
+		return "", true
+	}
+	v, err := a.cfg.Reviewer.Review(ctx, call, a.messages)
+	if err != nil {
+		v = safety.Verdict{Decision: safety.Deny, Reason: err.Error()}
+	}
+	if a.cfg.Hooks.OnReview != nil {
+		a.cfg.Hooks.OnReview(call, v)
+	}
+	switch v.Decision {
+	case safety.Allow:
+		return "", true
+	case safety.NeedsHuman:
+		if a.cfg.Hooks.Confirm != nil && a.cfg.Hooks.Confirm(call, v.Reason) {
+			return "", true
+		}
+		return "blocked: needs human approval: " + v.Reason, false
+	default:
+		return "blocked by safety review: " + v.Reason, false
+	}
+}
+
+func (a *Agent) append(m openai.ChatCompletionMessage, meta runs.MessageMeta) {
+	a.messages = append(a.messages, m)
+	a.metas = append(a.metas, meta)
+	if a.cfg.Run != nil {
+		a.cfg.Run.AppendMessage(m, meta)
+	}
+}
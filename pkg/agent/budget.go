@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"cmp"
+	"fmt"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/llm/usage"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Budget limits what one Run may spend. Zero fields are not limited.
+// The limits are checked before every LLM call: the call that crosses one
+// completes, the next one stops the Run with a *BudgetError.
+type Budget struct {
+	Steps   int           // LLM calls
+	Tokens  int           // Prompt and completion tokens
+	Dollars float64       // Estimated cost, by usage.Prices; calls to unpriced models count as free
+	Time    time.Duration // Wall time since Run started
+}
+
+// Spent is what a Run has used so far.
+type Spent struct {
+	Steps    int
+	Tokens   int
+	Dollars  float64
+	Time     time.Duration
+	Unpriced int // LLM calls to models without a price, not in Dollars
+}
+
+func (s Spent) String() string {
+	out := fmt.Sprintf("%d steps, %d tokens, $%.4f, %s", s.Steps, s.Tokens, s.Dollars, s.Time.Round(100*time.Millisecond))
+	if s.Unpriced > 0 {
+		out += fmt.Sprintf(" (%d calls unpriced)", s.Unpriced)
+	}
+	return out
+}
+
+// BudgetError is returned from Run when Config.Budget stops it. It
+// matches ErrBudget.
+type BudgetError struct {
+	Limit  string // "steps", "tokens", "dollars" or "time"
+	Budget Budget
+	Spent  Spent
+}
+
+func (e *BudgetError) Error() string {
+	var limit string
+	switch e.Limit {
+	case "steps":
+		limit = fmt.Sprintf("%d of %d steps", e.Spent.Steps, e.Budget.Steps)
+	case "tokens":
+		limit = fmt.Sprintf("%d of %d tokens", e.Spent.Tokens, e.Budget.Tokens)
+	case "dollars":
+		limit = fmt.Sprintf("$%.4f of $%.4f", e.Spent.Dollars, e.Budget.Dollars)
+	case "time":
+		limit = fmt.Sprintf("%s of %s", e.Spent.Time.Round(100*time.Millisecond), e.Budget.Time)
+	}
+	return fmt.Sprintf("%v: %s (spent %v)", ErrBudget, limit, e.Spent)
+}
+
+func (e *BudgetError) Unwrap() error { return ErrBudget }
+
+// Spent returns what the current Run has used so far, or what the last
+// one used.
+func (a *Agent) Spent() Spent {
+	s := a.spent
+	if !a.started.IsZero() {
+		s.Time = time.Since(a.started)
+	}
+	return s
+}
+
+// checkBudget returns a *BudgetError if the Run has reached a limit of
+// Config.Budget.
+func (a *Agent) checkBudget() error {
+	b, s := a.cfg.Budget, a.Spent()
+	limit := ""
+	switch {
+	case b.Steps > 0 && s.Steps >= b.Steps:
+		limit = "steps"
+	case b.Tokens > 0 && s.Tokens >= b.Tokens:
+		limit = "tokens"
+	case b.Dollars > 0 && s.Dollars >= b.Dollars:
+		limit = "dollars"
+	case b.Time > 0 && s.Time >= b.Time:
+		limit = "time"
+	default:
+		return nil
+	}
+	return &BudgetError{Limit: limit, Budget: b, Spent: s}
+}
+
+// spend adds a successful LLM call to the Run's spending.
+func (a *Agent) spend(req openai.ChatCompletionRequest, resp openai.ChatCompletionResponse) {
+	a.spent.Tokens += resp.Usage.TotalTokens
+	t := usage.Totals{PromptTokens: resp.Usage.PromptTokens, CompletionTokens: resp.Usage.CompletionTokens}
+	if cost, ok := t.Cost(cmp.Or(resp.Model, req.Model)); ok {
+		a.spent.Dollars += cost
+	} else {
+		a.spent.Unpriced++
+	}
+}
@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/tools"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Facts and their freshness.
+//
+// A result of a tool with a TTL is a fact about the world at the moment
+// of the call. While it is fresh, the same call is answered from the cache
+// (a specialist isn't asked the same question twice). Before a Mutating
+// call, facts older than their TTL are re-verified: the calls are run
+// again, and if any result changed, the mutating call is blocked and the
+// model gets the new results to decide again. A restart must not rely on
+// "502 Bad Gateway" seen five minutes ago.
+//
+// A Mutating call that runs clears the facts: it may have changed what
+// they describe.
+//
+// Calls of one reply may run in parallel (Config.ParallelTools), so the
+// facts are guarded by factsMu. Mutating calls, and so reverify and the
+// clearing, always run alone (see tools.Registry.Each).
+
+// fact is the result of a call to a tool with a TTL.
+type fact struct {
+	call   openai.ToolCall
+	result string // As the tool returned it, before Hooks.OnToolResult
+	at     time.Time
+	ttl    time.Duration
+}
+
+func (a *Agent) now() time.Time {
+	if a.cfg.Now != nil {
+		return a.cfg.Now()
+	}
+	return time.Now()
+}
+
+// cached returns the fresh result of the same call, if there is one.
+func (a *Agent) cached(call openai.ToolCall) (string, bool) {
+	a.factsMu.Lock()
+	defer a.factsMu.Unlock()
+	f, ok := a.facts[fingerprint(call)]
+	if !ok || a.now().Sub(f.at) >= f.ttl {
+		return "", false
+	}
+	return f.result, true
+}
+
+// remember records the result of a call to a tool with a TTL.
+func (a *Agent) remember(call openai.ToolCall, result string, ttl time.Duration) {
+	a.factsMu.Lock()
+	defer a.factsMu.Unlock()
+	if a.facts == nil {
+		a.facts = map[string]fact{}
+	}
+	a.facts[fingerprint(call)] = fact{call: call, result: result, at: a.now(), ttl: ttl}
+}
+
+// reverify re-runs the stale facts before a call of a Mutating tool. It
+// returns false with the reason if any of them changed: the decision to
+// make the call was based on a world that is gone.
+func (a *Agent) reverify(ctx context.Context, t tools.Tool) (string, bool) {
+	if !t.Mutating {
+		return "", true
+	}
+	var changed []string
+	for _, key := range slices.Sorted(maps.Keys(a.facts)) {
+		f := a.facts[key]
+		age := a.now().Sub(f.at)
+		if age < f.ttl {
+			continue
+		}
+		fresh, err := a.tools.Dispatch(ctx, f.call)
+		if err != nil {
+			fresh = fmt.Sprintf("Error: %v", err)
+		}
+		if a.cfg.Hooks.OnReverify != nil {
+			a.cfg.Hooks.OnReverify(f.call, f.result, fresh)
+		}
+		if fresh != f.result {
+			changed = append(changed, fmt.Sprintf("- %s %s: was %q %s ago, now %q",
+				f.call.Function.Name, f.call.Function.Arguments, f.result, age.Round(time.Second), fresh))
+		}
+		a.facts[key] = fact{call: f.call, result: fresh, at: a.now(), ttl: f.ttl}
+	}
+	if len(changed) > 0 {
+		return "blocked: facts changed since they were checked, decide again with the new ones:\n" + strings.Join(changed, "\n"), false
+	}
+	return "", true
+}
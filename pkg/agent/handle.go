@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/kshvakov/agent/pkg/tools"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Embedding an agent. Handle is Run for a program that serves requests
+// with an agent: a Request in, a Result out, nothing read from stdin or
+// written to stdout. It doesn't export the labs' agents: they are package
+// main and talk to their simulated environments. A service builds the same
+// kind of agent with New and its own tools (or from a team file, see
+// pkg/team) and serves requests with Handle:
+//
+//	a := agent.New(client, agent.Config{SystemPrompt: prompt, Budget: agent.Budget{Steps: 15}})
+//	for _, t := range docker.Tools(dc) {
+//		a.RegisterTool(t)
+//	}
+//	res, err := a.Handle(ctx, agent.Request{Task: "web returns 502", Context: alertJSON})
+//
+// Like Run, Handle continues the conversation of the Agent: for unrelated
+// requests, build an agent per request (New is cheap) or serialize them.
+// Mutating calls that need a human are blocked unless Hooks.Confirm is set.
+
+// Request is one task for Handle.
+type Request struct {
+	Task string
+	// Context is what the task is about (an alert, logs, a document),
+	// sent ahead of the task in the same message. Optional.
+	Context string
+}
+
+// Result is what Handle did. After an error it still has the calls made
+// and what was spent, so a service can log why the request failed.
+type Result struct {
+	Answer    string
+	ToolCalls []ToolCallRecord // In the order the model made them
+	Spent     Spent
+}
+
+// ToolCallRecord is one tool call of a Handle and its result as it stands
+// in the conversation: the first part of a paged one, the tools.Result with
+// Config.StructuredResults. The model's read_more calls are not recorded.
+type ToolCallRecord struct {
+	Name      string
+	Arguments string // JSON
+	Result    string
+	Failed    bool // The call failed, not the thing it checked (see tools.IsError)
+}
+
+// Handle runs req as a new user turn and returns its Result. The error is
+// the one Run returns.
+func (a *Agent) Handle(ctx context.Context, req Request) (Result, error) {
+	msg := req.Task
+	if req.Context != "" {
+		msg = req.Context + "\n\n" + req.Task
+	}
+	from := len(a.messages)
+	answer, err := a.Run(ctx, msg)
+	return Result{Answer: answer, ToolCalls: toolCallsOf(a.messages[from:]), Spent: a.Spent()}, err
+}
+
+// toolCallsOf pairs the tool calls of msgs with their results.
+func toolCallsOf(msgs []openai.ChatCompletionMessage) []ToolCallRecord {
+	var calls []ToolCallRecord
+	index := map[string]int{} // ToolCallID → calls[i]
+	for _, m := range msgs {
+		switch m.Role {
+		case openai.ChatMessageRoleAssistant:
+			for _, tc := range m.ToolCalls {
+				if tc.Function.Name == ReadMoreTool {
+					continue
+				}
+				index[tc.ID] = len(calls)
+				calls = append(calls, ToolCallRecord{Name: tc.Function.Name, Arguments: tc.Function.Arguments})
+			}
+		case openai.ChatMessageRoleTool:
+			if i, ok := index[m.ToolCallID]; ok {
+				calls[i].Result, calls[i].Failed = m.Content, tools.IsError(m.Content)
+			}
+		}
+	}
+	return calls
+}
@@ -0,0 +1,298 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/blobs"
+	"github.com/kshvakov/agent/pkg/parse"
+	"github.com/kshvakov/agent/pkg/runs"
+	"github.com/kshvakov/agent/pkg/schema"
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Handing a task over to a human ---
+//
+// An agent that escalates leaves its conversation to whoever takes over,
+// and nobody on call reads forty tool calls to find out where things
+// stand. Handoff condenses it into what they need: the agent's best guess
+// at the cause, the tool output that supports it, what to do next and how
+// risky each step is, and where the full record is.
+//
+// The model writes the guess, the evidence and the next steps; the code
+// checks them against the conversation. An excerpt is looked up in the
+// results of the tool it is attributed to, and one that isn't there is
+// marked, not passed on as fact. A step that uses a Mutating tool is at
+// least medium risk, whatever the model says. What was done comes from
+// the tool calls themselves, not from the model's memory of them.
+
+// Risk levels of a next action.
+const (
+	RiskLow    = "low"    // Reads or checks; safe to run
+	RiskMedium = "medium" // Changes the system, can be undone
+	RiskHigh   = "high"   // Hard to undo, or affects users
+)
+
+// Handoff is what a human needs to take over a task.
+type Handoff struct {
+	Task       string     `json:"task"`
+	Reason     string     `json:"reason"`     // Why the agent stopped
+	Hypothesis string     `json:"hypothesis"` // The agent's best explanation of the cause
+	Evidence   []Evidence `json:"evidence"`
+	Next       []Action   `json:"next_actions"`
+	Done       []Step     `json:"done"`
+	Run        string     `json:"run,omitempty"`       // The run directory, if Config.Run is set
+	Artifacts  []string   `json:"artifacts,omitempty"` // Files in it, relative to Run: the transcript, the plan, blobs cited
+	Created    time.Time  `json:"created"`
+}
+
+// Evidence is tool output that supports the hypothesis.
+type Evidence struct {
+	Tool    string `json:"tool"`
+	Excerpt string `json:"excerpt"`
+	CallID  string `json:"call_id,omitempty"` // The call whose result has the excerpt; empty if none has
+}
+
+// Found reports whether the excerpt is in the result of a call of Tool.
+func (e Evidence) Found() bool { return e.CallID != "" }
+
+// Action is a proposed next step.
+type Action struct {
+	Action string `json:"action"`
+	Tool   string `json:"tool,omitempty"` // The agent's tool that does it, if any
+	Risk   string `json:"risk"`
+	Why    string `json:"why"`
+}
+
+// Step is a tool call the agent made, with the start of its result.
+type Step struct {
+	Tool      string `json:"tool"`
+	Arguments string `json:"arguments,omitempty"`
+	Result    string `json:"result"`
+}
+
+// handoffReply is what the model is asked for.
+type handoffReply struct {
+	Hypothesis string `json:"hypothesis" description:"The most likely cause, in one or two sentences. Say so if it is unknown."`
+	Evidence   []struct {
+		Tool    string `json:"tool" description:"The tool whose result shows it"`
+		Excerpt string `json:"excerpt" description:"A short verbatim quote from that result"`
+	} `json:"evidence"`
+	Next []struct {
+		Action string `json:"action" description:"What the human should do, as an instruction"`
+		Tool   string `json:"tool,omitempty" description:"The tool that does it, if one of yours does"`
+		Risk   string `json:"risk" enum:"low,medium,high" description:"low: reads or checks; medium: changes the system, can be undone; high: hard to undo, or affects users"`
+		Why    string `json:"why"`
+	} `json:"next_actions"`
+}
+
+var handoffSchema = schema.For[handoffReply]()
+
+// handoffPrompt asks for the handoff at the end of the conversation.
+const handoffPrompt = `You are handing this task over to a human on call, who has not seen this conversation. Reason for the handoff: %s
+
+Return JSON only, matching this schema:
+%s
+
+Quote evidence verbatim from tool results; don't paraphrase it. List next actions in the order to take them, checks first.`
+
+// Handoff asks the model for a handoff of the conversation so far, the
+// agent having stopped for reason, and checks it (see above). It doesn't
+// change the conversation.
+func (a *Agent) Handoff(ctx context.Context, reason string) (*Handoff, error) {
+	prompt := fmt.Sprintf(handoffPrompt, reason, handoffSchema.Raw())
+	req := openai.ChatCompletionRequest{
+		Model:          a.cfg.Model,
+		Messages:       append(slices.Clip(a.messages), openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: prompt}),
+		Temperature:    a.cfg.Temperatures.For(PhaseJSON),
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	}
+	a.step++
+	start := time.Now()
+	resp, err := a.client.ChatCompletion(ctx, req)
+	a.cfg.Trace.LLMRequest(ctx, a.step, req, resp, time.Since(start), err)
+	if err != nil {
+		return nil, fmt.Errorf("handoff: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("handoff: empty response")
+	}
+	if a.cfg.Run != nil {
+		a.cfg.Run.AddUsage(resp.Usage)
+	}
+	raw, err := parse.JSON[json.RawMessage]()(resp.Choices[0].Message.Content)
+	if err != nil {
+		return nil, fmt.Errorf("handoff: %w", err)
+	}
+	if err := handoffSchema.Validate(raw); err != nil {
+		return nil, fmt.Errorf("handoff: %w", err)
+	}
+	var reply handoffReply
+	if err := json.Unmarshal(raw, &reply); err != nil {
+		return nil, fmt.Errorf("handoff: %w", err)
+	}
+
+	h := &Handoff{Reason: reason, Hypothesis: reply.Hypothesis, Created: time.Now().UTC()}
+	results := map[string]string{}
+	for _, m := range a.messages {
+		switch m.Role {
+		case openai.ChatMessageRoleUser:
+			if h.Task == "" {
+				h.Task = m.Content
+			}
+		case openai.ChatMessageRoleTool:
+			results[m.ToolCallID] = m.Content
+		}
+	}
+	var calls []openai.ToolCall
+	for _, m := range a.messages {
+		for _, c := range m.ToolCalls {
+			if c.Function.Name == ReadMoreTool {
+				continue
+			}
+			calls = append(calls, c)
+			result, ok := results[c.ID]
+			if !ok {
+				result = "(no result)"
+			}
+			h.Done = append(h.Done, Step{Tool: c.Function.Name, Arguments: c.Function.Arguments, Result: cut(result)})
+		}
+	}
+	for _, e := range reply.Evidence {
+		ev := Evidence{Tool: e.Tool, Excerpt: e.Excerpt}
+		for _, c := range slices.Backward(calls) {
+			if c.Function.Name == e.Tool && containsFolded(results[c.ID], e.Excerpt) {
+				ev.CallID = c.ID
+				break
+			}
+		}
+		h.Evidence = append(h.Evidence, ev)
+	}
+	for _, n := range reply.Next {
+		act := Action{Action: n.Action, Tool: n.Tool, Risk: n.Risk, Why: n.Why}
+		if t, ok := a.tools.Get(n.Tool); ok && t.Mutating && act.Risk == RiskLow {
+			act.Risk = RiskMedium
+		}
+		h.Next = append(h.Next, act)
+	}
+	if a.cfg.Run != nil {
+		h.Run = a.cfg.Run.Dir
+		for _, f := range []string{runs.TranscriptFile, runs.PlanFile, runs.ReportFile, runs.PipelinesDir} {
+			if _, err := os.Stat(filepath.Join(h.Run, f)); err == nil {
+				h.Artifacts = append(h.Artifacts, f)
+			}
+		}
+		for _, ref := range blobRefs(a.messages) {
+			h.Artifacts = append(h.Artifacts, filepath.Join(runs.BlobsDir, strings.TrimPrefix(ref, blobs.Prefix)))
+		}
+	}
+	return h, nil
+}
+
+// containsFolded reports whether excerpt is in s, ignoring case and how
+// whitespace is laid out: the model quotes, but not always byte for byte.
+func containsFolded(s, excerpt string) bool {
+	norm := func(s string) string { return strings.ToLower(strings.Join(strings.Fields(s), " ")) }
+	excerpt = norm(excerpt)
+	return excerpt != "" && strings.Contains(norm(s), excerpt)
+}
+
+var blobRef = regexp.MustCompile(regexp.QuoteMeta(blobs.Prefix) + `[0-9a-f]+`)
+
+// blobRefs returns the blob references in msgs, each once.
+func blobRefs(msgs []openai.ChatCompletionMessage) []string {
+	var refs []string
+	for _, m := range msgs {
+		texts := []string{m.Content}
+		for _, c := range m.ToolCalls {
+			texts = append(texts, c.Function.Arguments)
+		}
+		for _, t := range texts {
+			for _, ref := range blobRef.FindAllString(t, -1) {
+				if !slices.Contains(refs, ref) {
+					refs = append(refs, ref)
+				}
+			}
+		}
+	}
+	return refs
+}
+
+// Markdown renders the handoff for a human: the page to read first.
+func (h *Handoff) Markdown() string {
+	var b strings.Builder
+	b.WriteString("# Handoff: needs a human\n\n")
+	fmt.Fprintf(&b, "**Task:** %s\n\n", oneLine(h.Task))
+	fmt.Fprintf(&b, "**Why the agent stopped:** %s\n\n", oneLine(h.Reason))
+	fmt.Fprintf(&b, "## Hypothesis\n\n%s\n\n", h.Hypothesis)
+
+	b.WriteString("## Evidence\n\n")
+	if len(h.Evidence) == 0 {
+		b.WriteString("None cited.\n")
+	}
+	for _, e := range h.Evidence {
+		note := ""
+		if !e.Found() {
+			note = " ⚠️ not found in the results of this tool: check it before relying on it"
+		}
+		fmt.Fprintf(&b, "- `%s`: %q%s\n", e.Tool, e.Excerpt, note)
+	}
+
+	b.WriteString("\n## Next Actions\n\n")
+	if len(h.Next) == 0 {
+		b.WriteString("None proposed.\n")
+	} else {
+		b.WriteString("| # | Action | Risk | Why |\n|---|--------|------|-----|\n")
+	}
+	for i, n := range h.Next {
+		action := n.Action
+		if n.Tool != "" {
+			action += fmt.Sprintf(" (`%s`)", n.Tool)
+		}
+		fmt.Fprintf(&b, "| %d | %s | %s | %s |\n", i+1, cell(action), riskIcon(n.Risk)+" "+n.Risk, cell(n.Why))
+	}
+
+	b.WriteString("\n## What Was Done\n\n")
+	if len(h.Done) == 0 {
+		b.WriteString("No tool calls.\n")
+	}
+	for i, s := range h.Done {
+		fmt.Fprintf(&b, "%d. `%s %s` → %s\n", i+1, s.Tool, s.Arguments, s.Result)
+	}
+
+	if h.Run != "" {
+		fmt.Fprintf(&b, "\n## Run Artifacts\n\nIn `%s`:\n\n", h.Run)
+		for _, f := range h.Artifacts {
+			fmt.Fprintf(&b, "- [%s](%s)\n", f, filepath.ToSlash(f))
+		}
+	}
+	fmt.Fprintf(&b, "\n_Created %s._\n", h.Created.Format(time.RFC3339))
+	return b.String()
+}
+
+func riskIcon(risk string) string {
+	switch risk {
+	case RiskLow:
+		return "🟢"
+	case RiskMedium:
+		return "🟡"
+	}
+	return "🔴"
+}
+
+// oneLine joins the lines of s, for a field on one line.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// cell makes s safe for a table cell.
+func cell(s string) string {
+	return strings.ReplaceAll(oneLine(s), "|", `\|`)
+}
@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"unicode/utf8"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Interruptible returns a context canceled by Ctrl+C (SIGINT) or SIGTERM.
+// The run then stops at the next LLM or tool call instead of dying in the
+// middle of one, and the lab can print what was done (see Recap). A second
+// Ctrl+C kills the process as usual. Call stop when the run is over.
+func Interruptible(ctx context.Context) (_ context.Context, stop context.CancelFunc) {
+	ctx, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop() // The next signal gets the default behavior: exit
+	}()
+	return ctx, stop
+}
+
+// recapResult is the length tool results and the model's text are cut to
+// in a recap.
+const recapResult = 120
+
+// Recap describes a conversation in a few lines, for a run that stopped
+// before its answer: the task, every tool call with its result (or that it
+// never ran), and the last thing the model said.
+func Recap(msgs []openai.ChatCompletionMessage) string {
+	results := map[string]string{}
+	for _, m := range msgs {
+		if m.Role == openai.ChatMessageRoleTool {
+			results[m.ToolCallID] = m.Content
+		}
+	}
+	var b strings.Builder
+	task, said := "", ""
+	replies, calls := 0, 0
+	var steps []string
+	for _, m := range msgs {
+		switch m.Role {
+		case openai.ChatMessageRoleUser:
+			if task == "" {
+				task = m.Content
+			}
+		case openai.ChatMessageRoleAssistant:
+			replies++
+			if m.Content != "" {
+				said = m.Content
+			}
+			for _, c := range m.ToolCalls {
+				calls++
+				result, ok := results[c.ID]
+				if !ok {
+					result = "(no result: interrupted)"
+				}
+				steps = append(steps, fmt.Sprintf("%d. %s(%s) → %s", calls, c.Function.Name, c.Function.Arguments, cut(result)))
+			}
+		}
+	}
+	fmt.Fprintf(&b, "Task: %s\n", cut(task))
+	fmt.Fprintf(&b, "Done: %d LLM replies, %d tool calls\n", replies, calls)
+	for _, s := range steps {
+		fmt.Fprintf(&b, "  %s\n", s)
+	}
+	if said != "" {
+		fmt.Fprintf(&b, "Last said: %s\n", cut(said))
+	}
+	return b.String()
+}
+
+// Recap describes the agent's conversation so far: see Recap.
+func (a *Agent) Recap() string {
+	return Recap(a.messages)
+}
+
+func cut(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= recapResult {
+		return s
+	}
+	return string([]rune(s)[:recapResult]) + "…"
+}
@@ -0,0 +1,61 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/kshvakov/agent/pkg/runs"
+	"github.com/sashabaranov/go-openai"
+)
+
+// checkLoop counts the calls of one reply by fingerprint (see
+// Config.LoopLimit). The first call to reach the limit gets the model a
+// nudge; a call at the limit after the nudge stops the Run. The results
+// are in the history either way, so the conversation stays valid.
+func (a *Agent) checkLoop(calls []openai.ToolCall) error {
+	if a.cfg.LoopLimit <= 0 {
+		return nil
+	}
+	for _, call := range calls {
+		key := fingerprint(call)
+		a.repeats[key]++
+		n := a.repeats[key]
+		if n < a.cfg.LoopLimit {
+			continue
+		}
+		if a.cfg.Strict {
+			return a.strictError(openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{call}},
+				ViolationRepeatedCall, "%s called %d times with the same arguments (LoopLimit %d)", call.Function.Name, n, a.cfg.LoopLimit)
+		}
+		if a.warned {
+			return fmt.Errorf("%w: %s(%s) called %d times, and the model was already asked to stop repeating calls",
+				ErrLoop, call.Function.Name, call.Function.Arguments, n)
+		}
+		a.warned = true
+		if a.cfg.Hooks.OnLoop != nil {
+			a.cfg.Hooks.OnLoop(call, n)
+		}
+		a.append(openai.ChatCompletionMessage{
+			Role: openai.ChatMessageRoleSystem,
+			Content: fmt.Sprintf("You have called %s with the same arguments %d times. Calling it again will not change the outcome. "+
+				"Act on the results you have, try a different tool, or answer and say what is blocking you.", call.Function.Name, n),
+		}, runs.MessageMeta{})
+		return nil
+	}
+	return nil
+}
+
+// fingerprint identifies a call by tool and arguments: the key of LoopLimit,
+// of the facts of a TTL (freshness.go) and of Once calls without an
+// IdempotencyKey. The arguments are compared as JSON values, so
+// {"host":"a"} and { "host": "a" } are the same call.
+func fingerprint(call openai.ToolCall) string {
+	args := call.Function.Arguments
+	var v any
+	if err := json.Unmarshal([]byte(args), &v); err == nil {
+		if data, err := json.Marshal(v); err == nil {
+			args = string(data)
+		}
+	}
+	return call.Function.Name + " " + args
+}
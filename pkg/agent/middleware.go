@@ -0,0 +1,242 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrBudget is returned from Run when TokenBudget or Config.Budget stops it.
+var ErrBudget = errors.New("agent: budget exceeded")
+
+// Chain combines Hooks into one, so middleware stacks up:
+//
+//	Hooks: agent.Chain(
+//		agent.TokenBudget(20_000),
+//		agent.Approval(ask, "restart_service"),
+//		agent.Hooks{OnThought: printThought},
+//	)
+//
+// The Before hooks run in order and the first to stop (an error, a
+// handled call) wins; the After hooks run in reverse order, like deferred
+// calls. Each other hook is taken from the first Hooks that sets it.
+func Chain(hooks ...Hooks) Hooks {
+	// Walking back, the first Hooks to set a hook is the last to assign it.
+	var out Hooks
+	for _, h := range slices.Backward(hooks) {
+		if h.OnThought != nil {
+			out.OnThought = h.OnThought
+		}
+		if h.OnToolCall != nil {
+			out.OnToolCall = h.OnToolCall
+		}
+		if h.OnToolResult != nil {
+			out.OnToolResult = h.OnToolResult
+		}
+		if h.OnContent != nil {
+			out.OnContent = h.OnContent
+		}
+		if h.OnReview != nil {
+			out.OnReview = h.OnReview
+		}
+		if h.OnLoop != nil {
+			out.OnLoop = h.OnLoop
+		}
+		if h.OnReverify != nil {
+			out.OnReverify = h.OnReverify
+		}
+		if h.Confirm != nil {
+			out.Confirm = h.Confirm
+		}
+		if h.OnPaged != nil {
+			out.OnPaged = h.OnPaged
+		}
+		if h.Repair != nil {
+			out.Repair = h.Repair
+		}
+	}
+
+	var beforeLLM []func(*openai.ChatCompletionRequest) error
+	var afterLLM []func(openai.ChatCompletionRequest, openai.ChatCompletionResponse, error)
+	var beforeTool []func(openai.ToolCall) (string, bool)
+	var afterTool []func(openai.ToolCall, string, error)
+	for _, h := range hooks {
+		if h.BeforeLLMCall != nil {
+			beforeLLM = append(beforeLLM, h.BeforeLLMCall)
+		}
+		if h.AfterLLMCall != nil {
+			afterLLM = append(afterLLM, h.AfterLLMCall)
+		}
+		if h.BeforeToolCall != nil {
+			beforeTool = append(beforeTool, h.BeforeToolCall)
+		}
+		if h.AfterToolCall != nil {
+			afterTool = append(afterTool, h.AfterToolCall)
+		}
+	}
+	if len(beforeLLM) > 0 {
+		out.BeforeLLMCall = func(req *openai.ChatCompletionRequest) error {
+			for _, fn := range beforeLLM {
+				if err := fn(req); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	if len(afterLLM) > 0 {
+		out.AfterLLMCall = func(req openai.ChatCompletionRequest, resp openai.ChatCompletionResponse, err error) {
+			for _, fn := range slices.Backward(afterLLM) {
+				fn(req, resp, err)
+			}
+		}
+	}
+	if len(beforeTool) > 0 {
+		out.BeforeToolCall = func(call openai.ToolCall) (string, bool) {
+			for _, fn := range beforeTool {
+				if result, handled := fn(call); handled {
+					return result, true
+				}
+			}
+			return "", false
+		}
+	}
+	if len(afterTool) > 0 {
+		out.AfterToolCall = func(call openai.ToolCall, result string, err error) {
+			for _, fn := range slices.Backward(afterTool) {
+				fn(call, result, err)
+			}
+		}
+	}
+	return out
+}
+
+// TokenBudget stops a run once its LLM calls have used limit tokens
+// (prompt and completion): the call that crosses the limit completes,
+// the next one returns ErrBudget. One budget can be shared by several
+// agents, e.g. a supervisor and its workers.
+func TokenBudget(limit int) Hooks {
+	var used atomic.Int64
+	return Hooks{
+		BeforeLLMCall: func(*openai.ChatCompletionRequest) error {
+			if n := used.Load(); n >= int64(limit) {
+				return fmt.Errorf("%w: %d of %d tokens used", ErrBudget, n, limit)
+			}
+			return nil
+		},
+		AfterLLMCall: func(_ openai.ChatCompletionRequest, resp openai.ChatCompletionResponse, err error) {
+			if err == nil {
+				used.Add(int64(resp.Usage.TotalTokens))
+			}
+		},
+	}
+}
+
+// ErrRefused is wrapped by the error of a call that middleware refused:
+// a BeforeToolCall hook handled it with a result "Error: ...". Only such a
+// result is a failure; a tool whose output starts with "Error: " ran.
+var ErrRefused = errors.New("agent: call refused")
+
+// refusedError is the error of a refused call; its message is the reason.
+type refusedError struct {
+	reason string
+}
+
+func (e *refusedError) Error() string { return e.reason }
+func (e *refusedError) Unwrap() error { return ErrRefused }
+
+// Approval asks a human before every call of the named tools; ask returns
+// true to run the call. A call that isn't approved doesn't run, and the
+// model is told so.
+func Approval(ask func(call openai.ToolCall) bool, tools ...string) Hooks {
+	return Hooks{
+		BeforeToolCall: func(call openai.ToolCall) (string, bool) {
+			if !slices.Contains(tools, call.Function.Name) || ask(call) {
+				return "", false
+			}
+			return "Error: the operator did not approve this call", true
+		},
+	}
+}
+
+// ChangeGuard limits how often unattended runs change a system: at most
+// one call of the guarded tools per target within Window. A call over the
+// limit doesn't run; it is queued for a human to review, and the model is
+// told so. An agent that flips between two fixes, or restarts a service
+// each time a check looks bad, can't flap it.
+//
+//	guard := &agent.ChangeGuard{Window: 10 * time.Minute, Tools: []string{"restart_service", "rollback_deploy"}}
+//	Hooks: agent.Chain(guard.Hooks(), ...)
+//
+// One guard can be shared by several agents and runs: the limit is global.
+type ChangeGuard struct {
+	Window time.Duration
+	Tools  []string // Guarded tools, usually the Mutating ones
+	// Target returns what a call changes, e.g. the "service" argument.
+	// Nil means every call changes the same system.
+	Target func(call openai.ToolCall) string
+	// Now is the clock; time.Now if nil.
+	Now func() time.Time
+
+	mu     sync.Mutex
+	last   map[string]time.Time // Last change per target
+	queued []Proposed
+}
+
+// Proposed is a change ChangeGuard held back for a human.
+type Proposed struct {
+	Call     openai.ToolCall
+	Target   string
+	At       time.Time // When it was proposed
+	LastDone time.Time // When the target was last changed
+}
+
+// Hooks returns the middleware that enforces the guard.
+func (g *ChangeGuard) Hooks() Hooks {
+	return Hooks{
+		BeforeToolCall: func(call openai.ToolCall) (string, bool) {
+			if !slices.Contains(g.Tools, call.Function.Name) {
+				return "", false
+			}
+			now := time.Now
+			if g.Now != nil {
+				now = g.Now
+			}
+			target := ""
+			if g.Target != nil {
+				target = g.Target(call)
+			}
+
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			at := now()
+			last, ok := g.last[target]
+			if !ok || at.Sub(last) >= g.Window {
+				if g.last == nil {
+					g.last = map[string]time.Time{}
+				}
+				g.last[target] = at
+				return "", false
+			}
+			g.queued = append(g.queued, Proposed{Call: call, Target: target, At: at, LastDone: last})
+			what := "the last change"
+			if target != "" {
+				what += " to " + target
+			}
+			return fmt.Sprintf("Error: not run: %s was %s ago, and unattended runs make at most one change per %s. "+
+				"The call is queued for human review; do not retry it.", what, at.Sub(last).Round(time.Second), g.Window), true
+		},
+	}
+}
+
+// Queued returns the changes held back so far, in the order they were proposed.
+func (g *ChangeGuard) Queued() []Proposed {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return slices.Clone(g.queued)
+}
@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/kshvakov/agent/pkg/tools"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Idempotency of dangerous calls.
+//
+// A call of a Once tool (delete_db, rollback_deploy) runs at most once per
+// Run for its idempotency key: Tool.IdempotencyKey of the arguments, or
+// the arguments compared as JSON values. A model that calls it again (it
+// lost track of the result, or didn't believe it) gets the result of the
+// first call and is told the call didn't run: one rollback, not two.
+//
+// A call that failed may run again, unless its outcome is unknown: a call
+// abandoned after its Timeout, or ended by a panic, may have done its work
+// before it stopped. Its repeats are refused, and the model is told to
+// check the system first.
+//
+// The keys are kept for the current Run, like the fingerprints of
+// LoopLimit. A Once call runs alone (see tools.Registry.Each), so two
+// copies of it in one reply can't both start.
+
+// onceCall is what the first call with a key did.
+type onceCall struct {
+	result  string // If it succeeded
+	unknown string // How it ended, if its outcome is unknown
+}
+
+// onceKey returns the idempotency key of a call of t.
+func onceKey(t tools.Tool, call openai.ToolCall) string {
+	if t.IdempotencyKey != nil {
+		return t.Name + " " + t.IdempotencyKey(json.RawMessage(call.Function.Arguments))
+	}
+	return fingerprint(call)
+}
+
+// ranOnce reports whether a call of a Once tool already ran in this Run,
+// with what the repeat gets instead of running.
+func (a *Agent) ranOnce(t tools.Tool, call openai.ToolCall) (ran bool, result string, err error) {
+	if !t.Once {
+		return false, "", nil
+	}
+	a.factsMu.Lock()
+	defer a.factsMu.Unlock()
+	c, ok := a.once[onceKey(t, call)]
+	switch {
+	case !ok:
+		return false, "", nil
+	case c.unknown != "":
+		return true, "", tools.WithHint(
+			fmt.Errorf("%s did not run: the same call already ran in this run and %s, so it may have done its work.", t.Name, c.unknown),
+			"Check the state of the system before deciding what to do.")
+	default:
+		return true, fmt.Sprintf("%s did not run: the same call already ran in this run. Its result:\n%s", t.Name, c.result), nil
+	}
+}
+
+// recordOnce records a call of a Once tool that ran. A call that failed
+// with a known outcome isn't recorded: it may run again.
+func (a *Agent) recordOnce(t tools.Tool, call openai.ToolCall, result string, err error) {
+	if !t.Once {
+		return
+	}
+	var timeout *tools.TimeoutError
+	var panicked *tools.PanicError
+	var c onceCall
+	switch {
+	case err == nil:
+		c.result = result
+	case errors.As(err, &timeout):
+		c.unknown = fmt.Sprintf("was abandoned after %s", timeout.After)
+	case errors.As(err, &panicked):
+		c.unknown = "panicked"
+	default:
+		return
+	}
+	a.factsMu.Lock()
+	defer a.factsMu.Unlock()
+	if a.once == nil {
+		a.once = map[string]onceCall{}
+	}
+	a.once[onceKey(t, call)] = c
+}
@@ -0,0 +1,288 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/tools"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Tool results too large for one request.
+//
+// A tool result can be larger than the model's context window on its own:
+// a log dump, the listing of a big directory. Condensing the history
+// doesn't help (the result is the newest message), so the request would
+// just fail. Instead the result is paged: its tool message holds the
+// first part and a continuation marker, and the model reads the rest with
+// the read_more tool, one part per turn. Only the part being read stays
+// in full: a part the model has moved on from becomes a one-line stub, so
+// reading a long result doesn't fill the window again.
+//
+// A result is paged when it is longer than Config.MaxToolResult, and
+// whatever that is, when a request overflows the context window (see
+// llm.IsContextOverflow) and the results of the last step are to blame:
+// the longest of them gets parts half its size, then half that, until the
+// request fits or the parts would be shorter than minPart.
+
+// ReadMoreTool is the tool the model reads the next part of a paged
+// result with. It is offered once a result has been paged.
+const ReadMoreTool = "read_more"
+
+// minPart is the shortest part a result is split into on an overflow:
+// a window that can't take this much more has no room for the answer.
+const minPart = 256
+
+// paged is a tool result sent in parts.
+type paged struct {
+	call    openai.ToolCall // The call that produced it; its ID names the result to the model
+	text    string
+	starts  []int  // Part i is text[starts[i]:starts[i+1]]
+	cur     int    // The part shown in full
+	shownBy string // ID of the tool call whose message shows it
+}
+
+func (p *paged) parts() int { return len(p.starts) - 1 }
+
+func (p *paged) part(i int) string { return p.text[p.starts[i]:p.starts[i+1]] }
+
+// pages are the paged results of an agent by the ID of the call that
+// produced them. Calls of one reply may run in parallel, so mu guards
+// them and the messages read_more rewrites.
+type pages struct {
+	mu     sync.Mutex
+	byCall map[string]*paged
+	tool   *tools.Registry // Just read_more
+}
+
+// readMoreArgs are the arguments of read_more.
+type readMoreArgs struct {
+	ID   string `json:"id" description:"The id from the continuation marker: the call that produced the result"`
+	Part int    `json:"part" description:"The part to read, from 1"`
+}
+
+// splitParts returns the starts of parts of s no longer than size bytes,
+// cut after a newline where one is in the second half of a part, and
+// never inside a UTF-8 character.
+func splitParts(s string, from, size int) []int {
+	starts := []int{from}
+	for at := from; at < len(s); {
+		end := min(at+size, len(s))
+		if end < len(s) {
+			if i := strings.LastIndexByte(s[at:end], '\n'); i >= size/2 {
+				end = at + i + 1
+			}
+			for end > at+1 && !utf8.RuneStart(s[end]) {
+				end--
+			}
+		}
+		starts = append(starts, end)
+		at = end
+	}
+	return starts
+}
+
+// marker tells the model where part i is in the result and how to read on.
+func (p *paged) marker(i int) string {
+	if i == p.parts()-1 {
+		return fmt.Sprintf("\n[part %d of %d: the end of the result]", i+1, p.parts())
+	}
+	return fmt.Sprintf("\n[part %d of %d, %d of %d bytes shown so far. Call %s with id %q and part %d for the rest.]",
+		i+1, p.parts(), p.starts[i+1], len(p.text), ReadMoreTool, p.call.ID, i+2)
+}
+
+// stub is what stays of part i once the model reads another one.
+func (p *paged) stub(i int) string {
+	return fmt.Sprintf("[part %d of %d of this result, read. Call %s with id %q and part %d to see it again.]",
+		i+1, p.parts(), ReadMoreTool, p.call.ID, i+1)
+}
+
+// page splits result of call into parts of size bytes and returns the
+// first one with its marker: the content of the call's tool message.
+func (a *Agent) page(call openai.ToolCall, result string, size int) string {
+	a.pages.mu.Lock()
+	defer a.pages.mu.Unlock()
+	p := &paged{call: call, text: result, starts: splitParts(result, 0, size), shownBy: call.ID}
+	a.pagesInit()
+	a.pages.byCall[call.ID] = p
+	if a.cfg.Hooks.OnPaged != nil {
+		a.cfg.Hooks.OnPaged(call, p.parts())
+	}
+	return p.part(0) + p.marker(0)
+}
+
+// pagesInit creates the read_more tool with the first paged result.
+// The caller holds pages.mu.
+func (a *Agent) pagesInit() {
+	if a.pages.byCall != nil {
+		return
+	}
+	a.pages.byCall = map[string]*paged{}
+	a.pages.tool = tools.NewRegistry(tools.New(ReadMoreTool,
+		"Read another part of a tool result that was too large to send at once. The end of each part says which part comes next.",
+		a.readMore))
+}
+
+// callIDKey carries the ID of the read_more call in progress.
+type callIDKey struct{}
+
+// readMore returns a part of a paged result and turns the part shown
+// before into a stub.
+func (a *Agent) readMore(ctx context.Context, args readMoreArgs) (string, error) {
+	a.pages.mu.Lock()
+	defer a.pages.mu.Unlock()
+	p, ok := a.pages.byCall[args.ID]
+	if !ok {
+		return "", fmt.Errorf("no paged result with id %q", args.ID)
+	}
+	if args.Part < 1 || args.Part > p.parts() {
+		return "", fmt.Errorf("the result has parts 1 to %d", p.parts())
+	}
+	for i := range a.messages {
+		if m := &a.messages[i]; m.Role == openai.ChatMessageRoleTool && m.ToolCallID == p.shownBy {
+			m.Content = p.stub(p.cur)
+		}
+	}
+	p.cur = args.Part - 1
+	p.shownBy, _ = ctx.Value(callIDKey{}).(string)
+	return p.part(p.cur) + p.marker(p.cur), nil
+}
+
+// fit makes the results of the last step smaller after a request
+// overflowed the context window: the longest one gets parts half the
+// size it has now. System messages after the results (the nudge of
+// LoopLimit) are skipped. It reports false if there is nothing left to
+// shrink.
+func (a *Agent) fit() bool {
+	a.pages.mu.Lock()
+	defer a.pages.mu.Unlock()
+	end := len(a.messages)
+	for end > 0 && a.messages[end-1].Role == openai.ChatMessageRoleSystem {
+		end--
+	}
+	longest, size := -1, 0
+	for i := end - 1; i >= 0 && a.messages[i].Role == openai.ChatMessageRoleTool; i-- {
+		if n := len(a.messages[i].Content); n > size {
+			longest, size = i, n
+		}
+	}
+	if longest < 0 || size/2 < minPart {
+		return false
+	}
+	m := &a.messages[longest]
+	a.pagesInit()
+	if p, ok := a.pageShownBy(m.ToolCallID); ok {
+		// A part that is still too large: split the rest of the result anew.
+		half := len(p.part(p.cur)) / 2
+		if half < minPart {
+			return false
+		}
+		p.starts = append(p.starts[:p.cur], splitParts(p.text, p.starts[p.cur], half)...)
+		m.Content = p.part(p.cur) + p.marker(p.cur)
+		if a.cfg.Hooks.OnPaged != nil {
+			a.cfg.Hooks.OnPaged(p.call, p.parts())
+		}
+		return true
+	}
+	p := &paged{call: a.toolCall(m.ToolCallID), text: m.Content, starts: splitParts(m.Content, 0, size/2), shownBy: m.ToolCallID}
+	a.pages.byCall[m.ToolCallID] = p
+	m.Content = p.part(0) + p.marker(0)
+	if a.cfg.Hooks.OnPaged != nil {
+		a.cfg.Hooks.OnPaged(p.call, p.parts())
+	}
+	return true
+}
+
+// pageShownBy returns the paged result shown by the message of call id.
+func (a *Agent) pageShownBy(id string) (*paged, bool) {
+	for _, p := range a.pages.byCall {
+		if p.shownBy == id {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// toolCall returns the call with id from the assistant messages.
+func (a *Agent) toolCall(id string) openai.ToolCall {
+	for _, m := range slices.Backward(a.messages) {
+		for _, c := range m.ToolCalls {
+			if c.ID == id {
+				return c
+			}
+		}
+	}
+	return openai.ToolCall{ID: id}
+}
+
+// pagingRegistry returns the registry of read_more; an empty one until
+// a result is paged, so the call fails as an unknown tool.
+func (a *Agent) pagingRegistry() *tools.Registry {
+	a.pages.mu.Lock()
+	defer a.pages.mu.Unlock()
+	if a.pages.tool == nil {
+		return tools.NewRegistry()
+	}
+	return a.pages.tool
+}
+
+// pagingTools returns the definition of read_more once a result is paged.
+func (a *Agent) pagingTools() []openai.Tool {
+	a.pages.mu.Lock()
+	defer a.pages.mu.Unlock()
+	if a.pages.tool == nil {
+		return nil
+	}
+	return a.pages.tool.Definitions()
+}
+
+// completeFitting makes the LLM call; while it overflows the context
+// window, it shrinks the results of the last step (see fit) and tries
+// again with them.
+func (a *Agent) completeFitting(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	resp, err := a.completion(ctx, req)
+	for llm.IsContextOverflow(err) && a.fit() {
+		req.Messages = a.refit(req.Messages)
+		req.Tools = append(req.Tools[:len(req.Tools):len(req.Tools)], a.missingPagingTools(req.Tools)...)
+		resp, err = a.completion(ctx, req)
+	}
+	return resp, err
+}
+
+// refit returns msgs, a request's copy of the conversation (which
+// Hooks.BeforeLLMCall may have trimmed), with the tool results as they
+// are in the conversation now.
+func (a *Agent) refit(msgs []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	now := map[string]string{}
+	for _, m := range a.messages {
+		if m.Role == openai.ChatMessageRoleTool {
+			now[m.ToolCallID] = m.Content
+		}
+	}
+	out := append([]openai.ChatCompletionMessage{}, msgs...)
+	for i, m := range out {
+		if c, ok := now[m.ToolCallID]; ok && m.Role == openai.ChatMessageRoleTool {
+			out[i].Content = c
+		}
+	}
+	return out
+}
+
+// missingPagingTools returns read_more if a request offering have
+// doesn't offer it yet. A request without tools (Report) doesn't get it.
+func (a *Agent) missingPagingTools(have []openai.Tool) []openai.Tool {
+	if len(have) == 0 {
+		return nil
+	}
+	for _, t := range have {
+		if t.Function != nil && t.Function.Name == ReadMoreTool {
+			return nil
+		}
+	}
+	return a.pagingTools()
+}
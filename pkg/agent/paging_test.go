@@ -0,0 +1,147 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/sashabaranov/go-openai"
+)
+
+// window is a model with a small context window: a request longer than
+// size bytes fails the way a real one does. Otherwise it gives the next
+// of replies.
+type window struct {
+	size    int
+	replies []openai.ChatCompletionMessage
+	sent    [][]openai.ChatCompletionMessage // Requests that fit
+}
+
+func (w *window) ChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	n := 0
+	for _, m := range req.Messages {
+		n += len(m.Content)
+		for _, c := range m.ToolCalls {
+			n += len(c.Function.Arguments)
+		}
+	}
+	if n > w.size {
+		return openai.ChatCompletionResponse{}, fmt.Errorf("this model's maximum context length is %d, the request has %d", w.size, n)
+	}
+	if len(w.replies) == 0 {
+		return openai.ChatCompletionResponse{}, fmt.Errorf("no reply left")
+	}
+	w.sent = append(w.sent, req.Messages)
+	reply := w.replies[0]
+	w.replies = w.replies[1:]
+	reply.Role = openai.ChatMessageRoleAssistant
+	return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: reply}}}, nil
+}
+
+func (w *window) Stream(context.Context, openai.ChatCompletionRequest) (llm.Stream, error) {
+	panic("not used")
+}
+
+func (w *window) Embeddings(context.Context, openai.EmbeddingRequest) (openai.EmbeddingResponse, error) {
+	panic("not used")
+}
+
+func call(id, name, args string) openai.ToolCall {
+	return openai.ToolCall{ID: id, Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: name, Arguments: args}}
+}
+
+// logsAgent is an agent over w with one tool, logs, whose result alone is
+// larger than the window.
+func logsAgent(w *window, cfg Config) *Agent {
+	a := New(w, cfg)
+	a.RegisterTool(Tool{Name: "logs", Description: "Read the logs.", Execute: func(context.Context, json.RawMessage) (string, error) {
+		var b strings.Builder
+		for i := range 100 {
+			fmt.Fprintf(&b, "12:%02d payment: upstream timed out\n", i%60)
+		}
+		return b.String(), nil
+	}})
+	return a
+}
+
+func TestOverflowPagesResult(t *testing.T) {
+	w := &window{size: 1500, replies: []openai.ChatCompletionMessage{
+		{ToolCalls: []openai.ToolCall{call("1", "logs", "{}")}},
+		{Content: "The upstream times out."},
+	}}
+	a := logsAgent(w, Config{SystemPrompt: "You are an SRE agent."})
+	answer, err := a.Run(context.Background(), "Why does payment fail?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer != "The upstream times out." {
+		t.Errorf("answer %q", answer)
+	}
+	last := w.sent[len(w.sent)-1]
+	result := last[len(last)-1]
+	if result.Role != openai.ChatMessageRoleTool || !strings.Contains(result.Content, "Call "+ReadMoreTool+` with id "1" and part 2`) {
+		t.Errorf("the result sent is not the first part with a marker:\n%s", result.Content)
+	}
+}
+
+// TestOverflowAfterNudge: the loop nudge comes after the results of the
+// step; the results are still the ones paged.
+func TestOverflowAfterNudge(t *testing.T) {
+	w := &window{size: 1500, replies: []openai.ChatCompletionMessage{
+		{ToolCalls: []openai.ToolCall{call("1", "logs", "{}"), call("2", "logs", "{}")}},
+		{Content: "The upstream times out."},
+	}}
+	a := logsAgent(w, Config{SystemPrompt: "You are an SRE agent.", LoopLimit: 2})
+	answer, err := a.Run(context.Background(), "Why does payment fail?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer != "The upstream times out." {
+		t.Errorf("answer %q", answer)
+	}
+	last := w.sent[len(w.sent)-1]
+	if nudge := last[len(last)-1]; nudge.Role != openai.ChatMessageRoleSystem {
+		t.Fatalf("the last message sent is %s, want the loop nudge", nudge.Role)
+	}
+	for _, m := range last {
+		if m.Role == openai.ChatMessageRoleTool && !strings.Contains(m.Content, "[part 1 of ") {
+			t.Errorf("result of call %s is not paged:\n%s", m.ToolCallID, m.Content)
+		}
+	}
+}
+
+// TestOverflowReadMore: the model reads the rest part by part, and a part
+// it moved on from becomes a stub, so every request fits.
+func TestOverflowReadMore(t *testing.T) {
+	w := &window{size: 1500, replies: []openai.ChatCompletionMessage{
+		{ToolCalls: []openai.ToolCall{call("1", "logs", "{}")}},
+		{ToolCalls: []openai.ToolCall{call("2", ReadMoreTool, `{"id": "1", "part": 2}`)}},
+		{ToolCalls: []openai.ToolCall{call("3", ReadMoreTool, `{"id": "1", "part": 3}`)}},
+		{Content: "The upstream times out."},
+	}}
+	a := logsAgent(w, Config{SystemPrompt: "You are an SRE agent."})
+	if _, err := a.Run(context.Background(), "Why does payment fail?"); err != nil {
+		t.Fatal(err)
+	}
+	msgs := a.Messages()
+	for _, m := range msgs {
+		if m.Role == openai.ChatMessageRoleTool && m.ToolCallID == "1" && !strings.HasPrefix(m.Content, "[part 1 of ") {
+			t.Errorf("part 1 is not a stub after the model read on:\n%s", m.Content)
+		}
+	}
+	if part := msgs[len(msgs)-2]; !strings.Contains(part.Content, "[part 3 of ") {
+		t.Errorf("the last result is not part 3:\n%s", part.Content)
+	}
+}
+
+func TestOverflowNothingToPage(t *testing.T) {
+	w := &window{size: 100}
+	a := logsAgent(w, Config{SystemPrompt: "You are an SRE agent."})
+	_, err := a.Run(context.Background(), strings.Repeat("Why does payment fail? ", 10))
+	if !llm.IsContextOverflow(err) {
+		t.Errorf("err = %v, want the overflow", err)
+	}
+}
@@ -0,0 +1,71 @@
+package agent
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kshvakov/agent/pkg/llm"
+)
+
+// Phase is the kind of work an LLM turn does. Phases need different
+// temperatures: a tool name or a JSON field must come out the same every
+// time, while a report for a human reads better with some variety.
+type Phase string
+
+const (
+	PhaseTools     Phase = "tools"     // Choosing a tool and generating its arguments
+	PhaseJSON      Phase = "json"      // Structured output: plans, scores, extracted fields
+	PhaseSummarize Phase = "summarize" // Condensing history
+	PhaseReport    Phase = "report"    // Free-form answer or report for a human
+)
+
+// Temperatures maps phases to temperatures.
+type Temperatures map[Phase]float32
+
+// DefaultTemperatures is used for phases missing from Config.Temperatures.
+var DefaultTemperatures = Temperatures{
+	PhaseTools:     0,
+	PhaseJSON:      0,
+	PhaseSummarize: 0.3,
+	PhaseReport:    0.7,
+}
+
+// For returns the temperature of the phase, falling back to DefaultTemperatures,
+// as a request sets it: 0 is llm.ZeroTemperature.
+func (t Temperatures) For(p Phase) float32 {
+	v, ok := t[p]
+	if !ok {
+		v = DefaultTemperatures[p]
+	}
+	if v == 0 {
+		return llm.ZeroTemperature
+	}
+	return v
+}
+
+// ParseTemperatures reads a flag value like "tools=0,report=0.9".
+// Phases not listed keep their defaults.
+func ParseTemperatures(s string) (Temperatures, error) {
+	t := Temperatures{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("temperatures: %q: want phase=value", part)
+		}
+		p := Phase(strings.TrimSpace(name))
+		if _, known := DefaultTemperatures[p]; !known {
+			return nil, fmt.Errorf("temperatures: unknown phase %q (want tools, json, summarize or report)", p)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 32)
+		if err != nil || v < 0 || v > 2 {
+			return nil, fmt.Errorf("temperatures: %s: want a number from 0 to 2, got %q", p, value)
+		}
+		t[p] = float32(v)
+	}
+	return t, nil
+}
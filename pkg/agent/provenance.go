@@ -0,0 +1,45 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kshvakov/agent/pkg/runs"
+	"github.com/sashabaranov/go-openai"
+)
+
+// metaKey carries the provenance of the tool call in progress.
+type metaKey struct{}
+
+// Annotate adds provenance to the result of the tool call in progress:
+// a retrieval tool reports the documents it returned, a tool that masks
+// or truncates its output reports the redaction.
+//
+//	agent.Annotate(ctx, runs.MessageMeta{Docs: []string{"rollback_policy.md"}})
+//
+// Outside of Tool.Execute it does nothing.
+func Annotate(ctx context.Context, meta runs.MessageMeta) {
+	if m, ok := ctx.Value(metaKey{}).(*runs.MessageMeta); ok {
+		*m = runs.Merge(*m, meta)
+	}
+}
+
+// Compact replaces messages[from:to] with summary, e.g. when condensing a
+// long history. The summary inherits the merged provenance of the replaced
+// messages, marked with the summarizer version, so the evidence behind them
+// stays traceable. The system prompt (message 0) can't be replaced.
+func (a *Agent) Compact(from, to int, summary openai.ChatCompletionMessage, summarizer string) error {
+	if from < 1 || to > len(a.messages) || from >= to {
+		return fmt.Errorf("agent: compact [%d:%d] of %d messages", from, to, len(a.messages))
+	}
+	meta := runs.Merge(append(a.metas[from:to:to], runs.MessageMeta{Summarizer: summarizer})...)
+
+	messages := append([]openai.ChatCompletionMessage{}, a.messages[:from]...)
+	metas := append([]runs.MessageMeta{}, a.metas[:from]...)
+	a.messages = append(append(messages, summary), a.messages[to:]...)
+	a.metas = append(append(metas, meta), a.metas[to:]...)
+	if a.cfg.Run != nil {
+		a.cfg.Run.AppendMessage(summary, meta)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Strict mode. By default the loop recovers from a model that breaks the
+// contract: a call of a tool that doesn't exist, or with arguments that
+// fail the schema, goes back to the model as an error result; a reply cut
+// off at the token limit counts as the answer; Hooks.Repair nudges a model
+// that described a call instead of making it, and LoopLimit one that
+// repeats itself. The run goes on, and nobody sees how often it happened.
+// With Config.Strict the first deviation stops the Run with a
+// *StrictError that shows it: the step, the rule, what the model wrote
+// and what it should have written.
+//
+// Paging a tool result and fitting a request into the context window stay
+// on: they are about sizes, not contracts.
+
+// ErrStrict is matched by every *StrictError.
+var ErrStrict = errors.New("agent: strict mode")
+
+// Violations a *StrictError reports.
+const (
+	ViolationUnknownTool      = "unknown_tool"      // A call of a tool that wasn't offered
+	ViolationInvalidArguments = "invalid_arguments" // Arguments that fail the tool's schema
+	ViolationTruncated        = "truncated"         // finish_reason "length": the reply was cut off
+	ViolationEmptyReply       = "empty_reply"       // Neither content nor tool calls
+	ViolationNoToolCall       = "no_tool_call"      // Hooks.Repair wanted a call, not text
+	ViolationRepeatedCall     = "repeated_call"     // The same call LoopLimit times
+)
+
+// strictHints say what a violation usually means, for the diagnostics.
+var strictHints = map[string]string{
+	ViolationUnknownTool:      "The model invented a tool or misspelled one. Check the tool names the prompt mentions; a model that fails Lab 00 test 4 does this often.",
+	ViolationInvalidArguments: "The model ignored the parameter schema. Check the parameter descriptions and required fields (Lab 00 test 9 checks this).",
+	ViolationTruncated:        "The reply hit the completion token limit. Raise MaxTokens, or ask for a shorter answer.",
+	ViolationEmptyReply:       "The server returned an empty message: often a template or tool-format problem of a local model.",
+	ViolationNoToolCall:       "The model described the call in text instead of making it. The model may not support tool calls (Lab 02 -tool-mode json).",
+	ViolationRepeatedCall:     "The model doesn't act on the results it gets. Check that the results say clearly what happened.",
+}
+
+// StrictError stops a Run in strict mode (Config.Strict).
+type StrictError struct {
+	Step      int
+	Violation string                       // One of the Violation constants
+	Detail    string                       // What exactly was wrong
+	Reply     openai.ChatCompletionMessage // The reply that broke the rule
+}
+
+func (e *StrictError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v: step %d: %s: %s", ErrStrict, e.Step, e.Violation, e.Detail)
+	if e.Reply.Content != "" {
+		content := e.Reply.Content
+		if r := []rune(content); len(r) > 500 {
+			content = string(r[:500]) + "…"
+		}
+		fmt.Fprintf(&b, "\n  The model wrote: %q", content)
+	}
+	for _, c := range e.Reply.ToolCalls {
+		fmt.Fprintf(&b, "\n  The model called: %s %s", c.Function.Name, c.Function.Arguments)
+	}
+	if hint := strictHints[e.Violation]; hint != "" {
+		fmt.Fprintf(&b, "\n  %s", hint)
+	}
+	return b.String()
+}
+
+func (e *StrictError) Unwrap() error { return ErrStrict }
+
+// strictError returns a *StrictError for reply at the current step.
+func (a *Agent) strictError(reply openai.ChatCompletionMessage, violation, format string, args ...any) error {
+	return &StrictError{Step: a.step, Violation: violation, Detail: fmt.Sprintf(format, args...), Reply: reply}
+}
+
+// checkStrict checks a reply against the contract in strict mode: not
+// cut off, not empty, every call of an offered tool with arguments that
+// fit its schema.
+func (a *Agent) checkStrict(msg openai.ChatCompletionMessage, finish openai.FinishReason) error {
+	if !a.cfg.Strict {
+		return nil
+	}
+	if finish == openai.FinishReasonLength {
+		return a.strictError(msg, ViolationTruncated, "the reply was cut off at the token limit (finish_reason %q)", finish)
+	}
+	if msg.Content == "" && len(msg.ToolCalls) == 0 {
+		return a.strictError(msg, ViolationEmptyReply, "the reply has no content and no tool calls")
+	}
+	for _, call := range msg.ToolCalls {
+		t, ok := a.tools.Get(call.Function.Name)
+		if !ok && call.Function.Name == ReadMoreTool {
+			t, ok = a.pagingRegistry().Get(call.Function.Name)
+		}
+		if !ok {
+			offered := a.ToolNames()
+			if a.pagingTools() != nil {
+				offered = append(offered, ReadMoreTool)
+			}
+			return a.strictError(msg, ViolationUnknownTool, "%s is not one of the tools offered (%s)",
+				call.Function.Name, strings.Join(offered, ", "))
+		}
+		if err := t.Params.Validate([]byte(call.Function.Arguments)); err != nil {
+			return a.strictError(msg, ViolationInvalidArguments, "arguments of %s: %v\n  Parameters: %s",
+				call.Function.Name, err, t.Params.Raw())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+// Package blobs keeps large intermediate data (logs, pipeline outputs,
+// big tool results) out of the model context.
+//
+// Data is stored in content-addressed files, and the model gets a short
+// reference token instead:
+//
+//	blob:3f2a9c0d41e5b7a8
+//
+// The model passes the token between tools like any other string; tools
+// call Resolve to get the data back. Identical data gets the same token
+// and is stored once.
+package blobs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Prefix starts every reference token.
+const Prefix = "blob:"
+
+// idLen is the number of hex digits of the SHA-256 used as the blob ID.
+// 16 digits are unique enough within one run and short for the model to copy.
+const idLen = 16
+
+var (
+	refPattern    = regexp.MustCompile(fmt.Sprintf(`^%s[0-9a-f]{%d}$`, Prefix, idLen))
+	refsInPattern = regexp.MustCompile(fmt.Sprintf(`%s[0-9a-f]{%d}\b`, Prefix, idLen))
+)
+
+// Store is a directory of content-addressed blobs. It is safe for concurrent use:
+// a blob is written to a temp file and renamed into place.
+type Store struct {
+	dir string
+}
+
+// Open creates dir if needed and returns a store backed by it.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create blob dir: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Put stores data and returns its reference token.
+func (s *Store) Put(data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	id := hex.EncodeToString(sum[:])[:idLen]
+	path := filepath.Join(s.dir, id)
+	if _, err := os.Stat(path); err == nil {
+		return Prefix + id, nil // Already stored
+	}
+
+	tmp, err := os.CreateTemp(s.dir, id+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return Prefix + id, nil
+}
+
+// Get returns the data behind a reference token.
+func (s *Store) Get(ref string) ([]byte, error) {
+	if !IsRef(ref) {
+		return nil, fmt.Errorf("not a blob reference: %q", ref)
+	}
+	id := strings.TrimPrefix(strings.TrimSpace(ref), Prefix)
+	data, err := os.ReadFile(filepath.Join(s.dir, id))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("unknown blob %s", ref)
+	}
+	return data, err
+}
+
+// IsRef reports whether s is exactly one reference token.
+func IsRef(s string) bool {
+	return refPattern.MatchString(strings.TrimSpace(s))
+}
+
+// Refs returns the reference tokens found anywhere in text, in order of
+// first appearance.
+func Refs(text string) []string {
+	var refs []string
+	seen := map[string]bool{}
+	for _, ref := range refsInPattern.FindAllString(text, -1) {
+		if !seen[ref] {
+			seen[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// Resolve returns the data if text is a reference token, and text itself otherwise.
+// Tools call it on inputs that may be either inline data or a reference.
+func (s *Store) Resolve(text string) (string, error) {
+	if !IsRef(text) {
+		return text, nil
+	}
+	data, err := s.Get(text)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Park keeps text inline if it fits into limit bytes. Otherwise it stores
+// the text and returns its head plus the reference token, so the model
+// sees what the data looks like and can pass the whole of it to the next tool.
+func (s *Store) Park(text string, limit int) (string, error) {
+	if len(text) <= limit {
+		return text, nil
+	}
+	ref, err := s.Put([]byte(text))
+	if err != nil {
+		return "", err
+	}
+	head := text[:limit]
+	if i := strings.LastIndexByte(head, '\n'); i > 0 {
+		head = head[:i] // Don't cut a line in half
+	}
+	return fmt.Sprintf("%s\n... [%d of %d bytes shown; full data: %s]", head, len(head), len(text), ref), nil
+}
@@ -0,0 +1,293 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// anthropicVersion is the Messages API version the adapter speaks.
+const anthropicVersion = "2023-06-01"
+
+// defaultAnthropicMaxTokens is used when the request sets no limit:
+// Anthropic requires max_tokens, OpenAI doesn't.
+const defaultAnthropicMaxTokens = 4096
+
+// Anthropic is a Provider for the Anthropic Messages API with tool use.
+type Anthropic struct {
+	baseURL string
+	apiKey  string
+}
+
+// NewAnthropic returns a provider for the Messages API at baseURL (e.g. https://api.anthropic.com).
+func NewAnthropic(baseURL, apiKey string) *Anthropic {
+	return &Anthropic{baseURL: strings.TrimRight(baseURL, "/"), apiKey: apiKey}
+}
+
+func (a *Anthropic) String() string {
+	return "anthropic " + a.baseURL
+}
+
+type anthropicBlock struct {
+	Type string `json:"type"` // text | tool_use | tool_result
+
+	Text string `json:"text,omitempty"`
+
+	ID    string          `json:"id,omitempty"` // tool_use
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	ToolUseID string `json:"tool_use_id,omitempty"` // tool_result
+	Content   string `json:"content,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"` // user | assistant
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicTool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema any    `json:"input_schema"`
+}
+
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	Tools         []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice    map[string]string  `json:"tool_choice,omitempty"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   float32            `json:"temperature"`
+	TopP          float32            `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type anthropicResponse struct {
+	ID         string           `json:"id"`
+	Model      string           `json:"model"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+func (a *Anthropic) headers() map[string]string {
+	return map[string]string{"x-api-key": a.apiKey, "anthropic-version": anthropicVersion}
+}
+
+// request converts an OpenAI request. The differences that matter:
+// system messages go to the top-level "system" (a system message in the
+// middle of the conversation, like a repair nudge, becomes user text);
+// tool calls are tool_use blocks of the assistant, tool results are
+// tool_result blocks of the user; roles must alternate.
+func (a *Anthropic) request(req openai.ChatCompletionRequest, stream bool) anthropicRequest {
+	out := anthropicRequest{
+		Model:         req.Model,
+		MaxTokens:     maxTokens(req),
+		Temperature:   min(req.Temperature, 1), // Anthropic's range is 0..1
+		TopP:          req.TopP,
+		StopSequences: req.Stop,
+		Stream:        stream,
+	}
+	if out.MaxTokens == 0 {
+		out.MaxTokens = defaultAnthropicMaxTokens
+	}
+
+	var system []string
+	add := func(role string, b anthropicBlock) {
+		if n := len(out.Messages); n > 0 && out.Messages[n-1].Role == role {
+			out.Messages[n-1].Content = append(out.Messages[n-1].Content, b)
+			return
+		}
+		out.Messages = append(out.Messages, anthropicMessage{Role: role, Content: []anthropicBlock{b}})
+	}
+	for _, m := range req.Messages {
+		switch m.Role {
+		case openai.ChatMessageRoleSystem, openai.ChatMessageRoleDeveloper:
+			if len(out.Messages) == 0 {
+				system = append(system, m.Content)
+			} else {
+				add("user", anthropicBlock{Type: "text", Text: "[system] " + m.Content})
+			}
+		case openai.ChatMessageRoleAssistant:
+			if m.Content != "" {
+				add("assistant", anthropicBlock{Type: "text", Text: m.Content})
+			}
+			for _, tc := range m.ToolCalls {
+				add("assistant", anthropicBlock{Type: "tool_use", ID: tc.ID, Name: tc.Function.Name, Input: jsonArgs(tc.Function.Arguments)})
+			}
+		case openai.ChatMessageRoleTool:
+			add("user", anthropicBlock{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.Content})
+		default:
+			add("user", anthropicBlock{Type: "text", Text: m.Content})
+		}
+	}
+	if f := req.ResponseFormat; f != nil && f.Type != openai.ChatCompletionResponseFormatTypeText {
+		// No JSON mode in the Messages API: ask for it in words.
+		system = append(system, "Respond with a single JSON object only, without any other text.")
+	}
+	out.System = strings.Join(system, "\n\n")
+
+	for _, t := range req.Tools {
+		if t.Function == nil {
+			continue
+		}
+		params := t.Function.Parameters
+		if params == nil {
+			params = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		out.Tools = append(out.Tools, anthropicTool{Name: t.Function.Name, Description: t.Function.Description, InputSchema: params})
+	}
+	if len(out.Tools) > 0 {
+		out.ToolChoice = anthropicToolChoice(req.ToolChoice)
+	}
+	return out
+}
+
+// anthropicToolChoice maps OpenAI's tool_choice: "auto", "required",
+// "none", or a ToolChoice naming a function.
+func anthropicToolChoice(choice any) map[string]string {
+	switch c := choice.(type) {
+	case string:
+		switch c {
+		case "required":
+			return map[string]string{"type": "any"}
+		case "none":
+			return map[string]string{"type": "none"}
+		}
+	case openai.ToolChoice:
+		return map[string]string{"type": "tool", "name": c.Function.Name}
+	case *openai.ToolChoice:
+		return map[string]string{"type": "tool", "name": c.Function.Name}
+	}
+	return nil // auto
+}
+
+func (a *Anthropic) ChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	var resp anthropicResponse
+	if err := postJSON(ctx, a.baseURL+"/v1/messages", a.headers(), a.request(req, false), &resp); err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	msg := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+	var text []string
+	for _, b := range resp.Content {
+		switch b.Type {
+		case "text":
+			text = append(text, b.Text)
+		case "tool_use":
+			msg.ToolCalls = append(msg.ToolCalls, openai.ToolCall{
+				ID:       b.ID,
+				Type:     openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: b.Name, Arguments: string(b.Input)},
+			})
+		}
+	}
+	msg.Content = strings.Join(text, "\n")
+	return openai.ChatCompletionResponse{
+		ID:      resp.ID,
+		Object:  "chat.completion",
+		Model:   resp.Model,
+		Choices: []openai.ChatCompletionChoice{{Message: msg, FinishReason: anthropicFinish(resp.StopReason)}},
+		Usage: openai.Usage{
+			PromptTokens:     resp.Usage.InputTokens,
+			CompletionTokens: resp.Usage.OutputTokens,
+			TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
+		},
+	}, nil
+}
+
+// anthropicEvent is one server-sent event of a streamed message.
+type anthropicEvent struct {
+	Type         string         `json:"type"`
+	Index        int            `json:"index"`
+	ContentBlock anthropicBlock `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"` // text_delta | input_json_delta
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (a *Anthropic) Stream(ctx context.Context, req openai.ChatCompletionRequest) (Stream, error) {
+	resp, err := post(ctx, a.baseURL+"/v1/messages", a.headers(), a.request(req, true))
+	if err != nil {
+		return nil, err
+	}
+	toolIndex := map[int]int{} // Content block index -> tool call index
+	return newLineStream(resp.Body, func(line []byte) (openai.ChatCompletionStreamResponse, bool, error) {
+		data, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			return openai.ChatCompletionStreamResponse{}, true, nil // "event:" lines; the type is in the data too
+		}
+		var ev anthropicEvent
+		if err := json.Unmarshal(bytes.TrimSpace(data), &ev); err != nil {
+			return openai.ChatCompletionStreamResponse{}, false, fmt.Errorf("llm: anthropic: bad stream event: %w", err)
+		}
+		var delta openai.ChatCompletionStreamChoiceDelta
+		switch ev.Type {
+		case "error":
+			return openai.ChatCompletionStreamResponse{}, false, fmt.Errorf("llm: anthropic: %s", ev.Error.Message)
+		case "content_block_start":
+			if ev.ContentBlock.Type != "tool_use" {
+				return openai.ChatCompletionStreamResponse{}, true, nil
+			}
+			i := len(toolIndex)
+			toolIndex[ev.Index] = i
+			delta.ToolCalls = []openai.ToolCall{{
+				Index:    &i,
+				ID:       ev.ContentBlock.ID,
+				Type:     openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: ev.ContentBlock.Name},
+			}}
+		case "content_block_delta":
+			switch ev.Delta.Type {
+			case "text_delta":
+				delta.Content = ev.Delta.Text
+			case "input_json_delta":
+				i := toolIndex[ev.Index]
+				delta.ToolCalls = []openai.ToolCall{{Index: &i, Function: openai.FunctionCall{Arguments: ev.Delta.PartialJSON}}}
+			default:
+				return openai.ChatCompletionStreamResponse{}, true, nil
+			}
+		case "message_delta":
+			if ev.Delta.StopReason == "" {
+				return openai.ChatCompletionStreamResponse{}, true, nil
+			}
+			return deltaChunk(delta, anthropicFinish(ev.Delta.StopReason)), false, nil
+		default: // message_start, content_block_stop, message_stop, ping
+			return openai.ChatCompletionStreamResponse{}, true, nil
+		}
+		return deltaChunk(delta, ""), false, nil
+	}), nil
+}
+
+// Embeddings is not offered by the Anthropic API.
+func (a *Anthropic) Embeddings(context.Context, openai.EmbeddingRequest) (openai.EmbeddingResponse, error) {
+	return openai.EmbeddingResponse{}, fmt.Errorf("anthropic embeddings: %w", ErrNotSupported)
+}
+
+func anthropicFinish(reason string) openai.FinishReason {
+	switch reason {
+	case "tool_use":
+		return openai.FinishReasonToolCalls
+	case "max_tokens":
+		return openai.FinishReasonLength
+	default:
+		return openai.FinishReasonStop
+	}
+}
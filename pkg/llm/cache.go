@@ -0,0 +1,144 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Response cache ---
+//
+// Working on a lab means running it again and again, and every run sends
+// the same first requests: the same system prompt, the same task, the same
+// tools. Against a paid API each of them costs tokens, and the answer is
+// one the run has already had. WithCache keeps the replies on disk, one
+// file per request, and answers a request it has seen from the file.
+//
+// The key is the hash of the whole request: model, messages, tools,
+// temperature and the rest. Change anything in the prompt and the request
+// goes to the model; the next run gets the new reply from the cache. Unlike
+// a cassette (see Replay) the cache has no order and no end: a run takes
+// from it what it asks for and gets the rest from the model.
+
+// WithCache returns a provider that answers requests from the cache in dir
+// and passes the rest to p, saving each successful reply. A cached reply
+// costs nothing, so put WithCache above WithUsage: the usage summary then
+// shows what the run really spent.
+func WithCache(p Provider, dir string) Provider {
+	return &cached{Provider: p, dir: dir}
+}
+
+type cached struct {
+	Provider
+	dir string
+}
+
+func (c *cached) String() string {
+	return fmt.Sprint(c.Provider)
+}
+
+// path returns the file of a request of kind.
+func (c *cached) path(kind string, req json.RawMessage) string {
+	sum := sha256.Sum256([]byte(kind + "\n" + canonical(req)))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// load returns the cached interaction at path; ok is false if there is none.
+func (c *cached) load(path string) (it interaction, ok bool, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return it, false, nil
+	}
+	if err != nil {
+		return it, false, fmt.Errorf("llm: cache: %w", err)
+	}
+	if err := json.Unmarshal(data, &it); err != nil {
+		// A file cut short by a killed run: ask the model again.
+		return it, false, nil
+	}
+	return it, true, nil
+}
+
+// store writes i to path, atomically: parallel runs share the cache.
+func (c *cached) store(path string, i interaction) error {
+	data, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return fmt.Errorf("llm: cache: %w", err)
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return fmt.Errorf("llm: cache: %w", err)
+	}
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("llm: cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("llm: cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("llm: cache: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (c *cached) ChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	body := requestJSON(req)
+	path := c.path(kindChat, body)
+	it, ok, err := c.load(path)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	if ok && it.Response != nil {
+		return *it.Response, nil
+	}
+	resp, err := c.Provider.ChatCompletion(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	return resp, c.store(path, interaction{Kind: kindChat, Request: body, Response: &resp})
+}
+
+func (c *cached) Stream(ctx context.Context, req openai.ChatCompletionRequest) (Stream, error) {
+	body := requestJSON(req)
+	path := c.path(kindStream, body)
+	it, ok, err := c.load(path)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return &replayedStream{chunks: it.Chunks}, nil
+	}
+	s, err := c.Provider.Stream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	save := func(i interaction) error { return c.store(path, i) }
+	return &recordedStream{Stream: s, save: save, req: body}, nil
+}
+
+func (c *cached) Embeddings(ctx context.Context, req openai.EmbeddingRequest) (openai.EmbeddingResponse, error) {
+	body := requestJSON(req)
+	path := c.path(kindEmbeddings, body)
+	it, ok, err := c.load(path)
+	if err != nil {
+		return openai.EmbeddingResponse{}, err
+	}
+	if ok && it.Embeddings != nil {
+		return *it.Embeddings, nil
+	}
+	resp, err := c.Provider.Embeddings(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	return resp, c.store(path, interaction{Kind: kindEmbeddings, Request: body, Embeddings: &resp})
+}
@@ -0,0 +1,254 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Record and replay ---
+//
+// A model answers the same prompt differently from run to run, so two runs
+// of a lab are never the same. WithRecording saves every request and the
+// response to it in a cassette file (testdata/<name>.json); Replay plays
+// the file back instead of a model. A replayed run gets exactly the
+// replies of the recorded one, so its transcript is reproducible: labs
+// ship golden runs, and a solution is graded against the same model
+// behavior on any machine, offline.
+
+// Interaction kinds in a cassette.
+const (
+	kindChat       = "chat"
+	kindStream     = "stream"
+	kindEmbeddings = "embeddings"
+)
+
+// interaction is one recorded call: the request as sent and what came back.
+type interaction struct {
+	Kind       string                                `json:"kind"`
+	Request    json.RawMessage                       `json:"request"`
+	Response   *openai.ChatCompletionResponse        `json:"response,omitempty"`
+	Chunks     []openai.ChatCompletionStreamResponse `json:"chunks,omitempty"`
+	Embeddings *openai.EmbeddingResponse             `json:"embeddings,omitempty"`
+}
+
+type cassette struct {
+	Interactions []interaction `json:"interactions"`
+}
+
+// WithRecording returns a provider that passes calls to p and saves each
+// successful one to the cassette at path, rewritten after every call, so
+// an interrupted run keeps what it has done. Failed calls are not saved:
+// a replay answers the retry that succeeded.
+func WithRecording(p Provider, path string) Provider {
+	return &recorder{Provider: p, path: path}
+}
+
+type recorder struct {
+	Provider
+	path string
+
+	mu   sync.Mutex
+	tape cassette
+}
+
+func (r *recorder) save(i interaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tape.Interactions = append(r.tape.Interactions, i)
+	data, err := json.MarshalIndent(r.tape, "", "  ")
+	if err != nil {
+		return fmt.Errorf("llm: record: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return fmt.Errorf("llm: record: %w", err)
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("llm: record: %w", err)
+	}
+	return os.Rename(tmp, r.path)
+}
+
+func (r *recorder) ChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	resp, err := r.Provider.ChatCompletion(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	return resp, r.save(interaction{Kind: kindChat, Request: requestJSON(req), Response: &resp})
+}
+
+func (r *recorder) Stream(ctx context.Context, req openai.ChatCompletionRequest) (Stream, error) {
+	s, err := r.Provider.Stream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &recordedStream{Stream: s, save: r.save, req: requestJSON(req)}, nil
+}
+
+func (r *recorder) Embeddings(ctx context.Context, req openai.EmbeddingRequest) (openai.EmbeddingResponse, error) {
+	resp, err := r.Provider.Embeddings(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	return resp, r.save(interaction{Kind: kindEmbeddings, Request: requestJSON(req), Embeddings: &resp})
+}
+
+// recordedStream collects the chunks and saves them when the stream ends.
+// A stream closed before its end is not saved.
+type recordedStream struct {
+	Stream
+	save   func(interaction) error
+	req    json.RawMessage
+	chunks []openai.ChatCompletionStreamResponse
+}
+
+func (s *recordedStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	chunk, err := s.Stream.Recv()
+	switch {
+	case err == nil:
+		s.chunks = append(s.chunks, chunk)
+	case errors.Is(err, io.EOF):
+		if err := s.save(interaction{Kind: kindStream, Request: s.req, Chunks: s.chunks}); err != nil {
+			return chunk, err
+		}
+	}
+	return chunk, err
+}
+
+// requestJSON is the form requests are recorded and matched in.
+func requestJSON(req any) json.RawMessage {
+	data, err := json.Marshal(req)
+	if err != nil {
+		// Requests are plain values; marshaling can't fail.
+		panic(fmt.Sprintf("llm: %v", err))
+	}
+	return data
+}
+
+// Replay returns a provider that answers from the cassette at path instead
+// of a model. A request gets the reply recorded for the same request; a
+// request that was not recorded as is (the code under test builds its
+// prompts differently) gets the next unused reply of its kind, in the
+// recorded order, and onMismatch, if set, is told about it. A run that
+// asks for more than was recorded fails.
+func Replay(path string, onMismatch func(kind string, n int)) (Provider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("llm: replay: %w", err)
+	}
+	var tape cassette
+	if err := json.Unmarshal(data, &tape); err != nil {
+		return nil, fmt.Errorf("llm: replay %s: %w", path, err)
+	}
+	r := &replayer{path: path, tape: tape.Interactions, used: make([]bool, len(tape.Interactions)), onMismatch: onMismatch}
+	for _, it := range r.tape {
+		r.keys = append(r.keys, canonical(it.Request))
+	}
+	return r, nil
+}
+
+type replayer struct {
+	path       string
+	onMismatch func(kind string, n int)
+
+	mu    sync.Mutex
+	tape  []interaction
+	keys  []string // Requests of tape, canonical
+	used  []bool
+	calls map[string]int // Calls so far by kind, for messages
+}
+
+// canonical returns the JSON of a request without the indentation of the
+// cassette file, so recorded and live requests compare as strings.
+func canonical(data json.RawMessage) string {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return string(data)
+	}
+	out, _ := json.Marshal(v)
+	return string(out)
+}
+
+// next returns the recorded interaction for a request of kind.
+func (r *replayer) next(kind string, req json.RawMessage) (interaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.calls == nil {
+		r.calls = map[string]int{}
+	}
+	r.calls[kind]++
+
+	key := canonical(req)
+	first := -1
+	for i, it := range r.tape {
+		if r.used[i] || it.Kind != kind {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		if r.keys[i] == key {
+			r.used[i] = true
+			return it, nil
+		}
+	}
+	if first < 0 {
+		return interaction{}, fmt.Errorf("llm: replay %s: %s call %d was not recorded", r.path, kind, r.calls[kind])
+	}
+	if r.onMismatch != nil {
+		r.onMismatch(kind, r.calls[kind])
+	}
+	r.used[first] = true
+	return r.tape[first], nil
+}
+
+func (r *replayer) String() string {
+	return "replay " + r.path
+}
+
+func (r *replayer) ChatCompletion(_ context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	it, err := r.next(kindChat, requestJSON(req))
+	if err != nil || it.Response == nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	return *it.Response, nil
+}
+
+func (r *replayer) Stream(_ context.Context, req openai.ChatCompletionRequest) (Stream, error) {
+	it, err := r.next(kindStream, requestJSON(req))
+	if err != nil {
+		return nil, err
+	}
+	return &replayedStream{chunks: it.Chunks}, nil
+}
+
+func (r *replayer) Embeddings(_ context.Context, req openai.EmbeddingRequest) (openai.EmbeddingResponse, error) {
+	it, err := r.next(kindEmbeddings, requestJSON(req))
+	if err != nil || it.Embeddings == nil {
+		return openai.EmbeddingResponse{}, err
+	}
+	return *it.Embeddings, nil
+}
+
+type replayedStream struct {
+	chunks []openai.ChatCompletionStreamResponse
+}
+
+func (s *replayedStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	if len(s.chunks) == 0 {
+		return openai.ChatCompletionStreamResponse{}, io.EOF
+	}
+	chunk := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return chunk, nil
+}
+
+func (s *replayedStream) Close() error { return nil }
@@ -0,0 +1,80 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// StatusError is an error response from the backend. Its methods let
+// pkg/llm/retry tell a rate limit from a bad request and honor Retry-After.
+type StatusError struct {
+	Code  int           // HTTP status code
+	After time.Duration // Retry-After from the response, 0 if absent
+	Err   error
+}
+
+func (e *StatusError) Error() string             { return e.Err.Error() }
+func (e *StatusError) Unwrap() error             { return e.Err }
+func (e *StatusError) HTTPStatus() int           { return e.Code }
+func (e *StatusError) RetryAfter() time.Duration { return e.After }
+
+// parseRetryAfter reads a Retry-After header: seconds or an HTTP date.
+func parseRetryAfter(h string) time.Duration {
+	if h == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(h); err == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+// go-openai doesn't expose response headers on errors, so the OpenAI
+// adapter records Retry-After in its transport, into a holder passed
+// along with the request context.
+type retryAfterKey struct{}
+
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && resp.StatusCode/100 != 2 {
+		if after, ok := req.Context().Value(retryAfterKey{}).(*time.Duration); ok {
+			*after = parseRetryAfter(resp.Header.Get("Retry-After"))
+		}
+	}
+	return resp, err
+}
+
+// withRetryAfter returns a context whose requests record Retry-After.
+func withRetryAfter(ctx context.Context) (context.Context, *time.Duration) {
+	after := new(time.Duration)
+	return context.WithValue(ctx, retryAfterKey{}, after), after
+}
+
+// openAIError wraps go-openai errors that carry an HTTP status into a StatusError.
+func openAIError(err error, after time.Duration) error {
+	code := 0
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		code = apiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		code = reqErr.HTTPStatusCode
+	}
+	if code == 0 {
+		return err
+	}
+	return &StatusError{Code: code, After: after, Err: err}
+}
@@ -0,0 +1,126 @@
+package llm
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/kshvakov/agent/pkg/llm/retry"
+	"github.com/kshvakov/agent/pkg/llm/usage"
+	"github.com/sashabaranov/go-openai"
+)
+
+// WithFailover returns a provider that sends calls to the first of
+// providers and moves to the next one when a call fails in a way another
+// backend may not: the server is down or overloaded after all retries
+// (wrap each provider in WithRetry), it lacks the capability (embeddings
+// on Anthropic, a model it doesn't have), or it rejects the credentials.
+// A bad request fails the same way everywhere and is returned as is.
+//
+// The switch sticks: the backend that failed is not tried again in this
+// process, so every call doesn't pay the retries first. Chat and
+// embeddings fail over separately. onSwitch, if set, is told about every
+// switch.
+//
+//	local → second local → cloud:
+//	p := llm.WithFailover(logSwitch, llamaGPU1, llamaGPU2, openAI)
+func WithFailover(onSwitch func(from, to Provider, err error), providers ...Provider) Provider {
+	if len(providers) == 1 {
+		return providers[0]
+	}
+	return &failover{providers: providers, onSwitch: onSwitch}
+}
+
+type failover struct {
+	providers []Provider
+	onSwitch  func(from, to Provider, err error)
+	chat      atomic.Int32 // Index of the provider chat calls go to
+	embed     atomic.Int32 // Same for embeddings
+}
+
+// failsOver reports whether another backend might succeed where err
+// happened.
+func failsOver(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if retry.Transient(err) || errors.Is(err, ErrNotSupported) {
+		return true
+	}
+	var st interface{ HTTPStatus() int }
+	if errors.As(err, &st) {
+		switch st.HTTPStatus() {
+		case 401, 403, 404, 501: // Bad key, unknown model, missing endpoint
+			return true
+		}
+	}
+	return false
+}
+
+// use calls fn with the provider at, moving at down the list while the
+// call fails over.
+func use[T any](f *failover, ctx context.Context, at *atomic.Int32, fn func(Provider) (T, error)) (T, error) {
+	for {
+		i := int(at.Load())
+		resp, err := fn(f.providers[i])
+		if err == nil || i == len(f.providers)-1 || ctx.Err() != nil || !failsOver(err) {
+			return resp, err
+		}
+		// Calls running in parallel may fail together: one switch is enough.
+		if at.CompareAndSwap(int32(i), int32(i+1)) && f.onSwitch != nil {
+			f.onSwitch(f.providers[i], f.providers[i+1], err)
+		}
+	}
+}
+
+func (f *failover) ChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	return use(f, ctx, &f.chat, func(p Provider) (openai.ChatCompletionResponse, error) {
+		return p.ChatCompletion(ctx, req)
+	})
+}
+
+// Stream fails over until the stream is established, like WithRetry.
+func (f *failover) Stream(ctx context.Context, req openai.ChatCompletionRequest) (Stream, error) {
+	return use(f, ctx, &f.chat, func(p Provider) (Stream, error) {
+		return p.Stream(ctx, req)
+	})
+}
+
+func (f *failover) Embeddings(ctx context.Context, req openai.EmbeddingRequest) (openai.EmbeddingResponse, error) {
+	return use(f, ctx, &f.embed, func(p Provider) (openai.EmbeddingResponse, error) {
+		return p.Embeddings(ctx, req)
+	})
+}
+
+func (f *failover) String() string {
+	return fmt.Sprint(f.providers[f.chat.Load()])
+}
+
+// failoverFromEnv builds the chain for LLM_FAILOVER: primary (the
+// LLM_PROVIDER backend, called name) first, then the backends of spec.
+// Usage is recorded per backend.
+func failoverFromEnv(primary Provider, name, model, spec string, policy retry.Policy) (Provider, error) {
+	embedding := os.Getenv("LLM_EMBEDDING_MODEL")
+	member := func(p Provider, via, model string) Provider {
+		return WithRetry(WithModel(withCacheFromEnv(&metered{Provider: p, tracker: usage.Default, via: via}), model, embedding), policy)
+	}
+	chain := []Provider{member(primary, name, model)}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		via, m, _ := strings.Cut(item, "=")
+		kind, baseURL, _ := strings.Cut(via, "@")
+		m = cmp.Or(m, model)
+		p, err := newProvider(strings.ToLower(kind), baseURL, m)
+		if err != nil {
+			return nil, fmt.Errorf("%w (LLM_FAILOVER item %q)", err, item)
+		}
+		chain = append(chain, member(p, via, m))
+	}
+	return WithFailover(func(from, to Provider, err error) {
+		fmt.Fprintf(os.Stderr, "llm: %v failed: %v; switching to %v\n", from, err, to)
+	}, chain...), nil
+}
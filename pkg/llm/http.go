@@ -0,0 +1,104 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// post sends body as JSON and returns the response if the status is 2xx,
+// a *StatusError otherwise. The caller closes the body.
+func post(ctx context.Context, url string, headers map[string]string, body any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &StatusError{
+			Code:  resp.StatusCode,
+			After: parseRetryAfter(resp.Header.Get("Retry-After")),
+			Err:   fmt.Errorf("llm: %s: %s: %s", url, resp.Status, bytes.TrimSpace(msg)),
+		}
+	}
+	return resp, nil
+}
+
+// postJSON is post that decodes the response into out.
+func postJSON(ctx context.Context, url string, headers map[string]string, body, out any) error {
+	resp, err := post(ctx, url, headers, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("llm: %s: bad response: %w", url, err)
+	}
+	return nil
+}
+
+// lineStream is the Stream for backends that send one JSON event per line
+// (Ollama's NDJSON, Anthropic's SSE "data:" lines). next converts an event
+// into a chunk; skip=true means the event carries nothing for the caller.
+type lineStream struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+	next    func(line []byte) (chunk openai.ChatCompletionStreamResponse, skip bool, err error)
+}
+
+func newLineStream(body io.ReadCloser, next func([]byte) (openai.ChatCompletionStreamResponse, bool, error)) *lineStream {
+	sc := bufio.NewScanner(body)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	return &lineStream{body: body, scanner: sc, next: next}
+}
+
+func (s *lineStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	for s.scanner.Scan() {
+		line := bytes.TrimSpace(s.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		chunk, skip, err := s.next(line)
+		if err != nil {
+			return openai.ChatCompletionStreamResponse{}, err
+		}
+		if !skip {
+			return chunk, nil
+		}
+	}
+	if err := s.scanner.Err(); err != nil {
+		return openai.ChatCompletionStreamResponse{}, err
+	}
+	return openai.ChatCompletionStreamResponse{}, io.EOF
+}
+
+func (s *lineStream) Close() error {
+	return s.body.Close()
+}
+
+// deltaChunk wraps a delta into a one-choice stream response.
+func deltaChunk(delta openai.ChatCompletionStreamChoiceDelta, finish openai.FinishReason) openai.ChatCompletionStreamResponse {
+	return openai.ChatCompletionStreamResponse{
+		Object:  "chat.completion.chunk",
+		Choices: []openai.ChatCompletionStreamChoice{{Delta: delta, FinishReason: finish}},
+	}
+}
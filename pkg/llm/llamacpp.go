@@ -0,0 +1,110 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kshvakov/agent/pkg/schema"
+	"github.com/sashabaranov/go-openai"
+)
+
+// LlamaCpp is a Provider for llama.cpp's llama-server that constrains JSON
+// output with a GBNF grammar. Requests asking for JSON (a planner's plan,
+// a judge's scores) are sent with a grammar built from their schema
+// (schema.GBNF): the server samples only tokens that keep the output
+// valid, so a 7B model can't wrap the plan in prose or drop a required
+// field. Everything else goes through the OpenAI-compatible API as is.
+//
+// A request with tools gets no grammar: it would forbid the tool calls.
+type LlamaCpp struct {
+	*OpenAI
+	baseURL string
+	headers map[string]string
+}
+
+// NewLlamaCpp returns a provider for the llama-server at baseURL (e.g.
+// http://localhost:8080/v1). token is the server's --api-key, if any.
+func NewLlamaCpp(baseURL, token string) *LlamaCpp {
+	l := &LlamaCpp{OpenAI: NewOpenAI(baseURL, token), baseURL: strings.TrimRight(baseURL, "/")}
+	if token != "" {
+		l.headers = map[string]string{"Authorization": "Bearer " + token}
+	}
+	return l
+}
+
+func (l *LlamaCpp) String() string {
+	return "llama.cpp " + l.baseURL + " (grammar)"
+}
+
+// llamaCppRequest is a chat request with llama-server's grammar field.
+// response_format is dropped: the server takes a grammar or a schema,
+// not both.
+type llamaCppRequest struct {
+	openai.ChatCompletionRequest
+	Grammar string `json:"grammar"`
+}
+
+// grammar returns the grammar for req, or "" if req doesn't ask for JSON.
+func grammar(req openai.ChatCompletionRequest) (string, error) {
+	f := req.ResponseFormat
+	if f == nil || f.Type == openai.ChatCompletionResponseFormatTypeText || len(req.Tools) > 0 {
+		return "", nil
+	}
+	s := schema.Object() // json_object: any object
+	if f.Type == openai.ChatCompletionResponseFormatTypeJSONSchema && f.JSONSchema != nil && f.JSONSchema.Schema != nil {
+		data, err := json.Marshal(f.JSONSchema.Schema)
+		if err != nil {
+			return "", fmt.Errorf("llm: llama.cpp: response schema: %w", err)
+		}
+		if s, err = schema.Parse(data); err != nil {
+			return "", fmt.Errorf("llm: llama.cpp: response schema: %w", err)
+		}
+	}
+	return s.GBNF(), nil
+}
+
+func (l *LlamaCpp) ChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	g, err := grammar(req)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	if g == "" {
+		return l.OpenAI.ChatCompletion(ctx, req)
+	}
+	req.ResponseFormat = nil
+	var resp openai.ChatCompletionResponse
+	err = postJSON(ctx, l.baseURL+"/chat/completions", l.headers, llamaCppRequest{req, g}, &resp)
+	return resp, err
+}
+
+func (l *LlamaCpp) Stream(ctx context.Context, req openai.ChatCompletionRequest) (Stream, error) {
+	g, err := grammar(req)
+	if err != nil {
+		return nil, err
+	}
+	if g == "" {
+		return l.OpenAI.Stream(ctx, req)
+	}
+	req.ResponseFormat = nil
+	req.Stream = true
+	resp, err := post(ctx, l.baseURL+"/chat/completions", l.headers, llamaCppRequest{req, g})
+	if err != nil {
+		return nil, err
+	}
+	// The OpenAI SSE format: "data: {chunk}" lines, then "data: [DONE]".
+	return newLineStream(resp.Body, func(line []byte) (openai.ChatCompletionStreamResponse, bool, error) {
+		var chunk openai.ChatCompletionStreamResponse
+		data, ok := bytes.CutPrefix(line, []byte("data:"))
+		data = bytes.TrimSpace(data)
+		if !ok || string(data) == "[DONE]" {
+			return chunk, true, nil
+		}
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return chunk, false, fmt.Errorf("llm: llama.cpp: bad stream chunk: %w", err)
+		}
+		return chunk, false, nil
+	}), nil
+}
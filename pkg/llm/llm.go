@@ -0,0 +1,374 @@
+// Package llm lets the labs talk to different LLM backends through one
+// interface. Requests and responses are go-openai types, the format every
+// lab already speaks; adapters translate them for backends with their own API.
+//
+// The backend is chosen by environment variables, so the same lab runs
+// against a cloud model or a local one without code changes:
+//
+//	LLM_PROVIDER   openai (default) | llamacpp | ollama | anthropic
+//	LLM_MODEL      model to use instead of the one the lab asks for
+//	LLM_EMBEDDING_MODEL  same for embeddings
+//	LLM_MAX_ATTEMPTS     attempts per call on transient errors (default 5, 1 = no retries)
+//	LLM_PRICES           extra prices for the usage summary, e.g. "qwen2.5:7b=0.05/0.10"
+//	LLM_CONDENSE         "off" disables condense-and-retry on context overflows (see WithCondense)
+//	LLM_TEMPERATURE      sampling temperature of every chat request instead of the lab's
+//	LLM_FAILOVER         backends to fall back to, in order, when LLM_PROVIDER keeps
+//	                     failing (see WithFailover): "provider[@url][=model]" items
+//	                     separated by commas, e.g. "llamacpp@http://gpu2:8080/v1,openai=gpt-4o-mini"
+//	LLM_RECORD           cassette file to save every call of the run to (see WithRecording)
+//	LLM_REPLAY           cassette file to answer from instead of a backend (see Replay)
+//	LLM_CACHE            directory to keep replies in and answer repeated requests from (see WithCache)
+//
+//	openai:    OPENAI_API_KEY, OPENAI_BASE_URL (any OpenAI-compatible server:
+//	           LM Studio, vLLM, Ollama's /v1 endpoint; "mock" for the
+//	           scripted offline server from pkg/mockllm, MOCK_CONTEXT_WINDOW
+//	           to give it a context window in tokens)
+//	llamacpp:  LLAMACPP_BASE_URL (default http://localhost:8080/v1),
+//	           LLAMACPP_GRAMMAR=on to constrain JSON replies with a GBNF
+//	           grammar built from their schema (see LlamaCpp)
+//	ollama:    OLLAMA_HOST (default http://localhost:11434), native /api/chat
+//	anthropic: ANTHROPIC_API_KEY, ANTHROPIC_BASE_URL (default https://api.anthropic.com)
+package llm
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/llm/retry"
+	"github.com/kshvakov/agent/pkg/llm/usage"
+	"github.com/kshvakov/agent/pkg/mockllm"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Provider is an LLM backend.
+type Provider interface {
+	ChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+	// Stream returns the reply chunk by chunk; Recv returns io.EOF after the last one.
+	Stream(ctx context.Context, req openai.ChatCompletionRequest) (Stream, error)
+	Embeddings(ctx context.Context, req openai.EmbeddingRequest) (openai.EmbeddingResponse, error)
+}
+
+// Stream is a streamed chat completion. *openai.ChatCompletionStream implements it.
+type Stream interface {
+	Recv() (openai.ChatCompletionStreamResponse, error)
+	Close() error
+}
+
+// ErrNotSupported is returned for a capability the backend doesn't have,
+// e.g. embeddings on Anthropic.
+var ErrNotSupported = errors.New("llm: not supported by this provider")
+
+// FromEnv returns the provider selected by LLM_PROVIDER (see the package doc).
+func FromEnv() (Provider, error) {
+	name := strings.ToLower(os.Getenv("LLM_PROVIDER"))
+	model := os.Getenv("LLM_MODEL")
+
+	policy, err := retry.PolicyFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if err := usage.PricesFromEnv(); err != nil {
+		return nil, err
+	}
+	policy.OnRetry = func(attempt int, delay time.Duration, err error) {
+		fmt.Fprintf(os.Stderr, "llm: attempt %d/%d failed: %v; retrying in %s\n",
+			attempt, policy.MaxAttempts, err, delay.Round(100*time.Millisecond))
+	}
+	var p Provider
+	if path := os.Getenv("LLM_REPLAY"); path != "" {
+		// No backend at all: the cassette answers, and its usage is counted.
+		if p, err = Replay(path, func(kind string, n int) {
+			fmt.Fprintf(os.Stderr, "llm: replay: %s call %d differs from the recording; sending the next recorded reply\n", kind, n)
+		}); err != nil {
+			return nil, err
+		}
+		p = WithUsage(p, usage.Default)
+	} else {
+		if p, err = newProvider(name, "", model); err != nil {
+			return nil, err
+		}
+		if v := os.Getenv("LLM_FAILOVER"); v == "" {
+			p = WithRetry(WithModel(withCacheFromEnv(WithUsage(p, usage.Default)), model, os.Getenv("LLM_EMBEDDING_MODEL")), policy)
+		} else if p, err = failoverFromEnv(p, cmp.Or(name, "openai"), model, v, policy); err != nil {
+			return nil, err
+		}
+		// Recorded above retries and failover: the cassette holds the
+		// requests as the lab made them and the replies that succeeded.
+		if path := os.Getenv("LLM_RECORD"); path != "" {
+			p = WithRecording(p, path)
+		}
+	}
+	if v := os.Getenv("LLM_TEMPERATURE"); v != "" {
+		t, err := strconv.ParseFloat(v, 32)
+		if err != nil || t < 0 || t > 2 {
+			return nil, fmt.Errorf("llm: LLM_TEMPERATURE=%q: want a number from 0 to 2", v)
+		}
+		p = WithTemperature(p, float32(t))
+	}
+	if strings.ToLower(os.Getenv("LLM_CONDENSE")) == "off" {
+		return p, nil
+	}
+	return WithCondense(p, func(c Condensed) {
+		fmt.Fprintf(os.Stderr, "llm: context length exceeded: %v; retrying once\n", c)
+	}), nil
+}
+
+// newProvider returns the backend called name, at baseURL or, if it is
+// empty, at the address from its environment variables.
+func newProvider(name, baseURL, model string) (Provider, error) {
+	switch name {
+	case "", "openai":
+		baseURL = cmp.Or(baseURL, os.Getenv("OPENAI_BASE_URL"))
+		if baseURL == mockllm.URL {
+			// Offline run: the lab's script (mock.go) plays the model.
+			s := mockllm.Start(mockllm.Registered())
+			if v := os.Getenv("MOCK_CONTEXT_WINDOW"); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 1 {
+					return nil, fmt.Errorf("llm: MOCK_CONTEXT_WINDOW=%q: want a number of tokens", v)
+				}
+				s.Window = n
+			}
+			baseURL = s.BaseURL()
+		}
+		return NewOpenAI(baseURL, os.Getenv("OPENAI_API_KEY")), nil
+	case "llamacpp", "llama.cpp":
+		baseURL = cmp.Or(baseURL, env("LLAMACPP_BASE_URL", "http://localhost:8080/v1"))
+		if strings.ToLower(os.Getenv("LLAMACPP_GRAMMAR")) == "on" {
+			return NewLlamaCpp(baseURL, os.Getenv("OPENAI_API_KEY")), nil
+		}
+		return NewOpenAI(baseURL, os.Getenv("OPENAI_API_KEY")), nil
+	case "ollama":
+		if model == "" {
+			return nil, fmt.Errorf("llm: ollama needs a model: LLM_MODEL (e.g. qwen2.5:7b)")
+		}
+		return NewOllama(cmp.Or(baseURL, env("OLLAMA_HOST", "http://localhost:11434"))), nil
+	case "anthropic":
+		if model == "" {
+			return nil, fmt.Errorf("llm: anthropic needs a model: LLM_MODEL (e.g. claude-sonnet-4-5)")
+		}
+		key := os.Getenv("ANTHROPIC_API_KEY")
+		if key == "" {
+			return nil, fmt.Errorf("llm: anthropic needs ANTHROPIC_API_KEY")
+		}
+		return NewAnthropic(cmp.Or(baseURL, env("ANTHROPIC_BASE_URL", "https://api.anthropic.com")), key), nil
+	}
+	return nil, fmt.Errorf("llm: unknown LLM_PROVIDER %q (want openai, llamacpp, ollama or anthropic)", name)
+}
+
+func env(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// WithModel returns a provider that replaces the model of every chat request
+// with chat and of every embedding request with embedding. Empty values keep
+// the model from the request. Labs ask for "gpt-4o-mini"; this is how that
+// becomes "qwen2.5:7b" on Ollama.
+func WithModel(p Provider, chat, embedding string) Provider {
+	if chat == "" && embedding == "" {
+		return p
+	}
+	return &modelOverride{Provider: p, chat: chat, embedding: embedding}
+}
+
+// EmbeddingModel returns the model an embedding request for requested is
+// answered by: LLM_EMBEDDING_MODEL if set (see WithModel). Vectors of two
+// models don't compare, so whatever keeps them (pkg/vecindex) is keyed by it.
+func EmbeddingModel(requested string) string {
+	return cmp.Or(os.Getenv("LLM_EMBEDDING_MODEL"), requested)
+}
+
+type modelOverride struct {
+	Provider
+	chat, embedding string
+}
+
+func (m *modelOverride) ChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	if m.chat != "" {
+		req.Model = m.chat
+	}
+	return m.Provider.ChatCompletion(ctx, req)
+}
+
+func (m *modelOverride) Stream(ctx context.Context, req openai.ChatCompletionRequest) (Stream, error) {
+	if m.chat != "" {
+		req.Model = m.chat
+	}
+	return m.Provider.Stream(ctx, req)
+}
+
+func (m *modelOverride) Embeddings(ctx context.Context, req openai.EmbeddingRequest) (openai.EmbeddingResponse, error) {
+	if m.embedding != "" {
+		req.Model = openai.EmbeddingModel(m.embedding)
+	}
+	return m.Provider.Embeddings(ctx, req)
+}
+
+func (m *modelOverride) String() string {
+	return fmt.Sprintf("%v, model %s", m.Provider, m.chat)
+}
+
+// ZeroTemperature is what a request sets for temperature 0. go-openai
+// omits a zero temperature, and the server's default (usually 1) applies;
+// the smallest float is taken as 0.
+const ZeroTemperature = math.SmallestNonzeroFloat32
+
+// WithTemperature returns a provider that sets the temperature of every
+// chat request to t, whatever the lab asked for.
+func WithTemperature(p Provider, t float32) Provider {
+	if t == 0 {
+		t = ZeroTemperature
+	}
+	return &temperatureOverride{Provider: p, t: t}
+}
+
+type temperatureOverride struct {
+	Provider
+	t float32
+}
+
+func (o *temperatureOverride) ChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	req.Temperature = o.t
+	return o.Provider.ChatCompletion(ctx, req)
+}
+
+func (o *temperatureOverride) Stream(ctx context.Context, req openai.ChatCompletionRequest) (Stream, error) {
+	req.Temperature = o.t
+	return o.Provider.Stream(ctx, req)
+}
+
+func (o *temperatureOverride) String() string {
+	return fmt.Sprintf("%v, temperature %g", o.Provider, o.t)
+}
+
+// WithRetry returns a provider that retries calls failing with a transient
+// error (see retry.Transient) according to policy. A stream is retried only
+// until it is established: chunks already passed to the caller can't be
+// taken back.
+func WithRetry(p Provider, policy retry.Policy) Provider {
+	if policy.MaxAttempts <= 1 {
+		return p
+	}
+	return &retrying{Provider: p, policy: policy}
+}
+
+type retrying struct {
+	Provider
+	policy retry.Policy
+}
+
+func (r *retrying) ChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (resp openai.ChatCompletionResponse, err error) {
+	err = retry.Do(ctx, r.policy, func() error {
+		resp, err = r.Provider.ChatCompletion(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+func (r *retrying) Stream(ctx context.Context, req openai.ChatCompletionRequest) (stream Stream, err error) {
+	err = retry.Do(ctx, r.policy, func() error {
+		stream, err = r.Provider.Stream(ctx, req)
+		return err
+	})
+	return stream, err
+}
+
+func (r *retrying) Embeddings(ctx context.Context, req openai.EmbeddingRequest) (resp openai.EmbeddingResponse, err error) {
+	err = retry.Do(ctx, r.policy, func() error {
+		resp, err = r.Provider.Embeddings(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+func (r *retrying) String() string {
+	return fmt.Sprint(r.Provider)
+}
+
+// withCacheFromEnv wraps p in the LLM_CACHE cache, if it is set. It goes
+// below WithModel, so the key has the model the backend is asked for, and
+// above WithUsage, so cached replies cost nothing.
+func withCacheFromEnv(p Provider) Provider {
+	if dir := os.Getenv("LLM_CACHE"); dir != "" {
+		return WithCache(p, dir)
+	}
+	return p
+}
+
+// WithUsage returns a provider that records the usage of every successful
+// call in t, under the model that answered. Streams are recorded only if
+// the backend sends usage in a chunk (StreamOptions.IncludeUsage).
+func WithUsage(p Provider, t *usage.Tracker) Provider {
+	return &metered{Provider: p, tracker: t}
+}
+
+type metered struct {
+	Provider
+	tracker *usage.Tracker
+	via     string // Backend name added to the model, with failover
+}
+
+// key is the name the usage of model is recorded under: "gpt-4o-mini",
+// or "gpt-4o-mini via openai" when several backends serve the run.
+// Prices still match: they are looked up by prefix.
+func (m *metered) key(model string) string {
+	if m.via == "" {
+		return model
+	}
+	return model + " via " + m.via
+}
+
+func (m *metered) ChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	resp, err := m.Provider.ChatCompletion(ctx, req)
+	if err == nil {
+		m.tracker.Add(m.key(cmp.Or(resp.Model, req.Model)), resp.Usage)
+		m.tracker.AddContext(req, resp.Usage)
+	}
+	return resp, err
+}
+
+func (m *metered) Stream(ctx context.Context, req openai.ChatCompletionRequest) (Stream, error) {
+	s, err := m.Provider.Stream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &meteredStream{Stream: s, tracker: m.tracker, req: req, key: m.key}, nil
+}
+
+func (m *metered) Embeddings(ctx context.Context, req openai.EmbeddingRequest) (openai.EmbeddingResponse, error) {
+	resp, err := m.Provider.Embeddings(ctx, req)
+	if err == nil {
+		m.tracker.Add(m.key(cmp.Or(string(resp.Model), string(req.Model))), resp.Usage)
+	}
+	return resp, err
+}
+
+func (m *metered) String() string {
+	return fmt.Sprint(m.Provider)
+}
+
+type meteredStream struct {
+	Stream
+	tracker *usage.Tracker
+	req     openai.ChatCompletionRequest
+	key     func(model string) string
+}
+
+func (s *meteredStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	chunk, err := s.Stream.Recv()
+	if err == nil && chunk.Usage != nil {
+		s.tracker.Add(s.key(cmp.Or(chunk.Model, s.req.Model)), *chunk.Usage)
+		s.tracker.AddContext(s.req, *chunk.Usage)
+	}
+	return chunk, err
+}
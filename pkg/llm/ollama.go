@@ -0,0 +1,235 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Ollama is a Provider for Ollama's native API (/api/chat, /api/embed).
+// Ollama also serves an OpenAI-compatible /v1 endpoint, usable with
+// NewOpenAI; the native API additionally takes options like num_ctx and
+// reports token counts for every call.
+type Ollama struct {
+	host  string
+	calls atomic.Int64 // Ollama doesn't give tool calls IDs; we number them
+}
+
+// NewOllama returns a provider for the Ollama server at host (e.g. http://localhost:11434).
+func NewOllama(host string) *Ollama {
+	return &Ollama{host: strings.TrimRight(host, "/")}
+}
+
+func (o *Ollama) String() string {
+	return "ollama " + o.host
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Tools    []openai.Tool   `json:"tools,omitempty"` // Same format as OpenAI
+	Format   any             `json:"format,omitempty"`
+	Stream   bool            `json:"stream"`
+	Options  map[string]any  `json:"options"`
+}
+
+type ollamaChatResponse struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+func (o *Ollama) chatRequest(req openai.ChatCompletionRequest, stream bool) ollamaChatRequest {
+	// Temperature is always sent: 0 means "deterministic" in the labs,
+	// not "the server's default".
+	options := map[string]any{"temperature": req.Temperature}
+	if req.TopP != 0 {
+		options["top_p"] = req.TopP
+	}
+	if n := maxTokens(req); n != 0 {
+		options["num_predict"] = n
+	}
+	if len(req.Stop) > 0 {
+		options["stop"] = req.Stop
+	}
+	if req.Seed != nil {
+		options["seed"] = *req.Seed
+	}
+
+	out := ollamaChatRequest{Model: req.Model, Tools: req.Tools, Stream: stream, Options: options}
+	if f := req.ResponseFormat; f != nil {
+		switch {
+		case f.Type == openai.ChatCompletionResponseFormatTypeJSONSchema && f.JSONSchema != nil:
+			out.Format = f.JSONSchema.Schema
+		case f.Type != openai.ChatCompletionResponseFormatTypeText:
+			out.Format = "json"
+		}
+	}
+
+	names := map[string]string{} // Tool call ID -> tool name, for tool results
+	for _, m := range req.Messages {
+		om := ollamaMessage{Role: m.Role, Content: m.Content}
+		for _, tc := range m.ToolCalls {
+			names[tc.ID] = tc.Function.Name
+			var c ollamaToolCall
+			c.Function.Name = tc.Function.Name
+			c.Function.Arguments = jsonArgs(tc.Function.Arguments)
+			om.ToolCalls = append(om.ToolCalls, c)
+		}
+		if m.Role == openai.ChatMessageRoleTool {
+			om.ToolName = names[m.ToolCallID]
+		}
+		out.Messages = append(out.Messages, om)
+	}
+	return out
+}
+
+// toolCalls converts Ollama's tool calls, giving each a unique ID.
+func (o *Ollama) toolCalls(calls []ollamaToolCall) []openai.ToolCall {
+	var out []openai.ToolCall
+	for i, c := range calls {
+		index := i
+		out = append(out, openai.ToolCall{
+			Index: &index,
+			ID:    fmt.Sprintf("call_%d", o.calls.Add(1)),
+			Type:  openai.ToolTypeFunction,
+			Function: openai.FunctionCall{
+				Name:      c.Function.Name,
+				Arguments: string(c.Function.Arguments),
+			},
+		})
+	}
+	return out
+}
+
+func (o *Ollama) ChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	var resp ollamaChatResponse
+	if err := postJSON(ctx, o.host+"/api/chat", nil, o.chatRequest(req, false), &resp); err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	if resp.Error != "" {
+		return openai.ChatCompletionResponse{}, fmt.Errorf("llm: ollama: %s", resp.Error)
+	}
+	msg := openai.ChatCompletionMessage{
+		Role:      openai.ChatMessageRoleAssistant,
+		Content:   resp.Message.Content,
+		ToolCalls: o.toolCalls(resp.Message.ToolCalls),
+	}
+	for i := range msg.ToolCalls {
+		msg.ToolCalls[i].Index = nil // Index is for stream deltas only
+	}
+	return openai.ChatCompletionResponse{
+		Object:  "chat.completion",
+		Model:   resp.Model,
+		Choices: []openai.ChatCompletionChoice{{Message: msg, FinishReason: ollamaFinish(resp.DoneReason, msg)}},
+		Usage: openai.Usage{
+			PromptTokens:     resp.PromptEvalCount,
+			CompletionTokens: resp.EvalCount,
+			TotalTokens:      resp.PromptEvalCount + resp.EvalCount,
+		},
+	}, nil
+}
+
+func (o *Ollama) Stream(ctx context.Context, req openai.ChatCompletionRequest) (Stream, error) {
+	resp, err := post(ctx, o.host+"/api/chat", nil, o.chatRequest(req, true))
+	if err != nil {
+		return nil, err
+	}
+	toolIndex := 0
+	// Ollama streams NDJSON; tool calls arrive whole, in one chunk.
+	return newLineStream(resp.Body, func(line []byte) (openai.ChatCompletionStreamResponse, bool, error) {
+		var r ollamaChatResponse
+		if err := json.Unmarshal(line, &r); err != nil {
+			return openai.ChatCompletionStreamResponse{}, false, fmt.Errorf("llm: ollama: bad stream chunk: %w", err)
+		}
+		if r.Error != "" {
+			return openai.ChatCompletionStreamResponse{}, false, fmt.Errorf("llm: ollama: %s", r.Error)
+		}
+		calls := o.toolCalls(r.Message.ToolCalls)
+		for i := range calls {
+			*calls[i].Index = toolIndex
+			toolIndex++
+		}
+		var finish openai.FinishReason
+		if r.Done {
+			finish = openai.FinishReasonStop
+			if toolIndex > 0 {
+				finish = openai.FinishReasonToolCalls
+			}
+		}
+		chunk := deltaChunk(openai.ChatCompletionStreamChoiceDelta{Content: r.Message.Content, ToolCalls: calls}, finish)
+		chunk.Model = r.Model
+		return chunk, r.Message.Content == "" && len(calls) == 0 && !r.Done, nil
+	}), nil
+}
+
+func (o *Ollama) Embeddings(ctx context.Context, req openai.EmbeddingRequest) (openai.EmbeddingResponse, error) {
+	var resp struct {
+		Model           string      `json:"model"`
+		Embeddings      [][]float32 `json:"embeddings"`
+		PromptEvalCount int         `json:"prompt_eval_count"`
+	}
+	body := map[string]any{"model": req.Model, "input": req.Input}
+	if err := postJSON(ctx, o.host+"/api/embed", nil, body, &resp); err != nil {
+		return openai.EmbeddingResponse{}, err
+	}
+	out := openai.EmbeddingResponse{
+		Object: "list",
+		Model:  openai.EmbeddingModel(resp.Model),
+		Usage:  openai.Usage{PromptTokens: resp.PromptEvalCount, TotalTokens: resp.PromptEvalCount},
+	}
+	for i, e := range resp.Embeddings {
+		out.Data = append(out.Data, openai.Embedding{Object: "embedding", Embedding: e, Index: i})
+	}
+	return out, nil
+}
+
+func ollamaFinish(reason string, msg openai.ChatCompletionMessage) openai.FinishReason {
+	switch {
+	case len(msg.ToolCalls) > 0:
+		return openai.FinishReasonToolCalls
+	case reason == "length":
+		return openai.FinishReasonLength
+	default:
+		return openai.FinishReasonStop
+	}
+}
+
+// jsonArgs turns OpenAI's string arguments into the JSON object native
+// APIs want. Broken arguments (the model's own earlier mistake) become {}.
+func jsonArgs(args string) json.RawMessage {
+	if strings.TrimSpace(args) == "" || !json.Valid([]byte(args)) {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(args)
+}
+
+// maxTokens returns the completion limit from either field of the request.
+func maxTokens(req openai.ChatCompletionRequest) int {
+	if req.MaxCompletionTokens != 0 {
+		return req.MaxCompletionTokens
+	}
+	return req.MaxTokens
+}
@@ -0,0 +1,55 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// OpenAI is a Provider for OpenAI and OpenAI-compatible servers
+// (llama.cpp server, LM Studio, vLLM, Ollama's /v1 endpoint).
+type OpenAI struct {
+	client  *openai.Client
+	baseURL string
+}
+
+// NewOpenAI returns a provider for the server at baseURL (the OpenAI API if
+// empty). Local servers usually ignore the token; "dummy" is used if empty.
+func NewOpenAI(baseURL, token string) *OpenAI {
+	if token == "" {
+		token = "dummy"
+	}
+	config := openai.DefaultConfig(token)
+	if baseURL != "" {
+		config.BaseURL = baseURL
+	}
+	config.HTTPClient = &http.Client{Transport: retryAfterTransport{base: http.DefaultTransport}}
+	return &OpenAI{client: openai.NewClientWithConfig(config), baseURL: config.BaseURL}
+}
+
+func (o *OpenAI) ChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	ctx, after := withRetryAfter(ctx)
+	resp, err := o.client.CreateChatCompletion(ctx, req)
+	return resp, openAIError(err, *after)
+}
+
+func (o *OpenAI) Stream(ctx context.Context, req openai.ChatCompletionRequest) (Stream, error) {
+	req.Stream = true
+	ctx, after := withRetryAfter(ctx)
+	stream, err := o.client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, openAIError(err, *after) // Not a typed nil in the interface
+	}
+	return stream, nil
+}
+
+func (o *OpenAI) Embeddings(ctx context.Context, req openai.EmbeddingRequest) (openai.EmbeddingResponse, error) {
+	ctx, after := withRetryAfter(ctx)
+	resp, err := o.client.CreateEmbeddings(ctx, req)
+	return resp, openAIError(err, *after)
+}
+
+func (o *OpenAI) String() string {
+	return "openai-compatible " + o.baseURL
+}
@@ -0,0 +1,222 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kshvakov/agent/pkg/prompts"
+	"github.com/kshvakov/agent/pkg/redact"
+	"github.com/sashabaranov/go-openai"
+)
+
+// overflowMarkers are the messages backends use for a prompt that doesn't
+// fit the model's window: OpenAI, Anthropic, llama.cpp, vLLM.
+var overflowMarkers = []string{
+	"context_length_exceeded",
+	"maximum context length",
+	"context window",
+	"prompt is too long",
+	"exceeds the available context size",
+	"exceed context limit",
+}
+
+// IsContextOverflow reports whether err says the request didn't fit the
+// model's context window.
+func IsContextOverflow(err error) bool {
+	if err == nil {
+		return false
+	}
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) && apiErr.Code == "context_length_exceeded" {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, m := range overflowMarkers {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// CondenseTail is the number of trailing messages Condense keeps as is.
+const CondenseTail = 4
+
+// summarizePrompt is the summarizer prompt of Lab 09.
+var summarizePrompt = prompts.Must("summarizer", nil)
+
+// The summarizer sees the replaced messages cut to fit half of the request
+// that overflowed, so it doesn't overflow too: each message gets an equal
+// share, from minSummarizeMessage to maxSummarizeMessage characters.
+const (
+	minSummarizeMessage = 200
+	maxSummarizeMessage = 2000
+)
+
+// Condensed describes one condense: what was replaced and by what.
+type Condensed struct {
+	Dropped []openai.ChatCompletionMessage // Messages replaced by the summary
+	Kept    int                            // Messages sent as is: the system prompt and the tail
+	Summary string
+	Masked  []string // Kinds of secrets and personal data masked before summarizing (see pkg/redact)
+}
+
+// String describes what was dropped, for logs:
+// "replaced 9 messages (4 assistant, 3 tool, 2 user; 18204 bytes) with a 412-byte summary, kept 5".
+func (c Condensed) String() string {
+	roles := map[string]int{}
+	size := 0
+	for _, m := range c.Dropped {
+		roles[m.Role]++
+		size += len(m.Content)
+		for _, tc := range m.ToolCalls {
+			size += len(tc.Function.Arguments)
+		}
+	}
+	var counts []string
+	for _, role := range slices.Sorted(maps.Keys(roles)) {
+		counts = append(counts, fmt.Sprintf("%d %s", roles[role], role))
+	}
+	s := fmt.Sprintf("replaced %d messages (%s; %d bytes) with a %d-byte summary, kept %d",
+		len(c.Dropped), strings.Join(counts, ", "), size, len(c.Summary), c.Kept)
+	if len(c.Masked) > 0 {
+		s += ", masked " + strings.Join(c.Masked, ", ")
+	}
+	return s
+}
+
+// Condense is the compression pipeline of Lab 09: the system prompt stays,
+// the last CondenseTail messages stay (extended to the left so no tool result
+// loses its tool call), and everything in between is replaced by one
+// summary written by p. It fails if there is nothing in between.
+//
+// The summarizer sees the messages with secrets and personal data masked
+// (pkg/redact): a summary outlives the messages it replaces, and a
+// credential pasted once must not ride along in every later request.
+func Condense(ctx context.Context, p Provider, model string, msgs []openai.ChatCompletionMessage) ([]openai.ChatCompletionMessage, Condensed, error) {
+	head := 0
+	if len(msgs) > 0 && msgs[0].Role == openai.ChatMessageRoleSystem {
+		head = 1
+	}
+	start := max(len(msgs)-CondenseTail, head)
+	for start > head && msgs[start].Role == openai.ChatMessageRoleTool {
+		start--
+	}
+	if start == head {
+		return nil, Condensed{}, fmt.Errorf("llm: condense: %d messages, nothing to replace", len(msgs))
+	}
+
+	size := 0
+	for _, m := range msgs {
+		size += utf8.RuneCountInString(m.Content)
+	}
+	share := min(max(size/2/(start-head), minSummarizeMessage), maxSummarizeMessage)
+
+	var b strings.Builder
+	for _, m := range msgs[head:start] {
+		content := m.Content
+		if r := []rune(content); len(r) > share {
+			content = string(r[:share]) + fmt.Sprintf(" …[%d more characters]", len(r)-share)
+		}
+		fmt.Fprintf(&b, "%s: %s\n", m.Role, content)
+		for _, tc := range m.ToolCalls {
+			fmt.Fprintf(&b, "%s calls %s(%s)\n", m.Role, tc.Function.Name, tc.Function.Arguments)
+		}
+	}
+	transcript, masked := redact.Text(b.String())
+	resp, err := p.ChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: summarizePrompt},
+			{Role: openai.ChatMessageRoleUser, Content: transcript},
+		},
+	})
+	if err != nil {
+		return nil, Condensed{}, fmt.Errorf("llm: condense: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, Condensed{}, fmt.Errorf("llm: condense: empty response")
+	}
+	summary := resp.Choices[0].Message.Content
+
+	out := append([]openai.ChatCompletionMessage{}, msgs[:head]...)
+	out = append(out, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: "Context of previous work:\n\n" + summary,
+	})
+	out = append(out, msgs[start:]...)
+	return out, Condensed{
+		Dropped: msgs[head:start],
+		Kept:    head + len(msgs) - start,
+		Summary: summary,
+		Masked:  masked,
+	}, nil
+}
+
+// WithCondense returns a provider that recovers from context overflows:
+// the offending request is condensed (see Condense) and retried once.
+// onCondense, if set, is told what was dropped. If the retry overflows too,
+// or there is nothing to condense, the caller gets the error.
+//
+// Only the request is condensed, not the caller's history: a caller that
+// keeps growing its history will overflow again on the next call. Labs
+// that manage their context (Lab 09, Lab 11) do better on their own.
+func WithCondense(p Provider, onCondense func(Condensed)) Provider {
+	return &condensing{Provider: p, onCondense: onCondense}
+}
+
+type condensing struct {
+	Provider
+	onCondense func(Condensed)
+}
+
+func (c *condensing) condense(ctx context.Context, req openai.ChatCompletionRequest, err error) (openai.ChatCompletionRequest, error) {
+	msgs, cd, cerr := Condense(ctx, c.Provider, req.Model, req.Messages)
+	if cerr != nil {
+		return req, fmt.Errorf("%w (recovery failed: %v)", err, cerr)
+	}
+	if c.onCondense != nil {
+		c.onCondense(cd)
+	}
+	req.Messages = msgs
+	return req, nil
+}
+
+func (c *condensing) ChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	resp, err := c.Provider.ChatCompletion(ctx, req)
+	if !IsContextOverflow(err) {
+		return resp, err
+	}
+	if req, err = c.condense(ctx, req, err); err != nil {
+		return resp, err
+	}
+	resp, err = c.Provider.ChatCompletion(ctx, req)
+	if IsContextOverflow(err) {
+		return resp, fmt.Errorf("llm: context overflow even after condense: %w", err)
+	}
+	return resp, err
+}
+
+func (c *condensing) Stream(ctx context.Context, req openai.ChatCompletionRequest) (Stream, error) {
+	s, err := c.Provider.Stream(ctx, req)
+	if !IsContextOverflow(err) {
+		return s, err
+	}
+	if req, err = c.condense(ctx, req, err); err != nil {
+		return nil, err
+	}
+	s, err = c.Provider.Stream(ctx, req)
+	if IsContextOverflow(err) {
+		return nil, fmt.Errorf("llm: context overflow even after condense: %w", err)
+	}
+	return s, err
+}
+
+func (c *condensing) String() string {
+	return fmt.Sprint(c.Provider)
+}
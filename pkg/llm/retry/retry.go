@@ -0,0 +1,130 @@
+// Package retry re-runs calls that failed with a transient error: rate
+// limits (429), server errors (5xx), timeouts and dropped connections.
+// A long agent run makes dozens of calls; with a flaky local server one of
+// them fails sooner or later, and it shouldn't take the whole run with it.
+//
+// Delays grow exponentially with jitter, so clients that failed together
+// don't retry together. If the server says how long to wait (Retry-After),
+// that wins.
+//
+//	err := retry.Do(ctx, retry.DefaultPolicy, func() error {
+//		resp, err = client.ChatCompletion(ctx, req)
+//		return err
+//	})
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Policy configures Do.
+type Policy struct {
+	MaxAttempts int           // Attempts including the first one; 1 disables retries
+	BaseDelay   time.Duration // Delay before the first retry; doubles with every attempt
+	MaxDelay    time.Duration // Cap on one delay, including a Retry-After from the server
+
+	// OnRetry, if set, is called before sleeping, e.g. to log the failure.
+	OnRetry func(attempt int, delay time.Duration, err error)
+}
+
+// DefaultPolicy waits about 1s, 2s, 4s, 8s: enough for a local server
+// to finish loading a model or for a rate limit window to pass.
+var DefaultPolicy = Policy{
+	MaxAttempts: 5,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+}
+
+// PolicyFromEnv returns DefaultPolicy with MaxAttempts from LLM_MAX_ATTEMPTS, if set.
+func PolicyFromEnv() (Policy, error) {
+	p := DefaultPolicy
+	if v := os.Getenv("LLM_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return p, fmt.Errorf("retry: LLM_MAX_ATTEMPTS: want a number from 1, got %q", v)
+		}
+		p.MaxAttempts = n
+	}
+	return p, nil
+}
+
+// Do calls fn until it succeeds, fails with an error that is not Transient,
+// runs out of attempts, or ctx is done. It returns the last error.
+func Do(ctx context.Context, p Policy, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !Transient(err) || ctx.Err() != nil {
+			return err
+		}
+		delay := p.Delay(attempt, err)
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, delay, err)
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// Delay returns how long to wait after the failed attempt (1-based): the
+// server's Retry-After if err carries one, otherwise BaseDelay·2^(attempt-1)
+// with jitter — a random value from half of it to all of it. Both are
+// capped by MaxDelay.
+func (p Policy) Delay(attempt int, err error) time.Duration {
+	var ra interface{ RetryAfter() time.Duration }
+	if errors.As(err, &ra) && ra.RetryAfter() > 0 {
+		return capDelay(ra.RetryAfter(), p.MaxDelay)
+	}
+	d := capDelay(p.BaseDelay<<(attempt-1), p.MaxDelay)
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+func capDelay(d, limit time.Duration) time.Duration {
+	if limit > 0 && (d > limit || d < 0) { // d < 0: the shift overflowed
+		return limit
+	}
+	return d
+}
+
+// Transient reports whether err is worth retrying. Errors that report an
+// HTTP status (HTTPStatus() int) are transient for 408, 429 and 5xx except
+// 501; without a status, timeouts and dropped or refused connections are.
+// A canceled context is never transient: the caller gave up.
+func Transient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var st interface{ HTTPStatus() int }
+	if errors.As(err, &st) {
+		switch code := st.HTTPStatus(); {
+		case code == 408, code == 429:
+			return true
+		case code >= 500 && code != 501:
+			return true
+		case code > 0:
+			return false
+		}
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
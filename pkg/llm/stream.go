@@ -0,0 +1,94 @@
+package llm
+
+import (
+	"errors"
+	"io"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Collect reads s to the end and assembles the reply, as if it had come
+// from ChatCompletion: content is concatenated, tool calls are assembled
+// from their deltas, usage is taken from the chunk that carries it (see
+// StreamOptions.IncludeUsage). onContent, if set, gets every content
+// delta as it arrives. Collect doesn't close s.
+func Collect(s Stream, onContent func(string)) (openai.ChatCompletionResponse, error) {
+	return CollectUntil(s, func(delta string) error {
+		if onContent != nil {
+			onContent(delta)
+		}
+		return nil
+	})
+}
+
+// CollectUntil is Collect with a content callback that can stop the
+// reply: when onContent returns an error, CollectUntil returns the reply
+// so far with that error and reads no more. Close s then: the connection
+// goes away, and servers stop generating the tokens nobody will read.
+// Checking a plan step by step as it streams (parse.Elements) stops a bad
+// one at its first bad step.
+func CollectUntil(s Stream, onContent func(string) error) (openai.ChatCompletionResponse, error) {
+	resp := openai.ChatCompletionResponse{Object: "chat.completion"}
+	choice := openai.ChatCompletionChoice{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}}
+	for {
+		chunk, err := s.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return resp, err
+		}
+		if resp.ID == "" {
+			resp.ID, resp.Model, resp.Created = chunk.ID, chunk.Model, chunk.Created
+		}
+		if chunk.Usage != nil {
+			resp.Usage = *chunk.Usage
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		c := chunk.Choices[0]
+		if c.Delta.Content != "" {
+			choice.Message.Content += c.Delta.Content
+			if err := onContent(c.Delta.Content); err != nil {
+				resp.Choices = []openai.ChatCompletionChoice{choice}
+				return resp, err
+			}
+		}
+		choice.Message.ToolCalls = MergeToolCalls(choice.Message.ToolCalls, c.Delta.ToolCalls)
+		if c.FinishReason != "" {
+			choice.FinishReason = c.FinishReason
+		}
+	}
+	for i := range choice.Message.ToolCalls {
+		choice.Message.ToolCalls[i].Index = nil // Index is for stream deltas only
+	}
+	resp.Choices = []openai.ChatCompletionChoice{choice}
+	return resp, nil
+}
+
+// MergeToolCalls assembles tool calls from stream deltas: the first delta of
+// a call carries its ID and name, the following ones append argument fragments.
+// Deltas without Index (some servers omit it) continue the last call, unless
+// they carry a new ID.
+func MergeToolCalls(calls []openai.ToolCall, deltas []openai.ToolCall) []openai.ToolCall {
+	for _, d := range deltas {
+		i := len(calls) - 1
+		if d.Index != nil {
+			i = *d.Index
+		} else if d.ID != "" || i < 0 {
+			i = len(calls)
+		}
+		for len(calls) <= i {
+			calls = append(calls, openai.ToolCall{Type: openai.ToolTypeFunction})
+		}
+		if d.ID != "" {
+			calls[i].ID = d.ID
+		}
+		if d.Function.Name != "" {
+			calls[i].Function.Name = d.Function.Name
+		}
+		calls[i].Function.Arguments += d.Function.Arguments
+	}
+	return calls
+}
@@ -0,0 +1,145 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Where the prompt tokens go ---
+//
+// Every LLM call of an agent sends the whole context again: the system
+// prompt, the tool schemas, every tool result so far. The usage table says
+// how many tokens a run took, not which part of the context took them.
+// The tracker also splits the tokens of each call among the parts of its
+// request, so the summary shows what to trim first: a tool whose results
+// stay in the history, schemas of tools nobody calls, a long system prompt.
+
+// Contributors to the tokens of a call.
+const (
+	SystemPrompt     = "system prompt"
+	ToolSchemas      = "tool schemas"
+	ToolResults      = "tool results"
+	Summaries        = "summaries" // Condensed history (llm.WithCondense, lab09)
+	UserMessages     = "user messages"
+	AssistantHistory = "assistant history" // Earlier replies and tool calls, sent back
+	AssistantOutput  = "assistant output"  // The completion itself
+)
+
+// summaryPrefix starts the message that replaces condensed history.
+const summaryPrefix = "Context of previous work:"
+
+// Attribute splits the tokens of a call with request req among its
+// contributors. Providers count the prompt as a whole, so the prompt
+// tokens are divided in proportion to the size of each part of the
+// request; the completion tokens are AssistantOutput.
+func Attribute(req openai.ChatCompletionRequest, u openai.Usage) map[string]float64 {
+	sizes := map[string]int{}
+	if len(req.Tools) > 0 {
+		data, _ := json.Marshal(req.Tools)
+		sizes[ToolSchemas] = len(data)
+	}
+	for _, m := range req.Messages {
+		size := len(m.Content)
+		for _, part := range m.MultiContent {
+			size += len(part.Text)
+		}
+		for _, tc := range m.ToolCalls {
+			size += len(tc.Function.Name) + len(tc.Function.Arguments)
+		}
+		sizes[contributor(m)] += size
+	}
+	total := 0
+	for _, n := range sizes {
+		total += n
+	}
+
+	out := map[string]float64{}
+	if total > 0 {
+		for name, n := range sizes {
+			if n > 0 {
+				out[name] = float64(u.PromptTokens) * float64(n) / float64(total)
+			}
+		}
+	}
+	if u.CompletionTokens > 0 {
+		out[AssistantOutput] = float64(u.CompletionTokens)
+	}
+	return out
+}
+
+// contributor returns the part of the context m belongs to.
+func contributor(m openai.ChatCompletionMessage) string {
+	switch m.Role {
+	case openai.ChatMessageRoleSystem, openai.ChatMessageRoleDeveloper:
+		return SystemPrompt
+	case openai.ChatMessageRoleTool, openai.ChatMessageRoleFunction:
+		return ToolResults
+	case openai.ChatMessageRoleAssistant:
+		return AssistantHistory
+	}
+	if strings.HasPrefix(m.Content, summaryPrefix) {
+		return Summaries
+	}
+	return UserMessages
+}
+
+// AddContext records how the tokens of a call with request req split
+// among its contributors (see Attribute).
+func (t *Tracker) AddContext(req openai.ChatCompletionRequest, u openai.Usage) {
+	shares := Attribute(req, u)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.context == nil {
+		t.context = map[string]float64{}
+	}
+	for name, n := range shares {
+		t.context[name] += n
+	}
+}
+
+// Context returns a copy of the tokens per contributor.
+func (t *Tracker) Context() map[string]float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[string]float64, len(t.context))
+	for name, n := range t.context {
+		out[name] = n
+	}
+	return out
+}
+
+// PrintContext writes the contributors, the largest first, with their
+// share of all tokens. It prints nothing if no chat calls were recorded.
+//
+//	Tokens by context part:
+//	  tool results        3120  55%  ████████████████
+//	  tool schemas        1210  21%  ██████
+//	  system prompt        730  13%  ███
+func (t *Tracker) PrintContext(w io.Writer) {
+	parts := t.Context()
+	if len(parts) == 0 {
+		return
+	}
+	names := make([]string, 0, len(parts))
+	var total float64
+	for name, n := range parts {
+		names = append(names, name)
+		total += n
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if parts[names[i]] != parts[names[j]] {
+			return parts[names[i]] > parts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	fmt.Fprintln(w, "Tokens by context part:")
+	for _, name := range names {
+		share := parts[name] / total
+		fmt.Fprintf(w, "  %-17s  %7.0f  %3.0f%%  %s\n", name, parts[name], 100*share, strings.Repeat("█", int(30*share+0.5)))
+	}
+}
@@ -0,0 +1,206 @@
+// Package usage counts tokens across all LLM calls of a process and turns
+// them into money. A multi-step run (a supervisor with workers, a plan with
+// ten steps) makes calls nobody sees; the summary at exit shows what it cost.
+//
+// llm.FromEnv meters every call into Default, so a lab only prints it:
+//
+//	defer usage.Default.Print(os.Stdout)
+//
+// The summary also shows which parts of the context the tokens went to:
+// the system prompt, tool schemas, tool results, history (see Attribute).
+//
+// Prices are USD per million tokens, looked up by model name. Local models
+// have no price; their tokens are counted, their cost is not.
+package usage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Price is the cost of a model in USD per million tokens.
+type Price struct {
+	Prompt     float64
+	Completion float64
+}
+
+// Prices is the price table. A model matches an entry by exact name or by
+// the longest entry its name starts with, so dated snapshots
+// ("gpt-4o-mini-2024-07-18") get the price of their family. Add entries
+// or set LLM_PRICES (see PricesFromEnv) for models that are missing.
+var Prices = map[string]Price{
+	"gpt-4o":                 {2.50, 10.00},
+	"gpt-4o-mini":            {0.15, 0.60},
+	"gpt-4.1":                {2.00, 8.00},
+	"gpt-4.1-mini":           {0.40, 1.60},
+	"gpt-4.1-nano":           {0.10, 0.40},
+	"gpt-3.5-turbo":          {0.50, 1.50},
+	"o3-mini":                {1.10, 4.40},
+	"text-embedding-3-small": {0.02, 0},
+	"text-embedding-3-large": {0.13, 0},
+	"text-embedding-ada-002": {0.10, 0},
+	"claude-haiku-4-5":       {1.00, 5.00},
+	"claude-sonnet-4-5":      {3.00, 15.00},
+	"claude-opus-4-1":        {15.00, 75.00},
+}
+
+// PriceOf returns the price of model from Prices.
+func PriceOf(model string) (Price, bool) {
+	if p, ok := Prices[model]; ok {
+		return p, true
+	}
+	best := ""
+	for name := range Prices {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	p, ok := Prices[best]
+	return p, ok && best != ""
+}
+
+// PricesFromEnv adds prices from LLM_PRICES to Prices:
+// "model=prompt/completion" pairs separated by commas, e.g.
+// "qwen2.5:7b=0.05/0.10,my-proxy-model=2.5/10".
+func PricesFromEnv() error {
+	v := os.Getenv("LLM_PRICES")
+	if v == "" {
+		return nil
+	}
+	for _, item := range strings.Split(v, ",") {
+		model, pair, ok := strings.Cut(strings.TrimSpace(item), "=")
+		prompt, completion, ok2 := strings.Cut(pair, "/")
+		if !ok || !ok2 || model == "" {
+			return fmt.Errorf("usage: LLM_PRICES: want model=prompt/completion, got %q", item)
+		}
+		p, err1 := strconv.ParseFloat(prompt, 64)
+		c, err2 := strconv.ParseFloat(completion, 64)
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("usage: LLM_PRICES: bad price in %q", item)
+		}
+		Prices[model] = Price{Prompt: p, Completion: c}
+	}
+	return nil
+}
+
+// Totals is the usage of one model.
+type Totals struct {
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// Cost returns the cost of t at the price of model, and false if the model
+// has no price.
+func (t Totals) Cost(model string) (float64, bool) {
+	p, ok := PriceOf(model)
+	if !ok {
+		return 0, false
+	}
+	return (float64(t.PromptTokens)*p.Prompt + float64(t.CompletionTokens)*p.Completion) / 1e6, true
+}
+
+// Tracker accumulates usage per model. It is safe for concurrent use.
+type Tracker struct {
+	mu      sync.Mutex
+	models  map[string]*Totals
+	context map[string]float64 // Tokens per contributor, see AddContext
+}
+
+// Default is the tracker llm.FromEnv meters into.
+var Default = &Tracker{}
+
+// Add records the usage of one call to model.
+func (t *Tracker) Add(model string, u openai.Usage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.models == nil {
+		t.models = map[string]*Totals{}
+	}
+	m := t.models[model]
+	if m == nil {
+		m = &Totals{}
+		t.models[model] = m
+	}
+	m.Requests++
+	m.PromptTokens += u.PromptTokens
+	m.CompletionTokens += u.CompletionTokens
+}
+
+// Models returns a copy of the totals per model.
+func (t *Tracker) Models() map[string]Totals {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[string]Totals, len(t.models))
+	for name, m := range t.models {
+		out[name] = *m
+	}
+	return out
+}
+
+// Cost returns the total cost of the priced models.
+func (t *Tracker) Cost() float64 {
+	var sum float64
+	for name, m := range t.Models() {
+		c, _ := m.Cost(name)
+		sum += c
+	}
+	return sum
+}
+
+// Print writes a table of requests, tokens and cost per model and the
+// total, then the tokens by context part (PrintContext). It prints nothing
+// if no calls were made.
+//
+//	Usage:
+//	  gpt-4o-mini   7 requests   5210 prompt + 412 completion tokens   $0.0010
+//	  total         7 requests   5210 prompt + 412 completion tokens   $0.0010
+func (t *Tracker) Print(w io.Writer) {
+	models := t.Models()
+	if len(models) == 0 {
+		return
+	}
+	names := make([]string, 0, len(models))
+	width := len("total")
+	for name := range models {
+		names = append(names, name)
+		width = max(width, len(name))
+	}
+	sort.Strings(names)
+
+	row := func(name string, m Totals, cost string) {
+		fmt.Fprintf(w, "  %-*s  %3d requests  %7d prompt + %6d completion tokens  %s\n",
+			width, name, m.Requests, m.PromptTokens, m.CompletionTokens, cost)
+	}
+	var total Totals
+	var sum float64
+	unpriced := false
+	fmt.Fprintln(w, "Usage:")
+	for _, name := range names {
+		m := models[name]
+		total.Requests += m.Requests
+		total.PromptTokens += m.PromptTokens
+		total.CompletionTokens += m.CompletionTokens
+		c, ok := m.Cost(name)
+		if !ok {
+			unpriced = true
+			row(name, m, "no price")
+			continue
+		}
+		sum += c
+		row(name, m, fmt.Sprintf("$%.4f", c))
+	}
+	cost := fmt.Sprintf("$%.4f", sum)
+	if unpriced {
+		cost += " + unpriced"
+	}
+	row("total", total, cost)
+	t.PrintContext(w)
+}
@@ -0,0 +1,68 @@
+package mockllm
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// embeddingDims is the size of mock embeddings.
+const embeddingDims = 64
+
+// embeddings answers with bag-of-words vectors: texts that share words get
+// a high cosine similarity, which is all the labs' similarity search needs.
+func (s *Server) embeddings(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Input any    `json:"input"`
+		Model string `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var inputs []string
+	switch in := req.Input.(type) {
+	case string:
+		inputs = []string{in}
+	case []any:
+		for _, v := range in {
+			if s, ok := v.(string); ok {
+				inputs = append(inputs, s)
+			}
+		}
+	}
+	resp := openai.EmbeddingResponse{Object: "list", Model: openai.EmbeddingModel(req.Model)}
+	for i, text := range inputs {
+		resp.Data = append(resp.Data, openai.Embedding{Object: "embedding", Embedding: Embed(text), Index: i})
+		resp.Usage.PromptTokens += len(text) / 4
+	}
+	resp.Usage.TotalTokens = resp.Usage.PromptTokens
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Embed returns the mock embedding of text: normalized counts of hashed words.
+func Embed(text string) []float32 {
+	v := make([]float32, embeddingDims)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !('a' <= r && r <= 'z' || '0' <= r && r <= '9')
+	}) {
+		h := fnv.New32a()
+		h.Write([]byte(word))
+		v[h.Sum32()%embeddingDims]++
+	}
+	var norm float64
+	for _, x := range v {
+		norm += float64(x * x)
+	}
+	if norm > 0 {
+		for i := range v {
+			v[i] /= float32(math.Sqrt(norm))
+		}
+	}
+	return v
+}
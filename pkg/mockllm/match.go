@@ -0,0 +1,75 @@
+package mockllm
+
+import (
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Helpers for Turn.When and Turn.Reply.
+
+// JSONMode reports whether the request asks for a JSON response
+// (planners, judges).
+func JSONMode(req openai.ChatCompletionRequest) bool {
+	f := req.ResponseFormat
+	return f != nil && f.Type != "" && f.Type != openai.ChatCompletionResponseFormatTypeText
+}
+
+// HasTools reports whether the request offers tools (the agent loop).
+func HasTools(req openai.ChatCompletionRequest) bool {
+	return len(req.Tools) > 0
+}
+
+// Offers returns a When that accepts requests offering the named tool.
+// Multi-agent labs use it to tell the supervisor from the workers.
+func Offers(tool string) func(openai.ChatCompletionRequest) bool {
+	return func(req openai.ChatCompletionRequest) bool {
+		for _, t := range req.Tools {
+			if t.Function != nil && t.Function.Name == tool {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Mentions returns a When that accepts requests whose last user message
+// contains text (case-insensitive).
+func Mentions(text string) func(openai.ChatCompletionRequest) bool {
+	text = strings.ToLower(text)
+	return func(req openai.ChatCompletionRequest) bool {
+		return strings.Contains(strings.ToLower(LastUser(req)), text)
+	}
+}
+
+// All returns a When that accepts requests accepted by every condition.
+func All(conds ...func(openai.ChatCompletionRequest) bool) func(openai.ChatCompletionRequest) bool {
+	return func(req openai.ChatCompletionRequest) bool {
+		for _, c := range conds {
+			if !c(req) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// LastUser returns the content of the last user message.
+func LastUser(req openai.ChatCompletionRequest) string {
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == openai.ChatMessageRoleUser {
+			return req.Messages[i].Content
+		}
+	}
+	return ""
+}
+
+// LastToolResult returns the content of the last tool message.
+func LastToolResult(req openai.ChatCompletionRequest) string {
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == openai.ChatMessageRoleTool {
+			return req.Messages[i].Content
+		}
+	}
+	return ""
+}
@@ -0,0 +1,296 @@
+// Package mockllm is a scripted LLM server that speaks the OpenAI chat
+// completions protocol, so every lab runs offline: no API key, no GPU.
+//
+// A lab describes the conversation it expects as a Script of turns and
+// registers it; with OPENAI_BASE_URL=mock, llm.FromEnv starts the server
+// and points the client at it:
+//
+//	func init() {
+//		mockllm.Register(
+//			mockllm.Call("check_disk", nil),
+//			mockllm.Call("clean_logs", nil),
+//			mockllm.Say("Freed 20GB."),
+//		)
+//	}
+//
+// Each request is answered with the first unused turn whose When accepts
+// it. When the script runs out, the server replies with plain text, so a
+// lab always terminates.
+package mockllm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// URL is the value of OPENAI_BASE_URL that selects the mock server.
+const URL = "mock"
+
+// Turn is one scripted model reply.
+type Turn struct {
+	// When, if set, must accept the request for this turn to be used.
+	// Labs use it to tell the planner's JSON call from the tool loop.
+	When func(req openai.ChatCompletionRequest) bool
+
+	Content   string
+	ToolCalls []ToolCall
+
+	// Reply, if set, builds the reply from the request instead of
+	// Content/ToolCalls: e.g. to pass on a blob reference from a tool result.
+	Reply func(req openai.ChatCompletionRequest) Turn
+}
+
+// ToolCall is a scripted tool call. Args is marshaled to JSON; nil means {}.
+type ToolCall struct {
+	Name string
+	Args any
+}
+
+// Script is the sequence of turns of one lab.
+type Script []Turn
+
+// Say returns a turn that answers with text.
+func Say(content string) Turn {
+	return Turn{Content: content}
+}
+
+// Call returns a turn that calls one tool.
+func Call(name string, args any) Turn {
+	return Turn{ToolCalls: []ToolCall{{Name: name, Args: args}}}
+}
+
+// Think returns a turn that calls a tool with a thought in Content, the
+// way labs that print the model's reasoning expect it.
+func Think(thought, name string, args any) Turn {
+	return Turn{Content: thought, ToolCalls: []ToolCall{{Name: name, Args: args}}}
+}
+
+// If returns t restricted to requests accepted by when.
+func (t Turn) If(when func(req openai.ChatCompletionRequest) bool) Turn {
+	t.When = when
+	return t
+}
+
+var (
+	registeredMu sync.Mutex
+	registered   Script
+)
+
+// Register appends turns to the script used by llm.FromEnv. Labs call it
+// from init() in mock.go.
+func Register(turns ...Turn) {
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	registered = append(registered, turns...)
+}
+
+// Registered returns a copy of the registered script.
+func Registered() Script {
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	return append(Script(nil), registered...)
+}
+
+// Server is a running mock. Requests lists every chat request received.
+type Server struct {
+	*httptest.Server
+
+	// Window, if set, is the context window in tokens, counted as in the
+	// usage the mock reports: a longer request gets the error OpenAI sends
+	// for one (context_length_exceeded), and no turn is used up.
+	Window int
+
+	mu       sync.Mutex
+	script   Script
+	used     []bool
+	calls    int
+	Requests []openai.ChatCompletionRequest
+}
+
+// Start starts a server with the script. Close it when done; labs that
+// exit right after the run may leave it to the process exit.
+func Start(script Script) *Server {
+	s := &Server{script: script, used: make([]bool, len(script))}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/chat/completions", s.chat)
+	mux.HandleFunc("/v1/embeddings", s.embeddings)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// BaseURL is the URL to use as OPENAI_BASE_URL.
+func (s *Server) BaseURL() string {
+	return s.URL + "/v1"
+}
+
+// next picks the first unused turn that accepts req.
+func (s *Server) next(req openai.ChatCompletionRequest) Turn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Requests = append(s.Requests, req)
+	for i, t := range s.script {
+		if s.used[i] || (t.When != nil && !t.When(req)) {
+			continue
+		}
+		s.used[i] = true
+		if t.Reply != nil {
+			return t.Reply(req)
+		}
+		return t
+	}
+	return fallback(req)
+}
+
+// fallback answers when the script has nothing for the request.
+func fallback(req openai.ChatCompletionRequest) Turn {
+	if JSONMode(req) {
+		return Say("{}")
+	}
+	return Say("(mock) Script finished: nothing more to do.")
+}
+
+func (s *Server) message(t Turn) openai.ChatCompletionMessage {
+	msg := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: t.Content}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range t.ToolCalls {
+		args := []byte("{}")
+		if c.Args != nil {
+			if raw, ok := c.Args.(string); ok {
+				args = []byte(raw) // Already JSON (or deliberately broken)
+			} else {
+				args, _ = json.Marshal(c.Args)
+			}
+		}
+		s.calls++
+		msg.ToolCalls = append(msg.ToolCalls, openai.ToolCall{
+			ID:       fmt.Sprintf("call_mock_%d", s.calls),
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: c.Name, Arguments: string(args)},
+		})
+	}
+	return msg
+}
+
+func (s *Server) chat(w http.ResponseWriter, r *http.Request) {
+	var req openai.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if n := usageOf(req, openai.ChatCompletionMessage{}).PromptTokens; s.Window > 0 && n > s.Window {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{"error": map[string]any{
+			"message": fmt.Sprintf("This model's maximum context length is %d tokens. However, your messages resulted in %d tokens.", s.Window, n),
+			"type":    "invalid_request_error",
+			"code":    "context_length_exceeded",
+		}})
+		return
+	}
+	msg := s.message(s.next(req))
+	finish := openai.FinishReasonStop
+	if len(msg.ToolCalls) > 0 {
+		finish = openai.FinishReasonToolCalls
+	}
+	usage := usageOf(req, msg)
+
+	if req.Stream {
+		var u *openai.Usage
+		if req.StreamOptions != nil && req.StreamOptions.IncludeUsage {
+			u = &usage
+		}
+		stream(r.Context(), w, req.Model, msg, finish, u)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+		ID:      "chatcmpl-mock",
+		Object:  "chat.completion",
+		Model:   req.Model,
+		Choices: []openai.ChatCompletionChoice{{Message: msg, FinishReason: finish}},
+		Usage:   usage,
+	})
+}
+
+// chunkDelay paces streamed words like a real model, so a user has time
+// to interrupt a long reply.
+const chunkDelay = 40 * time.Millisecond
+
+// stream sends msg as server-sent events: content word by word, then
+// each tool call in two deltas (name, then arguments), then usage in a
+// chunk without choices if it is not nil. It stops when the client goes
+// away (ctx is done).
+func stream(ctx context.Context, w http.ResponseWriter, model string, msg openai.ChatCompletionMessage, finish openai.FinishReason, usage *openai.Usage) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	flusher, _ := w.(http.Flusher)
+	send := func(delta openai.ChatCompletionStreamChoiceDelta, finish openai.FinishReason) {
+		data, _ := json.Marshal(openai.ChatCompletionStreamResponse{
+			ID:      "chatcmpl-mock",
+			Object:  "chat.completion.chunk",
+			Model:   model,
+			Choices: []openai.ChatCompletionStreamChoice{{Delta: delta, FinishReason: finish}},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	send(openai.ChatCompletionStreamChoiceDelta{Role: openai.ChatMessageRoleAssistant}, "")
+	for _, word := range strings.SplitAfter(msg.Content, " ") {
+		if word != "" {
+			send(openai.ChatCompletionStreamChoiceDelta{Content: word}, "")
+			select {
+			case <-time.After(chunkDelay):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+	for i, c := range msg.ToolCalls {
+		index := i
+		send(openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{{
+			Index: &index, ID: c.ID, Type: c.Type, Function: openai.FunctionCall{Name: c.Function.Name},
+		}}}, "")
+		send(openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{{
+			Index: &index, Function: openai.FunctionCall{Arguments: c.Function.Arguments},
+		}}}, "")
+	}
+	send(openai.ChatCompletionStreamChoiceDelta{}, finish)
+	if usage != nil {
+		data, _ := json.Marshal(openai.ChatCompletionStreamResponse{
+			ID:      "chatcmpl-mock",
+			Object:  "chat.completion.chunk",
+			Model:   model,
+			Choices: []openai.ChatCompletionStreamChoice{},
+			Usage:   usage,
+		})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// usageOf estimates token usage (~4 characters per token), so labs that
+// budget or condense by usage see numbers that grow with the history.
+func usageOf(req openai.ChatCompletionRequest, msg openai.ChatCompletionMessage) openai.Usage {
+	prompt := 0
+	for _, m := range req.Messages {
+		prompt += len(m.Content)/4 + 4
+		for _, c := range m.ToolCalls {
+			prompt += (len(c.Function.Name)+len(c.Function.Arguments))/4 + 8
+		}
+	}
+	completion := len(msg.Content) / 4
+	for _, c := range msg.ToolCalls {
+		completion += (len(c.Function.Name)+len(c.Function.Arguments))/4 + 8
+	}
+	return openai.Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}
+}
@@ -0,0 +1,251 @@
+// Package normalize rewrites dates, versions and quantities in text into
+// one canonical form, so the same fact written two ways is the same string:
+//
+//	"Jan 5, 2024", "05.01.2024", "5 января 2024"  → "2024-01-05"
+//	"ubuntu 22.04 LTS", "Ubuntu v22.04"          → "Ubuntu 22.04"
+//	"version 2.0", "версия 2.0"                   → "v2.0"
+//	"10 TB", "10tb", "10 терабайт"                → "10TB"
+//	"1,5 GB", "30 sec", "95 percent"              → "1.5GB", "30s", "95%"
+//
+// Long-term memory runs notes and queries through Text: a fact saved as
+// "upgraded to PostgreSQL v16 on 5 March 2024" is found by "postgres 16"
+// and "2024-03-05", and two notes about the same thing can be compared.
+// English and Russian spellings are understood; everything else is left
+// as it was.
+package normalize
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Text returns s with dates, versions and quantities in canonical form.
+func Text(s string) string {
+	s = dates(s)
+	s = versions(s)
+	return quantities(s)
+}
+
+// --- Dates → 2006-01-02 ---
+
+// monthPrefixes map the start of a month name to its number: "janvier"
+// is not matched, "January", "Jan.", "января", "янв" are.
+var monthPrefixes = []struct {
+	prefix string
+	month  time.Month
+}{
+	{"jan", 1}, {"feb", 2}, {"mar", 3}, {"apr", 4}, {"may", 5}, {"jun", 6},
+	{"jul", 7}, {"aug", 8}, {"sep", 9}, {"oct", 10}, {"nov", 11}, {"dec", 12},
+	{"янв", 1}, {"фев", 2}, {"мар", 3}, {"апр", 4}, {"ма", 5}, {"июн", 6},
+	{"июл", 7}, {"авг", 8}, {"сен", 9}, {"окт", 10}, {"ноя", 11}, {"дек", 12},
+}
+
+// month returns the month a word names, or 0.
+func month(word string) time.Month {
+	w := strings.ToLower(word)
+	if n := len([]rune(w)); n < 3 || n > 9 {
+		return 0
+	}
+	for _, m := range monthPrefixes {
+		if strings.HasPrefix(w, m.prefix) {
+			if m.prefix == "ма" && w != "мая" && w != "май" {
+				return 0 // "март", "марта" are March, matched by "мар"
+			}
+			return m.month
+		}
+	}
+	return 0
+}
+
+var (
+	// 5 January 2024, 5th Jan 2024, 5 января 2024 г.
+	dateDMonY = regexp.MustCompile(`(?i)\b(\d{1,2})(?:st|nd|rd|th)?\.?\s+(\p{L}+)\.?,?\s+(\d{4})\b`)
+	// January 5, 2024; Jan 5th 2024
+	dateMonDY = regexp.MustCompile(`(?i)(\p{L}+)\.?\s+(\d{1,2})(?:st|nd|rd|th)?,?\s+(\d{4})\b`)
+	// 05.01.2024 (day first, as in Europe and Russia)
+	dateDotted = regexp.MustCompile(`\b(\d{1,2})\.(\d{1,2})\.(\d{4})\b`)
+	// 01/05/2024 (month first unless the first number can't be a month)
+	dateSlashed = regexp.MustCompile(`\b(\d{1,2})/(\d{1,2})/(\d{4})\b`)
+	// 2024/1/5, 2024.01.05, 2024-1-5
+	dateYMD = regexp.MustCompile(`\b(\d{4})[-/.](\d{1,2})[-/.](\d{1,2})\b`)
+)
+
+func dates(s string) string {
+	s = replace(dateDMonY, s, func(m []string) (string, bool) {
+		return isoDate(m[3], month(m[2]), m[1])
+	})
+	s = replace(dateMonDY, s, func(m []string) (string, bool) {
+		return isoDate(m[3], month(m[1]), m[2])
+	})
+	s = replace(dateDotted, s, func(m []string) (string, bool) {
+		mon, _ := strconv.Atoi(m[2])
+		return isoDate(m[3], time.Month(mon), m[1])
+	})
+	s = replace(dateSlashed, s, func(m []string) (string, bool) {
+		a, _ := strconv.Atoi(m[1])
+		b, _ := strconv.Atoi(m[2])
+		if a > 12 {
+			return isoDate(m[3], time.Month(b), m[1])
+		}
+		return isoDate(m[3], time.Month(a), m[2])
+	})
+	return replace(dateYMD, s, func(m []string) (string, bool) {
+		mon, _ := strconv.Atoi(m[2])
+		return isoDate(m[1], time.Month(mon), m[3])
+	})
+}
+
+// isoDate formats a date, or reports false if there is no such day.
+func isoDate(year string, mon time.Month, day string) (string, bool) {
+	y, _ := strconv.Atoi(year)
+	d, _ := strconv.Atoi(day)
+	if mon < 1 || mon > 12 || d < 1 {
+		return "", false
+	}
+	t := time.Date(y, mon, d, 0, 0, 0, 0, time.UTC)
+	if t.Month() != mon || t.Day() != d {
+		return "", false // February 30
+	}
+	return t.Format(time.DateOnly), true
+}
+
+// --- Versions ---
+
+// products are the names versions are written after, with their
+// spellings. The canonical name is the first.
+var products = [][]string{
+	{"Ubuntu", "ubuntu", "убунту"},
+	{"Debian", "debian", "дебиан"},
+	{"CentOS", "centos"},
+	{"RHEL", "rhel"},
+	{"Alpine", "alpine"},
+	{"PostgreSQL", "postgresql", "postgres", "pg", "постгрес", "постгресе", "постгреса"},
+	{"MySQL", "mysql"},
+	{"Redis", "redis"},
+	{"Nginx", "nginx"},
+	{"Kubernetes", "kubernetes", "k8s", "кубернетес"},
+	{"Docker", "docker"},
+	{"Python", "python"},
+	{"Node.js", "node.js", "nodejs"},
+	{"Terraform", "terraform"},
+	{"Ansible", "ansible"},
+	{"Vault", "vault"},
+	{"Prometheus", "prometheus"},
+	{"Grafana", "grafana"},
+}
+
+var (
+	productVersion = regexp.MustCompile(`(?i)(^|[^\p{L}\d.])(` + alternation(products) + `)[\s_-]*v?(\d+(?:\.\d+)*)(?:\s*LTS)?`)
+	// version 2.0, ver. 2.0, версия 2.0, V2.0
+	versionWord = regexp.MustCompile(`(?i)(^|[^\p{L}\d])(?:version|ver\.?|версии|версию|версия|v)\s*(\d+(?:\.\d+)+)`)
+)
+
+func versions(s string) string {
+	s = replace(productVersion, s, func(m []string) (string, bool) {
+		return m[1] + canonical(products, m[2]) + " " + m[3], true
+	})
+	return replace(versionWord, s, func(m []string) (string, bool) {
+		return m[1] + "v" + m[2], true
+	})
+}
+
+// --- Quantities ---
+
+// units are the canonical units with their spellings. Decimal and binary
+// sizes stay apart: 1GB is not 1GiB.
+var units = [][]string{
+	{"B", "bytes", "byte", "байт", "байта", "байтов"},
+	{"KB", "kb", "kilobytes", "кб", "килобайт", "килобайта", "килобайтов"},
+	{"MB", "mb", "megabytes", "мб", "мегабайт", "мегабайта", "мегабайтов"},
+	{"GB", "gb", "gigabytes", "гб", "гигабайт", "гигабайта", "гигабайтов"},
+	{"TB", "tb", "terabytes", "тб", "терабайт", "терабайта", "терабайтов"},
+	{"PB", "pb", "petabytes", "пб", "петабайт", "петабайта", "петабайтов"},
+	{"KiB", "kib"}, {"MiB", "mib"}, {"GiB", "gib"}, {"TiB", "tib"},
+	{"ms", "ms", "msec", "milliseconds", "millisecond", "мс", "миллисекунд", "миллисекунды"},
+	{"s", "s", "sec", "secs", "seconds", "second", "сек", "секунд", "секунды", "секунду"},
+	{"min", "m", "min", "mins", "minutes", "minute", "мин", "минут", "минуты", "минуту"},
+	{"h", "h", "hr", "hrs", "hours", "hour", "ч", "час", "часа", "часов"},
+	{"d", "d", "days", "day", "дн", "дня", "дней", "день"},
+	{"%", "%", "percent", "pct", "процент", "процента", "процентов"},
+}
+
+// quantity is a number with an optional thousands separator (1,000, or a
+// non-breaking space as in Russian typography) and a decimal point or
+// comma (1.5, 1,5), then a unit.
+var quantity = regexp.MustCompile(`(?i)(\d{1,3}(?:[,\x{00A0}\x{202F}]\d{3})+|\d+)(?:[.,](\d+))?\s*(` + alternation(units) + `)`)
+
+// quantities rewrites the quantities that stand as words of their own:
+// "5 min" but not "5 minor", "10GB" but not "v1.10gb".
+func quantities(s string) string {
+	var b strings.Builder
+	at := 0
+	for _, m := range quantity.FindAllStringSubmatchIndex(s, -1) {
+		before, _ := utf8.DecodeLastRuneInString(s[:m[0]])
+		after, _ := utf8.DecodeRuneInString(s[m[1]:])
+		if m[0] > 0 && (wordRune(before) || before == '.' || before == ',') || m[1] < len(s) && wordRune(after) {
+			continue
+		}
+		n := strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, s[m[2]:m[3]])
+		if m[4] >= 0 {
+			n += "." + s[m[4]:m[5]]
+		}
+		b.WriteString(s[at:m[0]])
+		b.WriteString(n + canonical(units, s[m[6]:m[7]]))
+		at = m[1]
+	}
+	b.WriteString(s[at:])
+	return b.String()
+}
+
+func wordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// --- Helpers ---
+
+// replace is ReplaceAllStringFunc with submatches; fn returning false
+// leaves the match as it was.
+func replace(re *regexp.Regexp, s string, fn func(m []string) (string, bool)) string {
+	return re.ReplaceAllStringFunc(s, func(match string) string {
+		if out, ok := fn(re.FindStringSubmatch(match)); ok {
+			return out
+		}
+		return match
+	})
+}
+
+// alternation is a regexp alternative of all spellings, longest first so
+// "minutes" wins over "m".
+func alternation(table [][]string) string {
+	var all []string
+	for _, row := range table {
+		all = append(all, row[1:]...)
+	}
+	slices.SortFunc(all, func(a, b string) int { return len([]rune(b)) - len([]rune(a)) })
+	for i, a := range all {
+		all[i] = regexp.QuoteMeta(a)
+	}
+	return strings.Join(all, "|")
+}
+
+// canonical returns the canonical form of a spelling in table.
+func canonical(table [][]string, spelling string) string {
+	s := strings.ToLower(spelling)
+	for _, row := range table {
+		if slices.Contains(row[1:], s) {
+			return row[0]
+		}
+	}
+	panic(fmt.Sprintf("normalize: %q is not in the table", spelling))
+}
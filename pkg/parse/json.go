@@ -0,0 +1,86 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// JSON finds the first JSON value in the text that decodes into a T.
+// Prose around it and ```json fences are skipped, so it works both on
+// response_format=json_object output and on a model that "explains" first.
+// Objects are tried before arrays, so a "[1]" footnote doesn't win over the
+// payload. Use JSON[json.RawMessage]() to extract without decoding (e.g. to
+// validate against a schema.Schema first).
+func JSON[T any]() Parser[T] {
+	return func(text string) (T, error) {
+		var firstErr error
+		for _, open := range []byte{'{', '['} {
+			for _, raw := range candidates(text, open) {
+				var v T
+				err := json.Unmarshal([]byte(raw), &v)
+				if err == nil {
+					return v, nil
+				}
+				if firstErr == nil {
+					firstErr = fmt.Errorf("parse: invalid JSON: %w", err)
+				}
+			}
+		}
+		var zero T
+		if firstErr != nil {
+			return zero, firstErr
+		}
+		if strings.TrimSpace(text) == "" {
+			return zero, fmt.Errorf("parse: empty text, want JSON")
+		}
+		return zero, fmt.Errorf("parse: no JSON found")
+	}
+}
+
+// candidates returns the balanced, valid JSON values starting with open,
+// outermost first. Nested values are not returned separately.
+func candidates(text string, open byte) []string {
+	var out []string
+	for i := 0; i < len(text); i++ {
+		if text[i] != open {
+			continue
+		}
+		end := matchBracket(text, i)
+		if end < 0 {
+			continue
+		}
+		if c := text[i : end+1]; json.Valid([]byte(c)) {
+			out = append(out, c)
+			i = end
+		}
+	}
+	return out
+}
+
+// matchBracket returns the index of the bracket closing the one at start,
+// skipping brackets inside strings, or -1.
+func matchBracket(text string, start int) int {
+	depth := 0
+	inString, escaped := false, false
+	for i := start; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
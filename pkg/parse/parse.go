@@ -0,0 +1,181 @@
+// Package parse extracts typed data from model output and tool results.
+//
+// Models wrap JSON in ```json fences, put a sentence before a table, number
+// a list with "1)" instead of "1.". Checking such text with strings.Contains
+// passes on the wrong answer and fails on the right one. A Parser finds the
+// part it needs and returns it typed, or an error that says what was missing:
+//
+//	usage, err := parse.Then(parse.Match(`(\d+)%`), strconv.Atoi)(checkDisk())
+//	plan, err := parse.JSON[Plan]()(resp.Choices[0].Message.Content)
+//	rows, err := parse.Then(parse.Fenced(""), parse.Tabular())(answer)
+//
+// Parsers are plain functions, so they chain with Then and fall back with Or.
+// Elements reads a JSON object while it streams, element by element.
+package parse
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Parser turns text into a T.
+type Parser[T any] func(text string) (T, error)
+
+// Then runs p and passes its result to next. With p returning a string,
+// next can be another Parser: Then(Fenced("json"), JSON[Plan]()).
+func Then[A, B any](p Parser[A], next func(A) (B, error)) Parser[B] {
+	return func(text string) (B, error) {
+		a, err := p(text)
+		if err != nil {
+			var zero B
+			return zero, err
+		}
+		return next(a)
+	}
+}
+
+// Or returns a parser that tries p, then each fallback in turn, and returns
+// the first success. If all fail, the errors of all of them are returned.
+func (p Parser[T]) Or(fallbacks ...Parser[T]) Parser[T] {
+	return func(text string) (T, error) {
+		v, err := p(text)
+		if err == nil {
+			return v, nil
+		}
+		errs := []error{err}
+		for _, f := range fallbacks {
+			v, err := f(text)
+			if err == nil {
+				return v, nil
+			}
+			errs = append(errs, err)
+		}
+		var zero T
+		return zero, errors.Join(errs...)
+	}
+}
+
+// Match returns the first capture group of the first match of pattern, or
+// the whole match if the pattern has no groups. It panics on a bad pattern,
+// like regexp.MustCompile: patterns are part of the code, not input.
+func Match(pattern string) Parser[string] {
+	re := regexp.MustCompile(pattern)
+	return func(text string) (string, error) {
+		m := re.FindStringSubmatch(text)
+		if m == nil {
+			return "", fmt.Errorf("parse: no match for /%s/", pattern)
+		}
+		if len(m) > 1 {
+			return m[1], nil
+		}
+		return m[0], nil
+	}
+}
+
+// Regex returns the named capture groups of the first match of pattern.
+// Unnamed groups are keyed by their number ("1", "2", ...).
+func Regex(pattern string) Parser[map[string]string] {
+	re := regexp.MustCompile(pattern)
+	return func(text string) (map[string]string, error) {
+		m := re.FindStringSubmatch(text)
+		if m == nil {
+			return nil, fmt.Errorf("parse: no match for /%s/", pattern)
+		}
+		return groups(re, m), nil
+	}
+}
+
+// RegexAll is Regex for every match, in order.
+func RegexAll(pattern string) Parser[[]map[string]string] {
+	re := regexp.MustCompile(pattern)
+	return func(text string) ([]map[string]string, error) {
+		all := re.FindAllStringSubmatch(text, -1)
+		if all == nil {
+			return nil, fmt.Errorf("parse: no match for /%s/", pattern)
+		}
+		out := make([]map[string]string, 0, len(all))
+		for _, m := range all {
+			out = append(out, groups(re, m))
+		}
+		return out, nil
+	}
+}
+
+func groups(re *regexp.Regexp, m []string) map[string]string {
+	g := map[string]string{}
+	for i, name := range re.SubexpNames() {
+		if i == 0 {
+			continue
+		}
+		if name == "" {
+			name = fmt.Sprint(i)
+		}
+		g[name] = m[i]
+	}
+	return g
+}
+
+// Fenced returns the body of the first ``` code block with the given
+// language tag ("" for any block).
+func Fenced(lang string) Parser[string] {
+	return func(text string) (string, error) {
+		rest := text
+		for {
+			start := strings.Index(rest, "```")
+			if start < 0 {
+				break
+			}
+			rest = rest[start+3:]
+			header, body, ok := strings.Cut(rest, "\n")
+			if !ok {
+				break
+			}
+			end := strings.Index(body, "```")
+			if end < 0 {
+				break
+			}
+			if lang == "" || strings.EqualFold(strings.TrimSpace(header), lang) {
+				return strings.TrimRight(body[:end], "\n"), nil
+			}
+			rest = body[end+3:]
+		}
+		if lang == "" {
+			return "", fmt.Errorf("parse: no code block")
+		}
+		return "", fmt.Errorf("parse: no %s code block", lang)
+	}
+}
+
+// After returns the text after the first line that contains marker, up to
+// the next blank line: the block under "Plan:" or "## Findings".
+func After(marker string) Parser[string] {
+	return func(text string) (string, error) {
+		lines := strings.Split(text, "\n")
+		for i, l := range lines {
+			if !strings.Contains(l, marker) {
+				continue
+			}
+			var block []string
+			// Text on the marker line itself ("Status: ok") belongs to the block.
+			if tail := strings.TrimSpace(l[strings.Index(l, marker)+len(marker):]); tail != "" {
+				block = append(block, tail)
+			}
+			for _, l := range lines[i+1:] {
+				if strings.TrimSpace(l) == "" {
+					if len(block) == 0 {
+						continue // Blank lines right after the marker
+					}
+					break
+				}
+				block = append(block, l)
+			}
+			if len(block) == 0 {
+				return "", fmt.Errorf("parse: nothing after %q", marker)
+			}
+			return strings.Join(block, "\n"), nil
+		}
+		return "", fmt.Errorf("parse: %q not found", marker)
+	}
+}
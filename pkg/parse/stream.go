@@ -0,0 +1,131 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Elements reads a JSON object that arrives in pieces, as a streamed
+// completion does, and hands each element of one of its array fields to
+// a function as soon as the element is complete:
+//
+//	steps := parse.NewElements("steps", func(i int, step json.RawMessage) error {
+//		return checkStep(i, step) // an error stops the stream
+//	})
+//	resp, err := llm.CollectUntil(stream, steps.Write)
+//
+// So a plan whose second step names a tool that doesn't exist is caught
+// when that step closes, not after the model has written ten more. Text
+// before the object (prose, a ```json fence) is skipped. Elements doesn't
+// validate the rest of the document: parse the whole reply when it is
+// complete.
+type Elements struct {
+	field string
+	fn    func(i int, raw json.RawMessage) error
+	err   error
+	n     int // Elements handed over
+
+	started, done     bool
+	depth             int
+	inString, escaped bool
+	str               []byte // The string being read at depth 1: maybe a key
+	last, key         string // The last string at depth 1; the key whose value is being read
+	inField           bool   // Inside the array of field
+	elem              []byte // The element being read; nil between elements
+}
+
+// NewElements returns an Elements that calls fn with each element of the
+// array field of the top-level object, i counting from 0.
+func NewElements(field string, fn func(i int, raw json.RawMessage) error) *Elements {
+	return &Elements{field: field, fn: fn}
+}
+
+// Write reads the next piece of the text. It returns the error of fn, and
+// keeps returning it: the rest of the text is not read.
+func (e *Elements) Write(chunk string) error {
+	for i := 0; i < len(chunk) && e.err == nil && !e.done; i++ {
+		c := chunk[i]
+		if !e.started {
+			if c == '{' {
+				e.started, e.depth = true, 1
+			}
+			continue
+		}
+		if e.elem != nil {
+			e.elem = append(e.elem, c)
+		}
+		if e.inString {
+			switch {
+			case e.escaped:
+				e.escaped = false
+			case c == '\\':
+				e.escaped = true
+			case c == '"':
+				e.inString = false
+				if e.depth == 1 {
+					e.last = string(e.str)
+				}
+				continue
+			}
+			if e.depth == 1 {
+				e.str = append(e.str, c)
+			}
+			continue
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n':
+		case '"':
+			e.inString, e.str = true, e.str[:0]
+			e.begin(c)
+		case '{', '[':
+			e.begin(c)
+			if e.depth == 1 && c == '[' && e.key == e.field {
+				e.inField = true
+			}
+			e.depth++
+		case '}', ']':
+			e.depth--
+			switch {
+			case e.depth == 0:
+				e.done = true
+			case e.inField && e.depth == 2 && e.elem != nil:
+				e.emit(e.elem) // An object or array closed
+			case e.inField && e.depth == 1:
+				if e.elem != nil {
+					e.emit(e.elem[:len(e.elem)-1]) // A scalar before the ]
+				}
+				e.inField = false
+			}
+		case ':':
+			if e.depth == 1 {
+				e.key = e.last
+			}
+		case ',':
+			switch {
+			case e.depth == 1:
+				e.key = ""
+			case e.inField && e.depth == 2 && e.elem != nil:
+				e.emit(e.elem[:len(e.elem)-1])
+			}
+		default:
+			e.begin(c) // A number, true, false or null
+		}
+	}
+	return e.err
+}
+
+// begin starts an element at c if c starts one.
+func (e *Elements) begin(c byte) {
+	if e.inField && e.depth == 2 && e.elem == nil {
+		e.elem = []byte{c}
+	}
+}
+
+func (e *Elements) emit(raw []byte) {
+	e.elem = nil
+	e.err = e.fn(e.n, json.RawMessage(bytes.TrimSpace(raw)))
+	e.n++
+}
+
+// Count returns how many elements were handed over.
+func (e *Elements) Count() int { return e.n }
@@ -0,0 +1,140 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Table is a parsed table: a header and rows of cells.
+type Table struct {
+	Header []string
+	Rows   [][]string
+}
+
+// Column returns the cells of the named column (case-insensitive), or nil.
+func (t *Table) Column(name string) []string {
+	i := t.index(name)
+	if i < 0 {
+		return nil
+	}
+	col := make([]string, 0, len(t.Rows))
+	for _, r := range t.Rows {
+		col = append(col, cell(r, i))
+	}
+	return col
+}
+
+// Records returns the rows as header → cell maps.
+func (t *Table) Records() []map[string]string {
+	out := make([]map[string]string, 0, len(t.Rows))
+	for _, r := range t.Rows {
+		rec := make(map[string]string, len(t.Header))
+		for i, h := range t.Header {
+			rec[h] = cell(r, i)
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+func (t *Table) index(name string) int {
+	for i, h := range t.Header {
+		if strings.EqualFold(h, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func cell(row []string, i int) string {
+	if i < len(row) {
+		return row[i]
+	}
+	return ""
+}
+
+// Tabular parses the first table in the text. Markdown tables (| a | b |) are
+// recognized anywhere; otherwise the first non-empty line is taken as the
+// header of a whitespace-separated table, like `df -h` or `kubectl get pods`
+// output, where the last column takes the rest of the line.
+func Tabular() Parser[*Table] {
+	return func(text string) (*Table, error) {
+		lines := strings.Split(text, "\n")
+		if t := markdownTable(lines); t != nil {
+			return t, nil
+		}
+		return columnTable(lines)
+	}
+}
+
+func markdownTable(lines []string) *Table {
+	var t *Table
+	for _, l := range lines {
+		l = strings.TrimSpace(l)
+		if !strings.HasPrefix(l, "|") {
+			if t != nil {
+				break
+			}
+			continue
+		}
+		cells := strings.Split(strings.Trim(l, "|"), "|")
+		for i := range cells {
+			cells[i] = strings.TrimSpace(cells[i])
+		}
+		switch {
+		case t == nil:
+			t = &Table{Header: cells}
+		case isSeparator(cells):
+		default:
+			t.Rows = append(t.Rows, cells)
+		}
+	}
+	return t
+}
+
+// isSeparator reports whether cells are a markdown header separator (|---|:--:|).
+func isSeparator(cells []string) bool {
+	for _, c := range cells {
+		if strings.Trim(c, "-: ") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func columnTable(lines []string) (*Table, error) {
+	var t *Table
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			if t != nil {
+				break
+			}
+			continue
+		}
+		if t == nil {
+			t = &Table{Header: strings.Fields(l)}
+			continue
+		}
+		t.Rows = append(t.Rows, splitColumns(l, len(t.Header)))
+	}
+	if t == nil || len(t.Rows) == 0 {
+		return nil, fmt.Errorf("parse: no table found")
+	}
+	return t, nil
+}
+
+// splitColumns splits line into at most n whitespace-separated cells.
+func splitColumns(line string, n int) []string {
+	fields := strings.Fields(line)
+	if len(fields) <= n {
+		return fields
+	}
+	// Re-cut the original line so the last column keeps its inner spacing.
+	rest := strings.TrimSpace(line)
+	cells := make([]string, 0, n)
+	for i := 0; i < n-1; i++ {
+		cells = append(cells, fields[i])
+		rest = strings.TrimSpace(rest[len(fields[i]):])
+	}
+	return append(cells, rest)
+}
@@ -0,0 +1,77 @@
+package parse
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// listItem matches "1. x", "2) x", "- x", "* x", "• x".
+var listItem = regexp.MustCompile(`^\s*(?:\d+[.)]|[-*•])\s+(.+)$`)
+
+// List returns the items of the first numbered or bulleted list. Lines
+// indented under an item are appended to it; the list ends at the first
+// line that is neither.
+func List() Parser[[]string] {
+	return func(text string) ([]string, error) {
+		var items []string
+		for _, l := range strings.Split(text, "\n") {
+			if m := listItem.FindStringSubmatch(l); m != nil {
+				items = append(items, strings.TrimSpace(m[1]))
+				continue
+			}
+			if len(items) == 0 {
+				continue
+			}
+			if strings.TrimSpace(l) != "" && (strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t")) {
+				items[len(items)-1] += " " + strings.TrimSpace(l)
+				continue
+			}
+			break
+		}
+		if len(items) == 0 {
+			return nil, fmt.Errorf("parse: no list found")
+		}
+		return items, nil
+	}
+}
+
+// KeyValue returns "key: value" and "key = value" pairs, one per line.
+// Keys are lowercased and stripped of list markers and markdown emphasis,
+// so "- **Status**: OK" gives "status" → "OK". Lines without a separator
+// or a value ("Summary:") are skipped; the first occurrence of a key wins.
+func KeyValue() Parser[map[string]string] {
+	return func(text string) (map[string]string, error) {
+		kv := map[string]string{}
+		for _, l := range strings.Split(text, "\n") {
+			key, value, ok := splitPair(l)
+			if !ok {
+				continue
+			}
+			if _, seen := kv[key]; !seen && value != "" {
+				kv[key] = value
+			}
+		}
+		if len(kv) == 0 {
+			return nil, fmt.Errorf("parse: no key-value pairs found")
+		}
+		return kv, nil
+	}
+}
+
+func splitPair(line string) (key, value string, ok bool) {
+	if m := listItem.FindStringSubmatch(line); m != nil {
+		line = m[1]
+	}
+	i := strings.IndexAny(line, ":=")
+	if i <= 0 {
+		return "", "", false
+	}
+	key = strings.ToLower(strings.Trim(strings.TrimSpace(line[:i]), "*_`"))
+	value = strings.Trim(strings.TrimSpace(line[i+1:]), "*_`")
+	// A key is a short label, not a sentence that happens to contain a colon.
+	if key == "" || len(strings.Fields(key)) > 4 {
+		return "", "", false
+	}
+	return key, value, true
+}
@@ -0,0 +1,262 @@
+// Package perturb makes noisy variants of a task, the way users really
+// type it: with typos, with the sentences in another order, half in
+// Russian, or with a sentence that has nothing to do with the task.
+//
+// It is mutation testing for prompts. An eval that passes on the clean
+// task and fails on a variant shows a skill that depends on the exact
+// wording:
+//
+//	rng := rand.New(rand.NewPCG(seed, 0))
+//	noisy := perturb.Typos.Apply(task, rng)
+//
+// Words that look like identifiers (worker.log, 10:05, API, pg_stat) are
+// never changed: a task with the file name misspelled is a different task.
+package perturb
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Perturbation is one kind of noise.
+type Perturbation struct {
+	Name        string
+	Description string
+
+	// Apply returns text changed, or text itself if it has nothing this
+	// kind of noise applies to (Reorder of a single sentence).
+	Apply func(text string, rng *rand.Rand) string
+}
+
+// typoRate is the share of plain words Typos misspells; at least one is.
+const typoRate = 0.2
+
+// mixRate is the share of the words Mixed knows that it translates.
+const mixRate = 0.7
+
+var (
+	Typos = Perturbation{
+		Name:        "typos",
+		Description: "swapped, dropped and doubled letters in plain words",
+		Apply:       typos,
+	}
+	Reorder = Perturbation{
+		Name:        "reorder",
+		Description: "the sentences in another order",
+		Apply:       reorder,
+	}
+	Mixed = Perturbation{
+		Name:        "mixed",
+		Description: "common words in Russian, technical terms left in English",
+		Apply:       mixed,
+	}
+	Distractor = Perturbation{
+		Name:        "distractor",
+		Description: "an irrelevant sentence inserted among the others",
+		Apply:       distractor,
+	}
+)
+
+// All is every perturbation, in the order reports list them.
+var All = []Perturbation{Typos, Reorder, Mixed, Distractor}
+
+// Find returns the perturbations with the names given.
+func Find(names ...string) ([]Perturbation, error) {
+	var out []Perturbation
+	for _, name := range names {
+		i := slices.IndexFunc(All, func(p Perturbation) bool { return p.Name == name })
+		if i < 0 {
+			var known []string
+			for _, p := range All {
+				known = append(known, p.Name)
+			}
+			return nil, fmt.Errorf("perturb: unknown perturbation %q (have %s)", name, strings.Join(known, ", "))
+		}
+		out = append(out, All[i])
+	}
+	return out, nil
+}
+
+// plain reports whether word is an ordinary lowercase word: letters only,
+// and long enough that a typo leaves it readable.
+func plain(word string) bool {
+	if len([]rune(word)) < 4 {
+		return false
+	}
+	for _, r := range word {
+		if !unicode.IsLower(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitWord returns the word without the punctuation around it, and the
+// punctuation.
+func splitWord(token string) (pre, word, post string) {
+	start := strings.IndexFunc(token, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) })
+	if start < 0 {
+		return token, "", ""
+	}
+	end := strings.LastIndexFunc(token, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) })
+	_, size := utf8.DecodeRuneInString(token[end:])
+	end += size
+	return token[:start], token[start:end], token[end:]
+}
+
+func typos(text string, rng *rand.Rand) string {
+	tokens := strings.Split(text, " ")
+	var candidates []int
+	for i, t := range tokens {
+		if _, word, _ := splitWord(t); plain(word) {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return text
+	}
+	hit := false
+	for _, i := range candidates {
+		if rng.Float64() < typoRate {
+			tokens[i] = misspell(tokens[i], rng)
+			hit = true
+		}
+	}
+	if !hit {
+		i := candidates[rng.IntN(len(candidates))]
+		tokens[i] = misspell(tokens[i], rng)
+	}
+	return strings.Join(tokens, " ")
+}
+
+// misspell makes one typo inside the word of token, keeping its first
+// letter: people rarely get that one wrong.
+func misspell(token string, rng *rand.Rand) string {
+	pre, word, post := splitWord(token)
+	w := []rune(word)
+	i := 1 + rng.IntN(len(w)-2) // Not the first letter, not the last
+	switch rng.IntN(3) {
+	case 0: // Swap with the next
+		w[i], w[i+1] = w[i+1], w[i]
+	case 1: // Drop
+		w = slices.Delete(w, i, i+1)
+	default: // Double
+		w = slices.Insert(w, i, w[i])
+	}
+	return pre + string(w) + post
+}
+
+// sentences splits text after ., ? and ! followed by a space.
+func sentences(text string) []string {
+	var out []string
+	start := 0
+	for i := 0; i < len(text)-1; i++ {
+		if strings.ContainsRune(".?!", rune(text[i])) && text[i+1] == ' ' {
+			out = append(out, strings.TrimSpace(text[start:i+1]))
+			start = i + 1
+		}
+	}
+	if rest := strings.TrimSpace(text[start:]); rest != "" {
+		out = append(out, rest)
+	}
+	return out
+}
+
+func reorder(text string, rng *rand.Rand) string {
+	s := sentences(text)
+	if len(s) < 2 {
+		return text
+	}
+	shuffled := slices.Clone(s)
+	rng.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	if slices.Equal(shuffled, s) {
+		shuffled = append(shuffled[1:], shuffled[0]) // Never the same order
+	}
+	return strings.Join(shuffled, " ")
+}
+
+// russian is what Mixed translates: the words around the technical terms,
+// as someone writing in Russian to a chat in English leaves them. An empty
+// translation drops the word.
+var russian = map[string]string{
+	"why":       "почему",
+	"what":      "что",
+	"which":     "какая",
+	"how":       "как",
+	"many":      "сколько",
+	"times":     "раз",
+	"find":      "найди",
+	"cause":     "причину",
+	"started":   "начал",
+	"since":     "с",
+	"around":    "около",
+	"and":       "и",
+	"in":        "в",
+	"from":      "из",
+	"not":       "не",
+	"never":     "никогда не",
+	"here":      "здесь",
+	"this":      "этой",
+	"these":     "эти",
+	"directory": "папке",
+	"files":     "файлы",
+	"logs":      "логах",
+	"error":     "ошибка",
+	"new":       "новые",
+	"is":        "",
+	"are":       "",
+	"the":       "",
+	"does":      "",
+	"it":        "",
+	"out":       "",
+}
+
+func mixed(text string, rng *rand.Rand) string {
+	var out []string
+	changed := false
+	for _, t := range strings.Split(text, " ") {
+		pre, word, post := splitWord(t)
+		ru, ok := russian[strings.ToLower(word)]
+		if !ok || rng.Float64() >= mixRate {
+			out = append(out, t)
+			continue
+		}
+		changed = true
+		if ru == "" {
+			if n := len(out); n > 0 {
+				out[n-1] += pre + post // "Why is it?" → "Why is?"
+			}
+			continue
+		}
+		if first, _ := utf8.DecodeRuneInString(word); unicode.IsUpper(first) {
+			r := []rune(ru)
+			r[0] = unicode.ToUpper(r[0])
+			ru = string(r)
+		}
+		out = append(out, pre+ru+post)
+	}
+	if !changed {
+		return "Подскажи, пожалуйста: " + text
+	}
+	return strings.Join(out, " ")
+}
+
+// distractors are sentences no task is about. None names a service, a
+// file or a number a task could need.
+var distractors = []string{
+	"By the way, the coffee machine on the third floor is broken again.",
+	"I am on call until Friday, so no rush with the rest.",
+	"Marketing asked whether we could change the color of the logo.",
+	"The weekly meeting moved to Thursday.",
+	"Sorry for the late message, I was at lunch.",
+}
+
+func distractor(text string, rng *rand.Rand) string {
+	s := sentences(text)
+	d := distractors[rng.IntN(len(distractors))]
+	return strings.Join(slices.Insert(s, rng.IntN(len(s)+1), d), " ")
+}
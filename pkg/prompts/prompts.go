@@ -0,0 +1,186 @@
+// Package prompts holds the prompts several labs share, as named
+// text/template templates. A lab renders a template with its own values
+// instead of keeping a copy of the text:
+//
+//	prompt := prompts.Must("sop", prompts.SOP{
+//		Service: "the Payment Service",
+//		Steps:   []string{"Check HTTP status first.", "..."},
+//	})
+//
+// Templates are composed from smaller ones ({{template "think-aloud"}}),
+// so a rule the labs share is written once. A value a template needs and
+// doesn't get is an error, not "<no value>" in the prompt.
+package prompts
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// SOP is the data of the "sop" template: an SRE following a fixed
+// procedure (Lab 06).
+type SOP struct {
+	Service       string   // What to fix, e.g. "the Payment Service"
+	Steps         []string // The procedure; a step may have indented sub-items
+	Notes         []string // Lines after the procedure, e.g. what the severity allows
+	SimulatedTime bool     // Tool results carry the simulated time (pkg/simclock)
+}
+
+// Incident is the data of the "incident" template: an SRE working an
+// incident from a plan (Lab 14).
+type Incident struct {
+	Service       string
+	Rules         []string
+	SimulatedTime bool
+}
+
+// Supervisor is the data of the "supervisor" template: an agent that
+// delegates to workers (Lab 08).
+type Supervisor struct {
+	Workers []Worker
+}
+
+// Worker is a specialist a supervisor can ask, and the data of the
+// "specialist" template, the worker's own prompt.
+type Worker struct {
+	Tool   string // Tool the supervisor asks it with
+	Role   string // "Network Specialist"
+	Topics string // "connectivity, pings, and ports"
+	Use    string // Kind of question, e.g. "Network questions"
+}
+
+// Skill is the data of the "skill" template: the part of a system prompt
+// a skill pack adds (pkg/skill).
+type Skill struct {
+	Name     string
+	Version  string
+	Prompt   string
+	Examples []Example
+}
+
+// Example is a task and the answer a skill expects to it.
+type Example struct {
+	Task   string
+	Answer string
+}
+
+const source = `
+{{- define "think-aloud" -}}
+Think step by step. Output your thought process before calling a tool.
+{{- end}}
+
+{{- define "simulated-time" -}}
+Time is simulated: every tool call takes time, and every tool result starts with the current time.
+{{- end}}
+
+{{- define "sop" -}}
+You are a Site Reliability Engineer (SRE).
+Your goal is to fix {{.Service}}.
+Follow this Standard Operating Procedure (SOP) strictly:
+{{range $i, $step := .Steps}}{{inc $i}}. {{$step}}
+{{end}}
+{{- range .Notes}}{{.}}
+{{end}}
+{{- if .SimulatedTime}}
+{{template "simulated-time"}}
+If something has a deadline (e.g. certificate expiry), act before it.
+{{end}}
+ALWAYS {{template "think-aloud"}}
+{{- end}}
+
+{{- define "incident" -}}
+You are a Site Reliability Engineer handling an incident on {{.Service}}.
+Follow the plan you were given. Rules:
+{{range .Rules}}- {{.}}
+{{end}}
+{{- if .SimulatedTime}}
+{{template "simulated-time"}}
+{{- end}}
+{{template "think-aloud"}}
+{{- end}}
+
+{{- define "supervisor" -}}
+You are a Supervisor agent. You coordinate specialized workers.
+When you receive a task, delegate it to the appropriate specialist:
+{{range .Workers}}- {{.Use}} → {{.Tool}}
+{{end -}}
+Collect results and provide a final answer to the user.
+{{- end}}
+
+{{- define "specialist" -}}
+You are a {{.Role}}. You know about {{.Topics}}.
+{{- end}}
+
+{{- define "summarizer" -}}
+You are compressing the agent's working transcript into a brief handoff for the next step.
+Preserve:
+1. The user's original task.
+2. Decisions already made and the reasoning behind them.
+3. Which files / resources have been read and what's relevant in them.
+4. What still needs to be done.
+Drop pleasantries and chatter.
+{{- end}}
+
+{{- define "skill" -}}
+## Skill: {{.Name}} ({{.Version}})
+{{.Prompt}}
+{{- if .Examples}}
+
+Examples:
+{{- range .Examples}}
+
+Task: {{.Task}}
+Answer: {{.Answer}}
+{{- end}}
+{{- end}}
+{{- end}}
+
+{{- define "fact-extractor" -}}
+Extract the stable facts from the text: names, roles, systems and their versions, decisions.
+Skip statuses that will change soon, greetings and opinions.
+Reply with one fact per line as "key: value", with short lowercase dotted keys (user.name, db.version).
+Reply with "none" if there are no such facts.
+{{- end}}
+`
+
+var set = template.Must(template.New("prompts").
+	Option("missingkey=error").
+	Funcs(template.FuncMap{"inc": func(i int) int { return i + 1 }}).
+	Parse(source))
+
+// Render returns the prompt of the named template with vars.
+func Render(name string, vars any) (string, error) {
+	t := set.Lookup(name)
+	if t == nil {
+		return "", fmt.Errorf("prompts: no template %q (have %s)", name, strings.Join(Names(), ", "))
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, vars); err != nil {
+		return "", fmt.Errorf("prompts: %w", err)
+	}
+	return b.String(), nil
+}
+
+// Must is Render for prompts built in code: a template that doesn't
+// render with the values the code passes is a bug, so it panics.
+func Must(name string, vars any) string {
+	s, err := Render(name, vars)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Names returns the names of all templates, sorted.
+func Names() []string {
+	var names []string
+	for _, t := range set.Templates() {
+		if t.Name() != set.Name() {
+			names = append(names, t.Name())
+		}
+	}
+	slices.Sort(names)
+	return names
+}
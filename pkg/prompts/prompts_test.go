@@ -0,0 +1,188 @@
+package prompts
+
+import (
+	"strings"
+	"testing"
+)
+
+const thinkAloud = "Think step by step. Output your thought process before calling a tool."
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		tmpl string
+		vars any
+		want string
+	}{
+		{
+			name: "sop",
+			tmpl: "sop",
+			vars: SOP{Service: "the Payment Service", Steps: []string{"Check HTTP status first.", "Restart it.\n   - only once"}},
+			want: "You are a Site Reliability Engineer (SRE).\n" +
+				"Your goal is to fix the Payment Service.\n" +
+				"Follow this Standard Operating Procedure (SOP) strictly:\n" +
+				"1. Check HTTP status first.\n" +
+				"2. Restart it.\n" +
+				"   - only once\n" +
+				"\n" +
+				"ALWAYS " + thinkAloud,
+		},
+		{
+			name: "sop with notes and simulated time",
+			tmpl: "sop",
+			vars: SOP{Service: "the Payment Service", Steps: []string{"Check HTTP status first."}, Notes: []string{"Severity: SEV2."}, SimulatedTime: true},
+			want: "You are a Site Reliability Engineer (SRE).\n" +
+				"Your goal is to fix the Payment Service.\n" +
+				"Follow this Standard Operating Procedure (SOP) strictly:\n" +
+				"1. Check HTTP status first.\n" +
+				"Severity: SEV2.\n" +
+				"\n" +
+				"Time is simulated: every tool call takes time, and every tool result starts with the current time.\n" +
+				"If something has a deadline (e.g. certificate expiry), act before it.\n" +
+				"\n" +
+				"ALWAYS " + thinkAloud,
+		},
+		{
+			name: "supervisor",
+			tmpl: "supervisor",
+			vars: Supervisor{Workers: []Worker{
+				{Tool: "ask_network", Use: "Network questions"},
+				{Tool: "ask_database", Use: "Database questions"},
+			}},
+			want: "You are a Supervisor agent. You coordinate specialized workers.\n" +
+				"When you receive a task, delegate it to the appropriate specialist:\n" +
+				"- Network questions → ask_network\n" +
+				"- Database questions → ask_database\n" +
+				"Collect results and provide a final answer to the user.",
+		},
+		{
+			name: "specialist",
+			tmpl: "specialist",
+			vars: Worker{Role: "Network Specialist", Topics: "connectivity, pings, and ports"},
+			want: "You are a Network Specialist. You know about connectivity, pings, and ports.",
+		},
+		{
+			name: "summarizer",
+			tmpl: "summarizer",
+			want: "You are compressing the agent's working transcript into a brief handoff for the next step.\n" +
+				"Preserve:\n" +
+				"1. The user's original task.\n" +
+				"2. Decisions already made and the reasoning behind them.\n" +
+				"3. Which files / resources have been read and what's relevant in them.\n" +
+				"4. What still needs to be done.\n" +
+				"Drop pleasantries and chatter.",
+		},
+		{
+			name: "fact-extractor",
+			tmpl: "fact-extractor",
+			want: "Extract the stable facts from the text: names, roles, systems and their versions, decisions.\n" +
+				"Skip statuses that will change soon, greetings and opinions.\n" +
+				`Reply with one fact per line as "key: value", with short lowercase dotted keys (user.name, db.version).` + "\n" +
+				`Reply with "none" if there are no such facts.`,
+		},
+		{
+			name: "incident",
+			tmpl: "incident",
+			vars: Incident{Service: "payment-service", Rules: []string{"Verify before you act.", "Escalate at SEV1."}},
+			want: "You are a Site Reliability Engineer handling an incident on payment-service.\n" +
+				"Follow the plan you were given. Rules:\n" +
+				"- Verify before you act.\n" +
+				"- Escalate at SEV1.\n" +
+				"\n" +
+				thinkAloud,
+		},
+		{
+			name: "skill",
+			tmpl: "skill",
+			vars: Skill{Name: "postgres", Version: "1.2.0", Prompt: "Check replication lag first.", Examples: []Example{{Task: "Is the replica behind?", Answer: "Lag is 3s."}}},
+			want: "## Skill: postgres (1.2.0)\n" +
+				"Check replication lag first.\n" +
+				"\n" +
+				"Examples:\n" +
+				"\n" +
+				"Task: Is the replica behind?\n" +
+				"Answer: Lag is 3s.",
+		},
+		{
+			name: "values in a map",
+			tmpl: "specialist",
+			vars: map[string]any{"Role": "Database Specialist", "Topics": "queries"},
+			want: "You are a Database Specialist. You know about queries.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.tmpl, tt.vars)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Render(%q) =\n%s\nwant\n%s", tt.tmpl, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestComposition checks that the shared parts are written once: the
+// templates that include them render exactly what they render alone.
+func TestComposition(t *testing.T) {
+	think := Must("think-aloud", nil)
+	simulated := Must("simulated-time", nil)
+	if think != thinkAloud {
+		t.Errorf("think-aloud = %q, want %q", think, thinkAloud)
+	}
+	tests := []struct {
+		tmpl      string
+		vars      any
+		simulated bool
+	}{
+		{"sop", SOP{Service: "x", Steps: []string{"a"}}, false},
+		{"sop", SOP{Service: "x", Steps: []string{"a"}, SimulatedTime: true}, true},
+		{"incident", Incident{Service: "x"}, false},
+		{"incident", Incident{Service: "x", SimulatedTime: true}, true},
+	}
+	for _, tt := range tests {
+		got := Must(tt.tmpl, tt.vars)
+		if !strings.HasSuffix(got, think) {
+			t.Errorf("%s doesn't end with the think-aloud rule:\n%s", tt.tmpl, got)
+		}
+		if strings.Contains(got, simulated) != tt.simulated {
+			t.Errorf("%s with %+v: simulated-time included = %t, want %t", tt.tmpl, tt.vars, !tt.simulated, tt.simulated)
+		}
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		tmpl string
+		vars any
+		want string // Part of the error
+	}{
+		{"missing key", "sop", map[string]any{"Steps": []string{"a"}}, `no entry for key "Service"`},
+		{"missing field", "specialist", struct{ Role string }{"Network Specialist"}, "can't evaluate field Topics"},
+		{"no values", "supervisor", nil, "Workers"},
+		{"unknown template", "triage", nil, `no template "triage"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.tmpl, tt.vars)
+			if err == nil {
+				t.Fatalf("Render(%q) = %q, want an error", tt.tmpl, got)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Render(%q): %v, want it to mention %s", tt.tmpl, err, tt.want)
+			}
+			if strings.Contains(got, "<no value>") {
+				t.Errorf("Render(%q) = %q", tt.tmpl, got)
+			}
+		})
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Must didn't panic on a missing value")
+		}
+	}()
+	Must("sop", map[string]any{})
+}
@@ -0,0 +1,143 @@
+// Package qdrant is a small client of the Qdrant vector database REST API:
+// the three calls a lab needs to keep its embeddings there instead of in
+// a file (pkg/vecindex).
+//
+//	db := qdrant.New(os.Getenv("QDRANT_URL")) // e.g. http://localhost:6333
+//	err := db.EnsureCollection(ctx, "runbooks", len(vecs[0]))
+//	err = db.Upsert(ctx, "runbooks", []qdrant.Point{{ID: qdrant.IDOf(name), Vector: vec, Payload: map[string]any{"name": name}}})
+//	hits, err := db.Search(ctx, "runbooks", queryVec, 3)
+//
+// Collections use cosine distance, as vecindex.Cosine does.
+package qdrant
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client talks to one Qdrant server.
+type Client struct {
+	url  string
+	http *http.Client
+}
+
+// New returns a client of the server at url.
+func New(url string) *Client {
+	return &Client{url: strings.TrimSuffix(url, "/"), http: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Point is a vector with its ID and payload.
+type Point struct {
+	ID      uint64         `json:"id"`
+	Vector  []float32      `json:"vector"`
+	Payload map[string]any `json:"payload,omitempty"`
+}
+
+// Hit is a point found by Search.
+type Hit struct {
+	ID      uint64         `json:"id"`
+	Score   float32        `json:"score"`
+	Payload map[string]any `json:"payload"`
+}
+
+// IDOf returns a point ID for a text key. Qdrant takes integers or UUIDs
+// as IDs; a hash keeps an upsert of the same document in place.
+func IDOf(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64() >> 1 // Some clients read IDs as signed
+}
+
+// EnsureCollection creates the collection for vectors of size dim. A
+// collection with vectors of another size (another embedding model) is
+// dropped and created again: its vectors don't compare with new ones.
+func (c *Client) EnsureCollection(ctx context.Context, name string, dim int) error {
+	var info struct {
+		Config struct {
+			Params struct {
+				Vectors struct {
+					Size int `json:"size"`
+				} `json:"vectors"`
+			} `json:"params"`
+		} `json:"config"`
+	}
+	status, err := c.do(ctx, http.MethodGet, "/collections/"+name, nil, &info)
+	switch {
+	case err == nil && info.Config.Params.Vectors.Size == dim:
+		return nil
+	case err == nil:
+		if _, err := c.do(ctx, http.MethodDelete, "/collections/"+name, nil, nil); err != nil {
+			return err
+		}
+	case status != http.StatusNotFound:
+		return err
+	}
+	body := map[string]any{"vectors": map[string]any{"size": dim, "distance": "Cosine"}}
+	_, err = c.do(ctx, http.MethodPut, "/collections/"+name, body, nil)
+	return err
+}
+
+// Upsert adds points to the collection, replacing those with the same ID,
+// and returns once they are searchable.
+func (c *Client) Upsert(ctx context.Context, collection string, points []Point) error {
+	_, err := c.do(ctx, http.MethodPut, "/collections/"+collection+"/points?wait=true", map[string]any{"points": points}, nil)
+	return err
+}
+
+// Search returns the limit points closest to vector, closest first.
+func (c *Client) Search(ctx context.Context, collection string, vector []float32, limit int) ([]Hit, error) {
+	var hits []Hit
+	body := map[string]any{"vector": vector, "limit": limit, "with_payload": true}
+	_, err := c.do(ctx, http.MethodPost, "/collections/"+collection+"/points/search", body, &hits)
+	return hits, err
+}
+
+// do sends a request and decodes the "result" of the answer into out. It
+// returns the HTTP status, 0 if there was no answer.
+func (c *Client) do(ctx context.Context, method, path string, body, out any) (int, error) {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, fmt.Errorf("qdrant: %w", err)
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, r)
+	if err != nil {
+		return 0, fmt.Errorf("qdrant: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("qdrant: %w", err)
+	}
+	defer resp.Body.Close()
+	var answer struct {
+		Result json.RawMessage `json:"result"`
+		Status any             `json:"status"` // "ok", or {"error": "..."}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("qdrant: %s %s: %w", method, path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg := resp.Status
+		if s, ok := answer.Status.(map[string]any); ok && s["error"] != nil {
+			msg = fmt.Sprintf("%s: %v", resp.Status, s["error"])
+		}
+		return resp.StatusCode, fmt.Errorf("qdrant: %s %s: %s", method, path, msg)
+	}
+	if out != nil && len(answer.Result) > 0 {
+		if err := json.Unmarshal(answer.Result, out); err != nil {
+			return resp.StatusCode, fmt.Errorf("qdrant: %s %s: %w", method, path, err)
+		}
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,130 @@
+// Package redact masks credentials and personal data in text before the
+// text is kept: in a summary of condensed history, in long-term memory.
+//
+// A secret the user pastes once leaves the context window a few turns
+// later; a summary or a memory note that repeats it keeps it for good, and
+// sends it with every future request. So text is scrubbed on its way in:
+//
+//	text, found := redact.Text(text)
+//	// "password=hunter2" → "password=[REDACTED:password]", found = ["password"]
+//
+// The patterns are regular expressions for the well-known shapes of
+// secrets (API keys, tokens, private keys, passwords in assignments and
+// URLs) and of personal data (emails, card numbers). They are a safety net,
+// not a guarantee: a password said in plain words ("it's hunter2") passes.
+package redact
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// A rule masks one kind of data. Groups of the pattern named "keep" stay
+// (the key of a "key=value" pair); the rest of the match is replaced.
+type rule struct {
+	kind    string
+	pattern *regexp.Regexp
+	valid   func(match string) bool // Extra check of a match; nil accepts all
+}
+
+// rules are applied in order: specific shapes first, so a token in a
+// "token=..." assignment is reported as what it is.
+var rules = []rule{
+	authorization,
+	{kind: "private-key", pattern: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{kind: "aws-key", pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{kind: "api-key", pattern: regexp.MustCompile(`\bsk-(?:ant-|proj-)?[A-Za-z0-9_-]{20,}`)},
+	{kind: "github-token", pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`)},
+	{kind: "slack-token", pattern: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{kind: "jwt", pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)},
+	{kind: "bearer-token", pattern: regexp.MustCompile(`(?i)(?P<keep>\bbearer\s+)[A-Za-z0-9._~+/-]{8,}=*`)},
+	{kind: "url-password", pattern: regexp.MustCompile(`(?P<keep>\b[a-z][a-z0-9+.-]*://[^\s:/@]+:)[^\s@/]+(?P<keep>@)`)},
+	{kind: "password", pattern: regexp.MustCompile(`(?i)(?P<keep>\b(?:password|passwd|pwd|passphrase)\b["']?\s*(?:[:=]|\bis\b)\s*["']?)[^\s"',;]+`)},
+	{kind: "secret", pattern: regexp.MustCompile(`(?i)(?P<keep>\b(?:secret|token|api[_-]?key|access[_-]?key|client[_-]?secret|private[_-]?key)\b["']?\s*(?:[:=])\s*["']?)[^\s"',;]+`)},
+	{kind: "email", pattern: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)},
+	{kind: "card-number", pattern: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), valid: luhn},
+}
+
+// authorization masks the credentials of an Authorization header, in any
+// shape it is written: "Authorization: Basic ...", a curl -H argument, a
+// JSON field. The scheme stays.
+var authorization = rule{kind: "authorization", pattern: regexp.MustCompile(`(?i)(?P<keep>\b(?:proxy-)?authorization\b["']?\s*[:=]\s*["']?(?:(?:bearer|basic|token|digest|negotiate|apikey)\s+)?)[^\s"',;]+`)}
+
+// Text returns text with every credential and piece of personal data it
+// recognizes replaced by "[REDACTED:<kind>]", and the kinds it found,
+// sorted. Text that has nothing to mask comes back unchanged.
+func Text(text string) (string, []string) {
+	return apply(text, rules)
+}
+
+// Authorization masks only the credentials of Authorization headers: for
+// text kept as a record, where the rest must stay as it was (transcripts
+// of runs, see pkg/runs).
+func Authorization(text string) string {
+	text, _ = apply(text, []rule{authorization})
+	return text
+}
+
+func apply(text string, rules []rule) (string, []string) {
+	var found []string
+	for _, r := range rules {
+		text = r.pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if strings.Contains(match, "[REDACTED:") || (r.valid != nil && !r.valid(match)) {
+				return match
+			}
+			if !slices.Contains(found, r.kind) {
+				found = append(found, r.kind)
+			}
+			return mask(r, match)
+		})
+	}
+	slices.Sort(found)
+	return text, found
+}
+
+// mask replaces the match except its "keep" groups.
+func mask(r rule, match string) string {
+	sub := r.pattern.FindStringSubmatchIndex(match)
+	placeholder := "[REDACTED:" + r.kind + "]"
+	var b strings.Builder
+	at := 0
+	masked := false
+	for i, name := range r.pattern.SubexpNames() {
+		if name != "keep" || sub[2*i] < 0 {
+			continue
+		}
+		start, end := sub[2*i], sub[2*i+1]
+		if start > at && !masked {
+			b.WriteString(placeholder)
+			masked = true
+		}
+		b.WriteString(match[start:end])
+		at = end
+	}
+	if !masked && at < len(match) {
+		b.WriteString(placeholder)
+	}
+	return b.String()
+}
+
+// luhn reports whether the digits of s pass the Luhn check of card
+// numbers, so order IDs and timestamps of the same length stay.
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
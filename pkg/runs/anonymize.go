@@ -0,0 +1,184 @@
+package runs
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	mathrand "math/rand/v2"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// AnonymizeOptions configure Anonymize.
+type AnonymizeOptions struct {
+	// Salt keys the identifier hashes. Use the same secret salt for a
+	// whole course to link runs of one student without learning who they
+	// are. Empty means a random salt that isn't kept: the export can't be
+	// linked to others, and its hashes can't be reversed by hashing
+	// candidate run IDs (a timestamp and 3 random bytes) without a key.
+	Salt string
+
+	// Epsilon enables differential privacy for usage metrics: Laplace noise
+	// with scale sensitivity/Epsilon is added to every counter.
+	// Zero disables the noise (exact metrics).
+	Epsilon float64
+}
+
+// Sensitivities for the Laplace mechanism: how much one message can change a counter.
+const (
+	requestSensitivity = 1
+	tokenSensitivity   = 50
+)
+
+// Anonymize returns a copy of the run that is safe to hand to an instructor:
+// message bodies, tool arguments, plans, pipeline outputs and the report are
+// replaced by size markers; identifiers (including the document and blob
+// IDs of message provenance) are replaced by keyed hashes.
+// Roles, tool names, message order, durations and usage are kept, so
+// aggregate statistics still work. The start of the run is cut to its day
+// (UTC), and every other time moves with it: the time of day would narrow
+// down the run ID, which is the start time to the second.
+func Anonymize(a *Artifacts, opts AnonymizeOptions) *Artifacts {
+	salt := opts.Salt
+	if salt == "" {
+		salt = rand.Text()
+	}
+	h := func(s string) string {
+		if s == "" {
+			return ""
+		}
+		return hashID(salt, s)
+	}
+	started := a.Meta.StartedAt.UTC().Truncate(24 * time.Hour)
+	shift := func(t time.Time) time.Time {
+		if t.IsZero() {
+			return t
+		}
+		return started.Add(t.Sub(a.Meta.StartedAt))
+	}
+
+	out := &Artifacts{
+		Meta:      a.Meta,
+		Usage:     a.Usage,
+		Pipelines: make(map[string]string, len(a.Pipelines)),
+	}
+	out.Meta.ID = h(a.Meta.ID)
+	out.Meta.StartedAt = started
+	out.Meta.FinishedAt = shift(a.Meta.FinishedAt)
+	out.Dir = out.Meta.ID
+
+	for _, e := range a.Transcript {
+		m := e.Message
+		anon := openai.ChatCompletionMessage{
+			Role:       m.Role,
+			Content:    redacted(m.Content),
+			Name:       h(m.Name),
+			ToolCallID: h(m.ToolCallID),
+		}
+		for _, tc := range m.ToolCalls {
+			anon.ToolCalls = append(anon.ToolCalls, openai.ToolCall{
+				ID:   h(tc.ID),
+				Type: tc.Type,
+				Function: openai.FunctionCall{
+					Name:      tc.Function.Name, // tool names are structure, not content
+					Arguments: redacted(tc.Function.Arguments),
+				},
+			})
+		}
+		entry := Entry{Time: shift(e.Time), Message: anon}
+		if e.Meta != nil {
+			meta := MessageMeta{
+				Tools:      e.Meta.Tools, // structure, like tool call names
+				Summarizer: e.Meta.Summarizer,
+			}
+			for _, d := range e.Meta.Docs {
+				meta.Docs = append(meta.Docs, h(d))
+			}
+			for _, b := range e.Meta.Blobs {
+				meta.Blobs = append(meta.Blobs, h(b))
+			}
+			for _, r := range e.Meta.Redactions {
+				meta.Redactions = append(meta.Redactions, redacted(r))
+			}
+			entry.Meta = &meta
+		}
+		out.Transcript = append(out.Transcript, entry)
+	}
+
+	if len(a.Plan) > 0 {
+		out.Plan = redactJSON(a.Plan)
+	}
+	for path, output := range a.Pipelines {
+		out.Pipelines[path] = redacted(output)
+	}
+	out.Report = redacted(a.Report)
+
+	if opts.Epsilon > 0 {
+		out.Usage = Usage{
+			Requests:         noisy(a.Usage.Requests, requestSensitivity, opts.Epsilon),
+			PromptTokens:     noisy(a.Usage.PromptTokens, tokenSensitivity, opts.Epsilon),
+			CompletionTokens: noisy(a.Usage.CompletionTokens, tokenSensitivity, opts.Epsilon),
+		}
+		out.Usage.TotalTokens = out.Usage.PromptTokens + out.Usage.CompletionTokens
+	}
+	return out
+}
+
+// hashID returns a short keyed hash of an identifier.
+func hashID(salt, s string) string {
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// redacted replaces text with a marker that keeps only its size.
+func redacted(s string) string {
+	if s == "" {
+		return ""
+	}
+	return fmt.Sprintf("[redacted: %d chars]", len(s))
+}
+
+// redactJSON keeps the shape of a JSON document (keys, arrays, numbers, bools)
+// and redacts every string value. Invalid JSON is redacted as a whole.
+func redactJSON(data json.RawMessage) json.RawMessage {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		out, _ := json.Marshal(redacted(string(data)))
+		return out
+	}
+	out, _ := json.Marshal(redactValue(v))
+	return out
+}
+
+func redactValue(v any) any {
+	switch x := v.(type) {
+	case string:
+		return redacted(x)
+	case []any:
+		for i := range x {
+			x[i] = redactValue(x[i])
+		}
+		return x
+	case map[string]any:
+		for k := range x {
+			x[k] = redactValue(x[k])
+		}
+		return x
+	default:
+		return v
+	}
+}
+
+// noisy applies the Laplace mechanism to a counter and clamps it at zero.
+func noisy(value int, sensitivity, epsilon float64) int {
+	scale := sensitivity / epsilon
+	u := mathrand.Float64() - 0.5
+	noise := -scale * math.Copysign(1, u) * math.Log(1-2*math.Abs(u))
+	return max(0, int(math.Round(float64(value)+noise)))
+}
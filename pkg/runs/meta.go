@@ -0,0 +1,68 @@
+package runs
+
+import "time"
+
+// Meta describes a run as a whole.
+type Meta struct {
+	ID         string    `json:"id"`
+	Lab        string    `json:"lab"`
+	Model      string    `json:"model,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	Status     string    `json:"status,omitempty"` // e.g. "success", "failed"
+}
+
+// MessageMeta is the provenance of a message: which tools and documents its
+// content came from and what was done to it on the way into the context.
+// It is stored next to the message in transcript.jsonl.
+//
+// A tool result records its tool; a summary that replaced part of the
+// history carries the merged metadata of the messages it replaced; a final
+// answer carries the merged metadata of the whole context it was written
+// from. So the answer can be traced back to its evidence even after the
+// history was condensed.
+type MessageMeta struct {
+	Tools      []string `json:"tools,omitempty"`      // Tools whose results the content is based on
+	Docs       []string `json:"docs,omitempty"`       // Retrieved documents, e.g. runbook file names
+	Blobs      []string `json:"blobs,omitempty"`      // blob: references to the full data
+	Summarizer string   `json:"summarizer,omitempty"` // Summarizer version, if the content is (or includes) a summary
+	Redactions []string `json:"redactions,omitempty"` // What was cut or masked, e.g. "parked 22950 bytes"
+}
+
+// IsZero reports whether m records nothing.
+func (m MessageMeta) IsZero() bool {
+	return len(m.Tools) == 0 && len(m.Docs) == 0 && len(m.Blobs) == 0 &&
+		m.Summarizer == "" && len(m.Redactions) == 0
+}
+
+// Merge returns the union of metas. Lists keep the order of first
+// appearance without duplicates; the last non-empty Summarizer wins.
+func Merge(metas ...MessageMeta) MessageMeta {
+	var out MessageMeta
+	for _, m := range metas {
+		out.Tools = union(out.Tools, m.Tools)
+		out.Docs = union(out.Docs, m.Docs)
+		out.Blobs = union(out.Blobs, m.Blobs)
+		out.Redactions = union(out.Redactions, m.Redactions)
+		if m.Summarizer != "" {
+			out.Summarizer = m.Summarizer
+		}
+	}
+	return out
+}
+
+func union(a, b []string) []string {
+	for _, s := range b {
+		seen := false
+		for _, x := range a {
+			if x == s {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			a = append(a, s)
+		}
+	}
+	return a
+}
@@ -0,0 +1,330 @@
+// Package runs stores the artifacts of one agent run in a standard layout:
+//
+//	runs/<id>/
+//	  meta.json          — lab, model, start/finish time, final status
+//	  transcript.jsonl   — every message of the conversation, one per line,
+//	                       with its provenance (MessageMeta)
+//	  usage.json         — accumulated token usage
+//	  plan.json          — the plan, if the run had one
+//	  pipelines/NNN.txt  — outputs of executed pipelines
+//	  blobs/<hash>       — large intermediate data referenced as blob:<hash>
+//	  report.md          — the final report
+//	  handoff.md         — what a human needs to take the run over (agent.Handoff)
+//	  handoff.json       — the same, for tools
+//
+// The same layout is read back by cmd/agentctl (replay, diff, export).
+package runs
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/blobs"
+	"github.com/kshvakov/agent/pkg/redact"
+	"github.com/sashabaranov/go-openai"
+)
+
+// File names inside a run directory.
+const (
+	MetaFile        = "meta.json"
+	TranscriptFile  = "transcript.jsonl"
+	UsageFile       = "usage.json"
+	PlanFile        = "plan.json"
+	ReportFile      = "report.md"
+	HandoffFile     = "handoff.md"
+	HandoffJSONFile = "handoff.json"
+	PipelinesDir    = "pipelines"
+	BlobsDir        = "blobs"
+)
+
+// DefaultRoot is used when AGENT_RUNS_DIR is not set.
+const DefaultRoot = "runs"
+
+// Root returns the directory that holds all runs.
+func Root() string {
+	if dir := os.Getenv("AGENT_RUNS_DIR"); dir != "" {
+		return dir
+	}
+	return DefaultRoot
+}
+
+// Usage is the token usage accumulated over all LLM calls of the run.
+type Usage struct {
+	Requests         int `json:"requests"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Entry is one line of transcript.jsonl.
+type Entry struct {
+	Time    time.Time                    `json:"time"`
+	Message openai.ChatCompletionMessage `json:"message"`
+	Meta    *MessageMeta                 `json:"meta,omitempty"`
+}
+
+// Run writes artifacts of a single run. It is safe for concurrent use.
+type Run struct {
+	Dir string
+
+	mu          sync.Mutex
+	meta        Meta
+	usage       Usage
+	transcript  *os.File
+	pipelineSeq int
+}
+
+// New creates runs/<id>/ under root and opens the transcript for writing.
+func New(root, lab, model string) (*Run, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(root, id)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create run dir: %w", err)
+	}
+	f, err := os.Create(filepath.Join(dir, TranscriptFile))
+	if err != nil {
+		return nil, fmt.Errorf("create transcript: %w", err)
+	}
+	r := &Run{
+		Dir:        dir,
+		transcript: f,
+		meta:       Meta{ID: id, Lab: lab, Model: model, StartedAt: time.Now().UTC()},
+	}
+	if err := r.writeJSON(MetaFile, r.meta); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// ID returns the run identifier (the directory name).
+func (r *Run) ID() string { return r.meta.ID }
+
+// AppendMessage adds one message to transcript.jsonl. A zero meta is not
+// stored. The credentials of Authorization headers in the content and the
+// tool arguments are masked (see redact.Authorization): a transcript is
+// shared and replayed, a token in it would outlive the run.
+func (r *Run) AppendMessage(msg openai.ChatCompletionMessage, meta MessageMeta) error {
+	msg.Content = redact.Authorization(msg.Content)
+	if len(msg.ToolCalls) > 0 {
+		msg.ToolCalls = slices.Clone(msg.ToolCalls) // The caller's message stays as it is
+		for i := range msg.ToolCalls {
+			msg.ToolCalls[i].Function.Arguments = redact.Authorization(msg.ToolCalls[i].Function.Arguments)
+		}
+	}
+	e := Entry{Time: time.Now().UTC(), Message: msg}
+	if !meta.IsZero() {
+		e.Meta = &meta
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err = r.transcript.Write(append(line, '\n'))
+	return err
+}
+
+// AddUsage accumulates resp.Usage of one LLM call.
+func (r *Run) AddUsage(u openai.Usage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.usage.Requests++
+	r.usage.PromptTokens += u.PromptTokens
+	r.usage.CompletionTokens += u.CompletionTokens
+	r.usage.TotalTokens += u.TotalTokens
+}
+
+// WritePlan stores the plan as plan.json.
+func (r *Run) WritePlan(plan any) error {
+	return r.writeJSON(PlanFile, plan)
+}
+
+// WritePipelineOutput stores a pipeline output as pipelines/NNN.txt and
+// returns the path relative to the run directory.
+func (r *Run) WritePipelineOutput(output string) (string, error) {
+	r.mu.Lock()
+	r.pipelineSeq++
+	rel := filepath.Join(PipelinesDir, fmt.Sprintf("%03d.txt", r.pipelineSeq))
+	r.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Join(r.Dir, PipelinesDir), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(r.Dir, rel), []byte(output), 0o644); err != nil {
+		return "", err
+	}
+	return rel, nil
+}
+
+// Blobs opens the run's blob store (blobs/), where tools park data
+// too large for the context.
+func (r *Run) Blobs() (*blobs.Store, error) {
+	return blobs.Open(filepath.Join(r.Dir, BlobsDir))
+}
+
+// WriteReport stores the final report as report.md.
+func (r *Run) WriteReport(report string) error {
+	return os.WriteFile(filepath.Join(r.Dir, ReportFile), []byte(report), 0o644)
+}
+
+// WriteHandoff stores a handoff as handoff.md, rendered as markdown, and
+// as handoff.json.
+func (r *Run) WriteHandoff(markdown string, handoff any) error {
+	if err := os.WriteFile(filepath.Join(r.Dir, HandoffFile), []byte(markdown), 0o644); err != nil {
+		return err
+	}
+	return r.writeJSON(HandoffJSONFile, handoff)
+}
+
+// Close finalizes the run: writes usage.json and meta.json with the status.
+func (r *Run) Close(status string) error {
+	r.mu.Lock()
+	r.meta.FinishedAt = time.Now().UTC()
+	r.meta.Status = status
+	meta, usage := r.meta, r.usage
+	err := r.transcript.Close()
+	r.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	if err := r.writeJSON(UsageFile, usage); err != nil {
+		return err
+	}
+	return r.writeJSON(MetaFile, meta)
+}
+
+func (r *Run) writeJSON(name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(r.Dir, name), data, 0o644)
+}
+
+// newID returns a sortable run ID: UTC timestamp plus a short random suffix.
+func newID() (string, error) {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b), nil
+}
+
+// Artifacts is a run loaded back from disk.
+type Artifacts struct {
+	Dir        string
+	Meta       Meta
+	Usage      Usage
+	Transcript []Entry
+	Plan       json.RawMessage // nil if the run had no plan
+	Report     string
+	Pipelines  map[string]string // relative path -> output
+}
+
+// Load reads all artifacts of the run stored in dir.
+// Missing optional files (plan, report, pipelines) are not an error.
+func Load(dir string) (*Artifacts, error) {
+	a := &Artifacts{Dir: dir, Pipelines: map[string]string{}}
+	if err := readJSON(filepath.Join(dir, MetaFile), &a.Meta); err != nil {
+		return nil, err
+	}
+	if err := readJSON(filepath.Join(dir, UsageFile), &a.Usage); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	transcript, err := ReadTranscript(filepath.Join(dir, TranscriptFile))
+	if err != nil {
+		return nil, err
+	}
+	a.Transcript = transcript
+
+	if data, err := os.ReadFile(filepath.Join(dir, PlanFile)); err == nil {
+		a.Plan = data
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, ReportFile)); err == nil {
+		a.Report = string(data)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, PipelinesDir, "*.txt"))
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		a.Pipelines[filepath.Join(PipelinesDir, filepath.Base(f))] = string(data)
+	}
+	return a, nil
+}
+
+// ReadTranscript parses a transcript.jsonl file.
+func ReadTranscript(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// List returns metadata of all runs under root, oldest first.
+func List(root string) ([]Meta, error) {
+	dirs, err := os.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var metas []Meta
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		var m Meta
+		if err := readJSON(filepath.Join(root, d.Name(), MetaFile), &m); err != nil {
+			continue // not a run directory
+		}
+		metas = append(metas, m)
+	}
+	sort.Slice(metas, func(i, j int) bool { return metas[i].StartedAt.Before(metas[j].StartedAt) })
+	return metas, nil
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
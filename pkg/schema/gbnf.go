@@ -0,0 +1,145 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// GBNF returns a grammar in llama.cpp's GBNF format that accepts exactly
+// the JSON values of the schema: objects with their properties (required
+// ones always, optional ones maybe, nothing else), arrays of their items,
+// enums as their literal values. A server decoding with the grammar can
+// only sample tokens that keep the output valid, so a small model can't
+// drift from the plan format the way it does in json_object mode.
+//
+// Keywords a grammar can't express cheaply (minimum, maximum) are left to
+// Validate. Properties are written in the order of Required, then the
+// optional ones by name.
+func (s *Schema) GBNF() string {
+	g := &gbnf{}
+	if root := g.value("root", s); root != "root" {
+		g.define("root", root)
+	}
+	// Rules are defined after the rules they use: reversed, the grammar
+	// reads top-down, from root to the primitives.
+	var b strings.Builder
+	for _, r := range slices.Backward(g.rules) {
+		fmt.Fprintf(&b, "%s ::= %s\n", r.name, r.body)
+	}
+	b.WriteString(gbnfPrimitives)
+	return b.String()
+}
+
+// gbnfPrimitives are the rules of plain JSON values, after llama.cpp's
+// grammars/json.gbnf. Every value rule eats the whitespace after it.
+const gbnfPrimitives = `value ::= object | array | string | number | boolean | null
+object ::= "{" ws ( string ":" ws value ( "," ws string ":" ws value )* )? "}" ws
+array ::= "[" ws ( value ( "," ws value )* )? "]" ws
+string ::= "\"" ( [^"\\\x7F\x00-\x1F] | "\\" ( ["\\/bfnrt] | "u" [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] ) )* "\"" ws
+number ::= "-"? ( "0" | [1-9] [0-9]* ) ( "." [0-9]+ )? ( [eE] [-+]? [0-9]+ )? ws
+integer ::= "-"? ( "0" | [1-9] [0-9]* ) ws
+boolean ::= ( "true" | "false" ) ws
+null ::= "null" ws
+ws ::= ( [ \t\n] ws )?
+`
+
+type gbnf struct {
+	rules []struct{ name, body string }
+}
+
+func (g *gbnf) define(name, body string) string {
+	g.rules = append(g.rules, struct{ name, body string }{name, body})
+	return name
+}
+
+// value returns the expression matching s, defining the rules it needs
+// under names starting with name.
+func (g *gbnf) value(name string, s *Schema) string {
+	if s == nil {
+		return "value"
+	}
+	if len(s.Enum) > 0 {
+		var alts []string
+		for _, v := range s.Enum {
+			data, err := json.Marshal(v)
+			if err != nil {
+				continue
+			}
+			alts = append(alts, strconv.Quote(string(data))) // Go quoting is valid GBNF
+		}
+		return g.define(name, "( "+strings.Join(alts, " | ")+" ) ws")
+	}
+	switch s.Type {
+	case "string", "number", "integer", "boolean", "null":
+		return s.Type
+	case "array":
+		item := g.value(name+"-item", s.Items)
+		return g.define(name, `"[" ws ( `+item+` ( "," ws `+item+` )* )? "]" ws`)
+	case "object":
+		if len(s.Properties) == 0 {
+			return "object"
+		}
+		return g.object(name, s)
+	}
+	return "value"
+}
+
+// object defines the rule of an object with declared properties.
+func (g *gbnf) object(name string, s *Schema) string {
+	var required, optional []string
+	for _, p := range s.Required {
+		if _, ok := s.Properties[p]; ok && !slices.Contains(required, p) {
+			required = append(required, p)
+		}
+	}
+	for p := range s.Properties {
+		if !slices.Contains(required, p) {
+			optional = append(optional, p)
+		}
+	}
+	slices.Sort(optional)
+
+	kv := map[string]string{}
+	for _, p := range append(slices.Clone(required), optional...) {
+		kv[p] = strconv.Quote(strconv.Quote(p)) + ` ws ":" ws ` + g.value(name+"-"+gbnfName(p), s.Properties[p])
+	}
+	// Optional properties after the required ones: ( "," ws kv )?
+	tail := func(props []string) string {
+		var b strings.Builder
+		for _, p := range props {
+			b.WriteString(` ( "," ws ` + kv[p] + ` )?`)
+		}
+		return b.String()
+	}
+
+	var body string
+	if len(required) > 0 {
+		parts := make([]string, len(required))
+		for i, p := range required {
+			parts[i] = kv[p]
+		}
+		body = strings.Join(parts, ` "," ws `) + tail(optional)
+	} else {
+		// Nothing is required: any in-order subset of the properties,
+		// the empty object included. Each alternative starts with
+		// the first property present.
+		alts := make([]string, len(optional))
+		for i, p := range optional {
+			alts[i] = kv[p] + tail(optional[i+1:])
+		}
+		body = "( " + strings.Join(alts, " | ") + " )?"
+	}
+	return g.define(name, `"{" ws `+body+` "}" ws`)
+}
+
+var gbnfNameInvalid = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// gbnfName turns a property name into a part of a rule name: rule names
+// are letters, digits and dashes.
+func gbnfName(p string) string {
+	return strings.Trim(gbnfNameInvalid.ReplaceAllString(p, "-"), "-")
+}
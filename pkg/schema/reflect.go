@@ -0,0 +1,121 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// For derives the schema of the JSON encoding of T, so the parameters the
+// model sees can't drift from the struct the arguments are decoded into:
+//
+//	type pingArgs struct {
+//		Host  string `json:"host" description:"Host to ping"`
+//		Count int    `json:"count,omitempty" description:"Number of packets" minimum:"1" maximum:"10"`
+//	}
+//
+//	schema.For[pingArgs]()
+//
+// Property names come from the json tags, the way encoding/json names them.
+// A field is required unless it is omitempty or a pointer. The tags
+// description, enum (comma-separated, for strings), minimum and maximum
+// fill in the rest. Embedded structs add their fields to the parent.
+//
+// For panics on a type JSON can't encode (a channel, a function): that is
+// a bug in the code, not in the arguments.
+func For[T any]() *Schema {
+	return of(reflect.TypeFor[T](), nil)
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// of returns the schema of t; seen holds the struct types being expanded,
+// to stop on recursive ones.
+func of(t reflect.Type, seen []reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return String("RFC 3339 time")
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string"} // []byte is base64
+		}
+		return &Schema{Type: "array", Items: of(t.Elem(), seen)}
+	case reflect.Map:
+		return &Schema{Type: "object"}
+	case reflect.Interface:
+		return &Schema{} // Any value
+	case reflect.Struct:
+		for _, s := range seen {
+			if s == t {
+				return &Schema{Type: "object"} // Recursive: not expanded again
+			}
+		}
+		s := Object()
+		fields(s, t, append(seen, t))
+		return s
+	}
+	panic(fmt.Sprintf("schema: %v can't be encoded as JSON", t))
+}
+
+// fields adds the properties of struct type t to s.
+func fields(s *Schema, t reflect.Type, seen []reflect.Type) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				fields(s, ft, seen)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		p := of(f.Type, seen)
+		if d := f.Tag.Get("description"); d != "" {
+			p.Description = d
+		}
+		if e := f.Tag.Get("enum"); e != "" {
+			for _, v := range strings.Split(e, ",") {
+				p.Enum = append(p.Enum, strings.TrimSpace(v))
+			}
+		}
+		if v, err := strconv.ParseFloat(f.Tag.Get("minimum"), 64); err == nil {
+			p.Min(v)
+		}
+		if v, err := strconv.ParseFloat(f.Tag.Get("maximum"), 64); err == nil {
+			p.Max(v)
+		}
+		s.Prop(name, p)
+		if !strings.Contains(","+opts+",", ",omitempty,") && f.Type.Kind() != reflect.Pointer {
+			s.Require(name)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Package schema builds and validates JSON Schemas for tool parameters,
+// plans and structured outputs.
+//
+// Instead of hand-written json.RawMessage blobs:
+//
+//	schema.Object().
+//		Prop("host", schema.String("Host to ping")).
+//		Prop("count", schema.Integer("Number of packets").Min(1).Max(10)).
+//		Require("host")
+//
+// *Schema marshals to JSON, so it can be used directly as
+// openai.FunctionDefinition.Parameters. Validate checks tool arguments
+// against the same schema the model was given.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Schema is the subset of JSON Schema the labs need.
+type Schema struct {
+	Type        string             `json:"type,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Enum        []any              `json:"enum,omitempty"`
+	Minimum     *float64           `json:"minimum,omitempty"`
+	Maximum     *float64           `json:"maximum,omitempty"`
+	Default     any                `json:"default,omitempty"`
+
+	// AdditionalProperties=false rejects unknown object keys.
+	AdditionalProperties *bool `json:"additionalProperties,omitempty"`
+}
+
+// Object returns an empty object schema; add properties with Prop.
+func Object() *Schema {
+	return &Schema{Type: "object", Properties: map[string]*Schema{}}
+}
+
+// String returns a string schema.
+func String(description string) *Schema {
+	return &Schema{Type: "string", Description: description}
+}
+
+// Integer returns an integer schema.
+func Integer(description string) *Schema {
+	return &Schema{Type: "integer", Description: description}
+}
+
+// Number returns a number schema.
+func Number(description string) *Schema {
+	return &Schema{Type: "number", Description: description}
+}
+
+// Boolean returns a boolean schema.
+func Boolean(description string) *Schema {
+	return &Schema{Type: "boolean", Description: description}
+}
+
+// Array returns an array schema with the given item schema.
+func Array(items *Schema, description string) *Schema {
+	return &Schema{Type: "array", Items: items, Description: description}
+}
+
+// Enum returns a string schema limited to values.
+func Enum(description string, values ...string) *Schema {
+	s := String(description)
+	for _, v := range values {
+		s.Enum = append(s.Enum, v)
+	}
+	return s
+}
+
+// Prop adds a property to an object schema.
+func (s *Schema) Prop(name string, p *Schema) *Schema {
+	if s.Properties == nil {
+		s.Properties = map[string]*Schema{}
+	}
+	s.Properties[name] = p
+	return s
+}
+
+// Require marks properties as required.
+func (s *Schema) Require(names ...string) *Schema {
+	s.Required = append(s.Required, names...)
+	return s
+}
+
+// Strict rejects properties that are not declared.
+func (s *Schema) Strict() *Schema {
+	f := false
+	s.AdditionalProperties = &f
+	return s
+}
+
+// Min sets the minimum of a number or integer.
+func (s *Schema) Min(v float64) *Schema {
+	s.Minimum = &v
+	return s
+}
+
+// Max sets the maximum of a number or integer.
+func (s *Schema) Max(v float64) *Schema {
+	s.Maximum = &v
+	return s
+}
+
+// WithDefault sets the default value.
+func (s *Schema) WithDefault(v any) *Schema {
+	s.Default = v
+	return s
+}
+
+// Raw returns the schema as JSON, for APIs that take json.RawMessage.
+func (s *Schema) Raw() json.RawMessage {
+	data, err := json.Marshal(s)
+	if err != nil {
+		// Schemas are built from plain values; marshaling can't fail.
+		panic(fmt.Sprintf("schema: %v", err))
+	}
+	return data
+}
+
+// Parse reads a schema from JSON.
+func Parse(data []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+	return &s, nil
+}
@@ -0,0 +1,180 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// FieldError is one validation failure. Path is "$" for the root value
+// and "$.field[0]" for nested ones.
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// Errors lists every failure found, so the model can fix all of them at once.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return "invalid arguments: " + strings.Join(msgs, "; ")
+}
+
+// Validate checks JSON data (e.g. tool call arguments) against the schema.
+// It returns Errors, or a plain error if data is not JSON.
+func (s *Schema) Validate(data []byte) error {
+	if len(bytes.TrimSpace(data)) == 0 {
+		data = []byte("{}") // Tools without arguments get an empty string
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("arguments are not valid JSON: %w", err)
+	}
+	return s.ValidateValue(v)
+}
+
+// ValidateValue checks a decoded JSON value (map[string]any, []any,
+// string, float64 or json.Number, bool, nil).
+func (s *Schema) ValidateValue(v any) error {
+	var errs Errors
+	s.validate("$", v, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (s *Schema) validate(path string, v any, errs *Errors) {
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.Type != "" && !hasType(v, s.Type) {
+		fail("expected %s, got %s", s.Type, typeName(v))
+		return
+	}
+	if len(s.Enum) > 0 && !inEnum(v, s.Enum) {
+		fail("must be one of %v", s.Enum)
+	}
+	if n, ok := number(v); ok {
+		if s.Minimum != nil && n < *s.Minimum {
+			fail("must be >= %v", *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			fail("must be <= %v", *s.Maximum)
+		}
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := val[name]; !ok {
+				*errs = append(*errs, FieldError{Path: path + "." + name, Message: "is required"})
+			}
+		}
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if p, ok := s.Properties[k]; ok {
+				p.validate(path+"."+k, val[k], errs)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				*errs = append(*errs, FieldError{Path: path + "." + k, Message: "unknown property"})
+			}
+		}
+	case []any:
+		if s.Items != nil {
+			for i, item := range val {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+			}
+		}
+	}
+}
+
+func hasType(v any, typ string) bool {
+	switch typ {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "null":
+		return v == nil
+	case "number":
+		_, ok := number(v)
+		return ok
+	case "integer":
+		n, ok := number(v)
+		return ok && n == math.Trunc(n)
+	}
+	return true // Unknown types are not checked
+}
+
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	}
+	if _, ok := number(v); ok {
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func inEnum(v any, enum []any) bool {
+	for _, e := range enum {
+		if n, ok := number(v); ok {
+			if m, ok := number(e); ok && n == m {
+				return true
+			}
+			continue
+		}
+		if v == e {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// --- One front-end at a time ---
+//
+// A session directory can be shared: a terminal on a laptop starts the
+// triage, and a front-end on another machine (a chat bot, a web page, the
+// same lab on a phone's SSH client) continues it. Two writers would
+// interleave their turns into one history, so a session is held by one
+// front-end at a time: Open takes sessions/<id>.lock, and Close gives it
+// up.
+//
+// The holder touches the lock while it runs. A lock not touched for Lease
+// is stale (the holder was killed, the laptop went to sleep) and the next
+// Open takes it. To take a session from a holder that is still running,
+// open it with Options.TakeOver: the old holder's next Append fails with
+// ErrTakenOver, so it stops writing instead of forking the history.
+
+// Lease is how long a lock stays valid without its holder touching it.
+const Lease = 30 * time.Second
+
+// ErrTakenOver is returned by Append after another front-end took the
+// session over.
+var ErrTakenOver = errors.New("session: taken over by another front-end")
+
+// Holder is who holds a session: the content of its lock file.
+type Holder struct {
+	Token string    `json:"token"` // Tells this Open from any other
+	Name  string    `json:"name"`  // The front-end, e.g. "lab05-human-interaction"
+	Host  string    `json:"host"`
+	PID   int       `json:"pid"`
+	Since time.Time `json:"since"`
+}
+
+func (h Holder) String() string {
+	return fmt.Sprintf("%s on %s (pid %d) since %s", h.Name, h.Host, h.PID, h.Since.Local().Format("15:04:05"))
+}
+
+// LockedError is returned by Open when another front-end holds the session.
+type LockedError struct {
+	ID     string
+	Holder Holder
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("session: %s is open in %s", e.ID, e.Holder)
+}
+
+// Options change how Open takes a session.
+type Options struct {
+	// Name is the front-end, shown to whoever finds the session locked.
+	// Empty means the program name.
+	Name string
+	// TakeOver takes the session from a holder that is still running.
+	TakeOver bool
+}
+
+// lock is the lock file of a session held by this process.
+type lock struct {
+	path   string
+	holder Holder
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// acquire takes the lock at path for o, or returns a *LockedError.
+func acquire(path, id string, o Options) (*lock, error) {
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("session: %w", err)
+	}
+	host, _ := os.Hostname()
+	l := &lock{path: path, holder: Holder{
+		Token: hex.EncodeToString(token),
+		Name:  o.Name,
+		Host:  host,
+		PID:   os.Getpid(),
+		Since: time.Now().UTC(),
+	}}
+	if l.holder.Name == "" {
+		l.holder.Name = filepath.Base(os.Args[0])
+	}
+	data, err := json.Marshal(l.holder)
+	if err != nil {
+		return nil, fmt.Errorf("session: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("session: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	switch {
+	case err == nil:
+		_, err = f.Write(data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(path)
+			return nil, fmt.Errorf("session: %w", err)
+		}
+	case errors.Is(err, fs.ErrExist):
+		other, fresh := readLock(path)
+		if fresh && !o.TakeOver {
+			return nil, &LockedError{ID: id, Holder: other}
+		}
+		// Stale, or taken over: replace it in one step, then check that
+		// no one else replaced it at the same moment.
+		if err := writeFile(path, data); err != nil {
+			return nil, err
+		}
+		if now, _ := readLock(path); now.Token != l.holder.Token {
+			return nil, &LockedError{ID: id, Holder: now}
+		}
+	default:
+		return nil, fmt.Errorf("session: %w", err)
+	}
+
+	l.stop, l.done = make(chan struct{}), make(chan struct{})
+	go l.heartbeat()
+	return l, nil
+}
+
+// readLock returns the holder in the lock file at path, and whether the
+// lock is fresh: touched within Lease. A lock being written (empty, or cut
+// short) is fresh but has no holder yet.
+func readLock(path string) (Holder, bool) {
+	var h Holder
+	info, err := os.Stat(path)
+	if err != nil {
+		return h, false
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &h)
+	}
+	return h, time.Since(info.ModTime()) < Lease
+}
+
+// writeFile replaces path with data atomically.
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".lock-*")
+	if err != nil {
+		return fmt.Errorf("session: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("session: %w", err)
+	}
+	return nil
+}
+
+// heartbeat touches the lock while it is held, until release or a take
+// over.
+func (l *lock) heartbeat() {
+	defer close(l.done)
+	t := time.NewTicker(Lease / 3)
+	defer t.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-t.C:
+			if !l.held() {
+				return
+			}
+			now := time.Now()
+			os.Chtimes(l.path, now, now)
+		}
+	}
+}
+
+// held reports whether the lock file is still this process's.
+func (l *lock) held() bool {
+	h, _ := readLock(l.path)
+	return h.Token == l.holder.Token
+}
+
+// release stops the heartbeat and removes the lock file if it is still
+// this process's.
+func (l *lock) release() {
+	close(l.stop)
+	<-l.done
+	if l.held() {
+		os.Remove(l.path)
+	}
+}
@@ -0,0 +1,231 @@
+// Package session keeps a conversation across runs of a lab. A lab that
+// exits loses its history; with a session it appends every message
+// (user input, assistant replies with their tool calls, tool results) to
+//
+//	sessions/<id>.jsonl
+//
+// and a later run with the same id starts from that history:
+//
+//	s, err := session.Open(session.Root(), *sessionID) // "" starts a new one
+//	messages := s.Messages()                          // the history so far
+//	...
+//	s.Append(newMessages...)
+//
+// A session is one file with one message per line, like the transcript
+// of a run (pkg/runs): it needs no database driver, a killed process loses
+// at most the line it was writing, and jq reads it.
+//
+// The directory can be shared between front-ends; one of them holds a
+// session at a time (see Lease), and another continues it after Close
+// or with Options.TakeOver. Pending returns the tool calls the previous
+// holder left without results, e.g. one waiting for approval.
+package session
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// DefaultRoot is used when AGENT_SESSIONS_DIR is not set.
+const DefaultRoot = "sessions"
+
+// Root returns the directory that holds all sessions.
+func Root() string {
+	if dir := os.Getenv("AGENT_SESSIONS_DIR"); dir != "" {
+		return dir
+	}
+	return DefaultRoot
+}
+
+// Entry is one line of a session file.
+type Entry struct {
+	Time    time.Time                    `json:"time"`
+	Message openai.ChatCompletionMessage `json:"message"`
+}
+
+// Session is an open conversation. It is safe for concurrent use.
+type Session struct {
+	id   string
+	path string
+
+	mu       sync.Mutex
+	f        *os.File
+	lock     *lock
+	messages []openai.ChatCompletionMessage
+}
+
+// validID keeps ids to file names: an id from a flag must not point
+// outside root.
+var validID = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Open opens the session id under root with its history, creating it if
+// it doesn't exist. An empty id starts a new session with a fresh id.
+// A session another front-end holds is a *LockedError.
+func Open(root, id string) (*Session, error) {
+	return OpenWith(root, id, Options{})
+}
+
+// OpenWith is Open with options: the front-end's name, and whether to
+// take the session from its holder.
+func OpenWith(root, id string, o Options) (*Session, error) {
+	if id == "" {
+		var err error
+		if id, err = newID(); err != nil {
+			return nil, fmt.Errorf("session: %w", err)
+		}
+	}
+	if !validID.MatchString(id) || id == "." || id == ".." {
+		return nil, fmt.Errorf("session: invalid id %q", id)
+	}
+	s := &Session{id: id, path: filepath.Join(root, id+".jsonl")}
+	// The history is read under the lock: the previous holder has
+	// written its last turn.
+	var err error
+	if s.lock, err = acquire(filepath.Join(root, id+".lock"), id, o); err != nil {
+		return nil, err
+	}
+	if err := s.load(); err != nil {
+		s.lock.release()
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the history and opens the file for appending.
+func (s *Session) load() error {
+	entries, size, err := read(s.path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for _, e := range entries {
+		s.messages = append(s.messages, e.Message)
+	}
+	if s.f, err = os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+		return fmt.Errorf("session: %w", err)
+	}
+	// New messages go after the last whole line, not after a cut one.
+	if err := s.f.Truncate(size); err != nil {
+		s.f.Close()
+		return fmt.Errorf("session: %w", err)
+	}
+	return nil
+}
+
+// ID returns the session id, the value to resume it with.
+func (s *Session) ID() string { return s.id }
+
+// Messages returns a copy of the history.
+func (s *Session) Messages() []openai.ChatCompletionMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]openai.ChatCompletionMessage(nil), s.messages...)
+}
+
+// Pending returns the tool calls of the last assistant message that have
+// no result in the history: what the previous holder asked about and
+// didn't get to run, like an action waiting for approval. The caller
+// answers each with a tool message before the next LLM call.
+func (s *Session) Pending() []openai.ToolCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	answered := map[string]bool{}
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		m := s.messages[i]
+		switch m.Role {
+		case openai.ChatMessageRoleTool:
+			answered[m.ToolCallID] = true
+			continue
+		case openai.ChatMessageRoleAssistant:
+			var pending []openai.ToolCall
+			for _, c := range m.ToolCalls {
+				if !answered[c.ID] {
+					pending = append(pending, c)
+				}
+			}
+			return pending
+		}
+		return nil
+	}
+	return nil
+}
+
+// Append adds messages to the history and writes them to the file. After
+// a take over it writes nothing and returns ErrTakenOver.
+func (s *Session) Append(msgs ...openai.ChatCompletionMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.lock.held() {
+		return ErrTakenOver
+	}
+	var buf bytes.Buffer
+	now := time.Now().UTC()
+	for _, m := range msgs {
+		line, err := json.Marshal(Entry{Time: now, Message: m})
+		if err != nil {
+			return fmt.Errorf("session: %w", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	// One write per call: a crash keeps whole messages.
+	if _, err := s.f.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("session: %w", err)
+	}
+	s.messages = append(s.messages, msgs...)
+	return nil
+}
+
+// Close closes the session file and gives the session up, so another
+// front-end can open it.
+func (s *Session) Close() error {
+	s.lock.release()
+	return s.f.Close()
+}
+
+// read parses a session file and returns the size of its whole lines. A
+// last line cut short by a crash is not part of the history.
+func read(path string) ([]Entry, int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	var entries []Entry
+	var size int64
+	for len(data) > 0 {
+		line, rest, ok := bytes.Cut(data, []byte("\n"))
+		if !ok {
+			break // Cut short
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			var e Entry
+			if err := json.Unmarshal(line, &e); err != nil {
+				return nil, 0, fmt.Errorf("session: %s: %w", path, err)
+			}
+			entries = append(entries, e)
+		}
+		size += int64(len(line)) + 1
+		data = rest
+	}
+	return entries, size, nil
+}
+
+// newID returns a sortable session ID: UTC timestamp plus a short random suffix.
+func newID() (string, error) {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,110 @@
+// Package simclock provides a controllable clock for mock environments.
+//
+// Scenarios that involve time ("the certificate expires at T+5m",
+// "the backlog grows every minute") can't use time.Now: a lab run would
+// either take real minutes or never reach the deadline. Instead, tools
+// advance a simulated clock by the time their action "takes", and
+// scheduled events fire when the clock passes them.
+package simclock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the part of time the mock environments depend on.
+type Clock interface {
+	Now() time.Time
+}
+
+// Real is a Clock backed by time.Now.
+type Real struct{}
+
+// Now returns the wall-clock time.
+func (Real) Now() time.Time { return time.Now() }
+
+type event struct {
+	at time.Time
+	fn func()
+}
+
+// Sim is a simulated clock. Time only moves when Advance is called.
+// It is safe for concurrent use.
+type Sim struct {
+	mu     sync.Mutex
+	now    time.Time
+	events []event
+}
+
+// New returns a simulated clock set to start.
+func New(start time.Time) *Sim {
+	return &Sim{now: start}
+}
+
+// Now returns the simulated time.
+func (c *Sim) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Since returns the simulated time elapsed since t.
+func (c *Sim) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// At schedules fn to run when the clock reaches t.
+// Events in the past run on the next Advance.
+func (c *Sim) At(t time.Time, fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, event{at: t, fn: fn})
+	sort.SliceStable(c.events, func(i, j int) bool { return c.events[i].at.Before(c.events[j].at) })
+}
+
+// After schedules fn to run d after the current simulated time.
+func (c *Sim) After(d time.Duration, fn func()) {
+	c.At(c.Now().Add(d), fn)
+}
+
+// Every schedules fn to run every d, starting d from now. Like
+// time.NewTicker, it panics if d is not positive: such an event would
+// reschedule itself at the same instant and Advance would never return.
+func (c *Sim) Every(d time.Duration, fn func()) {
+	if d <= 0 {
+		panic("simclock: non-positive interval for Every")
+	}
+	var tick func()
+	tick = func() {
+		fn()
+		c.After(d, tick)
+	}
+	c.After(d, tick)
+}
+
+// Advance moves the clock forward by d, firing due events in time order.
+// While an event runs, Now reports the event's time.
+func (c *Sim) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	c.mu.Unlock()
+
+	for {
+		c.mu.Lock()
+		if len(c.events) == 0 || c.events[0].at.After(target) {
+			c.now = target
+			c.mu.Unlock()
+			return
+		}
+		ev := c.events[0]
+		c.events = c.events[1:]
+		if ev.at.After(c.now) {
+			c.now = ev.at
+		}
+		c.mu.Unlock()
+
+		// Run outside the lock: events may schedule new events.
+		ev.fn()
+	}
+}
@@ -0,0 +1,339 @@
+// Package skill reads skill packs: what an agent needs to be good at one
+// kind of task, in one versioned YAML file. A skill is a fragment of the
+// system prompt, the tools it works with, example tasks with the answers
+// it should give, and eval tasks that check it still does:
+//
+//	name: log-analysis
+//	version: 1.0.0
+//	description: Finds the cause of errors in application logs
+//	prompt: |
+//	  Read the logs before you answer. Quote the lines ...
+//	tools: [list_files, read_file]
+//	examples:
+//	  - task: Why does the API return 502?
+//	    answer: "upstream timed out (app.log:1042) ..."
+//	evals:
+//	  - task: Why did the checkout fail at 10:05?
+//	    files:
+//	      app.log: |
+//	        10:05:01 ERROR payment: card declined ...
+//	    calls: [read_file]
+//	    expect: [card declined]
+//
+// Attach adds skills to any agent's config. Test runs a skill's evals,
+// each in a directory of its own with the eval's files, so a skill is
+// checked on its own, before anyone attaches it. Run runs one eval, e.g.
+// with its task changed by pkg/perturb. agentctl skill lists,
+// enables and tests the skills in cmd/agentctl/skills.
+package skill
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/kshvakov/agent/pkg/agent"
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/prompts"
+	"github.com/kshvakov/agent/pkg/tools"
+	"github.com/kshvakov/agent/pkg/trace"
+	"github.com/kshvakov/agent/pkg/yaml"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Skill is a skill pack.
+type Skill struct {
+	Name        string    `json:"name"`
+	Version     string    `json:"version"` // MAJOR.MINOR.PATCH; bump it when the prompt, tools or evals change
+	Description string    `json:"description"`
+	Prompt      string    `json:"prompt"` // Added to the agent's system prompt
+	Tools       []string  `json:"tools"`  // Names in the catalog passed to Attach
+	Examples    []Example `json:"examples"`
+	Evals       []Eval    `json:"evals"`
+
+	Path string `json:"-"` // The file it was read from
+}
+
+// Example is a task and the answer the skill should give, shown to the
+// model with the prompt.
+type Example struct {
+	Task   string `json:"task"`
+	Answer string `json:"answer"`
+}
+
+// Eval is a task a skill is tested on.
+type Eval struct {
+	Task   string            `json:"task"`
+	Files  map[string]string `json:"files"`  // Written to the eval's directory: logs, command output
+	Calls  []string          `json:"calls"`  // Tools the agent must call
+	Expect []string          `json:"expect"` // Text the answer must mention, in any case
+}
+
+var (
+	validName    = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+	validVersion = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+)
+
+// Load reads and checks a skill file.
+func Load(path string) (*Skill, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("skill: %w", err)
+	}
+	var s Skill
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("skill: %s: %w", path, err)
+	}
+	if err := s.check(); err != nil {
+		return nil, fmt.Errorf("skill: %s: %w", path, err)
+	}
+	s.Path = path
+	return &s, nil
+}
+
+// LoadDir reads the skill files (*.yaml) of dir, sorted by name.
+func LoadDir(dir string) ([]*Skill, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("skill: %w", err)
+	}
+	var skills []*Skill
+	for _, path := range paths {
+		s, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		if i := slices.IndexFunc(skills, func(o *Skill) bool { return o.Name == s.Name }); i >= 0 {
+			return nil, fmt.Errorf("skill: %s is in both %s and %s", s.Name, skills[i].Path, path)
+		}
+		skills = append(skills, s)
+	}
+	sort.Slice(skills, func(i, j int) bool { return skills[i].Name < skills[j].Name })
+	return skills, nil
+}
+
+// Find returns the skill called name.
+func Find(skills []*Skill, name string) (*Skill, error) {
+	for _, s := range skills {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+	names := make([]string, len(skills))
+	for i, s := range skills {
+		names[i] = s.Name
+	}
+	return nil, fmt.Errorf("skill: no skill %q (have %s)", name, strings.Join(names, ", "))
+}
+
+// check reports the first problem of the skill.
+func (s *Skill) check() error {
+	switch {
+	case !validName.MatchString(s.Name):
+		return fmt.Errorf("name %q: a name is lowercase letters, digits and -", s.Name)
+	case !validVersion.MatchString(s.Version):
+		return fmt.Errorf("version %q: want MAJOR.MINOR.PATCH, e.g. 1.0.0", s.Version)
+	case strings.TrimSpace(s.Prompt) == "":
+		return fmt.Errorf("no prompt")
+	case len(s.Evals) == 0:
+		return fmt.Errorf("no evals: a skill nobody can test can't be trusted to work")
+	}
+	for i, e := range s.Evals {
+		if strings.TrimSpace(e.Task) == "" {
+			return fmt.Errorf("eval %d: no task", i+1)
+		}
+		if len(e.Calls) == 0 && len(e.Expect) == 0 {
+			return fmt.Errorf("eval %d: nothing to check: add calls or expect", i+1)
+		}
+		for _, c := range e.Calls {
+			if !slices.Contains(s.Tools, c) {
+				return fmt.Errorf("eval %d: call of %s, which is not a tool of the skill", i+1, c)
+			}
+		}
+		for name := range e.Files {
+			if !filepath.IsLocal(name) {
+				return fmt.Errorf("eval %d: file %q: only paths inside the eval's directory", i+1, name)
+			}
+		}
+	}
+	return nil
+}
+
+// ID is the skill's name and version, e.g. log-analysis@1.0.0.
+func (s *Skill) ID() string { return s.Name + "@" + s.Version }
+
+// prompt is the part of the system prompt the skill adds.
+func (s *Skill) prompt() string {
+	p := prompts.Skill{Name: s.Name, Version: s.Version, Prompt: strings.TrimSpace(s.Prompt)}
+	for _, e := range s.Examples {
+		p.Examples = append(p.Examples, prompts.Example{Task: e.Task, Answer: strings.TrimSpace(e.Answer)})
+	}
+	return prompts.Must("skill", p)
+}
+
+// Attach returns cfg with the skills' prompts after its system prompt,
+// and the tools the skills name, from catalog, each once. The caller
+// registers the tools with the agent it builds from cfg.
+func Attach(cfg agent.Config, catalog *tools.Registry, skills ...*Skill) (agent.Config, []agent.Tool, error) {
+	var parts []string
+	if strings.TrimSpace(cfg.SystemPrompt) != "" {
+		parts = append(parts, strings.TrimSpace(cfg.SystemPrompt))
+	}
+	var ts []agent.Tool
+	for _, s := range skills {
+		for _, name := range s.Tools {
+			t, ok := catalog.Get(name)
+			if !ok {
+				return cfg, nil, fmt.Errorf("skill %s: unknown tool %q (have %s)", s.Name, name, strings.Join(catalog.Names(), ", "))
+			}
+			if !slices.ContainsFunc(ts, func(o agent.Tool) bool { return o.Name == name }) {
+				ts = append(ts, t)
+			}
+		}
+		parts = append(parts, s.prompt())
+	}
+	cfg.SystemPrompt = strings.Join(parts, "\n\n")
+	return cfg, ts, nil
+}
+
+// evalSteps is the step budget of one eval.
+const evalSteps = 10
+
+// Options are what Test needs to run a skill's evals.
+type Options struct {
+	Client llm.Provider
+	Model  string // agent.DefaultModel if empty
+
+	// Tools returns the catalog for an eval whose files are in dir: tools
+	// that read and run there. Calls of Mutating tools are refused: an
+	// eval has nobody to approve them.
+	Tools func(dir string) *tools.Registry
+
+	// Trace, if set, logs the steps of every eval.
+	Trace *trace.Logger
+}
+
+// Result is the outcome of one eval.
+type Result struct {
+	Eval     Eval
+	Answer   string
+	Calls    []string // The tools called, in order
+	Problems []string // Checks that failed
+	Err      error    // The run failed
+}
+
+// Passed reports whether the run finished and every check held.
+func (r Result) Passed() bool { return r.Err == nil && len(r.Problems) == 0 }
+
+// ToolsOK reports whether the run finished and called every tool of
+// Eval.Calls: the agent picked the right tools.
+func (r Result) ToolsOK() bool {
+	if r.Err != nil {
+		return false
+	}
+	for _, c := range r.Eval.Calls {
+		if !slices.Contains(r.Calls, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// AnswerOK reports whether the run finished and the answer mentions every
+// string of Eval.Expect.
+func (r Result) AnswerOK() bool {
+	if r.Err != nil {
+		return false
+	}
+	answer := strings.ToLower(r.Answer)
+	for _, want := range r.Eval.Expect {
+		if !strings.Contains(answer, strings.ToLower(want)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Test runs the skill's evals, one after another, each with an agent
+// that has only the skill attached.
+func (s *Skill) Test(ctx context.Context, opts Options) []Result {
+	var results []Result
+	for i, e := range s.Evals {
+		r := s.Run(ctx, e, opts)
+		if r.Err != nil {
+			r.Err = fmt.Errorf("eval %d: %w", i+1, r.Err)
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// Run runs eval e with an agent that has only s attached, in a temporary
+// directory with the files of e. e need not be one of s.Evals.
+func (s *Skill) Run(ctx context.Context, e Eval, opts Options) Result {
+	r := Result{Eval: e}
+	dir, err := os.MkdirTemp("", "skill-"+s.Name+"-")
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range e.Files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			r.Err = err
+			return r
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			r.Err = err
+			return r
+		}
+	}
+
+	catalog := opts.Tools(dir)
+	cfg, ts, err := Attach(agent.Config{
+		Model:  opts.Model,
+		Budget: agent.Budget{Steps: evalSteps},
+		Trace:  opts.Trace.With("skill", s.ID()),
+	}, catalog, s)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	var mutating []string
+	for _, t := range ts {
+		if t.Mutating {
+			mutating = append(mutating, t.Name)
+		}
+	}
+	cfg.Hooks = agent.Chain(
+		agent.Approval(func(openai.ToolCall) bool { return false }, mutating...),
+		agent.Hooks{OnToolCall: func(call openai.ToolCall) { r.Calls = append(r.Calls, call.Function.Name) }},
+	)
+	a := agent.New(opts.Client, cfg)
+	for _, t := range ts {
+		a.RegisterTool(t)
+	}
+	r.Answer, r.Err = a.Run(ctx, e.Task)
+	if r.Err != nil {
+		return r
+	}
+
+	for _, c := range e.Calls {
+		if !slices.Contains(r.Calls, c) {
+			r.Problems = append(r.Problems, "didn't call "+c)
+		}
+	}
+	answer := strings.ToLower(r.Answer)
+	for _, want := range e.Expect {
+		if !strings.Contains(answer, strings.ToLower(want)) {
+			r.Problems = append(r.Problems, fmt.Sprintf("answer doesn't mention %q", want))
+		}
+	}
+	return r
+}
@@ -0,0 +1,404 @@
+// Package team builds agents, and teams of them, from a YAML file, so a
+// new multi-agent topology is an edit to a file instead of a Go program:
+//
+//	agents:
+//	  lead:
+//	    model: gpt-4o
+//	    budget:
+//	      steps: 10
+//	      time: 5m
+//	  web:
+//	    description: "Checks URLs: status, redirects, content"
+//	    prompt: You check web endpoints. Report status codes exactly.
+//	    tools: [http_get]
+//	    skills: [log-analysis]
+//	    autonomy: auto
+//	teams:
+//	  site:
+//	    supervisor: lead
+//	    members: [web, files]
+//
+//	f, err := team.Load("site.yaml")
+//	a, err := f.Build("site", team.Options{Client: client, Tools: catalog})
+//	answer, err := a.Run(ctx, task)
+//
+// A supervisor asks its members through tools, ask_<member>, as in Lab 08:
+// every question is a new Run of the member. A member may itself be a
+// team. The tools an agent names come from a catalog the program passes
+// in (Options.Tools); agentctl team run has a small built-in one. So do
+// the skills (Options.Skills, see pkg/skill).
+package team
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/agent"
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/prompts"
+	"github.com/kshvakov/agent/pkg/skill"
+	"github.com/kshvakov/agent/pkg/tools"
+	"github.com/kshvakov/agent/pkg/trace"
+	"github.com/kshvakov/agent/pkg/yaml"
+	"github.com/sashabaranov/go-openai"
+)
+
+// File is a team file: agents, and teams made of them, by name.
+type File struct {
+	Agents map[string]*Agent `json:"agents"`
+	Teams  map[string]*Team  `json:"teams"`
+}
+
+// Agent is the definition of one agent.
+type Agent struct {
+	Description string   `json:"description"` // What to ask it; a supervisor's tool description
+	Model       string   `json:"model"`       // agent.DefaultModel if empty; LLM_MODEL overrides every agent's
+	Prompt      string   `json:"prompt"`      // A supervisor's is written from its members if empty
+	Tools       []string `json:"tools"`       // Names in Options.Tools
+	Skills      []string `json:"skills"`      // Names in Options.Skills
+	Budget      Budget   `json:"budget"`      // Of every Run
+	LoopLimit   int      `json:"loop_limit"`  // See agent.Config.LoopLimit
+	Autonomy    Autonomy `json:"autonomy"`    // Supervised if empty
+
+	// ToolTimeout is a duration ("30s") a tool call may run, its
+	// ask_<member> calls included; see agent.Config.ToolTimeout.
+	ToolTimeout string `json:"tool_timeout"`
+}
+
+// Budget is agent.Budget as written in the file: time is a duration
+// string ("2m").
+type Budget struct {
+	Steps   int     `json:"steps"`
+	Tokens  int     `json:"tokens"`
+	Dollars float64 `json:"dollars"`
+	Time    string  `json:"time"`
+}
+
+// Autonomy is how much an agent may do without a human.
+type Autonomy string
+
+const (
+	Auto       Autonomy = "auto"       // Nothing is asked
+	Supervised Autonomy = "supervised" // Calls of Mutating tools are approved by a human
+	Manual     Autonomy = "manual"     // Every call is approved by a human
+)
+
+// Team is a supervisor agent and the members it asks.
+type Team struct {
+	Description string   `json:"description"` // What to ask it, when it is a member of another team
+	Supervisor  string   `json:"supervisor"`  // An agent of the file
+	Members     []string `json:"members"`     // Agents or teams of the file
+	Parallel    int      `json:"parallel"`    // Members asked at once; one after another if 0
+}
+
+// validName keeps names usable in a tool name (ask_<name>).
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Load reads and checks a team file.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("team: %w", err)
+	}
+	var f File
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("team: %s: %w", path, err)
+	}
+	if err := f.check(); err != nil {
+		return nil, fmt.Errorf("team: %s: %w", path, err)
+	}
+	return &f, nil
+}
+
+// check reports the first problem of the file: a bad name or value, a
+// reference to nothing, a team that contains itself.
+func (f *File) check() error {
+	for _, name := range sortedKeys(f.Agents) {
+		a := f.Agents[name]
+		if a == nil { // "name:" with nothing under it
+			a = &Agent{}
+			f.Agents[name] = a
+		}
+		if !validName.MatchString(name) {
+			return fmt.Errorf("agent %q: a name is letters, digits, _ and -", name)
+		}
+		if _, ok := f.Teams[name]; ok {
+			return fmt.Errorf("%q is both an agent and a team", name)
+		}
+		switch a.Autonomy {
+		case "", Auto, Supervised, Manual:
+		default:
+			return fmt.Errorf("agent %s: autonomy %q (want auto, supervised or manual)", name, a.Autonomy)
+		}
+		if _, err := a.Budget.budget(); err != nil {
+			return fmt.Errorf("agent %s: %w", name, err)
+		}
+		if _, err := a.toolTimeout(); err != nil {
+			return fmt.Errorf("agent %s: %w", name, err)
+		}
+	}
+	for _, name := range sortedKeys(f.Teams) {
+		t := f.Teams[name]
+		if t == nil {
+			return fmt.Errorf("team %s: no supervisor", name)
+		}
+		if !validName.MatchString(name) {
+			return fmt.Errorf("team %q: a name is letters, digits, _ and -", name)
+		}
+		if _, ok := f.Agents[t.Supervisor]; !ok {
+			return fmt.Errorf("team %s: supervisor %q is not an agent of the file", name, t.Supervisor)
+		}
+		if len(t.Members) == 0 {
+			return fmt.Errorf("team %s: no members", name)
+		}
+		for _, m := range t.Members {
+			if m == t.Supervisor {
+				return fmt.Errorf("team %s: %s is the supervisor and a member", name, m)
+			}
+			_, agent := f.Agents[m]
+			_, team := f.Teams[m]
+			if !agent && !team {
+				return fmt.Errorf("team %s: member %q is not an agent or a team of the file", name, m)
+			}
+			if f.description(m) == "" {
+				return fmt.Errorf("team %s: member %q needs a description: it is what the supervisor asks it about", name, m)
+			}
+		}
+		if err := f.acyclic(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// description returns the description of the agent or team name, or ""
+// if there is no such agent or team.
+func (f *File) description(name string) string {
+	if a, ok := f.Agents[name]; ok {
+		return a.Description
+	}
+	if t, ok := f.Teams[name]; ok {
+		return t.Description
+	}
+	return ""
+}
+
+// acyclic reports a team that is, through its members, a member of itself.
+func (f *File) acyclic(name string, path []string) error {
+	if slices.Contains(path, name) {
+		return fmt.Errorf("team %s contains itself: %s", name, strings.Join(append(path, name), " → "))
+	}
+	t, ok := f.Teams[name]
+	if !ok {
+		return nil
+	}
+	for _, m := range t.Members {
+		if err := f.acyclic(m, append(path, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b Budget) budget() (agent.Budget, error) {
+	out := agent.Budget{Steps: b.Steps, Tokens: b.Tokens, Dollars: b.Dollars}
+	if b.Time != "" {
+		d, err := time.ParseDuration(b.Time)
+		if err != nil {
+			return out, fmt.Errorf("budget time: %w", err)
+		}
+		out.Time = d
+	}
+	return out, nil
+}
+
+func (a *Agent) toolTimeout() (time.Duration, error) {
+	if a.ToolTimeout == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(a.ToolTimeout)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("tool_timeout %q: want a duration such as 30s", a.ToolTimeout)
+	}
+	return d, nil
+}
+
+// Options are what a File needs to build agents.
+type Options struct {
+	Client llm.Provider
+	Tools  *tools.Registry // The tools agents may name
+	Skills []*skill.Skill  // The skills agents may name
+
+	// Enabled are skills attached to the agent Build returns, on top of
+	// the ones it names: the supervisor of a team, not its members.
+	Enabled []string
+
+	// Ask approves a call the agent's autonomy holds for a human; preview
+	// is the call as a command (tools.Tool.Preview). nil refuses them all.
+	Ask func(agent string, call openai.ToolCall, preview string) bool
+
+	// Trace, if set, logs the steps of every agent, marked with its name.
+	Trace *trace.Logger
+}
+
+// Names returns the teams and the agents of the file, teams first.
+func (f *File) Names() []string {
+	return append(sortedKeys(f.Teams), sortedKeys(f.Agents)...)
+}
+
+// Build returns the agent for name: the supervisor of a team, wired to
+// its members, or an agent alone. An empty name means the only team of
+// the file, or its only agent if it has no teams.
+func (f *File) Build(name string, opts Options) (*agent.Agent, error) {
+	if name == "" {
+		switch {
+		case len(f.Teams) == 1:
+			name = sortedKeys(f.Teams)[0]
+		case len(f.Teams) == 0 && len(f.Agents) == 1:
+			name = sortedKeys(f.Agents)[0]
+		default:
+			return nil, fmt.Errorf("team: which one? (%s)", strings.Join(f.Names(), ", "))
+		}
+	}
+	if opts.Tools == nil {
+		opts.Tools = tools.NewRegistry()
+	}
+	if _, ok := f.Teams[name]; ok {
+		return f.team(name, opts)
+	}
+	if _, ok := f.Agents[name]; ok {
+		return f.agent(name, nil, "", 0, opts)
+	}
+	return nil, fmt.Errorf("team: no team or agent %q (%s)", name, strings.Join(f.Names(), ", "))
+}
+
+// team builds the supervisor of team name with an ask_<member> tool per
+// member. Members are built once here, so a problem with one shows up
+// before the run; every question then gets a fresh member.
+func (f *File) team(name string, opts Options) (*agent.Agent, error) {
+	t := f.Teams[name]
+	var asks []agent.Tool
+	var workers []prompts.Worker
+	member := opts
+	member.Enabled = nil
+	for _, m := range t.Members {
+		if _, err := f.Build(m, member); err != nil {
+			return nil, err
+		}
+		tool := "ask_" + m
+		asks = append(asks, tools.New(tool, f.description(m),
+			func(ctx context.Context, args struct {
+				Question string `json:"question" description:"The question or task, with everything the member needs to know"`
+			}) (string, error) {
+				a, err := f.Build(m, member)
+				if err != nil {
+					return "", err
+				}
+				answer, err := a.Run(ctx, args.Question)
+				if err != nil {
+					return "", fmt.Errorf("%s: %w. So far:\n%s", m, err, a.Recap())
+				}
+				return answer, nil
+			}))
+		workers = append(workers, prompts.Worker{Tool: tool, Use: f.description(m)})
+	}
+	prompt := f.Agents[t.Supervisor].Prompt
+	if prompt == "" {
+		prompt = prompts.Must("supervisor", prompts.Supervisor{Workers: workers})
+	}
+	a, err := f.agent(t.Supervisor, asks, prompt, t.Parallel, opts)
+	if err != nil {
+		return nil, fmt.Errorf("team %s: %w", name, err)
+	}
+	return a, nil
+}
+
+// agent builds the agent name with its tools from the catalog, extra
+// tools, its skills and the enabled ones, and the approvals its autonomy
+// asks for. prompt, if set,
+// replaces the agent's own; parallel is agent.Config.ParallelTools.
+func (f *File) agent(name string, extra []agent.Tool, prompt string, parallel int, opts Options) (*agent.Agent, error) {
+	spec := f.Agents[name]
+	budget, err := spec.Budget.budget()
+	if err != nil {
+		return nil, fmt.Errorf("agent %s: %w", name, err)
+	}
+	toolTimeout, err := spec.toolTimeout()
+	if err != nil {
+		return nil, fmt.Errorf("agent %s: %w", name, err)
+	}
+	if prompt == "" {
+		prompt = spec.Prompt
+	}
+	var ts []agent.Tool
+	for _, tn := range spec.Tools {
+		t, ok := opts.Tools.Get(tn)
+		if !ok {
+			return nil, fmt.Errorf("agent %s: unknown tool %q (have %s)", name, tn, strings.Join(opts.Tools.Names(), ", "))
+		}
+		ts = append(ts, t)
+	}
+	ts = append(ts, extra...)
+
+	var skills []*skill.Skill
+	for _, sn := range slices.Concat(spec.Skills, opts.Enabled) {
+		s, err := skill.Find(opts.Skills, sn)
+		if err != nil {
+			return nil, fmt.Errorf("agent %s: %w", name, err)
+		}
+		if !slices.Contains(skills, s) {
+			skills = append(skills, s)
+		}
+	}
+	cfg, skillTools, err := skill.Attach(agent.Config{
+		Model:         spec.Model,
+		SystemPrompt:  prompt,
+		Budget:        budget,
+		LoopLimit:     spec.LoopLimit,
+		ToolTimeout:   toolTimeout,
+		ParallelTools: parallel,
+		Trace:         opts.Trace.With("agent", name),
+	}, opts.Tools, skills...)
+	if err != nil {
+		return nil, fmt.Errorf("agent %s: %w", name, err)
+	}
+	for _, t := range skillTools {
+		if !slices.ContainsFunc(ts, func(o agent.Tool) bool { return o.Name == t.Name }) {
+			ts = append(ts, t)
+		}
+	}
+
+	// The calls held for a human, by tool name.
+	var held []string
+	for _, t := range ts {
+		if spec.Autonomy == Manual || (spec.Autonomy != Auto && t.Mutating) {
+			held = append(held, t.Name)
+		}
+	}
+	var a *agent.Agent // The approval prompt shows the call as a command
+	if len(held) > 0 {
+		cfg.Hooks = agent.Approval(func(call openai.ToolCall) bool {
+			return opts.Ask != nil && opts.Ask(name, call, a.Preview(call))
+		}, held...)
+	}
+	a = agent.New(opts.Client, cfg)
+	for _, t := range ts {
+		a.RegisterTool(t)
+	}
+	return a, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
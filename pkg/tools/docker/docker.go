@@ -0,0 +1,261 @@
+// Package docker gives an agent the Docker containers of one host: list
+// them, read the last lines of a container's logs, restart one.
+//
+//	c, err := docker.FromEnv() // DOCKER_HOST, or the local socket
+//	reg := tools.NewRegistry(docker.Tools(c)...)
+//
+// The client speaks the Docker Engine API over its socket, the API the
+// docker CLI and the Go SDK use, so it needs neither. DOCKER_HOST may be
+// unix:///path/to/docker.sock or tcp://host:2375; TLS (tcp with
+// DOCKER_TLS_VERIFY) is not supported.
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/tools"
+)
+
+// DefaultHost is the Docker socket used when DOCKER_HOST is not set.
+const DefaultHost = "unix:///var/run/docker.sock"
+
+// MaxLogLines is the most log lines docker_logs returns.
+const MaxLogLines = 500
+
+// Client talks to one Docker daemon.
+type Client struct {
+	base string // http://docker or http://host:port
+	http *http.Client
+}
+
+// Container is one container as the API lists it.
+type Container struct {
+	ID     string   `json:"Id"`
+	Names  []string `json:"Names"` // With a leading "/"
+	Image  string   `json:"Image"`
+	State  string   `json:"State"`  // running, exited, restarting...
+	Status string   `json:"Status"` // "Up 2 hours", "Exited (1) 5 minutes ago"
+}
+
+// Name is the container's name without the leading "/".
+func (c Container) Name() string {
+	if len(c.Names) == 0 {
+		return c.ID[:min(len(c.ID), 12)]
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+// APIError is an error the daemon returned: 404 for a container that
+// doesn't exist, 409 for a conflict, 500 for the daemon's own failures.
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("docker: %d %s", e.Status, e.Message)
+}
+
+// New returns a client of the daemon at host: unix:///path or tcp://host:port.
+func New(host string) (*Client, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("docker: host %q: %w", host, err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	c := &Client{http: &http.Client{Transport: transport}}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+		c.base = "http://docker"
+	case "tcp", "http":
+		c.base = "http://" + u.Host
+	default:
+		return nil, fmt.Errorf("docker: host %q: want unix:// or tcp://", host)
+	}
+	return c, nil
+}
+
+// FromEnv returns a client of DOCKER_HOST, or of DefaultHost.
+func FromEnv() (*Client, error) {
+	if os.Getenv("DOCKER_TLS_VERIFY") != "" {
+		return nil, errors.New("docker: DOCKER_TLS_VERIFY is set, and TLS is not supported")
+	}
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		host = DefaultHost
+	}
+	return New(host)
+}
+
+// do sends a request and returns the body of a 2xx reply.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values) ([]byte, error) {
+	u := c.base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("docker: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		var e struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &e) != nil || e.Message == "" {
+			e.Message = strings.TrimSpace(string(body))
+		}
+		return nil, &APIError{Status: resp.StatusCode, Message: e.Message}
+	}
+	return body, nil
+}
+
+// Containers lists the running containers, or all of them.
+func (c *Client) Containers(ctx context.Context, all bool) ([]Container, error) {
+	query := url.Values{}
+	if all {
+		query.Set("all", "1")
+	}
+	body, err := c.do(ctx, http.MethodGet, "/containers/json", query)
+	if err != nil {
+		return nil, err
+	}
+	var list []Container
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("docker: containers: %w", err)
+	}
+	return list, nil
+}
+
+// Logs returns the last lines of a container's stdout and stderr.
+func (c *Client) Logs(ctx context.Context, container string, lines int) (string, error) {
+	// Without a TTY the daemon multiplexes stdout and stderr into frames;
+	// with one it sends the raw stream.
+	body, err := c.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(container)+"/json", nil)
+	if err != nil {
+		return "", err
+	}
+	var inspect struct {
+		Config struct {
+			Tty bool `json:"Tty"`
+		} `json:"Config"`
+	}
+	if err := json.Unmarshal(body, &inspect); err != nil {
+		return "", fmt.Errorf("docker: inspect %s: %w", container, err)
+	}
+	query := url.Values{"stdout": {"1"}, "stderr": {"1"}, "tail": {fmt.Sprint(lines)}}
+	body, err = c.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(container)+"/logs", query)
+	if err != nil {
+		return "", err
+	}
+	if inspect.Config.Tty {
+		return string(body), nil
+	}
+	return demux(body)
+}
+
+// demux joins the frames of a multiplexed log stream: an 8-byte header
+// (stream type, three zero bytes, big-endian size), then the payload.
+func demux(data []byte) (string, error) {
+	var out bytes.Buffer
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return "", errors.New("docker: logs: truncated frame header")
+		}
+		size := int(binary.BigEndian.Uint32(data[4:8]))
+		if len(data) < 8+size {
+			return "", errors.New("docker: logs: truncated frame")
+		}
+		out.Write(data[8 : 8+size])
+		data = data[8+size:]
+	}
+	return out.String(), nil
+}
+
+// Restart stops a container, waiting up to timeout for it to exit before
+// killing it, and starts it again.
+func (c *Client) Restart(ctx context.Context, container string, timeout time.Duration) error {
+	query := url.Values{"t": {fmt.Sprint(int(timeout.Seconds()))}}
+	_, err := c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(container)+"/restart", query)
+	return err
+}
+
+// Tools returns docker_ps, docker_logs and docker_restart (Mutating) over c.
+func Tools(c *Client) []tools.Tool {
+	ps := tools.New("docker_ps", "List Docker containers: name, image, state and status.", func(ctx context.Context, args struct {
+		All bool `json:"all,omitempty" description:"Include stopped containers"`
+	}) (string, error) {
+		list, err := c.Containers(ctx, args.All)
+		if err != nil {
+			return "", err
+		}
+		if len(list) == 0 {
+			return "No containers.", nil
+		}
+		var b strings.Builder
+		w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tIMAGE\tSTATE\tSTATUS")
+		for _, ct := range list {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", ct.Name(), ct.Image, ct.State, ct.Status)
+		}
+		w.Flush()
+		return b.String(), nil
+	})
+
+	logs := tools.New("docker_logs", "Read the last lines of a Docker container's logs (stdout and stderr).", func(ctx context.Context, args struct {
+		Container string `json:"container" description:"Container name or ID"`
+		Lines     int    `json:"lines,omitempty" description:"How many lines from the end (default 50)" minimum:"1" maximum:"500"`
+	}) (string, error) {
+		if args.Lines == 0 {
+			args.Lines = 50
+		}
+		text, err := c.Logs(ctx, args.Container, min(args.Lines, MaxLogLines))
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(text) == "" {
+			return "No log lines.", nil
+		}
+		return text, nil
+	})
+
+	type restartArgs struct {
+		Container string `json:"container" description:"Container name or ID"`
+	}
+	restart := tools.New("docker_restart", "Restart a Docker container. It gets 10 seconds to stop before it is killed.", func(ctx context.Context, args restartArgs) (string, error) {
+		if err := c.Restart(ctx, args.Container, 10*time.Second); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Container %s restarted.", args.Container), nil
+	})
+	restart.Mutating = true
+	restart.Preview = tools.PreviewOf(func(args restartArgs) string { return "docker restart " + args.Container })
+
+	return []tools.Tool{ps, logs, restart}
+}
@@ -0,0 +1,235 @@
+// Package files gives an agent the files of one directory, the sandbox:
+// read_file, list_dir and, unless the sandbox is read-only, write_file
+// (Mutating). Nothing outside it can be reached, by a "../" or by a
+// symlink: paths are resolved with os.Root. The sandbox holds for these
+// tools only: an agent that also has a shell can reach anything.
+//
+//	sb, err := files.Open("configs") // Relative paths from here on
+//	sb.ReadOnly = true               // No write_file
+//	reg := tools.NewRegistry(files.Tools(sb)...)
+//
+// A read returns at most MaxRead bytes, with the offset to read on from;
+// a write over MaxWrite is refused. A write replaces the file at once
+// (a temporary file renamed over it), so a reader never sees half a
+// config.
+package files
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/tools"
+)
+
+// Defaults of Sandbox.
+const (
+	DefaultMaxRead  = 32 << 10
+	DefaultMaxWrite = 1 << 20
+)
+
+// ErrReadOnly is returned by Write in a read-only sandbox.
+var ErrReadOnly = errors.New("files: the sandbox is read-only")
+
+// Sandbox is a directory the tools can't leave.
+type Sandbox struct {
+	Dir      string
+	ReadOnly bool
+	MaxRead  int // Bytes per read; DefaultMaxRead if 0
+	MaxWrite int // Bytes per write; DefaultMaxWrite if 0
+
+	root *os.Root
+}
+
+// Open returns a sandbox of the directory dir.
+func Open(dir string) (*Sandbox, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, fmt.Errorf("files: %w", err)
+	}
+	return &Sandbox{Dir: dir, root: root}, nil
+}
+
+// Close releases the directory.
+func (s *Sandbox) Close() error { return s.root.Close() }
+
+// clean checks that path is relative and inside the sandbox, for a clear
+// message; os.Root would refuse it too, symlinks included.
+func clean(path string) (string, error) {
+	if path == "" || path == "." || path == "/" {
+		return ".", nil
+	}
+	if filepath.IsAbs(path) || !filepath.IsLocal(path) {
+		return "", fmt.Errorf("files: %s: paths are relative to the sandbox and stay inside it", path)
+	}
+	return filepath.Clean(path), nil
+}
+
+// sniffSize is how much of a file Read looks at to tell a binary one.
+const sniffSize = 8 << 10
+
+// Read returns up to MaxRead bytes of a text file from offset, and says
+// how to read on if there is more. Only those bytes are read, so a read
+// of a big log costs no more than a read of a small one.
+func (s *Sandbox) Read(path string, offset int) (string, error) {
+	path, err := clean(path)
+	if err != nil {
+		return "", err
+	}
+	f, err := s.root.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("files: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("files: %w", err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("files: %s is a directory: list it", path)
+	}
+	size := int(info.Size())
+	head := make([]byte, min(size, sniffSize))
+	if _, err := io.ReadFull(f, head); err != nil {
+		return "", fmt.Errorf("files: %w", err)
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return "", fmt.Errorf("files: %s is a binary file (%d bytes)", path, size)
+	}
+	if offset < 0 || offset > size {
+		return "", fmt.Errorf("files: %s: offset %d outside the file (%d bytes)", path, offset, size)
+	}
+	if _, err := f.Seek(int64(offset), io.SeekStart); err != nil {
+		return "", fmt.Errorf("files: %w", err)
+	}
+	data, err := io.ReadAll(io.LimitReader(f, int64(cmp.Or(s.MaxRead, DefaultMaxRead))))
+	if err != nil {
+		return "", fmt.Errorf("files: %w", err)
+	}
+	text := string(data)
+	if end := offset + len(data); end < size {
+		text += fmt.Sprintf("\n... (%d more bytes: read on with offset %d)", size-end, end)
+	}
+	return text, nil
+}
+
+// Write replaces the file at path with content, creating it and its
+// directories if needed, and returns the size it had (-1 if it was new).
+func (s *Sandbox) Write(path, content string) (int, error) {
+	if s.ReadOnly {
+		return 0, ErrReadOnly
+	}
+	path, err := clean(path)
+	if err != nil {
+		return 0, err
+	}
+	if limit := cmp.Or(s.MaxWrite, DefaultMaxWrite); len(content) > limit {
+		return 0, fmt.Errorf("files: %s: %d bytes is over the limit of %d", path, len(content), limit)
+	}
+	was, mode := -1, os.FileMode(0o644)
+	if info, err := s.root.Stat(path); err == nil {
+		if info.IsDir() {
+			return 0, fmt.Errorf("files: %s is a directory", path)
+		}
+		was, mode = int(info.Size()), info.Mode().Perm()
+	}
+	if err := s.root.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, fmt.Errorf("files: %w", err)
+	}
+	tmp := fmt.Sprintf("%s.tmp-%d", path, time.Now().UnixNano())
+	if err := s.root.WriteFile(tmp, []byte(content), mode); err != nil {
+		return 0, fmt.Errorf("files: %w", err)
+	}
+	if err := s.root.Rename(tmp, path); err != nil {
+		s.root.Remove(tmp)
+		return 0, fmt.Errorf("files: %w", err)
+	}
+	return was, nil
+}
+
+// List returns the entries of a directory, one per line: directories with
+// a trailing "/", files with their size.
+func (s *Sandbox) List(path string) (string, error) {
+	path, err := clean(path)
+	if err != nil {
+		return "", err
+	}
+	dir, err := s.root.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("files: %w", err)
+	}
+	defer dir.Close()
+	entries, err := dir.ReadDir(-1)
+	if err != nil {
+		return "", fmt.Errorf("files: %w", err)
+	}
+	if len(entries) == 0 {
+		return "(empty directory)", nil
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	var b strings.Builder
+	for _, e := range entries {
+		switch info, err := e.Info(); {
+		case e.IsDir():
+			fmt.Fprintf(&b, "%s/\n", e.Name())
+		case err == nil && info.Mode().IsRegular():
+			fmt.Fprintf(&b, "%s  %d B\n", e.Name(), info.Size())
+		default:
+			fmt.Fprintf(&b, "%s\n", e.Name())
+		}
+	}
+	return b.String(), nil
+}
+
+// Tools returns read_file, list_dir and, unless s is read-only, write_file
+// (Mutating) over s.
+func Tools(s *Sandbox) []tools.Tool {
+	read := tools.New("read_file", "Read a text file of the sandbox directory. A long file comes in parts: read on with the offset the result gives.", func(_ context.Context, args struct {
+		Path   string `json:"path" description:"Path relative to the sandbox"`
+		Offset int    `json:"offset,omitempty" description:"Byte to start from (default 0)" minimum:"0"`
+	}) (string, error) {
+		return s.Read(args.Path, args.Offset)
+	})
+	read.Concurrency = 4
+
+	list := tools.New("list_dir", "List a directory of the sandbox: subdirectories end with /, files show their size.", func(_ context.Context, args struct {
+		Path string `json:"path,omitempty" description:"Path relative to the sandbox (default: its top)"`
+	}) (string, error) {
+		return s.List(args.Path)
+	})
+
+	if s.ReadOnly {
+		return []tools.Tool{read, list}
+	}
+	type writeArgs struct {
+		Path    string `json:"path" description:"Path relative to the sandbox"`
+		Content string `json:"content" description:"The whole new content of the file"`
+	}
+	write := tools.New("write_file", "Write a file of the sandbox: the content replaces the file, or creates it.", func(_ context.Context, args writeArgs) (string, error) {
+		was, err := s.Write(args.Path, args.Content)
+		if err != nil {
+			return "", err
+		}
+		if was < 0 {
+			return fmt.Sprintf("Created %s (%d bytes).", args.Path, len(args.Content)), nil
+		}
+		return fmt.Sprintf("Wrote %s (%d bytes, was %d).", args.Path, len(args.Content), was), nil
+	})
+	write.Mutating = true
+	write.Preview = tools.PreviewOf(func(args writeArgs) string {
+		if info, err := s.root.Stat(args.Path); err == nil {
+			return fmt.Sprintf("write %s: %d bytes, replacing %d", args.Path, len(args.Content), info.Size())
+		}
+		return fmt.Sprintf("create %s: %d bytes", args.Path, len(args.Content))
+	})
+	return []tools.Tool{read, list, write}
+}
@@ -0,0 +1,269 @@
+// Package git gives an agent one repository: git_status, git_diff and
+// git_log to see what changed, git_commit and git_checkout (Mutating) to
+// record a fix on a branch of its own. It runs the system git.
+//
+//	repo, err := git.Open(".")
+//	repo.Protected = []string{"main", "release/*"} // DefaultProtected if nil
+//	reg := tools.NewRegistry(git.Tools(repo)...)
+//
+// A commit on a protected branch is refused: the agent makes a branch with
+// git_checkout and commits there, and a human merges it. There is no push
+// and no tool that discards changes (reset, checkout of paths, clean);
+// git_checkout only switches branches, and git itself refuses a switch
+// that would overwrite uncommitted work.
+package git
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/tools"
+)
+
+// DefaultMaxOutput is how much of an output the tools keep.
+const DefaultMaxOutput = 16 << 10
+
+// DefaultProtected are the branches commits are refused on when
+// Repo.Protected is nil.
+var DefaultProtected = []string{"main", "master", "release/*"}
+
+// ErrProtected is matched by the error of a commit on a protected branch.
+var ErrProtected = errors.New("git: protected branch")
+
+// Repo is a work tree and its policy.
+type Repo struct {
+	Dir       string   // The top of the work tree
+	Protected []string // Branch patterns (path.Match): "main", "release/*"
+	MaxOutput int      // Bytes kept of an output; DefaultMaxOutput if 0
+}
+
+// Open returns the repository dir is in.
+func Open(dir string) (*Repo, error) {
+	r := &Repo{Dir: dir}
+	top, err := r.run(context.Background(), "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	r.Dir = strings.TrimSpace(top)
+	return r, nil
+}
+
+// run runs git in the work tree and returns its output; a failure is an
+// error with what git printed.
+func (r *Repo) run(ctx context.Context, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", append([]string{"--no-pager", "-c", "core.quotepath=off"}, args...)...)
+	cmd.Dir = r.Dir
+	// No prompts for credentials or an editor, and messages in English for
+	// the model.
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_EDITOR=true", "LC_ALL=C")
+	var out, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String() + "\n" + out.String())
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, msg)
+	}
+	return out.String(), nil
+}
+
+// cut keeps the first MaxOutput bytes of s.
+func (r *Repo) cut(s string) string {
+	limit := cmp.Or(r.MaxOutput, DefaultMaxOutput)
+	if len(s) <= limit {
+		return s
+	}
+	return s[:limit] + fmt.Sprintf("\n... (%d more bytes)", len(s)-limit)
+}
+
+// Branch returns the current branch, or "" on a detached HEAD.
+func (r *Repo) Branch(ctx context.Context) (string, error) {
+	out, err := r.run(ctx, "symbolic-ref", "--quiet", "--short", "HEAD")
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && exit.ExitCode() == 1 {
+		return "", nil
+	}
+	return strings.TrimSpace(out), err
+}
+
+// IsProtected reports whether commits on branch are refused.
+func (r *Repo) IsProtected(branch string) bool {
+	patterns := r.Protected
+	if patterns == nil {
+		patterns = DefaultProtected
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, branch); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Status returns the branch and the changed files, short format.
+func (r *Repo) Status(ctx context.Context) (string, error) {
+	out, err := r.run(ctx, "status", "--short", "--branch")
+	if err != nil {
+		return "", err
+	}
+	if strings.Count(out, "\n") <= 1 {
+		out += "(no changes)\n"
+	}
+	return r.cut(out), nil
+}
+
+// Diff returns the unstaged changes, or the staged ones, of the work tree
+// or of one path.
+func (r *Repo) Diff(ctx context.Context, staged bool, file string) (string, error) {
+	args := []string{"diff", "--stat", "--patch"}
+	if staged {
+		args = append(args, "--cached")
+	}
+	if file != "" {
+		args = append(args, "--", file)
+	}
+	out, err := r.run(ctx, args...)
+	if err != nil {
+		return "", err
+	}
+	if out == "" {
+		return "(no changes)", nil
+	}
+	return r.cut(out), nil
+}
+
+// Log returns the last n commits, of the work tree or of one path.
+func (r *Repo) Log(ctx context.Context, n int, file string) (string, error) {
+	args := []string{"log", fmt.Sprintf("-n%d", cmp.Or(n, 10)), "--format=%h %ad %an: %s", "--date=short"}
+	if file != "" {
+		args = append(args, "--", file)
+	}
+	out, err := r.run(ctx, args...)
+	if err != nil {
+		return "", err
+	}
+	if out == "" {
+		return "(no commits)", nil
+	}
+	return r.cut(out), nil
+}
+
+// Commit stages paths (every change if none) and commits them on the
+// current branch, unless it is protected.
+func (r *Repo) Commit(ctx context.Context, message string, paths []string) (string, error) {
+	if strings.TrimSpace(message) == "" {
+		return "", errors.New("git: a commit needs a message")
+	}
+	branch, err := r.Branch(ctx)
+	if err != nil {
+		return "", err
+	}
+	if branch == "" {
+		return "", errors.New("git: HEAD is detached: switch to a branch with git_checkout first")
+	}
+	if r.IsProtected(branch) {
+		return "", fmt.Errorf("%w: %s; make a branch with git_checkout and commit there", ErrProtected, branch)
+	}
+	add := []string{"add", "-A"}
+	if len(paths) > 0 {
+		add = append([]string{"add", "--"}, paths...)
+	}
+	if _, err := r.run(ctx, add...); err != nil {
+		return "", err
+	}
+	if _, err := r.run(ctx, "diff", "--cached", "--quiet"); err == nil {
+		return "", errors.New("git: nothing to commit")
+	}
+	out, err := r.run(ctx, "commit", "-m", message)
+	if err != nil {
+		return "", err
+	}
+	return r.cut(out), nil
+}
+
+// Checkout switches to branch, making it from the current commit if
+// create is set.
+func (r *Repo) Checkout(ctx context.Context, branch string, create bool) (string, error) {
+	if strings.HasPrefix(branch, "-") {
+		return "", fmt.Errorf("git: bad branch name %q", branch)
+	}
+	if _, err := r.run(ctx, "check-ref-format", "--branch", branch); err != nil {
+		return "", fmt.Errorf("git: bad branch name %q", branch)
+	}
+	args := []string{"switch", branch}
+	if create {
+		args = []string{"switch", "-c", branch}
+	}
+	if _, err := r.run(ctx, args...); err != nil {
+		return "", err
+	}
+	return r.Status(ctx)
+}
+
+// Tools returns git_status, git_diff, git_log, and git_commit and
+// git_checkout (Mutating) over r.
+func Tools(r *Repo) []tools.Tool {
+	status := tools.New("git_status", "The current branch and the changed files of the repository.", func(ctx context.Context, _ struct{}) (string, error) {
+		return r.Status(ctx)
+	})
+
+	diff := tools.New("git_diff", "The changes not yet staged, or the staged ones, of the repository or of one file.", func(ctx context.Context, args struct {
+		Staged bool   `json:"staged,omitempty" description:"Show the staged changes instead"`
+		Path   string `json:"path,omitempty" description:"Only this file or directory"`
+	}) (string, error) {
+		return r.Diff(ctx, args.Staged, args.Path)
+	})
+
+	log := tools.New("git_log", "The last commits of the repository or of one file.", func(ctx context.Context, args struct {
+		N    int    `json:"n,omitempty" description:"How many commits (default 10)" minimum:"1" maximum:"100"`
+		Path string `json:"path,omitempty" description:"Only commits that touch this file or directory"`
+	}) (string, error) {
+		return r.Log(ctx, args.N, args.Path)
+	})
+
+	type commitArgs struct {
+		Message string   `json:"message" description:"Commit message: a summary line, then why"`
+		Paths   []string `json:"paths,omitempty" description:"Files to commit (default: every change)"`
+	}
+	protected := r.Protected
+	if protected == nil {
+		protected = DefaultProtected
+	}
+	commit := tools.New("git_commit", "Commit changes on the current branch. Refused on a protected branch ("+strings.Join(protected, ", ")+"): make a branch with git_checkout first.", func(ctx context.Context, args commitArgs) (string, error) {
+		return r.Commit(ctx, args.Message, args.Paths)
+	})
+	commit.Mutating = true
+	commit.Preview = tools.PreviewOf(func(args commitArgs) string {
+		branch, _ := r.Branch(context.Background())
+		what := "every change"
+		if len(args.Paths) > 0 {
+			what = strings.Join(args.Paths, " ")
+		}
+		subject, _, _ := strings.Cut(args.Message, "\n")
+		return fmt.Sprintf("git commit on %s (%s): %s", cmp.Or(branch, "detached HEAD"), what, subject)
+	})
+
+	type checkoutArgs struct {
+		Branch string `json:"branch" description:"Branch to switch to"`
+		Create bool   `json:"create,omitempty" description:"Make the branch from the current commit"`
+	}
+	checkout := tools.New("git_checkout", "Switch to a branch, or make a new one. Uncommitted changes come along; git refuses a switch that would overwrite them.", func(ctx context.Context, args checkoutArgs) (string, error) {
+		return r.Checkout(ctx, args.Branch, args.Create)
+	})
+	checkout.Mutating = true
+	checkout.Preview = tools.PreviewOf(func(args checkoutArgs) string {
+		if args.Create {
+			return "git switch -c " + args.Branch
+		}
+		return "git switch " + args.Branch
+	})
+	return []tools.Tool{status, diff, log, commit, checkout}
+}
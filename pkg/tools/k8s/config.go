@@ -0,0 +1,319 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/yaml"
+)
+
+// Finding the cluster, the way kubectl does: the first file of KUBECONFIG,
+// else ~/.kube/config, else the service account of the pod the program
+// runs in. Of a kubeconfig, the current context is used; a token, a token
+// file, a client certificate and an exec plugin (aws, gke-gcloud-auth-plugin,
+// kubelogin) are understood. The old auth-provider plugins are not.
+
+// inClusterDir is where Kubernetes mounts the service account of a pod.
+const inClusterDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// FromEnv returns a client of the cluster kubectl would talk to.
+func FromEnv() (*Client, error) {
+	if list := os.Getenv("KUBECONFIG"); list != "" {
+		for _, path := range filepath.SplitList(list) {
+			if _, err := os.Stat(path); err == nil {
+				return Load(path, "")
+			}
+		}
+		return nil, fmt.Errorf("k8s: no file of KUBECONFIG=%s exists", list)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		path := filepath.Join(home, ".kube", "config")
+		if _, err := os.Stat(path); err == nil {
+			return Load(path, "")
+		}
+	}
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return InCluster()
+	}
+	return nil, errors.New("k8s: no kubeconfig (KUBECONFIG, ~/.kube/config) and not in a cluster")
+}
+
+// kubeconfig is the part of a kubeconfig file the client reads.
+type kubeconfig struct {
+	CurrentContext string `json:"current-context"`
+	Clusters       []struct {
+		Name    string `json:"name"`
+		Cluster struct {
+			Server                   string `json:"server"`
+			CertificateAuthority     string `json:"certificate-authority"`
+			CertificateAuthorityData string `json:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `json:"insecure-skip-tls-verify"`
+			TLSServerName            string `json:"tls-server-name"`
+		} `json:"cluster"`
+	} `json:"clusters"`
+	Users []struct {
+		Name string `json:"name"`
+		User struct {
+			Token                 string          `json:"token"`
+			TokenFile             string          `json:"tokenFile"`
+			ClientCertificate     string          `json:"client-certificate"`
+			ClientCertificateData string          `json:"client-certificate-data"`
+			ClientKey             string          `json:"client-key"`
+			ClientKeyData         string          `json:"client-key-data"`
+			Exec                  *execConfig     `json:"exec"`
+			AuthProvider          json.RawMessage `json:"auth-provider"`
+		} `json:"user"`
+	} `json:"users"`
+	Contexts []struct {
+		Name    string `json:"name"`
+		Context struct {
+			Cluster   string `json:"cluster"`
+			User      string `json:"user"`
+			Namespace string `json:"namespace"`
+		} `json:"context"`
+	} `json:"contexts"`
+}
+
+// execConfig runs a program that prints an ExecCredential with a token.
+type execConfig struct {
+	APIVersion string   `json:"apiVersion"`
+	Command    string   `json:"command"`
+	Args       []string `json:"args"`
+	Env        []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"env"`
+}
+
+// Load returns a client of the context named contextName of the kubeconfig
+// at path, or of its current context if contextName is "".
+func Load(path, contextName string) (*Client, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("k8s: %w", err)
+	}
+	// pkg/yaml refuses unknown keys, and a kubeconfig has many the client
+	// doesn't need (preferences, extensions): decode into any, then into
+	// the struct, which ignores them.
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("k8s: %s: %w", path, err)
+	}
+	js, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("k8s: %s: %w", path, err)
+	}
+	var kc kubeconfig
+	if err := json.Unmarshal(js, &kc); err != nil {
+		return nil, fmt.Errorf("k8s: %s: %w", path, err)
+	}
+
+	if contextName == "" {
+		contextName = kc.CurrentContext
+	}
+	if contextName == "" {
+		return nil, fmt.Errorf("k8s: %s has no current-context", path)
+	}
+	dir := filepath.Dir(path)
+	rel := func(p string) string { // Paths in a kubeconfig are relative to it
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+
+	c := &Client{Source: fmt.Sprintf("%s, context %s", path, contextName)}
+	tlsConfig := &tls.Config{}
+	found := 0
+	for _, ctx := range kc.Contexts {
+		if ctx.Name != contextName {
+			continue
+		}
+		found++
+		c.Namespace = ctx.Context.Namespace
+		for _, cl := range kc.Clusters {
+			if cl.Name != ctx.Context.Cluster {
+				continue
+			}
+			found++
+			c.Server = strings.TrimSuffix(cl.Cluster.Server, "/")
+			tlsConfig.InsecureSkipVerify = cl.Cluster.InsecureSkipTLSVerify
+			tlsConfig.ServerName = cl.Cluster.TLSServerName
+			ca, err := dataOrFile(cl.Cluster.CertificateAuthorityData, rel(cl.Cluster.CertificateAuthority))
+			if err != nil {
+				return nil, fmt.Errorf("k8s: cluster %s: %w", cl.Name, err)
+			}
+			if ca != nil {
+				if tlsConfig.RootCAs, err = certPool(ca); err != nil {
+					return nil, fmt.Errorf("k8s: cluster %s: %w", cl.Name, err)
+				}
+			}
+		}
+		for _, u := range kc.Users {
+			if u.Name != ctx.Context.User {
+				continue
+			}
+			user := u.User
+			switch {
+			case len(user.AuthProvider) > 0:
+				return nil, fmt.Errorf("k8s: user %s: auth-provider plugins are not supported; use a token or an exec plugin", u.Name)
+			case user.Exec != nil:
+				c.token = execToken(*user.Exec)
+			case user.Token != "":
+				token := user.Token
+				c.token = func(context.Context) (string, error) { return token, nil }
+			case user.TokenFile != "":
+				c.token = tokenFile(rel(user.TokenFile))
+			}
+			cert, err := dataOrFile(user.ClientCertificateData, rel(user.ClientCertificate))
+			if err != nil {
+				return nil, fmt.Errorf("k8s: user %s: %w", u.Name, err)
+			}
+			key, err := dataOrFile(user.ClientKeyData, rel(user.ClientKey))
+			if err != nil {
+				return nil, fmt.Errorf("k8s: user %s: %w", u.Name, err)
+			}
+			if cert != nil && key != nil {
+				pair, err := tls.X509KeyPair(cert, key)
+				if err != nil {
+					return nil, fmt.Errorf("k8s: user %s: %w", u.Name, err)
+				}
+				tlsConfig.Certificates = []tls.Certificate{pair}
+			}
+		}
+	}
+	if found < 2 || c.Server == "" {
+		return nil, fmt.Errorf("k8s: %s: context %q or its cluster not found", path, contextName)
+	}
+	c.init(tlsConfig)
+	return c, nil
+}
+
+// InCluster returns a client that acts as the service account of the pod
+// the program runs in.
+func InCluster() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("k8s: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set: not in a cluster")
+	}
+	ca, err := os.ReadFile(filepath.Join(inClusterDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("k8s: %w", err)
+	}
+	pool, err := certPool(ca)
+	if err != nil {
+		return nil, err
+	}
+	namespace, _ := os.ReadFile(filepath.Join(inClusterDir, "namespace"))
+	c := &Client{
+		Server:    "https://" + net.JoinHostPort(host, port),
+		Namespace: strings.TrimSpace(string(namespace)),
+		Source:    "in-cluster service account",
+		// The kubelet rotates the token: read it for every request.
+		token: tokenFile(filepath.Join(inClusterDir, "token")),
+	}
+	c.init(&tls.Config{RootCAs: pool})
+	return c, nil
+}
+
+// init makes the HTTP client of c.
+func (c *Client) init(tlsConfig *tls.Config) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	c.http = &http.Client{Timeout: 30 * time.Second, Transport: transport}
+	if c.Namespace == "" {
+		c.Namespace = "default"
+	}
+}
+
+// dataOrFile returns the base64 data, or else the contents of the file,
+// or nil if both are empty.
+func dataOrFile(data, path string) ([]byte, error) {
+	switch {
+	case data != "":
+		return base64.StdEncoding.DecodeString(data)
+	case path != "":
+		return os.ReadFile(path)
+	}
+	return nil, nil
+}
+
+func certPool(pem []byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("k8s: no certificates in the certificate authority")
+	}
+	return pool, nil
+}
+
+func tokenFile(path string) func(context.Context) (string, error) {
+	return func(context.Context) (string, error) {
+		token, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("k8s: %w", err)
+		}
+		return strings.TrimSpace(string(token)), nil
+	}
+}
+
+// execToken runs the exec plugin for a token, and again once the token
+// is about to expire.
+func execToken(cfg execConfig) func(context.Context) (string, error) {
+	var (
+		mu      sync.Mutex
+		token   string
+		expires time.Time // Zero: doesn't expire
+	)
+	return func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if token != "" && (expires.IsZero() || time.Until(expires) > time.Minute) {
+			return token, nil
+		}
+		cmd := exec.CommandContext(ctx, cfg.Command, cfg.Args...)
+		cmd.Env = os.Environ()
+		for _, e := range cfg.Env {
+			cmd.Env = append(cmd.Env, e.Name+"="+e.Value)
+		}
+		info, _ := json.Marshal(map[string]any{
+			"apiVersion": cfg.APIVersion,
+			"kind":       "ExecCredential",
+			"spec":       map[string]any{"interactive": false},
+		})
+		cmd.Env = append(cmd.Env, "KUBERNETES_EXEC_INFO="+string(info))
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("k8s: exec plugin %s: %w: %s", cfg.Command, err, strings.TrimSpace(stderr.String()))
+		}
+		var cred struct {
+			Status struct {
+				Token               string    `json:"token"`
+				ExpirationTimestamp time.Time `json:"expirationTimestamp"`
+			} `json:"status"`
+		}
+		if err := json.Unmarshal(out, &cred); err != nil {
+			return "", fmt.Errorf("k8s: exec plugin %s: %w", cfg.Command, err)
+		}
+		if cred.Status.Token == "" {
+			return "", fmt.Errorf("k8s: exec plugin %s returned no token (client certificates from plugins are not supported)", cfg.Command)
+		}
+		token, expires = cred.Status.Token, cred.Status.ExpirationTimestamp
+		return token, nil
+	}
+}
@@ -0,0 +1,119 @@
+// Package k8s gives an agent a Kubernetes cluster: the pods of a
+// namespace, the description of a pod with its events, the events of a
+// namespace, the logs of a pod, and a rollout restart of a deployment.
+//
+//	c, err := k8s.FromEnv() // The cluster kubectl talks to
+//	reg := tools.NewRegistry(k8s.Tools(c, true)...) // Read-only: no k8s_rollout_restart
+//
+// The client speaks the Kubernetes REST API, the API kubectl and
+// client-go use, so it needs neither; the kubeconfig is found and read as
+// kubectl does (see config.go). What the tools can see and do is what the
+// credentials may: for an agent, a service account or a user bound to the
+// "view" ClusterRole, plus patch on deployments if it may restart them.
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client talks to the API server of one cluster.
+type Client struct {
+	Server    string // https://host:6443
+	Namespace string // Of the context; "default" if it names none
+	Source    string // Where the configuration came from, for messages
+
+	http  *http.Client
+	token func(ctx context.Context) (string, error) // nil: no bearer token
+}
+
+// APIError is an error the API server returned, from its Status object:
+// 404 NotFound, 403 Forbidden (the credentials may not do it), 409
+// Conflict.
+type APIError struct {
+	Status  int
+	Reason  string // NotFound, Forbidden...
+	Message string // pods "api-7d9c" not found
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("k8s: %d %s: %s", e.Status, e.Reason, e.Message)
+}
+
+// do sends a request and returns the body of a 2xx reply. A non-nil patch
+// is sent as a strategic merge patch.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, patch any) ([]byte, error) {
+	u := c.Server + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var body io.Reader
+	if patch != nil {
+		data, err := json.Marshal(patch)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if patch != nil {
+		req.Header.Set("Content-Type", "application/strategic-merge-patch+json")
+	}
+	if c.token != nil {
+		token, err := c.token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("k8s: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("k8s: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		var status struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &status) != nil || status.Message == "" {
+			status.Message = strings.TrimSpace(string(data))
+		}
+		return nil, &APIError{Status: resp.StatusCode, Reason: status.Reason, Message: status.Message}
+	}
+	return data, nil
+}
+
+// get decodes the reply to a GET of path into out.
+func (c *Client) get(ctx context.Context, path string, query url.Values, out any) error {
+	data, err := c.do(ctx, http.MethodGet, path, query, nil)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("k8s: %s: %w", path, err)
+	}
+	return nil
+}
+
+// namespace is ns, or the client's namespace if ns is "".
+func (c *Client) namespace(ns string) string {
+	if ns == "" {
+		return c.Namespace
+	}
+	return ns
+}
@@ -0,0 +1,432 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/tools"
+)
+
+// MaxLogLines is the most log lines k8s_pod_logs returns.
+const MaxLogLines = 500
+
+// maxEvents is how many events, the newest, a listing shows.
+const maxEvents = 30
+
+// Pod is the part of a pod the tools show.
+type Pod struct {
+	Metadata struct {
+		Name              string     `json:"name"`
+		Namespace         string     `json:"namespace"`
+		CreationTimestamp time.Time  `json:"creationTimestamp"`
+		DeletionTimestamp *time.Time `json:"deletionTimestamp"`
+	} `json:"metadata"`
+	Spec struct {
+		NodeName   string `json:"nodeName"`
+		Containers []struct {
+			Name      string `json:"name"`
+			Image     string `json:"image"`
+			Resources struct {
+				Requests map[string]string `json:"requests"`
+				Limits   map[string]string `json:"limits"`
+			} `json:"resources"`
+		} `json:"containers"`
+	} `json:"spec"`
+	Status struct {
+		Phase      string `json:"phase"`
+		Reason     string `json:"reason"` // Evicted, NodeLost...
+		Message    string `json:"message"`
+		PodIP      string `json:"podIP"`
+		Conditions []struct {
+			Type    string `json:"type"`
+			Status  string `json:"status"`
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"conditions"`
+		InitContainerStatuses []ContainerStatus `json:"initContainerStatuses"`
+		ContainerStatuses     []ContainerStatus `json:"containerStatuses"`
+	} `json:"status"`
+}
+
+// ContainerStatus is the state of one container of a pod.
+type ContainerStatus struct {
+	Name         string         `json:"name"`
+	Ready        bool           `json:"ready"`
+	RestartCount int            `json:"restartCount"`
+	State        ContainerState `json:"state"`
+	LastState    ContainerState `json:"lastState"` // Of the run before the last restart
+}
+
+// ContainerState is one of waiting, running or terminated.
+type ContainerState struct {
+	Waiting *struct {
+		Reason  string `json:"reason"` // CrashLoopBackOff, ImagePullBackOff...
+		Message string `json:"message"`
+	} `json:"waiting"`
+	Running *struct {
+		StartedAt time.Time `json:"startedAt"`
+	} `json:"running"`
+	Terminated *struct {
+		Reason     string    `json:"reason"` // OOMKilled, Error, Completed
+		Message    string    `json:"message"`
+		ExitCode   int       `json:"exitCode"`
+		FinishedAt time.Time `json:"finishedAt"`
+	} `json:"terminated"`
+}
+
+// Event is a core/v1 event.
+type Event struct {
+	Metadata struct {
+		CreationTimestamp time.Time `json:"creationTimestamp"`
+	} `json:"metadata"`
+	InvolvedObject struct {
+		Kind string `json:"kind"`
+		Name string `json:"name"`
+	} `json:"involvedObject"`
+	Type          string    `json:"type"` // Normal, Warning
+	Reason        string    `json:"reason"`
+	Message       string    `json:"message"`
+	Count         int       `json:"count"`
+	LastTimestamp time.Time `json:"lastTimestamp"`
+	EventTime     time.Time `json:"eventTime"`
+}
+
+// Last is when the event was last seen: the API fills one of three fields.
+func (e Event) Last() time.Time {
+	for _, t := range []time.Time{e.LastTimestamp, e.EventTime, e.Metadata.CreationTimestamp} {
+		if !t.IsZero() {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Pods lists the pods of a namespace ("" for the client's), of all
+// namespaces if allNamespaces, matching selector ("app=api") if not "".
+func (c *Client) Pods(ctx context.Context, namespace, selector string, allNamespaces bool) ([]Pod, error) {
+	path := "/api/v1/namespaces/" + url.PathEscape(c.namespace(namespace)) + "/pods"
+	if allNamespaces {
+		path = "/api/v1/pods"
+	}
+	query := url.Values{}
+	if selector != "" {
+		query.Set("labelSelector", selector)
+	}
+	var list struct {
+		Items []Pod `json:"items"`
+	}
+	if err := c.get(ctx, path, query, &list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// Pod returns one pod.
+func (c *Client) Pod(ctx context.Context, namespace, name string) (Pod, error) {
+	var p Pod
+	err := c.get(ctx, "/api/v1/namespaces/"+url.PathEscape(c.namespace(namespace))+"/pods/"+url.PathEscape(name), nil, &p)
+	return p, err
+}
+
+// Events returns the events of a namespace, of the object named object if
+// not "", only warnings if warnings; the newest last.
+func (c *Client) Events(ctx context.Context, namespace, object string, warnings bool) ([]Event, error) {
+	var fields []string
+	if object != "" {
+		fields = append(fields, "involvedObject.name="+object)
+	}
+	if warnings {
+		fields = append(fields, "type=Warning")
+	}
+	query := url.Values{}
+	if len(fields) > 0 {
+		query.Set("fieldSelector", strings.Join(fields, ","))
+	}
+	var list struct {
+		Items []Event `json:"items"`
+	}
+	if err := c.get(ctx, "/api/v1/namespaces/"+url.PathEscape(c.namespace(namespace))+"/events", query, &list); err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(list.Items, func(a, b Event) int { return a.Last().Compare(b.Last()) })
+	return list.Items, nil
+}
+
+// Logs returns the last lines of a container of a pod (the only one if
+// container is ""), of its previous run if previous: the run that crashed.
+func (c *Client) Logs(ctx context.Context, namespace, pod, container string, lines int, previous bool) (string, error) {
+	query := url.Values{"tailLines": {fmt.Sprint(lines)}}
+	if container != "" {
+		query.Set("container", container)
+	}
+	if previous {
+		query.Set("previous", "true")
+	}
+	data, err := c.do(ctx, http.MethodGet, "/api/v1/namespaces/"+url.PathEscape(c.namespace(namespace))+"/pods/"+url.PathEscape(pod)+"/log", query, nil)
+	return string(data), err
+}
+
+// RolloutRestart restarts the pods of a deployment one by one, as kubectl
+// rollout restart does: by stamping the pod template, which starts a new
+// rollout.
+func (c *Client) RolloutRestart(ctx context.Context, namespace, deployment string, now time.Time) error {
+	patch := map[string]any{"spec": map[string]any{"template": map[string]any{"metadata": map[string]any{
+		"annotations": map[string]string{"kubectl.kubernetes.io/restartedAt": now.Format(time.RFC3339)},
+	}}}}
+	_, err := c.do(ctx, http.MethodPatch, "/apis/apps/v1/namespaces/"+url.PathEscape(c.namespace(namespace))+"/deployments/"+url.PathEscape(deployment), nil, patch)
+	return err
+}
+
+// Tools returns k8s_get_pods, k8s_describe_pod, k8s_get_events,
+// k8s_pod_logs and, unless readOnly, k8s_rollout_restart (Mutating) over c.
+func Tools(c *Client, readOnly bool) []tools.Tool {
+	getPods := tools.New("k8s_get_pods", "List the pods of a Kubernetes namespace: ready containers, status, restarts, age, node.", func(ctx context.Context, args struct {
+		Namespace     string `json:"namespace,omitempty" description:"Namespace (the default of the kubeconfig context if empty)"`
+		Selector      string `json:"selector,omitempty" description:"Label selector, e.g. app=api"`
+		AllNamespaces bool   `json:"all_namespaces,omitempty" description:"Pods of every namespace"`
+	}) (string, error) {
+		pods, err := c.Pods(ctx, args.Namespace, args.Selector, args.AllNamespaces)
+		if err != nil {
+			return "", err
+		}
+		if len(pods) == 0 {
+			return "No pods.", nil
+		}
+		now := time.Now()
+		var b strings.Builder
+		w := tabwriter.NewWriter(&b, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "NAMESPACE\tNAME\tREADY\tSTATUS\tRESTARTS\tAGE\tNODE")
+		for _, p := range pods {
+			ready, restarts := 0, 0
+			for _, cs := range p.Status.ContainerStatuses {
+				restarts += cs.RestartCount
+				if cs.Ready {
+					ready++
+				}
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d/%d\t%s\t%d\t%s\t%s\n", p.Metadata.Namespace, p.Metadata.Name, ready, len(p.Spec.Containers),
+				podStatus(p), restarts, age(now.Sub(p.Metadata.CreationTimestamp)), p.Spec.NodeName)
+		}
+		w.Flush()
+		return b.String(), nil
+	})
+	getPods.TTL = 30 * time.Second
+
+	type podArgs struct {
+		Namespace string `json:"namespace,omitempty" description:"Namespace (the default of the kubeconfig context if empty)"`
+		Pod       string `json:"pod" description:"Pod name"`
+	}
+	describePod := tools.New("k8s_describe_pod", "Describe a Kubernetes pod like kubectl describe: containers with their state, last state, restarts and limits, conditions, events.", func(ctx context.Context, args podArgs) (string, error) {
+		p, err := c.Pod(ctx, args.Namespace, args.Pod)
+		if err != nil {
+			return "", err
+		}
+		events, err := c.Events(ctx, p.Metadata.Namespace, p.Metadata.Name, false)
+		if err != nil {
+			return "", err
+		}
+		return describe(p, events, time.Now()), nil
+	})
+	describePod.TTL = 30 * time.Second
+
+	getEvents := tools.New("k8s_get_events", "List the events of a Kubernetes namespace, the newest last: scheduling, image pulls, probes, kills, scaling.", func(ctx context.Context, args struct {
+		Namespace string `json:"namespace,omitempty" description:"Namespace (the default of the kubeconfig context if empty)"`
+		Object    string `json:"object,omitempty" description:"Only the events of the object with this name (a pod, a deployment...)"`
+		Warnings  bool   `json:"warnings_only,omitempty" description:"Only Warning events"`
+	}) (string, error) {
+		events, err := c.Events(ctx, args.Namespace, args.Object, args.Warnings)
+		if err != nil {
+			return "", err
+		}
+		if len(events) == 0 {
+			return "No events.", nil
+		}
+		return formatEvents(events, time.Now(), true), nil
+	})
+
+	logs := tools.New("k8s_pod_logs", "Read the last lines of the logs of a Kubernetes pod; previous reads the run before the last restart (the one that crashed).", func(ctx context.Context, args struct {
+		Namespace string `json:"namespace,omitempty" description:"Namespace (the default of the kubeconfig context if empty)"`
+		Pod       string `json:"pod" description:"Pod name"`
+		Container string `json:"container,omitempty" description:"Container, if the pod has several"`
+		Lines     int    `json:"lines,omitempty" description:"How many lines from the end (default 100)" minimum:"1" maximum:"500"`
+		Previous  bool   `json:"previous,omitempty" description:"Logs of the previous run of the container"`
+	}) (string, error) {
+		if args.Lines == 0 {
+			args.Lines = 100
+		}
+		text, err := c.Logs(ctx, args.Namespace, args.Pod, args.Container, min(args.Lines, MaxLogLines), args.Previous)
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(text) == "" {
+			return "No log lines.", nil
+		}
+		return text, nil
+	})
+
+	list := []tools.Tool{getPods, describePod, getEvents, logs}
+	if readOnly {
+		return list
+	}
+	type restartArgs struct {
+		Namespace  string `json:"namespace,omitempty" description:"Namespace (the default of the kubeconfig context if empty)"`
+		Deployment string `json:"deployment" description:"Deployment name"`
+	}
+	restart := tools.New("k8s_rollout_restart", "Restart the pods of a Kubernetes deployment with a rolling update, like kubectl rollout restart.", func(ctx context.Context, args restartArgs) (string, error) {
+		if err := c.RolloutRestart(ctx, args.Namespace, args.Deployment, time.Now()); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("deployment.apps/%s restarted: new pods are rolling out (check them with k8s_get_pods).", args.Deployment), nil
+	})
+	restart.Mutating = true
+	restart.Preview = tools.PreviewOf(func(args restartArgs) string {
+		return fmt.Sprintf("kubectl rollout restart deployment/%s -n %s", args.Deployment, c.namespace(args.Namespace))
+	})
+	return append(list, restart)
+}
+
+// podStatus is the STATUS column of kubectl get pods: the reason of the
+// first container that isn't running, if any, else the phase.
+func podStatus(p Pod) string {
+	if p.Metadata.DeletionTimestamp != nil {
+		return "Terminating"
+	}
+	for _, cs := range p.Status.InitContainerStatuses {
+		if st := cs.State; st.Waiting != nil && st.Waiting.Reason != "" {
+			return "Init:" + st.Waiting.Reason
+		} else if st.Terminated != nil && st.Terminated.ExitCode != 0 {
+			return "Init:" + st.Terminated.Reason
+		}
+	}
+	for _, cs := range p.Status.ContainerStatuses {
+		if st := cs.State; st.Waiting != nil && st.Waiting.Reason != "" {
+			return st.Waiting.Reason
+		} else if st.Terminated != nil && st.Terminated.Reason != "" {
+			return st.Terminated.Reason
+		}
+	}
+	if p.Status.Reason != "" {
+		return p.Status.Reason
+	}
+	return p.Status.Phase
+}
+
+// describe renders a pod and its events like kubectl describe pod.
+func describe(p Pod, events []Event, now time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Name:         %s\nNamespace:    %s\nNode:         %s\nStatus:       %s\n", p.Metadata.Name, p.Metadata.Namespace, p.Spec.NodeName, podStatus(p))
+	if p.Status.Message != "" {
+		fmt.Fprintf(&b, "Message:      %s\n", p.Status.Message)
+	}
+	fmt.Fprintf(&b, "IP:           %s\nAge:          %s\nContainers:\n", p.Status.PodIP, age(now.Sub(p.Metadata.CreationTimestamp)))
+	for _, ct := range p.Spec.Containers {
+		fmt.Fprintf(&b, "  %s:\n    Image:          %s\n", ct.Name, ct.Image)
+		i := slices.IndexFunc(p.Status.ContainerStatuses, func(cs ContainerStatus) bool { return cs.Name == ct.Name })
+		if i >= 0 {
+			cs := p.Status.ContainerStatuses[i]
+			writeState(&b, "State:     ", cs.State)
+			writeState(&b, "Last State:", cs.LastState)
+			fmt.Fprintf(&b, "    Ready:          %t\n    Restart Count:  %d\n", cs.Ready, cs.RestartCount)
+		}
+		if len(ct.Resources.Limits) > 0 {
+			fmt.Fprintf(&b, "    Limits:         %s\n", resources(ct.Resources.Limits))
+		}
+		if len(ct.Resources.Requests) > 0 {
+			fmt.Fprintf(&b, "    Requests:       %s\n", resources(ct.Resources.Requests))
+		}
+	}
+	b.WriteString("Conditions:\n")
+	for _, cond := range p.Status.Conditions {
+		fmt.Fprintf(&b, "  %-16s %s", cond.Type, cond.Status)
+		if cond.Reason != "" {
+			fmt.Fprintf(&b, " (%s)", cond.Reason)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("Events:\n")
+	if len(events) == 0 {
+		b.WriteString("  <none>\n")
+	} else {
+		b.WriteString(formatEvents(events, now, false))
+	}
+	return b.String()
+}
+
+func writeState(b *strings.Builder, label string, st ContainerState) {
+	switch {
+	case st.Waiting != nil:
+		fmt.Fprintf(b, "    %s     Waiting\n      Reason:       %s\n", label, st.Waiting.Reason)
+		if st.Waiting.Message != "" {
+			fmt.Fprintf(b, "      Message:      %s\n", st.Waiting.Message)
+		}
+	case st.Running != nil:
+		fmt.Fprintf(b, "    %s     Running\n      Started:      %s\n", label, st.Running.StartedAt.Format(time.RFC3339))
+	case st.Terminated != nil:
+		fmt.Fprintf(b, "    %s     Terminated\n      Reason:       %s\n      Exit Code:    %d\n      Finished:     %s\n",
+			label, st.Terminated.Reason, st.Terminated.ExitCode, st.Terminated.FinishedAt.Format(time.RFC3339))
+		if st.Terminated.Message != "" {
+			fmt.Fprintf(b, "      Message:      %s\n", st.Terminated.Message)
+		}
+	}
+}
+
+// formatEvents renders the newest maxEvents events as a table, with the
+// object column if withObject.
+func formatEvents(events []Event, now time.Time, withObject bool) string {
+	var b strings.Builder
+	if len(events) > maxEvents {
+		fmt.Fprintf(&b, "(%d older events not shown)\n", len(events)-maxEvents)
+		events = events[len(events)-maxEvents:]
+	}
+	w := tabwriter.NewWriter(&b, 0, 0, 3, ' ', 0)
+	if withObject {
+		fmt.Fprintln(w, "LAST SEEN\tTYPE\tREASON\tOBJECT\tMESSAGE")
+	} else {
+		fmt.Fprintln(w, "  LAST SEEN\tTYPE\tREASON\tMESSAGE")
+	}
+	for _, e := range events {
+		seen := age(now.Sub(e.Last()))
+		if e.Count > 1 {
+			seen += fmt.Sprintf(" (x%d)", e.Count)
+		}
+		msg := strings.ReplaceAll(strings.TrimSpace(e.Message), "\n", " ")
+		if withObject {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s/%s\t%s\n", seen, e.Type, e.Reason, strings.ToLower(e.InvolvedObject.Kind), e.InvolvedObject.Name, msg)
+		} else {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", seen, e.Type, e.Reason, msg)
+		}
+	}
+	w.Flush()
+	return b.String()
+}
+
+// resources renders requests or limits: "cpu=500m, memory=256Mi".
+func resources(r map[string]string) string {
+	var parts []string
+	for _, k := range slices.Sorted(maps.Keys(r)) {
+		parts = append(parts, k+"="+r[k])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// age renders a duration the way kubectl does: 45s, 12m, 5h, 3d.
+func age(d time.Duration) string {
+	switch {
+	case d < 0:
+		return "0s"
+	case d < 2*time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < 2*time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
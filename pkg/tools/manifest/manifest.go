@@ -0,0 +1,414 @@
+// Package manifest reads tools from a YAML file, so a tool that is a
+// command or an HTTP endpoint needs no Go: its name, description,
+// parameters, what it runs and how risky it is.
+//
+//	# tools.yaml
+//	tools:
+//	  - name: disk_usage
+//	    description: Disk usage of a mount point
+//	    params:
+//	      path:
+//	        description: Mount point, e.g. /var
+//	    exec: [df, -h, "{{path}}"]
+//	  - name: restart_unit
+//	    description: Restart a systemd unit
+//	    risk: high                      # low (default), medium or high
+//	    timeout: 1m                     # Per call (default 30s)
+//	    params:
+//	      unit:
+//	        enum: [nginx, payment-service]
+//	    exec: [sudo, systemctl, restart, "{{unit}}"]
+//	  - name: service_status
+//	    description: Status of a service from the status API
+//	    params:
+//	      service:
+//	        description: Service name
+//	      verbose:
+//	        type: boolean               # string (default), integer, number or boolean
+//	        optional: true
+//	    http:
+//	      method: GET                   # GET (default), POST, PUT, DELETE
+//	      url: https://status.internal/api/services/{{service}}?verbose={{verbose}}
+//	      headers:
+//	        Authorization: Bearer ${STATUS_TOKEN}
+//
+//	ts, err := manifest.Load("tools.yaml")
+//	reg := tools.NewRegistry(ts...)
+//
+// A "{{param}}" is replaced by the argument. A command runs without a
+// shell, one argument per item, so an argument can't add a command; an
+// argument that starts with "-" is refused, so it can't add an option
+// either. A command that starts with "./" is relative to the file, and
+// runs in its directory. A request reaches only the host of its URL
+// (pkg/tools/web), whose host can't be a parameter; without a body
+// template, a POST or PUT sends the arguments as JSON. "${VAR}" in a
+// header is the environment variable, read when the file is loaded.
+//
+// Medium and high risk tools are Mutating: a supervised agent asks before
+// each call, and the approval prompt of a high risk one says so. A tool
+// with "once: true" runs once per run for the same arguments: a repeat
+// gets the first result (see tools.Tool.Once).
+package manifest
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/schema"
+	"github.com/kshvakov/agent/pkg/tools"
+	"github.com/kshvakov/agent/pkg/tools/web"
+	"github.com/kshvakov/agent/pkg/yaml"
+)
+
+// DefaultTimeout is the Tool.Timeout of a tool with no timeout.
+const DefaultTimeout = 30 * time.Second
+
+// maxOutput is how much of a command's output a result keeps.
+const maxOutput = 8 << 10
+
+// File is a tools.yaml.
+type File struct {
+	Tools []Spec `json:"tools"`
+}
+
+// Spec is one tool of the file: exactly one of Exec and HTTP.
+type Spec struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Risk        string            `json:"risk"`    // low (default), medium or high
+	Timeout     string            `json:"timeout"` // A duration; DefaultTimeout if empty
+	Once        bool              `json:"once"`    // A repeat in a run gets the first result (Tool.Once)
+	Params      map[string]*Param `json:"params"`
+	Exec        []string          `json:"exec"` // Command and arguments
+	HTTP        *HTTP             `json:"http"`
+}
+
+// Param is one parameter of a tool.
+type Param struct {
+	Type        string   `json:"type"` // string (default), integer, number or boolean
+	Description string   `json:"description"`
+	Enum        []string `json:"enum"` // Of a string
+	Minimum     *float64 `json:"minimum"`
+	Maximum     *float64 `json:"maximum"`
+	Optional    bool     `json:"optional"`
+}
+
+// HTTP is the request a tool sends.
+type HTTP struct {
+	Method  string            `json:"method"` // GET if empty
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"` // A template; the arguments as JSON if empty
+}
+
+// placeholder is a "{{param}}" of a template.
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_]+)\s*\}\}`)
+
+// validName is what the API accepts as a tool name.
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Load reads the tools of a file.
+func Load(path string) ([]tools.Tool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("manifest: %w", err)
+	}
+	var f File
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("manifest: %s: %w", path, err)
+	}
+	var ts []tools.Tool
+	for i, spec := range f.Tools {
+		t, err := spec.tool(filepath.Dir(path))
+		if err != nil {
+			return nil, fmt.Errorf("manifest: %s: tool %d (%s): %w", path, i+1, spec.Name, err)
+		}
+		if slices.ContainsFunc(ts, func(o tools.Tool) bool { return o.Name == t.Name }) {
+			return nil, fmt.Errorf("manifest: %s: tool %s is defined twice", path, t.Name)
+		}
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+// tool checks the spec and builds its tool; dir is the directory of the
+// file.
+func (s Spec) tool(dir string) (tools.Tool, error) {
+	if !validName.MatchString(s.Name) {
+		return tools.Tool{}, fmt.Errorf("name %q: letters, digits, _ and -, up to 64", s.Name)
+	}
+	if s.Description == "" {
+		return tools.Tool{}, fmt.Errorf("no description: it is all the model knows of the tool")
+	}
+	if (len(s.Exec) == 0) == (s.HTTP == nil) {
+		return tools.Tool{}, fmt.Errorf("want exactly one of exec and http")
+	}
+	timeout := DefaultTimeout
+	if s.Timeout != "" {
+		d, err := time.ParseDuration(s.Timeout)
+		if err != nil || d <= 0 {
+			return tools.Tool{}, fmt.Errorf("timeout %q: want a duration such as 30s", s.Timeout)
+		}
+		timeout = d
+	}
+	params, err := s.schema()
+	if err != nil {
+		return tools.Tool{}, err
+	}
+	t := tools.Tool{Name: s.Name, Description: s.Description, Params: params, Timeout: timeout, Once: s.Once}
+	var preview func(args map[string]any) string
+	if len(s.Exec) > 0 {
+		if placeholder.MatchString(s.Exec[0]) {
+			return tools.Tool{}, fmt.Errorf("exec %q: the command can't be a parameter", s.Exec[0])
+		}
+		if err := s.check(s.Exec...); err != nil {
+			return tools.Tool{}, err
+		}
+		t.Execute, preview = s.command(dir)
+	} else {
+		if err := s.check(s.HTTP.URL, s.HTTP.Body); err != nil {
+			return tools.Tool{}, err
+		}
+		if t.Execute, preview, err = s.request(timeout); err != nil {
+			return tools.Tool{}, err
+		}
+	}
+	switch s.Risk {
+	case "", "low":
+		t.Concurrency = 4
+	case "medium":
+		t.Mutating = true
+	case "high":
+		t.Mutating = true
+		prev := preview
+		preview = func(args map[string]any) string { return "HIGH RISK: " + prev(args) }
+	default:
+		return tools.Tool{}, fmt.Errorf("risk %q: want low, medium or high", s.Risk)
+	}
+	t.Preview = tools.PreviewOf(preview)
+	return t, nil
+}
+
+// schema returns the parameters of the spec as a JSON Schema.
+func (s Spec) schema() (*schema.Schema, error) {
+	obj := schema.Object().Strict()
+	for _, name := range slices.Sorted(func(yield func(string) bool) {
+		for k := range s.Params {
+			if !yield(k) {
+				return
+			}
+		}
+	}) {
+		p := s.Params[name]
+		if p == nil {
+			p = &Param{}
+		}
+		var ps *schema.Schema
+		switch p.Type {
+		case "", "string":
+			ps = schema.String(p.Description)
+			if len(p.Enum) > 0 {
+				ps = schema.Enum(p.Description, p.Enum...)
+			}
+		case "integer":
+			ps = schema.Integer(p.Description)
+		case "number":
+			ps = schema.Number(p.Description)
+		case "boolean":
+			ps = schema.Boolean(p.Description)
+		default:
+			return nil, fmt.Errorf("param %s: type %q: want string, integer, number or boolean", name, p.Type)
+		}
+		if len(p.Enum) > 0 && ps.Type != "string" {
+			return nil, fmt.Errorf("param %s: enum is for strings", name)
+		}
+		if p.Minimum != nil {
+			ps.Min(*p.Minimum)
+		}
+		if p.Maximum != nil {
+			ps.Max(*p.Maximum)
+		}
+		obj.Prop(name, ps)
+		if !p.Optional {
+			obj.Require(name)
+		}
+	}
+	return obj, nil
+}
+
+// check reports a placeholder of templates that is not a parameter.
+func (s Spec) check(templates ...string) error {
+	for _, tmpl := range templates {
+		for _, m := range placeholder.FindAllStringSubmatch(tmpl, -1) {
+			if _, ok := s.Params[m[1]]; !ok {
+				return fmt.Errorf("{{%s}} is not a parameter", m[1])
+			}
+		}
+	}
+	return nil
+}
+
+// fill replaces the placeholders of tmpl with the arguments, each through
+// escape; a missing optional argument is "".
+func fill(tmpl string, args map[string]any, escape func(string) string) string {
+	return placeholder.ReplaceAllStringFunc(tmpl, func(m string) string {
+		v, ok := args[placeholder.FindStringSubmatch(m)[1]]
+		if !ok {
+			return ""
+		}
+		switch v := v.(type) {
+		case string:
+			return escape(v)
+		case float64:
+			return escape(strconv.FormatFloat(v, 'f', -1, 64))
+		default:
+			return escape(fmt.Sprint(v))
+		}
+	})
+}
+
+func same(s string) string { return s }
+
+// fillURL fills a URL template: an argument is escaped as a path segment
+// before the "?" and as a query value after it, so it can't add either.
+func fillURL(tmpl string, args map[string]any) string {
+	path, query, ok := strings.Cut(tmpl, "?")
+	u := fill(path, args, url.PathEscape)
+	if ok {
+		u += "?" + fill(query, args, url.QueryEscape)
+	}
+	return u
+}
+
+// decode reads the arguments of a call; they are already validated.
+func decode(raw json.RawMessage) (map[string]any, error) {
+	var args map[string]any
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// argv returns the command line of a call: an item with a missing
+// optional argument is left out.
+func (s Spec) argv(dir string, args map[string]any) ([]string, error) {
+	var out []string
+	for i, item := range s.Exec {
+		if slices.ContainsFunc(placeholder.FindAllStringSubmatch(item, -1), func(m []string) bool {
+			_, ok := args[m[1]]
+			return !ok
+		}) {
+			continue
+		}
+		v := fill(item, args, same)
+		if placeholder.MatchString(item) && strings.HasPrefix(v, "-") && !strings.HasPrefix(item, "-") {
+			return nil, fmt.Errorf("argument %q starts with -: options can't come from arguments", v)
+		}
+		if i == 0 && strings.HasPrefix(v, "./") {
+			v = filepath.Join(dir, v)
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// command returns the Execute and the preview of an exec tool.
+func (s Spec) command(dir string) (func(context.Context, json.RawMessage) (string, error), func(map[string]any) string) {
+	execute := func(ctx context.Context, raw json.RawMessage) (string, error) {
+		args, err := decode(raw)
+		if err != nil {
+			return "", err
+		}
+		argv, err := s.argv(dir, args)
+		if err != nil {
+			return "", err
+		}
+		cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+		cmd.Dir = dir
+		cmd.WaitDelay = 5 * time.Second
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("%s: %w\n%s", argv[0], err, truncate(string(out)))
+		}
+		return truncate(string(out)), nil
+	}
+	preview := func(args map[string]any) string {
+		argv, err := s.argv(dir, args)
+		if err != nil {
+			return s.Name + ": " + err.Error()
+		}
+		for i, a := range argv {
+			if a == "" || strings.ContainsAny(a, " \t\"'$`\\|&;<>()*?") {
+				argv[i] = strconv.Quote(a)
+			}
+		}
+		return "$ " + strings.Join(argv, " ")
+	}
+	return execute, preview
+}
+
+// request returns the Execute and the preview of an http tool.
+func (s Spec) request(timeout time.Duration) (func(context.Context, json.RawMessage) (string, error), func(map[string]any) string, error) {
+	method := strings.ToUpper(cmp.Or(s.HTTP.Method, http.MethodGet))
+	if !slices.Contains([]string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}, method) {
+		return nil, nil, fmt.Errorf("http method %q: want GET, POST, PUT, PATCH or DELETE", s.HTTP.Method)
+	}
+	u, err := url.Parse(s.HTTP.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, nil, fmt.Errorf("http url %q: want http(s)://host/...", s.HTTP.URL)
+	}
+	if placeholder.MatchString(u.Host) {
+		return nil, nil, fmt.Errorf("http url %q: the host can't be a parameter", s.HTTP.URL)
+	}
+	host := strings.ToLower(u.Hostname())
+	header := http.Header{}
+	for name, value := range s.HTTP.Headers {
+		header.Set(name, os.ExpandEnv(value))
+	}
+	cfg := web.Config{Allow: []string{host}, Timeout: timeout, Headers: map[string]http.Header{host: header}}
+
+	execute := func(ctx context.Context, raw json.RawMessage) (string, error) {
+		args, err := decode(raw)
+		if err != nil {
+			return "", err
+		}
+		body := ""
+		switch {
+		case s.HTTP.Body != "":
+			body = fill(s.HTTP.Body, args, jsonEscape)
+		case method != http.MethodGet && method != http.MethodDelete:
+			body = string(raw)
+		}
+		return web.Do(ctx, cfg, method, fillURL(s.HTTP.URL, args), header.Get("Content-Type"), body)
+	}
+	preview := func(args map[string]any) string {
+		return method + " " + fillURL(s.HTTP.URL, args)
+	}
+	return execute, preview, nil
+}
+
+// jsonEscape escapes s for the inside of a JSON string.
+func jsonEscape(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data[1 : len(data)-1])
+}
+
+// truncate keeps the first maxOutput bytes of s.
+func truncate(s string) string {
+	if len(s) <= maxOutput {
+		return s
+	}
+	return s[:maxOutput] + fmt.Sprintf("\n... (%d more bytes)", len(s)-maxOutput)
+}
@@ -0,0 +1,357 @@
+// Package prom gives an agent the metrics of a Prometheus server:
+// prom_query runs a PromQL query, now or over a recent range, and returns
+// the series as lines the model can read.
+//
+//	c, err := prom.FromEnv() // PROMETHEUS_URL, PROMETHEUS_TOKEN
+//	reg := tools.NewRegistry(prom.Tool(c))
+//
+// A vector comes back as one line per series, "name{labels} value"; a
+// range as one line per series with its last, min and max values and a
+// few points in between, so an hour of a metric costs a line, not 240
+// samples. Any server with the Prometheus HTTP API works: Prometheus,
+// Thanos, Mimir, VictoriaMetrics.
+package prom
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/tools"
+)
+
+// DefaultMaxSeries is how many series a result shows when
+// Client.MaxSeries is 0.
+const DefaultMaxSeries = 20
+
+// Client queries one Prometheus server.
+type Client struct {
+	URL       string      // http://prometheus:9090, or the prefix of the API
+	Header    http.Header // Sent with every query: a bearer token, a tenant ID
+	MaxSeries int         // Series shown per result; DefaultMaxSeries if 0
+
+	http *http.Client
+}
+
+// APIError is an error the server returned: "bad_data" for a query that
+// doesn't parse, "timeout" or "execution" for one that is too heavy.
+type APIError struct {
+	Status  int
+	Type    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("prom: %d %s: %s", e.Status, e.Type, e.Message)
+}
+
+// New returns a client of the server at rawURL.
+func New(rawURL string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("prom: URL %q: want http(s)://host[:port]", rawURL)
+	}
+	return &Client{
+		URL:    strings.TrimSuffix(rawURL, "/"),
+		Header: http.Header{},
+		http:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// FromEnv returns a client of PROMETHEUS_URL that sends PROMETHEUS_TOKEN,
+// if set, as a bearer token.
+func FromEnv() (*Client, error) {
+	rawURL := os.Getenv("PROMETHEUS_URL")
+	if rawURL == "" {
+		return nil, errors.New("prom: PROMETHEUS_URL is not set")
+	}
+	c, err := New(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if token := os.Getenv("PROMETHEUS_TOKEN"); token != "" {
+		c.Header.Set("Authorization", "Bearer "+token)
+	}
+	return c, nil
+}
+
+// Point is one sample.
+type Point struct {
+	At    time.Time
+	Value float64
+}
+
+// Series is one labelled series: a single point for an instant query.
+type Series struct {
+	Metric map[string]string // Labels, with the name in "__name__"
+	Points []Point
+}
+
+// Result is what a query returned.
+type Result struct {
+	Type     string // vector, matrix, scalar or string
+	Series   []Series
+	Warnings []string
+}
+
+// Query evaluates query at the instant at, or now if at is zero.
+func (c *Client) Query(ctx context.Context, query string, at time.Time) (*Result, error) {
+	form := url.Values{"query": {query}}
+	if !at.IsZero() {
+		form.Set("time", unix(at))
+	}
+	return c.do(ctx, "/api/v1/query", form)
+}
+
+// QueryRange evaluates query from start to end, every step.
+func (c *Client) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration) (*Result, error) {
+	form := url.Values{
+		"query": {query},
+		"start": {unix(start)},
+		"end":   {unix(end)},
+		"step":  {strconv.FormatFloat(step.Seconds(), 'f', -1, 64)},
+	}
+	return c.do(ctx, "/api/v1/query_range", form)
+}
+
+func unix(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', -1, 64)
+}
+
+// do posts the query form to path and decodes the reply.
+func (c *Client) do(ctx context.Context, path string, form url.Values) (*Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("prom: %w", err)
+	}
+	for name, values := range c.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpClient := c.http
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("prom: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("prom: %w", err)
+	}
+	var reply struct {
+		Status    string   `json:"status"`
+		ErrorType string   `json:"errorType"`
+		Error     string   `json:"error"`
+		Warnings  []string `json:"warnings"`
+		Data      struct {
+			ResultType string          `json:"resultType"`
+			Result     json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &reply); err != nil {
+		return nil, &APIError{Status: resp.StatusCode, Type: "bad_response", Message: strings.TrimSpace(string(body[:min(len(body), 200)]))}
+	}
+	if reply.Status != "success" {
+		return nil, &APIError{Status: resp.StatusCode, Type: reply.ErrorType, Message: reply.Error}
+	}
+	res := &Result{Type: reply.Data.ResultType, Warnings: reply.Warnings}
+	switch res.Type {
+	case "vector", "matrix":
+		var series []struct {
+			Metric map[string]string `json:"metric"`
+			Value  []any             `json:"value"`
+			Values [][]any           `json:"values"`
+		}
+		if err := json.Unmarshal(reply.Data.Result, &series); err != nil {
+			return nil, fmt.Errorf("prom: %w", err)
+		}
+		for _, s := range series {
+			out := Series{Metric: s.Metric}
+			if s.Value != nil {
+				s.Values = append(s.Values, s.Value)
+			}
+			for _, v := range s.Values {
+				p, err := point(v)
+				if err != nil {
+					return nil, err
+				}
+				out.Points = append(out.Points, p)
+			}
+			res.Series = append(res.Series, out)
+		}
+	case "scalar", "string":
+		var v []any
+		if err := json.Unmarshal(reply.Data.Result, &v); err != nil {
+			return nil, fmt.Errorf("prom: %w", err)
+		}
+		p, err := point(v)
+		if err != nil && res.Type == "scalar" {
+			return nil, err
+		}
+		res.Series = []Series{{Points: []Point{p}}}
+		if res.Type == "string" && len(v) == 2 {
+			res.Series[0].Metric = map[string]string{"value": fmt.Sprint(v[1])}
+		}
+	}
+	return res, nil
+}
+
+// point decodes a [<unix seconds>, "<value>"] pair.
+func point(v []any) (Point, error) {
+	if len(v) != 2 {
+		return Point{}, fmt.Errorf("prom: bad sample %v", v)
+	}
+	at, ok := v[0].(float64)
+	s, ok2 := v[1].(string)
+	if !ok || !ok2 {
+		return Point{}, fmt.Errorf("prom: bad sample %v", v)
+	}
+	value, err := strconv.ParseFloat(s, 64) // "NaN" and "+Inf" too
+	if err != nil {
+		return Point{}, fmt.Errorf("prom: bad sample %v", v)
+	}
+	return Point{At: time.UnixMilli(int64(at * 1000)), Value: value}, nil
+}
+
+// Format renders r for the model: one line per series, the first
+// maxSeries of them in label order.
+func (r *Result) Format(maxSeries int) string {
+	var b strings.Builder
+	for _, w := range r.Warnings {
+		fmt.Fprintf(&b, "warning: %s\n", w)
+	}
+	switch {
+	case r.Type == "string":
+		fmt.Fprintf(&b, "%q\n", r.Series[0].Metric["value"])
+		return b.String()
+	case r.Type == "scalar":
+		fmt.Fprintf(&b, "scalar %s\n", value(r.Series[0].Points[0].Value))
+		return b.String()
+	case len(r.Series) == 0:
+		b.WriteString("(no series: the metric doesn't exist, or nothing matches the labels)\n")
+		return b.String()
+	}
+	series := slices.Clone(r.Series)
+	slices.SortFunc(series, func(a, b Series) int { return strings.Compare(labels(a.Metric), labels(b.Metric)) })
+	maxSeries = cmp.Or(maxSeries, DefaultMaxSeries)
+	for _, s := range series[:min(len(series), maxSeries)] {
+		if r.Type == "vector" && len(s.Points) == 1 {
+			fmt.Fprintf(&b, "%s %s\n", labels(s.Metric), value(s.Points[0].Value))
+			continue
+		}
+		fmt.Fprintf(&b, "%s %s\n", labels(s.Metric), summary(s.Points))
+	}
+	if len(series) > maxSeries {
+		fmt.Fprintf(&b, "... (%d more series: narrow the query by labels, or aggregate with sum by (...) or topk)\n", len(series)-maxSeries)
+	}
+	return b.String()
+}
+
+// labels renders a metric as PromQL writes it: name{a="b", c="d"}.
+func labels(metric map[string]string) string {
+	var parts []string
+	for _, k := range slices.Sorted(maps.Keys(metric)) {
+		if k != "__name__" {
+			parts = append(parts, fmt.Sprintf("%s=%q", k, metric[k]))
+		}
+	}
+	return metric["__name__"] + "{" + strings.Join(parts, ", ") + "}"
+}
+
+func value(v float64) string { return strconv.FormatFloat(v, 'g', 4, 64) }
+
+// summary renders the points of a range: the last, min and max values,
+// then up to 8 points spread over the range, in UTC.
+func summary(points []Point) string {
+	if len(points) == 0 {
+		return "(no points)"
+	}
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, p := range points {
+		if !math.IsNaN(p.Value) { // A gap: the target was down, or a division by 0
+			lo, hi = min(lo, p.Value), max(hi, p.Value)
+		}
+	}
+	if lo > hi { // Only gaps
+		lo, hi = math.NaN(), math.NaN()
+	}
+	first, last := points[0], points[len(points)-1]
+	var b strings.Builder
+	fmt.Fprintf(&b, "last %s, min %s, max %s (%d points):", value(last.Value), value(lo), value(hi), len(points))
+	layout := "15:04"
+	if first.At.UTC().YearDay() != last.At.UTC().YearDay() {
+		layout = "Jan 2 15:04"
+	}
+	const shown = 8
+	for i := range min(len(points), shown) {
+		p := points[i*(len(points)-1)/max(1, min(len(points), shown)-1)]
+		fmt.Fprintf(&b, " %s=%s", p.At.UTC().Format(layout), value(p.Value))
+	}
+	return b.String()
+}
+
+// parseRange reads a duration the way PromQL writes it: 30m, 2h, 1d.
+func parseRange(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("prom: bad range %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("prom: bad duration %q: want 30s, 15m, 2h or 1d", s)
+	}
+	return d, nil
+}
+
+// Tool returns prom_query over c.
+func Tool(c *Client) tools.Tool {
+	t := tools.New("prom_query", "Run a PromQL query on Prometheus ("+c.URL+"). Without range, the values now; with range (\"1h\"), how each series went over the last hour: last, min, max and a few points.", func(ctx context.Context, args struct {
+		Query string `json:"query" description:"PromQL, e.g. rate(http_requests_total{service=\"payments\",code=~\"5..\"}[5m])"`
+		Range string `json:"range,omitempty" description:"Look back this far: 15m, 1h, 1d (default: now only)"`
+		Step  string `json:"step,omitempty" description:"Resolution of a range (default: range/60)"`
+	}) (string, error) {
+		if args.Range == "" {
+			res, err := c.Query(ctx, args.Query, time.Time{})
+			if err != nil {
+				return "", err
+			}
+			return res.Format(c.MaxSeries), nil
+		}
+		span, err := parseRange(args.Range)
+		if err != nil {
+			return "", err
+		}
+		step := max(span/60, time.Second)
+		if args.Step != "" {
+			if step, err = parseRange(args.Step); err != nil {
+				return "", err
+			}
+		}
+		end := time.Now()
+		res, err := c.QueryRange(ctx, args.Query, end.Add(-span), end, step)
+		if err != nil {
+			return "", err
+		}
+		return res.Format(c.MaxSeries), nil
+	})
+	t.Concurrency = 4
+	return t
+}
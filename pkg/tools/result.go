@@ -0,0 +1,107 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Status of a Result.
+const (
+	StatusOK    = "ok"    // The tool ran; Data is what it found, good news or bad
+	StatusError = "error" // The tool couldn't do its job; Error says why
+)
+
+// Result is a tool result as the model reads it when results are
+// structured (agent.Config.StructuredResults): JSON that says whether the
+// tool failed, so "check_http ran and the service is down" and "check_http
+// couldn't connect" no longer read alike.
+//
+//	{"status":"ok","data":"HTTP 502 Bad Gateway"}
+//	{"status":"error","error":"dial tcp 10.0.0.5:443: connection refused","hint":"..."}
+//
+// Tools don't change for it: a tool's string becomes Data (as JSON if it
+// is a JSON object or array, see JSON), its error becomes Error, and a
+// Hint comes from the error (see WithHint).
+type Result struct {
+	Status string `json:"status"`
+	Data   any    `json:"data,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Hint   string `json:"hint,omitempty"` // What to do about the error
+}
+
+// OK returns the Result of a call that returned result.
+func OK(result string) Result {
+	trimmed := strings.TrimSpace(result)
+	if (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed)) {
+		return Result{Status: StatusOK, Data: json.RawMessage(trimmed)}
+	}
+	return Result{Status: StatusOK, Data: result}
+}
+
+// Failed returns the Result of a call that failed with err. The hint of
+// err, if it has one, moves from the message to Hint.
+func Failed(err error) Result {
+	msg, hint := err.Error(), HintOf(err)
+	if hint != "" {
+		msg = strings.TrimSpace(strings.Replace(msg, hint, "", 1))
+	}
+	return Result{Status: StatusError, Error: msg, Hint: hint}
+}
+
+// String returns r as JSON, the way the model gets it.
+func (r Result) String() string {
+	data, err := json.Marshal(r)
+	if err != nil { // Data that doesn't marshal: say so rather than lose the call
+		data, _ = json.Marshal(Result{Status: StatusError, Error: "result not serializable: " + err.Error()})
+	}
+	return string(data)
+}
+
+// JSON returns v as the string result of a tool, so a tool can hand over
+// fields instead of prose: with structured results it arrives as Data
+// unchanged.
+func JSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+// IsError reports whether content, a tool message, is a failed call: a
+// structured Result with status "error", or a plain "Error: ..." string.
+func IsError(content string) bool {
+	if strings.HasPrefix(content, "Error:") {
+		return true
+	}
+	var r Result
+	return strings.HasPrefix(content, "{") && json.Unmarshal([]byte(content), &r) == nil && r.Status == StatusError
+}
+
+// hinted is an error with a hint.
+type hinted struct {
+	err  error
+	hint string
+}
+
+func (e *hinted) Error() string { return e.err.Error() + " " + e.hint }
+func (e *hinted) Unwrap() error { return e.err }
+func (e *hinted) Hint() string  { return e.hint }
+
+// WithHint returns err with a hint for the model: "the service name is
+// the one inventory lists", "retry in a minute". The hint ends the
+// message, and is Result.Hint when results are structured.
+func WithHint(err error, hint string) error {
+	if err == nil {
+		return nil
+	}
+	return &hinted{err: err, hint: hint}
+}
+
+// HintOf returns the hint of err or of an error it wraps (see WithHint,
+// ArgumentsError, TimeoutError, PanicError), or "".
+func HintOf(err error) string {
+	var h interface{ Hint() string }
+	if errors.As(err, &h) {
+		return h.Hint()
+	}
+	return ""
+}
@@ -0,0 +1,253 @@
+// Package ssh gives an agent one dangerous tool, ssh_exec: a command on a
+// remote host, limited to the hosts and the commands a config file allows.
+//
+//	# ssh.yaml
+//	user: agent                      # Login user; ssh's default if empty
+//	identity: ~/.ssh/agent_ed25519   # Key; ssh's defaults and agent if empty
+//	timeout: 30s                     # Per command (default 30s)
+//	max_output: 16384                # Bytes of output kept (default 16 KB)
+//	hosts: [web-01, web-02]
+//	commands:                        # Allowed prefixes, whole words
+//	  - uptime
+//	  - df -h
+//	  - systemctl status
+//	  - journalctl -u nginx
+//	  - systemctl restart nginx $    # "$": this command exactly
+//
+//	cfg, err := ssh.LoadConfig("ssh.yaml")
+//	reg := tools.NewRegistry(ssh.Tool(cfg))
+//
+// A command is allowed if its first words are those of an allowed prefix:
+// "systemctl status nginx" is, "systemctl stop nginx" isn't. An entry
+// that ends in "$" allows that command and nothing after it: the agent can
+// restart nginx, but not "systemctl restart nginx postgresql". The remote
+// shell would run anything after a ";" or inside "$(...)", so a command
+// with shell syntax (; | & $ ` ( ) < > quotes, globs, backslashes, line
+// breaks) is refused whatever its prefix. The tool runs the system ssh
+// client in batch mode with strict host key checking: no password or
+// passphrase prompts, and a host must already be in known_hosts. ssh_exec
+// is Mutating, so a supervised agent asks before every command.
+package ssh
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/tools"
+	"github.com/kshvakov/agent/pkg/yaml"
+)
+
+// Defaults of Config.
+const (
+	DefaultTimeout   = 30 * time.Second
+	DefaultMaxOutput = 16 << 10
+)
+
+// ErrDenied is matched by the error of a call the config doesn't allow.
+var ErrDenied = errors.New("ssh: not allowed")
+
+// Config is the allowlist and how to connect.
+type Config struct {
+	User       string   `json:"user"`
+	Identity   string   `json:"identity"`    // Private key file
+	KnownHosts string   `json:"known_hosts"` // ssh's default if empty
+	Port       int      `json:"port"`        // 22 if 0
+	Timeout    string   `json:"timeout"`     // A duration; DefaultTimeout if empty
+	MaxOutput  int      `json:"max_output"`  // DefaultMaxOutput if 0
+	Hosts      []string `json:"hosts"`
+	Commands   []string `json:"commands"` // Allowed prefixes; one ending in "$" is a whole command
+}
+
+// LoadConfig reads and checks a config file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ssh: %w", err)
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("ssh: %s: %w", path, err)
+	}
+	if d, err := time.ParseDuration(cmp.Or(cfg.Timeout, DefaultTimeout.String())); err != nil || d <= 0 {
+		return nil, fmt.Errorf("ssh: %s: bad timeout %q", path, cfg.Timeout)
+	}
+	if len(cfg.Hosts) == 0 || len(cfg.Commands) == 0 {
+		return nil, fmt.Errorf("ssh: %s: hosts and commands must not be empty", path)
+	}
+	for _, h := range cfg.Hosts {
+		if h == "" || strings.HasPrefix(h, "-") || strings.ContainsAny(h, " \t") {
+			return nil, fmt.Errorf("ssh: %s: bad host %q", path, h)
+		}
+	}
+	for _, c := range cfg.Commands {
+		words, _ := strings.CutSuffix(strings.TrimSpace(c), "$")
+		if len(strings.Fields(words)) == 0 || !plain(words) {
+			return nil, fmt.Errorf("ssh: %s: bad command prefix %q: plain words only", path, c)
+		}
+	}
+	cfg.Identity, cfg.KnownHosts = home(cfg.Identity), home(cfg.KnownHosts)
+	return &cfg, nil
+}
+
+// Check returns an error matching ErrDenied unless cfg allows command on host.
+func (cfg *Config) Check(host, command string) error {
+	if !slices.Contains(cfg.Hosts, host) {
+		return fmt.Errorf("%w: host %q (allowed: %s)", ErrDenied, host, strings.Join(cfg.Hosts, ", "))
+	}
+	if !plain(command) {
+		return fmt.Errorf("%w: %q has shell syntax (; | & $ ` ( ) < > quotes, globs, backslashes); run one plain command", ErrDenied, command)
+	}
+	words := strings.Fields(command)
+	for _, entry := range cfg.Commands {
+		p, exact := strings.CutSuffix(strings.TrimSpace(entry), "$")
+		allowed := strings.Fields(p)
+		if exact && slices.Equal(words, allowed) ||
+			!exact && len(words) >= len(allowed) && slices.Equal(words[:len(allowed)], allowed) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q (allowed: %s)", ErrDenied, command, cfg.allowed())
+}
+
+// allowed lists the allowed commands for the model: a prefix ends in
+// "...", a whole command doesn't.
+func (cfg *Config) allowed() string {
+	var list []string
+	for _, entry := range cfg.Commands {
+		if p, exact := strings.CutSuffix(strings.TrimSpace(entry), "$"); exact {
+			list = append(list, strings.Join(strings.Fields(p), " "))
+		} else {
+			list = append(list, strings.Join(strings.Fields(p), " ")+" ...")
+		}
+	}
+	return strings.Join(list, "; ")
+}
+
+// plain reports whether s has no shell syntax: only letters, digits,
+// spaces and - _ . / : = , @ % +.
+func plain(s string) bool {
+	for _, r := range s {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == ' ':
+		case strings.ContainsRune("-_./:=,@%+", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Result is the outcome of a command that ran.
+type Result struct {
+	Output   string // stdout and stderr, at most Config.MaxOutput bytes
+	Dropped  int    // Bytes of output past MaxOutput
+	ExitCode int
+}
+
+// Exec runs command on host if cfg allows it. A command that ran and
+// failed is a Result with its ExitCode, not an error; an error is a call
+// that is denied, times out, or can't connect.
+func Exec(ctx context.Context, cfg *Config, host, command string) (Result, error) {
+	if err := cfg.Check(host, command); err != nil {
+		return Result{}, err
+	}
+	timeout, err := time.ParseDuration(cfg.Timeout)
+	if err != nil || timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	args := []string{"-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=yes", "-o", "ConnectTimeout=10"}
+	if cfg.User != "" {
+		args = append(args, "-l", cfg.User)
+	}
+	if cfg.Identity != "" {
+		args = append(args, "-i", cfg.Identity, "-o", "IdentitiesOnly=yes")
+	}
+	if cfg.KnownHosts != "" {
+		args = append(args, "-o", "UserKnownHostsFile="+cfg.KnownHosts)
+	}
+	if cfg.Port != 0 {
+		args = append(args, "-p", fmt.Sprint(cfg.Port))
+	}
+	cmd := exec.CommandContext(ctx, "ssh", append(args, "--", host, command)...)
+	cmd.WaitDelay = 5 * time.Second
+	out := &limitBuffer{max: cmp.Or(cfg.MaxOutput, DefaultMaxOutput)}
+	cmd.Stdout, cmd.Stderr = out, out
+
+	err = cmd.Run()
+	res := Result{Output: out.buf.String(), Dropped: out.dropped}
+	var exit *exec.ExitError
+	switch {
+	case err == nil:
+		return res, nil
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return res, fmt.Errorf("ssh %s: %q killed after %s\n%s", host, command, timeout, res.Output)
+	case errors.As(err, &exit) && exit.ExitCode() == 255:
+		// ssh's own failures: unreachable, unknown host key, auth refused.
+		return res, fmt.Errorf("ssh %s: connection failed: %s", host, strings.TrimSpace(res.Output))
+	case errors.As(err, &exit):
+		res.ExitCode = exit.ExitCode()
+		return res, nil
+	default:
+		return res, fmt.Errorf("ssh: %w", err)
+	}
+}
+
+// Tool returns ssh_exec over cfg. It is Mutating: an allowed command may
+// still restart or change something.
+func Tool(cfg *Config) tools.Tool {
+	type execArgs struct {
+		Host    string `json:"host" description:"Host to run the command on"`
+		Command string `json:"command" description:"One command without shell syntax (no ; | & $ quotes or globs)"`
+	}
+	t := tools.New("ssh_exec", fmt.Sprintf("Run a command on a remote host over SSH. Hosts: %s. Commands (\"...\": any arguments may follow): %s.",
+		strings.Join(cfg.Hosts, ", "), cfg.allowed()), func(ctx context.Context, args execArgs) (string, error) {
+		res, err := Exec(ctx, cfg, args.Host, args.Command)
+		if err != nil {
+			return "", err
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "exit status %d\n%s", res.ExitCode, res.Output)
+		if res.Dropped > 0 {
+			fmt.Fprintf(&b, "\n... (%d more bytes not kept)", res.Dropped)
+		}
+		return b.String(), nil
+	})
+	t.Mutating = true
+	t.Preview = tools.PreviewOf(func(args execArgs) string { return "ssh " + args.Host + " " + args.Command })
+	return t
+}
+
+// limitBuffer keeps the first max bytes written to it and counts the rest.
+type limitBuffer struct {
+	buf     bytes.Buffer
+	max     int
+	dropped int
+}
+
+func (w *limitBuffer) Write(p []byte) (int, error) {
+	keep := min(len(p), w.max-w.buf.Len())
+	w.buf.Write(p[:keep])
+	w.dropped += len(p) - keep
+	return len(p), nil
+}
+
+// home expands a leading ~/ to the home directory.
+func home(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if dir, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(dir, rest)
+		}
+	}
+	return path
+}
@@ -0,0 +1,49 @@
+package ssh
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ssh.yaml")
+	config := `hosts: [web-01]
+commands:
+  - uptime
+  - systemctl status
+  - systemctl restart nginx $    # this command exactly
+`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		host, command string
+		allowed       bool
+	}{
+		{"web-01", "uptime", true},
+		{"web-01", "systemctl status nginx", true},
+		{"web-01", "systemctl  restart   nginx", true},
+		{"web-01", "systemctl restart nginx postgresql", false},
+		{"web-01", "systemctl restart nginx --force", false},
+		{"web-01", "systemctl restart", false},
+		{"web-01", "systemctl stop nginx", false},
+		{"web-01", "uptime; reboot", false},
+		{"web-01", "systemctl status $(reboot)", false},
+		{"db-01", "uptime", false},
+	}
+	for _, tt := range tests {
+		err := cfg.Check(tt.host, tt.command)
+		if tt.allowed && err != nil {
+			t.Errorf("Check(%q, %q): %v, want it allowed", tt.host, tt.command, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrDenied) {
+			t.Errorf("Check(%q, %q) = %v, want ErrDenied", tt.host, tt.command, err)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+// Package tools is the tool registry shared by the labs: one Tool holds both
+// the definition the model sees and the function that runs, so the
+// []openai.Tool slice and the dispatch of ToolCalls come from the same place:
+//
+//	reg := tools.NewRegistry()
+//	reg.Register(tools.Tool{Name: "check_disk", Description: "Check current disk usage", Execute: checkDisk})
+//
+//	req.Tools = reg.Definitions()
+//	...
+//	for _, call := range msg.ToolCalls {
+//		result, err := reg.Dispatch(ctx, call)
+//	}
+//
+// Each runs the calls of one reply in parallel and keeps their order.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/schema"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Tool is one capability of an agent: what the model sees (name,
+// description, schema) and what runs when it is called.
+type Tool struct {
+	Name        string
+	Description string
+	Params      *schema.Schema // nil for tools without arguments
+
+	// Mutating marks tools that change the system (delete, restart, deploy).
+	// The agent loop sends their calls to a safety review first, if it has one.
+	Mutating bool
+
+	// TTL is how long a result of the tool stays true: "host is reachable"
+	// goes stale in a minute, a policy document in hours. The agent loop
+	// reuses a result while it is fresh and re-runs the call before a
+	// Mutating call relies on it. 0 means results are not tracked.
+	TTL time.Duration
+
+	// Once marks tools a repeated call of must not run again (delete_db,
+	// rollback_deploy): within one Run of the agent loop, a call with the
+	// idempotency key of an earlier one gets the earlier result instead of
+	// a second deletion. See IdempotencyKey.
+	Once bool
+
+	// IdempotencyKey returns the key of a call of a Once tool: a rollback
+	// is the same one whatever "reason" the model gives. nil means the
+	// arguments, compared as JSON values.
+	IdempotencyKey func(args json.RawMessage) string
+
+	// Timeout is how long one call may run. After it, Dispatch cancels
+	// the call's ctx and returns a *TimeoutError without waiting for the
+	// tool. 0 means no limit of its own.
+	Timeout time.Duration
+
+	// Concurrency is how many calls of the tool may run at once when the
+	// calls of one reply run in parallel (see Each): a rate-limited API
+	// gets 2, a worker agent 4. 0 means no limit of its own.
+	Concurrency int
+
+	// Preview renders a call for the human who approves it, as the
+	// command it amounts to ("systemctl restart payment-service",
+	// "DELETE FROM orders WHERE ... (~1200 rows)") rather than JSON
+	// arguments. nil means the name and arguments are shown as they are
+	// (see Registry.Preview).
+	Preview func(args json.RawMessage) string
+
+	// Execute runs the call. args are already validated against Params
+	// and are never empty ("{}" for a call without arguments). A tool
+	// that waits (on a process, a server, a worker agent) returns when
+	// ctx is done.
+	Execute func(ctx context.Context, args json.RawMessage) (string, error)
+}
+
+// New returns a tool whose arguments are decoded into Args. Params is
+// derived from the struct (see schema.For), so the schema the model sees
+// and the struct fn gets can't drift apart:
+//
+//	tools.New("ping", "Ping a host to check connectivity",
+//		func(ctx context.Context, args struct {
+//			Host string `json:"host" description:"Host to ping"`
+//		}) (string, error) {
+//			return ping(args.Host), nil
+//		})
+//
+// Set Mutating, Once, TTL, Concurrency or Preview on the result as needed.
+func New[Args any](name, description string, fn func(ctx context.Context, args Args) (string, error)) Tool {
+	return Tool{
+		Name:        name,
+		Description: description,
+		Params:      schema.For[Args](),
+		Execute: func(ctx context.Context, raw json.RawMessage) (string, error) {
+			var args Args
+			if err := json.Unmarshal(raw, &args); err != nil {
+				return "", fmt.Errorf("%s: %w", name, err)
+			}
+			return fn(ctx, args)
+		},
+	}
+}
+
+// PreviewOf returns a Tool.Preview whose arguments are decoded into Args,
+// like New does for Execute:
+//
+//	restart.Preview = tools.PreviewOf(func(args restartArgs) string {
+//		return "ssh " + args.Host + " sudo systemctl restart " + args.Service
+//	})
+//
+// Arguments that don't decode are shown as they are.
+func PreviewOf[Args any](fn func(args Args) string) func(json.RawMessage) string {
+	return func(raw json.RawMessage) string {
+		var args Args
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return string(raw)
+		}
+		return fn(args)
+	}
+}
+
+// Registry maps tool names to tools.
+type Registry struct {
+	tools map[string]Tool
+	order []string // Registration order, for a stable tool list
+}
+
+// NewRegistry returns a registry with the given tools.
+func NewRegistry(tools ...Tool) *Registry {
+	r := &Registry{tools: map[string]Tool{}}
+	for _, t := range tools {
+		r.Register(t)
+	}
+	return r
+}
+
+// Register adds a tool. Registering the same name again replaces it.
+func (r *Registry) Register(t Tool) {
+	if t.Params == nil {
+		t.Params = schema.Object()
+	}
+	if _, ok := r.tools[t.Name]; !ok {
+		r.order = append(r.order, t.Name)
+	}
+	r.tools[t.Name] = t
+}
+
+// Get returns the tool registered under name.
+func (r *Registry) Get(name string) (Tool, bool) {
+	t, ok := r.tools[name]
+	return t, ok
+}
+
+// Len returns the number of registered tools.
+func (r *Registry) Len() int {
+	return len(r.order)
+}
+
+// Names returns the names of registered tools in registration order.
+func (r *Registry) Names() []string {
+	return append([]string(nil), r.order...)
+}
+
+// Definitions returns the tool definitions sent to the model, in
+// registration order. It returns nil for an empty registry, so the
+// request carries no "tools" field at all.
+func (r *Registry) Definitions() []openai.Tool {
+	if len(r.order) == 0 {
+		return nil
+	}
+	defs := make([]openai.Tool, 0, len(r.order))
+	for _, name := range r.order {
+		t := r.tools[name]
+		defs = append(defs, openai.Tool{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
+			Name:        t.Name,
+			Description: t.Description,
+			Parameters:  t.Params,
+		}})
+	}
+	return defs
+}
+
+// Preview returns how call reads to a human: the tool's Preview of its
+// arguments, or, for a tool without one, its name and the arguments as
+// the model wrote them.
+func (r *Registry) Preview(call openai.ToolCall) string {
+	args := json.RawMessage(call.Function.Arguments)
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	if t, ok := r.tools[call.Function.Name]; ok && t.Preview != nil {
+		return t.Preview(args)
+	}
+	if string(args) == "{}" {
+		return call.Function.Name
+	}
+	return call.Function.Name + " " + string(args)
+}
+
+// ArgumentsError is returned by Dispatch when the arguments of a call don't
+// match the tool's schema. Its message is written for the model: every
+// problem on its own line, the parameters the tool takes, and what to do,
+// so the next call can fix all of it at once:
+//
+//	invalid arguments for send_email:
+//	- $.subject: is required
+//	- $.to: expected string, got number
+//	Parameters: {"type":"object","properties":{...},"required":["to","subject","body"]}
+//	Fix the arguments and call send_email again.
+type ArgumentsError struct {
+	Tool   string
+	Params *schema.Schema
+	Err    error // schema.Errors, or the JSON syntax error
+}
+
+func (e *ArgumentsError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid arguments for %s:\n", e.Tool)
+	if errs, ok := e.Err.(schema.Errors); ok {
+		for _, fe := range errs {
+			fmt.Fprintf(&b, "- %s\n", fe)
+		}
+	} else {
+		fmt.Fprintf(&b, "- %v\n", e.Err)
+	}
+	fmt.Fprintf(&b, "Parameters: %s\n", e.Params.Raw())
+	b.WriteString(e.Hint())
+	return b.String()
+}
+
+func (e *ArgumentsError) Unwrap() error { return e.Err }
+
+// Hint is the last line of the message, Result.Hint of the call.
+func (e *ArgumentsError) Hint() string {
+	return fmt.Sprintf("Fix the arguments and call %s again.", e.Tool)
+}
+
+// TimeoutError is returned by Dispatch for a call that ran longer than
+// its Tool.Timeout. The tool may still finish in the background, so what
+// it did is unknown, and the message tells the model so.
+type TimeoutError struct {
+	Tool  string
+	After time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s did not finish in %s and was canceled. %s", e.Tool, e.After, e.Hint())
+}
+
+func (e *TimeoutError) Unwrap() error { return context.DeadlineExceeded }
+
+func (e *TimeoutError) Hint() string {
+	return "What it did is unknown: check the state before you call it again."
+}
+
+// PanicError is returned by Dispatch for a call whose tool panicked. The
+// message is for the model; Stack is for whoever fixes the tool.
+type PanicError struct {
+	Tool  string
+	Value any
+	At    string // file:line of the panic
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s crashed (panic: %v at %s). %s", e.Tool, e.Value, e.At, e.Hint())
+}
+
+func (e *PanicError) Hint() string {
+	return "This is a bug in the tool, not in your arguments: the same call will crash again."
+}
+
+// Dispatch validates the arguments of call and runs the tool it names.
+// Unknown tools and invalid arguments (*ArgumentsError) are errors, just
+// like a failing tool; callers usually report all of them to the model as
+// the tool result, and the message tells the model how to correct the call.
+// A done ctx starts no tool: an interrupted run doesn't begin new actions.
+//
+// A tool that panics fails its call with a *PanicError instead of taking
+// the program down. Dispatch returns when ctx is done or the call's
+// Tool.Timeout is over (*TimeoutError), even if the tool doesn't: a tool
+// that ignores ctx runs on in the background, and its result is dropped.
+func (r *Registry) Dispatch(ctx context.Context, call openai.ToolCall) (string, error) {
+	t, ok := r.tools[call.Function.Name]
+	if !ok {
+		return "", fmt.Errorf("unknown tool %s; available tools: %s", call.Function.Name, strings.Join(r.order, ", "))
+	}
+	args := json.RawMessage(call.Function.Arguments)
+	if err := t.Params.Validate(args); err != nil {
+		return "", &ArgumentsError{Tool: t.Name, Params: t.Params, Err: err}
+	}
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	parent := ctx
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+	type outcome struct {
+		result string
+		err    error
+	}
+	done := make(chan outcome, 1) // Buffered: an abandoned call doesn't block
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				done <- outcome{err: &PanicError{Tool: t.Name, Value: v, At: panicSite(), Stack: debug.Stack()}}
+			}
+		}()
+		result, err := t.Execute(ctx, args)
+		done <- outcome{result, err}
+	}()
+	select {
+	case o := <-done:
+		if o.err != nil && parent.Err() == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", &TimeoutError{Tool: t.Name, After: t.Timeout}
+		}
+		return o.result, o.err
+	case <-ctx.Done():
+		if parent.Err() == nil {
+			return "", &TimeoutError{Tool: t.Name, After: t.Timeout}
+		}
+		return "", ctx.Err()
+	}
+}
+
+// panicSite returns the file:line a recovered panic was raised at: the
+// first frame outside the runtime.
+func panicSite() string {
+	pc := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pc[:runtime.Callers(3, pc)])
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, "runtime.") {
+			return filepath.Base(f.File) + ":" + strconv.Itoa(f.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+// Each runs fn for every call and returns the results in the order of
+// calls, whatever order they finish in. Up to parallel calls run at once
+// (1 or less: one after another), and no more than Tool.Concurrency calls
+// of one tool. A call of a Mutating or Once tool runs alone: the calls
+// before it finish first, the calls after it start when it is done, so an
+// action never races the checks around it, or a copy of itself.
+//
+// fn runs in its own goroutine when parallel > 1: whatever it touches
+// besides the call must be safe for concurrent use.
+func (r *Registry) Each(ctx context.Context, calls []openai.ToolCall, parallel int, fn func(context.Context, openai.ToolCall) string) []string {
+	results := make([]string, len(calls))
+	if parallel <= 1 {
+		for i, call := range calls {
+			results[i] = fn(ctx, call)
+		}
+		return results
+	}
+	slots := make(chan struct{}, parallel)
+	perTool := map[string]chan struct{}{}
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		t := r.tools[call.Function.Name]
+		if t.Mutating || t.Once {
+			wg.Wait()
+			results[i] = fn(ctx, call)
+			continue
+		}
+		limit := perTool[t.Name]
+		if limit == nil && t.Concurrency > 0 {
+			limit = make(chan struct{}, t.Concurrency)
+			perTool[t.Name] = limit
+		}
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if limit != nil {
+				limit <- struct{}{}
+				defer func() { <-limit }()
+			}
+			results[i] = fn(ctx, call)
+		}()
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,201 @@
+// Package toolserver serves tools over HTTP with the protocol of Lab 12,
+// and loads the tools of such a server into an agent:
+//
+//	// The server: the tools of a manifest, for every agent that asks.
+//	ts, err := manifest.Load("tools.yaml")
+//	http.ListenAndServe(":8080", toolserver.Handler(tools.NewRegistry(ts...), log.Printf))
+//
+//	// The agent: the server's tools, as if they were its own.
+//	ts, err := toolserver.Load(ctx, "http://tools:8080")
+//	reg := tools.NewRegistry(ts...)
+//
+// GET /tools lists the tools: name, version, description, the JSON
+// schema of the parameters and whether the tool is Mutating, so a
+// supervised agent reviews a remote restart as it would a local one.
+// POST /execute runs one:
+//
+//	{"tool": "check_status", "version": "1.0", "arguments": {"hostname": "web-1"}}
+//	{"success": true, "result": "Server is ONLINE"}
+//
+// A failed call is "success": false with the error for the model; an
+// HTTP error status means the request itself was wrong. This is the
+// reference transport of the lab, without its deprecated aliases: every
+// tool is version 1.0.
+package toolserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/schema"
+	"github.com/kshvakov/agent/pkg/tools"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Version is the version of every tool a Handler serves.
+const Version = "1.0"
+
+// maxRequest is the largest request body a Handler reads.
+const maxRequest = 1 << 20
+
+// Definition is a tool as GET /tools lists it.
+type Definition struct {
+	Name        string          `json:"name"`
+	Version     string          `json:"version"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"`
+	Mutating    bool            `json:"mutating,omitempty"`
+}
+
+// Request is the body of POST /execute.
+type Request struct {
+	Tool      string          `json:"tool"`
+	Version   string          `json:"version"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// Response is the answer to POST /execute.
+type Response struct {
+	Success bool   `json:"success"`
+	Result  string `json:"result"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Handler serves the tools of reg. Each call goes through reg.Dispatch,
+// so arguments are validated and timeouts apply as in the agent. logf,
+// if not nil, is told about every call.
+func Handler(reg *tools.Registry, logf func(format string, args ...any)) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /tools", func(w http.ResponseWriter, r *http.Request) {
+		var defs []Definition
+		for _, name := range reg.Names() {
+			t, _ := reg.Get(name)
+			defs = append(defs, Definition{
+				Name:        t.Name,
+				Version:     Version,
+				Description: t.Description,
+				Parameters:  t.Params.Raw(),
+				Mutating:    t.Mutating,
+			})
+		}
+		writeJSON(w, defs)
+	})
+	mux.HandleFunc("POST /execute", func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxRequest)).Decode(&req); err != nil {
+			http.Error(w, "toolserver: bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Version != "" && req.Version != Version {
+			writeJSON(w, Response{Error: fmt.Sprintf("tool %s: version %s is not compatible (the server has %s)", req.Tool, req.Version, Version)})
+			return
+		}
+		result, err := reg.Dispatch(r.Context(), openai.ToolCall{
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: req.Tool, Arguments: string(req.Arguments)},
+		})
+		if logf != nil {
+			status := "ok"
+			if err != nil {
+				status = "error: " + firstLine(err.Error())
+			}
+			logf("%s %s: %s", req.Tool, req.Arguments, status)
+		}
+		if err != nil {
+			writeJSON(w, Response{Error: err.Error()})
+			return
+		}
+		writeJSON(w, Response{Success: true, Result: result})
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// client is the HTTP client of the loaded tools. A call's own deadline
+// is its ctx (Tool.Timeout); this one only bounds a server that hangs.
+var client = &http.Client{Timeout: 5 * time.Minute}
+
+// Load returns the tools of the server at baseURL. Calling one posts to
+// the server; a server that is down fails the call, not the agent.
+func Load(ctx context.Context, baseURL string) ([]tools.Tool, error) {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/tools", nil)
+	if err != nil {
+		return nil, fmt.Errorf("toolserver: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("toolserver: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("toolserver: %s/tools: %s", baseURL, resp.Status)
+	}
+	var defs []Definition
+	if err := json.NewDecoder(resp.Body).Decode(&defs); err != nil {
+		return nil, fmt.Errorf("toolserver: %s/tools: %w", baseURL, err)
+	}
+	var ts []tools.Tool
+	for _, d := range defs {
+		params, err := schema.Parse(d.Parameters)
+		if err != nil {
+			return nil, fmt.Errorf("toolserver: tool %s: %w", d.Name, err)
+		}
+		ts = append(ts, tools.Tool{
+			Name:        d.Name,
+			Description: d.Description,
+			Params:      params,
+			Mutating:    d.Mutating,
+			Execute: func(ctx context.Context, args json.RawMessage) (string, error) {
+				return call(ctx, baseURL, Request{Tool: d.Name, Version: d.Version, Arguments: args})
+			},
+		})
+	}
+	return ts, nil
+}
+
+// call runs one tool on the server.
+func call(ctx context.Context, baseURL string, r Request) (string, error) {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/execute", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%s: tool server: %w", r.Tool, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("%s: tool server: %s: %s", r.Tool, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var out Response
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("%s: tool server: %w", r.Tool, err)
+	}
+	if !out.Success {
+		return "", errors.New(out.Error)
+	}
+	return out.Result, nil
+}
@@ -0,0 +1,98 @@
+package toolserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kshvakov/agent/pkg/tools"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestLoadedToolsRunOnTheServer(t *testing.T) {
+	restart := tools.New("restart_service", "Restart a service",
+		func(_ context.Context, args struct {
+			Service string `json:"service" description:"Service name"`
+		}) (string, error) {
+			return "restarted " + args.Service, nil
+		})
+	restart.Mutating = true
+	var calls []string
+	srv := httptest.NewServer(Handler(tools.NewRegistry(restart), func(format string, args ...any) {
+		calls = append(calls, format)
+	}))
+	defer srv.Close()
+
+	ts, err := Load(context.Background(), srv.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := tools.NewRegistry(ts...)
+	got, ok := reg.Get("restart_service")
+	if !ok || !got.Mutating || got.Description != "Restart a service" {
+		t.Fatalf("loaded %+v, want the server's restart_service, Mutating", got)
+	}
+
+	call := func(args string) (string, error) {
+		return reg.Dispatch(context.Background(), openai.ToolCall{
+			Function: openai.FunctionCall{Name: "restart_service", Arguments: args},
+		})
+	}
+	if result, err := call(`{"service": "payment"}`); err != nil || result != "restarted payment" {
+		t.Errorf("call = %q, %v; want the server's result", result, err)
+	}
+	// The schema came along: a bad call fails before it is sent.
+	if _, err := call(`{}`); err == nil || !strings.Contains(err.Error(), "service") {
+		t.Errorf("call without service: %v, want an arguments error", err)
+	}
+	if len(calls) != 1 {
+		t.Errorf("the server saw %d calls, want 1", len(calls))
+	}
+}
+
+func TestExecute(t *testing.T) {
+	srv := httptest.NewServer(Handler(tools.NewRegistry(tools.Tool{
+		Name: "check_status", Description: "Check server status",
+		Execute: func(context.Context, json.RawMessage) (string, error) { return "Server is ONLINE", nil },
+	}), nil))
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		want   Response
+	}{
+		{"call", `{"tool": "check_status", "version": "1.0", "arguments": {}}`, http.StatusOK, Response{Success: true, Result: "Server is ONLINE"}},
+		{"no version", `{"tool": "check_status"}`, http.StatusOK, Response{Success: true, Result: "Server is ONLINE"}},
+		{"other version", `{"tool": "check_status", "version": "2.0"}`, http.StatusOK, Response{Error: "tool check_status: version 2.0 is not compatible (the server has 1.0)"}},
+		{"unknown tool", `{"tool": "svc_restart", "version": "1.0"}`, http.StatusOK, Response{Error: "unknown tool svc_restart; available tools: check_status"}},
+		{"not JSON", `check_status`, http.StatusBadRequest, Response{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post(srv.URL+"/execute", "application/json", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status %d, want %d", resp.StatusCode, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var got Response
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
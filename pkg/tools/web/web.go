@@ -0,0 +1,205 @@
+// Package web gives an agent HTTP: http_get to probe a health endpoint or
+// read a status page, http_post (Mutating) to call an API. Both reach only
+// the hosts of an allowlist, also after a redirect, and return the status,
+// a few headers and the start of the body.
+//
+//	reg := tools.NewRegistry(web.Tools(web.Config{
+//		Allow: []string{"status.example.com", "*.internal.example.com"},
+//		Headers: map[string]http.Header{ // Sent by the tool; the model never sees them
+//			"api.internal.example.com": {"Authorization": {"Bearer " + os.Getenv("API_TOKEN")}},
+//		},
+//	})...)
+//
+// Credentials are set in Config.Headers, per host, not passed by the model:
+// what the model writes ends up in transcripts and traces. An
+// Authorization header that comes back in a body (an echo endpoint, a
+// debug page) is masked in the result (see redact.Authorization).
+package web
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/redact"
+	"github.com/kshvakov/agent/pkg/tools"
+)
+
+// Defaults of Config.
+const (
+	DefaultTimeout  = 10 * time.Second
+	DefaultMaxBytes = 4 << 10
+)
+
+// ErrDenied is matched by the error of a request to a host the allowlist
+// doesn't have.
+var ErrDenied = errors.New("web: host not allowed")
+
+// Config is what the tools may reach and how much they read.
+type Config struct {
+	// Allow lists the hosts: "api.example.com", or "*.example.com" for
+	// its subdomains. Empty allows every host.
+	Allow []string
+
+	Timeout  time.Duration // Per request, redirects included; DefaultTimeout if 0
+	MaxBytes int           // Of the body kept in the result; DefaultMaxBytes if 0
+
+	// Headers are added to the requests to a host, by host: credentials,
+	// an Accept header. They are not shown in the results.
+	Headers map[string]http.Header
+}
+
+// Check returns an error matching ErrDenied unless u is an http or https
+// URL of an allowed host.
+func (cfg Config) Check(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("web: %s: only http and https URLs", u.Redacted())
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return fmt.Errorf("web: %s: no host", u.Redacted())
+	}
+	if len(cfg.Allow) == 0 {
+		return nil
+	}
+	for _, a := range cfg.Allow {
+		a = strings.ToLower(a)
+		if suffix, ok := strings.CutPrefix(a, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return nil
+			}
+		} else if host == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s (allowed: %s)", ErrDenied, host, strings.Join(cfg.Allow, ", "))
+}
+
+// shownHeaders are the response headers a result shows: enough to tell a
+// redirect, a rate limit or a cache from the body.
+var shownHeaders = []string{"Content-Type", "Location", "Retry-After", "Cache-Control"}
+
+// Do sends a request and renders the response for the model. A response
+// with an error status is a result, not an error: a 503 is what a health
+// probe is for.
+func Do(ctx context.Context, cfg Config, method, rawURL, contentType, body string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("web: %w", err)
+	}
+	if err := cfg.Check(u); err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, cmp.Or(cfg.Timeout, DefaultTimeout))
+	defer cancel()
+	var reqBody io.Reader
+	if body != "" {
+		reqBody = strings.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reqBody)
+	if err != nil {
+		return "", fmt.Errorf("web: %w", err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", cmp.Or(contentType, "application/json"))
+	}
+	addHeaders(req, cfg)
+	client := &http.Client{CheckRedirect: func(next *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return errors.New("stopped after 5 redirects")
+		}
+		if err := cfg.Check(next.URL); err != nil {
+			return err
+		}
+		if next.URL.Hostname() != via[len(via)-1].URL.Hostname() {
+			// The client keeps the headers of the first request; the
+			// credentials of one host must not reach another.
+			for name := range cfg.Headers[strings.ToLower(via[0].URL.Hostname())] {
+				next.Header.Del(name)
+			}
+			addHeaders(next, cfg)
+		}
+		return nil
+	}}
+	resp, err := client.Do(req)
+	if errors.Is(err, ErrDenied) {
+		return "", fmt.Errorf("%w, redirected to by %s %s", unwrap(err), method, u.Redacted())
+	}
+	if err != nil {
+		return "", fmt.Errorf("web: %s %s: %w", method, u.Redacted(), unwrap(err))
+	}
+	defer resp.Body.Close()
+	limit := cmp.Or(cfg.MaxBytes, DefaultMaxBytes)
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+	if err != nil {
+		return "", fmt.Errorf("web: %s %s: reading the body: %w", method, u.Redacted(), err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s\n", resp.Proto, resp.Status)
+	if resp.Request.URL.String() != u.String() {
+		fmt.Fprintf(&b, "(redirected to %s)\n", resp.Request.URL.Redacted())
+	}
+	for _, h := range shownHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			fmt.Fprintf(&b, "%s: %s\n", h, v)
+		}
+	}
+	b.WriteString("\n")
+	if len(data) > limit {
+		fmt.Fprintf(&b, "%s\n... (truncated at %d bytes)", data[:limit], limit)
+	} else {
+		b.Write(data)
+	}
+	return redact.Authorization(b.String()), nil
+}
+
+// addHeaders sets the configured headers of req's host.
+func addHeaders(req *http.Request, cfg Config) {
+	for name, values := range cfg.Headers[strings.ToLower(req.URL.Hostname())] {
+		req.Header[http.CanonicalHeaderKey(name)] = slices.Clone(values)
+	}
+}
+
+// unwrap drops the *url.Error around err: its message repeats the URL.
+func unwrap(err error) error {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		return ue.Err
+	}
+	return err
+}
+
+// Tools returns http_get and http_post (Mutating) over cfg.
+func Tools(cfg Config) []tools.Tool {
+	hosts := "any host"
+	if len(cfg.Allow) > 0 {
+		hosts = strings.Join(cfg.Allow, ", ")
+	}
+	get := tools.New("http_get", "GET a URL ("+hosts+"): the status, a few headers and the start of the body. An error status is a result, not a failure.", func(ctx context.Context, args struct {
+		URL string `json:"url" description:"http:// or https:// URL"`
+	}) (string, error) {
+		return Do(ctx, cfg, http.MethodGet, args.URL, "", "")
+	})
+
+	type postArgs struct {
+		URL         string `json:"url" description:"http:// or https:// URL"`
+		Body        string `json:"body" description:"Request body"`
+		ContentType string `json:"content_type,omitempty" description:"Content-Type of the body (default application/json)"`
+	}
+	post := tools.New("http_post", "POST to a URL ("+hosts+"): the status, a few headers and the start of the body.", func(ctx context.Context, args postArgs) (string, error) {
+		return Do(ctx, cfg, http.MethodPost, args.URL, args.ContentType, args.Body)
+	})
+	post.Mutating = true
+	post.Preview = tools.PreviewOf(func(args postArgs) string {
+		return fmt.Sprintf("POST %s (%d bytes of %s)", args.URL, len(args.Body), cmp.Or(args.ContentType, "application/json"))
+	})
+	return []tools.Tool{get, post}
+}
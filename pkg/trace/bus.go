@@ -0,0 +1,251 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// --- Live events: in-process pub/sub and an SSE bridge ---
+//
+// A JSONL file is read after the run. A Bus hands the same events to
+// whoever watches the run while it goes: a TUI, a web page, a metrics
+// exporter. Each subscribes to one stream instead of tailing the file:
+//
+//	bus := trace.NewBus()
+//	tr := trace.Text(os.Stdout).Publish(bus)   // events go to both
+//	events, cancel := bus.Subscribe(64)
+//	defer cancel()
+//	go func() {
+//		for e := range events {
+//			fmt.Println(e.Name, e.Attrs["tool"])
+//		}
+//	}()
+//
+// Bus.ServeHTTP streams the events to browsers and curl as Server-Sent
+// Events. AGENT_EVENTS=<addr> does all of it for the labs (see FromEnv).
+
+// Event is one trace event as a subscriber sees it. It marshals to the
+// same JSON object as a line of the JSON log.
+type Event struct {
+	Time  time.Time
+	Level slog.Level
+	Name  string         // EventLLMRequest, EventToolCall, ...
+	Attrs map[string]any // step, tool, id, ... and the attrs of Logger.With
+}
+
+func (e Event) MarshalJSON() ([]byte, error) {
+	m := make(map[string]any, len(e.Attrs)+3)
+	for k, v := range e.Attrs {
+		m[k] = v
+	}
+	m[slog.TimeKey] = e.Time
+	m[slog.LevelKey] = e.Level.String()
+	m[slog.MessageKey] = e.Name
+	return json.Marshal(m)
+}
+
+// Bus fans events out to subscribers. Publishing never blocks the agent:
+// a subscriber that doesn't keep up loses the events its buffer can't
+// hold, and Dropped counts them. The zero Bus is not usable; use NewBus.
+type Bus struct {
+	mu      sync.Mutex
+	subs    map[chan Event]struct{}
+	dropped atomic.Int64
+}
+
+// NewBus returns a Bus without subscribers.
+func NewBus() *Bus {
+	return &Bus{subs: map[chan Event]struct{}{}}
+}
+
+// Subscribe returns a channel of the events published from now on, with
+// room for buffer events, and the function that unsubscribes and closes
+// the channel.
+func (b *Bus) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish sends e to every subscriber that has room for it.
+func (b *Bus) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			b.dropped.Add(1)
+		}
+	}
+}
+
+// Dropped returns how many events slow subscribers have lost.
+func (b *Bus) Dropped() int64 {
+	return b.dropped.Load()
+}
+
+// ServeHTTP streams events as Server-Sent Events until the client goes
+// away: "event: tool_call" and "data: {json}" per event.
+//
+//	curl -N http://localhost:7070/events
+func (b *Bus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	events, cancel := b.Subscribe(256)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	send := func(e Event) bool {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return true
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Name, data); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			// The server is shutting down at the end of the run: the
+			// last events (the final answer) are still sent.
+			for {
+				select {
+				case e := <-events:
+					if !send(e) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		case e := <-events:
+			if !send(e) {
+				return
+			}
+		}
+	}
+}
+
+// Serve serves the Bus at http://addr/events and returns the server, so
+// the caller can shut it down.
+func (b *Bus) Serve(addr string) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("trace: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/events", b)
+	// Shutdown ends the open streams too: they would never finish on
+	// their own.
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := &http.Server{Handler: mux, BaseContext: func(net.Listener) context.Context { return ctx }}
+	srv.RegisterOnShutdown(cancel)
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintln(os.Stderr, "trace: events server:", err)
+		}
+	}()
+	return srv, nil
+}
+
+// Publish returns a Logger that also publishes every event to b. On a nil
+// Logger it returns one that only publishes.
+func (l *Logger) Publish(b *Bus) *Logger {
+	var h slog.Handler = &busHandler{bus: b}
+	if l == nil {
+		return New(h)
+	}
+	return &Logger{log: slog.New(teeHandler{l.log.Handler(), h}), closer: l.closer}
+}
+
+// busHandler is the slog.Handler that turns records into Events.
+type busHandler struct {
+	bus   *Bus
+	attrs []slog.Attr // From WithAttrs
+	group string      // Key prefix from WithGroup
+}
+
+func (h *busHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *busHandler) Handle(_ context.Context, r slog.Record) error {
+	e := Event{Time: r.Time, Level: r.Level, Name: r.Message, Attrs: make(map[string]any, len(h.attrs)+r.NumAttrs())}
+	for _, a := range h.attrs {
+		e.Attrs[a.Key] = a.Value.Resolve().Any()
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		e.Attrs[h.group+a.Key] = a.Value.Resolve().Any()
+		return true
+	})
+	h.bus.Publish(e)
+	return nil
+}
+
+func (h *busHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		c.attrs = append(c.attrs, slog.Attr{Key: h.group + a.Key, Value: a.Value})
+	}
+	return &c
+}
+
+func (h *busHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.group = h.group + name + "."
+	return &c
+}
+
+// teeHandler sends every record to two handlers.
+type teeHandler struct{ a, b slog.Handler }
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return t.a.Enabled(ctx, level) || t.b.Enabled(ctx, level)
+}
+
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	if t.a.Enabled(ctx, r.Level) {
+		errs = append(errs, t.a.Handle(ctx, r.Clone()))
+	}
+	if t.b.Enabled(ctx, r.Level) {
+		errs = append(errs, t.b.Handle(ctx, r))
+	}
+	return errors.Join(errs...)
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return teeHandler{t.a.WithAttrs(attrs), t.b.WithAttrs(attrs)}
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	return teeHandler{t.a.WithGroup(name), t.b.WithGroup(name)}
+}
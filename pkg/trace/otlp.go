@@ -0,0 +1,289 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Spans, exported over OTLP ---
+//
+// Events tell what happened; spans tell what took how long inside what.
+// A Tracer records OpenTelemetry spans and sends them to a collector
+// (Jaeger, Tempo, the OTel Collector) over OTLP/HTTP with JSON encoding,
+// the one OTLP flavor that needs no generated code: the course stays on
+// the standard library. pkg/agent makes the spans when Config.Tracer is set:
+//
+//	invoke_agent                  one per Run
+//	├── agent.iteration           one per loop iteration
+//	│   ├── chat gpt-4o-mini      the LLM call: model, tokens
+//	│   └── execute_tool ping     one per tool call
+//	└── ...
+//
+// The context carries the current span, so a worker agent started from a
+// tool (Lab 08) lands inside the supervisor's trace.
+
+// Span kinds and status codes of OTLP.
+const (
+	kindInternal = 1
+	kindClient   = 3
+
+	statusOK    = 1
+	statusError = 2
+)
+
+// Tracer records spans and exports them when a trace's root span ends.
+// A nil *Tracer records nothing.
+type Tracer struct {
+	url     string
+	headers map[string]string
+	service string
+	client  *http.Client
+
+	mu       sync.Mutex
+	pending  []*Span
+	reported bool // An export error was printed already
+}
+
+// NewTracer returns a Tracer that posts spans of service to url, the full
+// OTLP traces URL ("http://localhost:4318/v1/traces").
+func NewTracer(url, service string) *Tracer {
+	return &Tracer{url: url, service: service, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// TracerFromEnv returns a Tracer configured by the standard OTel variables,
+// or nil if OTEL_EXPORTER_OTLP_ENDPOINT (or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT)
+// is not set:
+//
+//	OTEL_EXPORTER_OTLP_ENDPOINT         base URL; spans go to <base>/v1/traces
+//	OTEL_EXPORTER_OTLP_TRACES_ENDPOINT  full URL, used as is
+//	OTEL_EXPORTER_OTLP_HEADERS          "key=value,..." sent with every export
+//	OTEL_SERVICE_NAME                   overrides service
+//
+// Only the http/json protocol is spoken: point it at the collector's HTTP
+// port (4318), not the gRPC one.
+func TracerFromEnv(service string) *Tracer {
+	url := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if url == "" {
+		base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if base == "" {
+			return nil
+		}
+		url = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		service = name
+	}
+	t := NewTracer(url, service)
+	for _, kv := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			if t.headers == nil {
+				t.headers = map[string]string{}
+			}
+			t.headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return t
+}
+
+// Span is one timed operation. A nil *Span ignores every call.
+type Span struct {
+	tracer  *Tracer
+	traceID string
+	id      string
+	parent  string
+	name    string
+	kind    int
+	start   time.Time
+	end     time.Time
+	attrs   map[string]any
+	status  int
+	message string
+}
+
+type spanKey struct{}
+
+// SpanFromContext returns the current span of ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Start begins a span as a child of the current span of ctx (or a new
+// trace) and returns a context carrying it. attrs are key-value pairs:
+// Start(ctx, "execute_tool ping", "gen_ai.tool.name", "ping").
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...any) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	s := &Span{tracer: t, id: randomHex(8), name: name, kind: kindInternal, start: time.Now(), attrs: map[string]any{}}
+	if p := SpanFromContext(ctx); p != nil {
+		s.traceID, s.parent = p.traceID, p.id
+	} else {
+		s.traceID = randomHex(16)
+	}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		s.SetAttr(fmt.Sprint(attrs[i]), attrs[i+1])
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Client marks the span as a call to a remote service (an LLM API).
+func (s *Span) Client() *Span {
+	if s != nil {
+		s.kind = kindClient
+	}
+	return s
+}
+
+// SetAttr sets an attribute: a string, bool, integer or float.
+func (s *Span) SetAttr(key string, value any) {
+	if s != nil {
+		s.attrs[key] = value
+	}
+}
+
+// SetError marks the span failed. A nil err marks it successful.
+func (s *Span) SetError(err error) {
+	if s == nil {
+		return
+	}
+	if err != nil {
+		s.status, s.message = statusError, err.Error()
+	} else {
+		s.status, s.message = statusOK, ""
+	}
+}
+
+// End finishes the span. When a root span ends, its trace is exported.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	t := s.tracer
+	t.mu.Lock()
+	t.pending = append(t.pending, s)
+	t.mu.Unlock()
+	if s.parent == "" {
+		t.Flush(context.Background())
+	}
+}
+
+// Flush exports the finished spans. Export errors are printed to stderr
+// once: tracing must not break the run.
+func (t *Tracer) Flush(ctx context.Context) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	spans := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+	if err := t.export(ctx, spans); err != nil {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if !t.reported {
+			t.reported = true
+			fmt.Fprintf(os.Stderr, "trace: otlp export to %s: %v\n", t.url, err)
+		}
+	}
+}
+
+func (t *Tracer) export(ctx context.Context, spans []*Span) error {
+	var out []map[string]any
+	for _, s := range spans {
+		out = append(out, s.otlp())
+	}
+	body, err := json.Marshal(map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{"attributes": otlpAttrs(map[string]any{"service.name": t.service})},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "github.com/kshvakov/agent/pkg/agent"},
+				"spans": out,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
+
+// otlp renders the span in the OTLP/JSON mapping: hex IDs, times in
+// nanoseconds as strings.
+func (s *Span) otlp() map[string]any {
+	m := map[string]any{
+		"traceId":           s.traceID,
+		"spanId":            s.id,
+		"name":              s.name,
+		"kind":              s.kind,
+		"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+		"attributes":        otlpAttrs(s.attrs),
+	}
+	if s.parent != "" {
+		m["parentSpanId"] = s.parent
+	}
+	if s.status != 0 {
+		m["status"] = map[string]any{"code": s.status, "message": s.message}
+	}
+	return m
+}
+
+func otlpAttrs(attrs map[string]any) []map[string]any {
+	out := make([]map[string]any, 0, len(attrs))
+	for k, v := range attrs {
+		var value map[string]any
+		switch v := v.(type) {
+		case string:
+			value = map[string]any{"stringValue": v}
+		case bool:
+			value = map[string]any{"boolValue": v}
+		case int:
+			value = map[string]any{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]any{"doubleValue": v}
+		default:
+			value = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+		out = append(out, map[string]any{"key": k, "value": value})
+	}
+	return out
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
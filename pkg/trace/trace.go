@@ -0,0 +1,224 @@
+// Package trace logs the steps of an agent run as structured events
+// (log/slog), so a run can be read by a human and grepped or loaded by a
+// script alike:
+//
+//	llm_request   step, model, messages, tools, prompt_tokens, completion_tokens, duration
+//	tool_call     step, tool, id, args
+//	tool_result   step, tool, id, bytes, duration, result (error instead of result on failure)
+//	final_answer  step, answer
+//
+// step is the number of the LLM call in the agent's session: a tool call
+// and its result carry the step of the reply that asked for them. Every
+// event has a timestamp.
+//
+// pkg/agent emits the events when Config.Trace is set. Where they go is
+// chosen by AGENT_TRACE (see FromEnv): text on stdout by default, JSON
+// lines on stdout or in a file for later analysis.
+//
+// Consumers that watch a run live (a TUI, a web page, a metrics exporter)
+// subscribe to a Bus instead of tailing the file.
+//
+// The same steps can be recorded as OpenTelemetry spans and sent to a
+// collector: see Tracer.
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Event names.
+const (
+	EventLLMRequest  = "llm_request"
+	EventToolCall    = "tool_call"
+	EventToolResult  = "tool_result"
+	EventFinalAnswer = "final_answer"
+)
+
+// Logger emits the events of agent steps. A nil *Logger logs nothing, so
+// callers don't have to check.
+type Logger struct {
+	log    *slog.Logger
+	closer io.Closer // The file FromEnv opened, if any
+}
+
+// New returns a Logger writing to h.
+func New(h slog.Handler) *Logger {
+	return &Logger{log: slog.New(h)}
+}
+
+// Text returns a Logger writing human-readable lines to w.
+func Text(w io.Writer) *Logger {
+	return New(slog.NewTextHandler(w, nil))
+}
+
+// JSON returns a Logger writing one JSON object per event to w.
+func JSON(w io.Writer) *Logger {
+	return New(slog.NewJSONHandler(w, nil))
+}
+
+// FromEnv returns the Logger AGENT_TRACE asks for:
+//
+//	unset     text on stdout
+//	json      JSON lines on stdout
+//	off       nothing (nil Logger)
+//	<path>    JSON lines appended to the file
+//
+// With AGENT_EVENTS=<addr> (e.g. localhost:7070) the events are also
+// streamed live as Server-Sent Events at http://<addr>/events (see Bus),
+// whatever AGENT_TRACE says. Close the Logger when the run is over.
+func FromEnv() (*Logger, error) {
+	l, err := fromTraceEnv()
+	if err != nil {
+		return nil, err
+	}
+	addr := os.Getenv("AGENT_EVENTS")
+	if addr == "" {
+		return l, nil
+	}
+	bus := NewBus()
+	srv, err := bus.Serve(addr)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "trace: streaming events at http://%s/events\n", addr)
+	file := l.closerOrNil()
+	l = l.Publish(bus)
+	l.closer = closerFunc(func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		err := srv.Shutdown(ctx)
+		if file != nil {
+			err = errors.Join(err, file.Close())
+		}
+		return err
+	})
+	return l, nil
+}
+
+func fromTraceEnv() (*Logger, error) {
+	switch dest := os.Getenv("AGENT_TRACE"); dest {
+	case "":
+		return Text(os.Stdout), nil
+	case "json":
+		return JSON(os.Stdout), nil
+	case "off":
+		return nil, nil
+	default:
+		f, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("trace: %w", err)
+		}
+		l := JSON(f)
+		l.closer = f
+		return l, nil
+	}
+}
+
+// Close closes what FromEnv opened: the trace file, the events server.
+func (l *Logger) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+func (l *Logger) closerOrNil() io.Closer {
+	if l == nil {
+		return nil
+	}
+	return l.closer
+}
+
+// closerFunc adapts a function to io.Closer.
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+// With returns a Logger that adds attrs to every event, e.g.
+// With("agent", "NetworkAdmin") for the events of one worker.
+func (l *Logger) With(attrs ...any) *Logger {
+	if l == nil {
+		return nil
+	}
+	return &Logger{log: l.log.With(attrs...)}
+}
+
+// LLMRequest logs one LLM call: what was sent, what it cost, how long it
+// took. A failed call is logged at error level.
+func (l *Logger) LLMRequest(ctx context.Context, step int, req openai.ChatCompletionRequest, resp openai.ChatCompletionResponse, d time.Duration, err error) {
+	if l == nil {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.Int("step", step),
+		slog.String("model", req.Model),
+		slog.Int("messages", len(req.Messages)),
+		slog.Int("tools", len(req.Tools)),
+		slog.Duration("duration", d),
+	}
+	if err != nil {
+		l.log.LogAttrs(ctx, slog.LevelError, EventLLMRequest, append(attrs, slog.String("error", err.Error()))...)
+		return
+	}
+	attrs = append(attrs,
+		slog.Int("prompt_tokens", resp.Usage.PromptTokens),
+		slog.Int("completion_tokens", resp.Usage.CompletionTokens),
+	)
+	if len(resp.Choices) > 0 {
+		attrs = append(attrs, slog.Int("tool_calls", len(resp.Choices[0].Message.ToolCalls)))
+	}
+	l.log.LogAttrs(ctx, slog.LevelInfo, EventLLMRequest, attrs...)
+}
+
+// ToolCall logs a tool call before it runs.
+func (l *Logger) ToolCall(ctx context.Context, step int, call openai.ToolCall) {
+	if l == nil {
+		return
+	}
+	l.log.LogAttrs(ctx, slog.LevelInfo, EventToolCall,
+		slog.Int("step", step),
+		slog.String("tool", call.Function.Name),
+		slog.String("id", call.ID),
+		slog.String("args", call.Function.Arguments),
+	)
+}
+
+// ToolResult logs what a tool call returned, or its error (at warn level:
+// the model sees the error and may recover).
+func (l *Logger) ToolResult(ctx context.Context, step int, call openai.ToolCall, result string, d time.Duration, err error) {
+	if l == nil {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.Int("step", step),
+		slog.String("tool", call.Function.Name),
+		slog.String("id", call.ID),
+		slog.Int("bytes", len(result)),
+		slog.Duration("duration", d),
+	}
+	if err != nil {
+		l.log.LogAttrs(ctx, slog.LevelWarn, EventToolResult, append(attrs, slog.String("error", err.Error()))...)
+		return
+	}
+	l.log.LogAttrs(ctx, slog.LevelInfo, EventToolResult, append(attrs, slog.String("result", result))...)
+}
+
+// FinalAnswer logs the answer the run ended with.
+func (l *Logger) FinalAnswer(ctx context.Context, step int, answer string) {
+	if l == nil {
+		return
+	}
+	l.log.LogAttrs(ctx, slog.LevelInfo, EventFinalAnswer,
+		slog.Int("step", step),
+		slog.String("answer", answer),
+	)
+}
@@ -0,0 +1,324 @@
+// Package vecindex keeps embeddings on disk between runs, so a program
+// embeds its corpus (documents, tool descriptions, past tasks) once and
+// starts warm after that: only new or edited texts go to the model.
+//
+//	ix, err := vecindex.Open("kb.vec", string(openai.SmallEmbedding3))
+//	vecs, err := ix.Embed(ctx, client, texts) // asks the model for the missing ones
+//	err = ix.Save("kb.vec")
+//
+// A vector is found by the hash of its text: editing a document
+// re-embeds only what changed. The file records the embedding model
+// (see llm.EmbeddingModel), so switching models rebuilds the index
+// instead of comparing vectors that don't compare.
+//
+// # File format
+//
+// One file, little-endian, version 1:
+//
+//	offset  size        field
+//	0       4           magic "AGVI"
+//	4       4           format version
+//	8       4           dimensions d
+//	12      4           vectors n
+//	16      4           length of the model name m
+//	20      4           CRC-32 (IEEE) of everything after the header
+//	24      8           zero
+//	32      m           model name, zero-padded to a multiple of 64
+//	...     n*16        keys: the first 16 bytes of the SHA-256 of each text
+//	...                 zero padding to a multiple of 64
+//	...     n*d*4       vectors: float32, row i belongs to key i
+//
+// The vectors are one aligned, fixed-width block at the end, so a program
+// that maps the file (mmap) can use that block as a []float32 as is. This
+// package reads the whole file instead: for corpora the size of the labs'
+// that is as fast, and it needs nothing beyond the standard library.
+//
+// A file that fails a check (wrong magic or version, a checksum mismatch,
+// a size that doesn't add up) is not an error: Open starts an empty index
+// and says why in Rebuilt, and the next Save replaces the file.
+package vecindex
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	magic      = "AGVI"
+	version    = 1
+	headerSize = 32
+	keyLen     = 16
+	align      = 64
+
+	// batch is the number of texts per embedding request.
+	batch = 128
+)
+
+type key [keyLen]byte
+
+func keyOf(text string) key {
+	sum := sha256.Sum256([]byte(text))
+	return key(sum[:keyLen])
+}
+
+// Index is a set of embeddings of one model, by text. It is not safe for
+// concurrent use.
+type Index struct {
+	model string // Sent in requests
+	id    string // The model that answers them (llm.EmbeddingModel), recorded in the file
+	dim   int    // 0 until the first vector
+	keys  []key
+	vecs  []float32 // len(keys)*dim; row i is keys[i]
+	at    map[key]int
+	dirty bool
+
+	// Rebuilt says why the file was not used: another model, another
+	// format version, a failed integrity check. Empty if the file was
+	// used or there was none.
+	Rebuilt string
+}
+
+// Open reads the index at path, for vectors of model. A missing file, or
+// one that can't be used (see Rebuilt), gives an empty index; only a file
+// that can't be read is an error.
+func Open(path, model string) (*Index, error) {
+	ix := &Index{model: model, id: llm.EmbeddingModel(model), at: map[key]int{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ix, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("vecindex: %w", err)
+	}
+	if err := ix.decode(data); err != nil {
+		ix.reset(err.Error())
+	}
+	return ix, nil
+}
+
+// decode fills the index from the contents of a file.
+func (ix *Index) decode(data []byte) error {
+	le := binary.LittleEndian
+	if len(data) < headerSize || string(data[:4]) != magic {
+		return errors.New("not an index file")
+	}
+	if v := le.Uint32(data[4:]); v != version {
+		return fmt.Errorf("format version %d, want %d", v, version)
+	}
+	dim, n, m := int(le.Uint32(data[8:])), int(le.Uint32(data[12:])), int(le.Uint32(data[16:]))
+	keysAt := headerSize + padded(m)
+	vecsAt := padded(keysAt + n*keyLen)
+	if m > len(data) || n > len(data) || dim > len(data) || len(data) != vecsAt+n*dim*4 {
+		return fmt.Errorf("%d bytes, the header says %d vectors of %d dimensions", len(data), n, dim)
+	}
+	if crc32.ChecksumIEEE(data[headerSize:]) != le.Uint32(data[20:]) {
+		return errors.New("checksum mismatch")
+	}
+	if model := string(data[headerSize : headerSize+m]); model != ix.id {
+		return fmt.Errorf("built with %s, now %s", model, ix.id)
+	}
+	ix.dim = dim
+	ix.keys = make([]key, n)
+	for i := range ix.keys {
+		copy(ix.keys[i][:], data[keysAt+i*keyLen:])
+		ix.at[ix.keys[i]] = i
+	}
+	ix.vecs = make([]float32, n*dim)
+	for i := range ix.vecs {
+		ix.vecs[i] = math.Float32frombits(le.Uint32(data[vecsAt+i*4:]))
+	}
+	return nil
+}
+
+// padded rounds n up to a multiple of align.
+func padded(n int) int {
+	return (n + align - 1) / align * align
+}
+
+// reset empties the index, for the reason given.
+func (ix *Index) reset(reason string) {
+	ix.dim, ix.keys, ix.vecs, ix.at = 0, nil, nil, map[key]int{}
+	ix.dirty = true
+	ix.Rebuilt = reason
+}
+
+// Len returns the number of vectors in the index.
+func (ix *Index) Len() int {
+	return len(ix.keys)
+}
+
+// Lookup returns the vector of text, if the index has it.
+func (ix *Index) Lookup(text string) ([]float32, bool) {
+	i, ok := ix.at[keyOf(text)]
+	if !ok {
+		return nil, false
+	}
+	return ix.vecs[i*ix.dim : (i+1)*ix.dim : (i+1)*ix.dim], true
+}
+
+// Add puts the vector of text into the index. All vectors have the
+// dimensions of the first one.
+func (ix *Index) Add(text string, vec []float32) error {
+	if len(vec) == 0 {
+		return fmt.Errorf("vecindex: empty vector")
+	}
+	if ix.dim == 0 {
+		ix.dim = len(vec)
+	}
+	if len(vec) != ix.dim {
+		return fmt.Errorf("vecindex: a vector of %d dimensions in an index of %d", len(vec), ix.dim)
+	}
+	k := keyOf(text)
+	if i, ok := ix.at[k]; ok {
+		copy(ix.vecs[i*ix.dim:], vec)
+	} else {
+		ix.at[k] = len(ix.keys)
+		ix.keys = append(ix.keys, k)
+		ix.vecs = append(ix.vecs, vec...)
+	}
+	ix.dirty = true
+	return nil
+}
+
+// Embed returns the vectors of texts, in order. Texts the index lacks are
+// embedded by client and added. If the model answers with vectors of
+// other dimensions than the index holds (another backend behind the same
+// name, a failover), the index is rebuilt from texts.
+func (ix *Index) Embed(ctx context.Context, client llm.Provider, texts []string) ([][]float32, error) {
+	var missing []string
+	seen := map[key]bool{}
+	for _, t := range texts {
+		k := keyOf(t)
+		if _, ok := ix.at[k]; !ok && !seen[k] {
+			seen[k] = true
+			missing = append(missing, t)
+		}
+	}
+	for start := 0; start < len(missing); start += batch {
+		part := missing[start:min(start+batch, len(missing))]
+		resp, err := client.Embeddings(ctx, openai.EmbeddingRequest{Input: part, Model: openai.EmbeddingModel(ix.model)})
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Data) != len(part) {
+			return nil, fmt.Errorf("vecindex: %d embeddings for %d texts", len(resp.Data), len(part))
+		}
+		if d := len(resp.Data[0].Embedding); ix.dim != 0 && d != ix.dim {
+			ix.reset(fmt.Sprintf("the model answered with %d dimensions, the index had %d", d, ix.dim))
+			return ix.Embed(ctx, client, texts)
+		}
+		for i, e := range resp.Data {
+			j := i
+			if e.Index >= 0 && e.Index < len(part) {
+				j = e.Index
+			}
+			if err := ix.Add(part[j], e.Embedding); err != nil {
+				return nil, err
+			}
+		}
+	}
+	out := make([][]float32, len(texts))
+	for i, t := range texts {
+		out[i], _ = ix.Lookup(t)
+	}
+	return out, nil
+}
+
+// Retain drops the vectors of every text but texts: what a corpus no
+// longer has.
+func (ix *Index) Retain(texts []string) {
+	keep := map[key]bool{}
+	for _, t := range texts {
+		keep[keyOf(t)] = true
+	}
+	var keys []key
+	var vecs []float32
+	at := map[key]int{}
+	for i, k := range ix.keys {
+		if keep[k] {
+			at[k] = len(keys)
+			keys = append(keys, k)
+			vecs = append(vecs, ix.vecs[i*ix.dim:(i+1)*ix.dim]...)
+		}
+	}
+	if len(keys) != len(ix.keys) {
+		ix.keys, ix.vecs, ix.at, ix.dirty = keys, vecs, at, true
+	}
+}
+
+// Save writes the index to path if it changed since Open, atomically:
+// a run killed halfway leaves the old file.
+func (ix *Index) Save(path string) error {
+	if !ix.dirty {
+		return nil
+	}
+	le := binary.LittleEndian
+	n, m := len(ix.keys), len(ix.id)
+	keysAt := headerSize + padded(m)
+	vecsAt := padded(keysAt + n*keyLen)
+	data := make([]byte, vecsAt+len(ix.vecs)*4)
+	copy(data, magic)
+	le.PutUint32(data[4:], version)
+	le.PutUint32(data[8:], uint32(ix.dim))
+	le.PutUint32(data[12:], uint32(n))
+	le.PutUint32(data[16:], uint32(m))
+	copy(data[headerSize:], ix.id)
+	for i, k := range ix.keys {
+		copy(data[keysAt+i*keyLen:], k[:])
+	}
+	for i, v := range ix.vecs {
+		le.PutUint32(data[vecsAt+i*4:], math.Float32bits(v))
+	}
+	le.PutUint32(data[20:], crc32.ChecksumIEEE(data[headerSize:]))
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("vecindex: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("vecindex: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("vecindex: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("vecindex: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("vecindex: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("vecindex: %w", err)
+	}
+	ix.dirty = false
+	return nil
+}
+
+// Cosine returns the cosine similarity of a and b, 0 if either is zero.
+func Cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
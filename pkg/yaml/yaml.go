@@ -0,0 +1,350 @@
+// Package yaml reads the YAML that hand-written config files need,
+// without a YAML library: block mappings and sequences, "[a, b]" lists,
+// quoted and plain scalars, "|" and ">" block scalars (with "-" to strip
+// the final newline) and comments. Anchors, tags, flow mappings and
+// multi-document files are errors, not silently misread.
+//
+// The document is turned into JSON and decoded with encoding/json, so the
+// structs need only json tags, and an unknown key (a typo) is an error.
+// Team files (pkg/team), skills (pkg/skill) and lab00's model lists are
+// read with it.
+package yaml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Unmarshal decodes the YAML document data into v.
+func Unmarshal(data []byte, v any) error {
+	p := &yamlParser{lines: strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")}
+	for i, line := range p.lines {
+		if strings.HasPrefix(strings.TrimLeft(line, " "), "\t") {
+			return yamlError(i+1, "tabs are not allowed for indentation")
+		}
+	}
+	doc, err := p.document()
+	if err != nil {
+		return err
+	}
+	js, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.DisallowUnknownFields()
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+type yamlParser struct {
+	lines []string
+	i     int // The current line
+}
+
+// yamlError is an error at line n (1-based).
+func yamlError(n int, format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", n, fmt.Sprintf(format, args...))
+}
+
+func (p *yamlParser) document() (any, error) {
+	if p.next() && p.text() == "---" {
+		p.i++
+	}
+	if !p.next() {
+		return map[string]any{}, nil
+	}
+	if p.indent() != 0 {
+		return nil, yamlError(p.i+1, "the document must start at column 1")
+	}
+	v, err := p.block(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.next() {
+		return nil, yamlError(p.i+1, "unexpected indentation")
+	}
+	return v, nil
+}
+
+// next skips blank and comment lines and reports whether a line is left.
+func (p *yamlParser) next() bool {
+	for ; p.i < len(p.lines); p.i++ {
+		s := strings.TrimSpace(p.lines[p.i])
+		if s != "" && !strings.HasPrefix(s, "#") {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *yamlParser) indent() int {
+	line := p.lines[p.i]
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func (p *yamlParser) text() string {
+	return strings.TrimSpace(p.lines[p.i])
+}
+
+func isItem(s string) bool {
+	return s == "-" || strings.HasPrefix(s, "- ")
+}
+
+// block parses the mapping or sequence whose lines start at column ind.
+func (p *yamlParser) block(ind int) (any, error) {
+	if isItem(p.text()) {
+		return p.sequence(ind)
+	}
+	return p.mapping(ind)
+}
+
+func (p *yamlParser) mapping(ind int) (any, error) {
+	m := map[string]any{}
+	for p.next() && p.indent() >= ind {
+		n := p.i + 1
+		if p.indent() > ind {
+			return nil, yamlError(n, "unexpected indentation")
+		}
+		s := p.text()
+		if isItem(s) {
+			return nil, yamlError(n, "a list item where a key was expected")
+		}
+		key, rest, ok := cutKey(s)
+		if !ok {
+			return nil, yamlError(n, "expected \"key: value\", got %q", s)
+		}
+		if _, dup := m[key]; dup {
+			return nil, yamlError(n, "duplicate key %q", key)
+		}
+		v, err := p.value(ind, rest, true)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+func (p *yamlParser) sequence(ind int) (any, error) {
+	list := []any{}
+	for p.next() && p.indent() == ind && isItem(p.text()) {
+		rest := strings.TrimSpace(strings.TrimPrefix(p.text(), "-"))
+		if _, _, ok := cutKey(rest); ok && !strings.HasPrefix(rest, "\"") && !strings.HasPrefix(rest, "'") {
+			// "- key: value" starts a mapping at the column of the key:
+			// blank out the dash and parse the item as that mapping.
+			line := p.lines[p.i]
+			at := ind + 1 + len(line[ind+1:]) - len(strings.TrimLeft(line[ind+1:], " "))
+			p.lines[p.i] = strings.Repeat(" ", at) + line[at:]
+			v, err := p.mapping(at)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			continue
+		}
+		v, err := p.value(ind, rest, false)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+// value parses what follows "key:" or "-" on the current line of a block
+// at column ind: a scalar, a block scalar, or a nested block on the next
+// lines. A mapping's value may be a sequence at the mapping's own column.
+func (p *yamlParser) value(ind int, rest string, inMapping bool) (any, error) {
+	n := p.i + 1
+	rest = stripComment(rest)
+	p.i++
+	switch {
+	case strings.HasPrefix(rest, "|") || strings.HasPrefix(rest, ">"):
+		return p.blockScalar(n, ind, rest)
+	case rest != "":
+		return scalar(n, rest)
+	}
+	if !p.next() {
+		return nil, nil
+	}
+	switch {
+	case p.indent() > ind:
+		return p.block(p.indent())
+	case inMapping && p.indent() == ind && isItem(p.text()):
+		return p.sequence(ind)
+	}
+	return nil, nil
+}
+
+// blockScalar reads the lines of a "|" or ">" scalar, more indented than
+// ind, starting at the current line.
+func (p *yamlParser) blockScalar(n, ind int, header string) (any, error) {
+	style, chomp := header[0], header[1:]
+	if chomp != "" && chomp != "-" {
+		return nil, yamlError(n, "unsupported block scalar header %q (use %c or %c-)", header, style, style)
+	}
+	var lines []string
+	blockInd := -1
+	for ; p.i < len(p.lines); p.i++ {
+		line := p.lines[p.i]
+		if strings.TrimSpace(line) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		li := len(line) - len(strings.TrimLeft(line, " "))
+		if li <= ind {
+			break
+		}
+		if blockInd < 0 {
+			blockInd = li
+		}
+		if li < blockInd {
+			return nil, yamlError(p.i+1, "less indented than the first line of the block")
+		}
+		lines = append(lines, line[blockInd:])
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	var s string
+	if style == '|' {
+		s = strings.Join(lines, "\n")
+	} else {
+		// Folded: lines join with spaces, a blank line is a line break.
+		var b strings.Builder
+		for i, l := range lines {
+			switch {
+			case l == "":
+				b.WriteString("\n")
+			case i > 0 && lines[i-1] != "":
+				b.WriteString(" " + l)
+			default:
+				b.WriteString(l)
+			}
+		}
+		s = b.String()
+	}
+	if chomp == "" && s != "" {
+		s += "\n"
+	}
+	return s, nil
+}
+
+// cutKey splits "key: value" (or "key:") into the key and the rest.
+func cutKey(s string) (key, rest string, ok bool) {
+	if strings.HasSuffix(s, ":") && !strings.ContainsAny(s[:len(s)-1], ": ") {
+		return s[:len(s)-1], "", true
+	}
+	key, rest, ok = strings.Cut(s, ": ")
+	if !ok || key == "" || strings.ContainsAny(key, " \"'[]{}#") {
+		return "", "", false
+	}
+	return key, strings.TrimSpace(rest), true
+}
+
+// stripComment removes a " # comment" from a value outside quotes.
+func stripComment(s string) string {
+	quote := byte(0)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.ContainsRune("[, ", rune(s[i-1]))):
+			quote = c // Quotes open a value, not "don't"
+		case c == '#' && (i == 0 || s[i-1] == ' '):
+			return strings.TrimSpace(s[:i])
+		}
+	}
+	return strings.TrimSpace(s)
+}
+
+// scalar parses a one-line value: a quoted or plain scalar, or a "[...]"
+// list of them.
+func scalar(n int, s string) (any, error) {
+	switch {
+	case s == "{}":
+		return map[string]any{}, nil
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return nil, yamlError(n, "unterminated list %q", s)
+		}
+		list := []any{}
+		for _, item := range splitFlow(s[1 : len(s)-1]) {
+			if item == "" {
+				continue
+			}
+			if strings.HasPrefix(item, "[") || strings.HasPrefix(item, "{") {
+				return nil, yamlError(n, "nested lists and mappings in [...] are not supported")
+			}
+			v, err := scalar(n, item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case strings.HasPrefix(s, "{"), strings.HasPrefix(s, "&"), strings.HasPrefix(s, "*"), strings.HasPrefix(s, "!"):
+		return nil, yamlError(n, "flow mappings, anchors, aliases and tags are not supported: %q", s)
+	case strings.HasPrefix(s, "\""):
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, yamlError(n, "bad double-quoted string %s", s)
+		}
+		return v, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return nil, yamlError(n, "unterminated single-quoted string %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	switch s {
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	case "null", "Null", "NULL", "~":
+		return nil, nil
+	}
+	if number.MatchString(s) {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, yamlError(n, "bad number %s", s)
+		}
+		return json.Number(strconv.FormatFloat(f, 'f', -1, 64)), nil
+	}
+	return s, nil
+}
+
+var number = regexp.MustCompile(`^[-+]?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?$`)
+
+// splitFlow splits the inside of "[...]" at the commas outside quotes.
+func splitFlow(s string) []string {
+	var items []string
+	quote := byte(0)
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && strings.TrimSpace(s[start:i]) == "":
+			quote = c
+		case c == ',':
+			items = append(items, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(items, strings.TrimSpace(s[start:]))
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/yaml"
+)
+
+// --- Сравнение моделей (-models models.yaml) ---
+//
+// Выбор локальной модели — это прогон набора тестов против каждого кандидата
+// и сравнение отчётов на глаз. С -models это делает лаба: она прогоняет
+// набор против каждой модели из файла и печатает одну матрицу, по столбцу
+// на модель.
+
+// modelsFile — файл -models.
+type modelsFile struct {
+	Models []modelEntry `json:"models"`
+}
+
+// modelEntry — одна модель для проверки. Провайдер, модель и base URL становятся
+// переменными окружения, которые читает llm.FromEnv, как если бы их задали для
+// обычного запуска; env задаёт любые другие (API-ключи, LLAMACPP_GRAMMAR, ...).
+type modelEntry struct {
+	Name     string            `json:"name"`
+	Provider string            `json:"provider"`
+	Model    string            `json:"model"`
+	BaseURL  string            `json:"base_url"`
+	Env      map[string]string `json:"env"`
+}
+
+// baseURLVar — переменная, из которой каждый провайдер читает свой base URL.
+var baseURLVar = map[string]string{
+	"":          "OPENAI_BASE_URL",
+	"openai":    "OPENAI_BASE_URL",
+	"llamacpp":  "LLAMACPP_BASE_URL",
+	"llama.cpp": "LLAMACPP_BASE_URL",
+	"ollama":    "OLLAMA_HOST",
+	"anthropic": "ANTHROPIC_BASE_URL",
+}
+
+// environ возвращает переменные, которые надо задать для записи.
+func (m modelEntry) environ() (map[string]string, error) {
+	env := map[string]string{}
+	for k, v := range m.Env {
+		env[k] = v
+	}
+	if m.Provider != "" {
+		env["LLM_PROVIDER"] = m.Provider
+	}
+	if m.Model != "" {
+		env["LLM_MODEL"] = m.Model
+	}
+	if m.BaseURL != "" {
+		name, ok := baseURLVar[strings.ToLower(m.Provider)]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown provider %q (want openai, llamacpp, ollama or anthropic)", m.Name, m.Provider)
+		}
+		env[name] = m.BaseURL
+	}
+	return env, nil
+}
+
+// withEnv задаёт env на время run, а потом восстанавливает то, что было.
+func withEnv(env map[string]string, run func()) {
+	type saved struct {
+		value string
+		ok    bool
+	}
+	old := map[string]saved{}
+	for k, v := range env {
+		value, ok := os.LookupEnv(k)
+		old[k] = saved{value, ok}
+		os.Setenv(k, v)
+	}
+	defer func() {
+		for k, s := range old {
+			if s.ok {
+				os.Setenv(k, s.value)
+			} else {
+				os.Unsetenv(k)
+			}
+		}
+	}()
+	run()
+}
+
+// compareModels прогоняет набор против каждой модели из файла path
+// и печатает матрицу.
+func compareModels(ctx context.Context, path string, trials int) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var f modelsFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if len(f.Models) == 0 {
+		return fmt.Errorf("%s: no models", path)
+	}
+	for i, m := range f.Models {
+		if m.Name == "" {
+			f.Models[i].Name = m.Model
+		}
+		if f.Models[i].Name == "" {
+			return fmt.Errorf("%s: model %d has neither a name nor a model", path, i+1)
+		}
+	}
+
+	results := make([][]Rate, len(f.Models))
+	for i, m := range f.Models {
+		fmt.Printf("\n🔬 [%d/%d] %s\n", i+1, len(f.Models), m.Name)
+		env, err := m.environ()
+		if err != nil {
+			return err
+		}
+		withEnv(env, func() {
+			client, err := llm.FromEnv()
+			if err != nil {
+				fmt.Println("   ", err)
+				return
+			}
+			fmt.Printf("Endpoint: %v\n", client)
+			if results[i], err = runTrials(ctx, client, trials); err != nil {
+				fmt.Println("   ", err)
+			}
+		})
+	}
+	printMatrix(f.Models, results)
+	return nil
+}
+
+// contextSize находит окно в деталях пробы контекста.
+var contextSize = regexp.MustCompile(`taken whole: (\d+k)`)
+
+// printMatrix печатает по строке на тест и по столбцу на модель, а затем
+// модель, прошедшую больше всего тестов. С -trials в ячейке доля успехов,
+// и тест пройден, только если он прошёл каждый раз.
+func printMatrix(models []modelEntry, results [][]Rate) {
+	fmt.Println("\n📋 COMPARISON:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprint(w, "Test")
+	for _, m := range models {
+		fmt.Fprintf(w, "\t%s", m.Name)
+	}
+	fmt.Fprintln(w)
+
+	var names []string
+	for _, r := range results {
+		if len(r) > len(names) {
+			names = names[:0]
+			for _, t := range r {
+				names = append(names, t.Name)
+			}
+		}
+	}
+	passed := make([]int, len(models))
+	for row, name := range names {
+		fmt.Fprint(w, name)
+		for i, r := range results {
+			cell := "-" // Клиента не удалось создать
+			if row < len(r) {
+				cell = "❌"
+				switch {
+				case r[row].Stable():
+					cell = "✅"
+					passed[i]++
+				case r[row].Passes > 0:
+					cell = "⚠️"
+				}
+				if r[row].Trials > 1 {
+					cell += fmt.Sprintf(" %d/%d", r[row].Passes, r[row].Trials)
+				}
+				if m := contextSize.FindStringSubmatch(r[row].Last.Details); m != nil {
+					cell += " " + m[1]
+				}
+			}
+			fmt.Fprintf(w, "\t%s", cell)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprint(w, "Passed")
+	for i := range models {
+		fmt.Fprintf(w, "\t%d/%d", passed[i], len(names))
+	}
+	fmt.Fprintln(w)
+	w.Flush()
+
+	if len(names) == 0 {
+		fmt.Println("\n⚠️ No model could be reached.")
+		return
+	}
+	best := 0
+	for i := range models {
+		if passed[i] > passed[best] {
+			best = i
+		}
+	}
+	fmt.Printf("\n🏆 Most capable: %s (%d/%d). Details of every test are above, per model.\n", models[best].Name, passed[best], len(names))
+}
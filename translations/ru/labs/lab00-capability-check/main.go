@@ -3,10 +3,16 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"strings"
 
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/parse"
+	"github.com/kshvakov/agent/pkg/schema"
+	"github.com/kshvakov/agent/pkg/vecindex"
 	"github.com/sashabaranov/go-openai"
 )
 
@@ -17,16 +23,67 @@ type TestResult struct {
 }
 
 func main() {
-	token := os.Getenv("OPENAI_API_KEY")
-	if token == "" { token = "dummy" }
-	config := openai.DefaultConfig(token)
-	if baseURL := os.Getenv("OPENAI_BASE_URL"); baseURL != "" { config.BaseURL = baseURL }
-	client := openai.NewClientWithConfig(config)
+	models := flag.String("models", "", "YAML file with models to compare; runs the suite against each (see models.example.yaml)")
+	trials := flag.Int("trials", 1, "run every test this many times and report pass rates: local models are not deterministic")
+	flag.Parse()
+	if *trials < 1 {
+		fmt.Fprintln(os.Stderr, "-trials must be at least 1")
+		os.Exit(2)
+	}
 	ctx := context.Background()
 
+	if *models != "" {
+		if err := compareModels(ctx, *models, *trials); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// LLM_PROVIDER выбирает бэкенд: openai (любой OpenAI-совместимый сервер), llamacpp, ollama, anthropic.
+	client, err := llm.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
 	fmt.Println("🔬 Starting Model Capability Analysis...")
-	fmt.Printf("Endpoint: %s\n", config.BaseURL)
+	fmt.Printf("Endpoint: %v\n", client)
 
+	if *trials > 1 {
+		rates, err := runTrials(ctx, client, *trials)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		printRates(rates)
+		return
+	}
+	results := runSuite(ctx, client)
+
+	// REPORT
+	fmt.Println("\n📋 FINAL REPORT:")
+	allPassed := true
+	for _, r := range results {
+		icon := "✅"
+		if !r.Passed { 
+			icon = "❌" 
+			allPassed = false
+		}
+		fmt.Printf("%s %s\n   Details: %s\n", icon, r.Name, r.Details)
+	}
+
+	if allPassed {
+		fmt.Println("\n🎉 EXCELLENT! This model is ready for the course.")
+	} else if onlyEmbeddingsFailed(results) {
+		fmt.Println("\n🟡 ALMOST! The chat model is ready, but the endpoint has no usable embeddings: Lab 07 (-embeddings) and the plan history of Lab 10 need them. Set LLM_EMBEDDING_MODEL to an embedding model the server has (e.g. nomic-embed-text on Ollama).")
+	} else {
+		fmt.Println("\n⚠️ WARNING! This model has limitations. Some labs might fail.")
+	}
+}
+
+// runSuite прогоняет все тесты против client по порядку.
+func runSuite(ctx context.Context, client llm.Provider) []TestResult {
 	results := []TestResult{}
 
 	// TEST 1: Basic Sanity
@@ -45,38 +102,36 @@ func main() {
 	results = append(results, runTest(ctx, client, "3. JSON Generation", 
 		"Generate a JSON object with field 'status' set to 'ok'. Do not use markdown blocks.", 
 		func(response string) bool {
-			var js map[string]any
-			// Try to find JSON if wrapped in markdown
-			clean := strings.Trim(response, "`json \n")
-			return json.Unmarshal([]byte(clean), &js) == nil && js["status"] == "ok"
+			// Находит JSON, даже если модель всё-таки обернула его в markdown
+			js, err := parse.JSON[map[string]any]()(response)
+			return err == nil && js["status"] == "ok"
 		},
 	))
 
 	// TEST 4: Function Calling
 	results = append(results, runToolTest(ctx, client))
 
-	// REPORT
-	fmt.Println("\n📋 FINAL REPORT:")
-	allPassed := true
-	for _, r := range results {
-		icon := "✅"
-		if !r.Passed { 
-			icon = "❌" 
-			allPassed = false
-		}
-		fmt.Printf("%s %s\n   Details: %s\n", icon, r.Name, r.Details)
-	}
+	// TEST 5: JSON Mode (response_format), на который опираются планировщики и судьи Labs 10-13
+	results = append(results, runJSONModeTest(ctx, client))
 
-	if allPassed {
-		fmt.Println("\n🎉 EXCELLENT! This model is ready for the course.")
-	} else {
-		fmt.Println("\n⚠️ WARNING! This model has limitations. Some labs might fail.")
-	}
+	// TEST 6: Context Window, для -context-max из lab09
+	results = append(results, runContextProbe(ctx, client))
+
+	// TEST 7: Tool Chain: результат инструмента, от которого зависит следующий вызов, как в каждом цикле агента начиная с Lab 04
+	results = append(results, runToolChainTest(ctx, client))
+
+	// TEST 8: Embeddings, для базы знаний Lab 07 и истории планов Lab 10
+	results = append(results, runEmbeddingTest(ctx, client))
+
+	// TEST 9: Argument Schema Fidelity: вложенные, обязательные и enum-параметры, как у инструментов Labs 06-14
+	results = append(results, runSchemaFidelityTest(ctx, client))
+
+	return results
 }
 
-func runTest(ctx context.Context, client *openai.Client, name, prompt string, validator func(string) bool) TestResult {
+func runTest(ctx context.Context, client llm.Provider, name, prompt string, validator func(string) bool) TestResult {
 	fmt.Printf("Running %s...\n", name)
-	resp, err := client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+	resp, err := client.ChatCompletion(ctx, openai.ChatCompletionRequest{
 		Model: "gpt-4o-mini",
 		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: prompt}},
 		Temperature: 0,
@@ -93,7 +148,7 @@ func runTest(ctx context.Context, client *openai.Client, name, prompt string, va
 	return TestResult{name, passed, details}
 }
 
-func runToolTest(ctx context.Context, client *openai.Client) TestResult {
+func runToolTest(ctx context.Context, client llm.Provider) TestResult {
 	fmt.Println("Running 4. Function Calling...")
 	tools := []openai.Tool{
 		{
@@ -101,12 +156,12 @@ func runToolTest(ctx context.Context, client *openai.Client) TestResult {
 			Function: &openai.FunctionDefinition{
 				Name: "test_tool",
 				Description: "Call this tool to pass the test",
-				Parameters: json.RawMessage(`{"type": "object", "properties": {"foo": {"type": "string"}}}`),
+				Parameters:  schema.Object().Prop("foo", schema.String("")),
 			},
 		},
 	}
 
-	resp, err := client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+	resp, err := client.ChatCompletion(ctx, openai.ChatCompletionRequest{
 		Model: "gpt-4o-mini",
 		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "Call the test_tool please."}},
 		Tools: tools,
@@ -123,3 +178,338 @@ func runToolTest(ctx context.Context, client *openai.Client) TestResult {
 	return TestResult{"4. Function Calling", false, fmt.Sprintf("Model responded with text instead of tool: '%s'", resp.Choices[0].Message.Content)}
 }
 
+
+// runJSONModeTest просит структурированный ответ с ResponseFormat равным
+// json_object. В отличие от теста 3, ничего не прощается: ответ должен быть
+// одним JSON-объектом и ничем больше, без markdown-ограды, без прозы, с
+// запрошенными полями и типами. Labs 10-13 разбирают такие ответы как есть.
+func runJSONModeTest(ctx context.Context, client llm.Provider) TestResult {
+	const name = "5. JSON Mode (response_format)"
+	fmt.Printf("Running %s...\n", name)
+	prompt := "Describe a web server as a JSON object with the fields " +
+		"\"name\" (string), \"cpu_cores\" (integer) and \"tags\" (array of strings)."
+	resp, err := client.ChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:          "gpt-4o-mini",
+		Messages:       []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: prompt}},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+		Temperature:    0,
+	})
+	if err != nil {
+		return TestResult{name, false, fmt.Sprintf("API Error (the server may not support response_format): %v", err)}
+	}
+
+	content := resp.Choices[0].Message.Content
+	if strings.Contains(content, "```") {
+		return TestResult{name, false, fmt.Sprintf("Reply is wrapped in a markdown fence: '%s'", content)}
+	}
+	var answer struct {
+		Name     *string   `json:"name"`
+		CPUCores *int      `json:"cpu_cores"`
+		Tags     *[]string `json:"tags"`
+	}
+	dec := json.NewDecoder(strings.NewReader(content))
+	if err := dec.Decode(&answer); err != nil {
+		return TestResult{name, false, fmt.Sprintf("Not strict JSON (%v): '%s'", err, content)}
+	}
+	if dec.More() {
+		return TestResult{name, false, fmt.Sprintf("Text after the JSON object: '%s'", content)}
+	}
+	if answer.Name == nil || answer.CPUCores == nil || answer.Tags == nil {
+		return TestResult{name, false, fmt.Sprintf("Missing fields (want name, cpu_cores, tags): '%s'", content)}
+	}
+	return TestResult{name, true, fmt.Sprintf("Model returned strict JSON: '%s'", content)}
+}
+
+// probeSizes — размеры промпта в токенах, которые пробует проба контекста.
+var probeSizes = []int{2_000, 4_000, 8_000, 16_000}
+
+// runContextProbe отправляет всё более длинные дополненные промпты и сообщает
+// самый большой, который endpoint принимает целиком. Кодовое слово в самом
+// начале должно вернуться: Ollama, например, без ошибки обрезает промпт длиннее
+// своего num_ctx, и модель отвечает по промпту, начала которого не видела.
+// Lab 09 берёт свой -context-max отсюда, а не наугад.
+func runContextProbe(ctx context.Context, client llm.Provider) TestResult {
+	const name = "6. Context Window"
+	fmt.Printf("Running %s...\n", name)
+	largest, largestTokens := 0, 0
+	var stopped string
+	for _, size := range probeSizes {
+		code := fmt.Sprintf("PELICAN-%d", size)
+		resp, err := client.ChatCompletion(ctx, openai.ChatCompletionRequest{
+			Model:       "gpt-4o-mini",
+			Messages:    []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: probePrompt(code, size)}},
+			Temperature: 0,
+		})
+		if err != nil {
+			stopped = fmt.Sprintf("%dk: API Error: %v", size/1000, err)
+			break
+		}
+		if len(resp.Choices) == 0 || !strings.Contains(resp.Choices[0].Message.Content, code) {
+			stopped = fmt.Sprintf("%dk: accepted, but the start of the prompt was lost (truncated?)", size/1000)
+			break
+		}
+		largest, largestTokens = size, resp.Usage.PromptTokens
+		fmt.Printf("   %dk tokens: OK (%d by the server's count)\n", size/1000, largestTokens)
+	}
+	if stopped == "" {
+		stopped = "larger prompts not tried"
+	}
+	if largest == 0 {
+		return TestResult{name, false, fmt.Sprintf("Not even %dk tokens: %s", probeSizes[0]/1000, stopped)}
+	}
+	details := fmt.Sprintf("Largest prompt taken whole: %dk tokens (%d by the server's count); %s. Run lab09 with -context-max %d.",
+		largest/1000, largestTokens, stopped, largest)
+	// Lab 09 начинает сжатие на 80% своего окна: ему нужно 4k.
+	return TestResult{name, largest >= 4_000, details}
+}
+
+// probePrompt — примерно size токенов (по ~4 символа на токен) строк лога
+// между кодовым словом и вопросом о нём.
+func probePrompt(code string, size int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Remember the code word: %s.\n\nHere is a log to ignore:\n", code)
+	for i := 1; b.Len() < size*4; i++ {
+		fmt.Fprintf(&b, "%05d web-01 nginx: GET /health 200 0.002s\n", i)
+	}
+	b.WriteString("\nWhat was the code word at the start? Reply with the code word only.")
+	return b.String()
+}
+
+// chainRelease — версия, которую list_releases возвращает как предыдущую.
+// Её не угадать: откат на неё доказывает, что модель прочитала результат.
+const chainRelease = "v1.8.3-hotfix7"
+
+// runToolChainTest проверяет цикл, которого не проверяет тест 4: вызвать
+// инструмент, прочитать результат, сделать следующий вызов по тому, что он
+// сказал. Модель должна найти предыдущий релиз через list_releases, а затем
+// откатиться на него через rollback, не больше чем за chainSteps ответов.
+func runToolChainTest(ctx context.Context, client llm.Provider) TestResult {
+	const name = "7. Tool Chain (multi-turn)"
+	const chainSteps = 4
+	fmt.Printf("Running %s...\n", name)
+	tools := []openai.Tool{
+		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
+			Name:        "list_releases",
+			Description: "List the releases of a service, newest first",
+			Parameters:  schema.Object().Prop("service", schema.String("")).Require("service"),
+		}},
+		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
+			Name:        "rollback",
+			Description: "Roll a service back to a release",
+			Parameters: schema.Object().
+				Prop("service", schema.String("")).
+				Prop("version", schema.String("The release to roll back to, as list_releases shows it")).
+				Require("service", "version"),
+		}},
+	}
+	messages := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser,
+		Content: "The payment service is broken after its last release. Find the previous release with list_releases, then roll back to it with rollback."}}
+	listed := false
+	for step := 1; step <= chainSteps; step++ {
+		resp, err := client.ChatCompletion(ctx, openai.ChatCompletionRequest{
+			Model:       "gpt-4o-mini",
+			Messages:    messages,
+			Tools:       tools,
+			Temperature: 0,
+		})
+		if err != nil {
+			return TestResult{name, false, fmt.Sprintf("Step %d: API Error: %v", step, err)}
+		}
+		msg := resp.Choices[0].Message
+		if len(msg.ToolCalls) == 0 {
+			if !listed {
+				return TestResult{name, false, fmt.Sprintf("Model answered with text instead of calling list_releases: '%s'", msg.Content)}
+			}
+			return TestResult{name, false, fmt.Sprintf("Model stopped after the tool result instead of calling rollback: '%s'", msg.Content)}
+		}
+		messages = append(messages, msg)
+		for _, call := range msg.ToolCalls {
+			var result string
+			switch call.Function.Name {
+			case "list_releases":
+				listed = true
+				result = fmt.Sprintf("v1.9.0 (current, deployed 10 minutes ago)\n%s (previous)\nv1.8.2", chainRelease)
+			case "rollback":
+				var args struct {
+					Version string `json:"version"`
+				}
+				_ = json.Unmarshal([]byte(call.Function.Arguments), &args) // Кривой JSON оставляет Version пустым
+				switch {
+				case !listed:
+					return TestResult{name, false, fmt.Sprintf("Model called rollback before reading list_releases: %s", call.Function.Arguments)}
+				case args.Version != chainRelease:
+					return TestResult{name, false, fmt.Sprintf("Model rolled back to %q, the result said %q", args.Version, chainRelease)}
+				}
+				return TestResult{name, true, fmt.Sprintf("Model read the tool result and chained the next call in %d steps: rollback %s", step, call.Function.Arguments)}
+			default:
+				result = fmt.Sprintf("unknown tool %q", call.Function.Name)
+			}
+			messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleTool, ToolCallID: call.ID, Content: result})
+		}
+	}
+	return TestResult{name, false, fmt.Sprintf("No rollback after %d steps (list_releases called: %v)", chainSteps, listed)}
+}
+
+// embeddingTexts эмбеддит тест эмбеддингов: первый — дважды.
+var embeddingTexts = []string{
+	"The payment service returns 502 after the last deploy.",
+	"Rotate the TLS certificate of the load balancer.",
+}
+
+// runEmbeddingTest проверяет endpoint /embeddings, на который опираются RAG
+// и память: один вектор на текст, все одного размера, и тот же вектор для
+// того же текста во втором запросе. Векторный индекс, построенный в одном
+// запуске, ищется в следующем; если векторы плывут, ничего больше не находится.
+func runEmbeddingTest(ctx context.Context, client llm.Provider) TestResult {
+	const name = "8. Embeddings"
+	fmt.Printf("Running %s...\n", name)
+	embed := func(texts []string) ([][]float32, error) {
+		resp, err := client.Embeddings(ctx, openai.EmbeddingRequest{Input: texts, Model: openai.SmallEmbedding3})
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Data) != len(texts) {
+			return nil, fmt.Errorf("%d vectors for %d texts", len(resp.Data), len(texts))
+		}
+		vecs := make([][]float32, len(texts))
+		for _, d := range resp.Data {
+			if d.Index < 0 || d.Index >= len(texts) {
+				return nil, fmt.Errorf("vector with index %d for %d texts", d.Index, len(texts))
+			}
+			vecs[d.Index] = d.Embedding
+		}
+		return vecs, nil
+	}
+
+	first, err := embed(embeddingTexts)
+	if err != nil {
+		return TestResult{name, false, fmt.Sprintf("API Error: %v", err)}
+	}
+	dims := len(first[0])
+	for i, v := range first {
+		if len(v) == 0 || len(v) != dims {
+			return TestResult{name, false, fmt.Sprintf("Vector %d has %d dimensions, vector 1 has %d", i+1, len(v), dims)}
+		}
+	}
+	again, err := embed(embeddingTexts[:1])
+	if err != nil {
+		return TestResult{name, false, fmt.Sprintf("Second request: API Error: %v", err)}
+	}
+	if len(again[0]) != dims {
+		return TestResult{name, false, fmt.Sprintf("The same text got %d dimensions, then %d", dims, len(again[0]))}
+	}
+	// GPU не всегда складывают float в одном порядке: делаем поправку на округление.
+	if sim := vecindex.Cosine(first[0], again[0]); sim < 0.999 {
+		return TestResult{name, false, fmt.Sprintf("The same text got different vectors (cosine %.4f): an index built in one run won't match queries in the next", sim)}
+	}
+	return TestResult{name, true, fmt.Sprintf("%d dimensions, the same vector for the same text; similarity of two different texts: %.2f", dims, vecindex.Cosine(first[0], first[1]))}
+}
+
+// scaleSchema содержит то, что есть у настоящих инструментов и нет в тесте 4:
+// вложенный объект, обязательные поля, enum, целое с границами, массив
+// объектов. Каждый объект строгий, так что лишнее поле — тоже ошибка.
+var scaleSchema = schema.Object().
+	Prop("target", schema.Object().
+		Prop("service", schema.String("The service to scale")).
+		Prop("environment", schema.Enum("", "staging", "production")).
+		Require("service", "environment").Strict()).
+	Prop("replicas", schema.Integer("").Min(1).Max(20)).
+	Prop("strategy", schema.Enum("How to replace the pods", "rolling", "recreate")).
+	Prop("notify", schema.Array(schema.Object().
+		Prop("channel", schema.Enum("", "slack", "email", "pager")).
+		Prop("to", schema.String("Channel name or address")).
+		Require("channel", "to").Strict(), "Who to tell")).
+	Require("target", "replicas", "strategy", "notify").Strict()
+
+// fidelityPass — наименьшая точность, при которой тест пройден. pkg/agent
+// отправляет ошибки валидации модели на исправление: промах стоит хода, но
+// модель, которая упускает треть схемы, на ней зацикливается.
+const fidelityPass = 0.8
+
+// runSchemaFidelityTest просит один вызов инструмента с требовательной
+// схемой и оценивает аргументы: долю полей схемы, которые вышли верными.
+// Пропущенные поля, неверные типы, значения вне enum и поля, которых нет
+// в схеме, стоят по одному.
+func runSchemaFidelityTest(ctx context.Context, client llm.Provider) TestResult {
+	const name = "9. Argument Schema Fidelity"
+	fmt.Printf("Running %s...\n", name)
+	resp, err := client.ChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: "gpt-4o-mini",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser,
+			Content: "Scale the checkout service in production to 6 replicas with a rolling update, " +
+				"and notify the #payments Slack channel and oncall@example.com by email."}},
+		Tools: []openai.Tool{{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
+			Name:        "scale_deployment",
+			Description: "Scale a service to a number of replicas",
+			Parameters:  scaleSchema,
+		}}},
+		Temperature: 0,
+	})
+	if err != nil {
+		return TestResult{name, false, fmt.Sprintf("API Error: %v", err)}
+	}
+	calls := resp.Choices[0].Message.ToolCalls
+	if len(calls) == 0 {
+		return TestResult{name, false, fmt.Sprintf("Model responded with text instead of calling scale_deployment: '%s'", resp.Choices[0].Message.Content)}
+	}
+	args := calls[0].Function.Arguments
+	var errs schema.Errors
+	switch err := scaleSchema.Validate([]byte(args)); {
+	case errors.As(err, &errs):
+	case err != nil:
+		return TestResult{name, false, fmt.Sprintf("Fidelity 0%%: %v: %s", err, args)}
+	}
+
+	// Поля схемы и все лишние, которые добавила модель, — это то, из
+	// чего считается оценка.
+	fields := countFields(scaleSchema)
+	problems := map[string][]string{}
+	for _, e := range errs {
+		kind := "wrong value"
+		switch {
+		case e.Message == "is required":
+			kind = "missing"
+		case e.Message == "unknown property":
+			kind, fields = "extra", fields+1
+		case strings.HasPrefix(e.Message, "expected "):
+			kind = "wrong type"
+		}
+		problems[kind] = append(problems[kind], e.Path)
+	}
+	fidelity := max(0, float64(fields-len(errs))/float64(fields))
+	details := fmt.Sprintf("Fidelity %.0f%% (%d of %d fields right)", fidelity*100, fields-min(len(errs), fields), fields)
+	for _, kind := range []string{"missing", "wrong type", "wrong value", "extra"} {
+		if len(problems[kind]) > 0 {
+			details += fmt.Sprintf("; %s: %s", kind, strings.Join(problems[kind], ", "))
+		}
+	}
+	return TestResult{name, fidelity >= fidelityPass, details + ": " + args}
+}
+
+// countFields считает свойства s и объектов в нём; элементы массива
+// считаются один раз.
+func countFields(s *schema.Schema) int {
+	n := 0
+	for _, p := range s.Properties {
+		n++
+		if p.Items != nil {
+			p = p.Items
+		}
+		n += countFields(p)
+	}
+	return n
+}
+
+// onlyEmbeddingsFailed сообщает, единственный ли упавший тест — тест
+// эмбеддингов: тогда чат-лабы будут работать.
+func onlyEmbeddingsFailed(results []TestResult) bool {
+	failed := 0
+	embeddings := false
+	for _, r := range results {
+		if !r.Passed {
+			failed++
+			embeddings = embeddings || strings.HasPrefix(r.Name, "8. Embeddings")
+		}
+	}
+	return failed == 1 && embeddings
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kshvakov/agent/pkg/llm"
+)
+
+// --- Доля успехов (-trials N) ---
+//
+// Локальная модель не отвечает на один и тот же промпт одинаково дважды, даже
+// при температуре 0: батчинг и арифметика GPU меняют шансы. Тест, пройденный
+// однажды, может упасть на следующем запуске, а в лабе важен именно этот
+// запуск. С -trials набор прогоняется N раз, и каждый тест получает долю
+// успехов, а не вердикт по одной попытке.
+
+// Rate — результат теста за несколько попыток.
+type Rate struct {
+	Name   string
+	Passes int
+	Trials int
+	Last   TestResult // Последний провал или последний запуск, если провалов не было
+}
+
+// Stable сообщает, прошёл ли тест каждый раз.
+func (r Rate) Stable() bool { return r.Passes == r.Trials }
+
+func (r Rate) String() string {
+	return fmt.Sprintf("%d/%d (%.0f%%)", r.Passes, r.Trials, 100*float64(r.Passes)/float64(r.Trials))
+}
+
+// runTrials прогоняет набор n раз: первый раз против client, затем
+// каждый раз против нового клиента (мок-модель начинает свой сценарий заново).
+func runTrials(ctx context.Context, client llm.Provider, n int) ([]Rate, error) {
+	var rates []Rate
+	for trial := 1; trial <= n; trial++ {
+		if trial > 1 {
+			var err error
+			if client, err = llm.FromEnv(); err != nil {
+				return nil, err
+			}
+		}
+		if n > 1 {
+			fmt.Printf("\n🎲 Trial %d/%d\n", trial, n)
+		}
+		for i, r := range runSuite(ctx, client) {
+			if i == len(rates) {
+				rates = append(rates, Rate{Name: r.Name})
+			}
+			rates[i].Trials++
+			if r.Passed {
+				rates[i].Passes++
+			}
+			if !r.Passed || rates[i].Stable() {
+				rates[i].Last = r
+			}
+		}
+	}
+	return rates, nil
+}
+
+// printRates печатает долю успехов каждого теста, с последним провалом
+// для упавших, и вердикт.
+func printRates(rates []Rate) {
+	fmt.Println("\n📋 PASS RATES:")
+	stable, flaky := true, false
+	for _, r := range rates {
+		icon := "✅"
+		switch {
+		case r.Passes == 0:
+			icon, stable = "❌", false
+		case !r.Stable():
+			icon, stable, flaky = "⚠️", false, true
+		}
+		fmt.Printf("%s %s: %s\n", icon, r.Name, r)
+		if !r.Stable() {
+			fmt.Printf("   Last failure: %s\n", r.Last.Details)
+		}
+	}
+
+	switch {
+	case stable:
+		fmt.Println("\n🎉 EXCELLENT! This model passed every test every time.")
+	case flaky:
+		fmt.Println("\n⚠️ FLAKY! Some tests pass only some of the time: expect the labs that rely on them to fail now and then. Try a larger model or a lower quantization.")
+	default:
+		fmt.Println("\n⚠️ WARNING! This model has limitations. Some labs might fail.")
+	}
+}
@@ -1,15 +1,22 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/kshvakov/agent/pkg/session"
 	"github.com/sashabaranov/go-openai"
 )
 
 func main() {
+	stream := flag.Bool("stream", false, "print the reply as it is generated instead of all at once")
+	sessionID := flag.String("session-id", "", "resume the conversation with this id; empty starts a new one")
+	flag.Parse()
+
 	// 1. Настройка клиента (OpenAI или Local LLM)
 	token := os.Getenv("OPENAI_API_KEY")
 	baseURL := os.Getenv("OPENAI_BASE_URL")
@@ -28,24 +35,43 @@ func main() {
 	// client := openai.NewClientWithConfig(config)
 	// _ = client // TODO: remove this
 
-	// 2. Инициализируйте историю сообщений
-	// messages := ...
+	// 2. Инициализируйте историю сообщений, начиная с системного промпта
+	var messages []openai.ChatCompletionMessage
+
+	// 7. (Необязательно) Сохраняйте историю между запусками через pkg/session:
+	// s, err := session.Open(session.Root(), *sessionID)
+	// messages := s.Messages() // пусто для новой сессии: добавьте системный промпт
+	// После каждого ответа: s.Append(userMsg, assistantMsg)
+	// После команды, заменившей историю (/reset, /system, /load),
+	// закройте s и откройте с ней новую сессию: в файл сессии только
+	// дописывают.
+	// Напечатайте s.ID(), чтобы пользователь мог вернуться с -session-id.
+	_ = sessionID
 
-	reader := bufio.NewReader(os.Stdin)
+	// Строки целиком, с историей ↑/↓ в sessions/lab01.history (shell.go)
+	reader := newLineReader(filepath.Join(session.Root(), historyFile))
 	ctx := context.Background()
+	var total usageTotal // Токены, израсходованные разговором (stats.go)
 
-	fmt.Println("DevOps Bot (Lab 01). Type 'exit' to quit.")
+	fmt.Println("DevOps Bot (Lab 01). Type /help for commands, 'exit' to quit.")
 
 	for {
-		fmt.Print("> ")
-
-		var input string
-		fmt.Scanln(&input) // Warning: Scanln reads only one word. Better use reader.ReadString('\n')
-		_ = reader         // TODO: Use reader instead of Scanln
-
-		if input == "exit" {
+		input, err := reader.ReadLine("> ")
+		if err != nil || input == "exit" || input == "/exit" {
 			break
 		}
+		if input == "" {
+			continue
+		}
+		if strings.HasPrefix(input, "/") {
+			var replaced bool
+			messages, replaced, err = runCommand(input, messages)
+			if err != nil {
+				fmt.Println("Error:", err)
+			}
+			_ = replaced // 7. (Необязательно) Новая сессия, если история заменена
+			continue
+		}
 
 		// 3. Add User message to history
 
@@ -58,6 +84,20 @@ func main() {
 		// resp, err := client.CreateChatCompletion(ctx, req)
 
 		// 5. Handle response & Add Assistant message to history
+		// Измерьте ответ для строки статуса (stats.go): stats :=
+		// newReplyStats() перед запросом, stats.Done(&resp) после него,
+		// затем total.Add(stats) и printStatus(stats, &total).
+
+		// 6. (Необязательно) С -stream печатайте ответ по токенам:
+		// req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+		// s, err := client.CreateChatCompletionStream(ctx, req)
+		// defer s.Close()
+		// for { chunk, err := s.Recv(); if errors.Is(err, io.EOF) { break } ... }
+		// Печатайте каждый chunk.Choices[0].Delta.Content сразу и собирайте их:
+		// истории нужен весь ответ. stats.Chunk(chunk) для каждого чанка
+		// и stats.Done(nil) в конце.
 		_ = ctx
+		_ = stream
+		_ = total
 	}
 }
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Оболочка чата ---
+// Части REPL, которые не про LLM: чтение целых строк с редактированием
+// и историей (↑/↓ вспоминают набранное в этом запуске и в прошлых)
+// и slash-команды, которые работают с историей сообщений.
+// Они готовы к использованию; лаба — это цикл в main.go.
+
+// maxHistory — сколько набранных строк хранит файл истории.
+const maxHistory = 500
+
+// historyFile — где набранные строки хранятся между запусками, рядом с
+// сессиями (AGENT_SESSIONS_DIR, по умолчанию sessions/).
+const historyFile = "lab01.history"
+
+// lineReader читает строки из терминала с редактированием и историей,
+// которая хранится в файле. Из pipe он читает обычные строки.
+type lineReader struct {
+	in      *bufio.Reader
+	history []string
+	path    string // Файл истории
+}
+
+func newLineReader(path string) *lineReader {
+	r := &lineReader{in: bufio.NewReader(os.Stdin), path: path}
+	if data, err := os.ReadFile(path); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if line != "" {
+				r.history = append(r.history, line)
+			}
+		}
+	}
+	return r
+}
+
+// ReadLine печатает prompt и возвращает набранную строку без пробелов по краям.
+// io.EOF — это Ctrl+D на пустой строке или конец ввода.
+func (r *lineReader) ReadLine(prompt string) (string, error) {
+	var line string
+	var err error
+	if restore, ok := makeRaw(int(os.Stdin.Fd())); ok {
+		line, err = r.edit(prompt)
+		restore()
+	} else {
+		fmt.Print(prompt)
+		line, err = r.in.ReadString('\n')
+		if errors.Is(err, io.EOF) && line != "" {
+			err = nil
+		}
+	}
+	line = strings.TrimSpace(line)
+	if err == nil && line != "" {
+		r.remember(line)
+	}
+	return line, err
+}
+
+// remember добавляет line в историю и записывает файл истории.
+func (r *lineReader) remember(line string) {
+	if n := len(r.history); n > 0 && r.history[n-1] == line {
+		return
+	}
+	r.history = append(r.history, line)
+	if len(r.history) > maxHistory {
+		r.history = r.history[len(r.history)-maxHistory:]
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err == nil {
+		os.WriteFile(r.path, []byte(strings.Join(r.history, "\n")+"\n"), 0o600)
+	}
+}
+
+// edit читает строку по клавише из терминала в raw mode: ←/→, Home/End
+// (Ctrl+A/E) и Backspace/Delete её редактируют, ↑/↓ ходят по истории, Ctrl+U
+// её очищает, Ctrl+C её отбрасывает.
+func (r *lineReader) edit(prompt string) (string, error) {
+	var line []rune
+	pos := 0               // Курсор, в рунах
+	hist := len(r.history) // Показанная запись истории; len(r.history) — набираемая строка
+	draft := ""            // Набираемая строка, пока показана история
+	show := func(s string) {
+		line = []rune(s)
+		pos = len(line)
+	}
+	for {
+		fmt.Printf("\r%s%s\x1b[K", prompt, string(line))
+		if back := len(line) - pos; back > 0 {
+			fmt.Printf("\x1b[%dD", back)
+		}
+		c, _, err := r.in.ReadRune()
+		if err != nil {
+			fmt.Println()
+			return "", err
+		}
+		switch c {
+		case '\r', '\n':
+			fmt.Println()
+			return string(line), nil
+		case 3: // Ctrl+C
+			fmt.Println("^C")
+			show("")
+			hist = len(r.history)
+		case 4: // Ctrl+D
+			if len(line) == 0 {
+				fmt.Println()
+				return "", io.EOF
+			}
+		case 127, 8: // Backspace
+			if pos > 0 {
+				line = slices.Delete(line, pos-1, pos)
+				pos--
+			}
+		case 1: // Ctrl+A
+			pos = 0
+		case 5: // Ctrl+E
+			pos = len(line)
+		case 21: // Ctrl+U
+			show("")
+		case 27: // ESC [ X: стрелки, Home, End, Delete
+			if b, _ := r.in.ReadByte(); b != '[' && b != 'O' {
+				continue
+			}
+			switch k, _ := r.in.ReadByte(); k {
+			case 'A':
+				if hist > 0 {
+					if hist == len(r.history) {
+						draft = string(line)
+					}
+					hist--
+					show(r.history[hist])
+				}
+			case 'B':
+				if hist < len(r.history) {
+					hist++
+					if hist == len(r.history) {
+						show(draft)
+					} else {
+						show(r.history[hist])
+					}
+				}
+			case 'C':
+				pos = min(pos+1, len(line))
+			case 'D':
+				pos = max(pos-1, 0)
+			case 'H':
+				pos = 0
+			case 'F':
+				pos = len(line)
+			case '3': // ESC [ 3 ~
+				r.in.ReadByte()
+				if pos < len(line) {
+					line = slices.Delete(line, pos, pos+1)
+				}
+			}
+		default:
+			if c >= ' ' {
+				line = slices.Insert(line, pos, c)
+				pos++
+			}
+		}
+	}
+}
+
+// commandHelp перечисляет slash-команды.
+const commandHelp = `/reset            forget the conversation, keep the system prompt
+/system [prompt]  show the system prompt, or replace it
+/save <file>      save the conversation as JSON
+/load <file>      continue a conversation saved with /save
+/help             this list
+exit              quit (also /exit, Ctrl+D)`
+
+// runCommand выполняет slash-команду line над messages. Возвращает
+// историю после команды и то, заменила ли команда её (/reset,
+// /system <prompt>, /load): сохраняемая сессия начинается заново с новой.
+func runCommand(line string, messages []openai.ChatCompletionMessage) ([]openai.ChatCompletionMessage, bool, error) {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case "/help":
+		fmt.Println(commandHelp)
+		return messages, false, nil
+
+	case "/reset":
+		var kept []openai.ChatCompletionMessage
+		if len(messages) > 0 && messages[0].Role == openai.ChatMessageRoleSystem {
+			kept = append(kept, messages[0])
+		}
+		fmt.Printf("Forgot %d messages.\n", len(messages)-len(kept))
+		return kept, true, nil
+
+	case "/system":
+		hasSystem := len(messages) > 0 && messages[0].Role == openai.ChatMessageRoleSystem
+		if arg == "" {
+			if hasSystem {
+				fmt.Println(messages[0].Content)
+			} else {
+				fmt.Println("(no system prompt)")
+			}
+			return messages, false, nil
+		}
+		system := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: arg}
+		if hasSystem {
+			messages = slices.Clone(messages)
+			messages[0] = system
+		} else {
+			messages = append([]openai.ChatCompletionMessage{system}, messages...)
+		}
+		fmt.Println("System prompt replaced; the conversation so far stays.")
+		return messages, true, nil
+
+	case "/save":
+		if arg == "" {
+			return messages, false, errors.New("usage: /save <file>")
+		}
+		data, err := json.MarshalIndent(messages, "", "  ")
+		if err != nil {
+			return messages, false, err
+		}
+		if err := os.WriteFile(arg, append(data, '\n'), 0o644); err != nil {
+			return messages, false, err
+		}
+		fmt.Printf("Saved %d messages to %s.\n", len(messages), arg)
+		return messages, false, nil
+
+	case "/load":
+		if arg == "" {
+			return messages, false, errors.New("usage: /load <file>")
+		}
+		data, err := os.ReadFile(arg)
+		if err != nil {
+			return messages, false, err
+		}
+		var loaded []openai.ChatCompletionMessage
+		if err := json.Unmarshal(data, &loaded); err != nil {
+			return messages, false, fmt.Errorf("%s: %w", arg, err)
+		}
+		fmt.Printf("Loaded %d messages from %s.\n", len(loaded), arg)
+		return loaded, true, nil
+	}
+	return messages, false, fmt.Errorf("unknown command %s (try /help)", name)
+}
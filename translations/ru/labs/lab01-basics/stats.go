@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Строка статуса ---
+// Куда уходит время ответа: до первого токена сервер читает всю
+// историю (а для облачной модели запрос ещё идёт по сети); после него
+// модель генерирует с какой-то скоростью в токенах в секунду. Облачная
+// модель обычно начинает позже и пишет быстрее, чем локальная на
+// ноутбуке, а у локальной время до первого токена растёт вместе с
+// историей. Строка статуса после каждого ответа показывает и то, и другое,
+// и сколько разговор уже израсходовал: каждый запрос снова отправляет
+// всю историю. Готова к использованию, как shell.go.
+
+// replyStats измеряет один ответ. Создавайте его прямо перед запросом.
+type replyStats struct {
+	start  time.Time
+	first  time.Duration // До первого куска ответа; 0, если без стриминга
+	total  time.Duration
+	chunks int           // Куски ответа: примерно по токену
+	usage  *openai.Usage // Как сообщил сервер, если сообщил
+}
+
+func newReplyStats() *replyStats {
+	return &replyStats{start: time.Now()}
+}
+
+// Chunk записывает кусок стримингового ответа. Сервер сообщает usage в
+// последнем куске, если запрос об этом просит:
+// StreamOptions: &openai.StreamOptions{IncludeUsage: true}.
+func (r *replyStats) Chunk(chunk openai.ChatCompletionStreamResponse) {
+	if chunk.Usage != nil {
+		r.usage = chunk.Usage
+	}
+	if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+		return
+	}
+	if r.chunks == 0 {
+		r.first = time.Since(r.start)
+	}
+	r.chunks++
+}
+
+// Done завершает измерение. resp — ответ на запрос без стриминга,
+// nil для стримингового.
+func (r *replyStats) Done(resp *openai.ChatCompletionResponse) {
+	r.total = time.Since(r.start)
+	if resp != nil {
+		r.usage = &resp.Usage
+		if len(resp.Choices) > 0 {
+			r.chunks = (len(resp.Choices[0].Message.Content) + 3) / 4 // Примерно 4 символа на токен
+		}
+	}
+}
+
+// tokens возвращает сгенерированные токены и то, посчитал ли их сервер:
+// если нет, это оценка.
+func (r *replyStats) tokens() (int, bool) {
+	if r.usage != nil && r.usage.CompletionTokens > 0 {
+		return r.usage.CompletionTokens, true
+	}
+	return r.chunks, false
+}
+
+func (r *replyStats) String() string {
+	n, counted := r.tokens()
+	count := fmt.Sprint(n)
+	if !counted {
+		count = "~" + count
+	}
+	if r.first == 0 {
+		// Без стриминга: весь ответ пришёл сразу, поэтому есть только
+		// общая скорость.
+		return fmt.Sprintf("%s tokens in %.2fs · %.1f tok/s overall", count, r.total.Seconds(), rate(n, r.total))
+	}
+	// Скорость генерации: токены после первого за время после него.
+	return fmt.Sprintf("first token %.2fs · %s tokens in %.2fs · %.1f tok/s",
+		r.first.Seconds(), count, r.total.Seconds(), rate(n-1, r.total-r.first))
+}
+
+func rate(tokens int, d time.Duration) float64 {
+	if tokens <= 0 || d <= 0 {
+		return 0
+	}
+	return float64(tokens) / d.Seconds()
+}
+
+// usageTotal складывает ответы разговора.
+type usageTotal struct {
+	requests   int
+	prompt     int
+	completion int
+	estimated  bool // Какой-то ответ пришёл без usage: его токены — оценка
+}
+
+func (u *usageTotal) Add(r *replyStats) {
+	u.requests++
+	n, counted := r.tokens()
+	u.completion += n
+	if r.usage != nil {
+		u.prompt += r.usage.PromptTokens
+	}
+	if !counted {
+		u.estimated = true
+	}
+}
+
+func (u *usageTotal) String() string {
+	line := fmt.Sprintf("requests %d · %d prompt + %d completion tokens", u.requests, u.prompt, u.completion)
+	if u.estimated {
+		line += " (the server didn't report all of them)"
+	}
+	return line
+}
+
+// printStatus печатает строку статуса ответа r с итогами на данный момент.
+func printStatus(r *replyStats, total *usageTotal) {
+	fmt.Printf("⏱  %v | so far: %v\n", r, total)
+}
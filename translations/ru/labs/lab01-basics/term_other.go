@@ -0,0 +1,7 @@
+//go:build !linux && !darwin
+
+package main
+
+// makeRaw здесь не поддерживается: строки читаются без редактирования
+// и без истории.
+func makeRaw(fd int) (restore func(), ok bool) { return nil, false }
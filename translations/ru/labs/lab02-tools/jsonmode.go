@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kshvakov/agent/pkg/parse"
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Вызовы инструментов для моделей без них ---
+// Многие локальные модели никогда не заполняют ToolCalls: их этому не учили,
+// или сервер не передаёт им tools. Такая модель всё равно может выбрать
+// инструмент, если попросить её словами: системный промпт перечисляет
+// инструменты и просит в ответе JSON-блок действия. parseAction превращает
+// блок в openai.ToolCall — то же значение, что и у нативного вызова, поэтому
+// диспетчеризация после него разницы не видит. Готово к использованию; main.go
+// выбирает режим через -tool-mode.
+
+// Режимы инструментов.
+const (
+	toolModeNative = "native" // Инструменты в запросе, вызовы в ToolCalls
+	toolModeJSON   = "json"   // Инструменты в системном промпте, вызовы в тексте
+)
+
+// jsonToolPrompt — системный промпт режима json: инструменты и
+// формат вызова.
+func jsonToolPrompt(tools []openai.Tool) string {
+	var b strings.Builder
+	b.WriteString("You can call these tools:\n\n")
+	for _, t := range tools {
+		params, _ := json.Marshal(t.Function.Parameters)
+		fmt.Fprintf(&b, "- %s: %s\n  Parameters (JSON Schema): %s\n", t.Function.Name, t.Function.Description, params)
+	}
+	b.WriteString(`
+To call a tool, reply with only this JSON object and nothing else:
+{"tool": "<tool name>", "args": {<parameters>}}
+
+You will get the result in the next message. When you have what you need,
+answer the user in plain text, without JSON.`)
+	return b.String()
+}
+
+// action — вызов, который модель пишет в тексте. Модели, обученные на других
+// форматах, пишут "name" и "arguments", иногда с аргументами в виде
+// строки: принимаются все варианты.
+type action struct {
+	Tool      string          `json:"tool"`
+	Name      string          `json:"name"`
+	Args      json.RawMessage `json:"args"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// parseAction находит блок действия в content: голый, в ограде ```json
+// или с прозой вокруг. ok равен false, если блока нет, и тогда content —
+// это ответ. n нумерует вызов, для его ID.
+func parseAction(content string, n int) (call openai.ToolCall, ok bool) {
+	a, err := parse.JSON[action]()(content)
+	name := a.Tool
+	if name == "" {
+		name = a.Name
+	}
+	if err != nil || name == "" {
+		return openai.ToolCall{}, false
+	}
+	args := a.Args
+	if len(args) == 0 {
+		args = a.Arguments
+	}
+	var s string
+	if json.Unmarshal(args, &s) == nil {
+		args = json.RawMessage(s) // "arguments": "{\"ip\": ...}"
+	}
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	return openai.ToolCall{
+		ID:       fmt.Sprintf("json-%d", n),
+		Type:     openai.ToolTypeFunction,
+		Function: openai.FunctionCall{Name: name, Arguments: string(args)},
+	}, true
+}
+
+// jsonResult — сообщение, которое передаёт модели результат call в
+// режиме json. Это user-сообщение: API принимает tool-сообщение только
+// после assistant-сообщения с ToolCalls, а его нет.
+func jsonResult(call openai.ToolCall, result string) openai.ChatCompletionMessage {
+	return openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: fmt.Sprintf("Result of %s %s:\n%s", call.Function.Name, call.Function.Arguments, result),
+	}
+}
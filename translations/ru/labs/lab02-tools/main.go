@@ -2,12 +2,15 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"os"
+	"strings"
 
 	"github.com/sashabaranov/go-openai"
 )
 
-// Наша "реальная" функция
+// Наши "реальные" функции
 func runGetServerStatus(ip string) string {
 	// Mock implementation
 	if ip == "192.168.1.10" {
@@ -16,7 +19,28 @@ func runGetServerStatus(ip string) string {
 	return "OFFLINE"
 }
 
+func runGetServerLoad(ip string) string {
+	// Mock-реализация: load average за 1, 5 и 15 минут
+	if ip == "192.168.1.10" {
+		return "load average: 3.90, 2.10, 0.80 (4 CPUs)"
+	}
+	return "no data: the server does not respond"
+}
+
 func main() {
+	toolMode := flag.String("tool-mode", toolModeNative, "native: tools in the request; json: tools in the prompt, calls as JSON in the text (jsonmode.go)")
+	flag.Parse()
+	if *toolMode != toolModeNative && *toolMode != toolModeJSON {
+		fmt.Fprintln(os.Stderr, "-tool-mode must be native or json")
+		os.Exit(2)
+	}
+
+	// Вопрос, например go run . "How loaded is 192.168.1.10?"
+	question := "Is server 192.168.1.10 online?"
+	if flag.NArg() > 0 {
+		question = strings.Join(flag.Args(), " ")
+	}
+
 	// 1. Настройка клиента
 	token := os.Getenv("OPENAI_API_KEY")
 	baseURL := os.Getenv("OPENAI_BASE_URL")
@@ -29,24 +53,43 @@ func main() {
 	}
 	client := openai.NewClientWithConfig(config)
 
-	// 2. Опишите инструмент
+	// 2. Опишите инструменты: get_server_status и get_server_load
 	// tools := []openai.Tool{ ... }
 
 	// 3. Сформируйте запрос
+	// messages := []openai.ChatCompletionMessage{
+	//     {Role: openai.ChatMessageRoleUser, Content: question},
+	// }
 	// req := openai.ChatCompletionRequest{
 	//     Model: "gpt-4o-mini", // Или имя вашей локальной модели
-	//     Messages: []openai.ChatCompletionMessage{
-	//         {Role: openai.ChatMessageRoleUser, Content: "Is server 192.168.1.10 online?"},
-	//     },
+	//     Messages: messages,
 	//     Tools: tools,
 	// }
 
 	ctx := context.Background()
 	_ = ctx
 	_ = client
+	_ = question
 	_ = runGetServerStatus
+	_ = runGetServerLoad
 
 	// 4. Выполните запрос и проверьте ToolCalls
 	// resp, _ := client.CreateChatCompletion(ctx, req)
-	// if len(resp.Choices[0].Message.ToolCalls) > 0 { ... }
+	// msg := resp.Choices[0].Message
+	// if len(msg.ToolCalls) == 0 { модель ответила текстом: напечатайте его }
+
+	// 5. Выполните каждый вызов: выберите функцию по call.Function.Name,
+	// распарсьте call.Function.Arguments. Добавьте msg в messages, затем
+	// по одному сообщению tool на вызов:
+	// {Role: openai.ChatMessageRoleTool, ToolCallID: call.ID, Content: result}
+
+	// 6. Отправьте messages снова (с инструментами) и напечатайте ответ:
+	// модель превращает результаты в слова.
+
+	// 7. (Необязательно) С -tool-mode json, для моделей, которые никогда не
+	// заполняют ToolCalls: вместо Tools в запросе — системное сообщение
+	// jsonToolPrompt(tools). Вызов приходит текстом:
+	// call, ok := parseAction(msg.Content, 1) // ok == false: это ответ
+	// Выполните его так же, затем добавьте msg и jsonResult(call, result).
+	_ = toolMode
 }
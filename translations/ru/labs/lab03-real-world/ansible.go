@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// --- Запуск ansible-playbook ---
+// runPlaybook запускает команду, печатает её вывод по мере поступления (плейбук
+// может идти минутами, а тишина выглядит как зависание) и сохраняет его конец
+// для результата инструмента: PLAY RECAP и ошибки — в конце. Неудачный
+// запуск — это *playbookError, который по коду выхода говорит, что пошло не так
+// и поможет ли повторный запуск. Готово к использованию; инструмент в main.go
+// собирает командную строку.
+
+// maxPlaybookOutput — сколько вывода, с конца, сохраняет результат.
+const maxPlaybookOutput = 4 << 10
+
+// playbookRun — итог одного запуска.
+type playbookRun struct {
+	Command  string // Командная строка
+	Output   string // stdout и stderr в том виде, как печатались, последние maxPlaybookOutput байт
+	ExitCode int
+	Duration time.Duration // Таймаут, если TimedOut
+	TimedOut bool
+}
+
+// ansibleExitCodes — коды выхода ansible-playbook: что они значат
+// и может ли тот же запуск пройти позже.
+var ansibleExitCodes = map[int]struct {
+	meaning string
+	retry   bool
+}{
+	1:   {"error", false},
+	2:   {"one or more hosts failed", true},
+	3:   {"one or more hosts were unreachable", true},
+	4:   {"parser error: check the playbook and the inventory", false},
+	5:   {"bad or incomplete options", false},
+	99:  {"interrupted by the user", true},
+	250: {"unexpected error", false},
+}
+
+// playbookError — запуск, который не удался.
+type playbookError struct {
+	Run   playbookRun
+	Retry bool // Повторный запуск без изменений может сработать
+}
+
+func (e *playbookError) Error() string {
+	var reason string
+	switch {
+	case e.Run.TimedOut:
+		reason = fmt.Sprintf("killed after the timeout of %s", e.Run.Duration)
+	case ansibleExitCodes[e.Run.ExitCode].meaning != "":
+		reason = fmt.Sprintf("exit code %d: %s", e.Run.ExitCode, ansibleExitCodes[e.Run.ExitCode].meaning)
+	default:
+		reason = fmt.Sprintf("exit code %d", e.Run.ExitCode)
+	}
+	retry := "no, fix the call first"
+	switch {
+	case e.Run.TimedOut:
+		retry = "only with a longer timeout, after checking the output for the task that hangs"
+	case e.Retry:
+		retry = "yes, once the hosts are fixed or reachable"
+	}
+	return fmt.Sprintf("%s: %s. Retry: %s.\n%s", e.Run.Command, reason, retry, e.Run.Output)
+}
+
+// runPlaybook запускает cmd (ansible-playbook и его аргументы) с таймаутом.
+// Ошибка — *playbookError, если команда запустилась и упала, и другая
+// ошибка, если она не смогла стартовать.
+func runPlaybook(ctx context.Context, command func(ctx context.Context, args ...string) *exec.Cmd, args []string, timeout time.Duration) (playbookRun, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := command(ctx, args...)
+	cmd.WaitDelay = 5 * time.Second // Дочерние процессы убитого плейбука могут держать pipe открытыми
+
+	run := playbookRun{Command: strings.Join(append([]string{"ansible-playbook"}, args...), " ")}
+	var out bytes.Buffer
+	w := io.MultiWriter(os.Stdout, &out)
+	cmd.Stdout, cmd.Stderr = w, w // Один writer: строки остаются по порядку
+
+	start := time.Now()
+	err := cmd.Run()
+	run.Duration = time.Since(start)
+	run.Output = tail(out.String(), maxPlaybookOutput)
+
+	var exit *exec.ExitError
+	switch {
+	case err == nil:
+		return run, nil
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		run.TimedOut, run.ExitCode, run.Duration = true, -1, timeout
+		return run, &playbookError{Run: run, Retry: false}
+	case errors.As(err, &exit):
+		run.ExitCode = exit.ExitCode()
+		return run, &playbookError{Run: run, Retry: ansibleExitCodes[run.ExitCode].retry}
+	default:
+		return run, fmt.Errorf("%s: %w", run.Command, err) // Не установлен, не исполняемый
+	}
+}
+
+// tail оставляет последние n байт s и говорит, сколько отрезано.
+func tail(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	cut := len(s) - n
+	if i := strings.IndexByte(s[cut:], '\n'); i >= 0 {
+		cut += i + 1 // Начинаем с целой строки
+	}
+	return fmt.Sprintf("... (%d bytes before)\n%s", cut, s[cut:])
+}
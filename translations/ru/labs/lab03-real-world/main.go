@@ -1,8 +1,15 @@
 package main
 
 import (
+	"cmp"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
 )
 
 // 1. Интерфейс Инструмента
@@ -13,53 +20,198 @@ type Tool interface {
 	Execute(args json.RawMessage) (string, error)
 }
 
-// 2. Реализация Proxmox Tool
-type ProxmoxListVMsTool struct{}
+// 2. Инструменты Proxmox: настоящий API за интерфейсом (proxmox.go) или
+// фейковый кластер с -mock (mock.go). Инструменты не знают, какой именно.
+type ProxmoxListVMsTool struct{ PVE proxmox }
 
-func (t *ProxmoxListVMsTool) Name() string        { return "list_vms" }
-func (t *ProxmoxListVMsTool) Description() string { return "List all VMs" }
+func (t *ProxmoxListVMsTool) Name() string { return "list_vms" }
+func (t *ProxmoxListVMsTool) Description() string {
+	return "List the VMs of a Proxmox node, or of the whole cluster if node is empty"
+}
 func (t *ProxmoxListVMsTool) Execute(args json.RawMessage) (string, error) {
-	// TODO: Здесь должен быть реальный вызов API Proxmox
-	// client.GetNodes()...
-	return "VM-100 (Running), VM-101 (Stopped)", nil
+	var params struct {
+		Node string `json:"node"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", fmt.Errorf("invalid args: %v", err)
+	}
+	vms, err := t.PVE.ListVMs(params.Node)
+	if err != nil {
+		return "", err
+	}
+	if len(vms) == 0 {
+		return "No VMs", nil
+	}
+	lines := make([]string, len(vms))
+	for i, v := range vms {
+		lines[i] = v.String()
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+type ProxmoxStartVMTool struct{ PVE proxmox }
+
+func (t *ProxmoxStartVMTool) Name() string        { return "start_vm" }
+func (t *ProxmoxStartVMTool) Description() string { return "Start a VM: node and vmid" }
+func (t *ProxmoxStartVMTool) Execute(args json.RawMessage) (string, error) {
+	params, err := parseVMArgs(args)
+	if err != nil {
+		return "", err
+	}
+	if err := t.PVE.StartVM(params.Node, params.VMID); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("VM %d on %s started", params.VMID, params.Node), nil
+}
+
+type ProxmoxStopVMTool struct{ PVE proxmox }
+
+func (t *ProxmoxStopVMTool) Name() string { return "stop_vm" }
+func (t *ProxmoxStopVMTool) Description() string {
+	return "Stop a VM at once, without a guest shutdown: node and vmid"
+}
+func (t *ProxmoxStopVMTool) Execute(args json.RawMessage) (string, error) {
+	params, err := parseVMArgs(args)
+	if err != nil {
+		return "", err
+	}
+	if err := t.PVE.StopVM(params.Node, params.VMID); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("VM %d on %s stopped", params.VMID, params.Node), nil
+}
+
+// vmArgs — аргументы start_vm и stop_vm. Они проверяются здесь:
+// понятная ошибка для модели лучше, чем 400 от API.
+type vmArgs struct {
+	Node string `json:"node"`
+	VMID int    `json:"vmid"`
 }
 
-// 3. Реализация Ansible Tool
-type AnsibleRunPlaybookTool struct{}
+func parseVMArgs(args json.RawMessage) (vmArgs, error) {
+	var params vmArgs
+	if err := json.Unmarshal(args, &params); err != nil {
+		return params, fmt.Errorf("invalid args: %v", err)
+	}
+	if params.Node == "" {
+		return params, fmt.Errorf("node is required (list_vms shows the node of every VM)")
+	}
+	if params.VMID < 100 {
+		return params, fmt.Errorf("vmid must be 100 or more, got %d", params.VMID)
+	}
+	return params, nil
+}
 
-func (t *AnsibleRunPlaybookTool) Name() string        { return "run_playbook" }
-func (t *AnsibleRunPlaybookTool) Description() string { return "Run ansible playbook" }
+// 3. Реализация Ansible Tool: ansible-playbook как дочерний процесс
+// (ansible.go), его вывод стримится в терминал и возвращается.
+type AnsibleRunPlaybookTool struct {
+	Timeout time.Duration
+	// Command создает команду; nil запускает ansible-playbook из PATH.
+	Command func(ctx context.Context, args ...string) *exec.Cmd
+}
+
+func (t *AnsibleRunPlaybookTool) Name() string { return "run_playbook" }
+func (t *AnsibleRunPlaybookTool) Description() string {
+	return "Run an ansible playbook: playbook, optional inventory, limit (hosts or groups) and check (dry run)"
+}
 func (t *AnsibleRunPlaybookTool) Execute(args json.RawMessage) (string, error) {
-	// TODO: Парсинг аргументов
-	// var params struct { Playbook string }
-	// json.Unmarshal(args, &params)
-	
-	// TODO: exec.Command("ansible-playbook", params.Playbook)
-	return "Playbook executed successfully", nil
+	var params struct {
+		Playbook  string `json:"playbook"`
+		Inventory string `json:"inventory"`
+		Limit     string `json:"limit"`
+		Check     bool   `json:"check"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", fmt.Errorf("invalid args: %v", err)
+	}
+	if params.Playbook == "" {
+		return "", fmt.Errorf("playbook is required")
+	}
+	// Аргументы приходят от модели: значение, начинающееся с "-",
+	// было бы прочитано как опция.
+	for _, v := range []string{params.Playbook, params.Inventory, params.Limit} {
+		if strings.HasPrefix(v, "-") {
+			return "", fmt.Errorf("%q: arguments can't start with '-'", v)
+		}
+	}
+
+	var cmdArgs []string
+	if params.Inventory != "" {
+		cmdArgs = append(cmdArgs, "-i", params.Inventory)
+	}
+	if params.Limit != "" {
+		cmdArgs = append(cmdArgs, "--limit", params.Limit)
+	}
+	if params.Check {
+		cmdArgs = append(cmdArgs, "--check")
+	}
+	cmdArgs = append(cmdArgs, params.Playbook)
+
+	command := t.Command
+	if command == nil {
+		command = func(ctx context.Context, args ...string) *exec.Cmd {
+			return exec.CommandContext(ctx, "ansible-playbook", args...)
+		}
+	}
+	run, err := runPlaybook(context.Background(), command, cmdArgs, cmp.Or(t.Timeout, 10*time.Minute))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("✅ %s finished in %s.\n%s", run.Command, run.Duration.Round(time.Second), run.Output), nil
 }
 
 func main() {
+	// go run . [-mock] [tool] [json args], например go run . -mock start_vm '{"node": "pve1", "vmid": 101}'
+	// или go run . -mock run_playbook '{"playbook": "deploy_nginx.yml", "limit": "web"}'
+	mock := flag.Bool("mock", os.Getenv("OPENAI_BASE_URL") == "mock", "use a fake Proxmox cluster instead of PROXMOX_URL, and a fake ansible-playbook (mock.go)")
+	playbookTimeout := flag.Duration("playbook-timeout", 10*time.Minute, "how long run_playbook waits before it kills ansible-playbook")
+	flag.Parse()
+
+	var pve proxmox
+	ansible := &AnsibleRunPlaybookTool{Timeout: *playbookTimeout}
+	if *mock {
+		pve = newFakeProxmox()
+		ansible.Command = fakeAnsiblePlaybook
+	} else if client, err := proxmoxFromEnv(); err != nil {
+		// Ansible не нужен Proxmox: лаба продолжает работу без его инструментов.
+		fmt.Println("⚠️  No Proxmox tools:", err)
+	} else {
+		pve = client
+	}
+
 	// 4. Реестр инструментов (Map)
 	registry := make(map[string]Tool)
-	
-	pTool := &ProxmoxListVMsTool{}
-	registry[pTool.Name()] = pTool
-
-	aTool := &AnsibleRunPlaybookTool{}
-	registry[aTool.Name()] = aTool
+	tools := []Tool{ansible}
+	if pve != nil {
+		tools = append(tools, &ProxmoxListVMsTool{PVE: pve}, &ProxmoxStartVMTool{PVE: pve}, &ProxmoxStopVMTool{PVE: pve})
+	}
+	for _, t := range tools {
+		registry[t.Name()] = t
+	}
 
 	fmt.Println("Available tools:", len(registry))
 
 	// 5. Эмуляция вызова (как будто от LLM)
 	toolName := "list_vms"
 	toolArgs := json.RawMessage("{}")
+	if flag.NArg() > 0 {
+		toolName = flag.Arg(0)
+	}
+	if flag.NArg() > 1 {
+		toolArgs = json.RawMessage(flag.Arg(1))
+	}
 
 	if tool, ok := registry[toolName]; ok {
 		fmt.Printf("Executing %s...\n", toolName)
-		result, _ := tool.Execute(toolArgs)
+		result, err := tool.Execute(toolArgs)
+		if err != nil {
+			// Для LLM этот текст был бы результатом инструмента: модель
+			// читает, почему вызов не удался, и может исправить аргументы.
+			fmt.Println("Error:", err)
+			return
+		}
 		fmt.Println("Result:", result)
 	} else {
 		fmt.Println("Tool not found")
 	}
 }
-
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"cmp"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// --- Клиент Proxmox VE API ---
+// Маленький клиент REST API Proxmox VE: ровно то, что нужно инструментам в
+// main.go. Он аутентифицируется API-токеном, поэтому ни пароль, ни
+// тикет не нужны:
+//
+//	PROXMOX_URL=https://pve.example.com:8006
+//	PROXMOX_TOKEN_ID='agent@pve!lab03'
+//	PROXMOX_TOKEN_SECRET=xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx
+//	PROXMOX_INSECURE=1 # У сервера самоподписанный сертификат
+//
+// Создайте токен в Datacenter → Permissions → API Tokens; ему нужны
+// VM.Audit, чтобы получать список VM, и VM.PowerMgmt, чтобы запускать и
+// останавливать их. Готово к использованию; без сервера Proxmox запускайте
+// лабу с -mock (mock.go).
+
+// proxmox — то, чем пользуются инструменты: настоящий API или фейковый кластер.
+type proxmox interface {
+	// ListVMs возвращает VM узла node или всего кластера, если node равен "".
+	ListVMs(node string) ([]vm, error)
+	// StartVM и StopVM возвращаются, когда задача выполнена. StopVM — жёсткая
+	// остановка, как выдернуть шнур питания, а не выключение гостевой ОС.
+	StartVM(node string, vmid int) error
+	StopVM(node string, vmid int) error
+}
+
+// vm — одна VM в том виде, как её перечисляет API.
+type vm struct {
+	VMID   int    `json:"vmid"`
+	Name   string `json:"name"`
+	Node   string `json:"node"`
+	Status string `json:"status"` // running, stopped
+	Type   string `json:"type"`   // qemu; lxc для контейнеров
+}
+
+func (v vm) String() string {
+	return fmt.Sprintf("ID: %d, Name: %s, Node: %s, Status: %s", v.VMID, v.Name, v.Node, v.Status)
+}
+
+// proxmoxError — ошибка, которую вернул API. Message — причина, которую
+// Proxmox пишет в строку статуса ("VM 100 already running"), Errors —
+// невалидные параметры ответа 400.
+type proxmoxError struct {
+	Status  int
+	Message string
+	Errors  map[string]string
+}
+
+func (e *proxmoxError) Error() string {
+	msg := fmt.Sprintf("proxmox: %d %s", e.Status, cmp.Or(e.Message, http.StatusText(e.Status)))
+	params := make([]string, 0, len(e.Errors))
+	for p, reason := range e.Errors {
+		params = append(params, p+": "+strings.TrimSpace(reason))
+	}
+	slices.Sort(params)
+	if len(params) > 0 {
+		msg += " (" + strings.Join(params, "; ") + ")"
+	}
+	return msg
+}
+
+// proxmoxClient общается с сервером Proxmox VE.
+type proxmoxClient struct {
+	base  string // https://host:8006/api2/json
+	token string // Заголовок Authorization
+	http  *http.Client
+}
+
+// taskTimeout — сколько StartVM и StopVM ждут свою задачу.
+const taskTimeout = 2 * time.Minute
+
+// proxmoxFromEnv возвращает клиент, настроенный через PROXMOX_URL,
+// PROXMOX_TOKEN_ID, PROXMOX_TOKEN_SECRET и PROXMOX_INSECURE.
+func proxmoxFromEnv() (*proxmoxClient, error) {
+	base, id, secret := os.Getenv("PROXMOX_URL"), os.Getenv("PROXMOX_TOKEN_ID"), os.Getenv("PROXMOX_TOKEN_SECRET")
+	if base == "" || id == "" || secret == "" {
+		return nil, errors.New("set PROXMOX_URL, PROXMOX_TOKEN_ID and PROXMOX_TOKEN_SECRET, or run with -mock")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if os.Getenv("PROXMOX_INSECURE") == "1" {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &proxmoxClient{
+		base:  strings.TrimSuffix(base, "/") + "/api2/json",
+		token: "PVEAPIToken=" + id + "=" + secret,
+		http:  &http.Client{Timeout: 30 * time.Second, Transport: transport},
+	}, nil
+}
+
+// call отправляет запрос и декодирует поле "data" ответа в out.
+func (c *proxmoxClient) call(method, path string, form url.Values, out any) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, c.base+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", c.token)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("proxmox: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var reply struct {
+		Data   json.RawMessage   `json:"data"`
+		Errors map[string]string `json:"errors"`
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("proxmox: %w", err)
+	}
+	jsonErr := json.Unmarshal(raw, &reply)
+	if resp.StatusCode != http.StatusOK {
+		// "500 VM 100 not running": причина — текст после кода.
+		_, reason, _ := strings.Cut(resp.Status, " ")
+		if reason == http.StatusText(resp.StatusCode) {
+			reason = ""
+		}
+		return &proxmoxError{Status: resp.StatusCode, Message: reason, Errors: reply.Errors}
+	}
+	if jsonErr != nil {
+		return fmt.Errorf("proxmox: bad reply to %s %s: %w", method, path, jsonErr)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(reply.Data, out)
+}
+
+func (c *proxmoxClient) ListVMs(node string) ([]vm, error) {
+	var all []vm
+	if err := c.call(http.MethodGet, "/cluster/resources?type=vm", nil, &all); err != nil {
+		return nil, err
+	}
+	var vms []vm
+	for _, v := range all {
+		if v.Type == "qemu" && (node == "" || v.Node == node) {
+			vms = append(vms, v)
+		}
+	}
+	slices.SortFunc(vms, func(a, b vm) int { return a.VMID - b.VMID })
+	return vms, nil
+}
+
+func (c *proxmoxClient) StartVM(node string, vmid int) error { return c.power(node, vmid, "start") }
+
+func (c *proxmoxClient) StopVM(node string, vmid int) error { return c.power(node, vmid, "stop") }
+
+// power запускает или останавливает VM и ждёт задачу, которую Proxmox для этого
+// запускает: запрос только ставит задачу в очередь, а она ещё может упасть.
+func (c *proxmoxClient) power(node string, vmid int, action string) error {
+	var upid string
+	path := fmt.Sprintf("/nodes/%s/qemu/%d/status/%s", url.PathEscape(node), vmid, action)
+	if err := c.call(http.MethodPost, path, url.Values{}, &upid); err != nil {
+		return err
+	}
+	return c.wait(node, upid)
+}
+
+// wait опрашивает задачу, пока та не остановится, и возвращает её статус
+// выхода как ошибку, если он не "OK".
+func (c *proxmoxClient) wait(node, upid string) error {
+	path := fmt.Sprintf("/nodes/%s/tasks/%s/status", url.PathEscape(node), url.PathEscape(upid))
+	deadline := time.Now().Add(taskTimeout)
+	for {
+		var task struct {
+			Status     string `json:"status"` // running, stopped
+			ExitStatus string `json:"exitstatus"`
+		}
+		if err := c.call(http.MethodGet, path, nil, &task); err != nil {
+			return err
+		}
+		if task.Status == "stopped" {
+			if task.ExitStatus != "OK" {
+				return fmt.Errorf("proxmox: task %s failed: %s", upid, task.ExitStatus)
+			}
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("proxmox: task %s still running after %s", upid, taskTimeout)
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/parse"
+	"github.com/kshvakov/agent/pkg/schema"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Цикл, который останавливается, когда модель перестаёт вызывать инструменты,
+// заканчивается, когда модель считает, что всё сделано, а модель считает так
+// легко: «логи почищены» — это не «место на диске освобождено». Здесь цикл
+// заканчивается по явному критерию и говорит, по какому именно.
+
+// Состояния выхода из цикла, они же статус запуска (runs/<id>/meta.json).
+const (
+	exitSuccess        = "success"         // Цель достигнута
+	exitGaveUp         = "gave_up"         // Кончились попытки или итерации, цель не достигнута
+	exitBudgetExceeded = "budget_exceeded" // Кончился Budget запуска
+	exitInterrupted    = "interrupted"     // Ctrl+C
+	exitFailed         = "failed"          // Упал LLM API
+)
+
+// outcome — как закончился цикл и почему.
+type outcome struct {
+	State  string
+	Reason string
+}
+
+// evaluation — вердикт оценщика о цели.
+type evaluation struct {
+	Achieved bool   `json:"achieved"`
+	Reason   string `json:"reason"`
+	By       string `json:"-"` // rule или llm
+}
+
+// goal — то, чего должен добиться запуск: цель словами, для модели
+// и судьи, и правило, которое проверяет её на хосте.
+type goal struct {
+	Objective string
+	Threshold int // Загрузка диска, которую цель допускает на каждом разделе, в процентах
+}
+
+func (g goal) String() string {
+	return fmt.Sprintf("%s: every partition below %d%%, and staying there", g.Objective, g.Threshold)
+}
+
+// rule проверяет сам хост, а не то, что о нём говорит модель. Место,
+// которое снова заполняется, не освобождено.
+func (g goal) rule(h *host) evaluation {
+	for _, p := range []*partition{h.root, h.data} {
+		if p.percent() >= g.Threshold {
+			return evaluation{By: "rule", Reason: fmt.Sprintf("%s is still %d%% full, the objective needs below %d%%", p.mount, p.percent(), g.Threshold)}
+		}
+	}
+	if h.crashing {
+		return evaluation{By: "rule", Reason: fmt.Sprintf("every partition is below %d%%, but /data grows %dGB a minute and will fill again", g.Threshold, dumpGB)}
+	}
+	return evaluation{Achieved: true, By: "rule", Reason: fmt.Sprintf("/ is %d%% full, /data %d%%, and neither grows", h.root.percent(), h.data.percent())}
+}
+
+// evaluationSchema — форма ответа судьи.
+var evaluationSchema = schema.Object().
+	Prop("achieved", schema.Boolean("Whether the objective is achieved")).
+	Prop("reason", schema.String("The evidence, in one sentence")).
+	Require("achieved", "reason")
+
+// judge спрашивает модель, достиг ли запуск цели, по результатам
+// инструментов и ответу запуска. Судья читает улики, а не систему:
+// он для целей, которые не проверить правилом.
+func (g goal) judge(ctx context.Context, client llm.Provider, messages []openai.ChatCompletionMessage, answer string) (evaluation, error) {
+	var evidence strings.Builder
+	for _, m := range messages {
+		if m.Role == openai.ChatMessageRoleTool {
+			fmt.Fprintf(&evidence, "- %s\n", strings.TrimSpace(m.Content))
+		}
+	}
+	prompt := fmt.Sprintf(`You check whether an agent achieved its objective. Trust tool results over the agent's claims.
+Objective: %s
+
+Tool results, in order:
+%s
+Agent's answer: %s
+
+Return JSON only: {"achieved": true or false, "reason": "..."}`, g, evidence.String(), answer)
+
+	resp, err := client.ChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:          "gpt-4o-mini",
+		Messages:       []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: prompt}},
+		Temperature:    llm.ZeroTemperature,
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	})
+	if err != nil {
+		return evaluation{}, err
+	}
+	if len(resp.Choices) == 0 {
+		return evaluation{}, fmt.Errorf("empty judge response")
+	}
+	content, err := parse.JSON[json.RawMessage]()(resp.Choices[0].Message.Content)
+	if err != nil {
+		return evaluation{}, fmt.Errorf("judge: %w", err)
+	}
+	if err := evaluationSchema.Validate(content); err != nil {
+		return evaluation{}, fmt.Errorf("judge: %w", err)
+	}
+	var e evaluation
+	if err := json.Unmarshal(content, &e); err != nil {
+		return evaluation{}, fmt.Errorf("judge returned invalid JSON: %w", err)
+	}
+	e.By = "llm"
+	return e, nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// --- Симулированный хост ---
+//
+// Сервер, на котором агент освобождает место. Он маленький, но отвечает
+// так же, как настоящий: что делает действие, зависит от того, что было
+// до него, так что агенту есть к чему приспосабливаться.
+//
+//   - "/" забит старыми логами. clean_logs их освобождает, но первая попытка
+//     натыкается на logrotate, который держит блокировку, и срабатывает только повтор.
+//   - "/data" — настоящий виновник: report-worker падает в цикле и каждую
+//     минуту сбрасывает core в /data/dumps. Удаление дампов освобождает
+//     место на время; /data заполняется снова, пока worker не остановлен.
+//
+// Каждый вызов инструмента хоста — одна минута. Состояние виновника — это
+// конечный автомат (см. state), а history записывает каждый переход с
+// действием, которое его вызвало, так что тест проверяет путь, которым шло
+// исправление (filling → refilling → stopped → fixed, см. host_test.go
+// в labs/lab04-autonomy), а не только ответ.
+
+// Состояния хоста: worker и его дампы.
+const (
+	stateFilling   = "filling"   // Worker падает в цикле, его дампы заполняют /data
+	stateRefilling = "refilling" // Дампы удалены, но worker всё ещё падает: /data заполняется снова
+	stateStopped   = "stopped"   // Worker остановлен: /data больше не растёт, дампы ещё на месте
+	stateFixed     = "fixed"     // Worker остановлен, дампы удалены
+)
+
+// dumpGB — сколько одно падение report-worker добавляет в /data/dumps.
+const dumpGB = 2
+
+// partition — смонтированная файловая система: её размер и что её занимает,
+// по каталогам.
+type partition struct {
+	device string
+	mount  string
+	sizeGB int
+	dirs   map[string]int // Занято ГБ, по каталогам
+}
+
+func (p *partition) usedGB() int {
+	used := 0
+	for _, gb := range p.dirs {
+		used += gb
+	}
+	return used
+}
+
+// percent — это Use% из df.
+func (p *partition) percent() int {
+	return p.usedGB() * 100 / p.sizeGB
+}
+
+// transition — изменение состояния хоста.
+type transition struct {
+	Minute int
+	Action string // Вызов инструмента, который его вызвал, или "tick"
+	From   string
+	To     string
+}
+
+// host — симулированный сервер.
+type host struct {
+	minute     int
+	root       *partition
+	data       *partition
+	crashing   bool // report-worker падает в цикле
+	restarts   int  // Сколько раз report-worker уже упал
+	cleared    bool // Дампы удалили, пока он падал
+	cleanFails int  // Сколько вызовов clean_logs упадёт, прежде чем один сработает
+	logsClean  bool
+	history    []transition
+}
+
+// newHost возвращает хост в момент, когда сработал алерт по диску.
+func newHost() *host {
+	return &host{
+		root: &partition{device: "/dev/sda1", mount: "/", sizeGB: 50, dirs: map[string]int{
+			"/usr": 14, "/var/log": 20, "/home": 6, "/opt": 5,
+		}},
+		data: &partition{device: "/dev/sdb1", mount: "/data", sizeGB: 200, dirs: map[string]int{
+			"/data/db": 60, "/data/dumps": 130,
+		}},
+		crashing:   true,
+		restarts:   65,
+		cleanFails: 1,
+	}
+}
+
+// state — где хост находится в конечном автомате.
+func (h *host) state() string {
+	switch {
+	case h.crashing && h.cleared:
+		return stateRefilling
+	case h.crashing:
+		return stateFilling
+	case h.data.dirs["/data/dumps"] > 0:
+		return stateStopped
+	default:
+		return stateFixed
+	}
+}
+
+// do выполняет один вызов инструмента: проходит минута, выполняется
+// действие, и записывается смена состояния.
+func (h *host) do(action string, fn func() (string, error)) (string, error) {
+	from := h.state()
+	h.tick()
+	result, err := fn()
+	if to := h.state(); to != from {
+		h.history = append(h.history, transition{Minute: h.minute, Action: action, From: from, To: to})
+	}
+	return result, err
+}
+
+// tick — одна минута: worker, который падает в цикле, сбрасывает ещё один
+// core, пока в /data для него есть место.
+func (h *host) tick() {
+	h.minute++
+	if !h.crashing {
+		return
+	}
+	h.restarts++
+	free := h.data.sizeGB - h.data.usedGB()
+	h.data.dirs["/data/dumps"] += min(dumpGB, free)
+}
+
+// df — это check_disk.
+func (h *host) df() string {
+	var b strings.Builder
+	b.WriteString("Filesystem   Size  Used  Avail  Use%  Mounted on\n")
+	for _, p := range []*partition{h.root, h.data} {
+		fmt.Fprintf(&b, "%-10s %5dG %4dG %5dG %4d%%  %s\n", p.device, p.sizeGB, p.usedGB(), p.sizeGB-p.usedGB(), p.percent(), p.mount)
+	}
+	for _, p := range []*partition{h.root, h.data} {
+		if p.percent() >= 90 {
+			fmt.Fprintf(&b, "CRITICAL: %s is %d%% full\n", p.mount, p.percent())
+		}
+	}
+	return b.String()
+}
+
+// du перечисляет каталоги под path, от самого большого.
+func (h *host) du(path string) (string, error) {
+	path = cmp.Or(strings.TrimSuffix(path, "/"), "/")
+	type entry struct {
+		dir string
+		gb  int
+	}
+	var entries []entry
+	for _, p := range []*partition{h.root, h.data} {
+		for dir, gb := range p.dirs {
+			if path == "/" && p == h.data {
+				continue // Другая файловая система (du -x)
+			}
+			if dir == path || strings.HasPrefix(dir, path+"/") || path == "/" {
+				entries = append(entries, entry{dir, gb})
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("du: cannot access '%s': No such file or directory", path)
+	}
+	slices.SortFunc(entries, func(a, b entry) int { return cmp.Or(b.gb-a.gb, strings.Compare(a.dir, b.dir)) })
+	var b strings.Builder
+	total := 0
+	for _, e := range entries {
+		fmt.Fprintf(&b, "%dG\t%s\n", e.gb, e.dir)
+		total += e.gb
+	}
+	if path == "/data/dumps" && h.data.dirs["/data/dumps"] > 0 {
+		fmt.Fprintf(&b, "(%d files: core.report-worker.<pid>, newest a minute old)\n", h.data.dirs["/data/dumps"]/dumpGB)
+	}
+	fmt.Fprintf(&b, "%dG\ttotal\n", total)
+	return b.String(), nil
+}
+
+// listLogs — то, что печатает `du -ah /var/log` на сервере, который никуда
+// не отправлял старые логи: само по себе больше, чем вмещает контекстное
+// окно маленькой модели (см. Config.MaxToolResult). После очистки остаются
+// только текущие логи.
+func (h *host) listLogs() string {
+	oldest := 30
+	if h.logsClean {
+		oldest = 1
+	}
+	var b strings.Builder
+	for _, name := range []string{"syslog", "kern.log", "auth.log", "nginx/access.log", "nginx/error.log", "payment/app.log"} {
+		for day := oldest; day >= 1; day-- {
+			fmt.Fprintf(&b, "%dM\t/var/log/%s.%d.gz\n", 20+day*3, name, day)
+		}
+	}
+	fmt.Fprintf(&b, "%dG\t/var/log\n", h.root.dirs["/var/log"])
+	return b.String()
+}
+
+// cleanLogs удаляет ротированные логи из /var/log, если logrotate не держит
+// блокировку.
+func (h *host) cleanLogs() (string, error) {
+	if h.cleanFails > 0 {
+		h.cleanFails--
+		return "", fmt.Errorf("logrotate is running (pid 4242) and holds the lock on /var/log; it is done in a minute")
+	}
+	if h.logsClean {
+		return "No old logs left to clean. Freed 0GB.", nil
+	}
+	freed := h.root.dirs["/var/log"] - 2
+	h.root.dirs["/var/log"] = 2
+	h.logsClean = true
+	return fmt.Sprintf("Logs cleaned. Freed %dGB.", freed), nil
+}
+
+// serviceStatus — это systemctl status для юнитов хоста.
+func (h *host) serviceStatus(name string) (string, error) {
+	switch name {
+	case "report-worker":
+		if !h.crashing {
+			return "report-worker.service: inactive (dead) since the agent stopped it", nil
+		}
+		return fmt.Sprintf("report-worker.service: activating (auto-restart)\n"+
+			"Restarted %d times; last exit: signal SEGV, core dumped to /data/dumps", h.restarts), nil
+	case "postgresql":
+		return "postgresql.service: active (running), data in /data/db", nil
+	case "nginx", "payment":
+		return name + ".service: active (running)", nil
+	}
+	return "", fmt.Errorf("Unit %s.service could not be found. Units: nginx, payment, postgresql, report-worker", name)
+}
+
+// stopService останавливает юнит; без простоя можно остановить только
+// report-worker.
+func (h *host) stopService(name string) (string, error) {
+	switch name {
+	case "report-worker":
+		if !h.crashing {
+			return "report-worker is already stopped.", nil
+		}
+		h.crashing = false
+		return "Stopped report-worker.service. It no longer restarts.", nil
+	case "postgresql", "nginx", "payment":
+		return "", fmt.Errorf("refusing to stop %s: it serves production traffic", name)
+	}
+	return "", fmt.Errorf("Unit %s.service not loaded", name)
+}
+
+// cleanDumps удаляет core-дампы из /data/dumps.
+func (h *host) cleanDumps() string {
+	gb := h.data.dirs["/data/dumps"]
+	if gb == 0 {
+		return "No core dumps to delete."
+	}
+	h.data.dirs["/data/dumps"] = 0
+	if h.crashing {
+		h.cleared = true
+	}
+	return fmt.Sprintf("Deleted %d core dumps, freed %dGB.", gb/dumpGB, gb)
+}
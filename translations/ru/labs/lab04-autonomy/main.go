@@ -2,97 +2,263 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"regexp"
+	"strings"
+	"time"
 
+	"github.com/kshvakov/agent/pkg/agent"
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/runs"
+	"github.com/kshvakov/agent/pkg/tools"
+	"github.com/kshvakov/agent/pkg/trace"
 	"github.com/sashabaranov/go-openai"
 )
 
-// Mock Tools
-func checkDisk() string { return "Disk Usage: 95% (CRITICAL). Large folder: /var/log" }
-func cleanLogs() string { return "Logs cleaned. Freed 20GB." }
+// intentPhrases объявляют действие, которое модель собирается выполнить.
+var intentPhrases = []string{"i will", "i'll", "i’ll", "i'm going to", "i am going to", "let me", "now run", "now call"}
+
+// intentReach — через сколько слов после объявления должен идти инструмент:
+// "I will now run check_disk" — это вызов, "let me know if you want me to
+// run clean_dumps" — вопрос.
+const intentReach = 4
+
+// textualToolCall находит нарушенный контракт вызова инструментов: модель
+// объявляет вызов обычным текстом ("I will now run check_disk") вместо
+// ToolCall. Инструмент должен идти за объявлением в том же предложении:
+// финальный ответ "running clean_logs freed 18GB" сообщает о вызове, а не
+// объявляет его. Возвращает имя инструмента, о котором шла речь.
+func textualToolCall(content string, tools []string) (string, bool) {
+	sentences := strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return strings.ContainsRune(".!?\n", r)
+	})
+	for _, sentence := range sentences {
+		for _, p := range intentPhrases {
+			_, after, ok := strings.Cut(sentence, p)
+			if !ok {
+				continue
+			}
+			words := strings.Fields(after)
+			next := " " + strings.Join(words[:min(len(words), intentReach)], " ") + " "
+			for _, name := range tools {
+				// Модели пишут и "check_disk", и "check disk".
+				if mentionsWord(next, name) || mentionsWord(next, strings.ReplaceAll(name, "_", " ")) {
+					return name, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// mentionsWord сообщает, есть ли в text слово name целиком: "du" есть в
+// "run du on /data", но не в "during".
+func mentionsWord(text, name string) bool {
+	return regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\b`).MatchString(text)
+}
+
+// repairNudge — корректирующее системное сообщение после текстового вызова инструмента.
+func repairNudge(tool string) string {
+	return fmt.Sprintf("You described calling %s in text, but did not call it. "+
+		"Do not describe actions — call the tool via the tool-calling API.", tool)
+}
 
 func main() {
+	// Автономный агент сам тратит деньги и время. Бюджет ограничивает и то,
+	// и другое: запуск, который бы его превысил, останавливается с итогом,
+	// а не крутится дальше. Попробуйте -max-tokens 150, чтобы увидеть остановку.
+	var budget agent.Budget
+	flag.IntVar(&budget.Steps, "max-steps", 15, "LLM calls per run")
+	flag.IntVar(&budget.Tokens, "max-tokens", 20_000, "prompt and completion tokens per run")
+	flag.Float64Var(&budget.Dollars, "max-cost", 0.05, "estimated cost per run, in dollars")
+	flag.DurationVar(&budget.Time, "max-time", 2*time.Minute, "wall time per run")
+	// Цикл заканчивается, когда цель достигнута, а не когда модель перестает
+	// вызывать инструменты. Попробуйте -threshold 30, чтобы увидеть, как он сдается.
+	judge := flag.String("judge", "rule", "who evaluates the goal: rule (checks the host) or llm (reads the run)")
+	threshold := flag.Int("threshold", 80, "disk usage the goal allows on every partition, percent")
+	attempts := flag.Int("attempts", 3, "runs before the agent gives up on the goal")
+	flag.Parse()
+	if *judge != "rule" && *judge != "llm" {
+		fmt.Fprintf(os.Stderr, "-judge: want rule or llm, not %q\n", *judge)
+		os.Exit(2)
+	}
+
 	// 1. Настройка клиента (Local-First)
-	token := os.Getenv("OPENAI_API_KEY")
-	baseURL := os.Getenv("OPENAI_BASE_URL")
-	if token == "" {
-		token = "dummy"
+	// LLM_PROVIDER выбирает бэкенд: openai (любой OpenAI-совместимый сервер), llamacpp, ollama, anthropic.
+	client, err := llm.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
-	config := openai.DefaultConfig(token)
-	if baseURL != "" {
-		config.BaseURL = baseURL
+	// Ctrl+C останавливает запуск после текущего шага и печатает, что сделано.
+	ctx, stop := agent.Interruptible(context.Background())
+	defer stop()
+
+	// Каждый шаг пишется как структурное событие: по умолчанию текстом в stdout,
+	// строками JSON с AGENT_TRACE=json или AGENT_TRACE=<файл> (см. pkg/trace).
+	tr, err := trace.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	client := openai.NewClientWithConfig(config)
+	defer tr.Close()
+
+	// С заданным OTEL_EXPORTER_OTLP_ENDPOINT запуск экспортируется и как
+	// спаны OpenTelemetry: запуск → итерации → вызовы LLM и инструментов.
+	tracer := trace.TracerFromEnv("lab04-autonomy")
 
-	ctx := context.Background()
+	// Артефакты запуска пишутся в runs/<id>/ (см. `agentctl replay <id>`).
+	run, err := runs.New(runs.Root(), "lab04-autonomy", "gpt-4o-mini")
+	if err != nil {
+		panic(fmt.Sprintf("Run artifacts: %v", err))
+	}
+	status := exitGaveUp
+	defer func() { run.Close(status) }()
 
-	// 2. Определяем инструменты
-	tools := []openai.Tool{
-		{
-			Type: openai.ToolTypeFunction,
-			Function: &openai.FunctionDefinition{
-				Name:        "check_disk",
-				Description: "Check current disk usage",
+	// 2. Сам цикл (вызов LLM -> выполнение ToolCalls -> повтор) живет в pkg/agent;
+	// лаба его настраивает: промпт, инструменты и починку ответа.
+	var a *agent.Agent
+	mutating := map[string]bool{} // Инструменты, которые меняют хост, см. шаг 3
+	a = agent.New(client, agent.Config{
+		SystemPrompt: "You are an autonomous DevOps agent.",
+		Budget:       budget,
+		// Шаги ограничивает бюджет; итерации останавливают только запуск
+		// без него.
+		MaxIterations: 50,
+		Run:           run,
+		Trace:         tr,
+		Tracer:        tracer,
+		Hooks: agent.Hooks{
+			// Починка ответа: pkg/agent делает не больше одной попытки за ход пользователя,
+			// поэтому модель, которая не умеет вызывать инструменты, не крутится в цикле.
+			// Результат инструмента, слишком большой для контекстного окна, отправляется
+			// частями, которые модель читает через read_more (попробуйте MOCK_CONTEXT_WINDOW=1000).
+			OnPaged: func(call openai.ToolCall, parts int) {
+				fmt.Printf("Result of %s is too large for the context window: sent in %d parts\n", call.Function.Name, parts)
 			},
-		},
-		{
-			Type: openai.ToolTypeFunction,
-			Function: &openai.FunctionDefinition{
-				Name:        "clean_logs",
-				Description: "Delete old logs to free space",
+			Repair: func(msg openai.ChatCompletionMessage) (string, string) {
+				name, ok := textualToolCall(msg.Content, a.ToolNames())
+				if !ok {
+					return "", ""
+				}
+				// Догадка не может менять хост: изменяющий инструмент
+				// модель вызывает сама — или не вызывает.
+				if mutating[name] {
+					fmt.Printf("Repair: model described %s in text; it changes the host, so it is not forced\n", name)
+					return repairNudge(name), ""
+				}
+				fmt.Printf("Repair: model described %s in text, forcing a real tool call\n", name)
+				return repairNudge(name), name
 			},
 		},
+	})
+
+	// 3. Определяем инструменты: каждый вызов — минута на симулированном хосте (host.go)
+	h := newHost()
+	hostTool := func(name, description string, fn func() (string, error)) agent.Tool {
+		return agent.Tool{Name: name, Description: description, Execute: func(context.Context, json.RawMessage) (string, error) {
+			return h.do(name, fn)
+		}}
+	}
+	noErr := func(fn func() string) func() (string, error) {
+		return func() (string, error) { return fn(), nil }
+	}
+	register := func(t agent.Tool) {
+		a.RegisterTool(t)
+		mutating[t.Name] = t.Mutating
 	}
+	register(hostTool("check_disk", "Check the usage of every partition (df -h)", noErr(h.df)))
+	register(hostTool("list_logs", "List the files in /var/log with their sizes", noErr(h.listLogs)))
+	cleanLogs := hostTool("clean_logs", "Delete the rotated logs in /var/log to free space on /", h.cleanLogs)
+	cleanLogs.Mutating = true
+	register(cleanLogs)
+	cleanDumps := hostTool("clean_dumps", "Delete the core dumps in /data/dumps", noErr(h.cleanDumps))
+	cleanDumps.Mutating = true
+	register(cleanDumps)
+	register(tools.New("du", "Disk usage of the directories under a path, largest first (du -x)", func(_ context.Context, args struct {
+		Path string `json:"path" description:"Directory, e.g. / or /data"`
+	}) (string, error) {
+		return h.do("du", func() (string, error) { return h.du(args.Path) })
+	}))
+	type unitArgs struct {
+		Name string `json:"name" description:"Unit name, e.g. nginx"`
+	}
+	register(tools.New("service_status", "Status of a systemd unit", func(_ context.Context, args unitArgs) (string, error) {
+		return h.do("service_status", func() (string, error) { return h.serviceStatus(args.Name) })
+	}))
+	stopService := tools.New("stop_service", "Stop a systemd unit", func(_ context.Context, args unitArgs) (string, error) {
+		return h.do("stop_service", func() (string, error) { return h.stopService(args.Name) })
+	})
+	stopService.Mutating = true
+	register(stopService)
 
-	messages := []openai.ChatCompletionMessage{
-		{Role: openai.ChatMessageRoleSystem, Content: "You are an autonomous DevOps agent."},
-		{Role: openai.ChatMessageRoleUser, Content: "У меня кончилось место. Разберись."},
+	// 4. Цель и кто ее оценивает: правило проверяет хост, судья читает
+	// запуск. Если судья не сработал, решает правило.
+	g := goal{Objective: "disk space freed", Threshold: *threshold}
+	evaluate := func(answer string) evaluation {
+		if *judge == "llm" {
+			e, err := g.judge(ctx, client, a.Messages(), answer)
+			if err == nil {
+				return e
+			}
+			fmt.Printf("Judge failed, using the rule: %v\n", err)
+		}
+		return g.rule(h)
 	}
 
 	fmt.Println("Starting Agent Loop...")
+	fmt.Println("Run ID:", run.ID())
+	fmt.Println("Goal:", g)
 
-	// 3. THE LOOP
-	for i := 0; i < 5; i++ {
-		req := openai.ChatCompletionRequest{
-			Model:    "gpt-4o-mini",
-			Messages: messages,
-			Tools:    tools,
-		}
+	// 5. THE LOOP
+	out, answer := loop(ctx, a, evaluate, *attempts, fmt.Sprintf("I'm out of disk space. Fix it. Objective: %s.", g))
+	status = out.State
+	switch out.State {
+	case exitSuccess:
+		fmt.Println("AI:", answer)
+		fmt.Println("Spent:", a.Spent())
+		run.WriteReport(answer)
+	case exitGaveUp, exitBudgetExceeded, exitInterrupted:
+		fmt.Printf("\nSo far:\n%s", a.Recap())
+	}
+	fmt.Printf("\nLoop ended: %s (%s)\n", out.State, out.Reason)
+	fmt.Printf("Host: %s at minute %d\n", h.state(), h.minute)
+	for _, t := range h.history {
+		fmt.Printf("  minute %d, %s: %s → %s\n", t.Minute, t.Action, t.From, t.To)
+	}
+}
 
-		resp, err := client.CreateChatCompletion(ctx, req)
-		if err != nil {
-			panic(fmt.Sprintf("API Error: %v", err))
+// loop запускает агента, пока цель не достигнута или цикл не может
+// продолжаться, и возвращает, чем он закончился, с последним ответом. После
+// каждого запуска цель оценивается: за запуском, не дошедшим до нее, идет
+// следующий с объяснением причины, всего до attempts запусков.
+func loop(ctx context.Context, a *agent.Agent, evaluate func(answer string) evaluation, attempts int, task string) (outcome, string) {
+	msg := task
+	for i := 1; ; i++ {
+		answer, err := a.Run(ctx, msg)
+		switch {
+		case errors.Is(err, context.Canceled):
+			return outcome{exitInterrupted, "stopped by Ctrl+C"}, ""
+		case errors.Is(err, agent.ErrBudget):
+			return outcome{exitBudgetExceeded, err.Error()}, ""
+		case errors.Is(err, agent.ErrMaxIterations):
+			return outcome{exitGaveUp, err.Error()}, ""
+		case err != nil:
+			return outcome{exitFailed, fmt.Sprintf("API error: %v", err)}, ""
 		}
-
-		msg := resp.Choices[0].Message
-		messages = append(messages, msg)
-
-		// 4. Анализируем ответ
-		if len(msg.ToolCalls) == 0 {
-			fmt.Println("AI:", msg.Content)
-			break
+		e := evaluate(answer)
+		fmt.Printf("Goal check %d/%d (%s): achieved=%t, %s\n", i, attempts, e.By, e.Achieved, e.Reason)
+		if e.Achieved {
+			return outcome{exitSuccess, e.Reason}, answer
 		}
-
-		// 5. Выполняем инструменты
-		for _, toolCall := range msg.ToolCalls {
-			fmt.Printf("Executing tool: %s\n", toolCall.Function.Name)
-
-			var result string
-			if toolCall.Function.Name == "check_disk" {
-				result = checkDisk()
-			} else if toolCall.Function.Name == "clean_logs" {
-				result = cleanLogs()
-			}
-
-			fmt.Println("Tool Output:", result)
-
-			messages = append(messages, openai.ChatCompletionMessage{
-				Role:       openai.ChatMessageRoleTool,
-				Content:    result,
-				ToolCallID: toolCall.ID,
-			})
+		if i >= attempts {
+			return outcome{exitGaveUp, fmt.Sprintf("%d attempts, and %s", attempts, e.Reason)}, answer
 		}
+		msg = fmt.Sprintf("The objective is not achieved: %s. Continue until it is, or say what blocks you.", e.Reason)
 	}
 }
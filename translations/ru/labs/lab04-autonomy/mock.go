@@ -0,0 +1,69 @@
+package main
+
+import (
+	"regexp"
+
+	"github.com/kshvakov/agent/pkg/mockllm"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Офлайн-запуск: OPENAI_BASE_URL=mock go run .
+// Первый ответ описывает вызов инструмента текстом, чтобы показать починку в деле.
+// С MOCK_CONTEXT_WINDOW=1000 листинг /var/log не помещается: модель
+// читает его по частям, как говорят маркеры продолжения.
+//
+// Модель приспосабливается к хосту (host.go): повторяет clean_logs, когда
+// logrotate закончил, и удаляет core-дампы из /data. Это освобождает
+// место, но worker продолжает падать, так что цель не достигнута; второй
+// запуск сначала останавливает worker.
+//
+// С -judge llm цель оценивается JSON-вызовом, который отличается своим
+// промптом; эти ходы идут первыми, так что на него не отвечает никакой другой ход.
+func init() {
+	judge := mockllm.All(mockllm.JSONMode, mockllm.Mentions("You check whether an agent achieved its objective"))
+	summarizer := func(req openai.ChatCompletionRequest) bool { return !mockllm.HasTools(req) && !judge(req) }
+	mockllm.Register(
+		mockllm.Say(`{"achieved": false, "reason": "du shows a core dump a minute old in /data/dumps: /data will fill again"}`).If(judge),
+		mockllm.Say(`{"achieved": true, "reason": "report-worker is stopped and check_disk shows every partition below the threshold"}`).If(judge),
+		// llm.WithCondense сначала пробует сводку: листинг она ужать не может.
+		mockllm.Say("The user is out of disk space.").If(summarizer),
+		mockllm.Say("I will now run check_disk to see what takes the space."),
+		mockllm.Call("check_disk", nil),
+		mockllm.Call("list_logs", nil),
+	)
+	for range 3 {
+		mockllm.Register(mockllm.Turn{Reply: readMore}.If(continued))
+	}
+	mockllm.Register(
+		mockllm.Call("clean_logs", nil),
+		mockllm.Think("logrotate holds the lock for a minute. Checking the disk meanwhile.", "check_disk", nil),
+		mockllm.Call("clean_logs", nil),
+		mockllm.Think("/ is fine now, but /data is almost full.", "du", map[string]any{"path": "/data"}),
+		mockllm.Call("du", map[string]any{"path": "/data/dumps"}),
+		mockllm.Call("clean_dumps", nil),
+		mockllm.Call("check_disk", nil),
+		mockllm.Say("Freed 18GB of old logs on / and the core dumps on /data."),
+		// Второй запуск: проверка цели говорит, что /data заполняется снова.
+		mockllm.Call("service_status", map[string]any{"name": "report-worker"}),
+		mockllm.Think("report-worker crash-loops and dumps a core every minute: stopping it.", "stop_service", map[string]any{"name": "report-worker"}),
+		mockllm.Call("clean_dumps", nil),
+		mockllm.Call("check_disk", nil),
+		mockllm.Say("/ was full of old logs, /data of core dumps from report-worker, which crashed every minute. "+
+			"Logs and dumps are deleted and report-worker is stopped: / is at 54%, /data at 30%. report-worker needs a fix before it is started again."),
+	)
+}
+
+// moreMarker — конец части постраничного результата (см. pkg/agent).
+var moreMarker = regexp.MustCompile(`Call read_more with id "([^"]+)" and part (\d+) for the rest`)
+
+// continued принимает запрос, последнее сообщение которого — часть, за которой есть продолжение.
+func continued(req openai.ChatCompletionRequest) bool {
+	n := len(req.Messages)
+	return n > 0 && moreMarker.MatchString(req.Messages[n-1].Content)
+}
+
+// readMore просит часть, которую называет маркер.
+func readMore(req openai.ChatCompletionRequest) mockllm.Turn {
+	m := moreMarker.FindStringSubmatch(req.Messages[len(req.Messages)-1].Content)
+	return mockllm.Call("read_more", `{"id": "`+m[1]+`", "part": `+m[2]+`}`)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/kshvakov/agent/pkg/mockllm"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Офлайн-запуск: OPENAI_BASE_URL=mock go run .
+// Сценарий проигрывает три тестовых сценария из README.
+func init() {
+	mockllm.Register(
+		// 1. Удаление: сначала спросить, удалить после "yes".
+		mockllm.Turn{When: mockllm.Mentions("delete"), Reply: func(req openai.ChatCompletionRequest) mockllm.Turn {
+			return mockllm.Say("Deleting " + dbName(req) + " cannot be undone. Are you sure? (yes/no)")
+		}},
+		mockllm.Turn{When: mockllm.Mentions("yes"), Reply: func(req openai.ChatCompletionRequest) mockllm.Turn {
+			return mockllm.Call("delete_db", map[string]any{"name": dbName(req)})
+		}},
+		mockllm.Say("Done, the database is deleted.").If(mockllm.Mentions("yes")),
+
+		// 2. Email: спросить недостающие параметры, затем отправить.
+		mockllm.Say("Sure. What should the subject and the text be?").If(mockllm.Mentions("email")),
+		mockllm.Turn{When: asked("subject"), Reply: func(req openai.ChatCompletionRequest) mockllm.Turn {
+			return mockllm.Call("send_email", map[string]any{"to": "boss", "subject": "Status", "body": mockllm.LastUser(req)})
+		}},
+		mockllm.Say("The email is sent.").If(asked("subject")),
+
+		// 3. Длинный ответ, который можно прервать, пока он стримится.
+		mockllm.Say(strings.Repeat("A backup is a copy of the data taken at a point in time, stored away from the primary server. "+
+			"Full backups copy everything, incremental ones only what changed since the previous backup, and "+
+			"point-in-time recovery replays the write-ahead log on top of the last full copy. ", 3)).If(mockllm.Mentions("explain")),
+		mockllm.Say("A backup is a copy of your data you can restore after a failure.").If(mockllm.Mentions("short")),
+	)
+}
+
+var deleteTarget = regexp.MustCompile(`(?i)delete\s+(?:the\s+)?(\w+)`)
+
+// dbName находит базу данных, которую пользователь попросил удалить.
+func dbName(req openai.ChatCompletionRequest) string {
+	for _, m := range req.Messages {
+		if match := deleteTarget.FindStringSubmatch(m.Content); m.Role == openai.ChatMessageRoleUser && match != nil {
+			return match[1]
+		}
+	}
+	return "the database"
+}
+
+// asked принимает запросы, в которых последний вопрос ассистента упоминал text.
+func asked(text string) func(openai.ChatCompletionRequest) bool {
+	return func(req openai.ChatCompletionRequest) bool {
+		for i := len(req.Messages) - 1; i >= 0; i-- {
+			m := req.Messages[i]
+			if m.Role == openai.ChatMessageRoleAssistant && m.Content != "" {
+				return strings.Contains(strings.ToLower(m.Content), text)
+			}
+		}
+		return false
+	}
+}
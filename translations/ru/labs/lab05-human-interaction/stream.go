@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Стриминг с прерыванием ---
+//
+// Длинное объяснение или план может генерироваться много секунд. Вместо того
+// чтобы ждать весь ответ, он стримится, и пользователь может вмешаться:
+// строка, набранная (или просто нажатый Enter), пока агент «говорит»,
+// останавливает стрим. Частичный ответ остаётся в истории, так что модель знает,
+// где её прервали, а поправка уходит следующим сообщением пользователя.
+
+// readLines читает stdin в своей горутине, чтобы цикл чата мог одновременно
+// ждать ввода пользователя и кусков стрима. На EOF канал закрывается.
+func readLines(r io.Reader) <-chan string {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		sc := bufio.NewScanner(r)
+		for sc.Scan() {
+			lines <- sc.Text()
+		}
+	}()
+	return lines
+}
+
+// streamReply стримит один ответ, передавая content в onContent по мере
+// поступления. Если раньше из interrupts приходит строка, стрим останавливается,
+// и частичный ответ возвращается с interrupted=true и строкой в качестве
+// поправки (пустой, если пользователь только нажал Enter).
+func streamReply(ctx context.Context, client llm.Provider, req openai.ChatCompletionRequest,
+	interrupts <-chan string, onContent func(string)) (reply openai.ChatCompletionMessage, correction string, interrupted bool, err error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req.Stream = true
+	stream, err := client.Stream(ctx, req)
+	if err != nil {
+		return reply, "", false, err
+	}
+	defer stream.Close()
+
+	type chunk struct {
+		resp openai.ChatCompletionStreamResponse
+		err  error
+	}
+	chunks := make(chan chunk)
+	go func() {
+		for {
+			resp, err := stream.Recv()
+			select {
+			case chunks <- chunk{resp, err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	reply.Role = openai.ChatMessageRoleAssistant
+	for {
+		select {
+		case line, ok := <-interrupts:
+			if !ok {
+				interrupts = nil // stdin закрыт: прервать больше нечем
+				continue
+			}
+			// Частичные вызовы инструментов отбрасываются: их аргументы могут быть обрезаны посреди JSON.
+			reply.ToolCalls = nil
+			return reply, line, true, nil
+		case c := <-chunks:
+			if errors.Is(c.err, io.EOF) {
+				return reply, "", false, nil
+			}
+			if c.err != nil {
+				return reply, "", false, c.err
+			}
+			if len(c.resp.Choices) == 0 {
+				continue
+			}
+			delta := c.resp.Choices[0].Delta
+			if delta.Content != "" {
+				reply.Content += delta.Content
+				onContent(delta.Content)
+			}
+			reply.ToolCalls = llm.MergeToolCalls(reply.ToolCalls, delta.ToolCalls)
+		}
+	}
+}
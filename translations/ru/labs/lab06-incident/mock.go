@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/kshvakov/agent/pkg/mockllm"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Офлайн-запуск: OPENAI_BASE_URL=mock go run . [-scenario cert|flap|db|cascade]
+// Сценарная модель следует SOP в каждом сценарии: подтверждает
+// пейдж, разбирает инцидент и закрывает пейдж. При -severity SEV3 она
+// сначала исключает сертификат и только потом действует.
+func init() {
+	flap := mockllm.Mentions("database errors")
+	db := mockllm.Mentions("payments are failing")
+	cascade := mockllm.Mentions("checkouts time out")
+	down := mockllm.All(mockllm.Mentions("is down"), func(req openai.ChatCompletionRequest) bool { return !flap(req) && !db(req) && !cascade(req) })
+	cert := mockllm.Mentions("certificate")
+	sev3 := mockllm.Mentions("[SEV3]")
+	resolve := func(note string) mockllm.Turn {
+		return mockllm.Think("SOP: closing the page.", "pager", map[string]any{"action": "resolve", "note": note})
+	}
+	mockllm.Register(
+		// db, после эскалации (или лимита итераций, с -loop 0):
+		// передача дел команде баз данных (agent.Handoff, JSON mode).
+		// Первым, потому что его промпт теперь — последнее сообщение пользователя
+		// и тоже может упоминать "is down", на что срабатывают ходы config.
+		mockllm.Say(`{"hypothesis": "db-main is down, so the payment service can't connect to its database and fails to start.",
+			"evidence": [
+				{"tool": "read_logs", "excerpt": "Connection refused: db-main:5432"},
+				{"tool": "restart_service", "excerpt": "Exit code 1 (database unavailable)"}],
+			"next_actions": [
+				{"action": "Check db-main: is the process up, is port 5432 open, is the disk full?", "risk": "low", "why": "The logs point at the database, not the service."},
+				{"action": "Bring db-main back (restart or fail over to the replica)", "risk": "high", "why": "Payments fail until the database is back; a failover can lose recent writes."},
+				{"action": "Restart the payment service once db-main is up", "tool": "restart_service", "risk": "low", "why": "It may not reconnect on its own."}]}`).
+			If(mockllm.All(mockllm.JSONMode, toolSaid("Connection refused: db-main"))),
+
+		mockllm.Think("SOP step 1: acknowledge the page before anything else.", "pager", map[string]any{"action": "ack"}),
+
+		// config: проверка → логи → откат → верификация
+		mockllm.Think("SOP step 2: check the HTTP status.", "check_http", nil).If(down),
+		mockllm.Think("502. SOP step 3: read the logs before acting.", "read_logs", nil).If(down),
+		mockllm.Think("SEV3, there is time: ruling out the certificate before acting.", "check_cert", nil).If(mockllm.All(down, sev3)),
+		mockllm.Think("Logs show a config syntax error: restart won't help, rolling back.", "rollback_deploy", nil).If(down),
+		mockllm.Think("Verifying the fix.", "check_http", nil).If(down),
+		resolve("Bad v2.0 config, rolled back to v1.9.").If(down),
+		mockllm.Say("Resolved: the v2.0 deploy had a config syntax error; rolled back to v1.9, HTTP is 200 OK.").If(down),
+
+		// flap: проверка → логи → рестарт, который блокирует перепроверка
+		// (-ttl > 0), потому что сервис тем временем восстановился → верификация
+		mockllm.Think("SOP step 2: check the HTTP status.", "check_http", nil).If(flap),
+		mockllm.Think("502. SOP step 3: read the logs before acting.", "read_logs", nil).If(flap),
+		mockllm.Think("Logs show a connection error: transient, restarting.", "restart_service", nil).If(flap),
+		// С -ttl 0 рестарт попадает в восстановившийся сервис. Модель
+		// принимает потерянные платежи за новый сбой и хватается за
+		// следующее исправление: -unattended сдерживает метания.
+		mockllm.Think("Payments were dropped after the restart: the deploy may be broken, rolling back.", "rollback_deploy", nil).
+			If(mockllm.All(flap, toolSaid("payments dropped"))),
+		mockllm.Think("Checking the service state.", "check_http", nil).If(flap),
+		resolve("Recovered on its own when the database came back.").If(mockllm.All(flap, toolSaid("facts changed"))),
+		mockllm.Say("No restart needed: the service recovered on its own when the database came back. HTTP is 200 OK.").
+			If(mockllm.All(flap, toolSaid("facts changed"))),
+		resolve("Lost database connection, restarted.").If(flap),
+		mockllm.Say("Resolved: the service had lost its database connection; restarted it, HTTP is 200 OK.").If(flap),
+
+		// db: проверка → логи → рестарт, который падает → проверка снова и снова,
+		// пока подсказка о зацикливании (-loop) не заставит эскалировать
+		mockllm.Think("SOP step 2: check the HTTP status.", "check_http", nil).If(db),
+		mockllm.Think("502. SOP step 3: read the logs before acting.", "read_logs", nil).If(db),
+		mockllm.Think("Logs show a connection error: transient, restarting.", "restart_service", nil).If(db),
+		mockllm.Think("Repeating the check won't help: db-main is down. Escalating.", "pager",
+			map[string]any{"action": "escalate", "note": "db-main is down, payment service can't start. For the database team."}).
+			If(mockllm.All(db, systemSaid("same arguments"))),
+		mockllm.Say("The database db-main is down and a restart can't fix that. Escalating to the database team; the service will recover when db-main is back.").
+			If(mockllm.All(db, systemSaid("same arguments"))),
+	)
+	for range 15 { // Config.MaxIterations
+		mockllm.Register(mockllm.Think("Maybe it has recovered by now. Checking again.", "check_http", nil).If(db))
+	}
+	mockllm.Register(
+		// cascade: проверка → логи винят db-main → inventory → db-main винит
+		// cache-main → у cache-main кончилась память → рестарт → верификация
+		mockllm.Think("SOP step 2: check the HTTP status.", "check_http", nil).If(cascade),
+		mockllm.Think("502. SOP step 3: read the logs before acting.", "read_logs", nil).If(cascade),
+		mockllm.Think("The logs blame db-main, not the service: restarting the service won't help. Looking up its dependencies.", "inventory", nil).If(cascade),
+		mockllm.Think("Checking db-main.", "check_service", map[string]any{"service": "db-main"}).If(cascade),
+		mockllm.Think("db-main is up but out of connections. Reading its logs.", "read_service_logs", map[string]any{"service": "db-main"}).If(cascade),
+		mockllm.Think("db-main can't reach cache-main and reads from disk. Checking cache-main.", "check_service", map[string]any{"service": "cache-main"}).If(cascade),
+		mockllm.Think("cache-main is down. Reading its logs.", "read_service_logs", map[string]any{"service": "cache-main"}).If(cascade),
+		mockllm.Think("cache-main was killed for running out of memory: it is the broken one. Restarting it.", "restart_dependency", map[string]any{"service": "cache-main"}).If(cascade),
+		mockllm.Think("Verifying the Payment Service.", "check_http", nil).If(cascade),
+		resolve("cache-main OOM-killed; db-main ran out of connections reading from disk. Restarted cache-main. Set its maxmemory.").If(cascade),
+		mockllm.Say("Resolved: cache-main was killed for running out of memory, so db-main served every session read from disk and ran out of connections, and payments timed out. Restarted cache-main; HTTP is 200 OK. Its maxmemory is not set: the platform team should set it before it happens again.").If(cascade),
+
+		// cert: проверка срока → обновление до дедлайна → верификация
+		mockllm.Think("Checking when the certificate expires.", "check_cert", nil).If(cert),
+		mockllm.Think("It expires in minutes, and renewal takes 2 minutes: renewing now.", "renew_cert", nil).If(cert),
+		mockllm.Think("Verifying the service is still up.", "check_http", nil).If(cert),
+		resolve("Certificate renewed before expiry.").If(cert),
+		mockllm.Say("Certificate renewed before expiry; the service stayed up.").If(cert),
+	)
+}
+
+// systemSaid принимает запросы с system-сообщением, содержащим text.
+func systemSaid(text string) func(openai.ChatCompletionRequest) bool {
+	return func(req openai.ChatCompletionRequest) bool {
+		for _, m := range req.Messages[1:] {
+			if m.Role == openai.ChatMessageRoleSystem && strings.Contains(m.Content, text) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// toolSaid принимает запросы с результатом инструмента, содержащим text.
+func toolSaid(text string) func(openai.ChatCompletionRequest) bool {
+	return func(req openai.ChatCompletionRequest) bool {
+		for _, m := range req.Messages {
+			if m.Role == openai.ChatMessageRoleTool && strings.Contains(m.Content, text) {
+				return true
+			}
+		}
+		return false
+	}
+}
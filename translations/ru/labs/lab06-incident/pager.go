@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// --- Severity ---
+// Алерт приходит с severity, и severity решает, как разбирается
+// инцидент: SEV1 стоит платежей каждую минуту, поэтому диагностика,
+// которая не меняет исправление, пропускается; SEV3 оставляет время на
+// аккуратный путь.
+type severity struct {
+	ackWithin   time.Duration // После этого пейдж уходит второму дежурному
+	closeWithin time.Duration // Решён или эскалирован за это время, иначе оценка не пройдена
+	ttl         time.Duration // -ttl по умолчанию: насколько скоро проверки перезапускаются перед действием
+	rule        string        // Добавляется к SOP; пусто, если нечего
+}
+
+var severities = map[string]severity{
+	"SEV1": {
+		ackWithin:   5 * time.Minute,
+		closeWithin: 15 * time.Minute,
+		ttl:         2 * time.Minute, // Недавней проверки достаточно: без перепроверки перед исправлением
+		rule:        "This is a SEV1: payments are failing right now. Skip diagnostics that don't change the fix: act as soon as the logs show the cause.",
+	},
+	"SEV2": {
+		ackWithin:   15 * time.Minute,
+		closeWithin: time.Hour,
+		ttl:         30 * time.Second,
+	},
+	"SEV3": {
+		ackWithin:   time.Hour,
+		closeWithin: 4 * time.Hour,
+		ttl:         30 * time.Second,
+		rule:        "This is a SEV3: there is time for the careful path. Rule out the other causes (check the TLS certificate) before you act.",
+	},
+}
+
+// --- Pager ---
+// Алерт — это пейдж. Агент подтверждает его перед началом работы и
+// закрывает, когда закончил: resolved, когда сервис поднялся, escalated,
+// когда его не исправить. Пейдж, который никто вовремя не подтвердил, уходит
+// второму дежурному.
+var page struct {
+	severity string
+	ackedAt  time.Time
+	closedAt time.Time
+	closedAs string // "resolved" или "escalated"
+	note     string
+	missed   bool // Не подтверждён вовремя
+}
+
+// openPage открывает пейдж по алерту и планирует его эскалацию.
+func openPage(sev string) {
+	page.severity = sev
+	deadline := clock.Now().Add(severities[sev].ackWithin)
+	clock.At(deadline, func() {
+		if page.ackedAt.IsZero() {
+			page.missed = true
+			fmt.Printf("📟 %s page not acknowledged by %s: escalated to the secondary on-call\n", sev, deadline.Format("15:04:05"))
+		}
+	})
+}
+
+// pagerArgs — аргументы инструмента pager.
+type pagerArgs struct {
+	Action string `json:"action" enum:"ack,resolve,escalate" description:"ack when you start, resolve when the service is up again, escalate when you can't fix it"`
+	Note   string `json:"note,omitempty" description:"For resolve and escalate: one line on the cause and what was done, or who should take over"`
+}
+
+func pager(_ context.Context, args pagerArgs) (string, error) {
+	fmt.Printf("   [TOOL] Pager: %s\n", args.Action)
+	ran = append(ran, "pager "+args.Action)
+	switch {
+	case page.closedAs != "":
+		return fmt.Sprintf("Error: the page was already %s at %s.", page.closedAs, page.closedAt.Format("15:04:05")), nil
+	case args.Action == "ack" && !page.ackedAt.IsZero():
+		return fmt.Sprintf("The page was already acknowledged at %s.", page.ackedAt.Format("15:04:05")), nil
+	case args.Action == "ack":
+		page.ackedAt = clock.Now()
+		return fmt.Sprintf("%s page acknowledged. Close it within %s.", page.severity, severities[page.severity].closeWithin), nil
+	case page.ackedAt.IsZero():
+		return "Error: acknowledge the page first.", nil
+	}
+	page.closedAt, page.closedAs, page.note = clock.Now(), args.Action+"d", args.Note
+	if args.Action == "escalate" {
+		return "Page escalated. The owning team has been paged.", nil
+	}
+	return "Page resolved.", nil
+}
+
+// --- Оценка ---
+// ran называет каждый выполненный вызов инструмента по порядку: из этого
+// считается оценка. Вызовы pager — это "pager <action>", вызовы инструментов
+// inventory — "<tool> <service>".
+var ran []string
+
+// check — одна строка оценки.
+type check struct {
+	name string
+	ok   bool
+}
+
+// grade проверяет, как разбирался инцидент, по SOP и по
+// лимитам его severity.
+func grade() []check {
+	sev := severities[page.severity]
+	// index находит вызовы по имени ("restart_dependency") или по имени и
+	// аргументу ("restart_dependency db-main").
+	index := func(names ...string) (first, last int) {
+		first, last = -1, -1
+		for i, name := range ran {
+			if slices.Contains(names, name) || slices.Contains(names, strings.Fields(name)[0]) {
+				if first < 0 {
+					first = i
+				}
+				last = i
+			}
+		}
+		return first, last
+	}
+	firstAction, lastAction := index("restart_service", "rollback_deploy", "renew_cert", "restart_dependency")
+	firstDiagnosis, _ := index("read_logs", "check_cert", "read_service_logs")
+	_, lastCheck := index("check_http")
+	ack, _ := index("pager ack")
+
+	want := "resolved"
+	if serviceState["status"] != "running" {
+		want = "escalated"
+	}
+	checks := []check{
+		{fmt.Sprintf("page acknowledged within %s, before anything else", sev.ackWithin),
+			ack == 0 && !page.missed},
+		{"diagnosed (logs or certificate) before the first action",
+			firstAction < 0 || (firstDiagnosis >= 0 && firstDiagnosis < firstAction)},
+		{"HTTP checked after the last action",
+			lastCheck > lastAction},
+		{fmt.Sprintf("page %s (the service is %s)", want, serviceState["status"]),
+			page.closedAs == want},
+		{fmt.Sprintf("page closed within %s", sev.closeWithin),
+			page.closedAs != "" && page.closedAt.Sub(startedAt) <= sev.closeWithin},
+	}
+	return append(checks, topologyChecks(index)...)
+}
+
+// printGrade печатает оценку запуска.
+func printGrade(checks []check) {
+	passed := 0
+	for _, c := range checks {
+		if c.ok {
+			passed++
+		}
+	}
+	if page.closedAs != "" {
+		fmt.Printf("📟 Page %s at %s: %s\n", page.closedAs, page.closedAt.Format("15:04:05"), page.note)
+	}
+	fmt.Printf("📝 Grade (%s): %d/%d\n", page.severity, passed, len(checks))
+	for _, c := range checks {
+		mark := "✅"
+		if !c.ok {
+			mark = "❌"
+		}
+		fmt.Printf("  %s %s\n", mark, c.name)
+	}
+}
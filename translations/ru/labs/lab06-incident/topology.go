@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/agent"
+	"github.com/kshvakov/agent/pkg/tools"
+)
+
+// --- Топология (-scenario cascade) ---
+// Payment Service работает не сам по себе: он зависит от базы данных
+// db-main, а db-main обслуживает поиск сессий из кэша cache-main.
+// В сценарии cascade у кэша кончилась память. Каждый поиск
+// проваливается в базу, её пул соединений заполняется, и Payment
+// Service отваливается по таймауту в ожидании соединения. Алерт — про
+// платежи, логи платежей винят базу, а база работает.
+// Рестарт любого из них ничего не меняет: агент должен пройти по
+// зависимостям в inventory до сервиса, который сломан сам.
+
+// node — сервис в inventory.
+type node struct {
+	name      string
+	owner     string
+	dependsOn []string
+	role      string
+}
+
+var inventory = []node{
+	{"payment-service", "payments", []string{"db-main"}, "Takes payments; the service the alerts are about"},
+	{"db-main", "database", []string{"cache-main"}, "PostgreSQL; reads sessions from cache-main, from disk on a miss"},
+	{"cache-main", "platform", nil, "Redis; caches sessions for db-main"},
+}
+
+// cascading выставляет сценарий cascade: предлагаются инструменты
+// inventory, и оценка запуска получает проверки топологии.
+var cascading bool
+
+// serviceArgs называют сервис из inventory.
+type serviceArgs struct {
+	Service string `json:"service" enum:"payment-service,db-main,cache-main"`
+}
+
+// dependencyArgs называют сервис, от которого зависит Payment Service.
+type dependencyArgs struct {
+	Service string `json:"service" enum:"db-main,cache-main"`
+}
+
+func listServices(context.Context, struct{}) (string, error) {
+	fmt.Println("   [TOOL] Reading the service inventory...")
+	ran = append(ran, "inventory")
+	var b strings.Builder
+	for _, n := range inventory {
+		deps := "nothing"
+		if len(n.dependsOn) > 0 {
+			deps = strings.Join(n.dependsOn, ", ")
+		}
+		fmt.Fprintf(&b, "%s (owner: %s team) depends on %s. %s.\n", n.name, n.owner, deps, n.role)
+	}
+	return b.String(), nil
+}
+
+func checkService(_ context.Context, args serviceArgs) (string, error) {
+	fmt.Printf("   [TOOL] Checking %s...\n", args.Service)
+	ran = append(ran, "check_service "+args.Service)
+	switch args.Service {
+	case "payment-service":
+		return "HTTP " + checkHttp(), nil
+	case "db-main":
+		if serviceState["db"] == "slow" {
+			return "UP, degraded: 500/500 connections in use, p99 query latency 4.8s.", nil
+		}
+		return "UP: 40/500 connections in use, p99 query latency 12ms.", nil
+	}
+	if serviceState["cache"] == "oom" {
+		return "DOWN: connection refused on :6379.", nil
+	}
+	return "UP: 3% of 4 GiB used, hit rate 91%.", nil
+}
+
+func readServiceLogs(_ context.Context, args serviceArgs) (string, error) {
+	fmt.Printf("   [TOOL] Reading logs of %s...\n", args.Service)
+	ran = append(ran, "read_service_logs "+args.Service)
+	switch args.Service {
+	case "payment-service":
+		return readLogs(), nil
+	case "db-main":
+		if serviceState["db"] == "slow" {
+			return "WARN: cache-main:6379 unreachable, reading sessions from disk. " +
+				"FATAL: remaining connection slots are reserved. Slow query (4812 ms): SELECT * FROM sessions WHERE id = $1.", nil
+		}
+		return "LOG: checkpoint complete.", nil
+	}
+	if serviceState["cache"] == "oom" {
+		return "# WARNING: maxmemory is not set. Out of memory allocating 1048576 bytes! Killed by the OOM killer.", nil
+	}
+	return "Ready to accept connections.", nil
+}
+
+func restartDependency(_ context.Context, args dependencyArgs) (string, error) {
+	fmt.Printf("   [TOOL] Restarting %s...\n", args.Service)
+	ran = append(ran, "restart_dependency "+args.Service)
+	if args.Service == "db-main" {
+		if serviceState["db"] == "slow" {
+			dropped += 12
+			return "db-main restarted, 12 in-flight transactions rolled back. Connections back at 500/500 within 30s: sessions are still read from disk.", nil
+		}
+		return "db-main restarted.", nil
+	}
+	serviceState["cache"] = "up"
+	if serviceState["db"] == "slow" {
+		serviceState["db"] = "up"
+		serviceState["status"] = "running"
+	}
+	return "cache-main restarted. Status: Active, cache cold and warming. db-main connections falling: 120/500.", nil
+}
+
+// topologyTools — инструменты inventory: найти, проверить и прочитать
+// логи любого сервиса, перезапустить зависимость. Проверки действуют ttl;
+// inventory во время инцидента не меняется.
+func topologyTools(ttl time.Duration) []agent.Tool {
+	inv := tools.New("inventory", "List the services, their owners and what each one depends on.", listServices)
+	check := tools.New("check_service", "Check the health of a service from the inventory.", checkService)
+	logs := tools.New("read_service_logs", "Read the recent logs of a service from the inventory.", readServiceLogs)
+	restart := tools.New("restart_dependency",
+		"Restart a service the Payment Service depends on. Use ONLY on the service that is broken itself.", restartDependency)
+	check.TTL, logs.TTL = ttl, ttl
+	restart.Mutating = true
+	restart.Preview = tools.PreviewOf(func(args dependencyArgs) string {
+		return "systemctl restart " + args.Service
+	})
+	return []agent.Tool{inv, check, logs, restart}
+}
+
+// topologyRule добавляется к SOP в сценарии cascade.
+const topologyRule = "The Payment Service depends on other services (see the inventory tool). " +
+	"If its logs blame one of them, check that service and read its logs the same way, following the dependencies " +
+	"until you find the service that is broken itself. Fix that one: restarting a service that only suffers from it changes nothing."
+
+// topologyChecks оценивают сценарий cascade: агент прошёл по зависимостям
+// до кэша, прежде чем действовать, и не тронул сервисы, которые были
+// лишь симптомами. Пусто в остальных сценариях.
+func topologyChecks(index func(names ...string) (first, last int)) []check {
+	if !cascading {
+		return nil
+	}
+	firstAction, _ := index("restart_service", "rollback_deploy", "renew_cert", "restart_dependency")
+	reached, _ := index("check_service cache-main", "read_service_logs cache-main")
+	symptom, _ := index("restart_service", "rollback_deploy", "restart_dependency db-main")
+	return []check{
+		{"followed the dependencies to cache-main before the first action",
+			reached >= 0 && (firstAction < 0 || reached < firstAction)},
+		{"left the symptoms alone: no restart or rollback of payment-service or db-main",
+			symptom < 0},
+	}
+}
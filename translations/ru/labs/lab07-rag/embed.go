@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/vecindex"
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Эмбеддинги: ранжирование по смыслу (-eval -embeddings) ---
+//
+// Ранжировщики из retrieve.go сопоставляют слова: «сервис лежит» не находит
+// ничего про «рестарт». Эмбеддинги сравнивают смысл ценой вызова модели
+// на каждый текст. Чанки эмбеддятся один раз и хранятся в kb.vec
+// (pkg/vecindex); следующий запуск отправляет модели только новые или
+// изменённые чанки, а другая модель эмбеддингов пересобирает файл.
+
+// indexFile хранит эмбеддинги чанков и запросов eval.
+const indexFile = "kb.vec"
+
+// embeddingModel эмбеддит чанки и запросы.
+const embeddingModel = openai.SmallEmbedding3
+
+// embeddingRetriever эмбеддит чанки и запросы (те, которых нет в indexFile)
+// и возвращает ранжировщик, который упорядочивает чанки по косинусной
+// близости к запросу.
+func embeddingRetriever(ctx context.Context, client llm.Provider, chunks []Chunk, queries []string) (retriever, error) {
+	ix, err := vecindex.Open(indexFile, string(embeddingModel))
+	if err != nil {
+		return nil, err
+	}
+	if ix.Rebuilt != "" {
+		fmt.Printf("Rebuilding %s: %s\n", indexFile, ix.Rebuilt)
+	}
+	var texts []string
+	for _, c := range chunks {
+		texts = append(texts, searchable(c))
+	}
+	texts = append(texts, queries...)
+	ix.Retain(texts) // Чанки документов, изменённых с тех пор: больше никогда не найдутся
+	cached := ix.Len()
+	if _, err := ix.Embed(ctx, client, texts); err != nil {
+		return nil, fmt.Errorf("embeddings: %w", err)
+	}
+	if err := ix.Save(indexFile); err != nil {
+		return nil, err
+	}
+	fmt.Printf("%s: %d texts, %d embedded now\n\n", indexFile, ix.Len(), ix.Len()-cached)
+
+	return func(chunks []Chunk, query string) []Chunk {
+		q, ok := ix.Lookup(query)
+		if !ok {
+			return nil
+		}
+		var hits []scored
+		for _, c := range chunks {
+			v, _ := ix.Lookup(searchable(c))
+			hits = append(hits, scored{c, vecindex.Cosine(q, v)})
+		}
+		return ranked(hits)
+	}, nil
+}
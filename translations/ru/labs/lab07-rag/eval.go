@@ -0,0 +1,120 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// --- Оценка поиска (-eval) ---
+//
+// Настраивать RAG, глядя на один запрос за раз, — это гадание. Eval set —
+// список запросов, размеченных чанками, которые на них отвечают; каждый
+// ранжировщик ранжирует базу знаний для каждого запроса, и первые k
+// результатов оцениваются:
+//
+//	precision@k  доля релевантных среди первых k
+//	recall@k     доля релевантных чанков, найденных в первых k
+//	MRR          1/ранг первого релевантного результата (0, если нет), в среднем
+
+//go:embed evalset.json
+var bundledEvalSet []byte
+
+// evalCase — один размеченный запрос. Релевантные чанки задаются через Chunk.ID.
+type evalCase struct {
+	Query    string   `json:"query"`
+	Relevant []string `json:"relevant"`
+}
+
+// loadEvalSet читает eval set из path или встроенный, если path
+// пустой.
+func loadEvalSet(path string) ([]evalCase, error) {
+	data := bundledEvalSet
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	var cases []evalCase
+	if err := json.Unmarshal(data, &cases); err != nil {
+		return nil, fmt.Errorf("eval set: %w", err)
+	}
+	return cases, nil
+}
+
+// metrics одного ранжировщика на одном запросе или, в сумме, на всём наборе.
+type metrics struct {
+	precision, recall, rr float64
+}
+
+// score меряет первые k результатов против ID релевантных чанков.
+// Чанки с общим ID (поддерево YAML, разбитое надвое) для recall считаются один раз.
+func score(results []Chunk, relevant []string, k int) metrics {
+	want := map[string]bool{}
+	for _, id := range relevant {
+		want[id] = true
+	}
+	found := map[string]bool{}
+	var m metrics
+	hits := 0
+	for i, c := range results[:min(len(results), k)] {
+		if !want[c.ID()] {
+			continue
+		}
+		hits++
+		found[c.ID()] = true
+		if m.rr == 0 {
+			m.rr = 1 / float64(i+1)
+		}
+	}
+	m.precision = float64(hits) / float64(k)
+	if len(want) > 0 {
+		m.recall = float64(len(found)) / float64(len(want))
+	}
+	return m
+}
+
+// evaluate прогоняет каждый ранжировщик на каждом случае и печатает средние
+// метрики, а затем запросы, которые каждый ранжировщик полностью упустил.
+func evaluate(w io.Writer, chunks []Chunk, cases []evalCase, k int) {
+	known := map[string]bool{}
+	for _, c := range chunks {
+		known[c.ID()] = true
+	}
+	for _, ec := range cases {
+		for _, id := range ec.Relevant {
+			if !known[id] {
+				fmt.Fprintf(w, "warning: %q: no chunk %q in the knowledge base (see -chunks)\n", ec.Query, id)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "%d queries, %d chunks, k=%d\n\n", len(cases), len(chunks), k)
+	fmt.Fprintf(w, "  %-10s %12s %9s %6s\n", "retriever", "precision@"+fmt.Sprint(k), "recall@"+fmt.Sprint(k), "MRR")
+	missed := map[string][]string{}
+	for _, r := range retrievers {
+		var sum metrics
+		for _, ec := range cases {
+			m := score(r.rank(chunks, ec.Query), ec.Relevant, k)
+			sum.precision += m.precision
+			sum.recall += m.recall
+			sum.rr += m.rr
+			if m.rr == 0 {
+				missed[r.name] = append(missed[r.name], fmt.Sprintf("%q", ec.Query))
+			}
+		}
+		n := float64(len(cases))
+		fmt.Fprintf(w, "  %-10s %12.2f %9.2f %6.2f\n", r.name, sum.precision/n, sum.recall/n, sum.rr/n)
+	}
+
+	fmt.Fprintln(w, "\nNothing relevant in the top k:")
+	for _, r := range retrievers {
+		if len(missed[r.name]) > 0 {
+			fmt.Fprintf(w, "  %-10s %s\n", r.name, strings.Join(missed[r.name], ", "))
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// --- Загрузка: документы → чанки ---
+//
+// Поиск возвращает чанки, а не файлы: целый файл — слишком много контекста, а
+// окно фиксированного размера режет процедуру пополам. Каждый формат режется
+// по своей структуре, так что чанк — это единица, которую процитировал бы
+// человек: раздел Markdown под своими заголовками, поддерево YAML под своим
+// путём ключей, объявление Go со своим doc-комментарием.
+
+// Chunk — один извлекаемый кусок документа.
+type Chunk struct {
+	Source string // Имя файла
+	Path   string // Место в файле: "Restart Protocol > Steps", "spec.template", "func Drain"
+	Text   string
+}
+
+// ID называет чанк в наборах для оценки: "phoenix.md#Rollback" или просто
+// имя файла для чанка без пути.
+func (c Chunk) ID() string {
+	if c.Path == "" {
+		return c.Source
+	}
+	return c.Source + "#" + c.Path
+}
+
+// chunker режет один документ на чанки.
+type chunker func(name, content string) []Chunk
+
+// chunkers по расширению файла. Остальные файлы — обычный текст.
+var chunkers = map[string]chunker{
+	".md":       chunkMarkdown,
+	".markdown": chunkMarkdown,
+	".yaml":     chunkYAML,
+	".yml":      chunkYAML,
+	".go":       chunkGo,
+}
+
+// chunkerFor выбирает chunker по расширению файла.
+func chunkerFor(name string) chunker {
+	if c, ok := chunkers[strings.ToLower(path.Ext(name))]; ok {
+		return c
+	}
+	return chunkText
+}
+
+// ingest режет на чанки каждый файл в fsys.
+func ingest(fsys fs.FS) ([]Chunk, error) {
+	var chunks []Chunk
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		chunks = append(chunks, chunkerFor(name)(name, string(data))...)
+		return nil
+	})
+	return chunks, err
+}
+
+// --- Обычный текст ---
+
+// maxTextChunk — размер, до которого склеиваются абзацы обычного текста.
+const maxTextChunk = 800
+
+// chunkText режет текст по абзацам (пустым строкам) и склеивает соседние
+// до maxTextChunk символов. Короткий документ остаётся одним чанком.
+func chunkText(name, content string) []Chunk {
+	var chunks []Chunk
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() > 0 {
+			chunks = append(chunks, Chunk{Source: name, Text: cur.String()})
+			cur.Reset()
+		}
+	}
+	for _, p := range regexp.MustCompile(`\n\s*\n`).Split(content, -1) {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if cur.Len() > 0 && cur.Len()+len(p) > maxTextChunk {
+			flush()
+		}
+		if cur.Len() > 0 {
+			cur.WriteString("\n\n")
+		}
+		cur.WriteString(p)
+	}
+	flush()
+	if len(chunks) > 1 {
+		for i := range chunks {
+			chunks[i].Path = fmt.Sprintf("part %d", i+1)
+		}
+	}
+	return chunks
+}
+
+// --- Markdown: по чанку на раздел ---
+
+var mdHeading = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+
+// chunkMarkdown делает чанк из собственного текста каждого раздела; его Path —
+// цепочка заголовков над ним. Заголовки внутри блоков кода ("# comment"
+// в сниппете bash) — не заголовки. Разделы без собственного текста
+// (заголовок прямо перед подзаголовком) чанка не дают.
+func chunkMarkdown(name, content string) []Chunk {
+	var chunks []Chunk
+	var trail []string // trail[i] — текущий заголовок уровня i+1
+	var body []string
+	fenced := false
+	flush := func() {
+		text := strings.TrimSpace(strings.Join(body, "\n"))
+		body = nil
+		if text == "" {
+			return
+		}
+		var headings []string
+		for _, h := range trail {
+			if h != "" {
+				headings = append(headings, h)
+			}
+		}
+		chunks = append(chunks, Chunk{Source: name, Path: strings.Join(headings, " > "), Text: text})
+	}
+	for _, line := range strings.Split(content, "\n") {
+		if t := strings.TrimSpace(line); strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~") {
+			fenced = !fenced
+		}
+		m := mdHeading.FindStringSubmatch(line)
+		if m == nil || fenced {
+			body = append(body, line)
+			continue
+		}
+		flush()
+		level := len(m[1])
+		for len(trail) < level-1 {
+			trail = append(trail, "")
+		}
+		trail = append(trail[:level-1], m[2])
+	}
+	flush()
+	return chunks
+}
+
+// --- YAML: по чанку на поддерево, которое помещается ---
+
+// maxYAMLLines — размер чанка YAML. Поддерево побольше режется на своих
+// детей; маленькие соседи группируются вместе.
+const maxYAMLLines = 12
+
+// yamlNode — одна запись mapping или списка со всем, что в неё вложено.
+type yamlNode struct {
+	key   string   // "spec" или "[0]" для элемента списка
+	lines []string // Строка записи и её вложенные строки
+	at    int      // Индекс строки записи: перед ней могут идти комментарии
+}
+
+// chunkYAML режет каждый документ файла (разделённые "---") по
+// путям ключей: "spec.template.spec.containers[0]", "doc 2: spec" в
+// файле из нескольких документов. Каждый чанк начинается
+// со строк родительских ключей, так что читается как валидный YAML со своим
+// контекстом. Смотрит он только на отступы: библиотека YAML не нужна.
+func chunkYAML(name, content string) []Chunk {
+	var chunks []Chunk
+	docs := regexp.MustCompile(`(?m)^---\s*$`).Split(content, -1)
+	n := 0
+	for _, doc := range docs {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		n++
+		prefix := ""
+		if len(docs) > 1 {
+			prefix = fmt.Sprintf("doc %d", n)
+		}
+		chunkYAMLBlock(name, prefix, "", nil, strings.Split(strings.Trim(doc, "\n"), "\n"), &chunks)
+	}
+	return chunks
+}
+
+func chunkYAMLBlock(name, prefix, keyPath string, header, lines []string, out *[]Chunk) {
+	var group []yamlNode
+	size := 0
+	flush := func() {
+		if len(group) == 0 {
+			return
+		}
+		p := keyPath
+		if len(group) == 1 {
+			p = joinKeyPath(keyPath, group[0].key)
+		}
+		text := append([]string{}, header...)
+		for _, e := range group {
+			text = append(text, e.lines...)
+		}
+		if prefix != "" && p != "" {
+			p = prefix + ": " + p
+		} else if prefix != "" {
+			p = prefix
+		}
+		*out = append(*out, Chunk{Source: name, Path: p, Text: strings.Join(text, "\n")})
+		group, size = nil, 0
+	}
+	for _, e := range yamlEntries(lines) {
+		if len(e.lines) > maxYAMLLines && !yamlScalarBlock(e.lines[e.at]) {
+			flush()
+			chunkYAMLBlock(name, prefix, joinKeyPath(keyPath, e.key), append(header[:len(header):len(header)], e.lines[:e.at+1]...), e.lines[e.at+1:], out)
+			continue
+		}
+		if size+len(e.lines) > maxYAMLLines {
+			flush()
+		}
+		group = append(group, e)
+		size += len(e.lines)
+	}
+	flush()
+}
+
+// yamlEntries режет lines на записи с отступом первой из них.
+// Комментарии и пустые строки остаются с записью перед ними
+// (ведущие — с первой записью).
+func yamlEntries(lines []string) []yamlNode {
+	indent := -1
+	for _, l := range lines {
+		if t := strings.TrimSpace(l); t != "" && !strings.HasPrefix(t, "#") {
+			indent = len(l) - len(strings.TrimLeft(l, " "))
+			break
+		}
+	}
+	var nodes []yamlNode
+	var pending []string // Строки до первой записи
+	items := 0
+	for _, l := range lines {
+		t := strings.TrimSpace(l)
+		structural := t != "" && !strings.HasPrefix(t, "#")
+		if structural && len(l)-len(strings.TrimLeft(l, " ")) == indent {
+			key, _, _ := strings.Cut(t, ":")
+			if strings.HasPrefix(t, "- ") || t == "-" {
+				key = fmt.Sprintf("[%d]", items)
+				items++
+			}
+			nodes = append(nodes, yamlNode{key: strings.Trim(key, `"'`), lines: append(pending, l), at: len(pending)})
+			pending = nil
+			continue
+		}
+		if len(nodes) == 0 {
+			pending = append(pending, l)
+			continue
+		}
+		last := &nodes[len(nodes)-1]
+		last.lines = append(last.lines, l)
+	}
+	return nodes
+}
+
+// yamlScalarBlock сообщает, является ли значение записи многострочной строкой
+// ("key: |"): её строки — текст, а не ключи, и резать их нельзя.
+func yamlScalarBlock(line string) bool {
+	t := strings.TrimSpace(line)
+	for _, s := range []string{"|", "|-", "|+", ">", ">-", ">+"} {
+		if strings.HasSuffix(t, " "+s) || strings.HasSuffix(t, ":"+s) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinKeyPath(keyPath, key string) string {
+	if keyPath == "" || strings.HasPrefix(key, "[") {
+		return keyPath + key
+	}
+	return keyPath + "." + key
+}
+
+// --- Go: по чанку на объявление ---
+
+// chunkGo делает чанк из каждого объявления верхнего уровня (функции, типа,
+// группы const или var) вместе с его doc-комментарием, плюс один для
+// doc пакета. Импорты опускаются: они мало говорят о том, что делает
+// код. Файл, который не разбирается, режется как обычный текст.
+func chunkGo(name, content string) []Chunk {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, name, content, parser.ParseComments)
+	if err != nil {
+		return chunkText(name, content)
+	}
+	source := func(from, to token.Pos) string {
+		return content[fset.Position(from).Offset:fset.Position(to).Offset]
+	}
+
+	var chunks []Chunk
+	if f.Doc != nil {
+		chunks = append(chunks, Chunk{Source: name, Path: "package " + f.Name.Name, Text: source(f.Doc.Pos(), f.Name.End())})
+	}
+	for _, decl := range f.Decls {
+		var p string
+		var doc *ast.CommentGroup
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			doc, p = d.Doc, "func "+d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				p = fmt.Sprintf("func (%s) %s", goTypeName(d.Recv.List[0].Type), d.Name.Name)
+			}
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			var names []string
+			for _, s := range d.Specs {
+				switch s := s.(type) {
+				case *ast.TypeSpec:
+					names = append(names, s.Name.Name)
+				case *ast.ValueSpec:
+					for _, n := range s.Names {
+						names = append(names, n.Name)
+					}
+				}
+			}
+			doc, p = d.Doc, d.Tok.String()+" "+strings.Join(names, ", ")
+		}
+		start := decl.Pos()
+		if doc != nil {
+			start = doc.Pos()
+		}
+		chunks = append(chunks, Chunk{Source: name, Path: p, Text: source(start, decl.End())})
+	}
+	return chunks
+}
+
+// goTypeName выводит тип получателя: "*Backend", "List[T]".
+func goTypeName(e ast.Expr) string {
+	switch t := e.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return "*" + goTypeName(t.X)
+	case *ast.IndexExpr:
+		return goTypeName(t.X) + "[" + goTypeName(t.Index) + "]"
+	case *ast.IndexListExpr:
+		var params []string
+		for _, i := range t.Indices {
+			params = append(params, goTypeName(i))
+		}
+		return goTypeName(t.X) + "[" + strings.Join(params, ", ") + "]"
+	}
+	return "?"
+}
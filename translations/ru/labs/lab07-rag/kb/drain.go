@@ -0,0 +1,38 @@
+// Package ops is the team's toolkit for routine operations. The knowledge
+// base carries it so the agent can read what the tools actually do.
+package ops
+
+import (
+	"fmt"
+	"time"
+)
+
+// DrainTimeout is how long Drain waits for in-flight requests.
+const DrainTimeout = 30 * time.Second
+
+// Backend is one upstream of a load balancer.
+type Backend struct {
+	Name    string
+	Weight  int
+	Enabled bool
+}
+
+// Drain stops sending new requests to the backend and waits for in-flight
+// ones. Restart a backend only after Drain returns: requests still in
+// flight are lost otherwise.
+func Drain(b *Backend, inFlight func() int) error {
+	b.Enabled = false
+	deadline := time.Now().Add(DrainTimeout)
+	for inFlight() > 0 {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("drain %s: %d requests still in flight after %s", b.Name, inFlight(), DrainTimeout)
+		}
+		time.Sleep(time.Second)
+	}
+	return nil
+}
+
+// Undrain puts the backend back into rotation.
+func Undrain(b *Backend) {
+	b.Enabled = true
+}
@@ -2,15 +2,28 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"embed"
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
 	"os"
+	"sort"
 	"strings"
+	"time"
 
-	"github.com/sashabaranov/go-openai"
+	"github.com/kshvakov/agent/pkg/agent"
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/tools"
+	"github.com/kshvakov/agent/pkg/trace"
 )
 
-// База знаний
+// База знаний: короткие заметки прямо здесь, длинные документы в kb/
+// (ранбук на Markdown, манифест Kubernetes, исходник на Go), см. ingest.go.
+//
+//go:embed kb
+var bundledKB embed.FS
+
 var knowledgeBase = map[string]string{
 	"restart_policy.txt":  "POLICY #12: Before restarting any server, you MUST run 'backup_db'. Failure to do so is a violation.",
 	"backup_guide.txt":    "To run backup, use tool 'run_backup'. It takes no arguments.",
@@ -26,139 +39,184 @@ func restartServer(name string) string {
 	return fmt.Sprintf("Server '%s' restarted successfully.", name)
 }
 
-func searchKnowledgeBase(query string) string {
-	var results []string
-	queryLower := strings.ToLower(query)
+// maxResults — сколько чанков возвращает поиск.
+const maxResults = 5
 
-	for filename, content := range knowledgeBase {
-		if strings.Contains(strings.ToLower(content), queryLower) {
-			results = append(results, fmt.Sprintf("File: %s\nContent: %s", filename, content))
-		}
+// loadKnowledgeBase режет на чанки заметки и документы kb: встроенного
+// каталога kb/, если не задан dir.
+func loadKnowledgeBase(dir string) ([]Chunk, error) {
+	var chunks []Chunk
+	for _, name := range sortedKeys(knowledgeBase) {
+		chunks = append(chunks, chunkerFor(name)(name, knowledgeBase[name])...)
 	}
+	var kb fs.FS
+	if dir != "" {
+		kb = os.DirFS(dir)
+	} else {
+		kb, _ = fs.Sub(bundledKB, "kb")
+	}
+	docs, err := ingest(kb)
+	if err != nil {
+		return nil, fmt.Errorf("ingest %s: %w", dir, err)
+	}
+	return append(chunks, docs...), nil
+}
 
-	if len(results) == 0 {
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// searchKnowledgeBase возвращает чанки, в пути секции или тексте которых
+// есть query, сначала с наибольшим числом упоминаний (см. rankSubstring).
+func searchKnowledgeBase(chunks []Chunk, query string) string {
+	found := rankSubstring(chunks, query)
+	if len(found) == 0 {
 		return "No documents found matching your query."
 	}
 
+	var results []string
+	for _, c := range found[:min(len(found), maxResults)] {
+		results = append(results, formatChunk(c))
+	}
 	return strings.Join(results, "\n---\n")
 }
 
-func main() {
-	// 1. Настройка клиента (Local-First)
-	token := os.Getenv("OPENAI_API_KEY")
-	baseURL := os.Getenv("OPENAI_BASE_URL")
-	if token == "" {
-		token = "dummy"
+func formatChunk(c Chunk) string {
+	if c.Path == "" {
+		return fmt.Sprintf("File: %s\nContent: %s", c.Source, c.Text)
 	}
+	return fmt.Sprintf("File: %s\nSection: %s\nContent: %s", c.Source, c.Path, c.Text)
+}
 
-	config := openai.DefaultConfig(token)
-	if baseURL != "" {
-		config.BaseURL = baseURL
+func main() {
+	kbDir := flag.String("kb", "", "directory of documents to ingest instead of the bundled kb/")
+	showChunks := flag.Bool("chunks", false, "print the chunks of the knowledge base and exit")
+	eval := flag.Bool("eval", false, "measure the retrievers on the labeled queries and exit")
+	evalSet := flag.String("evalset", "", "eval set file for -eval instead of the bundled evalset.json")
+	k := flag.Int("k", 3, "results per query scored by -eval")
+	embeddings := flag.Bool("embeddings", false, "with -eval, measure ranking by embeddings too (needs a backend; kept in "+indexFile+")")
+	flag.Parse()
+
+	chunks, err := loadKnowledgeBase(*kbDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	client := openai.NewClientWithConfig(config)
-
-	ctx := context.Background()
-
-	// 2. Определяем инструменты
-	tools := []openai.Tool{
-		{
-			Type: openai.ToolTypeFunction,
-			Function: &openai.FunctionDefinition{
-				Name:        "search_knowledge_base",
-				Description: "Search the knowledge base for policies, guides, and procedures. ALWAYS use this before any action that might have a policy or procedure.",
-				Parameters: json.RawMessage(`{
-					"type": "object",
-					"properties": {
-						"query": {"type": "string", "description": "Search query (e.g., 'restart', 'backup', 'phoenix')"}
-					},
-					"required": ["query"]
-				}`),
-			},
-		},
-		{
-			Type: openai.ToolTypeFunction,
-			Function: &openai.FunctionDefinition{
-				Name:        "run_backup",
-				Description: "Run database backup. Required before server restarts.",
-			},
-		},
-		{
-			Type: openai.ToolTypeFunction,
-			Function: &openai.FunctionDefinition{
-				Name:        "restart_server",
-				Description: "Restart a server by name",
-				Parameters: json.RawMessage(`{
-					"type": "object",
-					"properties": {
-						"name": {"type": "string"}
-					},
-					"required": ["name"]
-				}`),
-			},
-		},
+	if *showChunks {
+		for _, c := range chunks {
+			fmt.Printf("=== %s", c.Source)
+			if c.Path != "" {
+				fmt.Printf(" | %s", c.Path)
+			}
+			fmt.Printf(" (%d bytes)\n%s\n\n", len(c.Text), c.Text)
+		}
+		return
 	}
-
-	systemPrompt := `You are a DevOps Agent.
-CRITICAL RULE: Before ANY restart action, you MUST search the knowledge base for policies and procedures.
-If you don't know the procedure, search first. Always follow the policies you find.`
-
-	messages := []openai.ChatCompletionMessage{
-		{Role: openai.ChatMessageRoleSystem, Content: systemPrompt},
-		{Role: openai.ChatMessageRoleUser, Content: "Перезагрузи сервер Phoenix согласно регламенту"},
+	if *eval {
+		if *k < 1 {
+			fmt.Fprintln(os.Stderr, "-k must be at least 1")
+			os.Exit(2)
+		}
+		cases, err := loadEvalSet(*evalSet)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if *embeddings {
+			client, err := llm.FromEnv()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			var queries []string
+			for _, ec := range cases {
+				queries = append(queries, ec.Query)
+			}
+			rank, err := embeddingRetriever(context.Background(), client, chunks, queries)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			retrievers = append(retrievers, namedRetriever{"embeddings", rank})
+		}
+		evaluate(os.Stdout, chunks, cases, *k)
+		return
 	}
 
-	fmt.Println("Starting Agent with RAG...")
+	// 1. Настройка клиента (Local-First)
+	// LLM_PROVIDER выбирает бэкенд: openai (любой OpenAI-совместимый сервер), llamacpp, ollama, anthropic.
+	client, err := llm.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
-	// 3. THE LOOP
-	for i := 0; i < 10; i++ {
-		req := openai.ChatCompletionRequest{
-			Model:    "gpt-4o-mini",
-			Messages: messages,
-			Tools:    tools,
-		}
+	// Ctrl+C останавливает запуск после текущего шага и печатает, что сделано.
+	ctx, stop := agent.Interruptible(context.Background())
+	defer stop()
 
-		resp, err := client.CreateChatCompletion(ctx, req)
-		if err != nil {
-			panic(fmt.Sprintf("API Error: %v", err))
-		}
+	// Каждый шаг пишется как структурное событие: по умолчанию текстом в stdout,
+	// строками JSON с AGENT_TRACE=json или AGENT_TRACE=<файл> (см. pkg/trace).
+	tr, err := trace.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer tr.Close()
 
-		msg := resp.Choices[0].Message
-		messages = append(messages, msg)
+	// С заданным OTEL_EXPORTER_OTLP_ENDPOINT запуск экспортируется и как
+	// спаны OpenTelemetry: запуск → итерации → вызовы LLM и инструментов.
+	tracer := trace.TracerFromEnv("lab07-rag")
 
-		// 4. Анализируем ответ
-		if len(msg.ToolCalls) == 0 {
-			fmt.Println("AI:", msg.Content)
-			break
-		}
+	systemPrompt := `You are a DevOps Agent.
+CRITICAL RULE: Before ANY restart action, you MUST search the knowledge base for policies and procedures.
+If you don't know the procedure, search first. Always follow the policies you find.`
 
-		// 5. Выполняем инструменты
-		for _, toolCall := range msg.ToolCalls {
-			fmt.Printf("Executing tool: %s\n", toolCall.Function.Name)
-
-			var result string
-			if toolCall.Function.Name == "search_knowledge_base" {
-				var args struct {
-					Query string `json:"query"`
-				}
-				json.Unmarshal([]byte(toolCall.Function.Arguments), &args)
-				result = searchKnowledgeBase(args.Query)
-			} else if toolCall.Function.Name == "run_backup" {
-				result = runBackup()
-			} else if toolCall.Function.Name == "restart_server" {
-				var args struct {
-					Name string `json:"name"`
-				}
-				json.Unmarshal([]byte(toolCall.Function.Arguments), &args)
-				result = restartServer(args.Name)
-			}
+	a := agent.New(client, agent.Config{
+		SystemPrompt: systemPrompt,
+		Trace:        tr,
+		Tracer:       tracer,
+	})
+
+	// 2. Определяем инструменты. Схемы их параметров выводятся из структур
+	// аргументов (tools.New).
+	search := tools.New("search_knowledge_base",
+		"Search the knowledge base for policies, guides, and procedures. ALWAYS use this before any action that might have a policy or procedure.",
+		func(_ context.Context, args struct {
+			Query string `json:"query" description:"Search query (e.g., 'restart', 'backup', 'phoenix')"`
+		}) (string, error) {
+			return searchKnowledgeBase(chunks, args.Query), nil
+		})
+	// Документы редактируют: процедура, найденная давно, ищется снова,
+	// прежде чем на нее опирается рестарт.
+	search.TTL = 10 * time.Minute
+	a.RegisterTool(search)
+	a.RegisterTool(tools.New("run_backup", "Run database backup. Required before server restarts.",
+		func(context.Context, struct{}) (string, error) { return runBackup(), nil }))
+	restart := tools.New("restart_server", "Restart a server by name",
+		func(_ context.Context, args struct {
+			Name string `json:"name" description:"Server name"`
+		}) (string, error) {
+			return restartServer(args.Name), nil
+		})
+	restart.Mutating = true
+	a.RegisterTool(restart)
 
-			fmt.Println("Tool Output:", result)
+	fmt.Println("Starting Agent with RAG...")
 
-			messages = append(messages, openai.ChatCompletionMessage{
-				Role:       openai.ChatMessageRoleTool,
-				Content:    result,
-				ToolCallID: toolCall.ID,
-			})
-		}
+	// 3. THE LOOP (pkg/agent)
+	answer, err := a.Run(ctx, "Restart Phoenix server according to protocol")
+	if errors.Is(err, context.Canceled) {
+		fmt.Printf("\n⏹  Interrupted. So far:\n%s", a.Recap())
+		return
+	}
+	if err != nil {
+		panic(fmt.Sprintf("Agent Error: %v", err))
 	}
+	fmt.Println("AI:", answer)
 }
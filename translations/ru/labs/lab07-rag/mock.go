@@ -0,0 +1,16 @@
+package main
+
+import "github.com/kshvakov/agent/pkg/mockllm"
+
+// Офлайн-запуск: OPENAI_BASE_URL=mock go run .
+// Сценарная модель ищет в базе знаний, прежде чем действовать, как
+// требует системный промпт, и следует найденному протоколу.
+func init() {
+	mockllm.Register(
+		mockllm.Call("search_knowledge_base", map[string]any{"query": "phoenix"}),
+		mockllm.Call("search_knowledge_base", map[string]any{"query": "restart"}),
+		mockllm.Call("run_backup", nil),
+		mockllm.Call("restart_server", map[string]any{"name": "phoenix"}),
+		mockllm.Say("Phoenix restarted per protocol: backup first (policy #12), then restart."),
+	)
+}
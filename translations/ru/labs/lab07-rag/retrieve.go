@@ -0,0 +1,148 @@
+package main
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// --- Поиск: запрос → ранжированные чанки ---
+//
+// Три способа ранжировать одни и те же чанки. search_knowledge_base использует первый;
+// -eval меряет их все на размеченных запросах из evalset.json, а
+// с -embeddings — и четвёртый (см. embed.go).
+
+// retriever ранжирует чанки, подходящие под query, от лучшего.
+type retriever func(chunks []Chunk, query string) []Chunk
+
+// namedRetriever — ранжировщик в том виде, как о нём сообщает -eval.
+type namedRetriever struct {
+	name string
+	rank retriever
+}
+
+var retrievers = []namedRetriever{
+	{"substring", rankSubstring},
+	{"keywords", rankKeywords},
+	{"bm25", rankBM25},
+}
+
+// scored — чанк с его оценкой для одного запроса.
+type scored struct {
+	chunk Chunk
+	score float64
+}
+
+// ranked отбрасывает чанки с оценкой 0 и сортирует остальные по оценке. При
+// равенстве сохраняется порядок базы знаний.
+func ranked(hits []scored) []Chunk {
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+	var out []Chunk
+	for _, h := range hits {
+		if h.score > 0 {
+			out = append(out, h.chunk)
+		}
+	}
+	return out
+}
+
+// searchable — текст, с которым сопоставляется запрос: путь раздела
+// несёт слова, которых может не быть в самом тексте ("Rollback", "func Undrain").
+func searchable(c Chunk) string {
+	return strings.ToLower(c.Path + "\n" + c.Text)
+}
+
+// rankSubstring ищет весь запрос как подстроку, оценка — число
+// вхождений. "restart phoenix" не находит "Phoenix server restart
+// protocol": просто и хрупко.
+func rankSubstring(chunks []Chunk, query string) []Chunk {
+	q := strings.ToLower(query)
+	var hits []scored
+	for _, c := range chunks {
+		hits = append(hits, scored{c, float64(strings.Count(searchable(c), q))})
+	}
+	return ranked(hits)
+}
+
+var wordRE = regexp.MustCompile(`[\p{L}\p{N}_]+`)
+
+func words(s string) []string {
+	return wordRE.FindAllString(strings.ToLower(s), -1)
+}
+
+// rankKeywords оценивает чанк по числу разных слов запроса, которые в нём
+// есть: порядок слов неважен, каждое слово весит одинаково ("how"
+// столько же, сколько "drain").
+func rankKeywords(chunks []Chunk, query string) []Chunk {
+	var hits []scored
+	for _, c := range chunks {
+		text := searchable(c)
+		n := 0
+		for _, w := range unique(words(query)) {
+			if strings.Contains(text, w) {
+				n++
+			}
+		}
+		hits = append(hits, scored{c, float64(n)})
+	}
+	return ranked(hits)
+}
+
+// Параметры BM25: насыщение частоты термина и нормализация по длине.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// rankBM25 — классическое лексическое ранжирование поисковиков: слово, которое
+// есть в немногих чанках (редкое, а значит показательное), весит больше, чем
+// встречающееся везде, повторы считаются с убывающей отдачей, длинные чанки штрафуются.
+func rankBM25(chunks []Chunk, query string) []Chunk {
+	docs := make([][]string, len(chunks))
+	df := map[string]int{}
+	total := 0
+	for i, c := range chunks {
+		docs[i] = words(c.Path + "\n" + c.Text)
+		total += len(docs[i])
+		for _, w := range unique(docs[i]) {
+			df[w]++
+		}
+	}
+	if len(chunks) == 0 {
+		return nil
+	}
+	avg := float64(total) / float64(len(chunks))
+	n := float64(len(chunks))
+
+	var hits []scored
+	for i, c := range chunks {
+		tf := map[string]int{}
+		for _, w := range docs[i] {
+			tf[w]++
+		}
+		score := 0.0
+		for _, w := range unique(words(query)) {
+			if tf[w] == 0 {
+				continue
+			}
+			idf := math.Log(1 + (n-float64(df[w])+0.5)/(float64(df[w])+0.5))
+			f := float64(tf[w])
+			score += idf * f * (bm25K1 + 1) / (f + bm25K1*(1-bm25B+bm25B*float64(len(docs[i]))/avg))
+		}
+		hits = append(hits, scored{c, score})
+	}
+	return ranked(hits)
+}
+
+func unique(ws []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, w := range ws {
+		if !seen[w] {
+			seen[w] = true
+			out = append(out, w)
+		}
+	}
+	return out
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Работники пересекаются: оба специалиста могут сказать, что хост доступен,
+// второй вопрос тому же специалисту повторяет половину первого ответа.
+// Каждое повторённое предложение — контекст, который supervisor перечитывает на
+// каждом следующем шаге. reported — проход дедупликации между
+// работниками и supervisor-ом: ответ работника попадает в историю
+// supervisor-а без предложений, которые тот уже видел.
+
+// sameFact — пересечение слов (Jaccard), начиная с которого два предложения
+// считаются одним и тем же фактом.
+const sameFact = 0.8
+
+// reported хранит предложения, уже возвращённые supervisor-у. Один на
+// всех работников запуска; работники идут параллельно, отсюда
+// блокировка.
+type reported struct {
+	mu        sync.Mutex
+	sentences []map[string]bool // Слова каждого отданного предложения
+	in, out   int               // Символы ответов работников до и после прохода
+	dropped   int               // Предложения, отброшенные как повторы
+}
+
+// merge возвращает answer без уже отданных предложений и
+// запоминает остальные.
+func (r *reported) merge(answer string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var kept []string
+	for _, s := range sentences(answer) {
+		w := words(s)
+		if r.seen(w) {
+			r.dropped++
+			continue
+		}
+		r.sentences = append(r.sentences, w)
+		kept = append(kept, s)
+	}
+	merged := strings.Join(kept, " ")
+	if merged == "" && answer != "" {
+		merged = "Nothing new: everything in this answer is already reported above."
+	}
+	r.in += len(answer)
+	r.out += len(merged)
+	return merged
+}
+
+// seen сообщает, отдано ли уже предложение со словами w.
+func (r *reported) seen(w map[string]bool) bool {
+	if len(w) == 0 {
+		return false
+	}
+	for _, prev := range r.sentences {
+		if overlap(w, prev) >= sameFact {
+			return true
+		}
+	}
+	return false
+}
+
+// Print пишет, сколько вывода работников проход не пустил в контекст
+// supervisor-а (токены оцениваются по 4 символа).
+func (r *reported) Print(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.in == 0 {
+		return
+	}
+	saved := r.in - r.out
+	fmt.Fprintf(w, "Dedup: %d of %d characters of worker answers (%.0f%%, ~%d tokens) kept out of the supervisor's context; repeated sentences: %d\n",
+		saved, r.in, 100*float64(saved)/float64(r.in), saved/4, r.dropped)
+}
+
+// saved возвращает символы, которые проход отбросил на данный момент.
+func (r *reported) saved() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.in - r.out
+}
+
+// sentences режет text по переводам строк и по концам предложений: ".", "!" или
+// "?", за которыми идёт пробел. "15.2" остаётся целым.
+func sentences(text string) []string {
+	var out []string
+	for _, line := range strings.Split(text, "\n") {
+		start := 0
+		for i := 0; i < len(line); i++ {
+			if strings.IndexByte(".!?", line[i]) >= 0 && (i+1 == len(line) || line[i+1] == ' ') {
+				out = appendSentence(out, line[start:i+1])
+				start = i + 1
+			}
+		}
+		out = appendSentence(out, line[start:])
+	}
+	return out
+}
+
+func appendSentence(out []string, s string) []string {
+	if s = strings.TrimSpace(s); s != "" {
+		out = append(out, s)
+	}
+	return out
+}
+
+// words возвращает слова предложения в нижнем регистре, без пунктуации.
+func words(s string) map[string]bool {
+	w := map[string]bool{}
+	for _, f := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.' && r != '-'
+	}) {
+		if f = strings.Trim(f, ".-"); f != "" {
+			w[f] = true
+		}
+	}
+	return w
+}
+
+// overlap — сходство Жаккара двух множеств слов.
+func overlap(a, b map[string]bool) float64 {
+	inter := 0
+	for w := range a {
+		if b[w] {
+			inter++
+		}
+	}
+	union := len(a) + len(b) - inter
+	if union == 0 {
+		return 0
+	}
+	return float64(inter) / float64(union)
+}
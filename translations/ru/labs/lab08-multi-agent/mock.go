@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/kshvakov/agent/pkg/mockllm"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Офлайн-запуск: OPENAI_BASE_URL=mock go run . [-bench]
+// Supervisor и работники делят одну сценарную модель; каждый ход сопоставляется
+// по инструментам, которые предлагает запрос. Универсал предлагает оба
+// инструмента работников, поэтому ходы работников требуют, чтобы другого не было.
+// -bench проигрывает сценарий по разу на запуск; при seed больше 10 лишние
+// запуски получают запасной ответ и проваливаются.
+func init() {
+	supervisor := mockllm.Offers("ask_network_expert")
+	generalist := mockllm.All(mockllm.Offers("ping"), mockllm.Offers("run_sql"))
+	network := only("ping", "run_sql")
+	database := only("run_sql", "ping")
+	for range 10 {
+		mockllm.Register(
+			mockllm.Call("ask_network_expert", map[string]any{"question": "Is db-host.example.com reachable?"}).If(supervisor),
+			mockllm.Call("ping", map[string]any{"host": "db-host.example.com"}).If(network),
+			mockllm.Say("db-host.example.com is reachable. Latency is 5ms.").If(network),
+			mockllm.Call("ask_database_expert", map[string]any{"question": "What PostgreSQL version is running?"}).If(supervisor),
+			mockllm.Call("run_sql", map[string]any{"query": "SELECT version()"}).If(database),
+			// Работник по БД повторяет сетевой факт: проход дедупликации его отбрасывает.
+			mockllm.Say("db-host.example.com is reachable. The server runs PostgreSQL 15.2.").If(database),
+			mockllm.Say("db-host.example.com is reachable (5ms), and it runs PostgreSQL 15.2.").If(supervisor),
+
+			mockllm.Call("ping", map[string]any{"host": "db-host.example.com"}).If(generalist),
+			mockllm.Call("run_sql", map[string]any{"query": "SELECT version()"}).If(generalist),
+			mockllm.Say("db-host.example.com is reachable (5ms) and runs PostgreSQL 15.2.").If(generalist),
+		)
+	}
+}
+
+// only подходит для запросов, которые предлагают tool, но не other.
+func only(tool, other string) func(openai.ChatCompletionRequest) bool {
+	return func(req openai.ChatCompletionRequest) bool {
+		return mockllm.Offers(tool)(req) && !mockllm.Offers(other)(req)
+	}
+}
@@ -3,10 +3,17 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"strings"
 
+	"github.com/kshvakov/agent/pkg/agent"
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/llm/usage"
+	"github.com/kshvakov/agent/pkg/schema"
+	"github.com/kshvakov/agent/pkg/tools"
 	"github.com/sashabaranov/go-openai"
 )
 
@@ -38,17 +45,17 @@ type Run struct {
 	contextMax   int  // окно модели; берите из конфигурации, не хардкод
 	condenseDone bool // лимит: один condense на Run
 
-	client *openai.Client
+	client llm.Provider
 	model  string
-	tools  []openai.Tool
+	tools  *tools.Registry
 }
 
-func NewRun(client *openai.Client, model string, contextMax int, systemPrompt string, tools []openai.Tool) *Run {
+func NewRun(client llm.Provider, model string, contextMax int, systemPrompt string, reg *tools.Registry) *Run {
 	return &Run{
 		client:     client,
 		model:      model,
 		contextMax: contextMax,
-		tools:      tools,
+		tools:      reg,
 		messages: []openai.ChatCompletionMessage{
 			{Role: openai.ChatMessageRoleSystem, Content: systemPrompt},
 		},
@@ -84,7 +91,10 @@ func (r *Run) Step(ctx context.Context, userInput string) (string, error) {
 		}
 
 		for _, tc := range msg.ToolCalls {
-			result := r.dispatchTool(ctx, tc)
+			result, err := r.tools.Dispatch(ctx, tc)
+			if err != nil {
+				result = fmt.Sprintf("error: %v", err)
+			}
 			r.messages = append(r.messages, openai.ChatCompletionMessage{
 				Role:       openai.ChatMessageRoleTool,
 				ToolCallID: tc.ID,
@@ -96,10 +106,10 @@ func (r *Run) Step(ctx context.Context, userInput string) (string, error) {
 }
 
 func (r *Run) callLLM(ctx context.Context) (openai.ChatCompletionResponse, error) {
-	return r.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+	return r.client.ChatCompletion(ctx, openai.ChatCompletionRequest{
 		Model:       r.model,
 		Messages:    r.messages,
-		Tools:       r.tools,
+		Tools:       r.tools.Definitions(),
 		Temperature: 0,
 	})
 }
@@ -150,24 +160,22 @@ func (r *Run) condense(ctx context.Context) error {
 
 // summarize вызывает LLM, чтобы получить краткую справку по куску истории.
 func (r *Run) summarize(ctx context.Context, head []openai.ChatCompletionMessage) (string, error) {
-	// TODO 5: соберите input как линейный текст ("role: content\n"),
-	// вызовите r.client с системным промптом из MANUAL.md (раздел «Шаг 4: condense»),
+	// TODO 5: соберите input как линейный текст ("role: content\n"), замаскируйте
+	// в нем секреты через redact.Text (pkg/redact), вызовите r.client с системным промптом из MANUAL.md (раздел «Шаг 4: condense»),
 	// верните Choices[0].Message.Content.
 	return "", fmt.Errorf("summarize not implemented")
 }
 
-// dispatchTool — пример простого fake-инструмента, чтобы демо могло крутить tool calls
+// fakeLookup — пример простого fake-инструмента, чтобы демо могло крутить tool calls
 // и проверять защиту пар при condense.
-func (r *Run) dispatchTool(ctx context.Context, tc openai.ToolCall) string {
-	switch tc.Function.Name {
-	case "fake_lookup":
-		var args struct {
-			Query string `json:"query"`
-		}
-		_ = json.Unmarshal([]byte(tc.Function.Arguments), &args)
-		return fmt.Sprintf("result for %q: ok", args.Query)
+func fakeLookup(_ context.Context, raw json.RawMessage) (string, error) {
+	var args struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return "", err
 	}
-	return "unknown tool: " + tc.Function.Name
+	return fmt.Sprintf("result for %q: ok", args.Query), nil
 }
 
 // isContextOverflow возвращает true, если ошибка похожа на переполнение окна.
@@ -182,42 +190,45 @@ func isContextOverflow(err error) bool {
 		strings.Contains(msg, "context window")
 }
 
-func jsonSchema(s string) json.RawMessage { return json.RawMessage(s) }
-
 func main() {
-	token := os.Getenv("OPENAI_API_KEY")
-	baseURL := os.Getenv("OPENAI_BASE_URL")
-	if token == "" {
-		token = "dummy"
-	}
-
-	cfg := openai.DefaultConfig(token)
-	if baseURL != "" {
-		cfg.BaseURL = baseURL
-	}
-	client := openai.NewClientWithConfig(cfg)
-
-	tools := []openai.Tool{
-		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
-			Name:        "fake_lookup",
-			Description: "Fake lookup tool used to exercise tool_call/tool_result pairs in the history.",
-			Parameters: jsonSchema(`{
-				"type":"object",
-				"properties":{"query":{"type":"string"}},
-				"required":["query"]
-			}`),
-		}},
+	// Значение по умолчанию намеренно занижено, чтобы быстро триггернуть
+	// проактивный condense. Для настоящей модели берите окно, которое нашла
+	// проба контекста Lab 00: завышенное переполняется, заниженное сжимает рано.
+	contextMax := flag.Int("context-max", 4_000, "model context window in tokens (Lab 00 measures it)")
+	tiered := flag.Bool("tiers", false, "keep the history in three tiers (recent turns, mid paragraphs, an ancient summary) instead of one condense; see tiers.go")
+	flag.Parse()
+
+	// LLM_PROVIDER выбирает бэкенд: openai (любой OpenAI-совместимый сервер), llamacpp, ollama, anthropic.
+	client, err := llm.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
+	// При выходе: токены по моделям и какие части контекста их заняли.
+	defer usage.Default.Print(os.Stdout)
+
+	reg := tools.NewRegistry(tools.Tool{
+		Name:        "fake_lookup",
+		Description: "Fake lookup tool used to exercise tool_call/tool_result pairs in the history.",
+		Params: schema.Object().
+			Prop("query", schema.String("")).
+			Require("query"),
+		Execute: fakeLookup,
+	})
 
 	systemPrompt := "Ты ассистент. Отвечай кратко и по существу. Если нужен поиск — вызывай fake_lookup."
 
-	// contextMax намеренно занижен, чтобы быстро триггернуть проактивный condense.
-	// В проде значение приходит из метаданных модели или конфигурации.
-	const contextMax = 4_000
-
-	run := NewRun(client, "gpt-4o-mini", contextMax, systemPrompt, tools)
+	run := NewRun(client, "gpt-4o-mini", *contextMax, systemPrompt, reg)
+	step := run.Step
+	var tiers *tieredRun
+	if *tiered {
+		tiers = newTieredRun(run)
+		step = tiers.Step
+	}
 
-	ctx := context.Background()
+	// Ctrl+C останавливает запуск после текущего шага и печатает, что сделано.
+	ctx, stop := agent.Interruptible(context.Background())
+	defer stop()
 
 	// Длинный диалог с заведомо «толстыми» репликами, чтобы пробить порог 80%.
 	steps := []string{
@@ -232,12 +243,19 @@ func main() {
 
 	for i, input := range steps {
 		fmt.Printf("\n--- Step %d ---\nUser: %s\n", i+1, input)
-		answer, err := run.Step(ctx, input)
+		answer, err := step(ctx, input)
+		if errors.Is(err, context.Canceled) {
+			fmt.Printf("\n⏹  Interrupted. So far:\n%s", agent.Recap(run.messages))
+			return
+		}
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "step error: %v\n", err)
 			os.Exit(1)
 		}
 		fmt.Printf("Assistant: %s\n", answer)
+		if tiers != nil {
+			tiers.report()
+		}
 		if run.condenseDone {
 			fmt.Println("  (condense already done in this Run)")
 		}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/kshvakov/agent/pkg/mockllm"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Офлайн-запуск: OPENAI_BASE_URL=mock go run .
+// Ответы намеренно раздуты: история должна пробить порог 80%, чтобы
+// сработал condense. Последний ход отвечает на проверку памяти, только
+// если имя и стек еще где-то есть в истории.
+func init() {
+	summarizer := func(req openai.ChatCompletionRequest) bool { return !mockllm.HasTools(req) }
+	long := func(topic string) string {
+		return strings.Repeat("Шаг: "+topic+" — проверить требования, применить, проверить результат, задокументировать. ", 40)
+	}
+	// -tiers: продвижения отвечают началом того, что сжимают, и первый
+	// ход (имя, стек) остается в каждом уровне.
+	for _, prompt := range []string{midPrompt, ancientPrompt} {
+		promotion := func(req openai.ChatCompletionRequest) bool {
+			return len(req.Messages) > 0 && req.Messages[0].Content == prompt
+		}
+		for range 10 {
+			mockllm.Register(mockllm.Turn{Reply: func(req openai.ChatCompletionRequest) mockllm.Turn {
+				text := []rune(strings.Join(strings.Fields(mockllm.LastUser(req)), " "))
+				return mockllm.Say(string(text[:min(len(text), 240)]))
+			}}.If(promotion))
+		}
+	}
+	mockllm.Register(
+		// condense: вызов суммаризации — единственный без инструментов
+		mockllm.Say("Пользователь: Иван, DevOps-инженер в TechCorp. Стек: Ubuntu 22.04, Docker, Kubernetes, PostgreSQL, Redis, Nginx, Vault, Prometheus. Обсудили: PoC на k8s, миграцию PG 14→16, алерты, Vault Injector.").If(summarizer),
+		mockllm.Say("Привет, Иван! Стек записал.").If(mockllm.Mentions("меня зовут иван")),
+		mockllm.Call("fake_lookup", map[string]any{"query": "kubernetes single-node ubuntu"}).If(mockllm.Mentions("kubernetes на голом")),
+		mockllm.Say(long("kubeadm single-node")).If(mockllm.Mentions("kubernetes на голом")),
+		mockllm.Say(long("pg_upgrade через логическую репликацию")).If(mockllm.Mentions("postgresql 14")),
+		mockllm.Say(long("лаг репликации, соединения, bloat")).If(mockllm.Mentions("метрики prometheus")),
+		mockllm.Say(long("аннотации Vault Agent Injector")).If(mockllm.Mentions("vault")),
+		mockllm.Say(long("Bacula для ленты, Restic для объектного хранилища")).If(mockllm.Mentions("bacula")),
+		mockllm.Turn{Reply: func(req openai.ChatCompletionRequest) mockllm.Turn {
+			for _, m := range req.Messages {
+				if strings.Contains(m.Content, "Иван") {
+					return mockllm.Say("Вы Иван, DevOps-инженер в TechCorp; стек — Ubuntu, Docker, Kubernetes, PostgreSQL и компания.")
+				}
+			}
+			return mockllm.Say("Не знаю: эта часть разговора потерялась.")
+		}}.If(mockllm.Mentions("как меня зовут")),
+	)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kshvakov/agent/pkg/redact"
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Опциональная часть: три уровня контекста (-tiers) ---
+//
+// Одного condense на Run хватает для одной задачи. Разговору, который идет
+// часами, нужно больше, и чем старше его часть, тем меньше ее деталей
+// стоят своих токенов. Уровневая раскладка хранит
+//
+//	recent   последние recentTurns ходов дословно
+//	mid      по абзацу на каждый более старый ход, не больше midParagraphs
+//	ancient  один абзац на все, что было раньше
+//
+// и продвигает уровни по мере роста разговора. После каждого шага самый
+// старый ход из recent становится абзацем, а самый старый абзац сверх
+// midParagraphs вливается в ancient. Каждый уровень покрывает больше
+// истории на токен, чем предыдущий, поэтому контекст остается примерно
+// того же размера, как бы долго ни шел разговор.
+//
+// Запрос той же формы, что и после condense: system, одно user-сообщение
+// с уровнями ancient и mid, затем ходы recent. Ход продвигается целиком
+// (от сообщения пользователя до ответа), поэтому tool-пары никогда не
+// разрываются.
+
+const (
+	recentTurns   = 2 // Ходы, которые хранятся дословно
+	midParagraphs = 3 // Абзацы, которые хранятся, пока самый старый не вольется в ancient
+)
+
+// Промпты двух продвижений.
+const (
+	midPrompt = `Сожми этот ход разговора пользователя с ассистентом в один абзац не длиннее 3 предложений.
+Сохрани имена, факты о пользователе и его системах, решения и открытые вопросы. Опусти детали ответа.`
+	ancientPrompt = `Объедини сводку самого раннего разговора со следующим за ней абзацем в один абзац не длиннее 5 предложений.
+Сохрани имена, факты о пользователе и его системах и решения. Все остальное опусти.`
+)
+
+// tieredRun гоняет Run с историей в трех уровнях.
+type tieredRun struct {
+	*Run
+	system  openai.ChatCompletionMessage
+	ancient string
+	mid     []string
+	recent  [][]openai.ChatCompletionMessage // Ходы, самый старый первым
+}
+
+func newTieredRun(r *Run) *tieredRun {
+	return &tieredRun{Run: r, system: r.messages[0]}
+}
+
+// Step выполняет один ход на уровневой истории и продвигает уровни.
+func (t *tieredRun) Step(ctx context.Context, userInput string) (string, error) {
+	t.messages = t.layout()
+	answer, err := t.Run.Step(ctx, userInput)
+	if err != nil {
+		return answer, err
+	}
+	// Ход — все начиная с его сообщения пользователя, где бы Run
+	// его ни оставил.
+	start := len(t.messages) - 1
+	for start > 0 && (t.messages[start].Role != openai.ChatMessageRoleUser || t.messages[start].Content != userInput) {
+		start--
+	}
+	t.recent = append(t.recent, slices.Clone(t.messages[start:]))
+	return answer, t.promote(ctx)
+}
+
+// layout возвращает сообщения следующего запроса.
+func (t *tieredRun) layout() []openai.ChatCompletionMessage {
+	msgs := []openai.ChatCompletionMessage{t.system}
+	var b strings.Builder
+	if t.ancient != "" {
+		b.WriteString("Ранее: " + t.ancient + "\n\n")
+	}
+	for _, p := range t.mid {
+		b.WriteString(p + "\n\n")
+	}
+	if b.Len() > 0 {
+		msgs = append(msgs, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleUser,
+			Content: "Контекст предыдущей работы:\n\n" + strings.TrimSpace(b.String()),
+		})
+	}
+	for _, turn := range t.recent {
+		msgs = append(msgs, turn...)
+	}
+	return msgs
+}
+
+// promote сдвигает самые старые ходы и абзацы на уровень ниже.
+func (t *tieredRun) promote(ctx context.Context) error {
+	for len(t.recent) > recentTurns {
+		p, err := t.compress(ctx, midPrompt, transcript(t.recent[0]))
+		if err != nil {
+			return fmt.Errorf("promote to mid: %w", err)
+		}
+		t.mid = append(t.mid, p)
+		t.recent = t.recent[1:]
+		fmt.Println("  tiers: oldest turn → mid paragraph")
+	}
+	for len(t.mid) > midParagraphs {
+		input := t.mid[0]
+		if t.ancient != "" {
+			input = "Сводка самого раннего разговора: " + t.ancient + "\n\nЗатем: " + t.mid[0]
+		}
+		a, err := t.compress(ctx, ancientPrompt, input)
+		if err != nil {
+			return fmt.Errorf("promote to ancient: %w", err)
+		}
+		t.ancient = a
+		t.mid = t.mid[1:]
+		fmt.Println("  tiers: oldest paragraph → ancient")
+	}
+	return nil
+}
+
+// compress просит у модели один абзац. Сначала маскируются секреты:
+// summary живет дольше сообщений, которые заменяет.
+func (t *tieredRun) compress(ctx context.Context, prompt, text string) (string, error) {
+	text, _ = redact.Text(text)
+	resp, err := t.client.ChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: t.model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: prompt},
+			{Role: openai.ChatMessageRoleUser, Content: text},
+		},
+		Temperature: 0,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("empty response")
+	}
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
+
+// transcript превращает ход в текст для суммаризатора.
+func transcript(msgs []openai.ChatCompletionMessage) string {
+	var b strings.Builder
+	for _, m := range msgs {
+		if m.Content != "" {
+			fmt.Fprintf(&b, "%s: %s\n", m.Role, m.Content)
+		}
+		for _, tc := range m.ToolCalls {
+			fmt.Fprintf(&b, "%s: calls %s(%s)\n", m.Role, tc.Function.Name, tc.Function.Arguments)
+		}
+	}
+	return b.String()
+}
+
+// report печатает прикидку токенов каждого уровня рядом с фактическими
+// токенами промпта последнего запроса. Подсчета провайдера по уровням нет,
+// поэтому уровни прикидываются; итог — провайдера.
+func (t *tieredRun) report() {
+	recent := 0
+	for _, turn := range t.recent {
+		for _, m := range turn {
+			recent += estimateTokens(m.Content)
+			for _, tc := range m.ToolCalls {
+				recent += estimateTokens(tc.Function.Name) + estimateTokens(tc.Function.Arguments)
+			}
+		}
+	}
+	mid := 0
+	for _, p := range t.mid {
+		mid += estimateTokens(p)
+	}
+	fmt.Printf("  tiers: recent %d turns ~%d tok | mid %d paragraphs ~%d tok | ancient ~%d tok | prompt (actual) %d\n",
+		len(t.recent), recent, len(t.mid), mid, estimateTokens(t.ancient), t.lastTokens)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/simclock"
+)
+
+// --- Сценарий автомасштабирования ---
+//
+// Сервис-обработчик разбирает очередь. Нагрузка растёт быстрее, чем справляются
+// текущие реплики, поэтому очередь продолжает расти. План должен масштабироваться
+// постепенно (большой скачок отклоняет ограничитель мощности), проверяя между
+// приращениями, что очередь действительно уменьшается. Новым репликам нужна
+// минута на прогрев, поэтому проверка сразу после масштабирования падает и повторяется.
+
+// scalingService — симулированный сервис с глубиной очереди и числом реплик.
+type scalingService struct {
+	// mu сериализует действия: Resources плана — то, что объявила модель,
+	// так что шаги одного батча могут обратиться к сервису одновременно.
+	mu    sync.Mutex
+	clock *simclock.Sim
+
+	QueueDepth int
+	Replicas   int // Готовые реплики
+	Warming    int // Реплики, которые запускаются
+
+	MaxReplicas int // Жёсткий предел мощности
+	MaxStep     int // Сколько реплик можно добавить или убрать за одно действие
+	ArrivalRate int // Сообщений в минуту
+	PerReplica  int // Сообщений, которые одна реплика разбирает за минуту
+
+	lastDepth int // Глубина очереди на предыдущей проверке
+}
+
+func newScalingService(clock *simclock.Sim) *scalingService {
+	s := &scalingService{
+		clock:       clock,
+		QueueDepth:  5000,
+		Replicas:    2,
+		MaxReplicas: 10,
+		MaxStep:     2,
+		ArrivalRate: 700,
+		PerReplica:  200,
+	}
+	s.lastDepth = s.QueueDepth
+	clock.Every(time.Minute, s.tick)
+	return s
+}
+
+// tick применяет одну минуту нагрузки и обработки.
+func (s *scalingService) tick() {
+	s.QueueDepth += s.ArrivalRate - s.Replicas*s.PerReplica
+	if s.QueueDepth < 0 {
+		s.QueueDepth = 0
+	}
+}
+
+func (s *scalingService) status() string {
+	return fmt.Sprintf("[%s] queue_depth=%d replicas=%d warming=%d",
+		s.clock.Now().Format("15:04:05"), s.QueueDepth, s.Replicas, s.Warming)
+}
+
+func (s *scalingService) scaleUp(n int) (string, error) {
+	if n <= 0 || n > s.MaxStep {
+		return "", fmt.Errorf("scale_up: count must be 1..%d, got %d (scale gradually)", s.MaxStep, n)
+	}
+	if s.Replicas+s.Warming+n > s.MaxReplicas {
+		return "", fmt.Errorf("scale_up: would exceed max replicas %d", s.MaxReplicas)
+	}
+	s.Warming += n
+	s.clock.After(time.Minute, func() {
+		s.Warming -= n
+		s.Replicas += n
+	})
+	return fmt.Sprintf("scaling up by %d, replicas will be ready in 1m. %s", n, s.status()), nil
+}
+
+func (s *scalingService) scaleDown(n int) (string, error) {
+	if n <= 0 || n > s.MaxStep {
+		return "", fmt.Errorf("scale_down: count must be 1..%d, got %d", s.MaxStep, n)
+	}
+	if s.Replicas-n < 1 {
+		return "", fmt.Errorf("scale_down: at least 1 replica must remain")
+	}
+	s.Replicas -= n
+	return fmt.Sprintf("scaled down by %d. %s", n, s.status()), nil
+}
+
+// verifyDraining ждёт минуту и проверяет, что очередь уменьшилась.
+// Ошибка означает «ещё нет» — исполнитель повторяет шаг.
+func (s *scalingService) verifyDraining() (string, error) {
+	s.clock.Advance(time.Minute)
+	prev := s.lastDepth
+	s.lastDepth = s.QueueDepth
+	if s.QueueDepth >= prev && s.QueueDepth > 0 {
+		return "", fmt.Errorf("queue is not draining: %d -> %d. %s", prev, s.QueueDepth, s.status())
+	}
+	return fmt.Sprintf("queue draining: %d -> %d. %s", prev, s.QueueDepth, s.status()), nil
+}
+
+// ScalingExecutor выполняет шаги плана на симулированном сервисе.
+// Шаги называют своё действие в Step.Tool; аргументы идут в Step.Args.
+type ScalingExecutor struct {
+	svc *scalingService
+}
+
+func (e *ScalingExecutor) Execute(step *Step) (string, error) {
+	fmt.Printf("Executing step %s: %s\n", step.ID, step.Description)
+	e.svc.mu.Lock()
+	defer e.svc.mu.Unlock()
+	// Каждое действие занимает немного симулированного времени.
+	defer e.svc.clock.Advance(10 * time.Second)
+
+	switch step.Tool {
+	case "check_queue":
+		return e.svc.status(), nil
+	case "scale_up":
+		return e.svc.scaleUp(intArg(step.Args, "count", 1))
+	case "scale_down":
+		return e.svc.scaleDown(intArg(step.Args, "count", 1))
+	case "verify_draining":
+		return e.svc.verifyDraining()
+	default:
+		return "", fmt.Errorf("unknown tool %q in step %s", step.Tool, step.ID)
+	}
+}
+
+// scalingTools — инструменты шагов сценария, которые проверяются, пока план
+// стримится (см. stream.go).
+var scalingTools = []string{"check_queue", "scale_up", "scale_down", "verify_draining"}
+
+// scalingToolsPrompt описывает инструменты сценария для createPlan.
+const scalingToolsPrompt = `Available step tools (set "tool" and "args" on each step):
+- check_queue {} — current queue depth and replicas
+- scale_up {"count": 1..2} — add replicas (ready after 1 minute)
+- scale_down {"count": 1..2} — remove replicas
+- verify_draining {} — wait 1 minute and check the queue shrinks (fails if not)
+Max 10 replicas. Scale gradually and verify after each increment.
+Every step touches "deployment/orders-worker" (set it in "resources").
+Steps may declare checks: "pre"/"post": [{"tool": "check_queue", "expect": "warming=0"}]
+(expect is a regexp the tool result must match).`
+
+// workerDeployment — ресурс, который затрагивает каждый шаг масштабирования:
+// два действия масштабирования сразу делают бессмысленной проверку каждого.
+const workerDeployment = "deployment/orders-worker"
+
+// autoscalePlan — эталонный план для сценария: постепенное масштабирование с
+// проверкой между приращениями.
+func autoscalePlan() *Plan {
+	return &Plan{
+		ID:   "autoscale-orders-worker",
+		Task: "Drain the orders-worker queue by scaling up gradually",
+		Steps: []*Step{
+			{ID: "check", Description: "Check queue depth and replicas", Tool: "check_queue", Resources: []string{workerDeployment}, Status: "pending"},
+			{ID: "scale-1", Description: "Scale up by 2 replicas", Tool: "scale_up", Args: map[string]any{"count": 2}, Dependencies: []string{"check"}, Resources: []string{workerDeployment}, Status: "pending"},
+			{ID: "verify-1", Description: "Verify the queue is draining", Tool: "verify_draining", Dependencies: []string{"scale-1"}, Resources: []string{workerDeployment}, Status: "pending"},
+			{ID: "scale-2", Description: "Scale up by 2 more replicas", Tool: "scale_up", Args: map[string]any{"count": 2}, Dependencies: []string{"verify-1"}, Resources: []string{workerDeployment}, Status: "pending",
+				// Не наслаивайте масштабирования: предыдущие реплики должны быть готовы.
+				Pre: []Condition{{Tool: "check_queue", Expect: `warming=0\b`}}},
+			{ID: "verify-2", Description: "Verify the queue drains faster", Tool: "verify_draining", Dependencies: []string{"scale-2"}, Resources: []string{workerDeployment}, Status: "pending"},
+			{ID: "final", Description: "Report final queue depth", Tool: "check_queue", Dependencies: []string{"verify-2"}, Resources: []string{workerDeployment}, Status: "pending",
+				Post: []Condition{{Tool: "check_queue", Expect: `replicas=6\b`}}},
+		},
+	}
+}
+
+// intArg читает целочисленный аргумент; числа JSON приходят как float64.
+func intArg(args map[string]any, key string, def int) int {
+	switch v := args[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return def
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// --- Предусловия и постусловия ---
+//
+// «Проверь исправление», написанное в промпте, — это пожелание; написанное в плане,
+// оно обязательно. Шаг может объявить проверки: вызов инструмента и регулярное
+// выражение, которому должен соответствовать его результат. Предусловия выполняются
+// до шага, постусловия — после. Проваленная проверка проваливает шаг, так что
+// действуют обычные повторы.
+
+// Condition — вызов инструмента с ожидаемым результатом.
+type Condition struct {
+	Tool   string         `json:"tool"`
+	Args   map[string]any `json:"args,omitempty"`
+	Expect string         `json:"expect"` // Регулярное выражение, которому должен соответствовать результат инструмента
+}
+
+// conditionExecutor проверяет Step.Pre и Step.Post вокруг внутреннего исполнителя.
+// Проверки тоже выполняет внутренний исполнитель, как отдельные шаги.
+type conditionExecutor struct {
+	inner StepExecutor
+}
+
+func (e *conditionExecutor) Execute(step *Step) (string, error) {
+	for i, c := range step.Pre {
+		if err := e.check(step, "pre", i, c); err != nil {
+			return "", err
+		}
+	}
+	result, err := e.inner.Execute(step)
+	if err != nil {
+		return result, err
+	}
+	for i, c := range step.Post {
+		if err := e.check(step, "post", i, c); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+func (e *conditionExecutor) check(step *Step, kind string, i int, c Condition) error {
+	re, err := regexp.Compile(c.Expect)
+	if err != nil {
+		return fmt.Errorf("%scondition %d of step %s: bad pattern: %w", kind, i+1, step.ID, err)
+	}
+	check := &Step{
+		ID:          fmt.Sprintf("%s/%s-%d", step.ID, kind, i+1),
+		Description: fmt.Sprintf("%scondition: %s expects /%s/", kind, c.Tool, c.Expect),
+		Tool:        c.Tool,
+		Args:        c.Args,
+		Resources:   step.Resources,
+	}
+	out, err := e.inner.Execute(check)
+	if err != nil {
+		return fmt.Errorf("%scondition %d of step %s: %w", kind, i+1, step.ID, err)
+	}
+	if !re.MatchString(out) {
+		return fmt.Errorf("%scondition %d of step %s failed: %s result %q doesn't match /%s/", kind, i+1, step.ID, c.Tool, out, c.Expect)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// --- Конфликты ресурсов ---
+//
+// Граф зависимостей говорит, какие шаги *могут* идти параллельно. Он не знает,
+// что «перезапустить api» и «мигрировать базу api» оба затрагивают деплой api.
+// Шаги объявляют затрагиваемые ресурсы в Step.Resources; два готовых шага
+// с общим ресурсом никогда не выполняются одновременно.
+
+// Conflict — пара шагов с общим ресурсом, не упорядоченных
+// зависимостями, так что планировщику приходится выполнять их по очереди.
+type Conflict struct {
+	A, B     string
+	Resource string
+}
+
+// resourceConflicts перечисляет неупорядоченные пары шагов с общим ресурсом.
+// Это отчёт для людей: планировщик всё равно выполняет их по очереди.
+func resourceConflicts(plan *Plan) []Conflict {
+	byID := make(map[string]*Step, len(plan.Steps))
+	for _, s := range plan.Steps {
+		byID[s.ID] = s
+	}
+	// dependsOn сообщает, зависит ли a (транзитивно) от b.
+	var dependsOn func(a *Step, b string, seen map[string]bool) bool
+	dependsOn = func(a *Step, b string, seen map[string]bool) bool {
+		for _, dep := range a.Dependencies {
+			if dep == b {
+				return true
+			}
+			if seen[dep] {
+				continue
+			}
+			seen[dep] = true
+			if d, ok := byID[dep]; ok && dependsOn(d, b, seen) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var conflicts []Conflict
+	for i, a := range plan.Steps {
+		for _, b := range plan.Steps[i+1:] {
+			res, ok := sharedResource(a, b)
+			if !ok {
+				continue
+			}
+			if dependsOn(a, b.ID, map[string]bool{}) || dependsOn(b, a.ID, map[string]bool{}) {
+				continue
+			}
+			conflicts = append(conflicts, Conflict{A: a.ID, B: b.ID, Resource: res})
+		}
+	}
+	return conflicts
+}
+
+func sharedResource(a, b *Step) (string, bool) {
+	for _, ra := range a.Resources {
+		for _, rb := range b.Resources {
+			if ra == rb {
+				return ra, true
+			}
+		}
+	}
+	return "", false
+}
+
+// nextBatch выбирает готовые шаги, которые могут идти вместе: в порядке плана шаг
+// берётся, если у него нет общего ресурса с шагом, уже попавшим в пачку.
+// Остальные остаются в ожидании и подбираются в следующем раунде.
+func nextBatch(ready []*Step) []*Step {
+	locked := map[string]bool{}
+	var batch []*Step
+	for _, s := range ready {
+		free := true
+		for _, r := range s.Resources {
+			if locked[r] {
+				free = false
+				break
+			}
+		}
+		if !free {
+			continue
+		}
+		for _, r := range s.Resources {
+			locked[r] = true
+		}
+		batch = append(batch, s)
+	}
+	return batch
+}
+
+// runBatch выполняет пачку без конфликтов параллельно и возвращает первую
+// ошибку вместе с шагом, от которого она пришла. fn выполняет один шаг (с его
+// повторами) и обновляет его статус.
+func runBatch(batch []*Step, fn func(*Step) error) error {
+	if len(batch) == 1 {
+		if err := fn(batch[0]); err != nil {
+			return fmt.Errorf("step %s: %w", batch[0].ID, err)
+		}
+		return nil
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, len(batch))
+	for i, s := range batch {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = fn(s)
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("step %s: %w", batch[i].ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/simclock"
+)
+
+// statsFile хранит измеренные длительности шагов между запусками.
+const statsFile = "plan_stats.json"
+
+// Цена шагов через LLM, $ за 1K токенов (gpt-4o-mini, усреднённо по входу/выходу).
+const pricePer1KTokens = 0.0006
+
+// stepHeuristics дают первую оценку, когда по виду шага нет истории.
+var stepHeuristics = []struct {
+	keyword  string
+	duration time.Duration
+	tokens   int
+}{
+	{"deploy", 5 * time.Minute, 1500},
+	{"build", 3 * time.Minute, 800},
+	{"test", 4 * time.Minute, 1200},
+	{"backup", 2 * time.Minute, 500},
+	{"migrat", 6 * time.Minute, 1500},
+	{"verify", 30 * time.Second, 600},
+	{"check", 15 * time.Second, 400},
+	{"scale", time.Minute, 400},
+}
+
+const (
+	defaultStepDuration = time.Minute
+	defaultStepTokens   = 800
+)
+
+// StepStats — исторические измерения одного вида шагов. Токены
+// считаются отдельно: у шага, который не идёт через LLM, есть длительность,
+// которую можно измерить, но нет usage.
+type StepStats struct {
+	Samples       int           `json:"samples"`
+	TotalDuration time.Duration `json:"total_duration"`
+	TokenSamples  int           `json:"token_samples,omitempty"`
+	TotalTokens   int           `json:"total_tokens"`
+}
+
+// unmeasured — число токенов шага, чей расход LLM никто не измерял.
+const unmeasured = -1
+
+// StatsStore сопоставляет виду шага (см. stepKind) его измерения.
+// Шаги одной пачки идут параллельно, поэтому record защищён mu.
+type StatsStore struct {
+	mu    sync.Mutex
+	path  string
+	Steps map[string]*StepStats `json:"steps"`
+}
+
+// loadStats читает историческую статистику; отсутствующий файл значит «истории пока нет».
+func loadStats(path string) (*StatsStore, error) {
+	s := &StatsStore{path: path, Steps: map[string]*StepStats{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *StatsStore) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0o644)
+}
+
+// record добавляет измерение step: его длительность и токены, если
+// они измерены.
+func (s *StatsStore) record(step *Step, d time.Duration, tokens int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kind := stepKind(step)
+	st, ok := s.Steps[kind]
+	if !ok {
+		st = &StepStats{}
+		s.Steps[kind] = st
+	}
+	st.Samples++
+	st.TotalDuration += d
+	if tokens != unmeasured {
+		st.TokenSamples++
+		st.TotalTokens += tokens
+	}
+}
+
+// stepKind группирует похожие шаги: по инструменту, если он у шага есть,
+// иначе по первым двум словам описания.
+func stepKind(step *Step) string {
+	if step.Tool != "" {
+		return "tool:" + step.Tool
+	}
+	words := strings.Fields(strings.ToLower(step.Description))
+	if len(words) > 2 {
+		words = words[:2]
+	}
+	return "desc:" + strings.Join(words, " ")
+}
+
+// StepEstimate — ожидаемые длительность и стоимость одного шага.
+type StepEstimate struct {
+	StepID   string
+	Duration time.Duration
+	Tokens   int
+	Cost     float64
+	Source   string // "history" или "heuristic"
+}
+
+// PlanEstimate подводит итог по плану. Duration — критический путь:
+// независимые шаги могут идти параллельно.
+type PlanEstimate struct {
+	Steps    []StepEstimate
+	Duration time.Duration
+	Tokens   int
+	Cost     float64
+}
+
+// estimateStep берёт оценку из эвристик, а затем заменяет то, что измерила
+// история, поле за полем: вид шага с длительностями, но без числа токенов
+// сохраняет угаданные токены, а с ними и стоимость.
+func estimateStep(step *Step, stats *StatsStore) StepEstimate {
+	e := StepEstimate{StepID: step.ID, Duration: defaultStepDuration, Tokens: defaultStepTokens, Source: "heuristic"}
+	desc := strings.ToLower(step.Description + " " + step.Tool)
+	for _, h := range stepHeuristics {
+		if strings.Contains(desc, h.keyword) {
+			e.Duration, e.Tokens = h.duration, h.tokens
+			break
+		}
+	}
+	if step.Tool != "" {
+		e.Tokens = 0 // Прямые вызовы инструментов не идут через LLM
+	}
+	if st, ok := stats.Steps[stepKind(step)]; ok {
+		if st.Samples > 0 {
+			e.Duration = st.TotalDuration / time.Duration(st.Samples)
+			e.Source = "history"
+		}
+		if st.TokenSamples > 0 {
+			e.Tokens = st.TotalTokens / st.TokenSamples
+			e.Source = "history"
+		}
+	}
+	e.Cost = float64(e.Tokens) / 1000 * pricePer1KTokens
+	return e
+}
+
+// estimatePlan оценивает шаги, которые будут выполняться, и весь план.
+// Выполненные и отложенные шаги ничего не стоят.
+func estimatePlan(plan *Plan, stats *StatsStore) PlanEstimate {
+	var pe PlanEstimate
+	byID := map[string]StepEstimate{}
+	for _, s := range plan.Steps {
+		if s.Status != "pending" {
+			continue
+		}
+		e := estimateStep(s, stats)
+		byID[s.ID] = e
+		pe.Steps = append(pe.Steps, e)
+		pe.Tokens += e.Tokens
+		pe.Cost += e.Cost
+	}
+	pe.Duration = criticalPath(plan, byID)
+	return pe
+}
+
+// criticalPath возвращает самую длинную цепочку зависимостей. На цикле она
+// откатывается к простой сумме — о самом цикле сообщает findReadySteps.
+func criticalPath(plan *Plan, est map[string]StepEstimate) time.Duration {
+	deps := map[string][]string{}
+	for _, s := range plan.Steps {
+		deps[s.ID] = s.Dependencies
+	}
+	finish := map[string]time.Duration{}
+	visiting := map[string]bool{}
+	cycle := false
+
+	var visit func(id string) time.Duration
+	visit = func(id string) time.Duration {
+		if d, ok := finish[id]; ok {
+			return d
+		}
+		if visiting[id] {
+			cycle = true
+			return 0
+		}
+		visiting[id] = true
+		var start time.Duration
+		for _, dep := range deps[id] {
+			start = max(start, visit(dep))
+		}
+		visiting[id] = false
+		finish[id] = start + est[id].Duration
+		return finish[id]
+	}
+
+	var longest, sum time.Duration
+	for _, s := range plan.Steps {
+		longest = max(longest, visit(s.ID))
+		sum += est[s.ID].Duration
+	}
+	if cycle {
+		return sum
+	}
+	return longest
+}
+
+func printEstimate(pe PlanEstimate) {
+	fmt.Println("\nEstimate:")
+	for _, e := range pe.Steps {
+		fmt.Printf("  %-12s %8s %6d tokens  $%.4f  (%s)\n", e.StepID, e.Duration, e.Tokens, e.Cost, e.Source)
+	}
+	fmt.Printf("  %-12s %8s %6d tokens  $%.4f\n", "TOTAL", pe.Duration, pe.Tokens, pe.Cost)
+}
+
+// confirmEstimate просит человека подтвердить, когда оценка превышает лимит.
+// Нулевые лимиты игнорируются.
+func confirmEstimate(pe PlanEstimate, maxDuration time.Duration, maxCost float64) bool {
+	var reasons []string
+	if maxDuration > 0 && pe.Duration > maxDuration {
+		reasons = append(reasons, fmt.Sprintf("duration %s > %s", pe.Duration, maxDuration))
+	}
+	if maxCost > 0 && pe.Cost > maxCost {
+		reasons = append(reasons, fmt.Sprintf("cost $%.4f > $%.4f", pe.Cost, maxCost))
+	}
+	if len(reasons) == 0 {
+		return true
+	}
+	fmt.Printf("\n⚠️  Estimate exceeds the threshold: %s. Continue? [y/N] ", strings.Join(reasons, ", "))
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// timedExecutor измеряет каждый шаг и записывает его в хранилище статистики.
+// Часы симулированные в сценарии autoscale и настоящие в остальных.
+// Исполнители этой лабы не вызывают LLM, поэтому их токены
+// не измерены; исполнитель, который вызывает, записал бы свой расход.
+type timedExecutor struct {
+	inner StepExecutor
+	clock simclock.Clock
+	stats *StatsStore
+}
+
+func (e *timedExecutor) Execute(step *Step) (string, error) {
+	start := e.clock.Now()
+	result, err := e.inner.Execute(step)
+	if err == nil {
+		e.stats.record(step, e.clock.Now().Sub(start), unmeasured)
+	}
+	return result, err
+}
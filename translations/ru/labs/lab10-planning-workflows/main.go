@@ -3,10 +3,15 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"time"
 
-	"github.com/sashabaranov/go-openai"
+	"github.com/kshvakov/agent/pkg/agent"
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/simclock"
 )
 
 // Step представляет один шаг плана
@@ -16,6 +21,14 @@ type Step struct {
 	Dependencies []string // ID шагов, от которых зависит этот шаг
 	Status       string   // pending, running, completed, failed
 	Result       string   // Результат выполнения
+
+	Tool string         // Необязательно: инструмент, который исполнитель запускает для шага
+	Args map[string]any // Необязательно: аргументы инструмента
+
+	Resources []string // Необязательно: ресурсы, которые трогает шаг (например, "deployment/api"); см. conflicts.go
+
+	Pre  []Condition // Необязательно: проверки, которые должны пройти до шага; см. conditions.go
+	Post []Condition // Необязательно: проверки, которые должны пройти после шага
 }
 
 // Plan представляет полный план выполнения задачи
@@ -30,15 +43,26 @@ type StepExecutor interface {
 	Execute(step *Step) (string, error)
 }
 
+// PlanOptions настраивают создание плана
+type PlanOptions struct {
+	Examples    string   // Планы похожих прошлых задач (см. history.go), может быть пусто
+	Temperature float32  // 0 для детерминированного плана, выше — для разнообразных кандидатов (см. portfolio.go)
+	Tools       []string // Инструменты шагов, которые может вызывать план (см. stream.go); пусто — никаких
+}
+
 // TODO 1: Реализуйте функцию создания плана через LLM
 // Используйте LLM для декомпозиции задачи на шаги
 // Определите зависимости между шагами
-func createPlan(ctx context.Context, client *openai.Client, task string) (*Plan, error) {
+func createPlan(ctx context.Context, client llm.Provider, task string, opts PlanOptions) (*Plan, error) {
 	// TODO: Создайте промпт для декомпозиции задачи
-	// TODO: Вызовите LLM для получения плана
+	//       (если задача перечисляет инструменты шагов, просите "tool" и "args" у каждого шага;
+	//       добавьте opts.Examples, чтобы модель училась на прошлых исходах,
+	//       и planOrderRule)
+	// TODO: Вызовите LLM для получения плана (с opts.Temperature): streamPlan(ctx, client, req, opts.Tools)
+	//       проверяет каждый шаг по мере поступления и спрашивает снова, если шаг плохой
 	// TODO: Распарсите ответ LLM в структуру Plan
 	// TODO: Верните план
-	
+
 	return nil, fmt.Errorf("not implemented")
 }
 
@@ -46,11 +70,12 @@ func createPlan(ctx context.Context, client *openai.Client, task string) (*Plan,
 // Верните шаги, все зависимости которых выполнены
 // Обнаруживайте циклические зависимости
 func findReadySteps(plan *Plan) ([]*Step, error) {
-	// TODO: Пройдитесь по всем шагам
+	// TODO: Пройдитесь по всем шагам (кандидаты — только "pending";
+	//       шаги "held" исключены через --until)
 	// TODO: Проверьте, все ли зависимости выполнены
 	// TODO: Обнаруживайте циклические зависимости
 	// TODO: Верните готовые шаги
-	
+
 	return nil, fmt.Errorf("not implemented")
 }
 
@@ -59,10 +84,15 @@ func findReadySteps(plan *Plan) ([]*Step, error) {
 // Повторяйте неудачные шаги до maxRetries
 func executePlanWithRetries(ctx context.Context, plan *Plan, executor StepExecutor, maxRetries int) error {
 	// TODO: Найдите готовые шаги
-	// TODO: Выполните шаги
+	// TODO: Выполните шаги (независимые шаги могут идти параллельно: возьмите
+	//       бесконфликтный батч через nextBatch и выполните его через runBatch)
 	// TODO: Обработайте ошибки (повтор, пропуск, прерывание)
 	// TODO: Отслеживайте статус шагов
-	
+	// TODO: Верните nil, когда каждый шаг "completed" или "held" (--until):
+	//       отложенные шаги выполнятся при --resume, это не дедлок
+	// TODO: Остановитесь между шагами, когда ctx завершен (Ctrl+C), и верните ctx.Err():
+	//       завершенные шаги сохранены, --resume подхватит остальное
+
 	return fmt.Errorf("not implemented")
 }
 
@@ -71,7 +101,7 @@ func executePlanWithRetries(ctx context.Context, plan *Plan, executor StepExecut
 func savePlanState(planID string, plan *Plan) error {
 	// TODO: Сериализуйте план в JSON
 	// TODO: Сохраните в файл
-	
+
 	return fmt.Errorf("not implemented")
 }
 
@@ -81,7 +111,7 @@ func loadPlanState(planID string) (*Plan, error) {
 	// TODO: Прочитайте файл
 	// TODO: Десериализуйте JSON в Plan
 	// TODO: Верните план
-	
+
 	return nil, fmt.Errorf("not implemented")
 }
 
@@ -95,46 +125,153 @@ func (e *MockExecutor) Execute(step *Step) (string, error) {
 }
 
 func main() {
-	// Настройка клиента
-	token := os.Getenv("OPENAI_API_KEY")
-	baseURL := os.Getenv("OPENAI_BASE_URL")
-	if token == "" {
-		token = "dummy"
-	}
+	scenario := flag.String("scenario", "deploy", "scenario: deploy | autoscale")
+	until := flag.String("until", "", "execute only up to this step ID (and its dependencies), then stop")
+	resume := flag.String("resume", "", "resume a saved plan by ID instead of creating a new one")
+	candidates := flag.Int("k", 1, "generate k candidate plans, let a judge model pick the best")
+	useHistory := flag.Bool("history", true, "show plans of similar past tasks to the planner (disable to compare plan quality)")
+	maxDuration := flag.Duration("max-duration", 15*time.Minute, "ask for confirmation if the estimated duration exceeds this (0 = no limit)")
+	progress := flag.String("progress", "text", "progress events: text | json (JSON lines on stderr) | off")
+	maxCost := flag.Float64("max-cost", 0.01, "ask for confirmation if the estimated LLM cost in $ exceeds this (0 = no limit)")
+	flag.Parse()
 
-	config := openai.DefaultConfig(token)
-	if baseURL != "" {
-		config.BaseURL = baseURL
+	// Настройка клиента. LLM_PROVIDER выбирает бэкенд: openai (любой OpenAI-совместимый сервер), llamacpp, ollama, anthropic.
+	client, err := llm.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	client := openai.NewClientWithConfig(config)
 
-	ctx := context.Background()
+	// Ctrl+C останавливает план между шагами; его можно возобновить через --resume.
+	ctx, stop := agent.Interruptible(context.Background())
+	defer stop()
 
 	// Тестовая задача
 	task := "Deploy new version of service"
+	var executor StepExecutor = &MockExecutor{}
+
+	var clock simclock.Clock = simclock.Real{}
+	var svc *scalingService
+	if *scenario == "autoscale" {
+		// Очередь растет по симулированным часам; шаги вызывают scale_up/scale_down/verify_draining.
+		sim := simclock.New(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+		clock = sim
+		svc = newScalingService(sim)
+		executor = &ScalingExecutor{svc: svc}
+		task = "Queue depth of orders-worker keeps growing. Drain it by scaling up gradually.\n\n" + scalingToolsPrompt
+	}
 
 	fmt.Println("=== Lab 10: Planning and Workflows ===")
 	fmt.Printf("Task: %s\n\n", task)
 
 	// TODO: Создайте план
-	plan, err := createPlan(ctx, client, task)
+	var plan *Plan
+	if *resume != "" {
+		plan, err = loadPlanState(*resume)
+	} else {
+		var opts PlanOptions
+		if svc != nil {
+			opts.Tools = scalingTools
+		}
+		if *useHistory {
+			history, histErr := loadHistory(historyFile)
+			if histErr != nil {
+				fmt.Printf("Warning: ignoring plan history: %v\n", histErr)
+			}
+			past := similarPlans(ctx, client, history, task, 3, 0.3)
+			if len(past) > 0 {
+				fmt.Printf("Using %d similar past plans as examples\n", len(past))
+			}
+			opts.Examples = planningExamples(past)
+		}
+		if *candidates > 1 {
+			plan, err = createPlanPortfolio(ctx, client, task, opts, *candidates)
+		} else {
+			plan, err = createPlan(ctx, client, task, opts)
+		}
+	}
+	if err != nil && *resume == "" && *scenario == "autoscale" {
+		// Позволяет работать над исполнителем до того, как реализован createPlan.
+		fmt.Printf("Error creating plan: %v — using the reference autoscale plan\n", err)
+		plan, err = autoscalePlan(), nil
+	}
 	if err != nil {
 		fmt.Printf("Error creating plan: %v\n", err)
 		return
 	}
 
 	fmt.Printf("Plan created with %d steps\n", len(plan.Steps))
+	for _, c := range resourceConflicts(plan) {
+		fmt.Printf("Note: steps %s and %s both touch %s — they will run one after another\n", c.A, c.B, c.Resource)
+	}
+
+	// Частичное выполнение: выполнить только то, что нужно --until, остальное оставить для --resume.
+	release := func() {}
+	if *until != "" {
+		release, err = limitPlan(plan, *until)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+	}
+
+	// Оценка перед выполнением: история прошлых запусков, иначе эвристики.
+	stats, err := loadStats(statsFile)
+	if err != nil {
+		fmt.Printf("Warning: ignoring step history: %v\n", err)
+		stats = &StatsStore{path: statsFile, Steps: map[string]*StepStats{}}
+	}
+	estimate := estimatePlan(plan, stats)
+	printEstimate(estimate)
+	if !confirmEstimate(estimate, *maxDuration, *maxCost) {
+		release()
+		fmt.Println("Aborted.")
+		return
+	}
 
 	// TODO: Выполните план
-	executor := &MockExecutor{}
+	executor = &timedExecutor{inner: &conditionExecutor{inner: executor}, clock: clock, stats: stats}
+	switch *progress {
+	case "text":
+		executor = newProgressExecutor(executor, plan, estimate, clock, textSink(os.Stdout))
+	case "json":
+		executor = newProgressExecutor(executor, plan, estimate, clock, jsonSink(os.Stderr))
+	}
 	err = executePlanWithRetries(ctx, plan, executor, 3)
+	release()
+	if saveErr := stats.save(); saveErr != nil {
+		fmt.Printf("Warning: step history not saved: %v\n", saveErr)
+	}
+	if svc != nil {
+		fmt.Println("Service:", svc.status())
+	}
+	if saveErr := savePlanState(plan.ID, plan); saveErr != nil {
+		fmt.Printf("Warning: plan state not saved: %v\n", saveErr)
+	}
+	// Частичные запуски — еще не исход: план записывается, когда завершится или упадет.
+	interrupted := errors.Is(err, context.Canceled)
+	if *until == "" && !interrupted {
+		if histErr := recordPlanOutcome(ctx, client, historyFile, plan, err); histErr != nil {
+			fmt.Printf("Warning: plan history not saved: %v\n", histErr)
+		}
+	}
+	if interrupted {
+		printPlanStatus(plan)
+		fmt.Printf("\n⏹  Interrupted. Continue with: go run . --resume %s\n", plan.ID)
+		return
+	}
 	if err != nil {
+		printPlanStatus(plan)
 		fmt.Printf("Error executing plan: %v\n", err)
 		return
 	}
 
+	if *until != "" {
+		printPlanStatus(plan)
+		fmt.Printf("\nStopped after step %q. Continue with: go run . --resume %s\n", *until, plan.ID)
+		return
+	}
 	fmt.Println("\nPlan executed successfully!")
-	
+
 	_ = json.RawMessage{}
 }
-
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"github.com/kshvakov/agent/pkg/mockllm"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Офлайн-запуск: OPENAI_BASE_URL=mock go run . [-scenario autoscale] [-k 3]
+// Планировщик и судья — JSON-вызовы, которые различаются по промпту
+// судьи (в нём есть и задача). По три каждого покрывают -k 3. Эмбеддинги
+// для -history мок считает сам.
+func init() {
+	judge := mockllm.All(mockllm.JSONMode, mockllm.Mentions("You review execution plans"))
+	planner := func(req openai.ChatCompletionRequest) bool { return mockllm.JSONMode(req) && !judge(req) }
+	deploy := mockllm.All(planner, mockllm.Mentions("Deploy new version"))
+	autoscale := mockllm.All(planner, mockllm.Mentions("Queue depth"))
+
+	deployPlans := []string{
+		`{"steps": [
+  {"id": "build", "description": "Build the new image", "dependencies": []},
+  {"id": "test", "description": "Run the test suite", "dependencies": ["build"]},
+  {"id": "backup", "description": "Back up the database", "dependencies": []},
+  {"id": "deploy", "description": "Deploy the new version", "dependencies": ["test", "backup"]},
+  {"id": "verify", "description": "Verify health checks", "dependencies": ["deploy"]}
+]}`,
+		`{"steps": [
+  {"id": "build", "description": "Build the new image", "dependencies": []},
+  {"id": "deploy", "description": "Deploy the new version", "dependencies": ["build"]}
+]}`,
+		`{"steps": [
+  {"id": "build", "description": "Build the new image", "dependencies": []},
+  {"id": "test", "description": "Run the test suite", "dependencies": ["build"]},
+  {"id": "deploy", "description": "Deploy the new version", "dependencies": ["test"]},
+  {"id": "verify", "description": "Verify health checks", "dependencies": ["deploy"]}
+]}`,
+	}
+	const autoscalePlan = `{"steps": [
+  {"id": "check", "description": "Check queue depth and replicas", "tool": "check_queue", "dependencies": []},
+  {"id": "scale-1", "description": "Scale up by 2 replicas", "tool": "scale_up", "args": {"count": 2}, "dependencies": ["check"]},
+  {"id": "verify-1", "description": "Verify the queue is draining", "tool": "verify_draining", "dependencies": ["scale-1"]},
+  {"id": "scale-2", "description": "Scale up by 2 more replicas", "tool": "scale_up", "args": {"count": 2}, "dependencies": ["verify-1"]},
+  {"id": "verify-2", "description": "Verify the queue drains faster", "tool": "verify_draining", "dependencies": ["scale-2"]}
+]}`
+	scores := []string{
+		`{"completeness": 9, "safety": 8, "parallelism": 7, "comment": "backup runs alongside the build"}`,
+		`{"completeness": 4, "safety": 2, "parallelism": 5, "comment": "no tests, no verification"}`,
+		`{"completeness": 8, "safety": 6, "parallelism": 3, "comment": "safe but strictly sequential"}`,
+	}
+
+	for i := range 3 {
+		mockllm.Register(
+			mockllm.Say(deployPlans[i]).If(deploy),
+			mockllm.Say(autoscalePlan).If(autoscale),
+			mockllm.Say(scores[i]).If(judge),
+		)
+	}
+}
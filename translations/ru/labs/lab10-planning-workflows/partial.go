@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// statusHeld помечает шаги, исключённые из текущего частичного выполнения.
+// findReadySteps берёт только шаги "pending", поэтому отложенные пропускаются.
+const statusHeld = "held"
+
+// limitPlan ограничивает выполнение шагом until и всем, от чего он
+// (транзитивно) зависит. Остальные шаги в ожидании откладываются.
+// Возвращаемая функция release возвращает их в "pending", чтобы план
+// можно было сохранить и возобновить позже.
+func limitPlan(plan *Plan, until string) (release func(), err error) {
+	byID := make(map[string]*Step, len(plan.Steps))
+	for _, s := range plan.Steps {
+		byID[s.ID] = s
+	}
+	if _, ok := byID[until]; !ok {
+		return nil, fmt.Errorf("step %q not found in plan %s", until, plan.ID)
+	}
+
+	// Собираем шаг until и замыкание его зависимостей.
+	needed := map[string]bool{}
+	var visit func(id string)
+	visit = func(id string) {
+		if needed[id] {
+			return
+		}
+		needed[id] = true
+		if s, ok := byID[id]; ok {
+			for _, dep := range s.Dependencies {
+				visit(dep)
+			}
+		}
+	}
+	visit(until)
+
+	var held []*Step
+	for _, s := range plan.Steps {
+		if !needed[s.ID] && s.Status == "pending" {
+			s.Status = statusHeld
+			held = append(held, s)
+		}
+	}
+	return func() {
+		for _, s := range held {
+			if s.Status == statusHeld {
+				s.Status = "pending"
+			}
+		}
+	}, nil
+}
+
+// printPlanStatus показывает каждый шаг с его статусом и результатом,
+// чтобы промежуточные результаты можно было посмотреть между частичными запусками.
+func printPlanStatus(plan *Plan) {
+	fmt.Printf("\nPlan %s:\n", plan.ID)
+	for _, s := range plan.Steps {
+		deps := ""
+		if len(s.Dependencies) > 0 {
+			deps = " (after " + strings.Join(s.Dependencies, ", ") + ")"
+		}
+		fmt.Printf("  [%-9s] %s: %s%s\n", s.Status, s.ID, s.Description, deps)
+		if s.Result != "" {
+			fmt.Printf("              → %s\n", s.Result)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/simclock"
+)
+
+// --- События прогресса ---
+//
+// Длинные планы не должны выполняться молча. progressExecutor оборачивает исполнитель и
+// испускает ProgressEvent, когда шаг начинается и заканчивается. События — простые
+// структуры, так что TUI или веб-фронтенд может потреблять их как строки JSON.
+
+// ProgressEvent описывает одно изменение в выполнении плана.
+type ProgressEvent struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"` // step_started, step_finished, step_failed
+	PlanID  string    `json:"plan_id"`
+	StepID  string    `json:"step_id"`
+	Done    int       `json:"done"`
+	Total   int       `json:"total"`
+	Percent float64   `json:"percent"`
+	// ETA — оценка оставшегося времени (критический путь незавершённых шагов).
+	ETA   time.Duration `json:"eta_ns"`
+	Error string        `json:"error,omitempty"`
+}
+
+// ProgressSink получает события прогресса.
+type ProgressSink func(ProgressEvent)
+
+// jsonSink пишет события строками JSON.
+func jsonSink(w io.Writer) ProgressSink {
+	enc := json.NewEncoder(w)
+	return func(ev ProgressEvent) { _ = enc.Encode(ev) }
+}
+
+// textSink пишет по одной понятной человеку строке на событие.
+func textSink(w io.Writer) ProgressSink {
+	return func(ev ProgressEvent) {
+		line := fmt.Sprintf("[%3.0f%%] %d/%d %s %s, ETA %s", ev.Percent, ev.Done, ev.Total, ev.Type, ev.StepID, ev.ETA.Round(time.Second))
+		if ev.Error != "" {
+			line += ": " + ev.Error
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// progressExecutor испускает события вокруг каждого шага. ETA берётся из
+// оценки плана (исторические длительности или эвристики, см. estimate.go).
+type progressExecutor struct {
+	inner StepExecutor
+	plan  *Plan
+	est   map[string]StepEstimate
+	clock simclock.Clock
+	sink  ProgressSink
+
+	total int // Шаги, которые будут выполняться в этом запуске, включая уже выполненные
+
+	mu   sync.Mutex
+	done map[string]bool
+}
+
+func newProgressExecutor(inner StepExecutor, plan *Plan, pe PlanEstimate, clock simclock.Clock, sink ProgressSink) *progressExecutor {
+	e := &progressExecutor{
+		inner: inner,
+		plan:  plan,
+		est:   map[string]StepEstimate{},
+		clock: clock,
+		sink:  sink,
+		done:  map[string]bool{},
+	}
+	for _, s := range pe.Steps {
+		e.est[s.StepID] = s
+	}
+	// Шаги, выполненные в прошлом запуске (--resume), считаются выполненными;
+	// отложенные шаги (--until) выполняться не будут и не считаются вовсе.
+	for _, s := range plan.Steps {
+		switch s.Status {
+		case statusHeld:
+			continue
+		case "completed":
+			e.done[s.ID] = true
+		}
+		e.total++
+	}
+	return e
+}
+
+func (e *progressExecutor) Execute(step *Step) (string, error) {
+	e.emit("step_started", step, nil)
+	result, err := e.inner.Execute(step)
+	if err != nil {
+		// Исполнитель повторяется, так что провал не окончательный.
+		e.emit("step_failed", step, err)
+		return result, err
+	}
+	e.mu.Lock()
+	e.done[step.ID] = true
+	e.mu.Unlock()
+	e.emit("step_finished", step, nil)
+	return result, nil
+}
+
+func (e *progressExecutor) emit(typ string, step *Step, err error) {
+	e.mu.Lock()
+	remaining := map[string]StepEstimate{}
+	for id, est := range e.est {
+		if !e.done[id] {
+			remaining[id] = est
+		}
+	}
+	done := len(e.done)
+	e.mu.Unlock()
+
+	ev := ProgressEvent{
+		Time:   e.clock.Now(),
+		Type:   typ,
+		PlanID: e.plan.ID,
+		StepID: step.ID,
+		Done:   done,
+		Total:  e.total,
+		ETA:    criticalPath(e.plan, remaining),
+	}
+	if e.total > 0 {
+		ev.Percent = float64(done) * 100 / float64(e.total)
+	}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	e.sink(ev)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/parse"
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Стриминг плана ---
+//
+// План приходит токен за токеном, а плохой план обычно плох с самого начала:
+// второй шаг зависит от шага, которого нет, или вызывает инструмент, которого в
+// сценарии нет. Дожидаясь всего плана, чтобы его проверить, мы платим
+// за каждый шаг после ошибки. streamPlan проверяет каждый шаг, как только
+// приходит его закрывающая скобка (parse.Elements), и останавливает стрим на
+// первом плохом; модель просят снова, сказав, что было не так.
+//
+// Шаг может зависеть только от шагов выше него. Это можно проверить до того,
+// как план готов, и в плане, который это соблюдает, нет циклов.
+
+// planRepairs — сколько раз план, остановленный на плохом шаге, запрашивается
+// снова.
+const planRepairs = 2
+
+// planOrderRule идёт в промпт планировщика: это то, что проверяет
+// checkPlanStep.
+const planOrderRule = "List the steps in order: a step may depend only on steps listed before it."
+
+// BadStepError — шаг плана, который не прошёл проверку, пока план
+// стримился.
+type BadStepError struct {
+	Step    int // С 1
+	ID      string
+	Problem string
+}
+
+func (e *BadStepError) Error() string {
+	return fmt.Sprintf("step %d (%s): %s", e.Step, e.ID, e.Problem)
+}
+
+// checkPlanStep проверяет шаг i (с 0) стримящегося плана по
+// шагам до него, по id, и по инструментам шагов (их нет вне сценария
+// autoscale).
+func checkPlanStep(i int, raw json.RawMessage, before []string, tools []string) (string, error) {
+	var step struct {
+		ID           string      `json:"id"`
+		Dependencies []string    `json:"dependencies"`
+		Tool         string      `json:"tool"`
+		Pre          []Condition `json:"pre"`
+		Post         []Condition `json:"post"`
+	}
+	if err := json.Unmarshal(raw, &step); err != nil {
+		return "", &BadStepError{Step: i + 1, Problem: "not a step object"}
+	}
+	bad := func(format string, args ...any) error {
+		return &BadStepError{Step: i + 1, ID: step.ID, Problem: fmt.Sprintf(format, args...)}
+	}
+	switch {
+	case step.ID == "":
+		return "", bad("no id")
+	case slices.Contains(before, step.ID):
+		return "", bad("the id is taken by an earlier step")
+	}
+	for _, dep := range step.Dependencies {
+		if !slices.Contains(before, dep) {
+			return "", bad("depends on %q, which is not a step above it", dep)
+		}
+	}
+	for _, c := range slices.Concat([]Condition{{Tool: step.Tool}}, step.Pre, step.Post) {
+		if c.Tool != "" && !slices.Contains(tools, c.Tool) {
+			if len(tools) == 0 {
+				return "", bad("calls %s, but this task has no step tools", c.Tool)
+			}
+			return "", bad("calls %s, which is not one of the step tools (%s)", c.Tool, strings.Join(tools, ", "))
+		}
+	}
+	return step.ID, nil
+}
+
+// streamPlan отправляет запрос планировщика req со стримингом и возвращает
+// текст плана, каждый шаг которого прошёл checkPlanStep. План, остановленный на
+// плохом шаге, запрашивается снова, до planRepairs раз.
+func streamPlan(ctx context.Context, client llm.Provider, req openai.ChatCompletionRequest, tools []string) (string, error) {
+	req.Stream = true
+	req.Messages = slices.Clone(req.Messages)
+	for attempt := 0; ; attempt++ {
+		text, err := streamPlanOnce(ctx, client, req, tools)
+		var bad *BadStepError
+		if !errors.As(err, &bad) || attempt == planRepairs {
+			return text, err
+		}
+		fmt.Printf("✂️  Plan stopped at %v. Asking again.\n", bad)
+		req.Messages = append(req.Messages,
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: text},
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: fmt.Sprintf(
+				"Your plan was stopped at %v. Write the whole plan again with that fixed. %s", bad, planOrderRule)})
+	}
+}
+
+// streamPlanOnce стримит один ответ, останавливаясь на первом плохом шаге:
+// текст на этот момент возвращается вместе с *BadStepError.
+func streamPlanOnce(ctx context.Context, client llm.Provider, req openai.ChatCompletionRequest, tools []string) (string, error) {
+	stream, err := client.Stream(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	var ids []string
+	steps := parse.NewElements("steps", func(i int, raw json.RawMessage) error {
+		id, err := checkPlanStep(i, raw, ids, tools)
+		ids = append(ids, id)
+		return err
+	})
+	resp, err := llm.CollectUntil(stream, steps.Write)
+	if len(resp.Choices) == 0 {
+		return "", err
+	}
+	return resp.Choices[0].Message.Content, err
+}
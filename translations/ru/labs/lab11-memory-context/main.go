@@ -3,11 +3,19 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/kshvakov/agent/pkg/agent"
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/normalize"
+	"github.com/kshvakov/agent/pkg/redact"
+	"github.com/kshvakov/agent/pkg/schema"
+	"github.com/kshvakov/agent/pkg/tools"
 	"github.com/sashabaranov/go-openai"
 )
 
@@ -68,19 +76,19 @@ type Run struct {
 	contextMax   int
 	condenseDone bool
 
-	client *openai.Client
+	client llm.Provider
 	model  string
-	tools  []openai.Tool
+	tools  *tools.Registry
 	store  Store
 }
 
-func NewRun(client *openai.Client, model string, contextMax int, store Store, systemPrompt string, tools []openai.Tool) *Run {
+func NewRun(client llm.Provider, model string, contextMax int, store Store, systemPrompt string, reg *tools.Registry) *Run {
 	return &Run{
 		client:     client,
 		model:      model,
 		contextMax: contextMax,
 		store:      store,
-		tools:      tools,
+		tools:      reg,
 		messages: []openai.ChatCompletionMessage{
 			{Role: openai.ChatMessageRoleSystem, Content: systemPrompt},
 		},
@@ -114,7 +122,10 @@ func (r *Run) Step(ctx context.Context, userInput string) (string, error) {
 		}
 
 		for _, tc := range msg.ToolCalls {
-			result := r.dispatchTool(ctx, tc)
+			result, err := r.tools.Dispatch(ctx, tc)
+			if err != nil {
+				result = fmt.Sprintf("error: %v", err)
+			}
 			r.messages = append(r.messages, openai.ChatCompletionMessage{
 				Role:       openai.ChatMessageRoleTool,
 				ToolCallID: tc.ID,
@@ -126,10 +137,10 @@ func (r *Run) Step(ctx context.Context, userInput string) (string, error) {
 }
 
 func (r *Run) callLLM(ctx context.Context) (openai.ChatCompletionResponse, error) {
-	return r.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+	return r.client.ChatCompletion(ctx, openai.ChatCompletionRequest{
 		Model:       r.model,
 		Messages:    r.messages,
-		Tools:       r.tools,
+		Tools:       r.tools.Definitions(),
 		Temperature: 0,
 	})
 }
@@ -155,51 +166,81 @@ func (r *Run) condense(ctx context.Context) error {
 
 // summarize вызывает LLM, чтобы получить краткую справку по куску истории.
 func (r *Run) summarize(ctx context.Context, head []openai.ChatCompletionMessage) (string, error) {
-	// TODO 9: соберите input как линейный текст (роль: контент),
-	// отправьте отдельный запрос с системным промптом из MANUAL.md
+	// TODO 9: соберите input как линейный текст (роль: контент), замаскируйте
+	// в нём секреты через redact.Text (как это делает memory_save), отправьте отдельный запрос с системным промптом из MANUAL.md
 	// (раздел «Шаг 2: condense») и верните Choices[0].Message.Content.
 	return "", fmt.Errorf("not implemented")
 }
 
-// dispatchTool разруливает вызовы memory_save / memory_recall / memory_delete.
-// Возвращает строку, которая идёт в content tool-сообщения.
-func (r *Run) dispatchTool(ctx context.Context, tc openai.ToolCall) string {
-	switch tc.Function.Name {
-	case "memory_save":
-		var args struct {
-			Key, Value string
-		}
-		if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
-			return fmt.Sprintf("error: %v", err)
-		}
-		if err := r.store.Save(ctx, args.Key, args.Value); err != nil {
-			return fmt.Sprintf("error: %v", err)
-		}
-		return "ok"
-
-	case "memory_recall":
-		var args struct{ Query string }
-		if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
-			return fmt.Sprintf("error: %v", err)
-		}
-		hits, err := r.store.Recall(ctx, args.Query)
-		if err != nil {
-			return fmt.Sprintf("error: %v", err)
-		}
-		out, _ := json.Marshal(hits)
-		return string(out)
-
-	case "memory_delete":
-		var args struct{ Key string }
-		if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
-			return fmt.Sprintf("error: %v", err)
-		}
-		if err := r.store.Delete(ctx, args.Key); err != nil {
-			return fmt.Sprintf("error: %v", err)
-		}
-		return "ok"
+// memoryTools возвращает memory_save / memory_recall / memory_delete поверх store.
+// Возвращаемая строка идёт в content tool-сообщения.
+func memoryTools(store Store) []tools.Tool {
+	return []tools.Tool{
+		{
+			Name:        "memory_save",
+			Description: "Save a long-term note. Use for stable facts about the user or project.",
+			Params: schema.Object().
+				Prop("key", schema.String("")).
+				Prop("value", schema.String("")).
+				Require("key", "value"),
+			Execute: func(ctx context.Context, raw json.RawMessage) (string, error) {
+				var args struct {
+					Key, Value string
+				}
+				if err := json.Unmarshal(raw, &args); err != nil {
+					return "", err
+				}
+				// Заметка живёт дольше сессии: маскируем учётные данные
+				// и персональные данные до записи, а даты, версии и
+				// размеры пишем единообразно, чтобы recall их находил.
+				value, masked := redact.Text(args.Value)
+				value = normalize.Text(value)
+				if err := store.Save(ctx, args.Key, value); err != nil {
+					return "", err
+				}
+				if len(masked) > 0 {
+					return "ok, masked: " + strings.Join(masked, ", "), nil
+				}
+				return "ok", nil
+			},
+		},
+		{
+			Name:        "memory_recall",
+			Description: "Search long-term notes by query (substring).",
+			Params: schema.Object().
+				Prop("query", schema.String("")).
+				Require("query"),
+			Execute: func(ctx context.Context, raw json.RawMessage) (string, error) {
+				var args struct{ Query string }
+				if err := json.Unmarshal(raw, &args); err != nil {
+					return "", err
+				}
+				hits, err := store.Recall(ctx, normalize.Text(args.Query))
+				if err != nil {
+					return "", err
+				}
+				out, _ := json.Marshal(hits)
+				return string(out), nil
+			},
+		},
+		{
+			Name:        "memory_delete",
+			Description: "Delete a note by key.",
+			Params: schema.Object().
+				Prop("key", schema.String("")).
+				Require("key"),
+			Execute: func(ctx context.Context, raw json.RawMessage) (string, error) {
+				var args struct{ Key string }
+				if err := json.Unmarshal(raw, &args); err != nil {
+					return "", err
+				}
+				if err := store.Delete(ctx, args.Key); err != nil {
+					return "", err
+				}
+				return "ok", nil
+			},
+		},
 	}
-	return fmt.Sprintf("unknown tool: %s", tc.Function.Name)
 }
 
 // isContextOverflow возвращает true, если ошибка похожа на переполнение окна модели.
@@ -208,23 +249,13 @@ func isContextOverflow(err error) bool {
 	return false
 }
 
-// jsonSchema — хелпер для удобной записи Parameters в tools.
-func jsonSchema(s string) json.RawMessage {
-	return json.RawMessage(s)
-}
-
 func main() {
-	token := os.Getenv("OPENAI_API_KEY")
-	baseURL := os.Getenv("OPENAI_BASE_URL")
-	if token == "" {
-		token = "dummy"
-	}
-
-	cfg := openai.DefaultConfig(token)
-	if baseURL != "" {
-		cfg.BaseURL = baseURL
+	// LLM_PROVIDER выбирает бэкенд: openai (любой OpenAI-совместимый сервер), llamacpp, ollama, anthropic.
+	client, err := llm.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	client := openai.NewClientWithConfig(cfg)
 
 	store, err := NewFileStore("memory.json")
 	if err != nil {
@@ -232,53 +263,24 @@ func main() {
 		os.Exit(1)
 	}
 
-	tools := []openai.Tool{
-		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
-			Name:        "memory_save",
-			Description: "Save a long-term note. Use for stable facts about the user or project.",
-			Parameters: jsonSchema(`{
-				"type":"object",
-				"properties":{
-					"key":{"type":"string"},
-					"value":{"type":"string"}
-				},
-				"required":["key","value"]
-			}`),
-		}},
-		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
-			Name:        "memory_recall",
-			Description: "Search long-term notes by query (substring).",
-			Parameters: jsonSchema(`{
-				"type":"object",
-				"properties":{
-					"query":{"type":"string"}
-				},
-				"required":["query"]
-			}`),
-		}},
-		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
-			Name:        "memory_delete",
-			Description: "Delete a note by key.",
-			Parameters: jsonSchema(`{
-				"type":"object",
-				"properties":{
-					"key":{"type":"string"}
-				},
-				"required":["key"]
-			}`),
-		}},
-	}
+	reg := tools.NewRegistry(memoryTools(store)...)
 
 	systemPrompt := `You are an assistant.
 You have memory_save / memory_recall / memory_delete tools that persist between sessions.
 Use them for stable facts about the user and project. Don't store transient statuses.`
 
-	run := NewRun(client, "gpt-4o-mini", 128_000, store, systemPrompt, tools)
+	run := NewRun(client, "gpt-4o-mini", 128_000, store, systemPrompt, reg)
 
-	ctx := context.Background()
+	// Ctrl+C останавливает запуск после текущего шага и печатает, что сделано.
+	ctx, stop := agent.Interruptible(context.Background())
+	defer stop()
 
 	// Демонстрационный шаг. В реальной лабе здесь должен быть REPL.
 	answer, err := run.Step(ctx, "Запомни, что меня зовут Иван и я отвечаю за prod-кластер.")
+	if errors.Is(err, context.Canceled) {
+		fmt.Printf("\n⏹  Interrupted. So far:\n%s", agent.Recap(run.messages))
+		return
+	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "step:", err)
 		os.Exit(1)
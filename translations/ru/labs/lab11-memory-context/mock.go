@@ -0,0 +1,15 @@
+package main
+
+import "github.com/kshvakov/agent/pkg/mockllm"
+
+// Офлайн-запуск: OPENAI_BASE_URL=mock go run .
+// Сценарная модель решает сохранить оба факта, как просит системный промпт.
+func init() {
+	mockllm.Register(
+		mockllm.Turn{ToolCalls: []mockllm.ToolCall{
+			{Name: "memory_save", Args: map[string]any{"key": "user.name", "value": "Иван"}},
+			{Name: "memory_save", Args: map[string]any{"key": "user.responsibility", "value": "prod-кластер"}},
+		}},
+		mockllm.Say("Понял, Иван: запомню, что вы отвечаете за prod-кластер."),
+	)
+}
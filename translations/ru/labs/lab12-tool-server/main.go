@@ -4,10 +4,14 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"expvar"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"os/exec"
+
+	"github.com/kshvakov/agent/pkg/schema"
 )
 
 // ToolRequest представляет запрос на выполнение инструмента
@@ -19,9 +23,10 @@ type ToolRequest struct {
 
 // ToolResponse представляет ответ от tool server
 type ToolResponse struct {
-	Success bool   `json:"success"`
-	Result  string `json:"result"`
-	Error   string `json:"error,omitempty"`
+	Success     bool   `json:"success"`
+	Result      string `json:"result"`
+	Error       string `json:"error,omitempty"`
+	Deprecation string `json:"deprecation,omitempty"` // Заполняется, когда вызвано устаревшее имя инструмента
 }
 
 // ToolDefinition представляет определение инструмента
@@ -31,6 +36,81 @@ type ToolDefinition struct {
 	CompatibleWith []string        `json:"compatible_with"`
 	Description    string          `json:"description"`
 	Parameters     json.RawMessage `json:"parameters"`
+	Deprecated     bool            `json:"deprecated,omitempty"`
+	ReplacedBy     string          `json:"replaced_by,omitempty"` // Имя инструмента, который надо вызывать вместо этого
+}
+
+// deprecatedCalls считает вызовы устаревших инструментов по имени.
+// expvar публикует его на /debug/vars, когда HTTP-сервер использует default mux.
+var deprecatedCalls = expvar.NewMap("deprecated_tool_calls")
+
+// deprecatedAlias регистрирует старое имя инструмента как устаревший алиас нового.
+// Алиас сохраняет тот же контракт, поэтому существующие агенты работают, пока мигрируют.
+func deprecatedAlias(oldName string, replacement *ToolDefinition) *ToolDefinition {
+	alias := *replacement
+	alias.Name = oldName
+	alias.Description = fmt.Sprintf("DEPRECATED: use %s instead. %s", replacement.Name, replacement.Description)
+	alias.Deprecated = true
+	alias.ReplacedBy = replacement.Name
+	return &alias
+}
+
+// deprecationNote — сообщение, которое модель получает вместе с результатом.
+func deprecationNote(tool *ToolDefinition) string {
+	if tool.ReplacedBy == "" {
+		return fmt.Sprintf("tool %q is deprecated and will be removed", tool.Name)
+	}
+	return fmt.Sprintf("tool %q is deprecated, call %q instead", tool.Name, tool.ReplacedBy)
+}
+
+// validateArguments проверяет аргументы по опубликованной схеме инструмента,
+// чтобы кривой вызов отклонялся до того, как дойдёт до инструмента.
+func validateArguments(tool *ToolDefinition, arguments json.RawMessage) error {
+	if len(tool.Parameters) == 0 {
+		return nil
+	}
+	s, err := schema.Parse(tool.Parameters)
+	if err != nil {
+		return fmt.Errorf("tool %s: %w", tool.Name, err)
+	}
+	return s.Validate(arguments)
+}
+
+// handleRequest находит инструмент, проверяет версию и аргументы и выполняет его.
+// Устаревшие инструменты по-прежнему работают (через замену), но ответ
+// несёт пометку, чтобы модель могла перейти на новое имя.
+func handleRequest(tools map[string]*ToolDefinition, req ToolRequest) ToolResponse {
+	tool, ok := tools[req.Tool]
+	if !ok {
+		return ToolResponse{Success: false, Error: fmt.Sprintf("unknown tool: %s", req.Tool)}
+	}
+	if !checkVersionCompatibility(tool, req.Version) {
+		return ToolResponse{Success: false, Error: fmt.Sprintf("tool %s: version %s is not compatible", req.Tool, req.Version)}
+	}
+	if err := validateArguments(tool, req.Arguments); err != nil {
+		return ToolResponse{Success: false, Error: err.Error()}
+	}
+
+	var resp ToolResponse
+	name := tool.Name
+	if tool.Deprecated {
+		deprecatedCalls.Add(tool.Name, 1)
+		// log пишет в stderr, поэтому не ломает stdio protocol на stdout.
+		log.Printf("deprecated tool called: %s (replaced by %q)", tool.Name, tool.ReplacedBy)
+		resp.Deprecation = deprecationNote(tool)
+		if tool.ReplacedBy != "" {
+			name = tool.ReplacedBy
+		}
+	}
+
+	result, err := executeTool(name, req.Arguments)
+	if err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+	resp.Success = true
+	resp.Result = result
+	return resp
 }
 
 // TODO 1: Реализуйте stdio protocol для tool server
@@ -51,10 +131,9 @@ func (s *StdioToolServer) RegisterTool(tool *ToolDefinition) {
 
 func (s *StdioToolServer) Start() error {
 	// TODO: Читайте запросы из stdin (JSON)
-	// TODO: Проверяйте версию
-	// TODO: Выполняйте инструмент
+	// TODO: Проверяйте версию и выполняйте инструмент — handleRequest(s.tools, req) делает и то, и другое
 	// TODO: Пишите ответ в stdout (JSON)
-	
+
 	return fmt.Errorf("not implemented")
 }
 
@@ -76,9 +155,9 @@ func (s *HTTPToolServer) RegisterTool(tool *ToolDefinition) {
 
 func (s *HTTPToolServer) Start(port string) error {
 	// TODO: Создайте HTTP endpoint POST /execute
-	// TODO: Обработайте запрос
+	// TODO: Обработайте запрос через handleRequest(s.tools, req)
 	// TODO: Верните JSON ответ
-	
+
 	return fmt.Errorf("not implemented")
 }
 
@@ -87,14 +166,16 @@ func checkVersionCompatibility(tool *ToolDefinition, requestedVersion string) bo
 	// TODO: Проверьте, совместима ли запрошенная версия
 	// TODO: Учтите поле CompatibleWith
 	// TODO: Верните true если совместима
-	
+
 	return false
 }
 
 // TODO 4: Реализуйте tool client для агента
 // Клиент для вызова tool server через протокол
 type ToolClient interface {
-	CallTool(tool string, version string, arguments json.RawMessage) (string, error)
+	// CallTool сдаётся, когда ctx завершён: Ctrl+C не должен ждать
+	// зависший tool server.
+	CallTool(ctx context.Context, tool string, version string, arguments json.RawMessage) (string, error)
 }
 
 type StdioToolClient struct {
@@ -104,15 +185,15 @@ type StdioToolClient struct {
 func NewStdioToolClient(serverPath string) (*StdioToolClient, error) {
 	// TODO: Запустите tool server как отдельный процесс
 	// TODO: Настройте stdin/stdout для коммуникации
-	
+
 	return nil, fmt.Errorf("not implemented")
 }
 
-func (c *StdioToolClient) CallTool(tool string, version string, arguments json.RawMessage) (string, error) {
+func (c *StdioToolClient) CallTool(ctx context.Context, tool string, version string, arguments json.RawMessage) (string, error) {
 	// TODO: Отправьте запрос в tool server через stdin
-	// TODO: Прочитайте ответ из stdout
+	// TODO: Прочитайте ответ из stdout; верните ctx.Err(), если ctx завершился раньше
 	// TODO: Верните результат
-	
+
 	return "", fmt.Errorf("not implemented")
 }
 
@@ -128,11 +209,11 @@ func NewHTTPToolClient(baseURL string) *HTTPToolClient {
 	}
 }
 
-func (c *HTTPToolClient) CallTool(tool string, version string, arguments json.RawMessage) (string, error) {
-	// TODO: Отправьте HTTP POST запрос
+func (c *HTTPToolClient) CallTool(ctx context.Context, tool string, version string, arguments json.RawMessage) (string, error) {
+	// TODO: Отправьте HTTP POST запрос с ctx (http.NewRequestWithContext)
 	// TODO: Обработайте ответ
 	// TODO: Верните результат
-	
+
 	return "", fmt.Errorf("not implemented")
 }
 
@@ -141,7 +222,7 @@ func executeTool(toolName string, arguments json.RawMessage) (string, error) {
 	switch toolName {
 	case "check_status":
 		return "Server is ONLINE", nil
-	case "restart_service":
+	case "svc_restart":
 		return "Service restarted successfully", nil
 	default:
 		return "", fmt.Errorf("unknown tool: %s", toolName)
@@ -151,23 +232,35 @@ func executeTool(toolName string, arguments json.RawMessage) (string, error) {
 func main() {
 	// Пример использования stdio protocol
 	fmt.Println("=== Lab 12: Tool Server Protocol ===")
-	fmt.Println("Starting stdio tool server...\n")
+	fmt.Println("Starting stdio tool server...")
+	fmt.Println()
 
 	server := NewStdioToolServer()
-	
+
 	// Регистрируем инструмент
 	server.RegisterTool(&ToolDefinition{
 		Name:           "check_status",
 		Version:        "1.0",
 		CompatibleWith: []string{"1.0", "1.1"},
 		Description:    "Check server status",
-		Parameters:     json.RawMessage(`{"type": "object", "properties": {"hostname": {"type": "string"}}}`),
+		Parameters:     schema.Object().Prop("hostname", schema.String("")).Raw(),
 	})
 
+	// restart_service переименован в svc_restart: старые агенты продолжают работать,
+	// но каждый вызов возвращает пометку об устаревании и увеличивает метрику.
+	svcRestart := &ToolDefinition{
+		Name:           "svc_restart",
+		Version:        "1.0",
+		CompatibleWith: []string{"1.0"},
+		Description:    "Restart a service",
+		Parameters:     schema.Object().Prop("service", schema.String("")).Require("service").Raw(),
+	}
+	server.RegisterTool(svcRestart)
+	server.RegisterTool(deprecatedAlias("restart_service", svcRestart))
+
 	// TODO: Запустите сервер
 	// server.Start()
 
 	_ = bufio.NewReader(os.Stdin)
 	_ = context.Background()
 }
-
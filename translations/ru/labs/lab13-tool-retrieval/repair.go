@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// --- Починка упавшего пайплайна ---
+//
+// Пайплайн, упавший на шаге 4, упал по причине, которая в этом шаге:
+// не хватает аргумента, инструмента нет в каталоге. "step 3 failed" заставляет
+// модель пересобрать весь пайплайн, и новый часто ломает шаг, который
+// работал. Вместо этого executePipeline возвращает *StepError: какой шаг,
+// вызов в том виде, в каком он был сделан, ошибку и начало вывода, который
+// дали шаги до него. Модель чинит этот один шаг и отправляет пайплайн
+// снова.
+//
+// -seed-failure нарочно ломает шаг первого пайплайна, что бы ни написала
+// модель, поэтому цикл починки можно проверить с любой моделью: он
+// должен сойтись не больше чем за maxRepairs повторных попыток.
+
+// maxRepairs — сколько повторных попыток может занять починка упавшего пайплайна.
+const maxRepairs = 2
+
+// inputPreview — сколько входа упавшего шага показывает StepError.
+const inputPreview = 300
+
+// StepError — упавший шаг пайплайна. Его сообщение — то, что читает
+// модель.
+type StepError struct {
+	Step    int                    `json:"step"`  // С 1
+	Steps   int                    `json:"steps"` // В пайплайне
+	Tool    string                 `json:"tool"`
+	Args    map[string]interface{} `json:"args"`
+	Message string                 `json:"error"`
+	Input   string                 `json:"input"` // Начало вывода шагов до него
+}
+
+func (e *StepError) Error() string {
+	details, _ := json.MarshalIndent(e, "", "  ")
+	worked := ""
+	if e.Step > 1 {
+		worked = fmt.Sprintf(", steps 1-%d worked", e.Step-1)
+	}
+	return fmt.Sprintf("pipeline failed at step %d of %d (%s)%s. Fix this step and send the whole pipeline again.\n%s",
+		e.Step, e.Steps, e.Tool, worked, details)
+}
+
+// stepError описывает шаг i (с 0) пайплайна p, упавший с err на входе input.
+func stepError(p Pipeline, i int, err error, input string) *StepError {
+	if len(input) > inputPreview {
+		input = input[:inputPreview] + "..."
+	}
+	return &StepError{
+		Step:    i + 1,
+		Steps:   len(p.Steps),
+		Tool:    p.Steps[i].Tool,
+		Args:    p.Steps[i].Args,
+		Message: err.Error(),
+		Input:   input,
+	}
+}
+
+// seedFailure выбрасывает аргументы первого шага, которому они нужны (grep,
+// head), и возвращает пайплайн и этот шаг, с 1; 0, если аргументы не нужны
+// ни одному шагу или pipelineJSON не разбирается.
+func seedFailure(pipelineJSON string) (string, int) {
+	var p Pipeline
+	if err := json.Unmarshal([]byte(pipelineJSON), &p); err != nil {
+		return pipelineJSON, 0
+	}
+	for i, step := range p.Steps {
+		if step.Tool == "grep" || step.Tool == "head" {
+			p.Steps[i].Args = map[string]interface{}{}
+			broken, err := json.Marshal(p)
+			if err != nil {
+				return pipelineJSON, 0
+			}
+			return string(broken), i + 1
+		}
+	}
+	return pipelineJSON, 0
+}
+
+// repairs следит за вызовами execute_pipeline в запуске.
+type repairs struct {
+	calls  int
+	ranOn  int // Вызов, на котором пайплайн впервые прошёл целиком, с 1; 0, если такого не было
+	seeded int // Шаг, который сломал -seed-failure, с 1
+}
+
+// verdict говорит, починена ли подстроенная поломка за maxRepairs
+// повторных попыток, для -seed-failure.
+func (r *repairs) verdict() (string, bool) {
+	switch {
+	case r.seeded == 0:
+		return "no step to break: the first pipeline had no grep or head", false
+	case r.ranOn == 0:
+		return fmt.Sprintf("not repaired: %d calls, none ran through", r.calls), false
+	case r.ranOn-1 > maxRepairs:
+		return fmt.Sprintf("repaired on retry %d, later than the limit of %d", r.ranOn-1, maxRepairs), false
+	}
+	return fmt.Sprintf("repaired on retry %d (limit %d)", r.ranOn-1, maxRepairs), true
+}
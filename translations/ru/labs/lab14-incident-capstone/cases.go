@@ -0,0 +1,134 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/normalize"
+)
+
+// --- Прошлые инциденты (case-based reasoning) ---
+//
+// Урок — это то, что модель решила записать. Кейс — это то, что произошло:
+// каждый решённый запуск записывает программа, а не модель: алерт,
+// симптомы, которые увидел агент, названную им причину, действия, которые
+// всё исправили, и сколько это заняло. При новом алерте самые похожие
+// кейсы попадают в план и в цикл до любой проверки, поэтому повторный
+// инцидент узнаётся, а не расследуется с нуля.
+
+// Case — один решённый инцидент.
+type Case struct {
+	ID        string        `json:"id"` // ID запуска: в runs/<id>/ лежит транскрипт
+	Alert     string        `json:"alert"`
+	Symptoms  []string      `json:"symptoms"`   // HTTP-статус и ошибки из логов, без отметок времени
+	RootCause string        `json:"root_cause"` // Урок агента или его финальный ответ
+	Fix       []string      `json:"fix"`        // Действия, по порядку
+	Resolved  time.Duration `json:"resolved"`   // Симулированное время от алерта до исправления
+	ToolCalls int           `json:"tool_calls"`
+	At        time.Time     `json:"at"`
+	Seen      int           `json:"seen"` // Запуски, закончившиеся этими симптомами и этим исправлением
+}
+
+// sameCase сообщает, один ли это инцидент, увиденный дважды: те же
+// симптомы, исправленные тем же способом.
+func sameCase(a, b Case) bool {
+	return slices.Equal(a.Symptoms, b.Symptoms) && slices.Equal(a.Fix, b.Fix)
+}
+
+// similarCase — вспомненный кейс и его близость к новому алерту,
+// от 0 до 1.
+type similarCase struct {
+	Case
+	Score float64
+}
+
+// caseThreshold — наименьшая близость, которую стоит показывать модели:
+// кейс, у которого с алертом одно-два общих слова, — шум, а не опыт.
+const caseThreshold = 0.3
+
+// actionTools меняют сервис: исправление в кейсе — это их вызовы.
+var actionTools = []string{"backup_db", "restart_service", "rollback_deploy"}
+
+// similarity — доля слов алерта, найденных в алерте и симптомах кейса.
+// Пересечению слов не нужны embeddings, поэтому оно работает офлайн и
+// с любым провайдером; как это сделать на векторах, показывает Lab 07.
+func similarity(alert string, c Case) float64 {
+	query := caseWords(alert)
+	if len(query) == 0 {
+		return 0
+	}
+	known := caseWords(c.Alert + " " + strings.Join(c.Symptoms, " "))
+	hits := 0
+	for w := range query {
+		if known[w] {
+			hits++
+		}
+	}
+	return float64(hits) / float64(len(query))
+}
+
+func caseWords(text string) map[string]bool {
+	words := map[string]bool{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(normalize.Text(text)), func(r rune) bool {
+		return !('a' <= r && r <= 'z' || '0' <= r && r <= '9' || r == '.' || r == '_')
+	}) {
+		if len(w) > 2 {
+			words[w] = true
+		}
+	}
+	return words
+}
+
+// rankCases возвращает до n кейсов с близостью к алерту не ниже
+// caseThreshold, сначала ближайшие; из одинаково близких — самые новые.
+func rankCases(cases []Case, alert string, n int) []similarCase {
+	var found []similarCase
+	for _, c := range cases {
+		if s := similarity(alert, c); s >= caseThreshold {
+			found = append(found, similarCase{c, s})
+		}
+	}
+	slices.SortFunc(found, func(a, b similarCase) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), b.At.Compare(a.At))
+	})
+	return found[:min(len(found), n)]
+}
+
+// formatCases готовит вспомненные кейсы для промпта. Модели велено
+// сначала подтвердить симптомы: у того же алерта может быть другая причина.
+func formatCases(cases []similarCase) string {
+	var b strings.Builder
+	b.WriteString("Similar past incidents (confirm the symptoms before you reuse a fix):\n")
+	for i, c := range cases {
+		seen := ""
+		if c.Seen > 1 {
+			seen = fmt.Sprintf("; seen %d times", c.Seen)
+		}
+		fmt.Fprintf(&b, "%d. [%.0f%% similar, run %s] Alert: %s\n   Symptoms: %s\n   Root cause: %s\n   Fix: %s (resolved in %s, %d tool calls%s)\n",
+			i+1, c.Score*100, c.ID, c.Alert, strings.Join(c.Symptoms, "; "), c.RootCause,
+			strings.Join(c.Fix, " → "), c.Resolved, c.ToolCalls, seen)
+	}
+	return b.String()
+}
+
+// symptomsOf извлекает симптомы из наблюдения: HTTP-статус
+// или различные сообщения об ошибках из логов.
+func symptomsOf(tool, result string) []string {
+	switch tool {
+	case "check_http":
+		return []string{"HTTP " + result}
+	case "read_logs":
+		var errs []string
+		for _, line := range strings.Split(result, "\n") {
+			_, msg, ok := strings.Cut(line, " ERROR ")
+			if ok && !slices.Contains(errs, msg) {
+				errs = append(errs, msg)
+			}
+		}
+		return errs
+	}
+	return nil
+}
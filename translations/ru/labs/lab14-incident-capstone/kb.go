@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/qdrant"
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- База знаний (lab07) ---
+
+// runbooks — внутренняя документация, с которой агент должен свериться перед действием.
+var runbooks = map[string]string{
+	"payment_502.md": "Payment service returns 502: check_http, then read_logs. " +
+		"If logs show config or syntax errors, restart will NOT help — rollback_deploy. " +
+		"If logs show connection pool or network errors, restart_service. " +
+		"Always verify with check_http afterwards.",
+	"rollback_policy.md": "POLICY #12: Before rollback_deploy you MUST run backup_db. " +
+		"A rollback without a fresh backup is refused.",
+	"log_analysis.md": "Service logs are large. Don't read them line by line: " +
+		"pass the logs reference to analyze_logs with a pipeline like " +
+		"grep ERROR -> sort -> uniq (count) -> head 5 to get the most frequent errors.",
+	"postmortem.md": "After the incident is resolved, save a one-line lesson to memory: " +
+		"symptom, root cause, fix. Future incidents start by recalling these lessons.",
+}
+
+// findRunbooks ранжирует runbooks по числу слов запроса, которые в них есть, и
+// возвращает имена трёх лучших. Простого поиска по ключевым словам здесь
+// достаточно; где нужны embeddings, объясняет lab07.
+func findRunbooks(query string) []string {
+	type hit struct {
+		name  string
+		score int
+	}
+	var hits []hit
+	words := strings.Fields(strings.ToLower(query))
+	for name, text := range runbooks {
+		doc := strings.ToLower(name + " " + text)
+		score := 0
+		for _, w := range words {
+			if len(w) > 2 && strings.Contains(doc, w) {
+				score++
+			}
+		}
+		if score > 0 {
+			hits = append(hits, hit{name, score})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		return hits[i].name < hits[j].name
+	})
+
+	var names []string
+	for i, h := range hits {
+		if i == 3 {
+			break
+		}
+		names = append(names, h.name)
+	}
+	return names
+}
+
+// keywordRunbooks — это findRunbooks в роли incident.kb.
+func keywordRunbooks(_ context.Context, query string) []string {
+	return findRunbooks(query)
+}
+
+func formatRunbooks(names []string) string {
+	if len(names) == 0 {
+		return "No documents found matching your query."
+	}
+	var parts []string
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("File: %s\nContent: %s", name, runbooks[name]))
+	}
+	return strings.Join(parts, "\n---\n")
+}
+
+// --- База знаний в Qdrant (QDRANT_URL) ---
+//
+// Четыре runbook помещаются в map, и их находят ключевые слова. С заданным
+// QDRANT_URL, как в демо-окружении (deploy/), они хранятся в Qdrant: каждый
+// runbook получает embedding при старте, а запрос сопоставляется по смыслу,
+// как в lab07. Неудачный поиск откатывается к ключевым словам: агент всё
+// равно получает свои runbooks.
+
+// runbookCollection — коллекция Qdrant с runbooks.
+const runbookCollection = "runbooks"
+
+// runbookEmbeddings строит embeddings runbooks и запросов;
+// LLM_EMBEDDING_MODEL её переопределяет (nomic-embed-text на Ollama).
+const runbookEmbeddings = openai.SmallEmbedding3
+
+// vectorRunbooks ищет runbooks в Qdrant.
+type vectorRunbooks struct {
+	db     *qdrant.Client
+	client llm.Provider
+}
+
+// openVectorRunbooks строит embeddings runbooks и сохраняет их на сервере
+// Qdrant по адресу url. Runbook хранится под хешем своего имени, поэтому
+// второй запуск заменяет точки первого.
+func openVectorRunbooks(ctx context.Context, client llm.Provider, url string) (*vectorRunbooks, error) {
+	var names, texts []string
+	for name := range runbooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		texts = append(texts, name+" "+runbooks[name])
+	}
+	vecs, err := embed(ctx, client, texts)
+	if err != nil {
+		return nil, err
+	}
+	db := qdrant.New(url)
+	if err := db.EnsureCollection(ctx, runbookCollection, len(vecs[0])); err != nil {
+		return nil, err
+	}
+	var points []qdrant.Point
+	for i, name := range names {
+		points = append(points, qdrant.Point{ID: qdrant.IDOf(name), Vector: vecs[i], Payload: map[string]any{"name": name}})
+	}
+	if err := db.Upsert(ctx, runbookCollection, points); err != nil {
+		return nil, err
+	}
+	return &vectorRunbooks{db: db, client: client}, nil
+}
+
+// find возвращает имена трёх runbooks, ближайших к query.
+func (kb *vectorRunbooks) find(ctx context.Context, query string) []string {
+	vecs, err := embed(ctx, kb.client, []string{query})
+	var hits []qdrant.Hit
+	if err == nil {
+		hits, err = kb.db.Search(ctx, runbookCollection, vecs[0], 3)
+	}
+	if err != nil {
+		fmt.Println("⚠️  Vector search failed, using keywords:", err)
+		return findRunbooks(query)
+	}
+	var names []string
+	for _, h := range hits {
+		if name, ok := h.Payload["name"].(string); ok && runbooks[name] != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// embed возвращает embeddings текстов texts по порядку.
+func embed(ctx context.Context, client llm.Provider, texts []string) ([][]float32, error) {
+	resp, err := client.Embeddings(ctx, openai.EmbeddingRequest{Input: texts, Model: runbookEmbeddings})
+	if err != nil {
+		return nil, fmt.Errorf("embeddings: %w", err)
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("embeddings: %d vectors for %d texts", len(resp.Data), len(texts))
+	}
+	vecs := make([][]float32, len(texts))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("embeddings: vector index %d out of range", d.Index)
+		}
+		vecs[d.Index] = d.Embedding
+	}
+	return vecs, nil
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kshvakov/agent/pkg/agent"
+	"github.com/kshvakov/agent/pkg/blobs"
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/normalize"
+	"github.com/kshvakov/agent/pkg/prompts"
+	"github.com/kshvakov/agent/pkg/redact"
+	"github.com/kshvakov/agent/pkg/runs"
+	"github.com/kshvakov/agent/pkg/schema"
+	"github.com/kshvakov/agent/pkg/tools"
+	"github.com/kshvakov/agent/pkg/tools/toolserver"
+	"github.com/kshvakov/agent/pkg/trace"
+	"github.com/sashabaranov/go-openai"
+)
+
+// maxInlineOutput — наибольший вывод инструмента, который возвращается модели как есть.
+// Большие выводы (логи, результаты пайплайнов) паркуются в хранилище блобов.
+const maxInlineOutput = 1500
+
+// incident хранит состояние, с которым работают инструменты.
+type incident struct {
+	env    *env
+	memory *memoryStore
+	blobs  *blobs.Store
+
+	// kb находит runbooks для запроса: keywordRunbooks или векторный поиск
+	// в Qdrant с заданным QDRANT_URL (kb.go).
+	kb func(ctx context.Context, query string) []string
+
+	// Что сделал запуск, для его кейса (cases.go).
+	calls    int
+	symptoms []string
+	fix      []string
+	lesson   string // Последний сохранённый урок
+}
+
+// afterTool выполняется после каждого вызова: записывает вызов для кейса, паркует
+// большие выводы и сдвигает симулированные часы. Валидацию и диспетчеризацию
+// выполняет pkg/agent.
+func (inc *incident) afterTool(call openai.ToolCall, result string) string {
+	inc.observe(call.Function.Name, result)
+	if parked, err := inc.blobs.Park(result, maxInlineOutput); err == nil {
+		result = parked
+	}
+	return fmt.Sprintf("[%s] %s", inc.env.advance(call.Function.Name), result)
+}
+
+// observe считает вызов и запоминает, что он показал: симптомы до
+// первого действия, затем действия, которые сработали.
+func (inc *incident) observe(tool, result string) {
+	inc.calls++
+	if !slices.Contains(actionTools, tool) {
+		if len(inc.fix) == 0 {
+			for _, s := range symptomsOf(tool, result) {
+				if !slices.Contains(inc.symptoms, s) {
+					inc.symptoms = append(inc.symptoms, s)
+				}
+			}
+		}
+		return
+	}
+	if !tools.IsError(result) && !strings.Contains(result, " did not run: ") { // Повтор Once-инструмента
+		inc.fix = append(inc.fix, tool)
+	}
+}
+
+// tools объявляет все инструменты incident-агента.
+func (inc *incident) tools() []agent.Tool {
+	noArgs := func(fn func() string) func(context.Context, json.RawMessage) (string, error) {
+		return func(context.Context, json.RawMessage) (string, error) { return fn(), nil }
+	}
+	var tools []agent.Tool
+	register := func(t agent.Tool) { tools = append(tools, t) }
+
+	// Симулятор (lab06)
+	register(agent.Tool{Name: "check_http", Description: "Check the payment service HTTP status.", Execute: noArgs(inc.env.checkHTTP)})
+	register(agent.Tool{Name: "read_logs", Description: "Read recent payment service logs. Large: returns the first lines and a blob reference for analyze_logs.", Execute: noArgs(inc.env.readLogs)})
+	register(agent.Tool{Name: "backup_db", Description: "Back up the payments database. Takes about 3 minutes.", Execute: noArgs(inc.env.backupDB)})
+	register(agent.Tool{Name: "restart_service", Description: "Restart the payment service.",
+		Execute: func(context.Context, json.RawMessage) (string, error) {
+			result := inc.env.restartService()
+			if strings.HasPrefix(result, "Failed") {
+				return "", errors.New(result)
+			}
+			return result, nil
+		}})
+	// Второй откат ушёл бы ещё на одну версию назад: повтор в том же
+	// запуске получает результат первого (Tool.Once). Отклонённый —
+	// это ошибка, поэтому его можно выполнить после бэкапа.
+	register(agent.Tool{Name: "rollback_deploy", Description: "Roll back the payment service to the previous version.", Once: true,
+		Execute: func(context.Context, json.RawMessage) (string, error) {
+			result := inc.env.rollback()
+			if strings.HasPrefix(result, "REFUSED") {
+				return "", errors.New(result)
+			}
+			return result, nil
+		}})
+
+	// База знаний (lab07)
+	register(agent.Tool{
+		Name:        "search_knowledge_base",
+		Description: "Search runbooks and policies. Use before any action that might have a procedure or policy.",
+		Params:      schema.Object().Prop("query", schema.String("Keywords, e.g. 'payment 502 rollback'")).Require("query"),
+		Execute: func(ctx context.Context, raw json.RawMessage) (string, error) {
+			var args struct {
+				Query string `json:"query"`
+			}
+			if err := json.Unmarshal(raw, &args); err != nil {
+				return "", err
+			}
+			// Runbooks становятся происхождением результата: финальный
+			// ответ можно проследить до политик, которым он следовал.
+			names := inc.kb(ctx, args.Query)
+			agent.Annotate(ctx, runs.MessageMeta{Docs: names})
+			return formatRunbooks(names), nil
+		},
+	})
+
+	// Пайплайны над блобами (lab13)
+	step := schema.Object().
+		Prop("tool", schema.Enum("", "grep", "cut", "sort", "uniq", "head")).
+		Prop("args", schema.Object()).
+		Require("tool")
+	register(agent.Tool{
+		Name: "analyze_logs",
+		Description: "Run a text pipeline over logs. Steps run in order: grep {pattern}, cut (drops timestamps), " +
+			"sort, uniq (counts, most frequent first), head {lines}.",
+		Params: schema.Object().
+			Prop("input", schema.String("A blob:<hash> reference from read_logs (or inline text)")).
+			Prop("steps", schema.Array(step, "Pipeline steps")).
+			Require("input", "steps"),
+		Execute: func(ctx context.Context, raw json.RawMessage) (string, error) {
+			var args struct {
+				Input string         `json:"input"`
+				Steps []PipelineStep `json:"steps"`
+			}
+			if err := json.Unmarshal(raw, &args); err != nil {
+				return "", err
+			}
+			input, err := inc.blobs.Resolve(args.Input)
+			if err != nil {
+				return "", err
+			}
+			return runPipeline(args.Steps, input)
+		},
+	})
+
+	// Долговременная память (lab11)
+	register(agent.Tool{
+		Name:        "memory_recall",
+		Description: "Search lessons from past incidents by keywords.",
+		Params:      schema.Object().Prop("query", schema.String("")).Require("query"),
+		Execute: func(ctx context.Context, raw json.RawMessage) (string, error) {
+			var args struct {
+				Query string `json:"query"`
+			}
+			if err := json.Unmarshal(raw, &args); err != nil {
+				return "", err
+			}
+			notes := inc.memory.Recall(normalize.Text(args.Query))
+			if len(notes) == 0 {
+				return "No lessons found.", nil
+			}
+			data, err := json.Marshal(notes)
+			return string(data), err
+		},
+	})
+	register(agent.Tool{
+		Name:        "memory_save",
+		Description: "Save a lesson for future incidents: symptom, root cause, fix.",
+		Params: schema.Object().
+			Prop("key", schema.String("Short identifier, e.g. 'payment-502-bad-config'")).
+			Prop("value", schema.String("The lesson")).
+			Require("key", "value"),
+		Execute: func(ctx context.Context, raw json.RawMessage) (string, error) {
+			var args struct {
+				Key   string `json:"key"`
+				Value string `json:"value"`
+			}
+			if err := json.Unmarshal(raw, &args); err != nil {
+				return "", err
+			}
+			// Уроки переживают запуск: учётные данные и персональные данные
+			// в них маскируются до записи, даты, версии и размеры
+			// записываются единообразно, чтобы recall их находил.
+			value, masked := redact.Text(args.Value)
+			value = normalize.Text(value)
+			if err := inc.memory.Save(args.Key, value); err != nil {
+				return "", err
+			}
+			inc.lesson = value
+			if len(masked) > 0 {
+				agent.Annotate(ctx, runs.MessageMeta{Redactions: []string{"masked in memory: " + strings.Join(masked, ", ")}})
+				return "Saved, with " + strings.Join(masked, ", ") + " masked.", nil
+			}
+			return "Saved.", nil
+		},
+	})
+	return tools
+}
+
+var systemPrompt = prompts.Must("incident", prompts.Incident{
+	Service: "the Payment Service",
+	Rules: []string{
+		"Consult the knowledge base before risky actions (restart, rollback); obey its policies.",
+		"Large outputs come back as a blob:<hash> reference. Pass references to analyze_logs instead of copying data.",
+		"Verify the fix with check_http.",
+		"When resolved, save a lesson with memory_save, then reply with one line: what was fixed.",
+	},
+	SimulatedTime: true,
+})
+
+const reportPrompt = `Write a short incident report for the team: impact, root cause, what you did (with times), and the lesson saved.`
+
+func main() {
+	scenario := flag.String("scenario", "config", "incident scenario: config | network")
+	memoryPath := flag.String("memory", "incident-memory.json", "file with lessons and resolved incidents from past runs")
+	recall := flag.Bool("recall", true, "put the most similar past incidents into the context before the diagnosis (-recall=false to compare)")
+	temps := flag.String("temperatures", "", "per-phase temperatures, e.g. tools=0,json=0,report=0.7")
+	flag.Parse()
+
+	temperatures, err := agent.ParseTemperatures(*temps)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	environment, err := newEnv(*scenario)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	memory, err := openMemory(*memoryPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "memory:", err)
+		os.Exit(1)
+	}
+
+	// LLM_PROVIDER выбирает бэкенд: openai (любой OpenAI-совместимый сервер), llamacpp, ollama, anthropic.
+	client, err := llm.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	// Шаги пишутся как события (см. pkg/trace); с AGENT_EVENTS=<addr>
+	// они ещё и стримятся вживую, для agentctl watch.
+	tr, err := trace.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer tr.Close()
+
+	// Ctrl+C останавливает запуск после текущего шага и печатает, что сделано.
+	ctx, stop := agent.Interruptible(context.Background())
+	defer stop()
+
+	// Артефакты запуска (транскрипт, план, блобы, отчёт) пишутся в runs/<id>/.
+	run, err := runs.New(runs.Root(), "lab14-incident-capstone", "gpt-4o-mini")
+	if err != nil {
+		panic(fmt.Sprintf("Run artifacts: %v", err))
+	}
+	status := "gave_up"
+	defer func() { run.Close(status) }()
+
+	store, err := run.Blobs()
+	if err != nil {
+		panic(fmt.Sprintf("Blob store: %v", err))
+	}
+
+	inc := &incident{env: environment, memory: memory, blobs: store, kb: keywordRunbooks}
+	if url := os.Getenv("QDRANT_URL"); url != "" {
+		kb, err := openVectorRunbooks(ctx, client, url)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "knowledge base:", err)
+			os.Exit(1)
+		}
+		inc.kb = kb.find
+		fmt.Println("📚 Runbooks in Qdrant at", url)
+	}
+	a := agent.New(client, agent.Config{
+		SystemPrompt:  systemPrompt,
+		MaxIterations: 20,
+		Temperatures:  temperatures,
+		Run:           run,
+		Trace:         tr,
+		Hooks: agent.Hooks{
+			OnThought: func(content string) {
+				fmt.Printf("\n🧠 Thought: %s\n", content)
+			},
+			OnToolCall: func(call openai.ToolCall) {
+				fmt.Printf("🔧 Call: %s %s\n", call.Function.Name, call.Function.Arguments)
+			},
+			OnToolResult: func(call openai.ToolCall, result string) string {
+				result = inc.afterTool(call, result)
+				fmt.Printf("📦 Result: %s\n", result)
+				return result
+			},
+		},
+	})
+	for _, t := range inc.tools() {
+		a.RegisterTool(t)
+	}
+	// С заданным AGENT_TOOL_SERVER инструменты tool server (Lab 12,
+	// agentctl toolserver) добавляются к собственным инструментам агента.
+	if url := os.Getenv("AGENT_TOOL_SERVER"); url != "" {
+		remote, err := toolserver.Load(ctx, url)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		for _, t := range remote {
+			a.RegisterTool(t)
+		}
+		fmt.Printf("🔌 %d tools from %s\n", len(remote), url)
+	}
+
+	alert := "Payment Service is down (502). Fix it."
+	fmt.Printf("🚨 ALERT [%s]: %s\n", environment.clock.Now().Format("15:04:05"), alert)
+	fmt.Println("Run ID:", run.ID())
+
+	// 0. Прошлые инциденты, похожие на этот, до любой проверки.
+	var similar []similarCase
+	var pastCases string
+	if *recall {
+		similar = memory.SimilarCases(alert, 3)
+	}
+	if len(similar) > 0 {
+		pastCases = formatCases(similar)
+		fmt.Printf("\n🗂  %s", pastCases)
+	}
+
+	// 1. План с учётом runbooks, прошлых уроков и прошлых инцидентов.
+	var lessons []string
+	for _, n := range memory.Recall(alert) {
+		lessons = append(lessons, "- "+n.Value)
+	}
+	if len(lessons) == 0 {
+		lessons = []string{"(none yet)"}
+	}
+	if pastCases != "" {
+		lessons = append(lessons, "", pastCases)
+	}
+	plan, err := createPlan(ctx, client, alert, formatRunbooks(inc.kb(ctx, alert)), strings.Join(lessons, "\n"), a.ToolNames(), temperatures.For(agent.PhaseJSON))
+	var planText string
+	if err != nil {
+		// Отсутствие плана не фатально: у агента всё ещё есть runbooks.
+		fmt.Println("⚠️  Planning failed, continuing without a plan:", err)
+		planText = "No plan: investigate first, then follow the runbooks."
+	} else {
+		run.WritePlan(plan)
+		planText = plan.String()
+	}
+	fmt.Printf("\n📋 Plan:\n%s\n", planText)
+
+	// 2. Цикл инструментов (pkg/agent) по плану.
+	task := alert + "\n\n"
+	if pastCases != "" {
+		task += pastCases + "\n"
+	}
+	answer, err := a.Run(ctx, task+"Plan:\n"+planText)
+	switch {
+	case errors.Is(err, context.Canceled):
+		status = "interrupted"
+		fmt.Printf("\n⏹  Interrupted. So far:\n%s", a.Recap())
+	case errors.Is(err, agent.ErrMaxIterations):
+		fmt.Println("Agent gave up:", err)
+	case err != nil:
+		status = "failed"
+		panic(fmt.Sprintf("API Error: %v", err))
+	default:
+		fmt.Printf("\n🤖 Agent: %s\n", answer)
+		// 3. Отчёт — текст для людей: отдельный ход, без инструментов, температура выше.
+		report, err := a.Report(ctx, reportPrompt)
+		if err != nil {
+			report = answer
+		}
+		fmt.Printf("\n📝 Report:\n%s\n", report)
+		run.WriteReport(report)
+		if environment.status == "running" {
+			status = "success"
+			// 4. Кейс для следующего такого же алерта.
+			c := Case{
+				ID: run.ID(), Alert: alert, Symptoms: inc.symptoms, RootCause: cmp.Or(inc.lesson, answer), Fix: inc.fix,
+				Resolved: environment.clock.Since(environment.startedAt), ToolCalls: inc.calls, At: time.Now().UTC(),
+			}
+			if err := memory.SaveCase(c); err != nil {
+				fmt.Println("⚠️  Case not saved:", err)
+			}
+			printSpeedup(c, similar)
+		} else {
+			status = "failed"
+		}
+	}
+
+	fmt.Printf("\n⏱  %s\n", environment.summary())
+	fmt.Println("Artifacts:", run.Dir)
+}
+
+// printSpeedup сравнивает запуск со вспомненным инцидентом, исправленным
+// тем же способом, если такой был: сколько времени и вызовов сэкономил recall.
+func printSpeedup(c Case, similar []similarCase) {
+	i := slices.IndexFunc(similar, func(s similarCase) bool { return slices.Equal(s.Fix, c.Fix) })
+	if i < 0 {
+		fmt.Printf("\n🗂  Recorded as a new case: %s in %s, %d tool calls\n", strings.Join(c.Fix, " → "), c.Resolved, c.ToolCalls)
+		return
+	}
+	past := similar[i]
+	fmt.Printf("\n🗂  Same fix as past incident %s: %s and %d tool calls now, %s and %d then\n",
+		past.ID, c.Resolved, c.ToolCalls, past.Resolved, past.ToolCalls)
+}
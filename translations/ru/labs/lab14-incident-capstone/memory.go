@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Долговременная память (lab11) ---
+//
+// Уроки прошлых инцидентов переживают запуски в JSON-файле.
+// Агент управляет ими сам через memory_save / memory_recall.
+// В том же файле хранятся решённые инциденты (cases.go), которые
+// записывает программа.
+
+// Note — одна запись в долговременной памяти.
+type Note struct {
+	Key       string    `json:"key"`
+	Value     string    `json:"value"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// memoryStore — решённый FileStore из lab11.
+type memoryStore struct {
+	mu    sync.Mutex
+	path  string
+	notes []Note
+	cases []Case
+}
+
+// memoryFile — формат файла. Файл с голым списком заметок, как его
+// писали до кейсов, тоже читается.
+type memoryFile struct {
+	Notes []Note `json:"notes"`
+	Cases []Case `json:"cases,omitempty"`
+}
+
+func openMemory(path string) (*memoryStore, error) {
+	m := &memoryStore{path: path}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		return m, json.Unmarshal(data, &m.notes)
+	}
+	var f memoryFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	m.notes, m.cases = f.Notes, f.Cases
+	return m, nil
+}
+
+// Save добавляет или обновляет заметку по ключу.
+func (m *memoryStore) Save(key, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	note := Note{Key: key, Value: value, CreatedAt: time.Now().UTC()}
+	for i := range m.notes {
+		if m.notes[i].Key == key {
+			m.notes[i] = note
+			return m.flush()
+		}
+	}
+	m.notes = append(m.notes, note)
+	return m.flush()
+}
+
+// Recall возвращает до 5 заметок, в которых есть любое слово запроса.
+func (m *memoryStore) Recall(query string) []Note {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	words := strings.Fields(strings.ToLower(query))
+	var found []Note
+	for _, n := range m.notes {
+		text := strings.ToLower(n.Key + " " + n.Value)
+		for _, w := range words {
+			if len(w) > 2 && strings.Contains(text, w) {
+				found = append(found, n)
+				break
+			}
+		}
+		if len(found) == 5 {
+			break
+		}
+	}
+	return found
+}
+
+// SaveCase записывает решённый инцидент. Виденный раньше заменяет свою
+// старую запись и считает разы: следовать нужно самому новому запуску.
+func (m *memoryStore) SaveCase(c Case) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c.Seen = 1
+	for i := range m.cases {
+		if sameCase(m.cases[i], c) {
+			c.Seen += m.cases[i].Seen
+			m.cases[i] = c
+			return m.flush()
+		}
+	}
+	m.cases = append(m.cases, c)
+	return m.flush()
+}
+
+// SimilarCases возвращает до n прошлых инцидентов, похожих на alert,
+// сначала ближайшие.
+func (m *memoryStore) SimilarCases(alert string, n int) []similarCase {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return rankCases(m.cases, alert, n)
+}
+
+func (m *memoryStore) flush() error {
+	data, err := json.MarshalIndent(memoryFile{Notes: m.notes, Cases: m.cases}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(m.path, data, 0o644)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kshvakov/agent/pkg/llm"
+	"github.com/kshvakov/agent/pkg/parse"
+	"github.com/kshvakov/agent/pkg/schema"
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Планирование (lab10) ---
+//
+// Прежде чем что-либо трогать, агент пишет план. План валидируется,
+// сохраняется как plan.json в каталоге запуска и затем направляет цикл инструментов:
+// lab10 выполняет планы своим рантаймом, здесь модель следует плану сама.
+//
+// План стримится, и каждый шаг проверяется, как только он готов
+// (parse.Elements): шаг с инструментом, которого у агента нет, или с id,
+// который уже занял более ранний шаг, останавливает стрим на месте. Модель
+// спрашивают снова, объяснив, что не так, вместо того чтобы дописывать план,
+// который всё равно выбросят.
+
+// Step — один шаг плана по инциденту.
+type Step struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	Tool        string `json:"tool,omitempty"` // Инструмент, который шаг собирается вызвать, если есть
+}
+
+// Plan — план реагирования на инцидент.
+type Plan struct {
+	Goal  string `json:"goal"`
+	Steps []Step `json:"steps"`
+}
+
+// planSchema проверяется до того, как план принят: план, которому модель
+// не может следовать, хуже, чем никакого плана.
+var planSchema = schema.Object().
+	Prop("goal", schema.String("What 'resolved' means for this incident")).
+	Prop("steps", schema.Array(schema.Object().
+		Prop("id", schema.String("")).
+		Prop("description", schema.String("")).
+		Prop("tool", schema.String("")).
+		Require("id", "description"), "")).
+	Require("goal", "steps")
+
+// planRepairs — сколько раз план, остановленный на плохом шаге,
+// запрашивается заново.
+const planRepairs = 2
+
+// badStep — шаг плана, не прошедший проверку, пока план стримился.
+type badStep struct {
+	Step    int // С 1
+	Problem string
+}
+
+func (e *badStep) Error() string {
+	return fmt.Sprintf("step %d: %s", e.Step, e.Problem)
+}
+
+// createPlan просит у модели план. Выдержки из runbooks и прошлые уроки
+// попадают в промпт, поэтому план начинается с того, что уже известно.
+// План — это JSON, поэтому температура берётся для PhaseJSON (по умолчанию 0).
+func createPlan(ctx context.Context, client llm.Provider, alert, runbookHints, lessons string, tools []string, temperature float32) (*Plan, error) {
+	prompt := fmt.Sprintf(`You are an SRE planning an incident response.
+Alert: %s
+
+Relevant runbooks:
+%s
+
+Lessons from past incidents:
+%s
+
+Available tools: %s
+
+Write a short plan (3-8 steps). Investigate before acting, respect policies from the runbooks,
+verify the fix at the end, and finish by saving a lesson to memory.
+Return JSON only: {"goal": "...", "steps": [{"id": "1", "description": "...", "tool": "..."}]}`,
+		alert, runbookHints, lessons, strings.Join(tools, ", "))
+
+	req := openai.ChatCompletionRequest{
+		Model:       "gpt-4o-mini",
+		Messages:    []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: prompt}},
+		Temperature: temperature,
+		// Схема уходит вместе с запросом: Ollama и llama.cpp
+		// (LLAMACPP_GRAMMAR=on) ограничивают ею декодирование.
+		ResponseFormat: &openai.ChatCompletionResponseFormat{
+			Type:       openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{Name: "plan", Schema: planSchema.Raw()},
+		},
+		Stream: true,
+	}
+	var text string
+	for attempt := 0; ; attempt++ {
+		var err error
+		text, err = streamPlan(ctx, client, req, tools)
+		var bad *badStep
+		if errors.As(err, &bad) && attempt < planRepairs {
+			fmt.Printf("✂️  Planner stopped at %v. Asking again.\n", bad)
+			req.Messages = append(req.Messages,
+				openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: text},
+				openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: fmt.Sprintf(
+					"Your plan was stopped at %v. Write the whole plan again with that step fixed. Use only the available tools.", bad)})
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("planner: %w", err)
+		}
+		break
+	}
+	// Без ограниченного декодирования схема — это просьба, а не
+	// гарантия: локальные модели всё ещё могут обернуть JSON в текст или code fence.
+	content, err := parse.JSON[json.RawMessage]()(text)
+	if err != nil {
+		return nil, fmt.Errorf("planner: %w", err)
+	}
+	if err := planSchema.Validate(content); err != nil {
+		return nil, fmt.Errorf("planner: %w", err)
+	}
+	var plan Plan
+	if err := json.Unmarshal(content, &plan); err != nil {
+		return nil, fmt.Errorf("planner returned invalid JSON: %w", err)
+	}
+	if len(plan.Steps) == 0 {
+		return nil, fmt.Errorf("planner returned no steps")
+	}
+	return &plan, nil
+}
+
+// streamPlan стримит ответ планировщика и проверяет каждый шаг, как только
+// он готов. Первый плохой шаг останавливает стрим; текст на этот момент
+// возвращается вместе с *badStep.
+func streamPlan(ctx context.Context, client llm.Provider, req openai.ChatCompletionRequest, tools []string) (string, error) {
+	stream, err := client.Stream(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	var ids []string
+	steps := parse.NewElements("steps", func(i int, raw json.RawMessage) error {
+		var step Step
+		if err := json.Unmarshal(raw, &step); err != nil {
+			return &badStep{i + 1, "not a step object"}
+		}
+		if slices.Contains(ids, step.ID) {
+			return &badStep{i + 1, fmt.Sprintf("id %q is taken by an earlier step", step.ID)}
+		}
+		if step.Tool != "" && !slices.Contains(tools, step.Tool) {
+			return &badStep{i + 1, fmt.Sprintf("there is no tool %q (available: %s)", step.Tool, strings.Join(tools, ", "))}
+		}
+		ids = append(ids, step.ID)
+		return nil
+	})
+	resp, err := llm.CollectUntil(stream, steps.Write)
+	if len(resp.Choices) == 0 {
+		return "", err
+	}
+	return resp.Choices[0].Message.Content, err
+}
+
+// String выводит план для диалога и консоли.
+func (p *Plan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Goal: %s\n", p.Goal)
+	for _, s := range p.Steps {
+		fmt.Fprintf(&b, "%s. %s", s.ID, s.Description)
+		if s.Tool != "" {
+			fmt.Fprintf(&b, " [%s]", s.Tool)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}